@@ -0,0 +1,282 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StorageProvider is the storage the snapshots are uploaded to.
+// +kubebuilder:validation:Enum=S3;GCS;Azure;PVC;HostPath
+type StorageProvider string
+
+const (
+	// StorageProviderS3 uploads the snapshots to S3, or an S3-compatible
+	// service.
+	StorageProviderS3 StorageProvider = "S3"
+	// StorageProviderGCS uploads the snapshots to Google Cloud Storage.
+	StorageProviderGCS StorageProvider = "GCS"
+	// StorageProviderAzure uploads the snapshots to Azure Blob Storage.
+	StorageProviderAzure StorageProvider = "Azure"
+	// StorageProviderPVC writes the snapshots to a PersistentVolumeClaim,
+	// without an object storage.
+	StorageProviderPVC StorageProvider = "PVC"
+	// StorageProviderHostPath writes the snapshots to a directory of a node,
+	// without an object storage.
+	StorageProviderHostPath StorageProvider = "HostPath"
+)
+
+// EtcdBackupSpec defines the snapshot to take, and where to upload it.
+// +kubebuilder:validation:XValidation:rule="(self.storageProvider == 'S3') == has(self.s3) && (self.storageProvider == 'GCS') == has(self.gcs) && (self.storageProvider == 'Azure') == has(self.azure) && (self.storageProvider == 'PVC') == has(self.pvc) && (self.storageProvider == 'HostPath') == has(self.hostPath)",message="exactly the destination of the storageProvider must be set, among s3, gcs, azure, pvc and hostPath"
+type EtcdBackupSpec struct {
+	// ClusterName is the name of the EtcdCluster to back up, in the namespace
+	// of the EtcdBackup.
+	// +kubebuilder:validation:MinLength=1
+	ClusterName string `json:"clusterName"`
+	// StorageProvider is the storage the snapshot is uploaded to, S3, GCS,
+	// Azure, PVC or HostPath. Its destination, s3, gcs, azure, pvc or
+	// hostPath, must be set.
+	// +kubebuilder:default=S3
+	// +optional
+	StorageProvider StorageProvider `json:"storageProvider,omitempty"`
+	// S3 is the bucket the snapshot is uploaded to by the S3 provider.
+	// +optional
+	S3 *S3BackupDestination `json:"s3,omitempty"`
+	// GCS is the bucket the snapshot is uploaded to by the GCS provider.
+	// +optional
+	GCS *GCSBackupDestination `json:"gcs,omitempty"`
+	// Azure is the container the snapshot is uploaded to by the Azure
+	// provider.
+	// +optional
+	Azure *AzureBackupDestination `json:"azure,omitempty"`
+	// PVC is the volume the snapshot is written to by the PVC provider.
+	// +optional
+	PVC *PVCBackupDestination `json:"pvc,omitempty"`
+	// HostPath is the directory of a node the snapshot is written to by the
+	// HostPath provider.
+	// +optional
+	HostPath *HostPathBackupDestination `json:"hostPath,omitempty"`
+	// ServiceAccountName is the ServiceAccount the backup Job runs as, e.g.
+	// one bound to a cloud identity through workload identity. Defaults to
+	// the default ServiceAccount of the namespace.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// Encryption encrypts the snapshot before its upload. The snapshot is
+	// restored with the same key.
+	// +optional
+	Encryption *SnapshotEncryption `json:"encryption,omitempty"`
+	// Verify checks the snapshot once it is uploaded, with a Job: it reads
+	// the status of the snapshot, and restores it to a scratch directory.
+	// The outcome is recorded in the verified status.
+	// +optional
+	Verify bool `json:"verify,omitempty"`
+}
+
+// SnapshotEncryption is the key the snapshots are encrypted with, using
+// AES-256-GCM.
+type SnapshotEncryption struct {
+	// KeySecretRef references the key in a Secret, in the namespace of the
+	// EtcdBackup or the EtcdRestore. The key is 32 random bytes.
+	KeySecretRef corev1.SecretKeySelector `json:"keySecretRef"`
+}
+
+// S3BackupDestination is an S3, or S3-compatible, bucket holding snapshots.
+type S3BackupDestination struct {
+	// Bucket is the name of the bucket.
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+	// Key is the key of the snapshot in the bucket. Defaults to
+	// <namespace>/<cluster name>/<backup name>.db.
+	// +optional
+	Key string `json:"key,omitempty"`
+	// Region is the region of the bucket.
+	// +optional
+	Region string `json:"region,omitempty"`
+	// Endpoint is the URL of an S3-compatible service, e.g. MinIO. Defaults
+	// to the endpoint of AWS for the region.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// CredentialsSecretRef references the Secret, in the namespace of the
+	// EtcdBackup, holding the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+	// of the upload.
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+}
+
+// GCSBackupDestination is a Google Cloud Storage bucket holding snapshots.
+type GCSBackupDestination struct {
+	// Bucket is the name of the bucket.
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+	// Object is the name of the snapshot in the bucket. Defaults to
+	// <namespace>/<cluster name>/<backup name>.db.
+	// +optional
+	Object string `json:"object,omitempty"`
+	// CredentialsSecretRef references the Secret, in the namespace of the
+	// EtcdBackup, holding the key of a service account under key.json. When
+	// unset, the upload authenticates as the ServiceAccount of the Job,
+	// through the workload identity of GKE.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// AzureBackupDestination is an Azure Blob Storage container holding
+// snapshots.
+type AzureBackupDestination struct {
+	// StorageAccount is the name of the storage account.
+	// +kubebuilder:validation:MinLength=1
+	StorageAccount string `json:"storageAccount"`
+	// Container is the name of the container.
+	// +kubebuilder:validation:MinLength=1
+	Container string `json:"container"`
+	// Blob is the name of the snapshot in the container. Defaults to
+	// <namespace>/<cluster name>/<backup name>.db.
+	// +optional
+	Blob string `json:"blob,omitempty"`
+	// CredentialsSecretRef references the Secret, in the namespace of the
+	// EtcdBackup, holding the access key of the storage account under
+	// AZURE_STORAGE_KEY. When unset, the upload authenticates with the
+	// managed identity of the ServiceAccount of the Job, through Azure
+	// Workload Identity.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// PVCBackupDestination is a PersistentVolumeClaim holding snapshots, e.g.
+// in an air-gapped environment without object storage.
+type PVCBackupDestination struct {
+	// ClaimName is the name of the PersistentVolumeClaim, in the namespace of
+	// the EtcdBackup. A ReadWriteMany claim lets the backup Jobs of a
+	// schedule run on any node.
+	// +kubebuilder:validation:MinLength=1
+	ClaimName string `json:"claimName"`
+	// Path is the path of the snapshot in the volume, relative and without
+	// .. segments. Defaults to <namespace>/<cluster name>/<backup name>.db.
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="!self.startsWith('/') && !self.matches('(^|/)[.][.](/|$)')",message="must be a relative path without .. segments"
+	Path string `json:"path,omitempty"`
+}
+
+// HostPathBackupDestination is a pre-provisioned directory of a node holding
+// snapshots. The backup Jobs run on that node. The operator only writes to
+// the directories its --backup-host-path-dirs flag allows.
+type HostPathBackupDestination struct {
+	// NodeName is the name of the node holding the directory.
+	// +kubebuilder:validation:MinLength=1
+	NodeName string `json:"nodeName"`
+	// Directory is the absolute path of the directory on the node. It must
+	// exist, in one of the directories the operator allows.
+	// +kubebuilder:validation:Pattern=`^/`
+	// +kubebuilder:validation:XValidation:rule="!self.matches('(^|/)[.][.](/|$)')",message="must not have .. segments"
+	Directory string `json:"directory"`
+	// Path is the path of the snapshot in the directory, relative and
+	// without .. segments. Defaults to
+	// <namespace>/<cluster name>/<backup name>.db.
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="!self.startsWith('/') && !self.matches('(^|/)[.][.](/|$)')",message="must be a relative path without .. segments"
+	Path string `json:"path,omitempty"`
+}
+
+// EtcdBackupPhase is the progress of an EtcdBackup.
+type EtcdBackupPhase string
+
+const (
+	// EtcdBackupPhaseRunning is the phase of a backup being taken.
+	EtcdBackupPhaseRunning EtcdBackupPhase = "Running"
+	// EtcdBackupPhaseCompleted is the phase of a backup uploaded to its
+	// bucket.
+	EtcdBackupPhaseCompleted EtcdBackupPhase = "Completed"
+	// EtcdBackupPhaseFailed is the phase of a backup that couldn't be
+	// taken. The operator doesn't retry it.
+	EtcdBackupPhaseFailed EtcdBackupPhase = "Failed"
+)
+
+// EtcdBackupStatus defines the observed state of EtcdBackup.
+type EtcdBackupStatus struct {
+	// Phase is the progress of the backup.
+	// +optional
+	Phase EtcdBackupPhase `json:"phase,omitempty"`
+	// Message explains why the backup, or its verification, failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Location is the URL of the snapshot: its s3:// or gs:// URL, the
+	// https:// URL of its Azure blob, its pvc://<claim name>/<path> URL, or
+	// its file://<node name>/<path> URL.
+	// +optional
+	Location string `json:"location,omitempty"`
+	// Size is the size of the snapshot, in bytes.
+	// +optional
+	Size int64 `json:"size,omitempty"`
+	// Revision is the revision of the cluster when the backup started. The
+	// snapshot holds at least this revision.
+	// +optional
+	Revision int64 `json:"revision,omitempty"`
+	// StartTime is when the backup started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the snapshot was uploaded.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Verified tells whether the snapshot passed its verification, when the
+	// spec asks for one. It is unset until the verification finishes.
+	// +optional
+	Verified *bool `json:"verified,omitempty"`
+	// SnapshotRevision is the latest revision of the snapshot, as read by
+	// its verification.
+	// +optional
+	SnapshotRevision int64 `json:"snapshotRevision,omitempty"`
+	// SnapshotHash is the hash of the snapshot, as read by its verification:
+	// the one of `etcdutl snapshot status`.
+	// +optional
+	SnapshotHash int64 `json:"snapshotHash,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// EtcdBackup is the Schema for the etcdbackups API.
+// It takes a snapshot of an EtcdCluster once, and uploads it to an object
+// storage, a volume or a directory of a node.
+type EtcdBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="the spec of an EtcdBackup is immutable, create another EtcdBackup instead"
+	Spec   EtcdBackupSpec   `json:"spec,omitempty"`
+	Status EtcdBackupStatus `json:"status,omitempty"`
+}
+
+// DefaultSnapshotName returns the name of the snapshot of b when its
+// destination doesn't name it: <namespace>/<cluster name>/<backup name>.db.
+func (b *EtcdBackup) DefaultSnapshotName() string {
+	return fmt.Sprintf("%s/%s/%s.db", b.Namespace, b.Spec.ClusterName, b.Name)
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdBackupList contains a list of EtcdBackup.
+type EtcdBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdBackup{}, &EtcdBackupList{})
+}
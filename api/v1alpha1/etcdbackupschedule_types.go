@@ -0,0 +1,106 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BackupScheduleLabel is set on the EtcdBackups created by an
+// EtcdBackupSchedule, to the name of the schedule.
+const BackupScheduleLabel = "operator.etcd.io/backup-schedule"
+
+// EtcdBackupScheduleSpec defines when EtcdBackups are taken, and how many of
+// them are kept.
+type EtcdBackupScheduleSpec struct {
+	// Schedule is the cron schedule of the backups, in UTC, e.g.
+	// "0 */6 * * *" or "@daily".
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+	// Retention is the number of completed backups kept. The older ones are
+	// deleted along with their snapshot. Defaults to 7.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Retention *int32 `json:"retention,omitempty"`
+	// Suspend stops the creation of new backups. The retention still
+	// applies.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+	// StartingDeadlineSeconds is how late a backup may start after its
+	// scheduled time, e.g. once the operator is back after a downtime. The
+	// backups missing their deadline are skipped. When unset, the last
+	// missed backup is taken however late.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+	// BackupTemplate is the template of the EtcdBackups. The name of their
+	// snapshot, the S3 key, the GCS object, the Azure blob or the path in a
+	// volume or directory, must be left empty, so each backup has its own
+	// snapshot.
+	// +kubebuilder:validation:XValidation:rule="(!has(self.spec.s3) || !has(self.spec.s3.key) || self.spec.s3.key == '') && (!has(self.spec.gcs) || !has(self.spec.gcs.object) || self.spec.gcs.object == '') && (!has(self.spec.azure) || !has(self.spec.azure.blob) || self.spec.azure.blob == '')",message="the backups of a schedule must not set the name of their snapshot"
+	// +kubebuilder:validation:XValidation:rule="(!has(self.spec.pvc) || !has(self.spec.pvc.path) || self.spec.pvc.path == '') && (!has(self.spec.hostPath) || !has(self.spec.hostPath.path) || self.spec.hostPath.path == '')",message="the backups of a schedule must not set the path of their snapshot"
+	BackupTemplate EtcdBackupTemplate `json:"backupTemplate"`
+}
+
+// EtcdBackupTemplate is the template of the EtcdBackups of an
+// EtcdBackupSchedule.
+type EtcdBackupTemplate struct {
+	// Labels are added to the EtcdBackups.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Spec is the spec of the EtcdBackups.
+	Spec EtcdBackupSpec `json:"spec"`
+}
+
+// EtcdBackupScheduleStatus defines the observed state of EtcdBackupSchedule.
+type EtcdBackupScheduleStatus struct {
+	// LastScheduleTime is the scheduled time of the last backup.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastBackupName is the name of the last EtcdBackup created.
+	// +optional
+	LastBackupName string `json:"lastBackupName,omitempty"`
+	// NextScheduleTime is the scheduled time of the next backup.
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// EtcdBackupSchedule is the Schema for the etcdbackupschedules API.
+// It creates EtcdBackups on a cron schedule, and deletes the oldest ones.
+type EtcdBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdBackupScheduleSpec   `json:"spec,omitempty"`
+	Status EtcdBackupScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdBackupScheduleList contains a list of EtcdBackupSchedule.
+type EtcdBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdBackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdBackupSchedule{}, &EtcdBackupScheduleList{})
+}
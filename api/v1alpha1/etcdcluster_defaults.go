@@ -0,0 +1,349 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// DefaultEtcdVersion is the etcd version used when spec.version is not set.
+	DefaultEtcdVersion = "v3.5.21"
+	// DefaultClusterSize is the size given to an EtcdCluster created without spec.size.
+	DefaultClusterSize = 3
+	// DefaultClientPort is the default port etcd serves client requests on.
+	DefaultClientPort int32 = 2379
+	// DefaultPeerPort is the default port etcd serves peer traffic on.
+	DefaultPeerPort int32 = 2380
+	// DefaultMetricsPort is the port the members of the clusters with TLS
+	// serve their metrics and health endpoints on, over plain HTTP, so the
+	// probes don't need a client certificate.
+	DefaultMetricsPort int32 = 2381
+	// DefaultVolumeSize is the default size of the volume requested for each member.
+	DefaultVolumeSize = "1Gi"
+	// DefaultKubeconfigSecretKey is the key of the kubeconfig Secret used when
+	// spec.kubeconfigSecretRef.key is not set.
+	DefaultKubeconfigSecretKey = "value"
+	// DefaultHealthCheckInterval is how often the members of an
+	// ExternalEtcdCluster are checked when spec.healthCheckInterval is not set.
+	DefaultHealthCheckInterval = time.Minute
+	// DefaultFragmentationThreshold is the percentage of unused space in the
+	// database of a member above which it is defragmented, when
+	// spec.defrag.fragmentationThreshold is not set.
+	DefaultFragmentationThreshold int32 = 50
+	// DefaultDefragMinDBSize is the size below which the database of a member
+	// isn't defragmented, when spec.defrag.minDBSize is not set.
+	DefaultDefragMinDBSize = "100Mi"
+	// DefaultBackupRetention is the number of completed backups an
+	// EtcdBackupSchedule keeps when spec.retention is not set.
+	DefaultBackupRetention int32 = 7
+	// DefaultFailoverThreshold is how long the source of an EtcdMirror must
+	// be unavailable before it is failed over automatically, when
+	// spec.failover.failureThreshold is not set.
+	DefaultFailoverThreshold = 5 * time.Minute
+)
+
+// SetEtcdClusterDefaults fills in the defaults of the optional fields of the
+// EtcdCluster spec. It is safe to call on both new and existing objects, and
+// calling it more than once has no further effect.
+//
+// spec.size is intentionally left alone: a size of 0 is meaningful for an
+// existing cluster, so it is only defaulted by the webhook on creation.
+func SetEtcdClusterDefaults(ec *EtcdCluster) {
+	spec := &ec.Spec
+
+	if spec.Version == "" {
+		spec.Version = DefaultEtcdVersion
+	}
+
+	if spec.DeletionPolicy == "" {
+		spec.DeletionPolicy = DeletionPolicyDelete
+	}
+
+	if spec.Ports == nil {
+		spec.Ports = &EtcdPorts{}
+	}
+	if spec.Ports.Client == 0 {
+		spec.Ports.Client = DefaultClientPort
+	}
+	if spec.Ports.Peer == 0 {
+		spec.Ports.Peer = DefaultPeerPort
+	}
+
+	if spec.StorageSpec != nil {
+		if spec.StorageSpec.AccessModes == "" {
+			spec.StorageSpec.AccessModes = corev1.ReadWriteOnce
+		}
+		if spec.StorageSpec.VolumeSizeRequest.IsZero() {
+			spec.StorageSpec.VolumeSizeRequest = resource.MustParse(DefaultVolumeSize)
+		}
+		if spec.StorageSpec.VolumeSizeLimit.IsZero() {
+			spec.StorageSpec.VolumeSizeLimit = spec.StorageSpec.VolumeSizeRequest
+		}
+	}
+
+	if spec.TLS != nil && spec.TLS.Provider == "" {
+		spec.TLS.Provider = TLSProviderAuto
+	}
+	if cfg := spec.TLS.CertManagerConfig(); cfg != nil {
+		if cfg.IssuerRef.Kind == "" {
+			cfg.IssuerRef.Kind = "Issuer"
+		}
+		if cfg.IssuerRef.Group == "" {
+			cfg.IssuerRef.Group = "cert-manager.io"
+		}
+	}
+
+	if spec.ConnectionSecret != nil && spec.ConnectionSecret.Name == "" {
+		spec.ConnectionSecret.Name = ec.Name + "-connection"
+	}
+
+	if svc := spec.ClientService; svc != nil {
+		if svc.Type == "" {
+			svc.Type = corev1.ServiceTypeClusterIP
+		}
+		if svc.SessionAffinity == "" {
+			svc.SessionAffinity = corev1.ServiceAffinityNone
+		}
+	}
+
+	if spec.MemberServices != nil && spec.MemberServices.Type == "" {
+		spec.MemberServices.Type = corev1.ServiceTypeClusterIP
+	}
+
+	if proxy := spec.GRPCProxy; proxy != nil {
+		if proxy.Replicas == nil {
+			proxy.Replicas = ptr.To[int32](1)
+		}
+		if proxy.Port == 0 {
+			proxy.Port = spec.Ports.Client
+		}
+	}
+
+	if gateway := spec.Gateway; gateway != nil {
+		if gateway.Replicas == nil {
+			gateway.Replicas = ptr.To[int32](1)
+		}
+		if gateway.Port == 0 {
+			gateway.Port = spec.Ports.Client
+		}
+	}
+
+	if spec.KubeconfigSecretRef != nil && spec.KubeconfigSecretRef.Key == "" {
+		spec.KubeconfigSecretRef.Key = DefaultKubeconfigSecretKey
+	}
+
+	if spec.PodTemplate == nil {
+		spec.PodTemplate = &PodTemplate{}
+	}
+	// The client port of the members with TLS requires a client certificate,
+	// so they are probed on their metrics port.
+	probePort := spec.Ports.Client
+	if spec.TLS.Enabled() {
+		probePort = DefaultMetricsPort
+	}
+	if spec.PodTemplate.LivenessProbe == nil {
+		spec.PodTemplate.LivenessProbe = &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{
+					Path:   "/livez",
+					Port:   intstr.FromInt32(probePort),
+					Scheme: corev1.URISchemeHTTP,
+				},
+			},
+			InitialDelaySeconds: 10,
+			PeriodSeconds:       10,
+			TimeoutSeconds:      5,
+			SuccessThreshold:    1,
+			FailureThreshold:    8,
+		}
+	}
+	if spec.PodTemplate.ReadinessProbe == nil {
+		// The full /readyz check fails on learners, which would keep a new
+		// member from ever becoming ready before the operator promotes it.
+		spec.PodTemplate.ReadinessProbe = &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{
+					Path:   "/readyz/serializable_read",
+					Port:   intstr.FromInt32(probePort),
+					Scheme: corev1.URISchemeHTTP,
+				},
+			},
+			PeriodSeconds:    5,
+			TimeoutSeconds:   5,
+			SuccessThreshold: 1,
+			FailureThreshold: 3,
+		}
+	}
+	if spec.PodTemplate.Scheduling == nil {
+		spec.PodTemplate.Scheduling = &PodScheduling{}
+	}
+	if spec.PodTemplate.Scheduling.Affinity == nil {
+		// Two members on the same node would both go with it. The selector
+		// matches the labels of the StatefulSet pods only, not those of the
+		// jobs of the cluster.
+		spec.PodTemplate.Scheduling.Affinity = &corev1.Affinity{
+			PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+					{
+						LabelSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{"app": ec.Name, "controller": ec.Name},
+						},
+						TopologyKey: corev1.LabelHostname,
+					},
+				},
+			},
+		}
+	}
+}
+
+// ApplyEtcdClusterTemplate fills in the fields of the EtcdCluster spec that
+// aren't set with the values of the template. It must be called before
+// SetEtcdClusterDefaults, so the template takes precedence over the defaults.
+func ApplyEtcdClusterTemplate(ec *EtcdCluster, tmpl *EtcdClusterTemplate) {
+	spec, tmplSpec := &ec.Spec, tmpl.Spec.DeepCopy()
+
+	if spec.Version == "" {
+		spec.Version = tmplSpec.Version
+	}
+	// The storage of the cluster, persistent or not, replaces the one of the
+	// template as a whole.
+	if spec.StorageSpec == nil && spec.EphemeralStorage == nil {
+		spec.StorageSpec = tmplSpec.StorageSpec
+		spec.EphemeralStorage = tmplSpec.EphemeralStorage
+	}
+	if spec.TLS == nil {
+		spec.TLS = tmplSpec.TLS
+	}
+	if len(spec.EtcdOptions) == 0 {
+		spec.EtcdOptions = tmplSpec.EtcdOptions
+	}
+	if spec.Ports == nil {
+		spec.Ports = tmplSpec.Ports
+	}
+	if spec.PodTemplate == nil {
+		spec.PodTemplate = tmplSpec.PodTemplate
+	}
+	if spec.DeletionPolicy == "" {
+		spec.DeletionPolicy = tmplSpec.DeletionPolicy
+	}
+}
+
+// ApplyEtcdClusterOverrides patches the EtcdCluster spec with the overrides
+// selecting the EtcdCluster, in priority order. overrides may contain
+// overrides of other namespaces, they are skipped. It must be called after
+// ApplyEtcdClusterTemplate and before SetEtcdClusterDefaults. It returns the
+// names of the applied overrides.
+func ApplyEtcdClusterOverrides(ec *EtcdCluster, overrides []EtcdClusterOverride) ([]string, error) {
+	var selected []*EtcdClusterOverride
+	for i := range overrides {
+		o := &overrides[i]
+		if o.Namespace != ec.Namespace {
+			continue
+		}
+		if o.Spec.ClusterSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(o.Spec.ClusterSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid clusterSelector in EtcdClusterOverride %s: %w", o.Name, err)
+			}
+			if !selector.Matches(labels.Set(ec.Labels)) {
+				continue
+			}
+		}
+		selected = append(selected, o)
+	}
+	slices.SortFunc(selected, func(a, b *EtcdClusterOverride) int {
+		if a.Spec.Priority != b.Spec.Priority {
+			return cmp.Compare(a.Spec.Priority, b.Spec.Priority)
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	spec, err := json.Marshal(ec.Spec)
+	if err != nil {
+		return nil, err
+	}
+	var applied []string
+	for _, o := range selected {
+		spec, err = strategicpatch.StrategicMergePatch(spec, o.Spec.Patch.Raw, EtcdClusterSpec{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply EtcdClusterOverride %s: %w", o.Name, err)
+		}
+		applied = append(applied, o.Name)
+	}
+
+	var patched EtcdClusterSpec
+	if err := json.Unmarshal(spec, &patched); err != nil {
+		return nil, fmt.Errorf("failed to apply EtcdClusterOverrides: %w", err)
+	}
+	ec.Spec = patched
+	return applied, nil
+}
+
+// SetExternalEtcdClusterDefaults fills in the defaults of the optional fields
+// of the ExternalEtcdCluster spec.
+func SetExternalEtcdClusterDefaults(eec *ExternalEtcdCluster) {
+	spec := &eec.Spec
+
+	if spec.HealthCheckInterval == nil {
+		spec.HealthCheckInterval = &metav1.Duration{Duration: DefaultHealthCheckInterval}
+	}
+
+	if spec.Defrag != nil {
+		if spec.Defrag.FragmentationThreshold == 0 {
+			spec.Defrag.FragmentationThreshold = DefaultFragmentationThreshold
+		}
+		if spec.Defrag.MinDBSize == nil {
+			size := resource.MustParse(DefaultDefragMinDBSize)
+			spec.Defrag.MinDBSize = &size
+		}
+	}
+
+	if spec.Backup != nil && spec.Backup.Version == "" {
+		spec.Backup.Version = DefaultEtcdVersion
+	}
+}
+
+// SetEtcdBackupScheduleDefaults fills in the defaults of the optional fields
+// of the EtcdBackupSchedule spec.
+func SetEtcdBackupScheduleDefaults(ebs *EtcdBackupSchedule) {
+	if ebs.Spec.Retention == nil {
+		retention := DefaultBackupRetention
+		ebs.Spec.Retention = &retention
+	}
+}
+
+// SetEtcdMirrorDefaults fills in the defaults of the optional fields of the
+// EtcdMirror spec.
+func SetEtcdMirrorDefaults(em *EtcdMirror) {
+	if f := em.Spec.Failover; f != nil && f.FailureThreshold == nil {
+		f.FailureThreshold = &metav1.Duration{Duration: DefaultFailoverThreshold}
+	}
+}
@@ -17,55 +17,1065 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+const (
+	// DryRunAnnotation, when set to "true" on an EtcdCluster, makes the operator
+	// only report the actions it would take in status.plannedActions, without
+	// applying any of them.
+	DryRunAnnotation = "operator.etcd.io/dry-run"
+
+	// PausedAnnotation, when set to "true" on a resource managed by the
+	// operator, stops the operator from acting on it. Only the status of the
+	// resource is kept up to date while it is paused.
+	PausedAnnotation = "operator.etcd.io/paused"
+
+	// ConfirmDeletionAnnotation confirms the deletion of an EtcdCluster whose
+	// deletionPolicy is Protect. Its value must be the name of the
+	// EtcdCluster, so the annotation can't be set on many clusters at once by
+	// accident.
+	ConfirmDeletionAnnotation = "operator.etcd.io/confirm-deletion"
+
+	// ConfirmQuorumRecoveryAnnotation confirms the recovery of an EtcdCluster
+	// that lost its quorum, from the source of its quorumRecovery. Its value
+	// must be the name of the EtcdCluster. The operator removes it once the
+	// recovery starts, so each recovery is confirmed on its own.
+	ConfirmQuorumRecoveryAnnotation = "operator.etcd.io/confirm-quorum-recovery"
+
+	// DebugPodAnnotation, when set on an EtcdCluster, makes the operator run a
+	// debug Pod with etcdctl and etcdutl pre-configured to reach the cluster.
+	// Its value is how long the Pod runs, e.g. "30m", or "true" for an hour.
+	// The Pod is deleted once the annotation is removed.
+	DebugPodAnnotation = "operator.etcd.io/debug-pod"
+
+	// MoveLeaderAnnotation, when set on an EtcdCluster, makes the operator
+	// transfer the leadership of the cluster to the member it names, e.g.
+	// before draining the node of the leader. The operator removes it once
+	// the leadership is transferred.
+	MoveLeaderAnnotation = "operator.etcd.io/move-leader-to"
+
+	// DeletionProtectionFinalizer blocks the deletion of an EtcdCluster whose
+	// deletionPolicy is Protect until the deletion is confirmed.
+	DeletionProtectionFinalizer = "operator.etcd.io/deletion-protection"
+
+	// RemoteCleanupFinalizer holds the deletion of an EtcdCluster whose
+	// members run in a remote Kubernetes cluster until the operator deleted
+	// them, as the garbage collector can't reach them.
+	RemoteCleanupFinalizer = "operator.etcd.io/remote-cleanup"
+
+	// ShardLabel assigns an EtcdCluster to the shard of the operator with the
+	// given index, when the operator runs sharded. EtcdClusters without it
+	// are assigned to a shard by a hash of their namespace and name.
+	ShardLabel = "operator.etcd.io/shard"
+)
+
+// DeletionPolicy controls what happens when an EtcdCluster is deleted.
+// +kubebuilder:validation:Enum=Delete;Protect
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the cluster and its members right away.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyProtect blocks the deletion until the
+	// ConfirmDeletionAnnotation is set on the EtcdCluster.
+	DeletionPolicyProtect DeletionPolicy = "Protect"
+)
+
+const (
+	// EtcdClusterConditionAvailable is True when the members have a leader,
+	// so the cluster serves requests.
+	EtcdClusterConditionAvailable = "Available"
+	// EtcdClusterConditionProgressing is True while the operator has actions
+	// planned to move the members towards the spec, listed in its message.
+	EtcdClusterConditionProgressing = "Progressing"
+	// EtcdClusterConditionScalingUp is True while members are added to the
+	// cluster to reach spec.size.
+	EtcdClusterConditionScalingUp = "ScalingUp"
+	// EtcdClusterConditionScalingDown is True while members are removed from
+	// the cluster to reach spec.size.
+	EtcdClusterConditionScalingDown = "ScalingDown"
+	// EtcdClusterConditionDegraded is True when at least one member of the
+	// cluster fails its health check.
+	EtcdClusterConditionDegraded = "Degraded"
+	// EtcdClusterConditionPaused is True when the reconciliation of the
+	// cluster is paused with the PausedAnnotation.
+	EtcdClusterConditionPaused = "Paused"
+	// EtcdClusterConditionSpecInvalid is True when the spec of the cluster
+	// fails validation, in which case the operator doesn't act on it.
+	EtcdClusterConditionSpecInvalid = "SpecInvalid"
+	// EtcdClusterConditionUpgrading is True while the members are upgraded
+	// to spec.version, one at a time. It is False, with the reason, once they
+	// all run it, or when the upgrade isn't supported.
+	EtcdClusterConditionUpgrading = "Upgrading"
+	// EtcdClusterConditionQuorumLost is True when none of the members of the
+	// cluster has a leader, in which case the cluster can't serve requests
+	// until enough members come back, or its quorum is recovered.
+	EtcdClusterConditionQuorumLost = "QuorumLost"
+	// EtcdClusterConditionVolumesExpanding is True while the volumes of the
+	// members are expanded to spec.storageSpec.volumeSizeRequest. It is False,
+	// with the reason, once they all have that size, or when their storage
+	// class doesn't allow it.
+	EtcdClusterConditionVolumesExpanding = "VolumesExpanding"
+	// EtcdClusterConditionEphemeral is True when the members have no
+	// persistent storage, so their data is lost along with their pods.
+	EtcdClusterConditionEphemeral = "Ephemeral"
+)
+
+// EtcdClusterPhase summarizes the state of an EtcdCluster, from its
+// conditions, for display.
+// +kubebuilder:validation:Enum=Pending;Running;Scaling;Upgrading;Degraded;Unavailable;Paused;Invalid;Deleting
+type EtcdClusterPhase string
+
+const (
+	// EtcdClusterPhasePending is the phase of a cluster that didn't elect a
+	// leader yet.
+	EtcdClusterPhasePending EtcdClusterPhase = "Pending"
+	// EtcdClusterPhaseRunning is the phase of a healthy cluster matching its
+	// spec.
+	EtcdClusterPhaseRunning EtcdClusterPhase = "Running"
+	// EtcdClusterPhaseScaling is the phase of a cluster whose members are
+	// added or removed.
+	EtcdClusterPhaseScaling EtcdClusterPhase = "Scaling"
+	// EtcdClusterPhaseUpgrading is the phase of a cluster whose members are
+	// upgraded.
+	EtcdClusterPhaseUpgrading EtcdClusterPhase = "Upgrading"
+	// EtcdClusterPhaseDegraded is the phase of a cluster with members failing
+	// their health check.
+	EtcdClusterPhaseDegraded EtcdClusterPhase = "Degraded"
+	// EtcdClusterPhaseUnavailable is the phase of a cluster that lost its
+	// leader.
+	EtcdClusterPhaseUnavailable EtcdClusterPhase = "Unavailable"
+	// EtcdClusterPhasePaused is the phase of a cluster whose reconciliation
+	// is paused.
+	EtcdClusterPhasePaused EtcdClusterPhase = "Paused"
+	// EtcdClusterPhaseInvalid is the phase of a cluster whose spec fails
+	// validation.
+	EtcdClusterPhaseInvalid EtcdClusterPhase = "Invalid"
+	// EtcdClusterPhaseDeleting is the phase of a cluster being deleted.
+	EtcdClusterPhaseDeleting EtcdClusterPhase = "Deleting"
+)
+
 // EtcdClusterSpec defines the desired state of EtcdCluster.
+// +kubebuilder:validation:XValidation:rule="!has(self.etcdOptions) || !has(self.size) || self.size == 0 || self.etcdOptions.all(o, !o.matches('^--(experimental-)?max-learners[= ][0-9]+$') || int(o.find('[0-9]+$')) < self.size)",message="the learners, --max-learners in etcdOptions, must be fewer than the voting members, size"
 type EtcdClusterSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Size is the expected size of the etcd cluster.
-	Size int `json:"size"`
-	// Version is the expected version of the etcd container image.
-	Version string `json:"version"`
+	// Size is the expected size of the etcd cluster. Defaults to 3 when the
+	// cluster is created without a size. etcd clusters larger than 7 members
+	// pay for the extra replication without gaining meaningful fault tolerance.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=7
+	// +optional
+	Size int `json:"size,omitempty"`
+	// Version is the expected version of the etcd container image. Defaults to
+	// DefaultEtcdVersion when not set.
+	// +optional
+	Version string `json:"version,omitempty"`
 	// StorageSpec is the name of the StorageSpec to use for the etcd cluster. If not provided, then each POD just uses the temporary storage inside the container.
 	StorageSpec *StorageSpec `json:"storageSpec,omitempty"`
+	// EphemeralStorage keeps the data of the members in an emptyDir volume,
+	// lost along with their pods, e.g. for test or cache clusters. It can't be
+	// combined with storageSpec, nor changed on an existing cluster.
+	// +optional
+	EphemeralStorage *EphemeralStorage `json:"ephemeralStorage,omitempty"`
 	// TLS is the TLS certificate configuration to use for the etcd cluster and etcd operator.
 	TLS *TLSCertificate `json:"tls,omitempty"`
 	// etcd configuration options are passed as command line arguments to the etcd container, refer to etcd documentation for configuration options applicable for the version of etcd being used.
+	// +kubebuilder:validation:MaxItems=64
+	// +kubebuilder:validation:items:MaxLength=1024
 	EtcdOptions []string `json:"etcdOptions,omitempty"`
+	// Tuning sets the etcd options tuning the members, checked by the
+	// operator. They must not be repeated in etcdOptions.
+	// +optional
+	Tuning *EtcdTuning `json:"tuning,omitempty"`
+	// Ports configures the ports etcd listens on for client and peer traffic.
+	// +optional
+	Ports *EtcdPorts `json:"ports,omitempty"`
+	// TemplateRef references the EtcdClusterTemplate providing the values of
+	// the fields that aren't set on this EtcdCluster.
+	// +optional
+	TemplateRef *EtcdClusterTemplateReference `json:"templateRef,omitempty"`
+	// DeletionPolicy controls whether deleting the EtcdCluster must be
+	// confirmed with the operator.etcd.io/confirm-deletion annotation.
+	// Defaults to Delete.
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// PodTemplate customizes the pods running the etcd members.
+	// +optional
+	PodTemplate *PodTemplate `json:"podTemplate,omitempty"`
+	// ConnectionSecret makes the operator maintain a Secret holding what the
+	// applications need to connect to the cluster.
+	// +optional
+	ConnectionSecret *ConnectionSecret `json:"connectionSecret,omitempty"`
+	// ClientService makes the operator maintain a Service in front of the
+	// client port of the members, e.g. to expose them outside of the
+	// Kubernetes cluster.
+	// +optional
+	ClientService *ClientService `json:"clientService,omitempty"`
+	// MemberServices makes the operator maintain a Service for each member,
+	// so that the members can be reached individually, e.g. by the clients
+	// or the peers outside of the Kubernetes cluster.
+	// +optional
+	MemberServices *MemberServices `json:"memberServices,omitempty"`
+	// GRPCProxy makes the operator deploy an etcd gRPC proxy in front of the
+	// members, for the clients to connect to: it serves the reads from its
+	// cache and fans the connections of the clients in.
+	// +optional
+	GRPCProxy *GRPCProxy `json:"grpcProxy,omitempty"`
+	// Gateway makes the operator deploy etcd gateways in front of the
+	// members: TCP proxies reached through a single Service, for the clients
+	// that can't resolve the per-member names of the headless Service.
+	// +optional
+	Gateway *Gateway `json:"gateway,omitempty"`
+	// KubeconfigSecretRef makes the operator run the members in the
+	// Kubernetes cluster of the kubeconfig held by the referenced Secret,
+	// rather than in the cluster of the EtcdCluster. It can't be added nor
+	// removed once the EtcdCluster exists.
+	// +optional
+	KubeconfigSecretRef *KubeconfigSecretReference `json:"kubeconfigSecretRef,omitempty"`
+	// MemberReplacement makes the operator replace the members failing their
+	// health check for too long: it removes them from the cluster, wipes
+	// their data, and adds them back. Members are not replaced when unset.
+	// +optional
+	MemberReplacement *MemberReplacement `json:"memberReplacement,omitempty"`
+	// QuorumRecovery makes the operator recover the quorum of the cluster
+	// when it is lost, once the recovery is confirmed with the
+	// operator.etcd.io/confirm-quorum-recovery annotation. It restarts the
+	// cluster from a single member holding the data of the source, and the
+	// other members join it empty. The quorum is never recovered when unset.
+	// +optional
+	QuorumRecovery *QuorumRecovery `json:"quorumRecovery,omitempty"`
+	// Maintenance schedules the maintenance of the members.
+	// +optional
+	Maintenance *Maintenance `json:"maintenance,omitempty"`
+	// Monitoring makes the operator create the objects of the Prometheus
+	// operator scraping the metrics of the members.
+	// +optional
+	Monitoring *Monitoring `json:"monitoring,omitempty"`
+	// Adoption makes the operator take over an etcd cluster it doesn't
+	// manage yet, run by the StatefulSet named after the EtcdCluster,
+	// rather than bootstrapping a new one. It has no effect once the
+	// StatefulSet is adopted.
+	// +optional
+	Adoption *Adoption `json:"adoption,omitempty"`
+	// Auth turns the authentication of etcd on, with a root user managed by
+	// the operator.
+	// +optional
+	Auth *Authentication `json:"auth,omitempty"`
+}
+
+// Adoption describes the existing etcd cluster taken over by an EtcdCluster.
+// Its StatefulSet must select the pods with the labels app and controller
+// set to the name of the EtcdCluster, be served by the headless Service of
+// the same name, keep the data of the members where the operator does, and
+// its members must be named after their pods.
+type Adoption struct {
+	// Endpoints are the client URLs of the members of the existing cluster,
+	// which must all be healthy to be adopted.
+	// +kubebuilder:validation:MinItems=1
+	Endpoints []string `json:"endpoints"`
+}
+
+// Monitoring configures the scraping of the metrics of the members, and the
+// alerts on them.
+type Monitoring struct {
+	// ServiceMonitor makes the operator create a ServiceMonitor, named after
+	// the cluster, scraping the metrics of each member. It requires the
+	// Prometheus operator. No ServiceMonitor is created when unset.
+	// +optional
+	ServiceMonitor *ServiceMonitorSpec `json:"serviceMonitor,omitempty"`
+	// PrometheusRule makes the operator create a PrometheusRule, named after
+	// the cluster, with the alerts recommended by etcd, e.g. on a member
+	// without leader, a slow disk or a database nearly full. The alerts
+	// select the metrics scraped by the ServiceMonitor, so it requires
+	// serviceMonitor. No PrometheusRule is created when unset.
+	// +optional
+	PrometheusRule *PrometheusRuleSpec `json:"prometheusRule,omitempty"`
+}
+
+// PrometheusRuleSpec configures the PrometheusRule of an EtcdCluster.
+type PrometheusRuleSpec struct {
+	// Labels are added to the PrometheusRule, e.g. to match the
+	// ruleSelector of Prometheus.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// AlertLabels are added to the alerts, along with their severity, e.g.
+	// to route them in Alertmanager.
+	// +optional
+	AlertLabels map[string]string `json:"alertLabels,omitempty"`
+}
+
+// ServiceMonitorSpec configures the ServiceMonitor of an EtcdCluster.
+type ServiceMonitorSpec struct {
+	// Interval is how often the members are scraped, in whole milliseconds.
+	// Defaults to the scrape interval of Prometheus.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Labels are added to the ServiceMonitor, e.g. to match the
+	// serviceMonitorSelector of Prometheus.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// MemberReplacement configures the replacement of the failed members.
+type MemberReplacement struct {
+	// FailureThreshold is how long a member must fail its health check,
+	// e.g. because its pod is stuck, its volume is lost or its peers can't
+	// reach it, before it is replaced. Defaults to 10 minutes.
+	// +optional
+	FailureThreshold *metav1.Duration `json:"failureThreshold,omitempty"`
+}
+
+// QuorumRecoverySource is what the quorum of an EtcdCluster is recovered
+// from.
+// +kubebuilder:validation:Enum=Member;Backup
+type QuorumRecoverySource string
+
+const (
+	// QuorumRecoverySourceMember recovers the quorum from the data of the
+	// member with the most recent raft index, among the members still
+	// responding. The writes it didn't apply yet are lost.
+	QuorumRecoverySourceMember QuorumRecoverySource = "Member"
+	// QuorumRecoverySourceBackup recovers the quorum from the snapshot of the
+	// latest completed EtcdBackup of the cluster. The writes since the
+	// backup are lost.
+	QuorumRecoverySourceBackup QuorumRecoverySource = "Backup"
+)
+
+// QuorumRecovery configures the recovery of the quorum of a cluster.
+// +kubebuilder:validation:XValidation:rule="!has(self.replayWAL) || !self.replayWAL || self.source == 'Backup'",message="replayWAL requires the Backup source"
+type QuorumRecovery struct {
+	// Source is what the quorum is recovered from.
+	Source QuorumRecoverySource `json:"source"`
+	// ReplayWAL makes the recovery from the Backup source replay, over the
+	// snapshot of the backup, the write-ahead log retained on the volume of
+	// the member with the most recent raft index, recovering the writes
+	// committed since the backup. The recovery fails when the log doesn't
+	// reach back to the snapshot.
+	// +optional
+	ReplayWAL bool `json:"replayWAL,omitempty"`
+}
+
+// Maintenance configures the scheduled maintenance of the members.
+type Maintenance struct {
+	// DefragSchedule is the cron schedule, in UTC, of the defragmentation
+	// of the members, e.g. "0 3 * * 0". The members are defragmented one at
+	// a time, the leader last, once they are all healthy. The members are
+	// not defragmented on a schedule when unset.
+	// +optional
+	DefragSchedule string `json:"defragSchedule,omitempty"`
+	// AutoRecoverNoSpace makes the operator recover the cluster from the
+	// NOSPACE alarm, raised when the database of a member reaches its quota:
+	// it compacts the keyspace to its current revision, defragments the
+	// members and disarms the alarm. The alarm is only reported when unset.
+	// +optional
+	AutoRecoverNoSpace bool `json:"autoRecoverNoSpace,omitempty"`
+	// LocalSnapshots makes the operator take periodic snapshots of each
+	// member onto its own volume, to restore from when the storage of the
+	// backups is unavailable. It requires a storageSpec. No local snapshot
+	// is taken when unset.
+	// +optional
+	LocalSnapshots *LocalSnapshots `json:"localSnapshots,omitempty"`
+}
+
+// LocalSnapshots configures the periodic snapshots of the members onto their
+// own volume.
+type LocalSnapshots struct {
+	// Schedule is the cron schedule, in UTC, of the snapshots, e.g.
+	// "0 * * * *". All the members are snapshotted at once, once they are
+	// all healthy.
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+	// Keep is the number of snapshots kept on the volume of each member,
+	// the oldest ones are deleted first. Defaults to 3.
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	Keep int32 `json:"keep,omitempty"`
+}
+
+// KubeconfigSecretReference references the Secret holding the kubeconfig of
+// a remote Kubernetes cluster.
+type KubeconfigSecretReference struct {
+	// Name is the name of the Secret, in the namespace of the EtcdCluster.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Key is the key of the Secret holding the kubeconfig. Defaults to
+	// "value", the key used by the kubeconfig Secrets of Cluster API.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// ConnectionSecret configures the connection Secret of an EtcdCluster.
+type ConnectionSecret struct {
+	// Name is the name of the Secret, in the namespace of the EtcdCluster.
+	// Defaults to the name of the EtcdCluster followed by "-connection".
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+// ClientService configures the Service in front of the client port of the
+// members of an EtcdCluster, named after the EtcdCluster followed by
+// "-client". Unlike the headless Service, it balances the clients between
+// the members.
+type ClientService struct {
+	// Type is the type of the Service. Defaults to ClusterIP.
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+	// Annotations are set on the Service, e.g. for external-dns or the load
+	// balancers of the cloud provider.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// NodePort is the port of the nodes the client port is exposed on, with
+	// the NodePort and LoadBalancer types. Allocated by Kubernetes when unset.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	NodePort int32 `json:"nodePort,omitempty"`
+	// SessionAffinity makes the Service send the connections of a client to
+	// the same member with ClientIP. Defaults to None.
+	// +kubebuilder:validation:Enum=None;ClientIP
+	// +optional
+	SessionAffinity corev1.ServiceAffinity `json:"sessionAffinity,omitempty"`
+	// LoadBalancerSourceRanges restricts the clients of a LoadBalancer
+	// Service to these CIDRs, where the cloud provider supports it.
+	// +optional
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+	// ExtraPorts are exposed by the Service next to the client port, named
+	// client. They target the ports of the members by name or number.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	ExtraPorts []ClientServicePort `json:"extraPorts,omitempty"`
+}
+
+// ClientServicePort is a port of the client Service of an EtcdCluster.
+type ClientServicePort struct {
+	// Name is the name of the port, unique in the Service.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=15
+	Name string `json:"name"`
+	// Port is the port exposed by the Service.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// TargetPort is the port of the members, by name or number. Defaults to
+	// port.
+	// +optional
+	TargetPort intstr.IntOrString `json:"targetPort,omitempty"`
+	// NodePort is the port of the nodes the port is exposed on, with the
+	// NodePort and LoadBalancer types. Allocated by Kubernetes when unset.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	NodePort int32 `json:"nodePort,omitempty"`
+}
+
+// MemberServices configures the Services of the members of an EtcdCluster,
+// named after the members followed by "-svc". Each selects the pod of its
+// member, even while it isn't ready, and exposes its client and peer ports.
+type MemberServices struct {
+	// Type is the type of the Services. Defaults to ClusterIP.
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+	// Annotations are set on the Services, with $(MEMBER_NAME) replaced by
+	// the name of the member, e.g. for the hostnames of external-dns.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Domain makes the members advertise their client and peer URLs at
+	// <member>.<domain> too, next to their URLs in the Kubernetes cluster.
+	// The names must resolve to the Services of the members, e.g. through
+	// external-dns. It can't be added, changed nor removed once the
+	// EtcdCluster exists: the peer URLs of the members are set when they
+	// join the cluster.
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`
+	// +optional
+	Domain string `json:"domain,omitempty"`
+}
+
+// GRPCProxy configures the etcd gRPC proxy of an EtcdCluster, run by a
+// Deployment and reached through a Service, both named after the EtcdCluster
+// followed by "-grpc-proxy". The proxy runs the etcd version of the members.
+type GRPCProxy struct {
+	// Replicas is the number of pods of the proxy. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Port is the port the proxy serves the clients on. Defaults to the
+	// client port of the members.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// Resources of the proxy container.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// Gateway configures the etcd gateway of an EtcdCluster, run by a Deployment
+// and reached through a Service, both named after the EtcdCluster followed by
+// "-gateway". The gateway forwards the connections of the clients to the
+// members as they are: with TLS, the clients verify the certificates of the
+// members, valid for the name of the EtcdCluster Service, e.g.
+// "<name>.<namespace>.svc", rather than for the one of the gateway.
+type Gateway struct {
+	// Replicas is the number of pods of the gateway. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Port is the port the gateway serves the clients on. Defaults to the
+	// client port of the members.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// Resources of the gateway container.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// Authentication configures the authentication of the clients of an
+// EtcdCluster.
+type Authentication struct {
+	// Enabled turns the authentication of etcd on once the members are
+	// healthy. The operator creates the root user beforehand, keeps its
+	// password in a Secret named after the EtcdCluster followed by "-root",
+	// and authenticates with it from then on. Turning it off disables the
+	// authentication, and deletes the Secret.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// AutoCompactionMode is how etcd interprets the auto compaction retention.
+// +kubebuilder:validation:Enum=periodic;revision
+type AutoCompactionMode string
+
+const (
+	// AutoCompactionModePeriodic keeps the history of the keys for a
+	// duration, e.g. "1h", or a number of hours.
+	AutoCompactionModePeriodic AutoCompactionMode = "periodic"
+	// AutoCompactionModeRevision keeps a number of revisions of the
+	// keyspace, e.g. "1000".
+	AutoCompactionModeRevision AutoCompactionMode = "revision"
+)
+
+// EtcdTuning holds the etcd options tuning the members. The options not set
+// keep the defaults of etcd.
+// +kubebuilder:validation:XValidation:rule="(has(self.electionTimeout) ? duration(self.electionTimeout).getMilliseconds() : 1000) >= 5 * (has(self.heartbeatInterval) ? duration(self.heartbeatInterval).getMilliseconds() : 100)",message="the election timeout must be at least 5 times the heartbeat interval"
+type EtcdTuning struct {
+	// QuotaBackendBytes is the size the database of a member can grow to,
+	// before it raises the NOSPACE alarm. --quota-backend-bytes, 2Gi by
+	// default. etcd recommends at most 8Gi.
+	// +optional
+	QuotaBackendBytes *resource.Quantity `json:"quotaBackendBytes,omitempty"`
+	// AutoCompactionMode is how AutoCompactionRetention is interpreted.
+	// --auto-compaction-mode, periodic by default.
+	// +optional
+	AutoCompactionMode AutoCompactionMode `json:"autoCompactionMode,omitempty"`
+	// AutoCompactionRetention is the history of the keys the members keep
+	// when they compact the keyspace: a duration, e.g. "1h", or a number of
+	// hours with the periodic mode, a number of revisions with the revision
+	// mode. --auto-compaction-retention, "0" by default, which disables the
+	// auto compaction.
+	// +optional
+	AutoCompactionRetention string `json:"autoCompactionRetention,omitempty"`
+	// SnapshotCount is the number of applied raft entries after which a
+	// member snapshots its state to disk. --snapshot-count.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SnapshotCount *int64 `json:"snapshotCount,omitempty"`
+	// HeartbeatInterval is how often the leader notifies the followers it
+	// is still the leader. --heartbeat-interval, 100ms by default. It is
+	// rounded down to the millisecond.
+	// +optional
+	HeartbeatInterval *metav1.Duration `json:"heartbeatInterval,omitempty"`
+	// ElectionTimeout is how long a follower waits without hearing from the
+	// leader before it starts an election. It must be at least 5 times the
+	// heartbeat interval, and at most 50s. --election-timeout, 1s by
+	// default. It is rounded down to the millisecond.
+	// +optional
+	ElectionTimeout *metav1.Duration `json:"electionTimeout,omitempty"`
+	// MaxRequestBytes is the largest request a member accepts from a
+	// client. --max-request-bytes, 1.5Mi by default.
+	// +optional
+	MaxRequestBytes *resource.Quantity `json:"maxRequestBytes,omitempty"`
+}
+
+// Flags returns the command line flags of the options set in t, in the
+// order of its fields.
+func (t *EtcdTuning) Flags() []string {
+	if t == nil {
+		return nil
+	}
+	var flags []string
+	if t.QuotaBackendBytes != nil {
+		flags = append(flags, fmt.Sprintf("--quota-backend-bytes=%d", t.QuotaBackendBytes.Value()))
+	}
+	if t.AutoCompactionMode != "" {
+		flags = append(flags, fmt.Sprintf("--auto-compaction-mode=%s", t.AutoCompactionMode))
+	}
+	if t.AutoCompactionRetention != "" {
+		flags = append(flags, fmt.Sprintf("--auto-compaction-retention=%s", t.AutoCompactionRetention))
+	}
+	if t.SnapshotCount != nil {
+		flags = append(flags, fmt.Sprintf("--snapshot-count=%d", *t.SnapshotCount))
+	}
+	if t.HeartbeatInterval != nil {
+		flags = append(flags, fmt.Sprintf("--heartbeat-interval=%d", t.HeartbeatInterval.Milliseconds()))
+	}
+	if t.ElectionTimeout != nil {
+		flags = append(flags, fmt.Sprintf("--election-timeout=%d", t.ElectionTimeout.Milliseconds()))
+	}
+	if t.MaxRequestBytes != nil {
+		flags = append(flags, fmt.Sprintf("--max-request-bytes=%d", t.MaxRequestBytes.Value()))
+	}
+	return flags
+}
+
+// EtcdPorts defines the ports used by the etcd members.
+// +kubebuilder:validation:XValidation:rule="!has(self.client) || !has(self.peer) || self.client != self.peer",message="client and peer ports must differ"
+type EtcdPorts struct {
+	// Client is the port etcd serves client requests on. Defaults to 2379.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Client int32 `json:"client,omitempty"`
+	// Peer is the port etcd serves peer (member to member) traffic on. Defaults to 2380.
+	// It is part of the member peer URLs, so it can't be changed once set.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="peer port is immutable"
+	// +optional
+	Peer int32 `json:"peer,omitempty"`
+}
+
+// PodTemplate defines the customizations applied to the etcd member pods.
+type PodTemplate struct {
+	// ExtraArgs are flags appended to the command line of the etcd container,
+	// after those of etcdOptions, e.g. to enable experimental features the
+	// operator doesn't model. The flags the operator owns, such as --name, the
+	// peer URLs and --data-dir, are rejected.
+	// +optional
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+	// Env are environment variables added to the etcd container. The
+	// variables the operator owns, such as ETCD_DATA_DIR or POD_NAME, are
+	// rejected.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// LivenessProbe overrides the default liveness probe of the etcd container,
+	// which queries the /livez endpoint on the client port.
+	// +optional
+	LivenessProbe *corev1.Probe `json:"livenessProbe,omitempty"`
+	// ReadinessProbe overrides the default readiness probe of the etcd container,
+	// which queries the /readyz/serializable_read endpoint on the client port.
+	// +optional
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+	// Resources are the compute resources of the etcd container. When the
+	// memory is limited and tuning.quotaBackendBytes isn't set, the quota of
+	// the database defaults to half the limit, if that is below 2Gi, as a
+	// database outgrowing the memory would get the members OOM-killed.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Scheduling constrains the nodes the members run on.
+	// +optional
+	Scheduling *PodScheduling `json:"scheduling,omitempty"`
+	// DisruptionBudget makes the operator create a PodDisruptionBudget
+	// letting the evictions, e.g. of a node drain, take down one member at a
+	// time, and only while the other members are ready. Defaults to true; set
+	// it to false when a PodDisruptionBudget of yours already selects the
+	// members, as the evictions fail when several of them do.
+	// +optional
+	DisruptionBudget *bool `json:"disruptionBudget,omitempty"`
+	// DataCheck makes an init container check the integrity of the data of
+	// the members before they start. A member whose write-ahead log, raft
+	// snapshots or database are corrupted is marked as such in
+	// status.failingMembers, and replaced right away with memberReplacement
+	// rather than crash-looping. The data isn't checked when unset.
+	// +optional
+	DataCheck *DataCheck `json:"dataCheck,omitempty"`
+	// GracefulShutdown configures the preStop hook of the etcd container: a
+	// stopping member moves its leadership to another member, and waits for
+	// the other members to be a healthy quorum without it, so that draining
+	// a node or rolling the members out doesn't leave the cluster leaderless.
+	// +optional
+	GracefulShutdown *GracefulShutdown `json:"gracefulShutdown,omitempty"`
+}
+
+// DataCheck configures the integrity check of the data of the members.
+type DataCheck struct {
+	// Image runs the check, with its `/manager check-data` command.
+	// Defaults to the image of the operator, its --operator-image flag; the
+	// data isn't checked when neither is set.
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// GracefulShutdown configures the preStop hook of the members.
+type GracefulShutdown struct {
+	// Enabled adds the preStop hook to the etcd container. Defaults to true.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+	// Image provides the hook, with its `/manager pre-stop` command, to the
+	// etcd container through an init container. Defaults to the image of
+	// the operator, its --operator-image flag; there is no hook when
+	// neither is set.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Timeout is how long a stopping member waits for the other members to
+	// be a healthy quorum, before stopping anyway. The termination grace
+	// period of the members is extended by it. Defaults to 30s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// PodScheduling defines the scheduling constraints of the etcd member pods.
+type PodScheduling struct {
+	// Affinity of the members. Defaults to a required pod anti-affinity
+	// between the members on kubernetes.io/hostname, so that losing a node
+	// costs the cluster at most one member; set it to {} to let the members
+	// share the nodes.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// Tolerations of the members, e.g. to run them on dedicated nodes.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// NodeSelector restricts the members to the nodes with these labels.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// PriorityClassName is the name of the PriorityClass of the members.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// TopologySpreadConstraints spread the members across the topology
+	// domains of the nodes, e.g. the zones. When the nodes are labeled with
+	// more than one topology.kubernetes.io/zone, the members are spread
+	// evenly across the zones by default.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+}
+
+// EtcdClusterTemplateReference references an EtcdClusterTemplate.
+type EtcdClusterTemplateReference struct {
+	// Name is the name of the EtcdClusterTemplate.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
 }
 
 type TLSCertificate struct {
-	Provider    string         `json:"provider,omitempty"` // Defaults to Auto provider if not present
+	// Provider issues the certificates of the cluster. Defaults to auto.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="provider is immutable"
+	// +optional
+	Provider    TLSProvider    `json:"provider,omitempty"`
 	ProviderCfg ProviderConfig `json:"providerCfg,omitempty"`
 }
 
+// CertManagerConfig returns the configuration of the cert-manager provider
+// when the certificates of the cluster are requested from cert-manager, nil
+// otherwise.
+func (t *TLSCertificate) CertManagerConfig() *ProviderCertManagerConfig {
+	if t == nil || t.Provider != TLSProviderCertManager {
+		return nil
+	}
+	return t.ProviderCfg.CertManagerCfg
+}
+
+// Enabled returns whether the members of the cluster serve TLS, with the
+// certificates of a supported provider.
+func (t *TLSCertificate) Enabled() bool {
+	if t == nil {
+		return false
+	}
+	return t.Provider == TLSProviderAuto || t.CertManagerConfig() != nil
+}
+
+// TLSProvider is the name of a certificate provider.
+// +kubebuilder:validation:Enum=auto;cert-manager
+type TLSProvider string
+
+const (
+	// TLSProviderAuto issues the certificates from a CA generated by the
+	// operator for the cluster.
+	TLSProviderAuto TLSProvider = "auto"
+	// TLSProviderCertManager requests the certificates from cert-manager.
+	TLSProviderCertManager TLSProvider = "cert-manager"
+)
+
 type ProviderConfig struct {
-	AutoCfg        *ProviderAutoConfig        `json:"autoCfg,omitempty"`
+	// AutoCfg configures the auto provider.
+	// +optional
+	AutoCfg *ProviderAutoConfig `json:"autoCfg,omitempty"`
+	// CertManagerCfg configures the cert-manager provider, which requires it.
+	// +optional
 	CertManagerCfg *ProviderCertManagerConfig `json:"certManagerCfg,omitempty"`
 }
 
+// ProviderAutoConfig configures the certificates the operator issues from the
+// CA it generates for the cluster.
 type ProviderAutoConfig struct {
+	// Duration is the lifetime of the certificates of the members and of the
+	// operator. Defaults to 90 days. The operator renews them once two thirds
+	// of their lifetime passed, and restarts the members, one at a time, to
+	// load the renewed certificates.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
 }
 
+// ProviderCertManagerConfig configures the certificates requested from
+// cert-manager.
 type ProviderCertManagerConfig struct {
+	// IssuerRef references the cert-manager Issuer, or ClusterIssuer, signing
+	// the certificates of the cluster. The operator and the members trust the
+	// CA it publishes in the ca.crt key of the certificate Secrets, so it
+	// must be a CA or a self-signed issuer.
+	IssuerRef CertManagerIssuerReference `json:"issuerRef"`
+	// Duration is the lifetime of the certificates. Defaults to the one of
+	// cert-manager, 90 days. cert-manager renews them before they expire, and
+	// the members pick the renewed certificates up without a restart.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// CertManagerIssuerReference references a cert-manager issuer.
+type CertManagerIssuerReference struct {
+	// Name is the name of the issuer. An Issuer must be in the namespace of
+	// the EtcdCluster.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Kind is the kind of the issuer, Issuer (default) or ClusterIssuer.
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Group is the API group of the issuer. Defaults to cert-manager.io, set
+	// it for the external issuers.
+	// +optional
+	Group string `json:"group,omitempty"`
 }
 
 // EtcdClusterStatus defines the observed state of EtcdCluster.
 type EtcdClusterStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Phase summarizes the state of the cluster, from its conditions.
+	// +optional
+	Phase EtcdClusterPhase `json:"phase,omitempty"`
+
+	// ReadyMembers is the number of members passing their health check.
+	// +optional
+	ReadyMembers int32 `json:"readyMembers"`
+
+	// Leader is the name of the leader of the cluster.
+	// +optional
+	Leader string `json:"leader,omitempty"`
+
+	// PlannedActions lists the actions the operator is going to take to move
+	// the cluster towards its spec, as computed by the last reconciliation.
+	// +optional
+	PlannedActions []PlannedAction `json:"plannedActions,omitempty"`
+
+	// Conditions describe the latest observed state of the cluster.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// InProgressOperation is the change of the membership of the cluster
+	// the operator is carrying out. It is recorded before the first step of
+	// the change, so that the operator resumes it after being interrupted,
+	// e.g. by a restart or a change of leader.
+	// +optional
+	InProgressOperation *MemberOperation `json:"inProgressOperation,omitempty"`
+
+	// Endpoints are the comma separated client URLs of the members, once the
+	// cluster has elected a leader. Along with Initialized, it lets Cluster
+	// API control planes use the cluster as their external etcd.
+	// +optional
+	Endpoints string `json:"endpoints,omitempty"`
+
+	// Initialized is true once the cluster first elected a leader.
+	// +optional
+	Initialized bool `json:"initialized,omitempty"`
+
+	// Learners are the names of the members added to the cluster as
+	// non-voting learners, which are promoted once they caught up with the
+	// leader.
+	// +optional
+	// +listType=set
+	Learners []string `json:"learners,omitempty"`
+
+	// FailingMembers are the members failing their health check, and since
+	// when.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	FailingMembers []FailingMember `json:"failingMembers,omitempty"`
+
+	// CertificatesRenewalTime is when the operator last renewed the
+	// certificates of the members, with the auto TLS provider. The members
+	// are restarted, one at a time, when it changes.
+	// +optional
+	CertificatesRenewalTime *metav1.Time `json:"certificatesRenewalTime,omitempty"`
+
+	// MemberDefrags record when the members were last defragmented, on the
+	// defrag schedule.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	MemberDefrags []MemberDefrag `json:"memberDefrags,omitempty"`
+
+	// LastLocalSnapshotTime is the time of the local snapshots schedule the
+	// members were last snapshotted at.
+	// +optional
+	LastLocalSnapshotTime *metav1.Time `json:"lastLocalSnapshotTime,omitempty"`
+
+	// Members describe the members of the cluster, as last reported by
+	// etcd. They are refreshed on each reconcile, and empty while the
+	// cluster doesn't respond.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Members []MemberStatus `json:"members,omitempty"`
+
+	// Alarms are the alarms raised by the members, e.g. NOSPACE, as last
+	// listed by the operator. An event is recorded when one is raised or
+	// cleared.
+	// +optional
+	Alarms []MemberAlarm `json:"alarms,omitempty"`
+
+	// ServiceMonitor is the name of the ServiceMonitor created for the
+	// cluster, deleted once spec.monitoring.serviceMonitor is removed.
+	// +optional
+	ServiceMonitor string `json:"serviceMonitor,omitempty"`
+
+	// PrometheusRule is the name of the PrometheusRule created for the
+	// cluster, deleted once spec.monitoring.prometheusRule is removed.
+	// +optional
+	PrometheusRule string `json:"prometheusRule,omitempty"`
+}
+
+// MemberOperation describes a change of the membership of the cluster, which
+// takes several steps.
+type MemberOperation struct {
+	// Type is the kind of change, ScaleOut, ScaleIn, ReplaceMember or
+	// RecoverQuorum.
+	Type string `json:"type"`
+	// Member is the name of the member being added, removed or replaced.
+	// For RecoverQuorum, it is the member whose data the quorum is recovered
+	// from, or the first member when it is recovered from a backup.
+	Member string `json:"member"`
+	// StartTime is when the change started.
+	StartTime metav1.Time `json:"startTime"`
+}
+
+// FailingMember is a member failing its health check.
+type FailingMember struct {
+	// Name is the name of the member.
+	Name string `json:"name"`
+	// Since is when the member first failed its health check.
+	Since metav1.Time `json:"since"`
+	// Error is the last error of the health check of the member.
+	// +optional
+	Error string `json:"error,omitempty"`
+	// Corrupted is set when the data check of the member found its data
+	// corrupted, see podTemplate.dataCheck. Error is then the outcome of the
+	// check.
+	// +optional
+	Corrupted bool `json:"corrupted,omitempty"`
+}
+
+// MemberDefrag records the last defragmentation of a member.
+type MemberDefrag struct {
+	// Name is the name of the member.
+	Name string `json:"name"`
+	// LastDefragTime is when the member was last defragmented.
+	LastDefragTime metav1.Time `json:"lastDefragTime"`
+}
+
+// MemberStatus describes a member of the cluster.
+type MemberStatus struct {
+	// Name is the name of the member. The learners that didn't start yet
+	// are named after the Pod of their peer URL.
+	Name string `json:"name"`
+	// ID is the hexadecimal ID of the member.
+	ID string `json:"id"`
+	// PeerURLs are the URLs the member is reached at by its peers.
+	// +optional
+	PeerURLs []string `json:"peerURLs,omitempty"`
+	// ClientURLs are the URLs the member serves the clients at.
+	// +optional
+	ClientURLs []string `json:"clientURLs,omitempty"`
+	// IsLeader is true for the leader of the cluster.
+	// +optional
+	IsLeader bool `json:"isLeader,omitempty"`
+	// IsLearner is true for the members not voting yet.
+	// +optional
+	IsLearner bool `json:"isLearner,omitempty"`
+	// Zone is the topology.kubernetes.io/zone label of the node of the
+	// member.
+	// +optional
+	Zone string `json:"zone,omitempty"`
+	// Version is the version of etcd the member runs. It and the fields below
+	// are only set for the members responding to their health check.
+	// +optional
+	Version string `json:"version,omitempty"`
+	// DBSize is the size of the database of the member, in bytes, including
+	// the space not given back to the filesystem until it is defragmented.
+	// +optional
+	DBSize int64 `json:"dbSize,omitempty"`
+	// DBSizeInUse is the size of the database of the member actually in use,
+	// in bytes.
+	// +optional
+	DBSizeInUse int64 `json:"dbSizeInUse,omitempty"`
+	// RaftAppliedIndex is the index of the last raft entry the member
+	// applied.
+	// +optional
+	RaftAppliedIndex int64 `json:"raftAppliedIndex,omitempty"`
+}
+
+// MemberAlarm is an alarm raised by a member.
+type MemberAlarm struct {
+	// Member is the name of the member, or its hexadecimal ID when it isn't
+	// in the member list.
+	Member string `json:"member"`
+	// Alarm is the type of the alarm, NOSPACE or CORRUPT.
+	Alarm string `json:"alarm"`
+}
+
+// PlannedAction describes an action the operator is going to take on the cluster.
+type PlannedAction struct {
+	// Type is the kind of action, e.g. ScaleOut or RollingRestart.
+	Type string `json:"type"`
+	// Description summarizes what the action does.
+	Description string `json:"description"`
+	// Reason explains what triggered the action.
+	// +optional
+	Reason string `json:"reason,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.spec.size`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyMembers`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.version`
+// +kubebuilder:printcolumn:name="Leader",type=string,JSONPath=`.status.leader`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // EtcdCluster is the Schema for the etcdclusters API.
 type EtcdCluster struct {
@@ -85,12 +1095,32 @@ type EtcdClusterList struct {
 	Items           []EtcdCluster `json:"items"`
 }
 
+// +kubebuilder:validation:XValidation:rule="!has(self.accessModes) || self.accessModes != 'ReadWriteMany' || (has(self.pvcName) && size(self.pvcName) > 0)",message="pvcName must be set when accessModes is ReadWriteMany"
 type StorageSpec struct {
-	AccessModes       corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`      // `ReadWriteOnce` (default) or `ReadWriteMany`. Note that `ReadOnlyMany` isn't allowed.
-	StorageClassName  string                            `json:"storageClassName,omitempty"` // optional, the default one will be used if not specified
-	PVCName           string                            `json:"pvcName,omitempty"`          // optional, only used when access mode is ReadWriteMany
-	VolumeSizeRequest resource.Quantity                 `json:"volumeSizeRequest"`          // required.
-	VolumeSizeLimit   resource.Quantity                 `json:"volumeSizeLimit,omitempty"`  // optional
+	// AccessModes is the access mode of the volumes, `ReadWriteOnce` (default)
+	// or `ReadWriteMany`. Note that `ReadOnlyMany` isn't allowed.
+	// +kubebuilder:validation:Enum=ReadWriteOnce;ReadWriteMany
+	// +optional
+	AccessModes corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="storageClassName is immutable"
+	StorageClassName  string            `json:"storageClassName,omitempty"`  // optional, the default one will be used if not specified
+	PVCName           string            `json:"pvcName,omitempty"`           // optional, only used when access mode is ReadWriteMany
+	VolumeSizeRequest resource.Quantity `json:"volumeSizeRequest,omitempty"` // optional, defaults to 1Gi
+	VolumeSizeLimit   resource.Quantity `json:"volumeSizeLimit,omitempty"`   // optional, defaults to VolumeSizeRequest
+}
+
+// EphemeralStorage defines the emptyDir volume keeping the data of the
+// members without persistent storage.
+type EphemeralStorage struct {
+	// Medium of the volume: the disk of the node by default, or Memory for a
+	// tmpfs, which counts against the memory limit of the etcd container.
+	// +kubebuilder:validation:Enum=Memory
+	// +optional
+	Medium corev1.StorageMedium `json:"medium,omitempty"`
+	// SizeLimit is the size of the volume above which the member is evicted.
+	// It should be above the quota of the database, tuning.quotaBackendBytes.
+	// +optional
+	SizeLimit *resource.Quantity `json:"sizeLimit,omitempty"`
 }
 
 func init() {
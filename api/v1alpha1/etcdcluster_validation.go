@@ -0,0 +1,695 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ValidateEtcdCluster checks the EtcdCluster spec on its own, mirroring the
+// validation of the CRD schema, so that the spec can also be validated where
+// the API server isn't involved. The EtcdCluster is expected to be defaulted.
+func ValidateEtcdCluster(ec *EtcdCluster) field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	spec := ec.Spec
+
+	if spec.Size < 0 || spec.Size > 7 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("size"), spec.Size, "must be between 0 and 7"))
+	}
+
+	if spec.Ports != nil {
+		portsPath := specPath.Child("ports")
+		allErrs = append(allErrs, validatePort(spec.Ports.Client, portsPath.Child("client"))...)
+		allErrs = append(allErrs, validatePort(spec.Ports.Peer, portsPath.Child("peer"))...)
+		if spec.Ports.Client == spec.Ports.Peer {
+			allErrs = append(allErrs, field.Invalid(portsPath, spec.Ports.Client, "client and peer ports must differ"))
+		}
+	}
+
+	if storage := spec.StorageSpec; storage != nil {
+		storagePath := specPath.Child("storageSpec")
+		switch storage.AccessModes {
+		case corev1.ReadWriteOnce:
+		case corev1.ReadWriteMany:
+			if storage.PVCName == "" {
+				allErrs = append(allErrs, field.Required(storagePath.Child("pvcName"), "pvcName must be set when accessModes is ReadWriteMany"))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(storagePath.Child("accessModes"), storage.AccessModes,
+				[]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce, corev1.ReadWriteMany}))
+		}
+		if storage.VolumeSizeLimit.Cmp(storage.VolumeSizeRequest) < 0 {
+			allErrs = append(allErrs, field.Invalid(storagePath.Child("volumeSizeLimit"), storage.VolumeSizeLimit.String(),
+				"must be at least volumeSizeRequest "+storage.VolumeSizeRequest.String()))
+		}
+	}
+
+	if spec.TLS != nil && !slices.Contains([]TLSProvider{TLSProviderAuto, TLSProviderCertManager}, spec.TLS.Provider) {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("tls", "provider"), spec.TLS.Provider,
+			[]TLSProvider{TLSProviderAuto, TLSProviderCertManager}))
+	}
+	if spec.TLS != nil && spec.TLS.Provider == TLSProviderCertManager {
+		allErrs = append(allErrs, validateCertManagerConfig(spec.TLS.ProviderCfg.CertManagerCfg, specPath.Child("tls", "providerCfg", "certManagerCfg"))...)
+	}
+	if spec.TLS != nil && spec.TLS.Provider == TLSProviderAuto && spec.TLS.ProviderCfg.AutoCfg != nil {
+		if d := spec.TLS.ProviderCfg.AutoCfg.Duration; d != nil && d.Duration < time.Hour {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("tls", "providerCfg", "autoCfg", "duration"), d.Duration.String(),
+				"must be at least 1h"))
+		}
+	}
+
+	allErrs = append(allErrs, validateTuning(spec.Tuning, spec.EtcdOptions, specPath)...)
+	if len(spec.EtcdOptions) > 64 {
+		allErrs = append(allErrs, field.TooMany(specPath.Child("etcdOptions"), len(spec.EtcdOptions), 64))
+	}
+	for i, option := range spec.EtcdOptions {
+		if len(option) > 1024 {
+			allErrs = append(allErrs, field.TooLong(specPath.Child("etcdOptions").Index(i), option, 1024))
+		}
+	}
+	allErrs = append(allErrs, validateMaxLearners(spec.EtcdOptions, spec.Size, specPath)...)
+	allErrs = append(allErrs, validatePodTemplate(spec.PodTemplate, spec.Tuning, specPath)...)
+
+	if r := spec.MemberReplacement; r != nil && r.FailureThreshold != nil && r.FailureThreshold.Duration < time.Minute {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("memberReplacement", "failureThreshold"), r.FailureThreshold.Duration.String(),
+			"must be at least 1m, so members aren't replaced on transient failures"))
+	}
+	if pt := spec.PodTemplate; pt != nil && pt.GracefulShutdown != nil && pt.GracefulShutdown.Timeout != nil && pt.GracefulShutdown.Timeout.Duration < time.Second {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("podTemplate", "gracefulShutdown", "timeout"), pt.GracefulShutdown.Timeout.Duration.String(),
+			"must be at least 1s"))
+	}
+
+	if storage := spec.EphemeralStorage; storage != nil {
+		storagePath := specPath.Child("ephemeralStorage")
+		if spec.StorageSpec != nil {
+			allErrs = append(allErrs, field.Forbidden(storagePath, "can't be combined with storageSpec"))
+		}
+		if storage.Medium != corev1.StorageMediumDefault && storage.Medium != corev1.StorageMediumMemory {
+			allErrs = append(allErrs, field.NotSupported(storagePath.Child("medium"), storage.Medium,
+				[]corev1.StorageMedium{corev1.StorageMediumMemory}))
+		}
+		if storage.SizeLimit != nil && storage.SizeLimit.Sign() <= 0 {
+			allErrs = append(allErrs, field.Invalid(storagePath.Child("sizeLimit"), storage.SizeLimit.String(), "must be positive"))
+		}
+	}
+
+	if r := spec.QuorumRecovery; r != nil {
+		recoveryPath := specPath.Child("quorumRecovery")
+		if !slices.Contains([]QuorumRecoverySource{QuorumRecoverySourceMember, QuorumRecoverySourceBackup}, r.Source) {
+			allErrs = append(allErrs, field.NotSupported(recoveryPath.Child("source"), r.Source,
+				[]QuorumRecoverySource{QuorumRecoverySourceMember, QuorumRecoverySourceBackup}))
+		}
+		if r.ReplayWAL && r.Source != QuorumRecoverySourceBackup {
+			allErrs = append(allErrs, field.Invalid(recoveryPath.Child("replayWAL"), r.ReplayWAL,
+				"the write-ahead log is only replayed over a backup, with the Backup source"))
+		}
+		if spec.StorageSpec == nil {
+			allErrs = append(allErrs, field.Required(specPath.Child("storageSpec"),
+				"the quorum is recovered to the volume of the first member, which requires a storageSpec"))
+		}
+	}
+
+	if m := spec.Maintenance; m != nil && m.LocalSnapshots != nil && spec.StorageSpec == nil {
+		allErrs = append(allErrs, field.Required(specPath.Child("storageSpec"),
+			"the local snapshots are taken onto the volumes of the members, which requires a storageSpec"))
+	}
+
+	if m := spec.Monitoring; m != nil && m.ServiceMonitor != nil {
+		monitorPath := specPath.Child("monitoring", "serviceMonitor")
+		// Prometheus durations have no fractions.
+		if d := m.ServiceMonitor.Interval; d != nil && (d.Duration < time.Second || d.Duration%time.Millisecond != 0) {
+			allErrs = append(allErrs, field.Invalid(monitorPath.Child("interval"), d.Duration.String(),
+				"must be at least 1s, in whole milliseconds"))
+		}
+		allErrs = append(allErrs, metav1validation.ValidateLabels(m.ServiceMonitor.Labels, monitorPath.Child("labels"))...)
+	}
+	if m := spec.Monitoring; m != nil && m.PrometheusRule != nil {
+		rulePath := specPath.Child("monitoring", "prometheusRule")
+		if m.ServiceMonitor == nil {
+			allErrs = append(allErrs, field.Required(specPath.Child("monitoring", "serviceMonitor"),
+				"the alerts of the PrometheusRule select the metrics scraped by the ServiceMonitor"))
+		}
+		allErrs = append(allErrs, metav1validation.ValidateLabels(m.PrometheusRule.Labels, rulePath.Child("labels"))...)
+		allErrs = append(allErrs, metav1validation.ValidateLabels(m.PrometheusRule.AlertLabels, rulePath.Child("alertLabels"))...)
+	}
+
+	if a := spec.Adoption; a != nil {
+		adoptionPath := specPath.Child("adoption")
+		if len(a.Endpoints) == 0 {
+			allErrs = append(allErrs, field.Required(adoptionPath.Child("endpoints"), "at least one endpoint is required"))
+		}
+		for i, ep := range a.Endpoints {
+			if u, err := url.Parse(ep); err != nil || u.Scheme != "http" || u.Host == "" {
+				allErrs = append(allErrs, field.Invalid(adoptionPath.Child("endpoints").Index(i), ep, "must be an http URL"))
+			}
+		}
+		// The operator can't reach the members of a cluster with TLS before
+		// they serve the certificates it issued.
+		if spec.TLS != nil {
+			allErrs = append(allErrs, field.Forbidden(adoptionPath, "the clusters with TLS can't be adopted"))
+		}
+	}
+
+	clientPort := DefaultClientPort
+	if spec.Ports != nil {
+		clientPort = spec.Ports.Client
+	}
+	allErrs = append(allErrs, validateClientService(spec.ClientService, clientPort, specPath)...)
+
+	if svc := spec.MemberServices; svc != nil {
+		svcPath := specPath.Child("memberServices")
+		types := []corev1.ServiceType{corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer}
+		if !slices.Contains(types, svc.Type) {
+			allErrs = append(allErrs, field.NotSupported(svcPath.Child("type"), svc.Type, types))
+		}
+		allErrs = append(allErrs, apimachineryvalidation.ValidateAnnotations(svc.Annotations, svcPath.Child("annotations"))...)
+		if svc.Domain != "" {
+			for _, msg := range utilvalidation.IsDNS1123Subdomain(svc.Domain) {
+				allErrs = append(allErrs, field.Invalid(svcPath.Child("domain"), svc.Domain, msg))
+			}
+			// The members of an adopted cluster joined it with their peer
+			// URLs in the Kubernetes cluster only.
+			if spec.Adoption != nil {
+				allErrs = append(allErrs, field.Forbidden(svcPath.Child("domain"), "the members of an adopted cluster can't advertise other URLs"))
+			}
+		}
+	}
+
+	if proxy := spec.GRPCProxy; proxy != nil {
+		proxyPath := specPath.Child("grpcProxy")
+		if proxy.Replicas != nil && *proxy.Replicas < 0 {
+			allErrs = append(allErrs, field.Invalid(proxyPath.Child("replicas"), *proxy.Replicas, "must not be negative"))
+		}
+		if proxy.Port != 0 {
+			allErrs = append(allErrs, validatePort(proxy.Port, proxyPath.Child("port"))...)
+		}
+	}
+
+	if gateway := spec.Gateway; gateway != nil {
+		gatewayPath := specPath.Child("gateway")
+		if gateway.Replicas != nil && *gateway.Replicas < 0 {
+			allErrs = append(allErrs, field.Invalid(gatewayPath.Child("replicas"), *gateway.Replicas, "must not be negative"))
+		}
+		if gateway.Port != 0 {
+			allErrs = append(allErrs, validatePort(gateway.Port, gatewayPath.Child("port"))...)
+		}
+	}
+
+	if !slices.Contains([]DeletionPolicy{DeletionPolicyDelete, DeletionPolicyProtect}, spec.DeletionPolicy) {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("deletionPolicy"), spec.DeletionPolicy,
+			[]DeletionPolicy{DeletionPolicyDelete, DeletionPolicyProtect}))
+	}
+
+	return allErrs
+}
+
+// validateTuning checks the tuning options the way etcd does on startup, so
+// a member doesn't crash-loop on them, and that etcdOptions doesn't repeat
+// them.
+func validateTuning(t *EtcdTuning, etcdOptions []string, specPath *field.Path) field.ErrorList {
+	if t == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	tuningPath := specPath.Child("tuning")
+
+	if t.QuotaBackendBytes != nil && t.QuotaBackendBytes.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(tuningPath.Child("quotaBackendBytes"), t.QuotaBackendBytes.String(), "must be positive"))
+	}
+	if t.MaxRequestBytes != nil && t.MaxRequestBytes.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(tuningPath.Child("maxRequestBytes"), t.MaxRequestBytes.String(), "must be positive"))
+	}
+
+	switch {
+	case !slices.Contains([]AutoCompactionMode{"", AutoCompactionModePeriodic, AutoCompactionModeRevision}, t.AutoCompactionMode):
+		allErrs = append(allErrs, field.NotSupported(tuningPath.Child("autoCompactionMode"), t.AutoCompactionMode,
+			[]AutoCompactionMode{AutoCompactionModePeriodic, AutoCompactionModeRevision}))
+	case t.AutoCompactionRetention == "":
+		if t.AutoCompactionMode != "" {
+			allErrs = append(allErrs, field.Required(tuningPath.Child("autoCompactionRetention"),
+				"the auto compaction is disabled without a retention"))
+		}
+	case t.AutoCompactionMode == AutoCompactionModeRevision:
+		if n, err := strconv.ParseInt(t.AutoCompactionRetention, 10, 64); err != nil || n < 0 {
+			allErrs = append(allErrs, field.Invalid(tuningPath.Child("autoCompactionRetention"), t.AutoCompactionRetention,
+				"must be a number of revisions with the revision mode"))
+		}
+	default:
+		if _, err := time.ParseDuration(t.AutoCompactionRetention); err != nil {
+			if n, err := strconv.ParseInt(t.AutoCompactionRetention, 10, 64); err != nil || n < 0 {
+				allErrs = append(allErrs, field.Invalid(tuningPath.Child("autoCompactionRetention"), t.AutoCompactionRetention,
+					"must be a duration, e.g. 1h, or a number of hours with the periodic mode"))
+			}
+		}
+	}
+
+	if t.SnapshotCount != nil && *t.SnapshotCount < 1 {
+		allErrs = append(allErrs, field.Invalid(tuningPath.Child("snapshotCount"), *t.SnapshotCount, "must be at least 1"))
+	}
+
+	// The defaults of etcd apply to the timings not set.
+	heartbeat, election := 100*time.Millisecond, time.Second
+	if t.HeartbeatInterval != nil {
+		heartbeat = t.HeartbeatInterval.Duration
+		if heartbeat < time.Millisecond {
+			allErrs = append(allErrs, field.Invalid(tuningPath.Child("heartbeatInterval"), heartbeat.String(), "must be at least 1ms"))
+		}
+	}
+	electionPath := tuningPath.Child("electionTimeout")
+	if t.ElectionTimeout != nil {
+		election = t.ElectionTimeout.Duration
+	} else {
+		electionPath = tuningPath.Child("heartbeatInterval")
+	}
+	if election < 5*heartbeat {
+		allErrs = append(allErrs, field.Invalid(electionPath, election.String(),
+			fmt.Sprintf("the election timeout %s must be at least 5 times the heartbeat interval %s", election, heartbeat)))
+	}
+	if election > 50*time.Second {
+		allErrs = append(allErrs, field.Invalid(electionPath, election.String(), "must be at most 50s"))
+	}
+
+	optionsPath := specPath.Child("etcdOptions")
+	for _, flag := range t.Flags() {
+		name, _, _ := strings.Cut(flag, "=")
+		for i, option := range etcdOptions {
+			if flagName(option) == name {
+				allErrs = append(allErrs, field.Invalid(optionsPath.Index(i), option, name+" is set by spec.tuning"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// maxLearnersFlags are the etcd flags setting how many learners a cluster
+// accepts.
+var maxLearnersFlags = []string{"--max-learners", "--experimental-max-learners"}
+
+// validateMaxLearners checks that etcdOptions doesn't let the learners
+// outnumber the voting members, size, of a cluster.
+func validateMaxLearners(etcdOptions []string, size int, specPath *field.Path) field.ErrorList {
+	if size == 0 {
+		return nil
+	}
+	var allErrs field.ErrorList
+	optionsPath := specPath.Child("etcdOptions")
+	for i, option := range etcdOptions {
+		name := flagName(option)
+		if !slices.Contains(maxLearnersFlags, name) {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimLeft(option[len(name):], "= ")); err == nil && n >= size {
+			allErrs = append(allErrs, field.Invalid(optionsPath.Index(i), option,
+				fmt.Sprintf("the learners must be fewer than the voting members, size %d", size)))
+		}
+	}
+	return allErrs
+}
+
+// operatorFlags are the etcd flags the operator sets to make up the cluster,
+// which the extra arguments of the pod template can't override.
+var operatorFlags = []string{
+	"--name",
+	"--data-dir",
+	"--listen-peer-urls",
+	"--initial-advertise-peer-urls",
+	"--initial-cluster",
+	"--initial-cluster-state",
+}
+
+// operatorEnv are the environment variables the operator sets on the etcd
+// container, which the environment of the pod template can't override.
+var operatorEnv = []string{"POD_NAME", "POD_NAMESPACE"}
+
+// flagName returns the name of the flag set by option, e.g. --name for
+// --name=etcd-0 or --name etcd-0.
+func flagName(option string) string {
+	if idx := strings.IndexAny(option, "= "); idx >= 0 {
+		return option[:idx]
+	}
+	return option
+}
+
+// flagEnv returns the environment variable etcd reads the flag name from,
+// e.g. ETCD_DATA_DIR for --data-dir.
+func flagEnv(name string) string {
+	return "ETCD_" + strings.ToUpper(strings.ReplaceAll(strings.TrimLeft(name, "-"), "-", "_"))
+}
+
+// validatePodTemplate checks that the extra arguments and the environment of
+// the pod template don't override what the operator sets, as the members
+// would then no longer match the cluster the operator manages, nor repeat
+// the tuning options.
+func validatePodTemplate(pt *PodTemplate, t *EtcdTuning, specPath *field.Path) field.ErrorList {
+	if pt == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	ptPath := specPath.Child("podTemplate")
+
+	var tuningFlags []string
+	for _, flag := range t.Flags() {
+		tuningFlags = append(tuningFlags, flagName(flag))
+	}
+	for i, arg := range pt.ExtraArgs {
+		name := flagName(arg)
+		switch {
+		case !strings.HasPrefix(name, "-"):
+			allErrs = append(allErrs, field.Invalid(ptPath.Child("extraArgs").Index(i), arg, "must be a flag, e.g. --name=value"))
+		case slices.Contains(operatorFlags, "--"+strings.TrimLeft(name, "-")):
+			allErrs = append(allErrs, field.Invalid(ptPath.Child("extraArgs").Index(i), arg, name+" is set by the operator"))
+		case slices.Contains(tuningFlags, "--"+strings.TrimLeft(name, "-")):
+			allErrs = append(allErrs, field.Invalid(ptPath.Child("extraArgs").Index(i), arg, name+" is set by spec.tuning"))
+		}
+	}
+
+	for i, env := range pt.Env {
+		owned := slices.Contains(operatorEnv, env.Name) || slices.ContainsFunc(operatorFlags, func(flag string) bool {
+			return flagEnv(flag) == env.Name
+		})
+		if owned {
+			allErrs = append(allErrs, field.Invalid(ptPath.Child("env").Index(i).Child("name"), env.Name, env.Name+" is set by the operator"))
+		}
+	}
+	return allErrs
+}
+
+// validateClientService checks the client Service the way the API server
+// validates Services, so the operator doesn't fail to apply it.
+func validateClientService(svc *ClientService, clientPort int32, specPath *field.Path) field.ErrorList {
+	if svc == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	svcPath := specPath.Child("clientService")
+
+	types := []corev1.ServiceType{corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer}
+	if !slices.Contains(types, svc.Type) {
+		allErrs = append(allErrs, field.NotSupported(svcPath.Child("type"), svc.Type, types))
+	}
+	affinities := []corev1.ServiceAffinity{corev1.ServiceAffinityNone, corev1.ServiceAffinityClientIP}
+	if !slices.Contains(affinities, svc.SessionAffinity) {
+		allErrs = append(allErrs, field.NotSupported(svcPath.Child("sessionAffinity"), svc.SessionAffinity, affinities))
+	}
+	allErrs = append(allErrs, apimachineryvalidation.ValidateAnnotations(svc.Annotations, svcPath.Child("annotations"))...)
+
+	nodePorts := svc.Type == corev1.ServiceTypeNodePort || svc.Type == corev1.ServiceTypeLoadBalancer
+	validateNodePort := func(nodePort int32, fldPath *field.Path) {
+		if nodePort == 0 {
+			return
+		}
+		if !nodePorts {
+			allErrs = append(allErrs, field.Forbidden(fldPath, "may only be set with the NodePort and LoadBalancer types"))
+			return
+		}
+		allErrs = append(allErrs, validatePort(nodePort, fldPath)...)
+	}
+	validateNodePort(svc.NodePort, svcPath.Child("nodePort"))
+
+	if len(svc.LoadBalancerSourceRanges) > 0 && svc.Type != corev1.ServiceTypeLoadBalancer {
+		allErrs = append(allErrs, field.Forbidden(svcPath.Child("loadBalancerSourceRanges"), "may only be set with the LoadBalancer type"))
+	}
+	for i, cidr := range svc.LoadBalancerSourceRanges {
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(cidr)); err != nil {
+			allErrs = append(allErrs, field.Invalid(svcPath.Child("loadBalancerSourceRanges").Index(i), cidr, "must be a CIDR, e.g. 10.0.0.0/8"))
+		}
+	}
+
+	names := map[string]bool{"client": true}
+	numbers := map[int32]bool{clientPort: true}
+	for i, p := range svc.ExtraPorts {
+		portPath := svcPath.Child("extraPorts").Index(i)
+		for _, msg := range utilvalidation.IsValidPortName(p.Name) {
+			allErrs = append(allErrs, field.Invalid(portPath.Child("name"), p.Name, msg))
+		}
+		if names[p.Name] {
+			allErrs = append(allErrs, field.Duplicate(portPath.Child("name"), p.Name))
+		}
+		names[p.Name] = true
+		allErrs = append(allErrs, validatePort(p.Port, portPath.Child("port"))...)
+		if numbers[p.Port] {
+			allErrs = append(allErrs, field.Duplicate(portPath.Child("port"), p.Port))
+		}
+		numbers[p.Port] = true
+		validateNodePort(p.NodePort, portPath.Child("nodePort"))
+	}
+	return allErrs
+}
+
+func validatePort(port int32, fldPath *field.Path) field.ErrorList {
+	if port < 1 || port > 65535 {
+		return field.ErrorList{field.Invalid(fldPath, port, "must be between 1 and 65535")}
+	}
+	return nil
+}
+
+// ValidateEtcdClusterUpdate checks that an update of an EtcdCluster doesn't
+// change fields that can't be changed safely on a live cluster. Both objects
+// are expected to be defaulted.
+func ValidateEtcdClusterUpdate(newEc, oldEc *EtcdCluster) field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	allErrs = append(allErrs, validateStorageUpdate(newEc.Spec.StorageSpec, oldEc.Spec.StorageSpec, specPath.Child("storageSpec"))...)
+	if !equality.Semantic.DeepEqual(newEc.Spec.EphemeralStorage, oldEc.Spec.EphemeralStorage) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("ephemeralStorage"),
+			"the members would restart with empty volumes and lose their data; create a new EtcdCluster instead"))
+	}
+
+	if oldEc.Spec.Ports != nil && newEc.Spec.Ports != nil && newEc.Spec.Ports.Peer != oldEc.Spec.Ports.Peer {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("ports", "peer"),
+			"the peer port is part of the member peer URLs and can't be changed on an existing cluster; "+
+				"create a new EtcdCluster and migrate the data instead"))
+	}
+
+	allErrs = append(allErrs, validateTLSUpdate(newEc.Spec.TLS, oldEc.Spec.TLS, specPath.Child("tls"))...)
+
+	if memberServicesDomain(newEc) != memberServicesDomain(oldEc) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("memberServices", "domain"),
+			"the domain is part of the member peer URLs and can't be changed on an existing cluster; "+
+				"create a new EtcdCluster and migrate the data instead"))
+	}
+
+	if (newEc.Spec.KubeconfigSecretRef == nil) != (oldEc.Spec.KubeconfigSecretRef == nil) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("kubeconfigSecretRef"),
+			"the members can't be moved to or from a remote Kubernetes cluster; "+
+				"create a new EtcdCluster and migrate the data instead"))
+	}
+
+	return allErrs
+}
+
+// memberServicesDomain returns the domain the members of ec advertise their
+// URLs at, if any.
+func memberServicesDomain(ec *EtcdCluster) string {
+	if ec.Spec.MemberServices == nil {
+		return ""
+	}
+	return ec.Spec.MemberServices.Domain
+}
+
+// WarnEtcdClusterUpdate returns warnings about updates of an EtcdCluster that
+// are allowed but risky. Both objects are expected to be defaulted.
+func WarnEtcdClusterUpdate(newEc, oldEc *EtcdCluster) []string {
+	var warnings []string
+
+	if removed := oldEc.Spec.Size - newEc.Spec.Size; removed > 1 {
+		warnings = append(warnings, fmt.Sprintf(
+			"spec.size: scaling down from %d to %d removes %d members; the operator removes them one at a time, "+
+				"consider scaling down by one member and checking the cluster health in between",
+			oldEc.Spec.Size, newEc.Spec.Size, removed))
+	}
+
+	if changed := disruptiveChanges(newEc, oldEc); len(changed) > 1 {
+		warnings = append(warnings, fmt.Sprintf(
+			"%s are changed at once; each of them restarts or replaces members, "+
+				"consider applying them one at a time so a failure is easier to attribute and roll back",
+			strings.Join(changed, ", ")))
+	}
+
+	if newStorage, oldStorage := newEc.Spec.StorageSpec, oldEc.Spec.StorageSpec; newStorage != nil && oldStorage != nil &&
+		newStorage.AccessModes == corev1.ReadWriteOnce && newStorage.VolumeSizeRequest.Cmp(oldStorage.VolumeSizeRequest) > 0 {
+		warnings = append(warnings, fmt.Sprintf(
+			"spec.storageSpec.volumeSizeRequest: the volumes of the members are expanded from %s to %s in place, "+
+				"which requires a storage class with allowVolumeExpansion",
+			oldStorage.VolumeSizeRequest.String(), newStorage.VolumeSizeRequest.String()))
+	}
+
+	if newEc.Spec.Version != oldEc.Spec.Version && meta.IsStatusConditionTrue(oldEc.Status.Conditions, EtcdClusterConditionDegraded) {
+		warnings = append(warnings, fmt.Sprintf(
+			"spec.version: upgrading from %s to %s while the cluster is Degraded; restarting members "+
+				"of an unhealthy cluster can cost quorum, consider fixing the unhealthy members first",
+			oldEc.Spec.Version, newEc.Spec.Version))
+	}
+
+	return warnings
+}
+
+// disruptiveChanges returns the paths of the changed fields whose update
+// restarts or replaces members.
+func disruptiveChanges(newEc, oldEc *EtcdCluster) []string {
+	var changed []string
+	if newEc.Spec.Size != oldEc.Spec.Size {
+		changed = append(changed, "spec.size")
+	}
+	if newEc.Spec.Version != oldEc.Spec.Version {
+		changed = append(changed, "spec.version")
+	}
+	if !equality.Semantic.DeepEqual(newEc.Spec.EtcdOptions, oldEc.Spec.EtcdOptions) {
+		changed = append(changed, "spec.etcdOptions")
+	}
+	if !equality.Semantic.DeepEqual(newEc.Spec.Tuning, oldEc.Spec.Tuning) {
+		changed = append(changed, "spec.tuning")
+	}
+	if !equality.Semantic.DeepEqual(newEc.Spec.Ports, oldEc.Spec.Ports) {
+		changed = append(changed, "spec.ports")
+	}
+	if !equality.Semantic.DeepEqual(newEc.Spec.PodTemplate, oldEc.Spec.PodTemplate) {
+		changed = append(changed, "spec.podTemplate")
+	}
+	if !equality.Semantic.DeepEqual(newEc.Spec.StorageSpec, oldEc.Spec.StorageSpec) {
+		changed = append(changed, "spec.storageSpec")
+	}
+	return changed
+}
+
+func validateStorageUpdate(newStorage, oldStorage *StorageSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch {
+	case oldStorage == nil && newStorage == nil:
+		return nil
+	case oldStorage == nil:
+		return append(allErrs, field.Forbidden(fldPath,
+			"persistent storage can't be added to an existing cluster; create a new EtcdCluster with storageSpec set"))
+	case newStorage == nil:
+		return append(allErrs, field.Forbidden(fldPath,
+			"persistent storage can't be removed from an existing cluster"))
+	}
+
+	if newStorage.StorageClassName != oldStorage.StorageClassName {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("storageClassName"),
+			"the storage class of existing volumes can't be changed; create a new EtcdCluster with the desired storage class"))
+	}
+	if newStorage.AccessModes != oldStorage.AccessModes {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("accessModes"),
+			"the access mode of existing volumes can't be changed"))
+	}
+	if newStorage.PVCName != oldStorage.PVCName {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("pvcName"),
+			"the PVC backing an existing cluster can't be changed"))
+	}
+	if newStorage.VolumeSizeRequest.Cmp(oldStorage.VolumeSizeRequest) < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("volumeSizeRequest"), newStorage.VolumeSizeRequest.String(),
+			"volumes can't be shrunk; the size must be at least "+oldStorage.VolumeSizeRequest.String()))
+	}
+
+	return allErrs
+}
+
+// validateCertManagerConfig checks the configuration of the cert-manager
+// provider.
+func validateCertManagerConfig(cfg *ProviderCertManagerConfig, fldPath *field.Path) field.ErrorList {
+	if cfg == nil {
+		return field.ErrorList{field.Required(fldPath, "the cert-manager provider needs the issuer of the certificates")}
+	}
+	var allErrs field.ErrorList
+	if cfg.IssuerRef.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("issuerRef", "name"), ""))
+	}
+	if kind := cfg.IssuerRef.Kind; kind != "" && kind != "Issuer" && kind != "ClusterIssuer" {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("issuerRef", "kind"), kind, []string{"Issuer", "ClusterIssuer"}))
+	}
+	// cert-manager rejects the certificates of less than an hour.
+	if cfg.Duration != nil && cfg.Duration.Duration < time.Hour {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("duration"), cfg.Duration.Duration.String(), "must be at least 1h"))
+	}
+	return allErrs
+}
+
+func validateTLSUpdate(newTLS, oldTLS *TLSCertificate, fldPath *field.Path) field.ErrorList {
+	if oldTLS == nil {
+		if newTLS != nil {
+			return field.ErrorList{field.Forbidden(fldPath,
+				"TLS can't be enabled on an existing cluster, as the members advertise their plaintext peer URLs to each other")}
+		}
+		return nil
+	}
+	if newTLS == nil {
+		return field.ErrorList{field.Forbidden(fldPath,
+			"TLS can't be disabled on a cluster that was created with TLS, as clients and peers would fall back to plaintext")}
+	}
+	if newTLS.Provider != oldTLS.Provider {
+		return field.ErrorList{field.Forbidden(fldPath.Child("provider"),
+			"the certificate provider of an existing cluster can't be changed")}
+	}
+	return nil
+}
+
+// ValidateEtcdClusterPolicy checks that an EtcdCluster satisfies the
+// constraints of an EtcdOperatorPolicy. The EtcdCluster is expected to be
+// defaulted.
+func ValidateEtcdClusterPolicy(ec *EtcdCluster, policy *EtcdOperatorPolicy) field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+	constraints := policy.Spec
+
+	if len(constraints.AllowedVersions) > 0 && !versionAllowed(ec.Spec.Version, constraints.AllowedVersions) {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("version"), ec.Spec.Version, constraints.AllowedVersions))
+	}
+	if constraints.MaxSize != nil && ec.Spec.Size > *constraints.MaxSize {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("size"), ec.Spec.Size,
+			fmt.Sprintf("must be at most %d according to EtcdOperatorPolicy %s", *constraints.MaxSize, policy.Name)))
+	}
+	if constraints.RequireTLS && ec.Spec.TLS == nil {
+		allErrs = append(allErrs, field.Required(specPath.Child("tls"),
+			fmt.Sprintf("TLS is required by EtcdOperatorPolicy %s", policy.Name)))
+	}
+	if len(constraints.AllowedStorageClasses) > 0 && ec.Spec.StorageSpec != nil &&
+		!slices.Contains(constraints.AllowedStorageClasses, ec.Spec.StorageSpec.StorageClassName) {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("storageSpec", "storageClassName"),
+			ec.Spec.StorageSpec.StorageClassName, constraints.AllowedStorageClasses))
+	}
+
+	return allErrs
+}
+
+// versionAllowed reports whether version matches one of the allowed
+// versions, which match the versions they are a component-wise prefix of.
+func versionAllowed(version string, allowed []string) bool {
+	for _, a := range allowed {
+		if version == a || strings.HasPrefix(version, a+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// EtcdClusterOverrideSpec defines a patch applied to the spec of EtcdClusters.
+type EtcdClusterOverrideSpec struct {
+	// ClusterSelector selects the EtcdClusters of the namespace the override
+	// applies to. The override applies to all the EtcdClusters of the
+	// namespace when it isn't set.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+	// Priority orders the overrides applying to the same EtcdCluster. Overrides
+	// with a higher priority are applied later, and win when they patch the
+	// same fields. Overrides with the same priority are applied in name order.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+	// Patch is a strategic merge patch of the EtcdCluster spec, applied on
+	// top of the spec and of its template.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Patch runtime.RawExtension `json:"patch"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdClusterOverride is the Schema for the etcdclusteroverrides API. It
+// adjusts the EtcdClusters of its namespace, e.g. to lower their resources
+// in a staging environment, without changing their manifests.
+type EtcdClusterOverride struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EtcdClusterOverrideSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdClusterOverrideList contains a list of EtcdClusterOverride.
+type EtcdClusterOverrideList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdClusterOverride `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdClusterOverride{}, &EtcdClusterOverrideList{})
+}
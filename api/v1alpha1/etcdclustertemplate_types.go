@@ -0,0 +1,78 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EtcdClusterTemplateSpec defines the shared configuration of the EtcdClusters
+// referencing the template. Every field set on an EtcdCluster takes precedence
+// over the template.
+type EtcdClusterTemplateSpec struct {
+	// Version is the version of etcd run by the clusters.
+	// +optional
+	Version string `json:"version,omitempty"`
+	// StorageSpec is the persistent storage of the members.
+	// +optional
+	StorageSpec *StorageSpec `json:"storageSpec,omitempty"`
+	// EphemeralStorage keeps the data of the members in an emptyDir volume.
+	// +optional
+	EphemeralStorage *EphemeralStorage `json:"ephemeralStorage,omitempty"`
+	// TLS is the TLS certificate configuration of the clusters.
+	// +optional
+	TLS *TLSCertificate `json:"tls,omitempty"`
+	// EtcdOptions are the command line arguments passed to etcd. They are
+	// replaced as a whole by the etcdOptions of an EtcdCluster.
+	// +optional
+	EtcdOptions []string `json:"etcdOptions,omitempty"`
+	// Ports configures the ports etcd listens on.
+	// +optional
+	Ports *EtcdPorts `json:"ports,omitempty"`
+	// PodTemplate customizes the pods running the etcd members.
+	// +optional
+	PodTemplate *PodTemplate `json:"podTemplate,omitempty"`
+	// DeletionPolicy controls whether deleting the clusters must be confirmed.
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+
+// EtcdClusterTemplate is the Schema for the etcdclustertemplates API. It
+// holds a configuration shared by EtcdClusters across namespaces, which
+// reference it through spec.templateRef.
+type EtcdClusterTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EtcdClusterTemplateSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdClusterTemplateList contains a list of EtcdClusterTemplate.
+type EtcdClusterTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdClusterTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdClusterTemplate{}, &EtcdClusterTemplateList{})
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// EtcdMirrorConditionMirroring is True while the keys of the source of
+	// an EtcdMirror are replicated to its destination.
+	EtcdMirrorConditionMirroring = "Mirroring"
+
+	// PromoteAnnotation, set to "true" on an EtcdMirror with a failover,
+	// promotes its destination right away, whatever the state of its
+	// source.
+	PromoteAnnotation = "operator.etcd.io/promote"
+)
+
+// EtcdMirrorSpec defines the cluster whose keys are mirrored, and where to.
+// +kubebuilder:validation:XValidation:rule="!has(self.destination.clusterName) || self.destination.clusterName != self.sourceClusterName",message="the destination must be another cluster than the source"
+// +kubebuilder:validation:XValidation:rule="!has(self.failover) || has(self.destination.clusterName)",message="failover requires an EtcdCluster destination"
+type EtcdMirrorSpec struct {
+	// SourceClusterName is the name of the EtcdCluster, in the namespace of
+	// the EtcdMirror, whose keys are mirrored.
+	// +kubebuilder:validation:MinLength=1
+	SourceClusterName string `json:"sourceClusterName"`
+	// Destination is the etcd cluster the keys are written to.
+	Destination EtcdMirrorDestination `json:"destination"`
+	// Prefix restricts the mirrored keys to the ones starting with it. All
+	// the keys are mirrored when unset.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// DestPrefix replaces Prefix in the keys written to the destination,
+	// like the --dest-prefix flag of `etcdctl make-mirror`. The keys are
+	// written as is when unset.
+	// +optional
+	DestPrefix string `json:"destPrefix,omitempty"`
+	// Failover promotes the destination EtcdCluster in place of the source
+	// once the source failed: the mirror stops for good, and the failover
+	// Service moves to the members of the destination.
+	// +optional
+	Failover *EtcdMirrorFailover `json:"failover,omitempty"`
+}
+
+// EtcdMirrorFailover configures the promotion of the destination of an
+// EtcdMirror.
+type EtcdMirrorFailover struct {
+	// Automatic promotes the destination once the source has been
+	// unavailable for FailureThreshold. Otherwise, the destination is only
+	// promoted through the operator.etcd.io/promote annotation.
+	// +optional
+	Automatic bool `json:"automatic,omitempty"`
+	// FailureThreshold is how long the source must be unavailable, i.e.
+	// missing or with its Available condition not True, before it is
+	// failed over automatically. Defaults to 5m.
+	// +optional
+	FailureThreshold *metav1.Duration `json:"failureThreshold,omitempty"`
+	// ServiceName is the name of the Service, in the namespace of the
+	// EtcdMirror, the operator maintains for the clients to reach the active
+	// cluster: it selects the members of the source, then the ones of the
+	// destination once promoted. No Service is maintained when unset.
+	// +optional
+	ServiceName string `json:"serviceName,omitempty"`
+}
+
+// EtcdMirrorDestination is the etcd cluster an EtcdMirror writes to: either
+// an EtcdCluster, or the endpoints of a cluster the operator doesn't run.
+// +kubebuilder:validation:XValidation:rule="has(self.clusterName) != has(self.endpoints)",message="exactly one of clusterName and endpoints must be set"
+type EtcdMirrorDestination struct {
+	// ClusterName is the name of the EtcdCluster, in the namespace of the
+	// EtcdMirror, the keys are written to. The operator connects to it like
+	// to the source.
+	// +optional
+	ClusterName string `json:"clusterName,omitempty"`
+	// Endpoints are the client URLs of the members of the destination, when
+	// the operator doesn't run it.
+	// +kubebuilder:validation:MinItems=1
+	// +optional
+	Endpoints []string `json:"endpoints,omitempty"`
+	// TLSSecretRef references the Secret, in the namespace of the
+	// EtcdMirror, holding the CA (ca.crt) and the client certificate
+	// (tls.crt and tls.key) used to reach the Endpoints.
+	// +optional
+	TLSSecretRef *corev1.LocalObjectReference `json:"tlsSecretRef,omitempty"`
+	// CredentialsSecretRef references the kubernetes.io/basic-auth Secret,
+	// in the namespace of the EtcdMirror, holding the user and the password
+	// the Endpoints are written with, when their authentication is enabled.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// EtcdMirrorStatus defines the observed state of EtcdMirror.
+type EtcdMirrorStatus struct {
+	// ObservedGeneration is the generation of the EtcdMirror the mirror
+	// runs.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the latest observed state of the mirror.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// MirroredRevision is the revision of the source the destination caught
+	// up with. The mirror resumes from it when restarted.
+	// +optional
+	MirroredRevision int64 `json:"mirroredRevision,omitempty"`
+	// SourceRevision is the revision of the source when the status was last
+	// updated.
+	// +optional
+	SourceRevision int64 `json:"sourceRevision,omitempty"`
+	// LagRevisions is how many revisions of the source the destination is
+	// behind: SourceRevision minus MirroredRevision.
+	// +optional
+	LagRevisions int64 `json:"lagRevisions,omitempty"`
+	// LastSyncTime is when the destination last caught up with
+	// MirroredRevision.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// SourceUnavailableSince is when the source was first seen unavailable,
+	// with a failover. It is cleared once the source is available again.
+	// +optional
+	SourceUnavailableSince *metav1.Time `json:"sourceUnavailableSince,omitempty"`
+	// PromotedTime is when the destination was promoted in place of the
+	// source. The mirror doesn't run anymore once it is set.
+	// +optional
+	PromotedTime *metav1.Time `json:"promotedTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.spec.sourceClusterName`
+// +kubebuilder:printcolumn:name="Mirroring",type=string,JSONPath=`.status.conditions[?(@.type=="Mirroring")].status`
+// +kubebuilder:printcolumn:name="Lag",type=integer,JSONPath=`.status.lagRevisions`
+// +kubebuilder:printcolumn:name="Promoted",type=date,JSONPath=`.status.promotedTime`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EtcdMirror is the Schema for the etcdmirrors API.
+// It replicates the keys of an EtcdCluster to another etcd cluster, like
+// `etcdctl make-mirror`, to keep a warm standby of it: the operator copies
+// the keys, then applies the changes of the source as they happen.
+type EtcdMirror struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdMirrorSpec   `json:"spec,omitempty"`
+	Status EtcdMirrorStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdMirrorList contains a list of EtcdMirror.
+type EtcdMirrorList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdMirror `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdMirror{}, &EtcdMirrorList{})
+}
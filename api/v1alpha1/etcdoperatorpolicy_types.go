@@ -0,0 +1,73 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EtcdOperatorPolicySpec defines the constraints EtcdClusters must satisfy.
+// Unset fields don't constrain anything.
+type EtcdOperatorPolicySpec struct {
+	// NamespaceSelector selects the namespaces of the EtcdClusters the policy
+	// applies to. The policy applies to all namespaces when it isn't set.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// AllowedVersions lists the etcd versions clusters may run. An entry
+	// matches the versions it is a prefix of, component-wise, so "v3.5"
+	// allows "v3.5.21" but not "v3.50.0".
+	// +optional
+	AllowedVersions []string `json:"allowedVersions,omitempty"`
+	// MaxSize is the largest size a cluster may request.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxSize *int `json:"maxSize,omitempty"`
+	// RequireTLS requires clusters to enable TLS.
+	// +optional
+	RequireTLS bool `json:"requireTLS,omitempty"`
+	// AllowedStorageClasses lists the storage classes clusters may use for
+	// persistent storage. Clusters with persistent storage must then name one
+	// of them explicitly.
+	// +optional
+	AllowedStorageClasses []string `json:"allowedStorageClasses,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+
+// EtcdOperatorPolicy is the Schema for the etcdoperatorpolicies API. It
+// constrains what EtcdClusters may request, and is enforced when they are
+// created or updated.
+type EtcdOperatorPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EtcdOperatorPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdOperatorPolicyList contains a list of EtcdOperatorPolicy.
+type EtcdOperatorPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdOperatorPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdOperatorPolicy{}, &EtcdOperatorPolicyList{})
+}
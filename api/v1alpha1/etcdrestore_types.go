@@ -0,0 +1,223 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RestoreLabel is set on the EtcdClusters created by an EtcdRestore, to the
+// name of the restore.
+const RestoreLabel = "operator.etcd.io/restore"
+
+// EtcdRestoreSpec defines the EtcdCluster to create, and the snapshot it
+// starts from.
+type EtcdRestoreSpec struct {
+	// ClusterName is the name of the EtcdCluster created from the snapshot,
+	// in the namespace of the EtcdRestore. It must not exist.
+	// +kubebuilder:validation:MinLength=1
+	ClusterName string `json:"clusterName"`
+	// ClusterSpec is the spec of the EtcdCluster. It must have a storageSpec,
+	// the snapshot is restored to the volume of the first member.
+	// +kubebuilder:validation:XValidation:rule="has(self.storageSpec)",message="the restored cluster needs a storageSpec"
+	// +kubebuilder:validation:XValidation:rule="!has(self.kubeconfigSecretRef)",message="clusters run in a remote Kubernetes cluster can't be restored"
+	ClusterSpec EtcdClusterSpec `json:"clusterSpec"`
+	// Source is where the snapshot is read from.
+	Source RestoreSource `json:"source"`
+	// ServiceAccountName is the ServiceAccount the restore Job runs as, e.g.
+	// one bound to a cloud identity through workload identity. Defaults to
+	// the default ServiceAccount of the namespace.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// Encryption decrypts the snapshot, encrypted by an EtcdBackup with the
+	// same key.
+	// +optional
+	Encryption *SnapshotEncryption `json:"encryption,omitempty"`
+}
+
+// RestoreSource is where the snapshot of an EtcdRestore is read from. Exactly
+// one of its fields must be set.
+// +kubebuilder:validation:XValidation:rule="(has(self.s3) ? 1 : 0) + (has(self.gcs) ? 1 : 0) + (has(self.azure) ? 1 : 0) + (has(self.pvc) ? 1 : 0) + (has(self.hostPath) ? 1 : 0) == 1",message="exactly one of s3, gcs, azure, pvc and hostPath must be set"
+type RestoreSource struct {
+	// S3 reads the snapshot from an S3, or S3-compatible, bucket, e.g. the
+	// snapshot of an EtcdBackup.
+	// +optional
+	S3 *S3SnapshotSource `json:"s3,omitempty"`
+	// GCS reads the snapshot from a Google Cloud Storage bucket.
+	// +optional
+	GCS *GCSSnapshotSource `json:"gcs,omitempty"`
+	// Azure reads the snapshot from an Azure Blob Storage container.
+	// +optional
+	Azure *AzureSnapshotSource `json:"azure,omitempty"`
+	// PVC reads the snapshot from a PersistentVolumeClaim.
+	// +optional
+	PVC *PVCSnapshotSource `json:"pvc,omitempty"`
+	// HostPath reads the snapshot from a directory of a node.
+	// +optional
+	HostPath *HostPathSnapshotSource `json:"hostPath,omitempty"`
+}
+
+// S3SnapshotSource is a snapshot in an S3, or S3-compatible, bucket.
+type S3SnapshotSource struct {
+	// Bucket is the name of the bucket.
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+	// Key is the key of the snapshot in the bucket, e.g. the one of the
+	// location of an EtcdBackup.
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+	// Region is the region of the bucket.
+	// +optional
+	Region string `json:"region,omitempty"`
+	// Endpoint is the URL of an S3-compatible service, e.g. MinIO. Defaults
+	// to the endpoint of AWS for the region.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// CredentialsSecretRef references the Secret, in the namespace of the
+	// EtcdRestore, holding the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+	// reading the snapshot.
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+}
+
+// GCSSnapshotSource is a snapshot in a Google Cloud Storage bucket.
+type GCSSnapshotSource struct {
+	// Bucket is the name of the bucket.
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+	// Object is the name of the snapshot in the bucket.
+	// +kubebuilder:validation:MinLength=1
+	Object string `json:"object"`
+	// CredentialsSecretRef references the Secret, in the namespace of the
+	// EtcdRestore, holding the key of a service account reading the
+	// snapshot under key.json. When unset, the download authenticates as
+	// the ServiceAccount of the Job, through the workload identity of GKE.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// AzureSnapshotSource is a snapshot in an Azure Blob Storage container.
+type AzureSnapshotSource struct {
+	// StorageAccount is the name of the storage account.
+	// +kubebuilder:validation:MinLength=1
+	StorageAccount string `json:"storageAccount"`
+	// Container is the name of the container.
+	// +kubebuilder:validation:MinLength=1
+	Container string `json:"container"`
+	// Blob is the name of the snapshot in the container.
+	// +kubebuilder:validation:MinLength=1
+	Blob string `json:"blob"`
+	// CredentialsSecretRef references the Secret, in the namespace of the
+	// EtcdRestore, holding the access key of the storage account under
+	// AZURE_STORAGE_KEY. When unset, the download authenticates with the
+	// managed identity of the ServiceAccount of the Job, through Azure
+	// Workload Identity.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// PVCSnapshotSource is a snapshot in a PersistentVolumeClaim.
+type PVCSnapshotSource struct {
+	// ClaimName is the name of the PersistentVolumeClaim, in the namespace of
+	// the EtcdRestore.
+	// +kubebuilder:validation:MinLength=1
+	ClaimName string `json:"claimName"`
+	// Path is the path of the snapshot in the volume, e.g. the one of an
+	// EtcdBackup of the PVC provider, relative and without .. segments.
+	// Defaults to snapshot.db, where the backups of the ExternalEtcdClusters
+	// save it.
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="!self.startsWith('/') && !self.matches('(^|/)[.][.](/|$)')",message="must be a relative path without .. segments"
+	Path string `json:"path,omitempty"`
+}
+
+// HostPathSnapshotSource is a snapshot in a directory of a node. The restore
+// Job runs on that node. The operator only reads from the directories its
+// --backup-host-path-dirs flag allows.
+type HostPathSnapshotSource struct {
+	// NodeName is the name of the node holding the directory.
+	// +kubebuilder:validation:MinLength=1
+	NodeName string `json:"nodeName"`
+	// Directory is the absolute path of the directory on the node, in one of
+	// the directories the operator allows.
+	// +kubebuilder:validation:Pattern=`^/`
+	// +kubebuilder:validation:XValidation:rule="!self.matches('(^|/)[.][.](/|$)')",message="must not have .. segments"
+	Directory string `json:"directory"`
+	// Path is the path of the snapshot in the directory, e.g. the one of an
+	// EtcdBackup of the HostPath provider, relative and without ..
+	// segments.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:XValidation:rule="!self.startsWith('/') && !self.matches('(^|/)[.][.](/|$)')",message="must be a relative path without .. segments"
+	Path string `json:"path"`
+}
+
+// EtcdRestorePhase is the progress of an EtcdRestore.
+type EtcdRestorePhase string
+
+const (
+	// EtcdRestorePhaseRunning is the phase of a snapshot being restored.
+	EtcdRestorePhaseRunning EtcdRestorePhase = "Running"
+	// EtcdRestorePhaseCompleted is the phase of a restore whose EtcdCluster
+	// is created.
+	EtcdRestorePhaseCompleted EtcdRestorePhase = "Completed"
+	// EtcdRestorePhaseFailed is the phase of a restore that couldn't be
+	// done. The operator doesn't retry it.
+	EtcdRestorePhaseFailed EtcdRestorePhase = "Failed"
+)
+
+// EtcdRestoreStatus defines the observed state of EtcdRestore.
+type EtcdRestoreStatus struct {
+	// Phase is the progress of the restore.
+	// +optional
+	Phase EtcdRestorePhase `json:"phase,omitempty"`
+	// Message explains why the restore failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// StartTime is when the restore started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the EtcdCluster was created.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// EtcdRestore is the Schema for the etcdrestores API.
+// It creates an EtcdCluster whose data starts from a snapshot.
+type EtcdRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="the spec of an EtcdRestore is immutable, create another EtcdRestore instead"
+	Spec   EtcdRestoreSpec   `json:"spec,omitempty"`
+	Status EtcdRestoreStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdRestoreList contains a list of EtcdRestore.
+type EtcdRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdRestore{}, &EtcdRestoreList{})
+}
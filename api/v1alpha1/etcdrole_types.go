@@ -0,0 +1,120 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// EtcdAuthFinalizer holds the deletion of an EtcdUser or an EtcdRole
+	// until the operator deleted the user or the role from etcd.
+	EtcdAuthFinalizer = "operator.etcd.io/etcd-auth"
+
+	// EtcdAuthConditionSynced is True when the user or the role in etcd
+	// matches the spec of its EtcdUser or EtcdRole.
+	EtcdAuthConditionSynced = "Synced"
+)
+
+// EtcdRoleSpec defines an etcd role, and the permissions it grants.
+type EtcdRoleSpec struct {
+	// ClusterName is the name of the EtcdCluster the role is managed in, in
+	// the namespace of the EtcdRole.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="clusterName is immutable"
+	ClusterName string `json:"clusterName"`
+	// RoleName is the name of the role in etcd. Defaults to the name of the
+	// EtcdRole.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="roleName is immutable"
+	// +optional
+	RoleName string `json:"roleName,omitempty"`
+	// Permissions are the permissions the role grants. The permissions
+	// granted to the role by other means, e.g. etcdctl, are revoked.
+	// +optional
+	Permissions []EtcdPermission `json:"permissions,omitempty"`
+}
+
+// EtcdPermissionType is the access an EtcdPermission grants.
+// +kubebuilder:validation:Enum=Read;Write;ReadWrite
+type EtcdPermissionType string
+
+const (
+	// EtcdPermissionRead grants reading and watching the keys.
+	EtcdPermissionRead EtcdPermissionType = "Read"
+	// EtcdPermissionWrite grants writing and deleting the keys.
+	EtcdPermissionWrite EtcdPermissionType = "Write"
+	// EtcdPermissionReadWrite grants both.
+	EtcdPermissionReadWrite EtcdPermissionType = "ReadWrite"
+)
+
+// EtcdPermission grants access to a key, or to the keys of a prefix.
+// +kubebuilder:validation:XValidation:rule="(has(self.prefix) && self.prefix) || (has(self.key) && size(self.key) > 0)",message="key must be set unless prefix is true"
+type EtcdPermission struct {
+	// Key is the key the permission applies to. With prefix, the empty key
+	// stands for all the keys.
+	// +optional
+	Key string `json:"key,omitempty"`
+	// Prefix makes the permission apply to all the keys starting with key.
+	// +optional
+	Prefix bool `json:"prefix,omitempty"`
+	// Type is the access granted to the keys.
+	Type EtcdPermissionType `json:"type"`
+}
+
+// EtcdRoleStatus defines the observed state of EtcdRole.
+type EtcdRoleStatus struct {
+	// ObservedGeneration is the generation of the EtcdRole last synced to
+	// etcd.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the latest observed state of the role.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EtcdRole is the Schema for the etcdroles API.
+// It manages a role of the authentication of an EtcdCluster, and the
+// permissions it grants on the keys. The role is deleted from etcd along with
+// the EtcdRole.
+type EtcdRole struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdRoleSpec   `json:"spec,omitempty"`
+	Status EtcdRoleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdRoleList contains a list of EtcdRole.
+type EtcdRoleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdRole `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdRole{}, &EtcdRoleList{})
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EtcdUserPasswordKey is the key of the password in the Secrets the operator
+// generates for the EtcdUsers.
+const EtcdUserPasswordKey = "password"
+
+// EtcdUserSpec defines an etcd user, its password, and the roles granted to
+// it.
+type EtcdUserSpec struct {
+	// ClusterName is the name of the EtcdCluster the user is managed in, in
+	// the namespace of the EtcdUser.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="clusterName is immutable"
+	ClusterName string `json:"clusterName"`
+	// UserName is the name of the user in etcd. Defaults to the name of the
+	// EtcdUser.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="userName is immutable"
+	// +optional
+	UserName string `json:"userName,omitempty"`
+	// PasswordSecretRef references the key of the Secret, in the namespace of
+	// the EtcdUser, holding the password of the user. The password is
+	// changed in etcd along with the Secret. When unset, the operator
+	// generates the password in a Secret named after the EtcdUser followed
+	// by "-password", under the "password" key.
+	// +optional
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+	// Roles are the names of the etcd roles granted to the user, e.g. the
+	// ones of EtcdRoles, or root. The roles granted to the user by other
+	// means, e.g. etcdctl, are revoked.
+	// +optional
+	Roles []string `json:"roles,omitempty"`
+}
+
+// EtcdUserStatus defines the observed state of EtcdUser.
+type EtcdUserStatus struct {
+	// ObservedGeneration is the generation of the EtcdUser last synced to
+	// etcd.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the latest observed state of the user.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// PasswordSecret is the name of the Secret holding the password of the
+	// user.
+	// +optional
+	PasswordSecret string `json:"passwordSecret,omitempty"`
+	// PasswordSecretVersion is the resourceVersion of the password Secret
+	// when the password was last set in etcd.
+	// +optional
+	PasswordSecretVersion string `json:"passwordSecretVersion,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterName`
+// +kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EtcdUser is the Schema for the etcdusers API.
+// It manages a user of the authentication of an EtcdCluster, whose password
+// is held by a Secret, and the roles granted to it. The user is deleted from
+// etcd along with the EtcdUser.
+type EtcdUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdUserSpec   `json:"spec,omitempty"`
+	Status EtcdUserStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdUserList contains a list of EtcdUser.
+type EtcdUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdUser{}, &EtcdUserList{})
+}
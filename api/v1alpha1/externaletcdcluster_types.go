@@ -0,0 +1,152 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExternalEtcdClusterSpec defines the etcd cluster, not run by the operator,
+// it looks after.
+type ExternalEtcdClusterSpec struct {
+	// Endpoints are the client URLs of the members, e.g.
+	// https://10.0.0.10:2379 for the static Pod of a kubeadm control plane
+	// node.
+	// +kubebuilder:validation:MinItems=1
+	Endpoints []string `json:"endpoints"`
+	// TLSSecretRef references the Secret, in the namespace of the
+	// ExternalEtcdCluster, holding the CA (ca.crt) and the client certificate
+	// (tls.crt and tls.key) used to reach the members, e.g. the
+	// healthcheck-client certificate of kubeadm.
+	// +optional
+	TLSSecretRef *corev1.LocalObjectReference `json:"tlsSecretRef,omitempty"`
+	// HealthCheckInterval is how often the members are checked. Defaults to
+	// 1m.
+	// +optional
+	HealthCheckInterval *metav1.Duration `json:"healthCheckInterval,omitempty"`
+	// Defrag makes the operator defragment the members whose database is
+	// fragmented, one at a time and the leader last.
+	// +optional
+	Defrag *ExternalEtcdDefrag `json:"defrag,omitempty"`
+	// Backup makes the operator take scheduled snapshots of the cluster.
+	// +optional
+	Backup *ExternalEtcdBackup `json:"backup,omitempty"`
+}
+
+// ExternalEtcdDefrag configures the defragmentation of the members of an
+// ExternalEtcdCluster.
+type ExternalEtcdDefrag struct {
+	// FragmentationThreshold is the percentage of the database of a member
+	// that must be unused for the member to be defragmented. Defaults to 50.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	FragmentationThreshold int32 `json:"fragmentationThreshold,omitempty"`
+	// MinDBSize is the size below which the database of a member isn't
+	// defragmented. Defaults to 100Mi.
+	// +optional
+	MinDBSize *resource.Quantity `json:"minDBSize,omitempty"`
+}
+
+// ExternalEtcdBackup configures the snapshots of an ExternalEtcdCluster.
+type ExternalEtcdBackup struct {
+	// Schedule is the cron schedule of the snapshots, e.g. "0 */6 * * *".
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+	// PVCName is the PersistentVolumeClaim, in the namespace of the
+	// ExternalEtcdCluster, the snapshots are saved to.
+	// +kubebuilder:validation:MinLength=1
+	PVCName string `json:"pvcName"`
+	// Version is the version of the etcd image running etcdctl. Defaults to
+	// DefaultEtcdVersion.
+	// +optional
+	Version string `json:"version,omitempty"`
+}
+
+// ExternalEtcdClusterStatus defines the observed state of ExternalEtcdCluster.
+type ExternalEtcdClusterStatus struct {
+	// Conditions describe the latest observed state of the cluster.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Members is the status of the members, as of the last health check.
+	// +optional
+	Members []ExternalEtcdMemberStatus `json:"members,omitempty"`
+
+	// LastDefragTime is when a member was last defragmented.
+	// +optional
+	LastDefragTime *metav1.Time `json:"lastDefragTime,omitempty"`
+}
+
+// ExternalEtcdMemberStatus is the status of a member of an
+// ExternalEtcdCluster.
+type ExternalEtcdMemberStatus struct {
+	// Endpoint is the client URL the member was checked on.
+	Endpoint string `json:"endpoint"`
+	// Healthy is true when the member serves requests.
+	Healthy bool `json:"healthy"`
+	// ID is the hexadecimal ID of the member.
+	// +optional
+	ID string `json:"id,omitempty"`
+	// Version is the version of etcd the member runs.
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Leader is true for the leader of the cluster.
+	// +optional
+	Leader bool `json:"leader,omitempty"`
+	// DBSize is the size of the database of the member, in bytes.
+	// +optional
+	DBSize int64 `json:"dbSize,omitempty"`
+	// DBSizeInUse is the part of the database of the member in use, in bytes.
+	// +optional
+	DBSizeInUse int64 `json:"dbSizeInUse,omitempty"`
+	// Error is why the member is unhealthy.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// ExternalEtcdCluster is the Schema for the externaletcdclusters API.
+// It reports the health of an etcd cluster the operator doesn't run, e.g. the
+// static Pods of a kubeadm control plane, and takes care of its
+// defragmentation and snapshots, without managing its members.
+type ExternalEtcdCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ExternalEtcdClusterSpec   `json:"spec,omitempty"`
+	Status ExternalEtcdClusterStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ExternalEtcdClusterList contains a list of ExternalEtcdCluster.
+type ExternalEtcdClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ExternalEtcdCluster `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ExternalEtcdCluster{}, &ExternalEtcdClusterList{})
+}
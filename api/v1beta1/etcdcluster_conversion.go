@@ -0,0 +1,99 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+var _ conversion.Convertible = &EtcdCluster{}
+
+// ConvertTo converts this EtcdCluster to the hub version, v1alpha1.
+func (src *EtcdCluster) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1alpha1.EtcdCluster)
+	if !ok {
+		return fmt.Errorf("expected a v1alpha1 EtcdCluster but got %T", dstRaw)
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = v1alpha1.EtcdClusterSpec{
+		Size:                src.Spec.Size,
+		Version:             src.Spec.Version,
+		StorageSpec:         src.Spec.Storage,
+		EphemeralStorage:    src.Spec.EphemeralStorage,
+		TLS:                 src.Spec.TLS,
+		EtcdOptions:         src.Spec.EtcdOptions,
+		Tuning:              src.Spec.Tuning,
+		Ports:               src.Spec.Ports,
+		TemplateRef:         src.Spec.TemplateRef,
+		DeletionPolicy:      src.Spec.DeletionPolicy,
+		PodTemplate:         src.Spec.PodTemplate,
+		ConnectionSecret:    src.Spec.ConnectionSecret,
+		ClientService:       src.Spec.ClientService,
+		MemberServices:      src.Spec.MemberServices,
+		GRPCProxy:           src.Spec.GRPCProxy,
+		Gateway:             src.Spec.Gateway,
+		KubeconfigSecretRef: src.Spec.KubeconfigSecretRef,
+		MemberReplacement:   src.Spec.MemberReplacement,
+		QuorumRecovery:      src.Spec.QuorumRecovery,
+		Maintenance:         src.Spec.Maintenance,
+		Monitoring:          src.Spec.Monitoring,
+		Adoption:            src.Spec.Adoption,
+		Auth:                src.Spec.Auth,
+	}
+	dst.Status = src.Status
+	return nil
+}
+
+// ConvertFrom converts the hub version, v1alpha1, to this EtcdCluster.
+func (dst *EtcdCluster) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1alpha1.EtcdCluster)
+	if !ok {
+		return fmt.Errorf("expected a v1alpha1 EtcdCluster but got %T", srcRaw)
+	}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = EtcdClusterSpec{
+		Size:                src.Spec.Size,
+		Version:             src.Spec.Version,
+		Storage:             src.Spec.StorageSpec,
+		EphemeralStorage:    src.Spec.EphemeralStorage,
+		TLS:                 src.Spec.TLS,
+		EtcdOptions:         src.Spec.EtcdOptions,
+		Tuning:              src.Spec.Tuning,
+		Ports:               src.Spec.Ports,
+		TemplateRef:         src.Spec.TemplateRef,
+		DeletionPolicy:      src.Spec.DeletionPolicy,
+		PodTemplate:         src.Spec.PodTemplate,
+		ConnectionSecret:    src.Spec.ConnectionSecret,
+		ClientService:       src.Spec.ClientService,
+		MemberServices:      src.Spec.MemberServices,
+		GRPCProxy:           src.Spec.GRPCProxy,
+		Gateway:             src.Spec.Gateway,
+		KubeconfigSecretRef: src.Spec.KubeconfigSecretRef,
+		MemberReplacement:   src.Spec.MemberReplacement,
+		QuorumRecovery:      src.Spec.QuorumRecovery,
+		Maintenance:         src.Spec.Maintenance,
+		Monitoring:          src.Spec.Monitoring,
+		Adoption:            src.Spec.Adoption,
+		Auth:                src.Spec.Auth,
+	}
+	dst.Status = src.Status
+	return nil
+}
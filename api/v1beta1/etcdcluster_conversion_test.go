@@ -0,0 +1,48 @@
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestEtcdClusterConversion(t *testing.T) {
+	hub := &v1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", Labels: map[string]string{"app": "test"}},
+		Spec: v1alpha1.EtcdClusterSpec{
+			Size:           3,
+			Version:        "v3.5.21",
+			StorageSpec:    &v1alpha1.StorageSpec{VolumeSizeRequest: resource.MustParse("2Gi")},
+			TLS:            &v1alpha1.TLSCertificate{Provider: v1alpha1.TLSProviderAuto},
+			EtcdOptions:    []string{"--log-level=debug"},
+			DeletionPolicy: v1alpha1.DeletionPolicyProtect,
+			Maintenance:    &v1alpha1.Maintenance{DefragSchedule: "0 3 * * *"},
+			Adoption:       &v1alpha1.Adoption{Endpoints: []string{"http://test-0.test:2379"}},
+			ClientService:  &v1alpha1.ClientService{Type: corev1.ServiceTypeLoadBalancer},
+		},
+		Status: v1alpha1.EtcdClusterStatus{ReadyMembers: 3, Leader: "test-0"},
+	}
+
+	ec := &EtcdCluster{}
+	assert.NoError(t, ec.ConvertFrom(hub))
+	assert.Equal(t, hub.ObjectMeta, ec.ObjectMeta)
+	assert.Equal(t, hub.Spec.StorageSpec, ec.Spec.Storage)
+	assert.Equal(t, hub.Spec.Adoption, ec.Spec.Adoption)
+	assert.Equal(t, hub.Status, ec.Status)
+
+	roundTrip := &v1alpha1.EtcdCluster{}
+	assert.NoError(t, ec.ConvertTo(roundTrip))
+	assert.Equal(t, hub, roundTrip)
+}
+
+// TestEtcdClusterSpecFields catches the fields added to the spec of one
+// version but not to the other, nor to the conversion.
+func TestEtcdClusterSpecFields(t *testing.T) {
+	assert.Equal(t, reflect.TypeOf(v1alpha1.EtcdClusterSpec{}).NumField(), reflect.TypeOf(EtcdClusterSpec{}).NumField())
+}
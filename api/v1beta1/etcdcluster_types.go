@@ -0,0 +1,164 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// EtcdClusterSpec defines the desired state of EtcdCluster. It is the one of
+// v1alpha1, with storageSpec renamed to storage.
+// +kubebuilder:validation:XValidation:rule="!has(self.etcdOptions) || !has(self.size) || self.size == 0 || self.etcdOptions.all(o, !o.matches('^--(experimental-)?max-learners[= ][0-9]+$') || int(o.find('[0-9]+$')) < self.size)",message="the learners, --max-learners in etcdOptions, must be fewer than the voting members, size"
+type EtcdClusterSpec struct {
+	// Size is the expected size of the etcd cluster. Defaults to 3 when the
+	// cluster is created without a size. etcd clusters larger than 7 members
+	// pay for the extra replication without gaining meaningful fault tolerance.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=7
+	// +optional
+	Size int `json:"size,omitempty"`
+	// Version is the expected version of the etcd container image. Defaults to
+	// DefaultEtcdVersion when not set.
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Storage is the persistent storage of the members. If not provided, then
+	// each pod just uses the temporary storage inside the container.
+	// +optional
+	Storage *v1alpha1.StorageSpec `json:"storage,omitempty"`
+	// EphemeralStorage keeps the data of the members in an emptyDir volume,
+	// lost along with their pods, e.g. for test or cache clusters. It can't be
+	// combined with storage, nor changed on an existing cluster.
+	// +optional
+	EphemeralStorage *v1alpha1.EphemeralStorage `json:"ephemeralStorage,omitempty"`
+	// TLS is the TLS certificate configuration to use for the etcd cluster and etcd operator.
+	TLS *v1alpha1.TLSCertificate `json:"tls,omitempty"`
+	// etcd configuration options are passed as command line arguments to the etcd container, refer to etcd documentation for configuration options applicable for the version of etcd being used.
+	// +kubebuilder:validation:MaxItems=64
+	// +kubebuilder:validation:items:MaxLength=1024
+	EtcdOptions []string `json:"etcdOptions,omitempty"`
+	// Tuning sets the etcd options tuning the members, checked by the
+	// operator. They must not be repeated in etcdOptions.
+	// +optional
+	Tuning *v1alpha1.EtcdTuning `json:"tuning,omitempty"`
+	// Ports configures the ports etcd listens on for client and peer traffic.
+	// +optional
+	Ports *v1alpha1.EtcdPorts `json:"ports,omitempty"`
+	// TemplateRef references the EtcdClusterTemplate providing the values of
+	// the fields that aren't set on this EtcdCluster.
+	// +optional
+	TemplateRef *v1alpha1.EtcdClusterTemplateReference `json:"templateRef,omitempty"`
+	// DeletionPolicy controls whether deleting the EtcdCluster must be
+	// confirmed with the operator.etcd.io/confirm-deletion annotation.
+	// Defaults to Delete.
+	// +optional
+	DeletionPolicy v1alpha1.DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// PodTemplate customizes the pods running the etcd members.
+	// +optional
+	PodTemplate *v1alpha1.PodTemplate `json:"podTemplate,omitempty"`
+	// ConnectionSecret makes the operator maintain a Secret holding what the
+	// applications need to connect to the cluster.
+	// +optional
+	ConnectionSecret *v1alpha1.ConnectionSecret `json:"connectionSecret,omitempty"`
+	// ClientService makes the operator maintain a Service in front of the
+	// client port of the members, e.g. to expose them outside of the
+	// Kubernetes cluster.
+	// +optional
+	ClientService *v1alpha1.ClientService `json:"clientService,omitempty"`
+	// MemberServices makes the operator maintain a Service for each member,
+	// so that the members can be reached individually, e.g. by the clients
+	// or the peers outside of the Kubernetes cluster.
+	// +optional
+	MemberServices *v1alpha1.MemberServices `json:"memberServices,omitempty"`
+	// GRPCProxy makes the operator deploy an etcd gRPC proxy in front of the
+	// members, for the clients to connect to: it serves the reads from its
+	// cache and fans the connections of the clients in.
+	// +optional
+	GRPCProxy *v1alpha1.GRPCProxy `json:"grpcProxy,omitempty"`
+	// Gateway makes the operator deploy etcd gateways in front of the
+	// members: TCP proxies reached through a single Service, for the clients
+	// that can't resolve the per-member names of the headless Service.
+	// +optional
+	Gateway *v1alpha1.Gateway `json:"gateway,omitempty"`
+	// KubeconfigSecretRef makes the operator run the members in the
+	// Kubernetes cluster of the kubeconfig held by the referenced Secret,
+	// rather than in the cluster of the EtcdCluster. It can't be added nor
+	// removed once the EtcdCluster exists.
+	// +optional
+	KubeconfigSecretRef *v1alpha1.KubeconfigSecretReference `json:"kubeconfigSecretRef,omitempty"`
+	// MemberReplacement makes the operator replace the members failing their
+	// health check for too long: it removes them from the cluster, wipes
+	// their data, and adds them back. Members are not replaced when unset.
+	// +optional
+	MemberReplacement *v1alpha1.MemberReplacement `json:"memberReplacement,omitempty"`
+	// QuorumRecovery makes the operator recover the quorum of the cluster
+	// when it is lost, once the recovery is confirmed with the
+	// operator.etcd.io/confirm-quorum-recovery annotation. It restarts the
+	// cluster from a single member holding the data of the source, and the
+	// other members join it empty. The quorum is never recovered when unset.
+	// +optional
+	QuorumRecovery *v1alpha1.QuorumRecovery `json:"quorumRecovery,omitempty"`
+	// Maintenance schedules the maintenance of the members.
+	// +optional
+	Maintenance *v1alpha1.Maintenance `json:"maintenance,omitempty"`
+	// Monitoring makes the operator create the objects of the Prometheus
+	// operator scraping the metrics of the members.
+	// +optional
+	Monitoring *v1alpha1.Monitoring `json:"monitoring,omitempty"`
+	// Adoption makes the operator take over an etcd cluster it doesn't
+	// manage yet, run by the StatefulSet named after the EtcdCluster,
+	// rather than bootstrapping a new one. It has no effect once the
+	// StatefulSet is adopted.
+	// +optional
+	Adoption *v1alpha1.Adoption `json:"adoption,omitempty"`
+	// Auth turns the authentication of etcd on, with a root user managed by
+	// the operator.
+	// +optional
+	Auth *v1alpha1.Authentication `json:"auth,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.spec.size`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyMembers`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.version`
+// +kubebuilder:printcolumn:name="Leader",type=string,JSONPath=`.status.leader`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EtcdCluster is the Schema for the etcdclusters API.
+type EtcdCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdClusterSpec            `json:"spec,omitempty"`
+	Status v1alpha1.EtcdClusterStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdClusterList contains a list of EtcdCluster.
+type EtcdClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdCluster `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdCluster{}, &EtcdClusterList{})
+}
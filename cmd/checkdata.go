@@ -0,0 +1,63 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go.etcd.io/etcd-operator/internal/datacheck"
+)
+
+// runCheckData implements `manager check-data`: the init container of the
+// members runs it, with the image of the operator, to check the integrity of
+// their data before they start. When the data is corrupted, it is written to
+// -out, the termination message the operator reports, and the command exits
+// with datacheck.ExitCorrupted; failing to check the data exits with 1. It
+// returns the exit code of the command.
+func runCheckData(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check-data", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dataDir := fs.String("data-dir", "", "The data directory of the member.")
+	out := fs.String("out", "", "The file the corruption of the data is written to, e.g. /dev/termination-log.")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: manager check-data -data-dir DIR [-out FILE]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *dataDir == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := datacheck.Check(*dataDir); err != nil {
+		fmt.Fprintln(stderr, err)
+		if !errors.As(err, new(*datacheck.CorruptedError)) {
+			return 1
+		}
+		if *out != "" {
+			_ = os.WriteFile(*out, []byte(err.Error()), 0o644)
+		}
+		return datacheck.ExitCorrupted
+	}
+	return 0
+}
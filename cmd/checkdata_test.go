@@ -0,0 +1,47 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.etcd.io/etcd-operator/internal/datacheck"
+)
+
+func TestRunCheckData(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "termination-log")
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 0, runCheckData([]string{"-data-dir", filepath.Join(dir, "data"), "-out", out}, stderr))
+	assert.Empty(t, stderr.String())
+	assert.NoFileExists(t, out)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "data", "member"), 0o700))
+	assert.Equal(t, datacheck.ExitCorrupted, runCheckData([]string{"-data-dir", filepath.Join(dir, "data"), "-out", out}, stderr))
+	assert.Contains(t, stderr.String(), "the write-ahead log is missing")
+	message, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "the write-ahead log is missing", string(message))
+
+	assert.Equal(t, 2, runCheckData([]string{"-out", out}, &bytes.Buffer{}))
+}
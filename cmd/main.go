@@ -17,26 +17,55 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"expvar"
 	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/pprof"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/yaml"
 
 	operatorv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	operatorv1beta1 "go.etcd.io/etcd-operator/api/v1beta1"
+	"go.etcd.io/etcd-operator/internal/config"
 	"go.etcd.io/etcd-operator/internal/controller"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+	"go.etcd.io/etcd-operator/internal/features"
+	"go.etcd.io/etcd-operator/internal/rbac"
+	webhookoperatorv1alpha1 "go.etcd.io/etcd-operator/internal/webhook/v1alpha1"
+	webhookoperatorv1beta1 "go.etcd.io/etcd-operator/internal/webhook/v1beta1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -49,33 +78,209 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(operatorv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(operatorv1beta1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		os.Exit(runSnapshot(os.Args[2:], os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check-data" {
+		os.Exit(runCheckData(os.Args[2:], os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "pre-stop" {
+		os.Exit(runPreStop(os.Args[2:], os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "install" {
+		os.Exit(runInstall(os.Args[2:], os.Stderr))
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
+	var leaderElectionID, leaderElectionNamespace string
+	var leaseDuration, renewDeadline, retryPeriod time.Duration
+	var gracefulShutdownTimeout time.Duration
+	var debugAddr string
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var etcdClusterConcurrency int
+	var etcdBackupConcurrency, etcdBackupScheduleConcurrency, etcdRestoreConcurrency int
+	var kubeAPIQPS float64
+	var kubeAPIBurst int
+	var watchNamespaces string
+	var clusterSelector string
+	var rateLimiter controller.RateLimiterOptions
+	var shard controller.Shard
+	var priorityQueue bool
+	var restrictedRBAC, printRestrictedRBAC bool
+	var warmStandby bool
+	var etcdStatusCacheTTL, etcdClientIdleTimeout time.Duration
+	var operatorImage string
+	var backupHostPathDirs string
+	var configFile string
 	var tlsOpts []func(*tls.Config)
+	flag.StringVar(&configFile, "config", "",
+		"The path of the configuration file of the operator. The flags passed explicitly take precedence over it.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionID, "leader-elect-id", "cc4a0f4b.etcd.io",
+		"The name of the lease of the leader election. The instances of the operator watching different namespaces "+
+			"need different names when their leases are in the same namespace.")
+	flag.StringVar(&leaderElectionNamespace, "leader-elect-namespace", "",
+		"The namespace of the lease of the leader election. Defaults to the namespace the operator runs in.")
+	flag.DurationVar(&leaseDuration, "leader-elect-lease-duration", 15*time.Second,
+		"The duration non-leader candidates wait before trying to acquire the leadership of a lease that wasn't renewed.")
+	flag.DurationVar(&renewDeadline, "leader-elect-renew-deadline", 10*time.Second,
+		"The duration the leader retries to renew its lease before giving up the leadership. "+
+			"Must be shorter than the lease duration.")
+	flag.DurationVar(&retryPeriod, "leader-elect-retry-period", 2*time.Second,
+		"The duration candidates wait between attempts to acquire or renew the leadership.")
+	flag.BoolVar(&warmStandby, "warm-standby", false,
+		"If set, the replicas waiting for the leadership keep their caches synced and their etcd connections open, "+
+			"so they resume the reconciles right after a failover.")
+	flag.DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", 30*time.Second,
+		"The duration the operator waits on shutdown for the reconciles in progress to finish.")
+	flag.StringVar(&debugAddr, "debug-bind-address", "",
+		"The address the pprof and expvar endpoints bind to, e.g. 127.0.0.1:6060. Leave empty to disable them. "+
+			"The endpoints aren't authenticated, so the address must be a loopback one.")
 	flag.BoolVar(&secureMetrics, "metrics-secure", true,
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.IntVar(&etcdClusterConcurrency, "etcdcluster-max-concurrent-reconciles", 1,
+		"The number of EtcdClusters reconciled in parallel. Increase it when managing many clusters.")
+	flag.IntVar(&etcdBackupConcurrency, "etcdbackup-max-concurrent-reconciles", 1,
+		"The number of EtcdBackups reconciled in parallel.")
+	flag.IntVar(&etcdBackupScheduleConcurrency, "etcdbackupschedule-max-concurrent-reconciles", 1,
+		"The number of EtcdBackupSchedules reconciled in parallel.")
+	flag.IntVar(&etcdRestoreConcurrency, "etcdrestore-max-concurrent-reconciles", 1,
+		"The number of EtcdRestores reconciled in parallel.")
+	flag.DurationVar(&rateLimiter.BaseDelay, "etcdcluster-requeue-base-delay", 5*time.Millisecond,
+		"The delay before retrying a failed EtcdCluster reconcile. It doubles with each consecutive failure.")
+	flag.DurationVar(&rateLimiter.MaxDelay, "etcdcluster-requeue-max-delay", 1000*time.Second,
+		"The maximum delay between two retries of a failing EtcdCluster.")
+	flag.Float64Var(&rateLimiter.QPS, "etcdcluster-requeue-qps", 10,
+		"The overall number of EtcdCluster reconcile retries per second.")
+	flag.IntVar(&rateLimiter.Burst, "etcdcluster-requeue-burst", 100,
+		"The number of EtcdCluster reconcile retries allowed above the QPS in a burst.")
+	flag.Float64Var(&kubeAPIQPS, "kube-api-qps", 20,
+		"The maximum number of requests per second of the operator to the API server.")
+	flag.IntVar(&kubeAPIBurst, "kube-api-burst", 30,
+		"The number of requests of the operator to the API server allowed above the QPS in a burst.")
+	flag.DurationVar(&etcdStatusCacheTTL, "etcd-status-cache-ttl", 5*time.Second,
+		"How long the member lists and the health of the etcd clusters are cached between reconciles. "+
+			"Set to 0 to query the members on every reconcile.")
+	flag.DurationVar(&etcdClientIdleTimeout, "etcd-client-idle-timeout", 10*time.Minute,
+		"How long a connection to an etcd cluster is kept open without being used. "+
+			"Set to 0 to only close the connections which failed.")
+	flag.StringVar(&operatorImage, "operator-image", "",
+		"The image of the operator, run by the backup and restore Jobs to encrypt and decrypt the snapshots, "+
+			"by the backup verification Jobs, by the quorum recovery Jobs replaying the write-ahead log, "+
+			"and by the data check of the members. "+
+			"Leave empty to refuse the encrypted backups and restores, to fail the verifications, "+
+			"to hold the quorum recoveries replaying the write-ahead log, "+
+			"and to skip the data checks which don't set their image.")
+	flag.StringVar(&backupHostPathDirs, "backup-host-path-dirs", "",
+		"Comma-separated list of the directories of the nodes the EtcdBackups of the HostPath provider may write "+
+			"their snapshots to and delete them from, and the EtcdRestores may read them from, subdirectories included. "+
+			"Leave empty to refuse the HostPath backups and restores, which otherwise reach the nodes as root.")
+	flag.BoolVar(&priorityQueue, "etcdcluster-priority-queue", true,
+		"If set, Degraded EtcdClusters are reconciled before the others.")
+	flag.IntVar(&shard.Count, "shard-count", 1,
+		"The number of operator instances splitting the EtcdClusters between them.")
+	flag.IntVar(&shard.Index, "shard-index", 0,
+		"The index of the shard of this instance, from 0 to --shard-count minus one.")
+	flag.StringVar(&clusterSelector, "cluster-selector", "",
+		"A label selector, e.g. tier=canary, restricting the EtcdClusters managed by this instance to the ones "+
+			"it matches. Leave empty to manage all the EtcdClusters.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", os.Getenv("WATCH_NAMESPACES"),
+		"Comma-separated list of namespaces the operator watches. Leave empty to watch all the namespaces. "+
+			"Defaults to the WATCH_NAMESPACES environment variable.")
+	flag.BoolVar(&restrictedRBAC, "restricted-rbac", false,
+		"If set, the operator doesn't list nor watch cluster-scoped resources, so that it can run with "+
+			"permissions limited to the namespaces of --watch-namespaces.")
+	flag.BoolVar(&printRestrictedRBAC, "print-restricted-rbac", false,
+		"Print the RBAC resources of --restricted-rbac for the namespaces of --watch-namespaces, and exit.")
+	flag.Func("feature-gates",
+		"Comma-separated list of key=value pairs enabling or disabling experimental features. Options are:\n"+
+			strings.Join(features.DefaultMutableFeatureGate.KnownFeatures(), "\n"),
+		features.DefaultMutableFeatureGate.Set)
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	var cfg *config.OperatorConfiguration
+	var configErr error
+	if configFile != "" {
+		if cfg, configErr = config.Load(configFile); configErr == nil {
+			configErr = cfg.ApplyToFlags(flag.CommandLine)
+		}
+	}
+
+	// The log level can be changed at runtime by the configuration file.
+	logLevel, ok := opts.Level.(uberzap.AtomicLevel)
+	if !ok {
+		logLevel = uberzap.NewAtomicLevelAt(zapcore.DebugLevel)
+		opts.Level = logLevel
+	}
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	if configErr != nil {
+		setupLog.Error(configErr, "unable to load the configuration file", "path", configFile)
+		os.Exit(1)
+	}
+
+	namespaces, err := splitNamespaces(watchNamespaces)
+	if err != nil {
+		setupLog.Error(err, "invalid --watch-namespaces")
+		os.Exit(1)
+	}
+	hostPathDirs, err := splitHostPathDirs(backupHostPathDirs)
+	if err != nil {
+		setupLog.Error(err, "invalid --backup-host-path-dirs")
+		os.Exit(1)
+	}
+	if err := checkDebugAddr(debugAddr); err != nil {
+		setupLog.Error(err, "invalid --debug-bind-address")
+		os.Exit(1)
+	}
+	if (restrictedRBAC || printRestrictedRBAC) && len(namespaces) == 0 {
+		setupLog.Error(nil, "the restricted RBAC mode requires --watch-namespaces")
+		os.Exit(1)
+	}
+	if printRestrictedRBAC {
+		if err := printRBAC(os.Stdout, namespaces); err != nil {
+			setupLog.Error(err, "unable to print the RBAC resources")
+			os.Exit(1)
+		}
+		return
+	}
+
+	if shard.Count < 1 || shard.Index < 0 || shard.Index >= shard.Count {
+		setupLog.Error(nil, "invalid shard, --shard-index must be between 0 and --shard-count minus one",
+			"shardCount", shard.Count, "shardIndex", shard.Index)
+		os.Exit(1)
+	}
+	if clusterSelector != "" {
+		if shard.Selector, err = labels.Parse(clusterSelector); err != nil {
+			setupLog.Error(err, "invalid --cluster-selector")
+			os.Exit(1)
+		}
+	}
+	// Each shard elects its own leader.
+	if shard.Count > 1 {
+		leaderElectionID = fmt.Sprintf("%s-shard-%d", leaderElectionID, shard.Index)
+	}
 
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
@@ -118,47 +323,219 @@ func main() {
 		// this setup is not recommended for production.
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		Metrics:                metricsServerOptions,
-		WebhookServer:          webhookServer,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "cc4a0f4b.etcd.io",
+	restConfig := ctrl.GetConfigOrDie()
+	restConfig.QPS = float32(kubeAPIQPS)
+	restConfig.Burst = kubeAPIBurst
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		Scheme:                  scheme,
+		Cache:                   cacheOptions(namespaces),
+		Client:                  clientOptions(restrictedRBAC),
+		NewClient:               controller.NewClient,
+		Metrics:                 metricsServerOptions,
+		WebhookServer:           webhookServer,
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        leaderElectionID,
+		LeaderElectionNamespace: leaderElectionNamespace,
+		LeaseDuration:           &leaseDuration,
+		RenewDeadline:           &renewDeadline,
+		RetryPeriod:             &retryPeriod,
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
 		// speeds up voluntary leader transitions as the new leader don't have to wait
 		// LeaseDuration time first.
 		//
-		// In the default scaffold provided, the program ends immediately after
-		// the manager stops, so would be fine to enable this option. However,
-		// if you are doing or is intended to do any operation such as perform cleanups
-		// after the manager stops then its usage might be unsafe.
-		// LeaderElectionReleaseOnCancel: true,
+		// The program ends immediately after the manager stops, once the reconciles
+		// in progress are done, so the next leader picks up right where this one
+		// stopped.
+		LeaderElectionReleaseOnCancel: true,
+		GracefulShutdownTimeout:       &gracefulShutdownTimeout,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	etcdClients := etcdutils.NewClientPool()
+	etcdClients.StatusTTL = etcdStatusCacheTTL
+	etcdClients.IdleTimeout = etcdClientIdleTimeout
+	if err := mgr.Add(etcdClients); err != nil {
+		setupLog.Error(err, "unable to set up the etcd client pool")
+		os.Exit(1)
+	}
 	if err = (&controller.EtcdClusterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		EtcdClients:             etcdClients,
+		MaxConcurrentReconciles: etcdClusterConcurrency,
+		RateLimiter:             rateLimiter,
+		Shard:                   shard,
+		PriorityQueue:           priorityQueue,
+		RestrictedRBAC:          restrictedRBAC,
+		APIReader:               mgr.GetAPIReader(),
+		OperatorImage:           operatorImage,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "EtcdCluster")
 		os.Exit(1)
 	}
+	if features.Enabled(features.ExternalEtcdClusters) {
+		if err = (&controller.ExternalEtcdClusterReconciler{
+			Client:      mgr.GetClient(),
+			Scheme:      mgr.GetScheme(),
+			EtcdClients: etcdClients,
+			Shard:       shard,
+			APIReader:   mgr.GetAPIReader(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ExternalEtcdCluster")
+			os.Exit(1)
+		}
+	}
+	if features.Enabled(features.EtcdBackups) {
+		if err = (&controller.EtcdBackupReconciler{
+			Client:                  mgr.GetClient(),
+			Scheme:                  mgr.GetScheme(),
+			MaxConcurrentReconciles: etcdBackupConcurrency,
+			EtcdClients:             etcdClients,
+			Shard:                   shard,
+			OperatorImage:           operatorImage,
+			HostPathDirs:            hostPathDirs,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "EtcdBackup")
+			os.Exit(1)
+		}
+		if err = (&controller.EtcdRestoreReconciler{
+			Client:                  mgr.GetClient(),
+			Scheme:                  mgr.GetScheme(),
+			MaxConcurrentReconciles: etcdRestoreConcurrency,
+			OperatorImage:           operatorImage,
+			HostPathDirs:            hostPathDirs,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "EtcdRestore")
+			os.Exit(1)
+		}
+	}
+	if features.Enabled(features.ContinuousBackup) {
+		if err = (&controller.EtcdBackupScheduleReconciler{
+			Client:                  mgr.GetClient(),
+			Scheme:                  mgr.GetScheme(),
+			MaxConcurrentReconciles: etcdBackupScheduleConcurrency,
+			HostPathDirs:            hostPathDirs,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "EtcdBackupSchedule")
+			os.Exit(1)
+		}
+	}
+	if features.Enabled(features.EtcdAuth) {
+		if err = (&controller.EtcdRoleReconciler{
+			Client:      mgr.GetClient(),
+			Scheme:      mgr.GetScheme(),
+			EtcdClients: etcdClients,
+			Shard:       shard,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "EtcdRole")
+			os.Exit(1)
+		}
+		if err = (&controller.EtcdUserReconciler{
+			Client:      mgr.GetClient(),
+			Scheme:      mgr.GetScheme(),
+			EtcdClients: etcdClients,
+			Shard:       shard,
+			APIReader:   mgr.GetAPIReader(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "EtcdUser")
+			os.Exit(1)
+		}
+	}
+	if features.Enabled(features.EtcdMirrors) {
+		if err = (&controller.EtcdMirrorReconciler{
+			Client:    mgr.GetClient(),
+			Scheme:    mgr.GetScheme(),
+			Shard:     shard,
+			APIReader: mgr.GetAPIReader(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "EtcdMirror")
+			os.Exit(1)
+		}
+	}
+	if warmStandby {
+		if err := mgr.Add(&controller.StandbyWarmer{
+			Cache:          mgr.GetCache(),
+			EtcdClients:    etcdClients,
+			Shard:          shard,
+			RestrictedRBAC: restrictedRBAC,
+			Interval:       30 * time.Second,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up the warm standby")
+			os.Exit(1)
+		}
+	}
+	// defaultTemplate holds the name of the template set on new EtcdClusters,
+	// which can be changed at runtime by the configuration file.
+	var defaultTemplate atomicString
+	if cfg != nil {
+		defaultTemplate.Store(cfg.DefaultTemplate)
+		reloader := &config.Reloader{
+			Path:     configFile,
+			Interval: 10 * time.Second,
+			OnChange: func(cfg *config.OperatorConfiguration) {
+				if err := setLogLevel(logLevel, cfg.LogLevel); err != nil {
+					setupLog.Error(err, "ignoring the invalid log level", "logLevel", cfg.LogLevel)
+				}
+				defaultTemplate.Store(cfg.DefaultTemplate)
+			},
+		}
+		if err := mgr.Add(reloader); err != nil {
+			setupLog.Error(err, "unable to set up the configuration reloader")
+			os.Exit(1)
+		}
+	}
+
+	// nolint:goconst
+	enableWebhooks := os.Getenv("ENABLE_WEBHOOKS") != "false"
+	if enableWebhooks {
+		if err = webhookoperatorv1alpha1.SetupEtcdClusterWebhookWithManager(mgr, defaultTemplate.Load); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "EtcdCluster")
+			os.Exit(1)
+		}
+		if err = webhookoperatorv1beta1.SetupEtcdClusterWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "EtcdCluster", "version", "v1beta1")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
+	// A wedged client pool blocks every reconcile, restart the operator.
+	if err := mgr.AddHealthzCheck("etcd-client-pool", etcdClients.Check); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
 	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("informers", cacheSyncedCheck(mgr.GetCache())); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		// The webhook server is started once its certificate is loaded.
+		if err := mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+			setupLog.Error(err, "unable to set up ready check")
+			os.Exit(1)
+		}
+	}
+
+	if debugAddr != "" {
+		if err := mgr.Add(newDebugServer(debugAddr)); err != nil {
+			setupLog.Error(err, "unable to set up debug server")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -166,3 +543,155 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitNamespaces returns the namespaces of the comma-separated list
+// watchNamespaces, or an error when one of them isn't a valid namespace name.
+func splitNamespaces(watchNamespaces string) ([]string, error) {
+	var namespaces []string
+	for _, ns := range strings.Split(watchNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns == "" {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace %q: %s", ns, strings.Join(errs, ", "))
+		}
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces, nil
+}
+
+// splitHostPathDirs returns the directories of the comma-separated list
+// hostPathDirs, cleaned, or an error when one of them isn't absolute.
+func splitHostPathDirs(hostPathDirs string) ([]string, error) {
+	var dirs []string
+	for _, dir := range strings.Split(hostPathDirs, ",") {
+		if dir = strings.TrimSpace(dir); dir == "" {
+			continue
+		}
+		if !path.IsAbs(dir) {
+			return nil, fmt.Errorf("invalid directory %q: must be an absolute path", dir)
+		}
+		dirs = append(dirs, path.Clean(dir))
+	}
+	return dirs, nil
+}
+
+// checkDebugAddr returns an error when addr, the address of the debug
+// server, if any, isn't a loopback one: its endpoints aren't authenticated.
+func checkDebugAddr(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("invalid address %q: the host must be localhost or a loopback IP", addr)
+	}
+	return nil
+}
+
+// cacheOptions restricts the cache of the manager to the child resources of
+// the operator, in the given namespaces. Cluster-scoped objects are always
+// watched.
+func cacheOptions(namespaces []string) cache.Options {
+	opts := cache.Options{ByObject: controller.CacheByObject()}
+	for _, ns := range namespaces {
+		if opts.DefaultNamespaces == nil {
+			opts.DefaultNamespaces = map[string]cache.Config{}
+		}
+		opts.DefaultNamespaces[ns] = cache.Config{}
+	}
+	return opts
+}
+
+// clientOptions makes the client of the manager read the cluster-scoped
+// objects directly from the API server in the restricted RBAC mode.
+func clientOptions(restrictedRBAC bool) client.Options {
+	if !restrictedRBAC {
+		return client.Options{}
+	}
+	return client.Options{Cache: &client.CacheOptions{DisableFor: controller.RestrictedRBACUncachedObjects()}}
+}
+
+// printRBAC writes the RBAC resources of the restricted mode for namespaces
+// to w, bound to the service account of the default deployment.
+func printRBAC(w io.Writer, namespaces []string) error {
+	objs := rbac.RestrictedObjects("etcd-operator-restricted", "etcd-operator-controller-manager", "etcd-operator-system", namespaces)
+	for _, obj := range objs {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheSyncedCheck reports an error until the informers of the cache are
+// synced.
+func cacheSyncedCheck(c cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), time.Second)
+		defer cancel()
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("informers not synced")
+		}
+		return nil
+	}
+}
+
+// newDebugServer returns a server exposing the pprof profiles and the expvar
+// variables of the operator on addr.
+func newDebugServer(addr string) *manager.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return &manager.Server{
+		Name: "debug",
+		Server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// setLogLevel sets level to text, a level name or an integer greater than 0
+// for more verbose levels, like the --zap-log-level flag. An empty text keeps
+// the current level.
+func setLogLevel(level uberzap.AtomicLevel, text string) error {
+	if text == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(text); err == nil {
+		if n <= 0 {
+			return fmt.Errorf("invalid log level %q", text)
+		}
+		level.SetLevel(zapcore.Level(-n))
+		return nil
+	}
+	return level.UnmarshalText([]byte(text))
+}
+
+// atomicString is a string safe for concurrent use.
+type atomicString struct {
+	v atomic.Value
+}
+
+func (s *atomicString) Load() string {
+	v, _ := s.v.Load().(string)
+	return v
+}
+
+func (s *atomicString) Store(v string) {
+	s.v.Store(v)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+func TestSplitNamespaces(t *testing.T) {
+	namespaces, err := splitNamespaces(" team-a,,team-b ,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "team-b"}, namespaces)
+	assert.Equal(t, map[string]cache.Config{"team-a": {}, "team-b": {}}, cacheOptions(namespaces).DefaultNamespaces)
+
+	namespaces, err = splitNamespaces("")
+	assert.NoError(t, err)
+	assert.Empty(t, namespaces)
+	assert.Nil(t, cacheOptions(namespaces).DefaultNamespaces)
+
+	_, err = splitNamespaces("team-a,Team_B")
+	assert.ErrorContains(t, err, `invalid namespace "Team_B"`)
+}
+
+func TestSplitHostPathDirs(t *testing.T) {
+	dirs, err := splitHostPathDirs(" /var/backups/,,/mnt/etcd/../snapshots ,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/var/backups", "/mnt/snapshots"}, dirs)
+
+	dirs, err = splitHostPathDirs("")
+	assert.NoError(t, err)
+	assert.Empty(t, dirs)
+
+	_, err = splitHostPathDirs("/var/backups,backups")
+	assert.ErrorContains(t, err, `invalid directory "backups"`)
+}
+
+func TestCheckDebugAddr(t *testing.T) {
+	for _, addr := range []string{"", "127.0.0.1:6060", "localhost:6060", "[::1]:6060"} {
+		assert.NoError(t, checkDebugAddr(addr), addr)
+	}
+
+	for _, addr := range []string{":6060", "0.0.0.0:6060", "[::]:6060", "10.0.0.1:6060", "example.com:6060"} {
+		assert.ErrorContains(t, checkDebugAddr(addr), "the host must be localhost or a loopback IP", addr)
+	}
+	assert.ErrorContains(t, checkDebugAddr("127.0.0.1"), `invalid address "127.0.0.1"`)
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	"go.uber.org/zap"
+
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+	"go.etcd.io/etcd-operator/internal/prestop"
+)
+
+// runPreStop implements `manager pre-stop`, the preStop hook of the etcd
+// container: it moves the leadership off the member, and waits for the other
+// members to be a healthy quorum, see prestop.Run. The member authenticates
+// with the ETCDCTL_USER and ETCDCTL_PASSWORD variables, and its TLS files
+// default to the ETCDCTL_CACERT, ETCDCTL_CERT and ETCDCTL_KEY ones, as for
+// etcdctl. It returns the exit code of the command.
+func runPreStop(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("pre-stop", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	endpoint := fs.String("endpoint", "", "The client URL of the member.")
+	timeout := fs.Duration("timeout", 30*time.Second, "How long to wait for the other members to be a healthy quorum.")
+	cacert := fs.String("cacert", os.Getenv("ETCDCTL_CACERT"), "The CA certificate of the members, when they serve TLS.")
+	cert := fs.String("cert", os.Getenv("ETCDCTL_CERT"), "The client certificate, when the members serve TLS.")
+	key := fs.String("key", os.Getenv("ETCDCTL_KEY"), "The key of the client certificate.")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: manager pre-stop -endpoint URL [-timeout DURATION] [-cacert FILE -cert FILE -key FILE]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *endpoint == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var tlsConfig *tls.Config
+	if *cacert != "" {
+		var err error
+		tlsInfo := transport.TLSInfo{TrustedCAFile: *cacert, CertFile: *cert, KeyFile: *key}
+		if tlsConfig, err = tlsInfo.ClientConfig(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	var creds *etcdutils.Credentials
+	if user := os.Getenv("ETCDCTL_USER"); user != "" {
+		creds = &etcdutils.Credentials{Username: user, Password: os.Getenv("ETCDCTL_PASSWORD")}
+	}
+	lg, err := zap.NewProduction()
+	if err != nil {
+		lg = zap.NewNop()
+	}
+	defer func() { _ = lg.Sync() }()
+
+	pool := etcdutils.NewClientPool()
+	defer pool.CloseAll()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := prestop.Run(ctx, lg, pool.Cluster("member", tlsConfig, creds), *endpoint); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runInstall implements `manager install`, copying the manager binary to the
+// given file: an init container of the members runs it, with the image of
+// the operator, for the etcd container to run its preStop hook from the
+// image of etcd.
+func runInstall(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	to := fs.String("to", "", "The file the manager binary is copied to.")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: manager install -to FILE")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *to == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := installBinary(*to); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// installBinary copies the running executable to the file to.
+func installBinary(to string) (err error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(exe)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPreStop(t *testing.T) {
+	assert.Equal(t, 2, runPreStop(nil, &bytes.Buffer{}))
+	assert.Equal(t, 1, runPreStop([]string{"-endpoint", "https://127.0.0.1:2379", "-cacert", filepath.Join(t.TempDir(), "ca.crt")}, &bytes.Buffer{}))
+
+	start := time.Now()
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 1, runPreStop([]string{"-endpoint", "http://127.0.0.1:1", "-timeout", "100ms"}, stderr))
+	assert.Contains(t, stderr.String(), "the other members aren't a healthy quorum")
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestRunInstall(t *testing.T) {
+	to := filepath.Join(t.TempDir(), "operator", "manager")
+	assert.Equal(t, 0, runInstall([]string{"-to", to}, &bytes.Buffer{}))
+	info, err := os.Stat(to)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	assert.Positive(t, info.Size())
+
+	assert.Equal(t, 2, runInstall(nil, &bytes.Buffer{}))
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.etcd.io/etcd-operator/internal/snapshotcrypt"
+	"go.etcd.io/etcd-operator/internal/snapshotstatus"
+	"go.etcd.io/etcd-operator/internal/walreplay"
+)
+
+// runSnapshot implements `manager snapshot encrypt|decrypt|status|replay`:
+// the backup and restore Jobs run it, with the image of the operator, to
+// encrypt the snapshots before their upload and to decrypt them before their
+// restore, the backup verification Jobs to report their status, and the
+// quorum recovery Jobs to replay the write-ahead log of a member over them.
+// It returns the exit code of the command.
+func runSnapshot(args []string, stderr io.Writer) int {
+	usage := func() {
+		fmt.Fprintln(stderr, "Usage: manager snapshot encrypt|decrypt -key-file FILE -in FILE -out FILE")
+		fmt.Fprintln(stderr, "       manager snapshot status -in FILE -out FILE")
+		fmt.Fprintln(stderr, "       manager snapshot replay -in FILE -source DIR -data-dir DIR -name NAME -peer-urls URLS")
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	switch args[0] {
+	case "encrypt", "decrypt":
+	case "status":
+		return runSnapshotStatus(args[1:], stderr, usage)
+	case "replay":
+		return runSnapshotReplay(args[1:], stderr, usage)
+	default:
+		usage()
+		return 2
+	}
+	fs := flag.NewFlagSet("snapshot "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	keyFile := fs.String("key-file", "", "The file holding the 32 bytes key.")
+	in := fs.String("in", "", "The snapshot to "+args[0]+".")
+	out := fs.String("out", "", "The file the "+args[0]+"ed snapshot is written to.")
+	fs.Usage = func() {
+		usage()
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *keyFile == "" || *in == "" || *out == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := cryptSnapshot(args[0] == "encrypt", *keyFile, *in, *out); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// cryptSnapshot encrypts, or decrypts, the snapshot at in to out with the key
+// of keyFile. out is removed when it fails.
+func cryptSnapshot(encrypt bool, keyFile, in, out string) (err error) {
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(out)
+		}
+	}()
+
+	if encrypt {
+		return snapshotcrypt.Encrypt(dst, src, key)
+	}
+	return snapshotcrypt.Decrypt(dst, src, key)
+}
+
+// runSnapshotStatus implements `manager snapshot status`, writing the status
+// of a snapshot as JSON, like `etcdutl snapshot status -w json`.
+func runSnapshotStatus(args []string, stderr io.Writer, usage func()) int {
+	fs := flag.NewFlagSet("snapshot status", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	in := fs.String("in", "", "The snapshot to read the status of.")
+	out := fs.String("out", "", "The file the status is written to, e.g. /dev/termination-log.")
+	fs.Usage = func() {
+		usage()
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *in == "" || *out == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	st, err := snapshotstatus.Read(*in)
+	if err == nil {
+		var data []byte
+		data, err = json.Marshal(st)
+		if err == nil {
+			err = os.WriteFile(*out, data, 0o644)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runSnapshotReplay implements `manager snapshot replay`, restoring a
+// snapshot along with the write-ahead log of a member, see walreplay.Replay.
+func runSnapshotReplay(args []string, stderr io.Writer, usage func()) int {
+	fs := flag.NewFlagSet("snapshot replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	in := fs.String("in", "", "The snapshot to restore.")
+	source := fs.String("source", "", "The member directory holding the write-ahead log to replay.")
+	dataDir := fs.String("data-dir", "", "The data directory the snapshot is restored to.")
+	name := fs.String("name", "", "The name of the restored member.")
+	peerURLs := fs.String("peer-urls", "", "The comma-separated peer URLs of the restored member.")
+	fs.Usage = func() {
+		usage()
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *in == "" || *source == "" || *dataDir == "" || *name == "" || *peerURLs == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	err := walreplay.Replay(walreplay.Options{
+		Snapshot: *in,
+		Source:   *source,
+		DataDir:  *dataDir,
+		Name:     *name,
+		PeerURLs: strings.Split(*peerURLs, ","),
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) string { return filepath.Join(dir, name) }
+	assert.NoError(t, os.WriteFile(file("key"), bytes.Repeat([]byte{1}, 32), 0o600))
+	assert.NoError(t, os.WriteFile(file("other-key"), bytes.Repeat([]byte{2}, 32), 0o600))
+	assert.NoError(t, os.WriteFile(file("snapshot.db"), []byte("etcd snapshot"), 0o600))
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 0, runSnapshot([]string{"encrypt", "-key-file", file("key"), "-in", file("snapshot.db"), "-out", file("snapshot.db.enc")}, stderr))
+	encrypted, err := os.ReadFile(file("snapshot.db.enc"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(encrypted), "etcd snapshot")
+
+	assert.Equal(t, 0, runSnapshot([]string{"decrypt", "-key-file", file("key"), "-in", file("snapshot.db.enc"), "-out", file("restored.db")}, stderr))
+	restored, err := os.ReadFile(file("restored.db"))
+	assert.NoError(t, err)
+	assert.Equal(t, "etcd snapshot", string(restored))
+	assert.Empty(t, stderr.String())
+
+	assert.Equal(t, 1, runSnapshot([]string{"decrypt", "-key-file", file("other-key"), "-in", file("snapshot.db.enc"), "-out", file("wrong.db")}, stderr))
+	assert.Contains(t, stderr.String(), "failed to decrypt the snapshot")
+	assert.NoFileExists(t, file("wrong.db"))
+
+	assert.Equal(t, 1, runSnapshot([]string{"status", "-in", file("snapshot.db"), "-out", file("status.json")}, stderr))
+	assert.NoFileExists(t, file("status.json"))
+	assert.Equal(t, 2, runSnapshot([]string{"status", "-in", file("snapshot.db")}, &bytes.Buffer{}))
+
+	assert.Equal(t, 1, runSnapshot([]string{"replay", "-in", file("snapshot.db"), "-source", file("member"), "-data-dir", file("data"),
+		"-name", "my-etcd-0", "-peer-urls", "http://my-etcd-0:2380"}, stderr))
+	assert.Equal(t, 2, runSnapshot([]string{"replay", "-in", file("snapshot.db")}, &bytes.Buffer{}))
+
+	assert.Equal(t, 2, runSnapshot([]string{"compress"}, &bytes.Buffer{}))
+	assert.Equal(t, 2, runSnapshot([]string{"encrypt", "-in", file("snapshot.db")}, &bytes.Buffer{}))
+}
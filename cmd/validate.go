@@ -0,0 +1,242 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/yaml"
+
+	operatorv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	operatorv1beta1 "go.etcd.io/etcd-operator/api/v1beta1"
+	webhookoperatorv1alpha1 "go.etcd.io/etcd-operator/internal/webhook/v1alpha1"
+)
+
+// runValidate implements `manager validate`: it runs the defaulting and the
+// validation of the admission webhooks on the EtcdClusters of manifests,
+// without a Kubernetes cluster, and prints them as the operator resolves
+// them. The EtcdClusterTemplates, EtcdClusterOverrides, EtcdOperatorPolicies
+// and Namespaces of the manifests are taken into account. It returns the exit
+// code of the command.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var files []string
+	fs.Func("f", "A manifest to validate, or - for the standard input. Can be repeated.", func(s string) error {
+		files = append(files, s)
+		return nil
+	})
+	output := fs.String("o", "yaml", "The format the resolved EtcdClusters are printed in: yaml, json or none.")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: manager validate -f FILE [-f FILE]... [-o yaml|json|none]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(files) == 0 || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if *output != "yaml" && *output != "json" && *output != "none" {
+		fmt.Fprintf(stderr, "unknown output format %q\n", *output)
+		return 2
+	}
+
+	var objs []client.Object
+	for _, file := range files {
+		fileObjs, err := readManifests(file)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", file, err)
+			return 1
+		}
+		objs = append(objs, fileObjs...)
+	}
+
+	valid, err := validateManifests(context.Background(), objs, *output, stdout, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if !valid {
+		return 1
+	}
+	return 0
+}
+
+// readManifests returns the objects of the operator, and the Namespaces, of
+// the YAML or JSON documents of file. The other objects are skipped.
+func readManifests(file string) ([]client.Object, error) {
+	var in io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(in))
+	var objs []client.Object
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return objs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		typeMeta := metav1.TypeMeta{}
+		if err := yaml.Unmarshal(doc, &typeMeta); err != nil {
+			return nil, err
+		}
+		if typeMeta.Kind == "" {
+			continue
+		}
+		if typeMeta.GroupVersionKind().Group != operatorv1alpha1.GroupVersion.Group && typeMeta.GroupVersionKind() != corev1.SchemeGroupVersion.WithKind("Namespace") {
+			continue
+		}
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if o, ok := obj.(client.Object); ok {
+			objs = append(objs, o)
+		}
+	}
+}
+
+// validateManifests defaults and validates the EtcdClusters of objs, the way
+// the webhooks do on their creation, against the other objects of objs. It
+// prints the resolved EtcdClusters to stdout in the given format, and the
+// violations and warnings to stderr. It reports whether all the EtcdClusters
+// are valid.
+func validateManifests(ctx context.Context, objs []client.Object, output string, stdout, stderr io.Writer) (bool, error) {
+	var clusters []*operatorv1alpha1.EtcdCluster
+	var others []client.Object
+	namespaces := map[string]bool{}
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *operatorv1alpha1.EtcdCluster:
+			if o.Namespace == "" {
+				o.Namespace = metav1.NamespaceDefault
+			}
+			clusters = append(clusters, o)
+		case *operatorv1beta1.EtcdCluster:
+			// The webhooks validate the hub version, v1alpha1.
+			ec := &operatorv1alpha1.EtcdCluster{}
+			if err := o.ConvertTo(ec); err != nil {
+				return false, err
+			}
+			if ec.Namespace == "" {
+				ec.Namespace = metav1.NamespaceDefault
+			}
+			clusters = append(clusters, ec)
+		case *corev1.Namespace:
+			namespaces[o.Name] = true
+			others = append(others, o)
+		default:
+			if obj.GetNamespace() == "" && obj.GetObjectKind().GroupVersionKind().Kind == "EtcdClusterOverride" {
+				obj.SetNamespace(metav1.NamespaceDefault)
+			}
+			others = append(others, obj)
+		}
+	}
+	// The EtcdOperatorPolicies select the namespaces of the clusters by
+	// their labels, the namespaces not in the manifests have none.
+	for _, ec := range clusters {
+		if !namespaces[ec.Namespace] {
+			namespaces[ec.Namespace] = true
+			others = append(others, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ec.Namespace}})
+		}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(others...).Build()
+	defaulter := &webhookoperatorv1alpha1.EtcdClusterCustomDefaulter{}
+	validator := &webhookoperatorv1alpha1.EtcdClusterCustomValidator{Client: c}
+	createCtx := admission.NewContextWithRequest(ctx, admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create},
+	})
+
+	valid := true
+	printed := 0
+	for _, ec := range clusters {
+		name := ec.Namespace + "/" + ec.Name
+		if err := defaulter.Default(createCtx, ec); err != nil {
+			return false, fmt.Errorf("%s: %w", name, err)
+		}
+		warnings, err := validator.ValidateCreate(createCtx, ec)
+		for _, w := range warnings {
+			fmt.Fprintf(stderr, "%s: warning: %s\n", name, w)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", name, err)
+			valid = false
+			continue
+		}
+
+		resolved, err := validator.Resolve(ctx, ec)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", name, err)
+		}
+		resolved.SetGroupVersionKind(operatorv1alpha1.GroupVersion.WithKind("EtcdCluster"))
+		if err := printResolved(stdout, resolved, output, printed > 0); err != nil {
+			return false, err
+		}
+		printed++
+	}
+	return valid, nil
+}
+
+func printResolved(w io.Writer, ec *operatorv1alpha1.EtcdCluster, output string, separate bool) error {
+	var data []byte
+	var err error
+	switch output {
+	case "none":
+		return nil
+	case "json":
+		data, err = json.MarshalIndent(ec, "", "  ")
+		data = append(data, '\n')
+	default:
+		data, err = yaml.Marshal(ec)
+		if separate {
+			data = append([]byte("---\n"), data...)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
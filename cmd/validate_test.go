@@ -0,0 +1,144 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const validateManifest = `apiVersion: operator.etcd.io/v1alpha1
+kind: EtcdClusterTemplate
+metadata:
+  name: small
+spec:
+  version: v3.5.17
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+---
+apiVersion: operator.etcd.io/v1alpha1
+kind: EtcdCluster
+metadata:
+  name: templated
+spec:
+  templateRef:
+    name: small
+`
+
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestRunValidate(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		manifest       string
+		expectedCode   int
+		expectedStdout []string
+		expectedStderr string
+	}{
+		{
+			name:           "resolves the template and the defaults",
+			manifest:       validateManifest,
+			expectedStdout: []string{"namespace: default", "size: 3", "version: v3.5.17", "peer: 2380"},
+		},
+		{
+			name: "reports the violations",
+			manifest: validateManifest + `---
+apiVersion: operator.etcd.io/v1alpha1
+kind: EtcdCluster
+metadata:
+  name: too-large
+  namespace: prod
+spec:
+  size: 9
+`,
+			expectedCode:   1,
+			expectedStdout: []string{"name: templated"},
+			expectedStderr: "prod/too-large: ",
+		},
+		{
+			name: "reports the warnings",
+			manifest: `apiVersion: operator.etcd.io/v1alpha1
+kind: EtcdCluster
+metadata:
+  name: deprecated
+spec:
+  version: v3.5.21
+  etcdOptions: ["--enable-v2=true"]
+`,
+			expectedStderr: "default/deprecated: warning: ",
+		},
+		{
+			name: "converts the v1beta1 clusters",
+			manifest: `apiVersion: operator.etcd.io/v1beta1
+kind: EtcdCluster
+metadata:
+  name: beta
+spec:
+  version: v3.5.21
+  storage:
+    volumeSizeRequest: 2Gi
+`,
+			expectedStdout: []string{"apiVersion: operator.etcd.io/v1alpha1", "name: beta", "storageSpec:", "volumeSizeRequest: 2Gi"},
+		},
+		{
+			name: "prints JSON",
+			args: []string{"-o", "json"},
+			manifest: `{"apiVersion": "operator.etcd.io/v1alpha1", "kind": "EtcdCluster", "metadata": {"name": "json"}}
+`,
+			expectedStdout: []string{`"kind": "EtcdCluster"`, `"size": 3`},
+		},
+		{
+			name:         "rejects unknown formats",
+			args:         []string{"-o", "xml"},
+			manifest:     validateManifest,
+			expectedCode: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-f", writeManifest(t, tt.manifest)}, tt.args...)
+			code := runValidate(args, &stdout, &stderr)
+			assert.Equal(t, tt.expectedCode, code, stderr.String())
+			for _, s := range tt.expectedStdout {
+				assert.Contains(t, stdout.String(), s)
+			}
+			if tt.expectedStderr != "" {
+				assert.Contains(t, stderr.String(), tt.expectedStderr)
+			}
+		})
+	}
+}
+
+func TestRunValidateRequiresFiles(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, runValidate(nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: manager validate")
+}
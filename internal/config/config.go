@@ -0,0 +1,204 @@
+// Package config loads the configuration file of the operator, an
+// alternative to its command line flags.
+package config
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the apiVersion of the configuration file.
+	APIVersion = "operator.etcd.io/v1alpha1"
+	// Kind is the kind of the configuration file.
+	Kind = "OperatorConfiguration"
+)
+
+// OperatorConfiguration is the content of the configuration file of the
+// operator. Each field tagged with a flag sets the default value of that
+// command line flag: flags passed explicitly take precedence over the file.
+// Only the fields documented as such are reloaded while the operator runs.
+type OperatorConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	MetricsBindAddress     *string `json:"metricsBindAddress,omitempty" flag:"metrics-bind-address"`
+	MetricsSecure          *bool   `json:"metricsSecure,omitempty" flag:"metrics-secure"`
+	EnableHTTP2            *bool   `json:"enableHTTP2,omitempty" flag:"enable-http2"`
+	HealthProbeBindAddress *string `json:"healthProbeBindAddress,omitempty" flag:"health-probe-bind-address"`
+	DebugBindAddress       *string `json:"debugBindAddress,omitempty" flag:"debug-bind-address"`
+
+	LeaderElect              *bool            `json:"leaderElect,omitempty" flag:"leader-elect"`
+	LeaderElectID            *string          `json:"leaderElectID,omitempty" flag:"leader-elect-id"`
+	LeaderElectNamespace     *string          `json:"leaderElectNamespace,omitempty" flag:"leader-elect-namespace"`
+	LeaderElectLeaseDuration *metav1.Duration `json:"leaderElectLeaseDuration,omitempty" flag:"leader-elect-lease-duration"`
+	LeaderElectRenewDeadline *metav1.Duration `json:"leaderElectRenewDeadline,omitempty" flag:"leader-elect-renew-deadline"`
+	LeaderElectRetryPeriod   *metav1.Duration `json:"leaderElectRetryPeriod,omitempty" flag:"leader-elect-retry-period"`
+	WarmStandby              *bool            `json:"warmStandby,omitempty" flag:"warm-standby"`
+	GracefulShutdownTimeout  *metav1.Duration `json:"gracefulShutdownTimeout,omitempty" flag:"graceful-shutdown-timeout"`
+
+	WatchNamespaces []string `json:"watchNamespaces,omitempty" flag:"watch-namespaces"`
+	ShardCount      *int     `json:"shardCount,omitempty" flag:"shard-count"`
+	ShardIndex      *int     `json:"shardIndex,omitempty" flag:"shard-index"`
+	ClusterSelector *string  `json:"clusterSelector,omitempty" flag:"cluster-selector"`
+	RestrictedRBAC  *bool    `json:"restrictedRBAC,omitempty" flag:"restricted-rbac"`
+
+	EtcdClusterMaxConcurrentReconciles *int             `json:"etcdClusterMaxConcurrentReconciles,omitempty" flag:"etcdcluster-max-concurrent-reconciles"`
+	EtcdClusterPriorityQueue           *bool            `json:"etcdClusterPriorityQueue,omitempty" flag:"etcdcluster-priority-queue"`
+	EtcdClusterRequeueBaseDelay        *metav1.Duration `json:"etcdClusterRequeueBaseDelay,omitempty" flag:"etcdcluster-requeue-base-delay"`
+	EtcdClusterRequeueMaxDelay         *metav1.Duration `json:"etcdClusterRequeueMaxDelay,omitempty" flag:"etcdcluster-requeue-max-delay"`
+	EtcdClusterRequeueQPS              *float64         `json:"etcdClusterRequeueQPS,omitempty" flag:"etcdcluster-requeue-qps"`
+	EtcdClusterRequeueBurst            *int             `json:"etcdClusterRequeueBurst,omitempty" flag:"etcdcluster-requeue-burst"`
+	KubeAPIQPS                         *float64         `json:"kubeAPIQPS,omitempty" flag:"kube-api-qps"`
+	KubeAPIBurst                       *int             `json:"kubeAPIBurst,omitempty" flag:"kube-api-burst"`
+	EtcdStatusCacheTTL                 *metav1.Duration `json:"etcdStatusCacheTTL,omitempty" flag:"etcd-status-cache-ttl"`
+	EtcdClientIdleTimeout              *metav1.Duration `json:"etcdClientIdleTimeout,omitempty" flag:"etcd-client-idle-timeout"`
+
+	EtcdBackupMaxConcurrentReconciles         *int `json:"etcdBackupMaxConcurrentReconciles,omitempty" flag:"etcdbackup-max-concurrent-reconciles"`
+	EtcdBackupScheduleMaxConcurrentReconciles *int `json:"etcdBackupScheduleMaxConcurrentReconciles,omitempty" flag:"etcdbackupschedule-max-concurrent-reconciles"`
+	EtcdRestoreMaxConcurrentReconciles        *int `json:"etcdRestoreMaxConcurrentReconciles,omitempty" flag:"etcdrestore-max-concurrent-reconciles"`
+
+	OperatorImage      *string  `json:"operatorImage,omitempty" flag:"operator-image"`
+	BackupHostPathDirs []string `json:"backupHostPathDirs,omitempty" flag:"backup-host-path-dirs"`
+
+	// FeatureGates enables or disables the experimental features of the
+	// operator, by name.
+	FeatureGates map[string]bool `json:"featureGates,omitempty" flag:"feature-gates"`
+
+	// LogLevel is the verbosity of the logs: debug, info or error, or an
+	// integer greater than 0 for more verbose levels. Reloaded while the
+	// operator runs.
+	LogLevel string `json:"logLevel,omitempty" flag:"zap-log-level"`
+
+	// DefaultTemplate is the name of the EtcdClusterTemplate set on the
+	// EtcdClusters created without a templateRef. Reloaded while the operator
+	// runs. It only applies to new EtcdClusters.
+	DefaultTemplate string `json:"defaultTemplate,omitempty"`
+}
+
+// Load reads the configuration file at path.
+func Load(path string) (*OperatorConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data)
+}
+
+func parse(data []byte) (*OperatorConfiguration, error) {
+	cfg := &OperatorConfiguration{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if cfg.APIVersion != APIVersion || cfg.Kind != Kind {
+		return nil, fmt.Errorf("invalid configuration: expected %s %s, got %s %s", APIVersion, Kind, cfg.APIVersion, cfg.Kind)
+	}
+	return cfg, nil
+}
+
+// ApplyToFlags sets the flags of fs to the values of the configuration,
+// except for the flags already set on the command line. It must be called
+// after parsing fs.
+func (c *OperatorConfiguration) ApplyToFlags(fs *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	v := reflect.ValueOf(c).Elem()
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		name := field.Tag.Get("flag")
+		if name == "" || v.Field(i).IsZero() || explicit[name] {
+			continue
+		}
+
+		var value string
+		switch f := v.Field(i).Interface().(type) {
+		case string:
+			value = f
+		case *metav1.Duration:
+			value = f.Duration.String()
+		case []string:
+			value = strings.Join(f, ",")
+		case map[string]bool:
+			gates := make([]string, 0, len(f))
+			for _, name := range slices.Sorted(maps.Keys(f)) {
+				gates = append(gates, fmt.Sprintf("%s=%t", name, f[name]))
+			}
+			value = strings.Join(gates, ",")
+		default:
+			value = fmt.Sprint(v.Field(i).Elem().Interface())
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", strings.Split(field.Tag.Get("json"), ",")[0], err)
+		}
+	}
+	return nil
+}
+
+// Reloader watches the configuration file, and reports its changes while
+// the operator runs.
+type Reloader struct {
+	// Path is the path of the configuration file.
+	Path string
+	// Interval is how often the file is checked for changes.
+	Interval time.Duration
+	// OnChange is called with the new configuration after each change of the
+	// file. An invalid file is logged and otherwise ignored.
+	OnChange func(*OperatorConfiguration)
+
+	last []byte
+}
+
+// Start polls the configuration file until ctx is done. Polling, unlike
+// watching the file, copes with the symlink swaps of mounted ConfigMaps.
+func (r *Reloader) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("config-reloader")
+	if r.last == nil {
+		r.last, _ = os.ReadFile(r.Path)
+	}
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(r.Path)
+		if err != nil {
+			logger.Error(err, "Failed to read the configuration file", "path", r.Path)
+			continue
+		}
+		if bytes.Equal(data, r.last) {
+			continue
+		}
+		r.last = data
+
+		cfg, err := parse(data)
+		if err != nil {
+			logger.Error(err, "Ignoring the invalid configuration file", "path", r.Path)
+			continue
+		}
+		logger.Info("Reloading the configuration file", "path", r.Path)
+		r.OnChange(cfg)
+	}
+}
+
+// NeedLeaderElection makes the Reloader run on all the replicas of the
+// operator, as the webhooks are served by all of them.
+func (r *Reloader) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `apiVersion: operator.etcd.io/v1alpha1
+kind: OperatorConfiguration
+leaderElect: true
+leaderElectNamespace: etcd-operator-leases
+leaderElectLeaseDuration: 30s
+watchNamespaces: [team-a, team-b]
+etcdClusterMaxConcurrentReconciles: 10
+etcdClusterRequeueQPS: 5.5
+logLevel: info
+defaultTemplate: golden
+featureGates:
+  StretchClusters: false
+  ContinuousBackup: true
+`
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load(writeConfig(t, testConfig))
+	assert.NoError(t, err)
+	assert.True(t, *cfg.LeaderElect)
+	assert.Equal(t, 30*time.Second, cfg.LeaderElectLeaseDuration.Duration)
+	assert.Equal(t, []string{"team-a", "team-b"}, cfg.WatchNamespaces)
+	assert.Equal(t, "golden", cfg.DefaultTemplate)
+
+	_, err = Load(writeConfig(t, "apiVersion: operator.etcd.io/v1alpha1\nkind: OperatorConfiguration\nunknownField: 1\n"))
+	assert.ErrorContains(t, err, "unknownField")
+
+	_, err = Load(writeConfig(t, "apiVersion: v1\nkind: ConfigMap\n"))
+	assert.ErrorContains(t, err, "expected operator.etcd.io/v1alpha1 OperatorConfiguration")
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestApplyToFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	leaderElect := fs.Bool("leader-elect", false, "")
+	leaderElectNamespace := fs.String("leader-elect-namespace", "", "")
+	leaseDuration := fs.Duration("leader-elect-lease-duration", 15*time.Second, "")
+	watchNamespaces := fs.String("watch-namespaces", "", "")
+	concurrency := fs.Int("etcdcluster-max-concurrent-reconciles", 1, "")
+	qps := fs.Float64("etcdcluster-requeue-qps", 10, "")
+	logLevel := fs.String("zap-log-level", "", "")
+	retryPeriod := fs.Duration("leader-elect-retry-period", 2*time.Second, "")
+	featureGates := fs.String("feature-gates", "", "")
+	assert.NoError(t, fs.Parse([]string{"--etcdcluster-max-concurrent-reconciles=3"}))
+
+	cfg, err := Load(writeConfig(t, testConfig))
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.ApplyToFlags(fs))
+
+	assert.True(t, *leaderElect)
+	assert.Equal(t, "etcd-operator-leases", *leaderElectNamespace)
+	assert.Equal(t, 30*time.Second, *leaseDuration)
+	assert.Equal(t, "team-a,team-b", *watchNamespaces)
+	assert.Equal(t, 5.5, *qps)
+	assert.Equal(t, "info", *logLevel)
+	assert.Equal(t, "ContinuousBackup=true,StretchClusters=false", *featureGates)
+	// Explicit flags win over the file.
+	assert.Equal(t, 3, *concurrency)
+	// Flags missing from the file keep their default.
+	assert.Equal(t, 2*time.Second, *retryPeriod)
+}
+
+func TestReloader(t *testing.T) {
+	path := writeConfig(t, testConfig)
+	changes := make(chan *OperatorConfiguration, 1)
+	r := &Reloader{
+		Path:     path,
+		Interval: 10 * time.Millisecond,
+		OnChange: func(cfg *OperatorConfiguration) { changes <- cfg },
+		last:     []byte(testConfig),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = r.Start(ctx) }()
+
+	// Unchanged and invalid files are ignored.
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(path, []byte("kind: ConfigMap\n"), 0o600))
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, changes)
+
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Replace(testConfig, "logLevel: info", "logLevel: error", 1)), 0o600))
+	select {
+	case cfg := <-changes:
+		assert.Equal(t, "error", cfg.LogLevel)
+	case <-time.After(time.Second):
+		t.Fatal("the change wasn't reported")
+	}
+}
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// adopting reports whether ec adopts sts, an existing StatefulSet it doesn't
+// control yet.
+func adopting(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) bool {
+	return ec.Spec.Adoption != nil && sts != nil && !isControlledBy(sts, ec)
+}
+
+// reconcileAdoption takes over the etcd cluster run by the StatefulSet named
+// after ec, which must have an adoption, once its members are healthy. The
+// pod template of the operator replaces the one of the StatefulSet, but the
+// rollout is held back to the members of the ordinals from the number of
+// replicas: none of them restarts, reconcileUpgrade then moves them to the
+// new template one at a time. It does nothing once the StatefulSet is
+// adopted, and fails while it doesn't exist, rather than bootstrapping a new
+// cluster.
+func reconcileAdoption(ctx context.Context, logger logr.Logger, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder,
+	ec *ecv1alpha1.EtcdCluster, etcdClient *etcdutils.ClusterClient) error {
+	sts, err := getStatefulSet(ctx, c, ec.Name, ec.Namespace)
+	if k8serrors.IsNotFound(err) {
+		return fmt.Errorf("StatefulSet %s/%s of the cluster to adopt not found", ec.Namespace, ec.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if !adopting(ec, sts) {
+		return nil
+	}
+	if err := checkAdoptableStatefulSet(ec, sts); err != nil {
+		return err
+	}
+
+	eps := ec.Spec.Adoption.Endpoints
+	health, err := etcdClient.ClusterHealth(eps)
+	if err != nil {
+		return fmt.Errorf("failed to check the health of the members to adopt: %w", err)
+	}
+	members, err := etcdClient.MemberList(eps)
+	if err != nil {
+		return fmt.Errorf("failed to list the members to adopt: %w", err)
+	}
+	version, err := checkAdoptableMembers(ec, sts, members, health)
+	if err != nil {
+		return err
+	}
+
+	// The pod template is applied with the version the members run, the
+	// upgrade to the version of the spec, if any, follows.
+	replicas := ptr.Deref(sts.Spec.Replicas, 0)
+	logger.Info("Adopting the etcd cluster", "statefulSet", sts.Name, "members", replicas, "version", version)
+	if err := setStatefulSetPartition(ctx, c, sts, replicas); err != nil {
+		return err
+	}
+	if err := applyEtcdClusterState(ctx, ec, int(replicas), c, scheme, logger, recorder); err != nil {
+		return err
+	}
+	adopted := ec.DeepCopy()
+	adopted.Spec.Version = version
+	if err := applyStatefulSet(ctx, logger, adopted, c, replicas, scheme); err != nil {
+		return err
+	}
+	recorder.Eventf(ec, corev1.EventTypeNormal, "Adopted", "Adopted the etcd cluster of StatefulSet %s, with %d members running %s", sts.Name, replicas, version)
+	return nil
+}
+
+// checkAdoptableStatefulSet returns why the operator can't take over sts on
+// behalf of ec, if it can't: the fields of sts the operator relies on can't
+// be changed, and the members must find their data when they restart with
+// the pod template of the operator.
+func checkAdoptableStatefulSet(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) error {
+	if owner := metav1.GetControllerOf(sts); owner != nil {
+		return fmt.Errorf("StatefulSet %s/%s is controlled by %s %s", sts.Namespace, sts.Name, owner.Kind, owner.Name)
+	}
+	if uid := sts.Labels[remoteOwnerLabel]; uid != "" {
+		return fmt.Errorf("StatefulSet %s/%s is controlled by the EtcdCluster with UID %s", sts.Namespace, sts.Name, uid)
+	}
+	desired, err := newStatefulSetSpec(ec, 0, nil)
+	if err != nil {
+		return err
+	}
+	if !equality.Semantic.DeepEqual(sts.Spec.Selector, desired.Selector) {
+		return fmt.Errorf("StatefulSet %s/%s must select the pods with the labels app=%s,controller=%s, its selector can't be changed",
+			sts.Namespace, sts.Name, ec.Name, ec.Name)
+	}
+	if sts.Spec.ServiceName != ec.Name {
+		return fmt.Errorf("StatefulSet %s/%s must be served by the Service %s, its serviceName can't be changed", sts.Namespace, sts.Name, ec.Name)
+	}
+
+	etcd := findContainer(sts.Spec.Template.Spec.Containers, "etcd")
+	if etcd == nil {
+		return fmt.Errorf("StatefulSet %s/%s has no etcd container", sts.Namespace, sts.Name)
+	}
+	if dir := containerDataDir(ec, etcd); dir != etcdDataDir {
+		return fmt.Errorf("the members of StatefulSet %s/%s keep their data in %q rather than %s", sts.Namespace, sts.Name, dir, etcdDataDir)
+	}
+	dataMount := func(c *corev1.Container) *corev1.VolumeMount {
+		i := slices.IndexFunc(c.VolumeMounts, func(m corev1.VolumeMount) bool { return m.MountPath == etcdDataDir })
+		if i < 0 {
+			return nil
+		}
+		m := c.VolumeMounts[i]
+		return &corev1.VolumeMount{Name: m.Name, SubPath: m.SubPath, SubPathExpr: m.SubPathExpr}
+	}
+	if want, got := dataMount(&desired.Template.Spec.Containers[0]), dataMount(etcd); !equality.Semantic.DeepEqual(want, got) {
+		return fmt.Errorf("the data volume of StatefulSet %s/%s isn't mounted the way the storage of the EtcdCluster is", sts.Namespace, sts.Name)
+	}
+	if len(desired.VolumeClaimTemplates) > 0 && !slices.ContainsFunc(sts.Spec.VolumeClaimTemplates, func(pvc corev1.PersistentVolumeClaim) bool {
+		return pvc.Name == volumeName
+	}) {
+		return fmt.Errorf("StatefulSet %s/%s has no volume claim template %s", sts.Namespace, sts.Name, volumeName)
+	}
+	return nil
+}
+
+// containerDataDir returns the data directory of the etcd container, set
+// with the --data-dir flag or the ETCD_DATA_DIR variable, or the one of the
+// ConfigMap of the cluster state of ec, for a StatefulSet the operator
+// created before.
+func containerDataDir(ec *ecv1alpha1.EtcdCluster, etcd *corev1.Container) string {
+	for i, arg := range etcd.Args {
+		if etcdutils.FlagName(arg) != "--data-dir" {
+			continue
+		}
+		if _, value, ok := strings.Cut(arg, "="); ok {
+			return value
+		}
+		if i+1 < len(etcd.Args) {
+			return etcd.Args[i+1]
+		}
+	}
+	for _, env := range etcd.Env {
+		if env.Name == "ETCD_DATA_DIR" {
+			return env.Value
+		}
+	}
+	for _, from := range etcd.EnvFrom {
+		if ref := from.ConfigMapRef; ref != nil && ref.Name == configMapNameForEtcdCluster(ec) {
+			return etcdDataDir
+		}
+	}
+	return ""
+}
+
+// checkAdoptableMembers returns the version run by the members of the
+// cluster to adopt, members, whose endpoints passed the health check
+// health, or why they can't be adopted: each pod of sts must run one of the
+// members, named after it, which the operator then finds by name.
+func checkAdoptableMembers(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, members *clientv3.MemberListResponse, health []etcdutils.EpHealth) (string, error) {
+	var version string
+	for _, h := range health {
+		if !h.Health || h.Status == nil {
+			return "", fmt.Errorf("member %s is unhealthy: %s", h.Ep, h.Error)
+		}
+		if version != "" && h.Status.Version != version {
+			return "", fmt.Errorf("the members run different versions, %s and %s", version, h.Status.Version)
+		}
+		version = h.Status.Version
+	}
+	if version == "" {
+		return "", errors.New("no member to adopt answered")
+	}
+
+	replicas := int(ptr.Deref(sts.Spec.Replicas, 0))
+	if len(members.Members) != replicas {
+		return "", fmt.Errorf("StatefulSet %s/%s runs %d pods, but the cluster has %d members", sts.Namespace, sts.Name, replicas, len(members.Members))
+	}
+	for _, m := range members.Members {
+		if m.IsLearner {
+			return "", fmt.Errorf("member %s is a learner", m.Name)
+		}
+		if !isMemberOfStatefulSet(ec, m.Name, replicas) {
+			return "", fmt.Errorf("member %q isn't named after a pod of StatefulSet %s/%s", m.Name, sts.Namespace, sts.Name)
+		}
+	}
+	return "v" + version, nil
+}
+
+// isMemberOfStatefulSet reports whether name is the name of a pod of the
+// StatefulSet of ec with the given number of replicas.
+func isMemberOfStatefulSet(ec *ecv1alpha1.EtcdCluster, name string, replicas int) bool {
+	for i := range replicas {
+		if name == fmt.Sprintf("%s-%d", ec.Name, i) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func newAdoptionTestCluster() *ecv1alpha1.EtcdCluster {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.UID = "ec-uid"
+	ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{VolumeSizeRequest: resource.MustParse("1Gi")}
+	ec.Spec.Adoption = &ecv1alpha1.Adoption{Endpoints: []string{"http://test-etcd-0.test-etcd:2379"}}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	return ec
+}
+
+// newUnmanagedStatefulSet returns a StatefulSet running the members of ec
+// the way a hand written manifest would.
+func newUnmanagedStatefulSet(t *testing.T, ec *ecv1alpha1.EtcdCluster) *appsv1.StatefulSet {
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	etcd := &sts.Spec.Template.Spec.Containers[0]
+	etcd.Image = "quay.io/coreos/etcd:v3.5.17"
+	etcd.EnvFrom = nil
+	etcd.Args = []string{"--name=$(POD_NAME)", "--data-dir", etcdDataDir}
+	return sts
+}
+
+func TestCheckAdoptableStatefulSet(t *testing.T) {
+	ec := newAdoptionTestCluster()
+
+	tests := []struct {
+		name        string
+		mutate      func(sts *appsv1.StatefulSet)
+		expectedErr string
+	}{
+		{
+			name: "adoptable",
+		},
+		{
+			name: "created by the operator",
+			mutate: func(sts *appsv1.StatefulSet) {
+				*sts = *newPlanTestStatefulSet(t, ec, 3)
+			},
+		},
+		{
+			name: "controlled by something else",
+			mutate: func(sts *appsv1.StatefulSet) {
+				sts.OwnerReferences = []metav1.OwnerReference{{Kind: "EtcdCluster", Name: "other", Controller: ptr.To(true)}}
+			},
+			expectedErr: "is controlled by EtcdCluster other",
+		},
+		{
+			name: "other selector",
+			mutate: func(sts *appsv1.StatefulSet) {
+				sts.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "etcd"}}
+			},
+			expectedErr: "its selector can't be changed",
+		},
+		{
+			name:        "other service",
+			mutate:      func(sts *appsv1.StatefulSet) { sts.Spec.ServiceName = "test-etcd-headless" },
+			expectedErr: "its serviceName can't be changed",
+		},
+		{
+			name: "other data directory",
+			mutate: func(sts *appsv1.StatefulSet) {
+				sts.Spec.Template.Spec.Containers[0].Args = []string{"--name=$(POD_NAME)"}
+				sts.Spec.Template.Spec.Containers[0].Env = append(sts.Spec.Template.Spec.Containers[0].Env,
+					corev1.EnvVar{Name: "ETCD_DATA_DIR", Value: "/data"})
+			},
+			expectedErr: `keep their data in "/data"`,
+		},
+		{
+			name: "other data volume",
+			mutate: func(sts *appsv1.StatefulSet) {
+				sts.Spec.Template.Spec.Containers[0].VolumeMounts[0].SubPathExpr = ""
+			},
+			expectedErr: "isn't mounted the way the storage of the EtcdCluster is",
+		},
+		{
+			name: "no volume claim template",
+			mutate: func(sts *appsv1.StatefulSet) {
+				sts.Spec.VolumeClaimTemplates[0].Name = "data"
+			},
+			expectedErr: "has no volume claim template etcd-data",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sts := newUnmanagedStatefulSet(t, ec)
+			if tt.mutate != nil {
+				tt.mutate(sts)
+			}
+			err := checkAdoptableStatefulSet(ec, sts)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestCheckAdoptableMembers(t *testing.T) {
+	ec := newAdoptionTestCluster()
+	sts := newUnmanagedStatefulSet(t, ec)
+	healthy := func(ep, version string) etcdutils.EpHealth {
+		return etcdutils.EpHealth{Ep: ep, Health: true, Status: &clientv3.StatusResponse{Version: version}}
+	}
+	members := func(names ...string) *clientv3.MemberListResponse {
+		resp := &clientv3.MemberListResponse{}
+		for _, name := range names {
+			resp.Members = append(resp.Members, &etcdserverpb.Member{Name: name})
+		}
+		return resp
+	}
+
+	version, err := checkAdoptableMembers(ec, sts, members("test-etcd-0", "test-etcd-1", "test-etcd-2"),
+		[]etcdutils.EpHealth{healthy("http://test-etcd-0.test-etcd:2379", "3.5.17")})
+	assert.NoError(t, err)
+	assert.Equal(t, "v3.5.17", version)
+
+	_, err = checkAdoptableMembers(ec, sts, members("test-etcd-0", "test-etcd-1", "test-etcd-2"),
+		[]etcdutils.EpHealth{{Ep: "http://test-etcd-0.test-etcd:2379", Error: "context deadline exceeded"}})
+	assert.ErrorContains(t, err, "member http://test-etcd-0.test-etcd:2379 is unhealthy")
+
+	_, err = checkAdoptableMembers(ec, sts, members("test-etcd-0", "test-etcd-1", "test-etcd-2"),
+		[]etcdutils.EpHealth{healthy("http://test-etcd-0.test-etcd:2379", "3.5.17"), healthy("http://test-etcd-1.test-etcd:2379", "3.5.16")})
+	assert.ErrorContains(t, err, "the members run different versions")
+
+	_, err = checkAdoptableMembers(ec, sts, members("test-etcd-0", "test-etcd-1"),
+		[]etcdutils.EpHealth{healthy("http://test-etcd-0.test-etcd:2379", "3.5.17")})
+	assert.ErrorContains(t, err, "runs 3 pods, but the cluster has 2 members")
+
+	_, err = checkAdoptableMembers(ec, sts, members("test-etcd-0", "test-etcd-1", "infra2"),
+		[]etcdutils.EpHealth{healthy("http://test-etcd-0.test-etcd:2379", "3.5.17")})
+	assert.ErrorContains(t, err, `member "infra2" isn't named after a pod`)
+}
+
+func TestReconcileAdoption(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	ec := newAdoptionTestCluster()
+	pool := etcdutils.NewClientPool()
+	defer pool.CloseAll()
+	etcdClient := pool.Cluster("default/test-etcd", nil, nil)
+
+	// A missing StatefulSet isn't created.
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	err := reconcileAdoption(ctx, logr.Discard(), c, scheme, record.NewFakeRecorder(10), ec, etcdClient)
+	assert.ErrorContains(t, err, "StatefulSet default/test-etcd of the cluster to adopt not found")
+
+	// The members aren't looked up once adopted.
+	sts := newUnmanagedStatefulSet(t, ec)
+	assert.NoError(t, setWorkloadOwner(ec, scheme, sts))
+	c = fake.NewClientBuilder().WithScheme(scheme).WithObjects(sts).Build()
+	assert.NoError(t, reconcileAdoption(ctx, logr.Discard(), c, scheme, record.NewFakeRecorder(10), ec, etcdClient))
+
+	// Nor before the StatefulSet is checked.
+	sts = newUnmanagedStatefulSet(t, ec)
+	sts.Spec.ServiceName = "test-etcd-headless"
+	c = fake.NewClientBuilder().WithScheme(scheme).WithObjects(sts).Build()
+	err = reconcileAdoption(ctx, logr.Discard(), c, scheme, record.NewFakeRecorder(10), ec, etcdClient)
+	assert.ErrorContains(t, err, "its serviceName can't be changed")
+}
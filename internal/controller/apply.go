@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// fieldManager is the field manager used for all the server-side applies of
+// the operator.
+const fieldManager = "etcd-operator"
+
+// managedByLabel marks the child resources of the operator. The cache of the
+// manager only watches the objects carrying it, see CacheByObject.
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "etcd-operator"
+)
+
+// CacheByObject restricts the cache of the manager to the child resources
+// of the operator, so it doesn't hold every StatefulSet, Service, ConfigMap,
+// Pod, Secret and Job of the Kubernetes cluster.
+func CacheByObject() map[client.Object]cache.ByObject {
+	managed := cache.ByObject{Label: labels.SelectorFromSet(labels.Set{managedByLabel: managedByValue})}
+	return map[client.Object]cache.ByObject{
+		&appsv1.StatefulSet{}: managed,
+		&corev1.Service{}:     managed,
+		&corev1.ConfigMap{}:   managed,
+		&corev1.Pod{}:         managed,
+		&corev1.Secret{}:      managed,
+		&batchv1.Job{}:        managed,
+	}
+}
+
+// managedTypes are the types of the objects cached by the managedByLabel.
+var managedTypes = func() map[reflect.Type]bool {
+	managed := map[reflect.Type]bool{}
+	for obj := range CacheByObject() {
+		managed[reflect.TypeOf(obj)] = true
+	}
+	return managed
+}()
+
+// NewClient creates the client of the manager. The objects of the kinds of
+// CacheByObject missing from the cache are read again from the API server:
+// the ones created by an older version of the operator don't carry the
+// managedByLabel until their next apply, and mustn't be mistaken for missing
+// ones, e.g. recreating a running StatefulSet with no replicas.
+func NewClient(config *rest.Config, options client.Options) (client.Client, error) {
+	c, err := client.New(config, options)
+	if err != nil {
+		return nil, err
+	}
+	options.Cache = nil
+	reader, err := client.New(config, options)
+	if err != nil {
+		return nil, err
+	}
+	return &unlabeledFallbackClient{Client: c, reader: reader}, nil
+}
+
+// unlabeledFallbackClient reads the objects of the kinds of CacheByObject
+// missing from the cache of Client with reader, see NewClient.
+type unlabeledFallbackClient struct {
+	client.Client
+	reader client.Reader
+}
+
+func (c *unlabeledFallbackClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	err := c.Client.Get(ctx, key, obj, opts...)
+	if !k8serrors.IsNotFound(err) || !managedTypes[reflect.TypeOf(obj)] {
+		return err
+	}
+	return c.reader.Get(ctx, key, obj, opts...)
+}
+
+// withManagedByLabel returns a copy of lbls with the managedByLabel set.
+func withManagedByLabel(lbls map[string]string) map[string]string {
+	managed := make(map[string]string, len(lbls)+1)
+	for k, v := range lbls {
+		managed[k] = v
+	}
+	managed[managedByLabel] = managedByValue
+	return managed
+}
+
+// applyOwnedObject server-side applies obj, a child resource of ec, with the
+// managedByLabel. obj must carry its apiVersion and kind. An existing object
+// with the same name that has no controller is adopted, and an Event records
+// the adoption; an object controlled by something else is left alone and
+// reported as an error. Ownership follows isControlledBy, so the workloads
+// run in a remote Kubernetes cluster are recognized too.
+func applyOwnedObject(ctx context.Context, c client.Client, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, obj client.Object) error {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	obj.SetLabels(withManagedByLabel(obj.GetLabels()))
+
+	existing, ok := obj.DeepCopyObject().(client.Object)
+	if !ok {
+		return fmt.Errorf("unable to copy %s %s/%s", kind, obj.GetNamespace(), obj.GetName())
+	}
+	err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	switch {
+	case k8serrors.IsNotFound(err):
+	case err != nil:
+		return err
+	case isControlledBy(existing, ec):
+	case metav1.GetControllerOf(existing) != nil:
+		return fmt.Errorf("%s %s/%s already exists and is controlled by %s",
+			kind, obj.GetNamespace(), obj.GetName(), metav1.GetControllerOf(existing).Name)
+	case existing.GetLabels()[remoteOwnerLabel] != "":
+		return fmt.Errorf("%s %s/%s already exists and is controlled by the EtcdCluster with UID %s",
+			kind, obj.GetNamespace(), obj.GetName(), existing.GetLabels()[remoteOwnerLabel])
+	default:
+		recorder.Eventf(ec, corev1.EventTypeNormal, "Adopted", "Adopted the existing %s %s", kind, obj.GetName())
+	}
+
+	return c.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
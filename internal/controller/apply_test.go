@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// applyAsCreateOrUpdate stores server-side apply patches as a create or a
+// full update, as the fake client doesn't support them.
+var applyAsCreateOrUpdate = interceptor.Funcs{
+	Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+		if patch.Type() != types.ApplyPatchType {
+			return c.Patch(ctx, obj, patch, opts...)
+		}
+		existing, _ := obj.DeepCopyObject().(client.Object)
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+			if !k8serrors.IsNotFound(err) {
+				return err
+			}
+			return c.Create(ctx, obj)
+		}
+		obj.SetResourceVersion(existing.GetResourceVersion())
+		return c.Update(ctx, obj)
+	},
+}
+
+func TestApplyOwnedObject(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default", UID: "ec-uid"},
+	}
+	owners, err := prepareOwnerReference(ec, scheme)
+	assert.NoError(t, err)
+
+	newService := func(name string) *corev1.Service {
+		return &corev1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: owners},
+		}
+	}
+	orphan := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "default"}}
+	foreign := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:      "foreign",
+		Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: "v1", Kind: "ConfigMap", Name: "someone-else", UID: "other-uid", Controller: ptr.To(true),
+		}},
+	}}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(orphan, foreign).
+		WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	recorder := record.NewFakeRecorder(10)
+
+	t.Run("creates missing objects", func(t *testing.T) {
+		assert.NoError(t, applyOwnedObject(ctx, fakeClient, recorder, ec, newService("test-etcd")))
+		assert.Empty(t, recorder.Events)
+
+		stored := &corev1.Service{}
+		assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-etcd", Namespace: "default"}, stored))
+		assert.Equal(t, managedByValue, stored.Labels[managedByLabel])
+	})
+
+	t.Run("adopts orphans", func(t *testing.T) {
+		assert.NoError(t, applyOwnedObject(ctx, fakeClient, recorder, ec, newService("orphan")))
+		assert.Contains(t, <-recorder.Events, "Adopted the existing Service orphan")
+
+		stored := &corev1.Service{}
+		assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(orphan), stored))
+		assert.True(t, metav1.IsControlledBy(stored, ec))
+	})
+
+	t.Run("leaves objects controlled by others alone", func(t *testing.T) {
+		err := applyOwnedObject(ctx, fakeClient, recorder, ec, newService("foreign"))
+		assert.ErrorContains(t, err, "is controlled by someone-else")
+	})
+}
+
+func TestUnlabeledFallbackClient(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default", UID: "ec-uid"},
+	}
+	owners, err := prepareOwnerReference(ec, scheme)
+	assert.NoError(t, err)
+
+	// The objects of an older version of the operator, without the
+	// managedByLabel.
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default", OwnerReferences: owners},
+		Spec:       appsv1.StatefulSetSpec{Replicas: ptr.To[int32](3)},
+	}
+	foreign := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:      "test-etcd-state",
+		Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: "v1", Kind: "ConfigMap", Name: "someone-else", UID: "other-uid", Controller: ptr.To(true),
+		}},
+	}}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(sts, foreign).Build()
+	// The cache of the manager only holds the objects with the label.
+	cached := interceptor.NewClient(reader, interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if err := c.Get(ctx, key, obj, opts...); err != nil {
+				return err
+			}
+			if obj.GetLabels()[managedByLabel] != managedByValue {
+				return k8serrors.NewNotFound(schema.GroupResource{}, key.Name)
+			}
+			return nil
+		},
+	})
+	_, err = getStatefulSet(ctx, cached, "test-etcd", "default")
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	c := &unlabeledFallbackClient{Client: cached, reader: reader}
+	got, err := getStatefulSet(ctx, c, "test-etcd", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), *got.Spec.Replicas)
+
+	cm := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd-state", Namespace: "default", OwnerReferences: owners},
+	}
+	err = applyOwnedObject(ctx, c, record.NewFakeRecorder(10), ec, cm)
+	assert.ErrorContains(t, err, "is controlled by someone-else")
+
+	// The objects actually missing are still reported as such.
+	err = c.Get(ctx, client.ObjectKey{Name: "missing", Namespace: "default"}, &appsv1.StatefulSet{})
+	assert.True(t, k8serrors.IsNotFound(err))
+}
@@ -0,0 +1,309 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"net"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/pki"
+)
+
+const (
+	// caValidity is the lifetime of the CA the operator generates for each
+	// EtcdCluster with the auto TLS provider.
+	caValidity = 10 * 365 * 24 * time.Hour
+	// defaultCertificateDuration is the lifetime of the certificates issued
+	// by the CA, unless the autoCfg of the EtcdCluster sets it.
+	defaultCertificateDuration = 90 * 24 * time.Hour
+)
+
+// renewalTimeAnnotation records, on the CA Secret and on the pod template of
+// the members, when the certificates of the members were last renewed. The
+// StatefulSet restarts the members when it changes.
+const renewalTimeAnnotation = "operator.etcd.io/certificates-renewal-time"
+
+// caSecretName returns the name of the Secret holding the CA of ec, and its
+// key.
+func caSecretName(ec *ecv1alpha1.EtcdCluster) string {
+	return ec.Name + "-ca"
+}
+
+// memberCertKey and memberKeyKey return the keys of the certificate of the
+// given member, and of its private key, in the server and peer Secrets.
+func memberCertKey(member string) string { return member + ".crt" }
+func memberKeyKey(member string) string  { return member + ".key" }
+
+// certificateDuration returns the lifetime of the certificates issued to the
+// members and to the operator.
+func certificateDuration(ec *ecv1alpha1.EtcdCluster) time.Duration {
+	if cfg := ec.Spec.TLS.ProviderCfg.AutoCfg; cfg != nil && cfg.Duration != nil {
+		return cfg.Duration.Duration
+	}
+	return defaultCertificateDuration
+}
+
+// reconcileAutoCertificates generates the CA of ec, issues the certificates of
+// its members and of the operator, and renews them before they expire. When
+// the certificates of the existing members, or the CA they trust, are
+// renewed, the renewal time recorded in the status of ec changes, which
+// restarts the members.
+func reconcileAutoCertificates(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, now time.Time) error {
+	caSecret, err := getTLSSecret(ctx, c, ec, caSecretName(ec))
+	if err != nil {
+		return err
+	}
+	ca, caRenewed, err := reconcileCA(ec, caSecret, now)
+	if err != nil {
+		return err
+	}
+	// The annotations of the CA Secret are applied along with it, so they
+	// aren't removed.
+	annotations := caSecret.Annotations
+	if len(caSecret.Data) == 0 || caRenewed {
+		if err := applyTLSSecret(ctx, c, scheme, recorder, ec, newCASecret(ec, ca, annotations)); err != nil {
+			return err
+		}
+	}
+
+	renewed := caRenewed
+	for _, certificate := range []string{peerCertificate, serverCertificate} {
+		secret, err := getTLSSecret(ctx, c, ec, tlsSecretName(ec, certificate))
+		if err != nil {
+			return err
+		}
+		data, memberRenewed, err := issueMemberCertificates(ec, ca, certificate, secret.Data, now)
+		if err != nil {
+			return fmt.Errorf("failed to issue the %s certificates: %w", certificate, err)
+		}
+		renewed = renewed || memberRenewed
+		if !maps.EqualFunc(secret.Data, data, bytes.Equal) {
+			if err := applyTLSSecret(ctx, c, scheme, recorder, ec, newTLSSecret(ec, secret.Name, corev1.SecretTypeOpaque, data)); err != nil {
+				return err
+			}
+		}
+	}
+
+	secret, err := getTLSSecret(ctx, c, ec, tlsSecretName(ec, clientCertificate))
+	if err != nil {
+		return err
+	}
+	if !validCertificate(secret.Data, ca, now) {
+		cert, err := ca.Issue(pki.Request{
+			CommonName: fmt.Sprintf("%s-operator", ec.Name),
+			Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			Validity:   certificateDuration(ec),
+		}, now)
+		if err != nil {
+			return fmt.Errorf("failed to issue the client certificate: %w", err)
+		}
+		data := map[string][]byte{
+			corev1.ServiceAccountRootCAKey: ca.CertPEM,
+			corev1.TLSCertKey:              cert.CertPEM,
+			corev1.TLSPrivateKeyKey:        cert.KeyPEM,
+		}
+		if err := applyTLSSecret(ctx, c, scheme, recorder, ec, newTLSSecret(ec, secret.Name, corev1.SecretTypeTLS, data)); err != nil {
+			return err
+		}
+	}
+
+	if renewed {
+		annotations = map[string]string{renewalTimeAnnotation: now.UTC().Format(time.RFC3339)}
+		if err := applyTLSSecret(ctx, c, scheme, recorder, ec, newCASecret(ec, ca, annotations)); err != nil {
+			return err
+		}
+		recorder.Event(ec, corev1.EventTypeNormal, "CertificatesRenewed",
+			"Renewed the certificates of the members, restarting them one at a time")
+	}
+	if value, ok := annotations[renewalTimeAnnotation]; ok {
+		renewalTime, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation on Secret %s: %w", renewalTimeAnnotation, caSecret.Name, err)
+		}
+		ec.Status.CertificatesRenewalTime = &metav1.Time{Time: renewalTime}
+	}
+	return nil
+}
+
+// certificatesAnnotations returns the annotations of the pod template of the
+// members of ec recording when their certificates were last renewed.
+func certificatesAnnotations(ec *ecv1alpha1.EtcdCluster) map[string]string {
+	if ec.Status.CertificatesRenewalTime == nil {
+		return nil
+	}
+	return map[string]string{renewalTimeAnnotation: ec.Status.CertificatesRenewalTime.UTC().Format(time.RFC3339)}
+}
+
+// certificatesRenewed returns whether the members of sts have to be
+// restarted to load the certificates renewed since they started.
+func certificatesRenewed(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) bool {
+	return certificatesAnnotations(ec)[renewalTimeAnnotation] != sts.Spec.Template.Annotations[renewalTimeAnnotation]
+}
+
+// reconcileCA returns the CA of ec, from its Secret. It is generated when the
+// Secret is missing, and renewed with the same key when it is about to
+// expire, so the certificates it issued stay valid.
+func reconcileCA(ec *ecv1alpha1.EtcdCluster, secret *corev1.Secret, now time.Time) (*pki.KeyPair, bool, error) {
+	if len(secret.Data) == 0 {
+		ca, err := pki.NewCA(fmt.Sprintf("%s-ca", ec.Name), caValidity, now)
+		return ca, false, err
+	}
+	ca, err := pki.ParseKeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		// Generating another CA would lock the members out of each other.
+		return nil, false, fmt.Errorf("invalid CA in Secret %s: %w", secret.Name, err)
+	}
+	if !pki.NeedsRenewal(ca.Cert, now) {
+		return ca, false, nil
+	}
+	ca, err = ca.Renew(caValidity, now)
+	return ca, true, err
+}
+
+// issueMemberCertificates returns the data of the Secret of the given
+// certificate of the members of ec, from its current data. The missing
+// certificates, of the new members, are issued. All the certificates are
+// reissued, which is reported, when any of them is about to expire or
+// wasn't issued by ca. The certificates of the members removed by a scale in
+// are kept, in case it is interrupted.
+func issueMemberCertificates(ec *ecv1alpha1.EtcdCluster, ca *pki.KeyPair, certificate string, current map[string][]byte, now time.Time) (map[string][]byte, bool, error) {
+	members := map[string]bool{}
+	for i := range ec.Spec.Size {
+		members[fmt.Sprintf("%s-%d", ec.Name, i)] = false
+	}
+	// The gRPC proxy serves the clients with a certificate of its own.
+	if certificate == serverCertificate && ec.Spec.GRPCProxy != nil {
+		members[grpcProxyName(ec)] = false
+	}
+	renew := false
+	for key := range current {
+		member, found := strings.CutSuffix(key, ".crt")
+		if !found || key == corev1.ServiceAccountRootCAKey {
+			continue
+		}
+		members[member] = true
+		if !validCertificate(map[string][]byte{
+			corev1.TLSCertKey:              current[key],
+			corev1.ServiceAccountRootCAKey: current[corev1.ServiceAccountRootCAKey],
+		}, ca, now) {
+			renew = true
+		}
+	}
+
+	data := map[string][]byte{corev1.ServiceAccountRootCAKey: ca.CertPEM}
+	renewed := false
+	for member, existing := range members {
+		if existing && !renew {
+			data[memberCertKey(member)] = current[memberCertKey(member)]
+			data[memberKeyKey(member)] = current[memberKeyKey(member)]
+			continue
+		}
+		cert, err := ca.Issue(memberCertificateRequest(ec, certificate, member), now)
+		if err != nil {
+			return nil, false, err
+		}
+		data[memberCertKey(member)] = cert.CertPEM
+		data[memberKeyKey(member)] = cert.KeyPEM
+		renewed = renewed || existing
+	}
+	return data, renewed, nil
+}
+
+// memberCertificateRequest describes the given certificate of a member of ec.
+func memberCertificateRequest(ec *ecv1alpha1.EtcdCluster, certificate, member string) pki.Request {
+	host := fmt.Sprintf("%s.%s.%s.svc", member, ec.Name, ec.Namespace)
+	req := pki.Request{
+		CommonName: member,
+		DNSNames:   []string{host, host + ".cluster.local"},
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		Validity:   certificateDuration(ec),
+	}
+	if domain := memberServicesDomain(ec); domain != "" {
+		req.DNSNames = append(req.DNSNames, member+"."+domain)
+	}
+	if member == grpcProxyName(ec) {
+		req.DNSNames = append(req.DNSNames, fmt.Sprintf("%s.%s.svc", member, ec.Namespace))
+	}
+	if certificate == serverCertificate {
+		req.DNSNames = append(req.DNSNames, fmt.Sprintf("%s.%s.svc", ec.Name, ec.Namespace), "localhost")
+		req.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	return req
+}
+
+// validCertificate returns whether data holds a certificate issued by ca,
+// along with ca itself, that doesn't need to be renewed yet.
+func validCertificate(data map[string][]byte, ca *pki.KeyPair, now time.Time) bool {
+	if !bytes.Equal(data[corev1.ServiceAccountRootCAKey], ca.CertPEM) {
+		return false
+	}
+	cert, err := pki.ParseCertificate(data[corev1.TLSCertKey])
+	if err != nil {
+		return false
+	}
+	return pki.SignedBy(cert, ca.Cert) && !pki.NeedsRenewal(cert, now)
+}
+
+// getTLSSecret returns the Secret of ec with the given name, or an empty one
+// when it doesn't exist yet.
+func getTLSSecret(ctx context.Context, c client.Client, ec *ecv1alpha1.EtcdCluster, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: ec.Namespace}, secret)
+	if k8serrors.IsNotFound(err) {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ec.Namespace}}, nil
+	}
+	return secret, err
+}
+
+// newTLSSecret returns the Secret of ec with the given name, type and data.
+func newTLSSecret(ec *ecv1alpha1.EtcdCluster, name string, secretType corev1.SecretType, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ec.Namespace,
+			Labels:    map[string]string{"app": ec.Name},
+		},
+		Type: secretType,
+		Data: data,
+	}
+}
+
+// newCASecret returns the Secret holding ca, the CA of ec, with the given
+// annotations.
+func newCASecret(ec *ecv1alpha1.EtcdCluster, ca *pki.KeyPair, annotations map[string]string) *corev1.Secret {
+	secret := newTLSSecret(ec, caSecretName(ec), corev1.SecretTypeTLS, map[string][]byte{
+		corev1.ServiceAccountRootCAKey: ca.CertPEM,
+		corev1.TLSCertKey:              ca.CertPEM,
+		corev1.TLSPrivateKeyKey:        ca.KeyPEM,
+	})
+	secret.Annotations = annotations
+	return secret
+}
+
+// applyTLSSecret applies secret, a Secret of ec holding certificates.
+func applyTLSSecret(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, secret *corev1.Secret) error {
+	if err := setWorkloadOwner(ec, scheme, secret); err != nil {
+		return err
+	}
+	if err := applyOwnedObject(ctx, c, recorder, ec, secret); err != nil {
+		return fmt.Errorf("failed to apply Secret %s: %w", secret.Name, err)
+	}
+	return nil
+}
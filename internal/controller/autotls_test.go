@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/pki"
+)
+
+func newAutoTLSTestCluster() *ecv1alpha1.EtcdCluster {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "default", UID: "ec-uid"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:    3,
+			Version: "v3.5.21",
+			TLS:     &ecv1alpha1.TLSCertificate{},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	return ec
+}
+
+func getTestSecret(t *testing.T, c client.Client, name string) *corev1.Secret {
+	t.Helper()
+	secret := &corev1.Secret{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKey{Name: name, Namespace: "default"}, secret))
+	return secret
+}
+
+func TestAutoTLSArgs(t *testing.T) {
+	ec := newAutoTLSTestCluster()
+	args := createArgs(ec)
+	assert.Contains(t, args, "--listen-client-urls=https://0.0.0.0:2379")
+	assert.Contains(t, args, "--cert-file=/etc/etcd/tls/server/$(POD_NAME).crt")
+	assert.Contains(t, args, "--key-file=/etc/etcd/tls/server/$(POD_NAME).key")
+	assert.Contains(t, args, "--trusted-ca-file=/etc/etcd/tls/server/ca.crt")
+	assert.Contains(t, args, "--peer-cert-file=/etc/etcd/tls/peer/$(POD_NAME).crt")
+	assert.Equal(t, ecv1alpha1.DefaultMetricsPort, ec.Spec.PodTemplate.ReadinessProbe.HTTPGet.Port.IntVal)
+}
+
+func TestReconcileAutoCertificates(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	recorder := record.NewFakeRecorder(10)
+	ec := newAutoTLSTestCluster()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, reconcileCertificates(ctx, c, scheme, recorder, ec, now))
+	caSecret := getTestSecret(t, c, "etcd-ca")
+	assert.True(t, metav1.IsControlledBy(caSecret, ec))
+	assert.Equal(t, managedByValue, caSecret.Labels[managedByLabel])
+	ca, err := pki.ParseKeyPair(caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey])
+	assert.NoError(t, err)
+
+	server := getTestSecret(t, c, "etcd-server-tls")
+	assert.Len(t, server.Data, 7)
+	assert.Equal(t, ca.CertPEM, server.Data[corev1.ServiceAccountRootCAKey])
+	cert, err := pki.ParseCertificate(server.Data["etcd-2.crt"])
+	assert.NoError(t, err)
+	assert.True(t, pki.SignedBy(cert, ca.Cert))
+	assert.NoError(t, cert.VerifyHostname("etcd-2.etcd.default.svc.cluster.local"))
+	assert.NoError(t, cert.VerifyHostname("etcd.default.svc"))
+	assert.Error(t, cert.VerifyHostname("etcd-1.etcd.default.svc"))
+	assert.Equal(t, now.Add(90*24*time.Hour), cert.NotAfter)
+	peer := getTestSecret(t, c, "etcd-peer-tls")
+	cert, err = pki.ParseCertificate(peer.Data["etcd-0.crt"])
+	assert.NoError(t, err)
+	assert.Error(t, cert.VerifyHostname("localhost"))
+
+	tlsConfig, err := clusterTLSConfig(ctx, c, ec)
+	assert.NoError(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.Nil(t, ec.Status.CertificatesRenewalTime)
+
+	t.Run("scale out", func(t *testing.T) {
+		ec.Spec.Size = 4
+		assert.NoError(t, reconcileCertificates(ctx, c, scheme, recorder, ec, now.Add(time.Hour)))
+		scaled := getTestSecret(t, c, "etcd-server-tls")
+		assert.Len(t, scaled.Data, 9)
+		assert.Equal(t, server.Data["etcd-0.crt"], scaled.Data["etcd-0.crt"])
+		assert.NotEmpty(t, scaled.Data["etcd-3.key"])
+		assert.Nil(t, ec.Status.CertificatesRenewalTime)
+
+		// The certificates of the removed members are kept.
+		ec.Spec.Size = 3
+		assert.NoError(t, reconcileCertificates(ctx, c, scheme, recorder, ec, now.Add(time.Hour)))
+		assert.Len(t, getTestSecret(t, c, "etcd-server-tls").Data, 9)
+	})
+
+	t.Run("renewal", func(t *testing.T) {
+		renewal := now.Add(61 * 24 * time.Hour)
+		assert.NoError(t, reconcileCertificates(ctx, c, scheme, recorder, ec, renewal))
+		renewed := getTestSecret(t, c, "etcd-server-tls")
+		cert, err := pki.ParseCertificate(renewed.Data["etcd-0.crt"])
+		assert.NoError(t, err)
+		assert.Equal(t, renewal.Add(90*24*time.Hour), cert.NotAfter)
+		cert, err = pki.ParseCertificate(renewed.Data["etcd-3.crt"])
+		assert.NoError(t, err)
+		assert.Equal(t, renewal.Add(90*24*time.Hour), cert.NotAfter)
+		assert.Equal(t, caSecret.Data, getTestSecret(t, c, "etcd-ca").Data)
+		assert.Equal(t, &metav1.Time{Time: renewal}, ec.Status.CertificatesRenewalTime)
+		assert.Contains(t, <-recorder.Events, "CertificatesRenewed")
+
+		sts := &appsv1.StatefulSet{}
+		assert.True(t, certificatesRenewed(ec, sts))
+		spec, err := newStatefulSetSpec(ec, 3, nil)
+		assert.NoError(t, err)
+		sts.Spec = spec
+		assert.False(t, certificatesRenewed(ec, sts))
+
+		// The renewal time is read back from the CA Secret.
+		ec.Status.CertificatesRenewalTime = nil
+		assert.NoError(t, reconcileCertificates(ctx, c, scheme, recorder, ec, renewal.Add(time.Hour)))
+		assert.Equal(t, &metav1.Time{Time: renewal}, ec.Status.CertificatesRenewalTime)
+	})
+
+	t.Run("CA renewal", func(t *testing.T) {
+		renewal := now.Add(7 * 365 * 24 * time.Hour)
+		assert.NoError(t, reconcileCertificates(ctx, c, scheme, recorder, ec, renewal))
+		renewedCA := getTestSecret(t, c, "etcd-ca")
+		assert.NotEqual(t, caSecret.Data[corev1.TLSCertKey], renewedCA.Data[corev1.TLSCertKey])
+		assert.Equal(t, caSecret.Data[corev1.TLSPrivateKeyKey], renewedCA.Data[corev1.TLSPrivateKeyKey])
+		assert.Equal(t, renewedCA.Data[corev1.TLSCertKey], getTestSecret(t, c, "etcd-peer-tls").Data[corev1.ServiceAccountRootCAKey])
+		assert.Equal(t, renewedCA.Data[corev1.TLSCertKey], getTestSecret(t, c, "etcd-client-tls").Data[corev1.ServiceAccountRootCAKey])
+		assert.Equal(t, &metav1.Time{Time: renewal}, ec.Status.CertificatesRenewalTime)
+	})
+
+	t.Run("invalid CA", func(t *testing.T) {
+		caSecret := getTestSecret(t, c, "etcd-ca")
+		caSecret.Data[corev1.TLSPrivateKeyKey] = []byte("not a key")
+		assert.NoError(t, c.Update(ctx, caSecret))
+		err := reconcileCertificates(ctx, c, scheme, recorder, ec, now)
+		assert.ErrorContains(t, err, "invalid CA in Secret etcd-ca")
+	})
+}
@@ -0,0 +1,356 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// awsCLIImage reaches the snapshots in S3, the etcd image has no shell.
+	awsCLIImage = "amazon/aws-cli:2.22.35"
+	// gcloudImage reaches the snapshots in Google Cloud Storage.
+	gcloudImage = "gcr.io/google.com/cloudsdktool/google-cloud-cli:502.0.0-slim"
+	// azureCLIImage reaches the snapshots in Azure Blob Storage.
+	azureCLIImage = "mcr.microsoft.com/azure-cli:2.67.0"
+
+	// gcsCredentialsDir is where the key of the GCS service account is
+	// mounted in the Jobs reaching the snapshots.
+	gcsCredentialsDir = "/var/run/secrets/gcs"
+
+	// snapshotVolumeDir is where the volume, or the directory of the node,
+	// holding the snapshots is mounted in the Jobs reaching them.
+	snapshotVolumeDir = "/snapshots"
+
+	// azureWorkloadIdentityLabel makes the webhook of Azure Workload Identity
+	// inject the federated token of the ServiceAccount into a Pod.
+	azureWorkloadIdentityLabel = "azure.workload.identity/use"
+
+	// The scripts upload the snapshot at $SNAPSHOT, and write its size to the
+	// termination message; fetch it to /snapshot/snapshot.db; or delete it.
+	// The S3 ones go through the endpoint of the bucket when it has one.
+	s3UploadScript = `set -e
+aws s3 cp "$SNAPSHOT" "s3://${BUCKET}/${KEY}" ${ENDPOINT:+--endpoint-url "$ENDPOINT"}
+stat -c %s "$SNAPSHOT" > /dev/termination-log
+`
+	s3FetchScript  = `aws s3 cp "s3://${BUCKET}/${KEY}" /snapshot/snapshot.db ${ENDPOINT:+--endpoint-url "$ENDPOINT"}`
+	s3DeleteScript = `aws s3 rm "s3://${BUCKET}/${KEY}" ${ENDPOINT:+--endpoint-url "$ENDPOINT"}`
+
+	// gcsLogin authenticates with the key of the service account when it is
+	// mounted, and otherwise through the workload identity of GKE.
+	gcsLogin = `set -e
+[ ! -f /var/run/secrets/gcs/key.json ] || gcloud auth activate-service-account --key-file=/var/run/secrets/gcs/key.json
+`
+	gcsUploadScript = gcsLogin + `gcloud storage cp "$SNAPSHOT" "gs://${BUCKET}/${OBJECT}"
+stat -c %s "$SNAPSHOT" > /dev/termination-log
+`
+	gcsFetchScript  = gcsLogin + `gcloud storage cp "gs://${BUCKET}/${OBJECT}" /snapshot/snapshot.db`
+	gcsDeleteScript = gcsLogin + `gcloud storage rm "gs://${BUCKET}/${OBJECT}"`
+
+	// azureLogin authenticates with the access key of the storage account
+	// when it is set, and otherwise with the federated token of Azure
+	// Workload Identity.
+	azureLogin = `set -e
+if [ -z "$AZURE_STORAGE_KEY" ]; then
+  az login --service-principal --username "$AZURE_CLIENT_ID" --tenant "$AZURE_TENANT_ID" \
+    --federated-token "$(cat "$AZURE_FEDERATED_TOKEN_FILE")" --allow-no-subscriptions > /dev/null
+  AUTH_MODE=login
+fi
+`
+	azureUploadScript = azureLogin + `az storage blob upload --container-name "$CONTAINER" --name "$BLOB" --file "$SNAPSHOT" --overwrite ${AUTH_MODE:+--auth-mode "$AUTH_MODE"} > /dev/null
+stat -c %s "$SNAPSHOT" > /dev/termination-log
+`
+	azureFetchScript  = azureLogin + `az storage blob download --container-name "$CONTAINER" --name "$BLOB" --file /snapshot/snapshot.db ${AUTH_MODE:+--auth-mode "$AUTH_MODE"} > /dev/null`
+	azureDeleteScript = azureLogin + `az storage blob delete --container-name "$CONTAINER" --name "$BLOB" ${AUTH_MODE:+--auth-mode "$AUTH_MODE"}`
+
+	// The volume ones copy the snapshot at $FILE in the volume mounted at
+	// snapshotVolumeDir, creating its directory.
+	volumeUploadScript = `set -e
+mkdir -p "$(dirname "/snapshots/${FILE}")"
+cp "$SNAPSHOT" "/snapshots/${FILE}"
+stat -c %s "$SNAPSHOT" > /dev/termination-log
+`
+	volumeFetchScript  = `cp "/snapshots/${FILE}" /snapshot/snapshot.db`
+	volumeDeleteScript = `rm -f "/snapshots/${FILE}"`
+)
+
+// storageOp is what a container does with a snapshot in its storage.
+type storageOp int
+
+const (
+	// uploadSnapshot uploads the snapshot at $SNAPSHOT.
+	uploadSnapshot storageOp = iota
+	// fetchSnapshot downloads the snapshot to /snapshot/snapshot.db.
+	fetchSnapshot
+	// deleteSnapshot deletes the snapshot.
+	deleteSnapshot
+)
+
+// snapshotStorage is where a snapshot is stored, in the destination of one
+// of the storage providers. Exactly one of s3, gcs, azure, pvc and hostPath
+// is set.
+type snapshotStorage struct {
+	s3       *ecv1alpha1.S3BackupDestination
+	gcs      *ecv1alpha1.GCSBackupDestination
+	azure    *ecv1alpha1.AzureBackupDestination
+	pvc      *ecv1alpha1.PVCBackupDestination
+	hostPath *ecv1alpha1.HostPathBackupDestination
+	// name is the name of the snapshot: its S3 key, GCS object, Azure blob,
+	// or its path in the volume or the directory.
+	name string
+}
+
+// backupStorage returns where the snapshot of backup is stored. It reports
+// false when backup has no destination for its storage provider.
+func backupStorage(backup *ecv1alpha1.EtcdBackup) (snapshotStorage, bool) {
+	spec := backup.Spec
+	name := backup.DefaultSnapshotName()
+	switch spec.StorageProvider {
+	case ecv1alpha1.StorageProviderGCS:
+		if spec.GCS == nil {
+			return snapshotStorage{}, false
+		}
+		if spec.GCS.Object != "" {
+			name = spec.GCS.Object
+		}
+		return snapshotStorage{gcs: spec.GCS, name: name}, true
+	case ecv1alpha1.StorageProviderAzure:
+		if spec.Azure == nil {
+			return snapshotStorage{}, false
+		}
+		if spec.Azure.Blob != "" {
+			name = spec.Azure.Blob
+		}
+		return snapshotStorage{azure: spec.Azure, name: name}, true
+	case ecv1alpha1.StorageProviderPVC:
+		if spec.PVC == nil {
+			return snapshotStorage{}, false
+		}
+		if spec.PVC.Path != "" {
+			name = spec.PVC.Path
+		}
+		return snapshotStorage{pvc: spec.PVC, name: name}, true
+	case ecv1alpha1.StorageProviderHostPath:
+		if spec.HostPath == nil {
+			return snapshotStorage{}, false
+		}
+		if spec.HostPath.Path != "" {
+			name = spec.HostPath.Path
+		}
+		return snapshotStorage{hostPath: spec.HostPath, name: name}, true
+	default:
+		if spec.S3 == nil {
+			return snapshotStorage{}, false
+		}
+		if spec.S3.Key != "" {
+			name = spec.S3.Key
+		}
+		return snapshotStorage{s3: spec.S3, name: name}, true
+	}
+}
+
+// restoreStorage returns where the snapshot of source is stored. It reports
+// false when source is in a PersistentVolumeClaim, the restore Job reads
+// it from the volume itself.
+func restoreStorage(source ecv1alpha1.RestoreSource) (snapshotStorage, bool) {
+	switch {
+	case source.S3 != nil:
+		return snapshotStorage{s3: &ecv1alpha1.S3BackupDestination{
+			Bucket:               source.S3.Bucket,
+			Region:               source.S3.Region,
+			Endpoint:             source.S3.Endpoint,
+			CredentialsSecretRef: source.S3.CredentialsSecretRef,
+		}, name: source.S3.Key}, true
+	case source.GCS != nil:
+		return snapshotStorage{gcs: &ecv1alpha1.GCSBackupDestination{
+			Bucket:               source.GCS.Bucket,
+			CredentialsSecretRef: source.GCS.CredentialsSecretRef,
+		}, name: source.GCS.Object}, true
+	case source.Azure != nil:
+		return snapshotStorage{azure: &ecv1alpha1.AzureBackupDestination{
+			StorageAccount:       source.Azure.StorageAccount,
+			Container:            source.Azure.Container,
+			CredentialsSecretRef: source.Azure.CredentialsSecretRef,
+		}, name: source.Azure.Blob}, true
+	case source.HostPath != nil:
+		return snapshotStorage{hostPath: &ecv1alpha1.HostPathBackupDestination{
+			NodeName:  source.HostPath.NodeName,
+			Directory: source.HostPath.Directory,
+		}, name: source.HostPath.Path}, true
+	}
+	return snapshotStorage{}, false
+}
+
+// checkRestoreSource returns why the operator refuses to read the snapshot
+// of source, or nil, see snapshotStorage.check.
+func checkRestoreSource(source ecv1alpha1.RestoreSource, hostPathDirs []string) error {
+	if storage, ok := restoreStorage(source); ok {
+		return storage.check(hostPathDirs)
+	}
+	if source.PVC != nil && source.PVC.Path != "" {
+		return checkSnapshotPath(source.PVC.Path)
+	}
+	return nil
+}
+
+// check returns why the operator refuses to reach s, or nil: the path of a
+// snapshot in a volume or a directory of a node must not reach out of it,
+// and the directory must be one of hostPathDirs, or in one of them, as the
+// Jobs reach it as root. The CRDs reject the same paths, this holds for the
+// objects created before they did.
+func (s snapshotStorage) check(hostPathDirs []string) error {
+	if s.pvc == nil && s.hostPath == nil {
+		return nil
+	}
+	if err := checkSnapshotPath(s.name); err != nil {
+		return err
+	}
+	if s.hostPath == nil {
+		return nil
+	}
+	dir := s.hostPath.Directory
+	if !path.IsAbs(dir) || slices.Contains(strings.Split(dir, "/"), "..") {
+		return fmt.Errorf("the directory %q must be an absolute path without .. segments", dir)
+	}
+	for _, allowed := range hostPathDirs {
+		if rel, err := filepath.Rel(allowed, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return nil
+		}
+	}
+	return fmt.Errorf("the directory %s of the nodes isn't allowed by the --backup-host-path-dirs flag of the operator", dir)
+}
+
+// checkSnapshotPath returns why the path of a snapshot in a volume or a
+// directory of a node reaches out of it, or nil.
+func checkSnapshotPath(name string) error {
+	if path.IsAbs(name) || slices.Contains(strings.Split(name, "/"), "..") {
+		return fmt.Errorf("the path %q of the snapshot must be relative, without .. segments", name)
+	}
+	return nil
+}
+
+// location returns the URL of the snapshot.
+func (s snapshotStorage) location() string {
+	switch {
+	case s.gcs != nil:
+		return fmt.Sprintf("gs://%s/%s", s.gcs.Bucket, s.name)
+	case s.azure != nil:
+		return fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", s.azure.StorageAccount, s.azure.Container, s.name)
+	case s.pvc != nil:
+		return fmt.Sprintf("pvc://%s/%s", s.pvc.ClaimName, s.name)
+	case s.hostPath != nil:
+		return fmt.Sprintf("file://%s%s", s.hostPath.NodeName, path.Join(s.hostPath.Directory, s.name))
+	}
+	return fmt.Sprintf("s3://%s/%s", s.s3.Bucket, s.name)
+}
+
+// container returns the container doing op on the snapshot, with mounts.
+func (s snapshotStorage) container(name string, op storageOp, mounts ...corev1.VolumeMount) corev1.Container {
+	c := corev1.Container{Name: name, VolumeMounts: slices.Clone(mounts)}
+	var scripts [3]string
+	switch {
+	case s.gcs != nil:
+		c.Image = gcloudImage
+		scripts = [3]string{gcsUploadScript, gcsFetchScript, gcsDeleteScript}
+		c.Env = []corev1.EnvVar{
+			{Name: "BUCKET", Value: s.gcs.Bucket},
+			{Name: "OBJECT", Value: s.name},
+		}
+		if s.gcs.CredentialsSecretRef != nil {
+			c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{Name: "gcs-credentials", MountPath: gcsCredentialsDir, ReadOnly: true})
+		}
+	case s.azure != nil:
+		c.Image = azureCLIImage
+		scripts = [3]string{azureUploadScript, azureFetchScript, azureDeleteScript}
+		c.Env = []corev1.EnvVar{
+			{Name: "AZURE_STORAGE_ACCOUNT", Value: s.azure.StorageAccount},
+			{Name: "CONTAINER", Value: s.azure.Container},
+			{Name: "BLOB", Value: s.name},
+		}
+		if s.azure.CredentialsSecretRef != nil {
+			c.Env = append(c.Env, corev1.EnvVar{
+				Name: "AZURE_STORAGE_KEY",
+				ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: *s.azure.CredentialsSecretRef,
+					Key:                  "AZURE_STORAGE_KEY",
+				}},
+			})
+		}
+	case s.pvc != nil, s.hostPath != nil:
+		c.Image = busyboxImage
+		scripts = [3]string{volumeUploadScript, volumeFetchScript, volumeDeleteScript}
+		c.Env = []corev1.EnvVar{{Name: "FILE", Value: s.name}}
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{Name: "snapshots", MountPath: snapshotVolumeDir})
+	default:
+		c.Image = awsCLIImage
+		scripts = [3]string{s3UploadScript, s3FetchScript, s3DeleteScript}
+		c.Env = s3Env(*s.s3, s.name)
+	}
+	c.Command = []string{"/bin/sh", "-c", scripts[op]}
+	return c
+}
+
+// configurePod gives template what the containers of s.container need to
+// authenticate to the storage, or to mount it. The Pods of a HostPath
+// storage are scheduled to its node.
+func (s snapshotStorage) configurePod(template *corev1.PodTemplateSpec) {
+	switch {
+	case s.pvc != nil:
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{Name: "snapshots", VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: s.pvc.ClaimName},
+		}})
+	case s.hostPath != nil:
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{Name: "snapshots", VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: s.hostPath.Directory, Type: ptr.To(corev1.HostPathDirectory)},
+		}})
+		template.Spec.NodeSelector = maps.Clone(template.Spec.NodeSelector)
+		if template.Spec.NodeSelector == nil {
+			template.Spec.NodeSelector = map[string]string{}
+		}
+		template.Spec.NodeSelector[corev1.LabelHostname] = s.hostPath.NodeName
+	case s.gcs != nil && s.gcs.CredentialsSecretRef != nil:
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{Name: "gcs-credentials", VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: s.gcs.CredentialsSecretRef.Name},
+		}})
+	case s.azure != nil && s.azure.CredentialsSecretRef == nil:
+		// The labels of the template may be shared with the Job.
+		template.Labels = maps.Clone(template.Labels)
+		if template.Labels == nil {
+			template.Labels = map[string]string{}
+		}
+		template.Labels[azureWorkloadIdentityLabel] = "true"
+	}
+}
+
+// s3Env returns the environment of the AWS CLI reaching the snapshot at key
+// in the bucket of s3, at s3://${BUCKET}/${KEY}.
+func s3Env(s3 ecv1alpha1.S3BackupDestination, key string) []corev1.EnvVar {
+	secretEnv := func(name string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: s3.CredentialsSecretRef,
+				Key:                  name,
+			}},
+		}
+	}
+	env := []corev1.EnvVar{
+		{Name: "BUCKET", Value: s3.Bucket},
+		{Name: "KEY", Value: key},
+		{Name: "ENDPOINT", Value: s3.Endpoint},
+		secretEnv("AWS_ACCESS_KEY_ID"),
+		secretEnv("AWS_SECRET_ACCESS_KEY"),
+	}
+	if s3.Region != "" {
+		env = append(env, corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: s3.Region})
+	}
+	return env
+}
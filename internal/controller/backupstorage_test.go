@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestBackupStorage(t *testing.T) {
+	backup := newTestBackup()
+	storage, ok := backupStorage(backup)
+	assert.True(t, ok)
+	assert.Equal(t, "s3://etcd-backups/default/etcd/nightly.db", storage.location())
+
+	backup.Spec.StorageProvider = ecv1alpha1.StorageProviderGCS
+	_, ok = backupStorage(backup)
+	assert.False(t, ok)
+
+	backup.Spec.S3 = nil
+	backup.Spec.GCS = &ecv1alpha1.GCSBackupDestination{Bucket: "etcd-backups", Object: "etcd/latest.db"}
+	storage, ok = backupStorage(backup)
+	assert.True(t, ok)
+	assert.Equal(t, "gs://etcd-backups/etcd/latest.db", storage.location())
+
+	backup.Spec.StorageProvider = ecv1alpha1.StorageProviderAzure
+	backup.Spec.GCS = nil
+	backup.Spec.Azure = &ecv1alpha1.AzureBackupDestination{StorageAccount: "etcdbackups", Container: "snapshots"}
+	storage, ok = backupStorage(backup)
+	assert.True(t, ok)
+	assert.Equal(t, "https://etcdbackups.blob.core.windows.net/snapshots/default/etcd/nightly.db", storage.location())
+
+	backup.Spec.StorageProvider = ecv1alpha1.StorageProviderPVC
+	backup.Spec.Azure = nil
+	backup.Spec.PVC = &ecv1alpha1.PVCBackupDestination{ClaimName: "etcd-backups"}
+	storage, ok = backupStorage(backup)
+	assert.True(t, ok)
+	assert.Equal(t, "pvc://etcd-backups/default/etcd/nightly.db", storage.location())
+
+	backup.Spec.StorageProvider = ecv1alpha1.StorageProviderHostPath
+	backup.Spec.PVC = nil
+	backup.Spec.HostPath = &ecv1alpha1.HostPathBackupDestination{NodeName: "node-1", Directory: "/var/backups/etcd", Path: "latest.db"}
+	storage, ok = backupStorage(backup)
+	assert.True(t, ok)
+	assert.Equal(t, "file://node-1/var/backups/etcd/latest.db", storage.location())
+}
+
+func TestSnapshotStorageCheck(t *testing.T) {
+	hostPathDirs := []string{"/var/backups", "/mnt/etcd"}
+	pvc := func(name string) snapshotStorage {
+		return snapshotStorage{pvc: &ecv1alpha1.PVCBackupDestination{ClaimName: "etcd-backups"}, name: name}
+	}
+	hostPath := func(dir, name string) snapshotStorage {
+		return snapshotStorage{hostPath: &ecv1alpha1.HostPathBackupDestination{NodeName: "node-1", Directory: dir}, name: name}
+	}
+	tests := []struct {
+		name    string
+		storage snapshotStorage
+		wantErr string
+	}{
+		{name: "object", storage: snapshotStorage{s3: &ecv1alpha1.S3BackupDestination{Bucket: "etcd-backups"}, name: "/../etcd.db"}},
+		{name: "volume", storage: pvc("default/etcd/nightly.db")},
+		{name: "absolute path in a volume", storage: pvc("/default/etcd/nightly.db"), wantErr: "must be relative"},
+		{name: "path out of a volume", storage: pvc("default/../../etcd.db"), wantErr: "must be relative"},
+		{name: "allowed directory", storage: hostPath("/var/backups", "etcd.db")},
+		{name: "subdirectory of an allowed directory", storage: hostPath("/mnt/etcd/snapshots/", "default/etcd.db")},
+		{name: "path out of a directory", storage: hostPath("/var/backups", "../../etc/passwd"), wantErr: "must be relative"},
+		{name: "directory out of an allowed directory", storage: hostPath("/var/backups/../../etc", "etcd.db"), wantErr: "without .. segments"},
+		{name: "directory next to an allowed directory", storage: hostPath("/var/backups-2", "etcd.db"), wantErr: "isn't allowed"},
+		{name: "parent of an allowed directory", storage: hostPath("/var", "backups/etcd.db"), wantErr: "isn't allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.storage.check(hostPathDirs)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	// No directory is allowed by default.
+	assert.ErrorContains(t, hostPath("/var/backups", "etcd.db").check(nil), "--backup-host-path-dirs")
+
+	assert.NoError(t, checkRestoreSource(ecv1alpha1.RestoreSource{PVC: &ecv1alpha1.PVCSnapshotSource{ClaimName: "etcd-backups"}}, nil))
+	assert.ErrorContains(t, checkRestoreSource(ecv1alpha1.RestoreSource{
+		PVC: &ecv1alpha1.PVCSnapshotSource{ClaimName: "etcd-backups", Path: "../snapshot.db"},
+	}, nil), "must be relative")
+	assert.ErrorContains(t, checkRestoreSource(ecv1alpha1.RestoreSource{
+		HostPath: &ecv1alpha1.HostPathSnapshotSource{NodeName: "node-1", Directory: "/etc", Path: "snapshot.db"},
+	}, hostPathDirs), "isn't allowed")
+}
+
+func TestSnapshotStorageContainer(t *testing.T) {
+	mounts := []corev1.VolumeMount{{Name: "backup", MountPath: "/backup"}}
+
+	gcs := snapshotStorage{gcs: &ecv1alpha1.GCSBackupDestination{
+		Bucket:               "etcd-backups",
+		CredentialsSecretRef: &corev1.LocalObjectReference{Name: "etcd-backup-gcs"},
+	}, name: "etcd.db"}
+	c := gcs.container("upload", uploadSnapshot, mounts...)
+	assert.Equal(t, gcloudImage, c.Image)
+	assert.Equal(t, gcsUploadScript, c.Command[2])
+	assert.Contains(t, c.Env, corev1.EnvVar{Name: "OBJECT", Value: "etcd.db"})
+	assert.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: "gcs-credentials", MountPath: gcsCredentialsDir, ReadOnly: true})
+	assert.Len(t, mounts, 1)
+	template := &corev1.PodTemplateSpec{}
+	gcs.configurePod(template)
+	assert.Equal(t, "etcd-backup-gcs", template.Spec.Volumes[0].Secret.SecretName)
+
+	// Without a key, the Pod authenticates with the workload identity of GKE.
+	gcs.gcs.CredentialsSecretRef = nil
+	assert.Len(t, gcs.container("prune", deleteSnapshot).VolumeMounts, 0)
+	template = &corev1.PodTemplateSpec{}
+	gcs.configurePod(template)
+	assert.Empty(t, template.Spec.Volumes)
+
+	azure := snapshotStorage{azure: &ecv1alpha1.AzureBackupDestination{
+		StorageAccount:       "etcdbackups",
+		Container:            "snapshots",
+		CredentialsSecretRef: &corev1.LocalObjectReference{Name: "etcd-backup-azure"},
+	}, name: "etcd.db"}
+	c = azure.container("fetch", fetchSnapshot)
+	assert.Equal(t, azureCLIImage, c.Image)
+	assert.Equal(t, azureFetchScript, c.Command[2])
+	assert.Contains(t, c.Env, corev1.EnvVar{Name: "AZURE_STORAGE_ACCOUNT", Value: "etcdbackups"})
+	assert.Equal(t, "etcd-backup-azure", c.Env[3].ValueFrom.SecretKeyRef.Name)
+	template = &corev1.PodTemplateSpec{}
+	azure.configurePod(template)
+	assert.Empty(t, template.Labels)
+
+	// Without an access key, the Pod authenticates with Azure Workload Identity.
+	azure.azure.CredentialsSecretRef = nil
+	assert.Len(t, azure.container("fetch", fetchSnapshot).Env, 3)
+	azure.configurePod(template)
+	assert.Equal(t, "true", template.Labels[azureWorkloadIdentityLabel])
+
+	pvc := snapshotStorage{pvc: &ecv1alpha1.PVCBackupDestination{ClaimName: "etcd-backups"}, name: "etcd.db"}
+	c = pvc.container("upload", uploadSnapshot, mounts...)
+	assert.Equal(t, busyboxImage, c.Image)
+	assert.Equal(t, volumeUploadScript, c.Command[2])
+	assert.Contains(t, c.Env, corev1.EnvVar{Name: "FILE", Value: "etcd.db"})
+	assert.Contains(t, c.VolumeMounts, corev1.VolumeMount{Name: "snapshots", MountPath: snapshotVolumeDir})
+	template = &corev1.PodTemplateSpec{}
+	pvc.configurePod(template)
+	assert.Equal(t, "etcd-backups", template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	assert.Empty(t, template.Spec.NodeSelector)
+
+	// The Pods of a HostPath storage run on its node.
+	hostPath := snapshotStorage{hostPath: &ecv1alpha1.HostPathBackupDestination{NodeName: "node-1", Directory: "/var/backups/etcd"}, name: "etcd.db"}
+	assert.Equal(t, volumeDeleteScript, hostPath.container("prune", deleteSnapshot).Command[2])
+	template = &corev1.PodTemplateSpec{}
+	hostPath.configurePod(template)
+	assert.Equal(t, "/var/backups/etcd", template.Spec.Volumes[0].HostPath.Path)
+	assert.Equal(t, corev1.HostPathDirectory, *template.Spec.Volumes[0].HostPath.Type)
+	assert.Equal(t, map[string]string{corev1.LabelHostname: "node-1"}, template.Spec.NodeSelector)
+}
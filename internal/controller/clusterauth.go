@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// rootUser is the etcd user the operator authenticates with once the
+// authentication of a cluster is enabled.
+const rootUser = "root"
+
+// authEnabled reports whether the authentication of ec must be enabled.
+func authEnabled(ec *ecv1alpha1.EtcdCluster) bool {
+	return ec.Spec.Auth != nil && ec.Spec.Auth.Enabled
+}
+
+// rootSecretName returns the name of the Secret holding the password of the
+// root user of ec.
+func rootSecretName(ec *ecv1alpha1.EtcdCluster) string {
+	return ec.Name + "-root"
+}
+
+// newRootSecret returns the Secret of the root user of ec, with a random
+// password.
+func newRootSecret(ec *ecv1alpha1.EtcdCluster) (*corev1.Secret, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      rootSecretName(ec),
+			Namespace: ec.Namespace,
+			Labels: map[string]string{
+				"app":       ec.Name,
+				"component": "root",
+			},
+		},
+		Type: corev1.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte(rootUser),
+			corev1.BasicAuthPasswordKey: []byte(base64.RawURLEncoding.EncodeToString(b)),
+		},
+	}, nil
+}
+
+// clusterCredentials returns the credentials the operator authenticates to
+// ec with, read from its root Secret in the Kubernetes cluster of c. There are
+// none until the root Secret is created, and once it is deleted.
+func clusterCredentials(ctx context.Context, c client.Reader, ec *ecv1alpha1.EtcdCluster) (*etcdutils.Credentials, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Name: rootSecretName(ec), Namespace: ec.Namespace}, secret); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if !isControlledBy(secret, ec) {
+		return nil, nil
+	}
+	return &etcdutils.Credentials{
+		Username: string(secret.Data[corev1.BasicAuthUsernameKey]),
+		Password: string(secret.Data[corev1.BasicAuthPasswordKey]),
+	}, nil
+}
+
+// reconcileRootSecret creates the root Secret of ec, alongside its TLS
+// Secrets, when its authentication is enabled, and returns the credentials
+// of the operator. The Secret is kept once the authentication is turned off,
+// until reconcileAuth disabled it.
+func reconcileRootSecret(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster) (*etcdutils.Credentials, error) {
+	creds, err := clusterCredentials(ctx, c, ec)
+	if err != nil || creds != nil || !authEnabled(ec) {
+		return creds, err
+	}
+
+	secret, err := newRootSecret(ec)
+	if err != nil {
+		return nil, err
+	}
+	if err := setWorkloadOwner(ec, scheme, secret); err != nil {
+		return nil, err
+	}
+	// An existing Secret that isn't controlled by ec is reported rather than
+	// overwritten.
+	if err := applyOwnedObject(ctx, c, recorder, ec, secret); err != nil {
+		return nil, err
+	}
+	return clusterCredentials(ctx, c, ec)
+}
+
+// reconcileAuth enables the authentication of ec with creds, or disables it
+// and deletes the root Secret once it is turned off. It must be called once
+// the members of ec are healthy.
+func reconcileAuth(ctx context.Context, logger logr.Logger, c client.Client, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, etcdClient *etcdutils.ClusterClient, eps []string, creds *etcdutils.Credentials) error {
+	if creds == nil {
+		return nil
+	}
+	if authEnabled(ec) {
+		enabled, err := etcdClient.EnableAuth(eps, creds.Username, creds.Password)
+		if err != nil {
+			recorder.Event(ec, corev1.EventTypeWarning, "AuthEnableFailed", err.Error())
+			return err
+		}
+		if enabled {
+			logger.Info("Enabled the authentication")
+			recorder.Eventf(ec, corev1.EventTypeNormal, "AuthEnabled", "Enabled the authentication, the root password is in the Secret %s", rootSecretName(ec))
+		}
+		return nil
+	}
+
+	disabled, err := etcdClient.DisableAuth(eps)
+	if err != nil {
+		recorder.Event(ec, corev1.EventTypeWarning, "AuthDisableFailed", err.Error())
+		return err
+	}
+	if disabled {
+		logger.Info("Disabled the authentication")
+		recorder.Event(ec, corev1.EventTypeNormal, "AuthDisabled", "Disabled the authentication")
+	}
+	secret := &corev1.Secret{}
+	err = c.Get(ctx, client.ObjectKey{Name: rootSecretName(ec), Namespace: ec.Namespace}, secret)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !isControlledBy(secret, ec) {
+		return nil
+	}
+	if err := c.Delete(ctx, secret); err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// addRootCredentials makes etcdctl, run by container, authenticate as the
+// root user of ec when its authentication is enabled.
+func addRootCredentials(ec *ecv1alpha1.EtcdCluster, container *corev1.Container) {
+	if !authEnabled(ec) {
+		return
+	}
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "ETCDCTL_USER", Value: rootUser},
+		corev1.EnvVar{Name: "ETCDCTL_PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: rootSecretName(ec)},
+			Key:                  corev1.BasicAuthPasswordKey,
+		}}},
+	)
+}
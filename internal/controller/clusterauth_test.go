@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestReconcileRootSecret(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default", UID: "ec-uid"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Size: 3},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).
+		WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	recorder := record.NewFakeRecorder(10)
+	key := types.NamespacedName{Name: "test-etcd-root", Namespace: "default"}
+
+	// Without authentication, there are no credentials.
+	creds, err := reconcileRootSecret(ctx, fakeClient, scheme, recorder, ec)
+	assert.NoError(t, err)
+	assert.Nil(t, creds)
+	assert.True(t, k8serrors.IsNotFound(fakeClient.Get(ctx, key, &corev1.Secret{})))
+
+	// The root password is generated once.
+	ec.Spec.Auth = &ecv1alpha1.Authentication{Enabled: true}
+	creds, err = reconcileRootSecret(ctx, fakeClient, scheme, recorder, ec)
+	assert.NoError(t, err)
+	assert.Equal(t, "root", creds.Username)
+	assert.Len(t, creds.Password, 32)
+	secret := &corev1.Secret{}
+	assert.NoError(t, fakeClient.Get(ctx, key, secret))
+	assert.True(t, metav1.IsControlledBy(secret, ec))
+	assert.Equal(t, corev1.SecretTypeBasicAuth, secret.Type)
+	again, err := reconcileRootSecret(ctx, fakeClient, scheme, recorder, ec)
+	assert.NoError(t, err)
+	assert.Equal(t, creds, again)
+
+	// The credentials are kept until the authentication is disabled.
+	ec.Spec.Auth.Enabled = false
+	again, err = reconcileRootSecret(ctx, fakeClient, scheme, recorder, ec)
+	assert.NoError(t, err)
+	assert.Equal(t, creds, again)
+
+	// Without credentials, there is nothing to enable nor disable.
+	assert.NoError(t, reconcileAuth(ctx, logr.Discard(), fakeClient, recorder, ec, nil, nil, nil))
+}
+
+func TestAddRootCredentials(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"}}
+	container := &corev1.Container{}
+	addRootCredentials(ec, container)
+	assert.Empty(t, container.Env)
+
+	ec.Spec.Auth = &ecv1alpha1.Authentication{Enabled: true}
+	addRootCredentials(ec, container)
+	assert.Equal(t, corev1.EnvVar{Name: "ETCDCTL_USER", Value: "root"}, container.Env[0])
+	assert.Equal(t, "ETCDCTL_PASSWORD", container.Env[1].Name)
+	assert.Equal(t, "test-etcd-root", container.Env[1].ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, corev1.BasicAuthPasswordKey, container.Env[1].ValueFrom.SecretKeyRef.Key)
+}
@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+const (
+	reasonMembersHealthy    = "MembersHealthy"
+	reasonHealthCheckFailed = "HealthCheckFailed"
+	reasonPausedAnnotation  = "PausedAnnotation"
+	reasonReconciling       = "Reconciling"
+	reasonValidationFailed  = "ValidationFailed"
+	reasonSpecValid         = "SpecValid"
+
+	reasonUpgradeInProgress  = "UpgradeInProgress"
+	reasonUpgradeCompleted   = "UpgradeCompleted"
+	reasonUpgradeUnsupported = "UpgradeUnsupported"
+
+	reasonLeaderElected  = "LeaderElected"
+	reasonNoLeader       = "NoLeader"
+	reasonSingleMember   = "SingleMember"
+	reasonElectingLeader = "ElectingLeader"
+
+	reasonExpansionInProgress  = "ExpansionInProgress"
+	reasonExpansionUnsupported = "ExpansionUnsupported"
+	reasonVolumesExpanded      = "VolumesExpanded"
+
+	reasonPersistentStorage = "PersistentStorage"
+	reasonEphemeralStorage  = "EphemeralStorage"
+	reasonNoStorage         = "NoStorage"
+
+	reasonUpToDate         = "UpToDate"
+	reasonNoMemberToAdd    = "NoMemberToAdd"
+	reasonNoMemberToRemove = "NoMemberToRemove"
+)
+
+// setAvailableCondition records in the Available condition of ec whether its
+// members have a leader, from healthInfos, the result of their health check,
+// or healthErr, the error of the health check.
+func setAvailableCondition(ec *ecv1alpha1.EtcdCluster, healthInfos []etcdutils.EpHealth, healthErr error) {
+	condition := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionAvailable,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: ec.Generation,
+		Reason:             reasonLeaderElected,
+		Message:            "The members have a leader and serve requests",
+	}
+	if !slices.ContainsFunc(healthInfos, hasLeader) {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonNoLeader
+		condition.Message = "None of the members has a leader"
+		if healthErr != nil {
+			condition.Message += ": " + healthErr.Error()
+		}
+	}
+
+	meta.SetStatusCondition(&ec.Status.Conditions, condition)
+}
+
+// setProgressConditions records in the Progressing, ScalingUp and
+// ScalingDown conditions of ec the actions planned to move its members
+// towards its spec, as recorded in its status. The reason of a True
+// condition is the type of the first action it covers.
+func setProgressConditions(ec *ecv1alpha1.EtcdCluster) {
+	progressing := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionProgressing,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec.Generation,
+		Reason:             reasonUpToDate,
+		Message:            "The members match the spec",
+	}
+	scalingUp := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionScalingUp,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec.Generation,
+		Reason:             reasonNoMemberToAdd,
+		Message:            "The cluster has at least spec.size members",
+	}
+	scalingDown := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionScalingDown,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec.Generation,
+		Reason:             reasonNoMemberToRemove,
+		Message:            "The cluster has at most spec.size members",
+	}
+
+	var descriptions []string
+	for _, action := range ec.Status.PlannedActions {
+		descriptions = append(descriptions, action.Description)
+		switch action.Type {
+		case actionCreateStatefulSet, actionScaleOut:
+			scalingUp.Status, scalingUp.Reason, scalingUp.Message = metav1.ConditionTrue, action.Type, action.Description
+		case actionScaleIn:
+			scalingDown.Status, scalingDown.Reason, scalingDown.Message = metav1.ConditionTrue, action.Type, action.Description
+		}
+	}
+	if len(ec.Status.PlannedActions) > 0 {
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = ec.Status.PlannedActions[0].Type
+		progressing.Message = strings.Join(descriptions, "; ")
+	}
+
+	meta.SetStatusCondition(&ec.Status.Conditions, progressing)
+	meta.SetStatusCondition(&ec.Status.Conditions, scalingUp)
+	meta.SetStatusCondition(&ec.Status.Conditions, scalingDown)
+}
+
+// setDegradedCondition records the outcome of the members health check,
+// healthErr, in the Degraded condition of ec.
+func setDegradedCondition(ec *ecv1alpha1.EtcdCluster, healthErr error) {
+	condition := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec.Generation,
+		Reason:             reasonMembersHealthy,
+		Message:            "All members are healthy",
+	}
+	if healthErr != nil {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonHealthCheckFailed
+		condition.Message = healthErr.Error()
+	}
+
+	meta.SetStatusCondition(&ec.Status.Conditions, condition)
+}
+
+// setPausedCondition records in the Paused condition of ec whether its
+// reconciliation is paused.
+func setPausedCondition(ec *ecv1alpha1.EtcdCluster, paused bool) {
+	condition := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionPaused,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec.Generation,
+		Reason:             reasonReconciling,
+		Message:            "The cluster is being reconciled",
+	}
+	if paused {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonPausedAnnotation
+		condition.Message = fmt.Sprintf("The reconciliation is paused by the %s annotation", ecv1alpha1.PausedAnnotation)
+	}
+
+	meta.SetStatusCondition(&ec.Status.Conditions, condition)
+}
+
+// setSpecInvalidCondition records the validation errors of the spec of ec,
+// with their field paths, in the SpecInvalid condition.
+func setSpecInvalidCondition(ec *ecv1alpha1.EtcdCluster, errs field.ErrorList) {
+	condition := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionSpecInvalid,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec.Generation,
+		Reason:             reasonSpecValid,
+		Message:            "The spec is valid",
+	}
+	if len(errs) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonValidationFailed
+		condition.Message = errs.ToAggregate().Error()
+	}
+
+	meta.SetStatusCondition(&ec.Status.Conditions, condition)
+}
+
+// setVolumesExpandingCondition records in the VolumesExpanding condition of ec
+// the volumes of its members still being expanded to size, and those that
+// can't be.
+func setVolumesExpandingCondition(ec *ecv1alpha1.EtcdCluster, size resource.Quantity, expanding, unsupported []string) {
+	condition := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionVolumesExpanding,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec.Generation,
+		Reason:             reasonVolumesExpanded,
+		Message:            fmt.Sprintf("The volumes of the members have at least %s", size.String()),
+	}
+	var messages []string
+	if len(expanding) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonExpansionInProgress
+		messages = append(messages, fmt.Sprintf("Expanding the volumes %s to %s", strings.Join(expanding, ", "), size.String()))
+	}
+	if len(unsupported) > 0 {
+		if len(expanding) == 0 {
+			condition.Reason = reasonExpansionUnsupported
+		}
+		messages = append(messages, fmt.Sprintf("The volumes %s can't be expanded to %s, see the VolumeExpansionFailed events",
+			strings.Join(unsupported, ", "), size.String()))
+	}
+	if len(messages) > 0 {
+		condition.Message = strings.Join(messages, "; ")
+	}
+
+	meta.SetStatusCondition(&ec.Status.Conditions, condition)
+}
+
+// setEphemeralCondition records in the Ephemeral condition of ec whether its
+// members lose their data along with their pods.
+func setEphemeralCondition(ec *ecv1alpha1.EtcdCluster) {
+	condition := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionEphemeral,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec.Generation,
+		Reason:             reasonPersistentStorage,
+		Message:            "The members keep their data on persistent volumes",
+	}
+	switch {
+	case ec.Spec.EphemeralStorage != nil:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonEphemeralStorage
+		condition.Message = "The members keep their data on emptyDir volumes, lost along with their pods"
+	case ec.Spec.StorageSpec == nil:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonNoStorage
+		condition.Message = "The members keep their data in their containers, lost along with their pods"
+	}
+
+	meta.SetStatusCondition(&ec.Status.Conditions, condition)
+}
+
+// setUpgradingCondition records the progress of the upgrade of the members of
+// ec in its Upgrading condition.
+func setUpgradingCondition(ec *ecv1alpha1.EtcdCluster, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&ec.Status.Conditions, metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionUpgrading,
+		Status:             status,
+		ObservedGeneration: ec.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
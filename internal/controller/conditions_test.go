@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func TestSetDegradedCondition(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+
+	setDegradedCondition(ec, errors.New("endpoint is unhealthy"))
+	condition := meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionDegraded)
+	assert.NotNil(t, condition)
+	assert.True(t, meta.IsStatusConditionTrue(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionDegraded))
+	assert.Equal(t, reasonHealthCheckFailed, condition.Reason)
+	assert.Equal(t, "endpoint is unhealthy", condition.Message)
+
+	setDegradedCondition(ec, nil)
+	assert.True(t, meta.IsStatusConditionFalse(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionDegraded))
+}
+
+func TestSetPausedCondition(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Annotations = map[string]string{ecv1alpha1.PausedAnnotation: "true"}
+
+	assert.True(t, isPaused(ec))
+	setPausedCondition(ec, isPaused(ec))
+	assert.True(t, meta.IsStatusConditionTrue(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionPaused))
+
+	ec.Annotations[ecv1alpha1.PausedAnnotation] = "false"
+	assert.False(t, isPaused(ec))
+	setPausedCondition(ec, isPaused(ec))
+	assert.True(t, meta.IsStatusConditionFalse(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionPaused))
+}
+
+func TestSetSpecInvalidCondition(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+
+	errs := field.ErrorList{field.Invalid(field.NewPath("spec", "etcdOptions").Index(0), "--debug", "--debug was removed in etcd v3.5")}
+	setSpecInvalidCondition(ec, errs)
+	condition := meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionSpecInvalid)
+	assert.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Contains(t, condition.Message, "spec.etcdOptions[0]")
+
+	setSpecInvalidCondition(ec, nil)
+	assert.True(t, meta.IsStatusConditionFalse(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionSpecInvalid))
+}
+
+func TestSetEphemeralCondition(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+
+	setEphemeralCondition(ec)
+	condition := meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionEphemeral)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, reasonNoStorage, condition.Reason)
+
+	ec.Spec.EphemeralStorage = &ecv1alpha1.EphemeralStorage{}
+	setEphemeralCondition(ec)
+	condition = meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionEphemeral)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, reasonEphemeralStorage, condition.Reason)
+
+	ec.Spec.EphemeralStorage = nil
+	ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{}
+	setEphemeralCondition(ec)
+	assert.True(t, meta.IsStatusConditionFalse(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionEphemeral))
+}
+
+func TestSetAvailableCondition(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	status := func(leader uint64) *clientv3.StatusResponse {
+		return &clientv3.StatusResponse{Header: &etcdserverpb.ResponseHeader{MemberId: 1}, Leader: leader}
+	}
+
+	setAvailableCondition(ec, []etcdutils.EpHealth{{Status: status(0)}, {Status: status(1)}}, errors.New("endpoint is unhealthy"))
+	assert.True(t, meta.IsStatusConditionTrue(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionAvailable))
+
+	setAvailableCondition(ec, nil, errors.New("context deadline exceeded"))
+	condition := meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionAvailable)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, reasonNoLeader, condition.Reason)
+	assert.Equal(t, "None of the members has a leader: context deadline exceeded", condition.Message)
+}
+
+func TestSetProgressConditions(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Status.PlannedActions = []ecv1alpha1.PlannedAction{
+		{Type: actionUpgrade, Description: "upgrade 1 member(s) one at a time, from v3.5.20 to v3.5.21"},
+		{Type: actionScaleOut, Description: "add 2 member(s) one learner at a time, from 1 to 3"},
+	}
+
+	setProgressConditions(ec)
+	progressing := meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionProgressing)
+	assert.Equal(t, metav1.ConditionTrue, progressing.Status)
+	assert.Equal(t, actionUpgrade, progressing.Reason)
+	assert.Equal(t, "upgrade 1 member(s) one at a time, from v3.5.20 to v3.5.21; add 2 member(s) one learner at a time, from 1 to 3", progressing.Message)
+	scalingUp := meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionScalingUp)
+	assert.Equal(t, metav1.ConditionTrue, scalingUp.Status)
+	assert.Equal(t, actionScaleOut, scalingUp.Reason)
+	assert.True(t, meta.IsStatusConditionFalse(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionScalingDown))
+
+	ec.Status.PlannedActions = []ecv1alpha1.PlannedAction{{Type: actionScaleIn, Description: "remove 2 member(s) one at a time, from 5 to 3"}}
+	setProgressConditions(ec)
+	assert.True(t, meta.IsStatusConditionFalse(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionScalingUp))
+	assert.True(t, meta.IsStatusConditionTrue(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionScalingDown))
+
+	ec.Status.PlannedActions = nil
+	setProgressConditions(ec)
+	for _, conditionType := range []string{
+		ecv1alpha1.EtcdClusterConditionProgressing, ecv1alpha1.EtcdClusterConditionScalingUp, ecv1alpha1.EtcdClusterConditionScalingDown,
+	} {
+		assert.True(t, meta.IsStatusConditionFalse(ec.Status.Conditions, conditionType))
+	}
+	assert.Equal(t, reasonUpToDate, meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionProgressing).Reason)
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// ConnectionSecretEndpointsKey is the key of the connection Secret holding
+// the comma separated client URLs of the members.
+const ConnectionSecretEndpointsKey = "endpoints"
+
+// connectionSecretLabels returns the labels of the connection Secrets of ec.
+func connectionSecretLabels(ec *ecv1alpha1.EtcdCluster) map[string]string {
+	return map[string]string{
+		"app":       ec.Name,
+		"component": "connection",
+	}
+}
+
+// newConnectionSecret returns the connection Secret of ec, which must have
+// a connectionSecret.
+func newConnectionSecret(ec *ecv1alpha1.EtcdCluster, owners []metav1.OwnerReference) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            ec.Spec.ConnectionSecret.Name,
+			Namespace:       ec.Namespace,
+			Labels:          connectionSecretLabels(ec),
+			OwnerReferences: owners,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			ConnectionSecretEndpointsKey: []byte(strings.Join(clientEndpointsFromEtcdCluster(ec), ",")),
+		},
+	}
+}
+
+// reconcileConnectionSecret applies the connection Secret of ec, and deletes
+// the connection Secrets it no longer uses, once the connectionSecret is
+// removed or renamed.
+func reconcileConnectionSecret(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster) error {
+	var name string
+	if ec.Spec.ConnectionSecret != nil {
+		owners, err := prepareOwnerReference(ec, scheme)
+		if err != nil {
+			return err
+		}
+		secret := newConnectionSecret(ec, owners)
+		if err := applyOwnedObject(ctx, c, recorder, ec, secret); err != nil {
+			return err
+		}
+		name = secret.Name
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.InNamespace(ec.Namespace), client.MatchingLabels(withManagedByLabel(connectionSecretLabels(ec)))); err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Name == name || !metav1.IsControlledBy(secret, ec) {
+			continue
+		}
+		if err := c.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
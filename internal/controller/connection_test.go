@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestReconcileConnectionSecret(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default", UID: "ec-uid"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:             3,
+			ConnectionSecret: &ecv1alpha1.ConnectionSecret{},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).
+		WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	recorder := record.NewFakeRecorder(10)
+
+	assert.NoError(t, reconcileConnectionSecret(ctx, fakeClient, scheme, recorder, ec))
+	secret := &corev1.Secret{}
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-etcd-connection", Namespace: "default"}, secret))
+	assert.True(t, metav1.IsControlledBy(secret, ec))
+	assert.Equal(t, "http://test-etcd-0.test-etcd.default.svc.cluster.local:2379,"+
+		"http://test-etcd-1.test-etcd.default.svc.cluster.local:2379,"+
+		"http://test-etcd-2.test-etcd.default.svc.cluster.local:2379",
+		string(secret.Data[ConnectionSecretEndpointsKey]))
+
+	// The Secret follows the size of the cluster.
+	ec.Spec.Size = 1
+	assert.NoError(t, reconcileConnectionSecret(ctx, fakeClient, scheme, recorder, ec))
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-etcd-connection", Namespace: "default"}, secret))
+	assert.Equal(t, "http://test-etcd-0.test-etcd.default.svc.cluster.local:2379", string(secret.Data[ConnectionSecretEndpointsKey]))
+
+	// A renamed Secret replaces the previous one.
+	ec.Spec.ConnectionSecret.Name = "renamed"
+	assert.NoError(t, reconcileConnectionSecret(ctx, fakeClient, scheme, recorder, ec))
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "renamed", Namespace: "default"}, secret))
+	err := fakeClient.Get(ctx, types.NamespacedName{Name: "test-etcd-connection", Namespace: "default"}, secret)
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	ec.Spec.ConnectionSecret = nil
+	assert.NoError(t, reconcileConnectionSecret(ctx, fakeClient, scheme, recorder, ec))
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "renamed", Namespace: "default"}, secret)
+	assert.True(t, k8serrors.IsNotFound(err))
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// assertCreateRejected creates obj in the API server of envtest, and checks
+// that the validation rules of its CRD reject it with wantErr, or accept it
+// when wantErr is empty.
+func assertCreateRejected(t *testing.T, obj client.Object, wantErr string) {
+	t.Helper()
+	ctx := t.Context()
+	err := k8sClient.Create(ctx, obj)
+	if wantErr == "" {
+		if assert.NoError(t, err) {
+			assert.NoError(t, k8sClient.Delete(ctx, obj))
+		}
+		return
+	}
+	assert.ErrorContains(t, err, wantErr)
+}
+
+func TestSnapshotPathValidation(t *testing.T) {
+	const relative = "must be a relative path without .. segments"
+	backup := func(name string, mutate func(*ecv1alpha1.EtcdBackupSpec)) *ecv1alpha1.EtcdBackup {
+		b := &ecv1alpha1.EtcdBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       ecv1alpha1.EtcdBackupSpec{ClusterName: "etcd"},
+		}
+		mutate(&b.Spec)
+		return b
+	}
+	pvc := func(path string) func(*ecv1alpha1.EtcdBackupSpec) {
+		return func(spec *ecv1alpha1.EtcdBackupSpec) {
+			spec.StorageProvider = ecv1alpha1.StorageProviderPVC
+			spec.PVC = &ecv1alpha1.PVCBackupDestination{ClaimName: "etcd-backups", Path: path}
+		}
+	}
+	hostPath := func(dir, path string) func(*ecv1alpha1.EtcdBackupSpec) {
+		return func(spec *ecv1alpha1.EtcdBackupSpec) {
+			spec.StorageProvider = ecv1alpha1.StorageProviderHostPath
+			spec.HostPath = &ecv1alpha1.HostPathBackupDestination{NodeName: "node-1", Directory: dir, Path: path}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		obj     client.Object
+		wantErr string
+	}{
+		{name: "relative path in a volume", obj: backup("pvc-relative", pvc("default/etcd/nightly.db"))},
+		{name: "absolute path in a volume", obj: backup("pvc-absolute", pvc("/etc/passwd")), wantErr: relative},
+		{name: "path out of a volume", obj: backup("pvc-parent", pvc("default/../../etcd.db")), wantErr: relative},
+		{name: "relative path in a directory", obj: backup("hostpath-relative", hostPath("/var/backups", "etcd..db"))},
+		{name: "absolute path in a directory", obj: backup("hostpath-absolute", hostPath("/var/backups", "/etc/passwd")), wantErr: relative},
+		{name: "path out of a directory", obj: backup("hostpath-parent", hostPath("/var/backups", "..")), wantErr: relative},
+		{name: "directory with .. segments", obj: backup("hostpath-dir", hostPath("/var/backups/../../etc", "passwd")), wantErr: "must not have .. segments"},
+		{
+			name: "restore from a path out of a volume",
+			obj: &ecv1alpha1.EtcdRestore{
+				ObjectMeta: metav1.ObjectMeta{Name: "restore-pvc-parent", Namespace: "default"},
+				Spec: ecv1alpha1.EtcdRestoreSpec{
+					ClusterName: "etcd",
+					ClusterSpec: ecv1alpha1.EtcdClusterSpec{Size: 1, Version: "v3.5.21"},
+					Source:      ecv1alpha1.RestoreSource{PVC: &ecv1alpha1.PVCSnapshotSource{ClaimName: "etcd-backups", Path: "../snapshot.db"}},
+				},
+			},
+			wantErr: relative,
+		},
+		{
+			name: "restore from an absolute path in a directory",
+			obj: &ecv1alpha1.EtcdRestore{
+				ObjectMeta: metav1.ObjectMeta{Name: "restore-hostpath-absolute", Namespace: "default"},
+				Spec: ecv1alpha1.EtcdRestoreSpec{
+					ClusterName: "etcd",
+					ClusterSpec: ecv1alpha1.EtcdClusterSpec{Size: 1, Version: "v3.5.21"},
+					Source: ecv1alpha1.RestoreSource{HostPath: &ecv1alpha1.HostPathSnapshotSource{
+						NodeName: "node-1", Directory: "/var/backups", Path: "/etc/shadow",
+					}},
+				},
+			},
+			wantErr: relative,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertCreateRejected(t, tt.obj, tt.wantErr)
+		})
+	}
+}
+
+func TestEtcdClusterCrossFieldValidation(t *testing.T) {
+	const (
+		election = "the election timeout must be at least 5 times the heartbeat interval"
+		learners = "the learners, --max-learners in etcdOptions, must be fewer than the voting members, size"
+	)
+	cluster := func(name string, mutate func(*ecv1alpha1.EtcdClusterSpec)) *ecv1alpha1.EtcdCluster {
+		ec := &ecv1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       ecv1alpha1.EtcdClusterSpec{Size: 3, Version: "v3.5.21"},
+		}
+		mutate(&ec.Spec)
+		return ec
+	}
+	tuning := func(heartbeat, election time.Duration) func(*ecv1alpha1.EtcdClusterSpec) {
+		return func(spec *ecv1alpha1.EtcdClusterSpec) {
+			spec.Tuning = &ecv1alpha1.EtcdTuning{}
+			if heartbeat != 0 {
+				spec.Tuning.HeartbeatInterval = &metav1.Duration{Duration: heartbeat}
+			}
+			if election != 0 {
+				spec.Tuning.ElectionTimeout = &metav1.Duration{Duration: election}
+			}
+		}
+	}
+	options := func(size int, options ...string) func(*ecv1alpha1.EtcdClusterSpec) {
+		return func(spec *ecv1alpha1.EtcdClusterSpec) {
+			spec.Size = size
+			spec.EtcdOptions = options
+		}
+	}
+
+	tests := []struct {
+		name    string
+		obj     client.Object
+		wantErr string
+	}{
+		{name: "election timeout 5 times the heartbeat interval", obj: cluster("timings", tuning(200*time.Millisecond, time.Second))},
+		{name: "election timeout below 5 times the heartbeat interval", obj: cluster("short-election", tuning(500*time.Millisecond, 2*time.Second)), wantErr: election},
+		{name: "heartbeat interval beyond the default election timeout", obj: cluster("long-heartbeat", tuning(250*time.Millisecond, 0)), wantErr: election},
+		{name: "election timeout below the default heartbeat interval", obj: cluster("default-heartbeat", tuning(0, 400*time.Millisecond)), wantErr: election},
+		{name: "fewer learners than voting members", obj: cluster("learners", options(3, "--max-learners=2"))},
+		{name: "as many learners as voting members", obj: cluster("too-many-learners", options(3, "--experimental-max-learners=3")), wantErr: learners},
+		{name: "learners of a cluster scaled to zero", obj: cluster("scaled-to-zero", options(0, "--max-learners=1"))},
+		{
+			name: "restored cluster with as many learners as voting members",
+			obj: &ecv1alpha1.EtcdRestore{
+				ObjectMeta: metav1.ObjectMeta{Name: "restore-learners", Namespace: "default"},
+				Spec: ecv1alpha1.EtcdRestoreSpec{
+					ClusterName: "etcd",
+					ClusterSpec: ecv1alpha1.EtcdClusterSpec{
+						Size: 1, Version: "v3.5.21", EtcdOptions: []string{"--max-learners 1"},
+						StorageSpec: &ecv1alpha1.StorageSpec{AccessModes: corev1.ReadWriteOnce, VolumeSizeRequest: resource.MustParse("1Gi")},
+					},
+					Source: ecv1alpha1.RestoreSource{PVC: &ecv1alpha1.PVCSnapshotSource{ClaimName: "etcd-backups", Path: "snapshot.db"}},
+				},
+			},
+			wantErr: learners,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertCreateRejected(t, tt.obj, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/datacheck"
+)
+
+// dataCheckContainerName is the init container of the members checking the
+// integrity of their data, see podTemplate.dataCheck.
+const dataCheckContainerName = "check-data"
+
+// dataCheckImage returns the image checking the data of the members of ec,
+// or an empty string when their data isn't checked.
+func dataCheckImage(ec *ecv1alpha1.EtcdCluster) string {
+	if ec.Spec.PodTemplate == nil || ec.Spec.PodTemplate.DataCheck == nil {
+		return ""
+	}
+	return ec.Spec.PodTemplate.DataCheck.Image
+}
+
+// setDataCheckImage fills in memory the image checking the data of the
+// members of ec with operatorImage, the image of the operator, when
+// podTemplate.dataCheck doesn't set one. A warning is recorded when there is
+// no image to run the check.
+func setDataCheckImage(recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, operatorImage string) {
+	if ec.Spec.PodTemplate == nil || ec.Spec.PodTemplate.DataCheck == nil || ec.Spec.PodTemplate.DataCheck.Image != "" {
+		return
+	}
+	if operatorImage == "" {
+		recorder.Event(ec, corev1.EventTypeWarning, "DataCheckUnavailable",
+			"The data of the members isn't checked, podTemplate.dataCheck.image isn't set and the operator runs without --operator-image")
+		return
+	}
+	ec.Spec.PodTemplate.DataCheck.Image = operatorImage
+}
+
+// newDataCheckContainer returns the init container checking the data of a
+// member with image, in the volume mounted by dataMount, before etcd starts.
+// The outcome of a failed check is its termination message. The data of the
+// members is only readable by the user of etcd, root in the etcd image.
+func newDataCheckContainer(image string, dataMount corev1.VolumeMount, resources corev1.ResourceRequirements) corev1.Container {
+	return corev1.Container{
+		Name:    dataCheckContainerName,
+		Image:   image,
+		Command: []string{"/manager", "check-data", "-data-dir", etcdDataDir, "-out", "/dev/termination-log"},
+		// The data of the member is a subdirectory of the volume named
+		// after its pod.
+		Env: []corev1.EnvVar{{
+			Name: "POD_NAME",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "metadata.name"},
+			},
+		}},
+		VolumeMounts: []corev1.VolumeMount{dataMount},
+		Resources:    resources,
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser:    ptr.To[int64](0),
+			RunAsNonRoot: ptr.To(false),
+		},
+	}
+}
+
+// corruptedMembers returns the corruption the data check found in the
+// members of ec, by name: the pods whose check-data init container last
+// exited with datacheck.ExitCorrupted. The other failures, e.g. an OOM kill
+// or unreadable data, say nothing of the data and are left to the kubelet.
+// The pods are read with c, which must not be restricted to the objects of
+// the operator.
+func corruptedMembers(ctx context.Context, c client.Reader, ec *ecv1alpha1.EtcdCluster) (map[string]string, error) {
+	if dataCheckImage(ec) == "" {
+		return nil, nil
+	}
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(ec.Namespace), client.MatchingLabels{"app": ec.Name, "controller": ec.Name}); err != nil {
+		return nil, err
+	}
+	corrupted := map[string]string{}
+	for _, p := range pods.Items {
+		for _, s := range p.Status.InitContainerStatuses {
+			if s.Name != dataCheckContainerName {
+				continue
+			}
+			terminated := s.State.Terminated
+			if terminated == nil {
+				terminated = s.LastTerminationState.Terminated
+			}
+			if terminated == nil || terminated.ExitCode != datacheck.ExitCorrupted {
+				continue
+			}
+			message := terminated.Message
+			if message == "" {
+				message = "the data is corrupted"
+			}
+			corrupted[p.Name] = "the data check failed: " + message
+		}
+	}
+	return corrupted, nil
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/datacheck"
+)
+
+func TestSetDataCheckImage(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	ec := newPlanTestCluster(3, "v3.5.21")
+	setDataCheckImage(recorder, ec, "etcd-operator:v0.1.0")
+	assert.Empty(t, dataCheckImage(ec))
+
+	ec.Spec.PodTemplate.DataCheck = &ecv1alpha1.DataCheck{}
+	setDataCheckImage(recorder, ec, "")
+	assert.Empty(t, dataCheckImage(ec))
+	assert.Contains(t, <-recorder.Events, "DataCheckUnavailable")
+
+	setDataCheckImage(recorder, ec, "etcd-operator:v0.1.0")
+	assert.Equal(t, "etcd-operator:v0.1.0", dataCheckImage(ec))
+
+	ec.Spec.PodTemplate.DataCheck.Image = "my-registry/etcd-operator:v0.1.0"
+	setDataCheckImage(recorder, ec, "etcd-operator:v0.1.0")
+	assert.Equal(t, "my-registry/etcd-operator:v0.1.0", dataCheckImage(ec))
+}
+
+func TestDataCheckContainer(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.PodTemplate.DataCheck = &ecv1alpha1.DataCheck{Image: "etcd-operator:v0.1.0"}
+
+	// Without a volume, there is no data to check.
+	spec, err := newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, spec.Template.Spec.InitContainers)
+
+	ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{
+		AccessModes:       corev1.ReadWriteOnce,
+		VolumeSizeRequest: resource.MustParse("1Gi"),
+		VolumeSizeLimit:   resource.MustParse("1Gi"),
+	}
+	ec.Spec.PodTemplate.Resources = &corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+	}
+	spec, err = newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	check := findContainer(spec.Template.Spec.InitContainers, dataCheckContainerName)
+	if assert.NotNil(t, check) {
+		assert.Equal(t, "etcd-operator:v0.1.0", check.Image)
+		assert.Equal(t, []string{"/manager", "check-data", "-data-dir", etcdDataDir, "-out", "/dev/termination-log"}, check.Command)
+		assert.Equal(t, []corev1.VolumeMount{{Name: volumeName, MountPath: etcdDataDir, SubPathExpr: "$(POD_NAME)"}}, check.VolumeMounts)
+		assert.Equal(t, "POD_NAME", check.Env[0].Name)
+		assert.Equal(t, *ec.Spec.PodTemplate.Resources, check.Resources)
+	}
+
+	ec.Spec.PodTemplate.DataCheck = nil
+	spec, err = newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, spec.Template.Spec.InitContainers)
+}
+
+func TestCorruptedMembers(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	ec := newPlanTestCluster(3, "v3.5.21")
+	pod := func(name string, status corev1.ContainerStatus) *corev1.Pod {
+		status.Name = dataCheckContainerName
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "test-etcd", "controller": "test-etcd"}},
+			Status:     corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{status}},
+		}
+	}
+	terminated := func(code int32, message string) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: code, Message: message}}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		pod("test-etcd-0", corev1.ContainerStatus{State: terminated(0, "")}),
+		pod("test-etcd-1", corev1.ContainerStatus{
+			State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			LastTerminationState: terminated(datacheck.ExitCorrupted, "the database is corrupted"),
+		}),
+		pod("test-etcd-2", corev1.ContainerStatus{State: terminated(datacheck.ExitCorrupted, "")}),
+		// Neither an OOM kill nor a failure to read the data is a
+		// corruption.
+		pod("test-etcd-3", corev1.ContainerStatus{State: terminated(137, "")}),
+		pod("test-etcd-4", corev1.ContainerStatus{
+			State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			LastTerminationState: terminated(1, ""),
+		}),
+	).Build()
+
+	corrupted, err := corruptedMembers(ctx, c, ec)
+	assert.NoError(t, err)
+	assert.Nil(t, corrupted)
+
+	ec.Spec.PodTemplate.DataCheck = &ecv1alpha1.DataCheck{Image: "etcd-operator:v0.1.0"}
+	corrupted, err = corruptedMembers(ctx, c, ec)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"test-etcd-1": "the data check failed: the database is corrupted",
+		"test-etcd-2": "the data check failed: the data is corrupted",
+	}, corrupted)
+}
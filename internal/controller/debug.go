@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// defaultDebugPodDuration is how long the debug Pod runs when the
+	// DebugPodAnnotation is set to "true".
+	defaultDebugPodDuration = time.Hour
+	// debugWatchKey is the key watched by the debug Pod to keep running. It
+	// is never written by the operator.
+	debugWatchKey = "/operator.etcd.io/debug"
+)
+
+// debugPodName returns the name of the debug Pod of ec.
+func debugPodName(ec *ecv1alpha1.EtcdCluster) string {
+	return ec.Name + "-debug"
+}
+
+// debugPodDuration returns how long the debug Pod requested by the
+// DebugPodAnnotation of ec runs, and whether one is requested.
+func debugPodDuration(ec *ecv1alpha1.EtcdCluster) (time.Duration, bool, error) {
+	value, ok := ec.Annotations[ecv1alpha1.DebugPodAnnotation]
+	if !ok {
+		return 0, false, nil
+	}
+	if value == "true" {
+		return defaultDebugPodDuration, true, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, true, fmt.Errorf("invalid %s annotation %q: expected a positive duration or \"true\"", ecv1alpha1.DebugPodAnnotation, value)
+	}
+	return d, true, nil
+}
+
+// newDebugPod returns the debug Pod of ec. It runs the image of the members,
+// so its etcdctl and etcdutl match their version, with the endpoints of all
+// the members set in ETCDCTL_ENDPOINTS, and the client certificate of the
+// operator when they serve TLS. The image has no shell, so the Pod
+// is kept running by an etcdctl watch, until d elapses.
+func newDebugPod(ec *ecv1alpha1.EtcdCluster, d time.Duration, owners []metav1.OwnerReference) *corev1.Pod {
+	pod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      debugPodName(ec),
+			Namespace: ec.Namespace,
+			Labels: map[string]string{
+				"app":       ec.Name,
+				"component": "debug",
+			},
+			OwnerReferences: owners,
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds:         ptr.To(int64(d.Seconds())),
+			TerminationGracePeriodSeconds: ptr.To(int64(0)),
+			Containers: []corev1.Container{
+				{
+					Name:  "etcdctl",
+					Image: fmt.Sprintf("gcr.io/etcd-development/etcd:%s", ec.Spec.Version),
+					Command: []string{
+						"/usr/local/bin/etcdctl", "watch", debugWatchKey,
+						fmt.Sprintf("--dial-timeout=%s", d),
+					},
+					Env: []corev1.EnvVar{
+						{Name: "ETCDCTL_API", Value: "3"},
+						{Name: "ETCDCTL_ENDPOINTS", Value: strings.Join(clientEndpointsFromEtcdCluster(ec), ",")},
+					},
+				},
+			},
+		},
+	}
+	addClientTLS(ec, &pod.Spec, &pod.Spec.Containers[0])
+	addRootCredentials(ec, &pod.Spec.Containers[0])
+	return pod
+}
+
+// reconcileDebugPod creates the debug Pod of ec when it carries the
+// DebugPodAnnotation, and deletes it once the annotation is removed. An
+// existing debug Pod is left as is, even once it expired, so that it is only
+// created again after its deletion.
+func reconcileDebugPod(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster) error {
+	d, requested, err := debugPodDuration(ec)
+	if err != nil {
+		recorder.Event(ec, corev1.EventTypeWarning, "InvalidDebugPod", err.Error())
+		return nil
+	}
+
+	pod := &corev1.Pod{}
+	err = c.Get(ctx, types.NamespacedName{Name: debugPodName(ec), Namespace: ec.Namespace}, pod)
+	switch {
+	case k8serrors.IsNotFound(err):
+		if !requested {
+			return nil
+		}
+	case err != nil:
+		return err
+	case !requested:
+		if !metav1.IsControlledBy(pod, ec) {
+			return nil
+		}
+		if err := c.Delete(ctx, pod); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		recorder.Eventf(ec, corev1.EventTypeNormal, "DebugPodDeleted", "Deleted the debug Pod %s", pod.Name)
+		return nil
+	default:
+		return nil
+	}
+
+	owners, err := prepareOwnerReference(ec, scheme)
+	if err != nil {
+		return err
+	}
+	pod = newDebugPod(ec, d, owners)
+	if err := applyOwnedObject(ctx, c, recorder, ec, pod); err != nil {
+		return err
+	}
+	recorder.Eventf(ec, corev1.EventTypeNormal, "DebugPodCreated",
+		"Created the debug Pod %s for %s, run etcdctl with: kubectl exec -n %s %s -- etcdctl member list",
+		pod.Name, d, pod.Namespace, pod.Name)
+	return nil
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestDebugPodDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     *string
+		expected  time.Duration
+		requested bool
+		wantErr   bool
+	}{
+		{name: "not requested"},
+		{name: "true", value: ptr.To("true"), expected: time.Hour, requested: true},
+		{name: "duration", value: ptr.To("30m"), expected: 30 * time.Minute, requested: true},
+		{name: "invalid", value: ptr.To("yes"), requested: true, wantErr: true},
+		{name: "negative", value: ptr.To("-1h"), requested: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &ecv1alpha1.EtcdCluster{}
+			if tt.value != nil {
+				ec.Annotations = map[string]string{ecv1alpha1.DebugPodAnnotation: *tt.value}
+			}
+			d, requested, err := debugPodDuration(ec)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.requested, requested)
+			assert.Equal(t, tt.expected, d)
+		})
+	}
+}
+
+func TestNewDebugPod(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Size: 2, Version: "v3.5.21"},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	pod := newDebugPod(ec, 30*time.Minute, nil)
+	assert.Equal(t, "test-etcd-debug", pod.Name)
+	assert.Equal(t, int64(1800), *pod.Spec.ActiveDeadlineSeconds)
+
+	c := pod.Spec.Containers[0]
+	assert.Equal(t, "gcr.io/etcd-development/etcd:v3.5.21", c.Image)
+	assert.Contains(t, c.Command, "--dial-timeout=30m0s")
+	assert.Contains(t, c.Env, corev1.EnvVar{
+		Name:  "ETCDCTL_ENDPOINTS",
+		Value: "http://test-etcd-0.test-etcd.default.svc.cluster.local:2379,http://test-etcd-1.test-etcd.default.svc.cluster.local:2379",
+	})
+}
+
+func TestReconcileDebugPod(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-etcd",
+			Namespace:   "default",
+			UID:         "ec-uid",
+			Annotations: map[string]string{ecv1alpha1.DebugPodAnnotation: "true"},
+		},
+		Spec: ecv1alpha1.EtcdClusterSpec{Size: 3, Version: "v3.5.21"},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).
+		WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	recorder := record.NewFakeRecorder(10)
+	key := types.NamespacedName{Name: "test-etcd-debug", Namespace: "default"}
+
+	assert.NoError(t, reconcileDebugPod(ctx, fakeClient, scheme, recorder, ec))
+	assert.Contains(t, <-recorder.Events, "DebugPodCreated")
+	pod := &corev1.Pod{}
+	assert.NoError(t, fakeClient.Get(ctx, key, pod))
+	assert.True(t, metav1.IsControlledBy(pod, ec))
+	assert.Equal(t, managedByValue, pod.Labels[managedByLabel])
+
+	// The existing Pod is left alone.
+	assert.NoError(t, reconcileDebugPod(ctx, fakeClient, scheme, recorder, ec))
+	assert.Empty(t, recorder.Events)
+
+	// An invalid annotation is reported, and keeps the Pod.
+	ec.Annotations[ecv1alpha1.DebugPodAnnotation] = "forever"
+	assert.NoError(t, reconcileDebugPod(ctx, fakeClient, scheme, recorder, ec))
+	assert.Contains(t, <-recorder.Events, "InvalidDebugPod")
+	assert.NoError(t, fakeClient.Get(ctx, key, pod))
+
+	delete(ec.Annotations, ecv1alpha1.DebugPodAnnotation)
+	assert.NoError(t, reconcileDebugPod(ctx, fakeClient, scheme, recorder, ec))
+	assert.Contains(t, <-recorder.Events, "DebugPodDeleted")
+	assert.True(t, k8serrors.IsNotFound(fakeClient.Get(ctx, key, pod)))
+
+	// A Pod of the same name not controlled by the cluster isn't deleted.
+	other := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	assert.NoError(t, fakeClient.Create(ctx, other))
+	assert.NoError(t, reconcileDebugPod(ctx, fakeClient, scheme, recorder, ec))
+	assert.NoError(t, fakeClient.Get(ctx, key, pod))
+}
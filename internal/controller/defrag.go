@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/cron"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// defragSchedule returns the parsed defrag schedule of ec, or nil when its
+// members aren't defragmented on a schedule.
+func defragSchedule(ec *ecv1alpha1.EtcdCluster) (*cron.Schedule, error) {
+	m := ec.Spec.Maintenance
+	if m == nil || m.DefragSchedule == "" {
+		return nil, nil
+	}
+	return cron.Parse(m.DefragSchedule)
+}
+
+func findMemberDefrag(ec *ecv1alpha1.EtcdCluster, name string) *ecv1alpha1.MemberDefrag {
+	for i := range ec.Status.MemberDefrags {
+		if ec.Status.MemberDefrags[i].Name == name {
+			return &ec.Status.MemberDefrags[i]
+		}
+	}
+	return nil
+}
+
+// dueDefragTime returns the last time of schedule, not after now, the
+// members of sts must have been defragmented since, or the zero time if
+// they all were. The schedule is walked from the oldest defragmentation of
+// the members, or from the creation of ec when one of them was never
+// defragmented.
+func dueDefragTime(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, schedule *cron.Schedule, now time.Time) time.Time {
+	since := time.Time{}
+	for i := range int(ptr.Deref(sts.Spec.Replicas, 0)) {
+		defrag := findMemberDefrag(ec, fmt.Sprintf("%s-%d", sts.Name, i))
+		if defrag == nil {
+			since = ec.CreationTimestamp.Time
+			break
+		}
+		if since.IsZero() || defrag.LastDefragTime.Time.Before(since) {
+			since = defrag.LastDefragTime.Time
+		}
+	}
+	if since.IsZero() {
+		return time.Time{}
+	}
+	return lastScheduledTime(schedule, since, now)
+}
+
+// nextDefragMember returns the ordinal of the next member of sts to
+// defragment, not defragmented since due, or -1 if there is none. The
+// leader goes last, so the leadership changes at most once. healthInfos is
+// the result of the health check of the members.
+func nextDefragMember(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, healthInfos []etcdutils.EpHealth, due time.Time) int {
+	leader := -1
+	for i := range int(ptr.Deref(sts.Spec.Replicas, 0)) {
+		ep := clientEndpointForOrdinalIndex(sts, i)
+		idx := slices.IndexFunc(healthInfos, func(h etcdutils.EpHealth) bool { return h.Ep == ep })
+		if idx < 0 || healthInfos[idx].Status == nil {
+			continue
+		}
+		if defrag := findMemberDefrag(ec, fmt.Sprintf("%s-%d", sts.Name, i)); defrag != nil && !defrag.LastDefragTime.Time.Before(due) {
+			continue
+		}
+		if status := healthInfos[idx].Status; status.Leader != status.Header.MemberId {
+			return i
+		}
+		leader = i
+	}
+	return leader
+}
+
+// reconcileDefrag defragments the next member of ec due on its defrag
+// schedule, and records when in the status of ec. The members of sts are
+// expected to be all healthy, as defragmenting blocks a member for a while.
+// The records of the members beyond the replicas of sts are forgotten. It
+// returns whether a member was defragmented, in which case the members are
+// checked again before the next one goes.
+func reconcileDefrag(logger logr.Logger, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet,
+	etcdClient *etcdutils.ClusterClient, healthInfos []etcdutils.EpHealth, now time.Time) (bool, error) {
+	ec.Status.MemberDefrags = slices.DeleteFunc(ec.Status.MemberDefrags, func(d ecv1alpha1.MemberDefrag) bool {
+		var index int
+		_, err := fmt.Sscanf(d.Name, sts.Name+"-%d", &index)
+		return err != nil || index >= int(ptr.Deref(sts.Spec.Replicas, 0))
+	})
+
+	schedule, err := defragSchedule(ec)
+	if schedule == nil || err != nil {
+		return false, err
+	}
+	due := dueDefragTime(ec, sts, schedule, now)
+	if due.IsZero() {
+		return false, nil
+	}
+	index := nextDefragMember(ec, sts, healthInfos, due)
+	if index < 0 {
+		return false, nil
+	}
+
+	name := fmt.Sprintf("%s-%d", sts.Name, index)
+	logger.Info("Defragmenting member", "member", name, "scheduledTime", due)
+	if err := etcdClient.Defragment(clientEndpointForOrdinalIndex(sts, index)); err != nil {
+		recorder.Eventf(ec, corev1.EventTypeWarning, "DefragFailed", "Failed to defragment member %s: %v", name, err)
+		return true, err
+	}
+	recorder.Eventf(ec, corev1.EventTypeNormal, "Defragmented", "Defragmented member %s, scheduled at %s", name, due.Format(time.RFC3339))
+	if defrag := findMemberDefrag(ec, name); defrag != nil {
+		defrag.LastDefragTime = metav1.NewTime(now)
+	} else {
+		ec.Status.MemberDefrags = append(ec.Status.MemberDefrags, ecv1alpha1.MemberDefrag{Name: name, LastDefragTime: metav1.NewTime(now)})
+	}
+	return true, nil
+}
+
+// withNextDefrag returns result requeued at the latest for the next time of
+// the defrag schedule of ec after now, if any.
+func withNextDefrag(result ctrl.Result, ec *ecv1alpha1.EtcdCluster, now time.Time) ctrl.Result {
+	schedule, err := defragSchedule(ec)
+	if schedule == nil || err != nil {
+		return result
+	}
+	if next := schedule.Next(now); !next.IsZero() {
+		if wait := next.Sub(now); result.RequeueAfter == 0 || wait < result.RequeueAfter {
+			result.RequeueAfter = wait
+		}
+	}
+	return result
+}
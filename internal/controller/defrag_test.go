@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/cron"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func newDefragTestCluster(schedule string, created time.Time) *ecv1alpha1.EtcdCluster {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.CreationTimestamp = metav1.NewTime(created)
+	ec.Spec.Maintenance = &ecv1alpha1.Maintenance{DefragSchedule: schedule}
+	return ec
+}
+
+func memberDefrags(times ...time.Time) []ecv1alpha1.MemberDefrag {
+	var defrags []ecv1alpha1.MemberDefrag
+	for i, t := range times {
+		defrags = append(defrags, ecv1alpha1.MemberDefrag{Name: fmt.Sprintf("test-etcd-%d", i), LastDefragTime: metav1.NewTime(t)})
+	}
+	return defrags
+}
+
+func TestDueDefragTime(t *testing.T) {
+	created := time.Date(2025, 1, 1, 0, 30, 0, 0, time.UTC)
+	now := time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC)
+	schedule, err := cron.Parse("0 3 * * *")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		defrags  []ecv1alpha1.MemberDefrag
+		expected time.Time
+	}{
+		{
+			name:     "never defragmented",
+			expected: time.Date(2025, 1, 3, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "a member never defragmented",
+			defrags:  memberDefrags(now, now),
+			expected: time.Date(2025, 1, 3, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "defragmented since the last schedule",
+			defrags:  memberDefrags(now, now.Add(-time.Hour), now),
+			expected: time.Time{},
+		},
+		{
+			name:     "a member defragmented before the last schedule",
+			defrags:  memberDefrags(now, time.Date(2025, 1, 2, 3, 1, 0, 0, time.UTC), now),
+			expected: time.Date(2025, 1, 3, 3, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := newDefragTestCluster("0 3 * * *", created)
+			ec.Status.MemberDefrags = tt.defrags
+			sts := newPlanTestStatefulSet(t, ec, 3)
+			assert.Equal(t, tt.expected, dueDefragTime(ec, sts, schedule, now))
+		})
+	}
+}
+
+func TestNextDefragMember(t *testing.T) {
+	due := time.Date(2025, 1, 3, 3, 0, 0, 0, time.UTC)
+	status := func(id, leader uint64) *clientv3.StatusResponse {
+		return &clientv3.StatusResponse{Header: &etcdserverpb.ResponseHeader{MemberId: id}, Leader: leader}
+	}
+
+	tests := []struct {
+		name     string
+		defrags  []ecv1alpha1.MemberDefrag
+		statuses []*clientv3.StatusResponse
+		expected int
+	}{
+		{
+			name:     "the followers first",
+			statuses: []*clientv3.StatusResponse{status(1, 1), status(2, 1), status(3, 1)},
+			expected: 1,
+		},
+		{
+			name:     "the leader last",
+			defrags:  memberDefrags(due.Add(-time.Hour), due.Add(time.Minute), due.Add(2*time.Minute)),
+			statuses: []*clientv3.StatusResponse{status(1, 1), status(2, 1), status(3, 1)},
+			expected: 0,
+		},
+		{
+			name:     "all defragmented",
+			defrags:  memberDefrags(due, due.Add(time.Minute), due.Add(2*time.Minute)),
+			statuses: []*clientv3.StatusResponse{status(1, 1), status(2, 1), status(3, 1)},
+			expected: -1,
+		},
+		{
+			name:     "members not responding",
+			statuses: []*clientv3.StatusResponse{status(1, 1)},
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := newDefragTestCluster("0 3 * * *", due.Add(-24*time.Hour))
+			ec.Status.MemberDefrags = tt.defrags
+			sts := newPlanTestStatefulSet(t, ec, 3)
+			var healthInfos []etcdutils.EpHealth
+			for i, s := range tt.statuses {
+				healthInfos = append(healthInfos, etcdutils.EpHealth{Ep: clientEndpointForOrdinalIndex(sts, i), Health: true, Status: s})
+			}
+			assert.Equal(t, tt.expected, nextDefragMember(ec, sts, healthInfos, due))
+		})
+	}
+}
+
+func TestReconcileDefragNotDue(t *testing.T) {
+	now := time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC)
+	ec := newDefragTestCluster("0 3 * * *", now.Add(-72*time.Hour))
+	// The records of the members removed are forgotten.
+	ec.Status.MemberDefrags = memberDefrags(now, now, now, now)
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	recorder := record.NewFakeRecorder(10)
+
+	defragmenting, err := reconcileDefrag(logr.Discard(), recorder, ec, sts, nil, nil, now)
+	assert.NoError(t, err)
+	assert.False(t, defragmenting)
+	assert.Equal(t, memberDefrags(now, now, now), ec.Status.MemberDefrags)
+	assert.Empty(t, recorder.Events)
+
+	// Without a schedule, nothing is defragmented.
+	ec = newPlanTestCluster(3, "v3.5.21")
+	defragmenting, err = reconcileDefrag(logr.Discard(), recorder, ec, sts, nil, nil, now)
+	assert.NoError(t, err)
+	assert.False(t, defragmenting)
+}
+
+func TestWithNextDefrag(t *testing.T) {
+	now := time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC)
+	ec := newDefragTestCluster("0 3 * * *", now)
+
+	assert.Equal(t, ctrl.Result{RequeueAfter: 15 * time.Hour}, withNextDefrag(ctrl.Result{}, ec, now))
+	assert.Equal(t, ctrl.Result{RequeueAfter: time.Hour}, withNextDefrag(ctrl.Result{RequeueAfter: time.Hour}, ec, now))
+	assert.Equal(t, ctrl.Result{}, withNextDefrag(ctrl.Result{}, newPlanTestCluster(3, "v3.5.21"), now))
+}
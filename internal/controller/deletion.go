@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// isDeletionConfirmed reports whether the deletion of ec was confirmed with
+// the ConfirmDeletionAnnotation.
+func isDeletionConfirmed(ec *ecv1alpha1.EtcdCluster) bool {
+	return ec.Annotations[ecv1alpha1.ConfirmDeletionAnnotation] == ec.Name
+}
+
+// reconcileDeletionProtection keeps the deletion protection finalizer of ec in
+// line with its deletion policy, and releases it once a protected cluster's
+// deletion is confirmed. It returns true when ec is being deleted, in which
+// case the reconciliation must stop.
+func reconcileDeletionProtection(ctx context.Context, c client.Client, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster) (bool, error) {
+	protected := ec.Spec.DeletionPolicy == ecv1alpha1.DeletionPolicyProtect
+
+	finalizers := slices.Clone(ec.Finalizers)
+
+	if ec.DeletionTimestamp.IsZero() {
+		var changed bool
+		if protected {
+			changed = controllerutil.AddFinalizer(ec, ecv1alpha1.DeletionProtectionFinalizer)
+		} else {
+			changed = controllerutil.RemoveFinalizer(ec, ecv1alpha1.DeletionProtectionFinalizer)
+		}
+		if changed {
+			return false, patchFinalizers(ctx, c, ec, finalizers)
+		}
+		return false, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(ec, ecv1alpha1.DeletionProtectionFinalizer) {
+		return true, nil
+	}
+
+	if protected && !isDeletionConfirmed(ec) {
+		recorder.Eventf(ec, corev1.EventTypeWarning, "DeletionBlocked",
+			"Deletion is blocked by the Protect deletion policy; annotate the EtcdCluster with %s=%s to confirm it",
+			ecv1alpha1.ConfirmDeletionAnnotation, ec.Name)
+		return true, nil
+	}
+
+	recorder.Event(ec, corev1.EventTypeNormal, "DeletionConfirmed", "Deletion confirmed, releasing the deletion protection")
+	controllerutil.RemoveFinalizer(ec, ecv1alpha1.DeletionProtectionFinalizer)
+	return true, patchFinalizers(ctx, c, ec, finalizers)
+}
+
+// patchFinalizers writes the finalizers of ec, changed from finalizers,
+// through a separate object: ec carries in-memory values of its spec, such as
+// the ones of its template and the defaults, which the response of the API
+// server would overwrite.
+func patchFinalizers(ctx context.Context, c client.Client, ec *ecv1alpha1.EtcdCluster, finalizers []string) error {
+	base := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: ec.Namespace, Finalizers: finalizers}}
+	obj := base.DeepCopy()
+	obj.Finalizers = ec.Finalizers
+	if err := c.Patch(ctx, obj, client.MergeFrom(base)); err != nil {
+		return err
+	}
+	ec.ResourceVersion = obj.ResourceVersion
+	return nil
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestReconcileDeletionProtection(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Size: 3, DeletionPolicy: ecv1alpha1.DeletionPolicyProtect},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).Build()
+	recorder := record.NewFakeRecorder(10)
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	// The finalizer is added to protected clusters.
+	deleting, err := reconcileDeletionProtection(ctx, fakeClient, recorder, ec)
+	assert.NoError(t, err)
+	assert.False(t, deleting)
+
+	stored := &ecv1alpha1.EtcdCluster{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(ec), stored))
+	assert.True(t, controllerutil.ContainsFinalizer(stored, ecv1alpha1.DeletionProtectionFinalizer))
+	assert.Empty(t, stored.Spec.Version, "defaults must not be persisted")
+
+	// The deletion is blocked until it is confirmed.
+	assert.NoError(t, fakeClient.Delete(ctx, stored))
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(ec), stored))
+	deleting, err = reconcileDeletionProtection(ctx, fakeClient, recorder, stored)
+	assert.NoError(t, err)
+	assert.True(t, deleting)
+	assert.Contains(t, <-recorder.Events, "DeletionBlocked")
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(ec), stored))
+
+	// A confirmation for another cluster doesn't count.
+	stored.Annotations = map[string]string{ecv1alpha1.ConfirmDeletionAnnotation: "other-etcd"}
+	assert.False(t, isDeletionConfirmed(stored))
+
+	stored.Annotations[ecv1alpha1.ConfirmDeletionAnnotation] = ec.Name
+	deleting, err = reconcileDeletionProtection(ctx, fakeClient, recorder, stored)
+	assert.NoError(t, err)
+	assert.True(t, deleting)
+	assert.Contains(t, <-recorder.Events, "DeletionConfirmed")
+
+	// Without the finalizer the fake client completes the deletion.
+	err = fakeClient.Get(ctx, client.ObjectKeyFromObject(ec), stored)
+	assert.Error(t, err)
+}
+
+func TestReconcileDeletionProtectionRemovesFinalizer(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Finalizers = []string{ecv1alpha1.DeletionProtectionFinalizer}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).Build()
+
+	deleting, err := reconcileDeletionProtection(ctx, fakeClient, record.NewFakeRecorder(10), ec)
+	assert.NoError(t, err)
+	assert.False(t, deleting)
+
+	stored := &ecv1alpha1.EtcdCluster{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(ec), stored))
+	assert.Empty(t, stored.Finalizers)
+}
+
+func TestReconcileDeletionProtectionKeepsDefaults(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Size: 3, DeletionPolicy: ecv1alpha1.DeletionPolicyProtect},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).Build()
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	expected := ec.Spec.DeepCopy()
+
+	// The finalizer patch doesn't overwrite the in-memory defaults with the
+	// stored spec.
+	_, err := reconcileDeletionProtection(ctx, fakeClient, record.NewFakeRecorder(10), ec)
+	assert.NoError(t, err)
+	assert.True(t, controllerutil.ContainsFinalizer(ec, ecv1alpha1.DeletionProtectionFinalizer))
+	assert.Equal(t, *expected, ec.Spec)
+	assert.NotNil(t, ec.Spec.Ports)
+	assert.NotNil(t, ec.Spec.PodTemplate)
+
+	stored := &ecv1alpha1.EtcdCluster{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(ec), stored))
+	assert.Equal(t, stored.ResourceVersion, ec.ResourceVersion)
+	assert.Nil(t, stored.Spec.Ports)
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	policyv1 "k8s.io/api/policy/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// hasDisruptionBudget reports whether the members of ec are covered by a
+// PodDisruptionBudget of the operator.
+func hasDisruptionBudget(ec *ecv1alpha1.EtcdCluster) bool {
+	return ec.Spec.PodTemplate == nil || ptr.Deref(ec.Spec.PodTemplate.DisruptionBudget, true)
+}
+
+// newPodDisruptionBudget returns the PodDisruptionBudget of the members of
+// ec. It lets the evictions, e.g. of a node drain, take down one member at a
+// time, and only while the other members are ready, so that a drain never
+// costs the cluster its quorum. The members are only evicted once the
+// previous one is back, and etcd transfers the leadership of a member it
+// stops to another one.
+func newPodDisruptionBudget(ec *ecv1alpha1.EtcdCluster) *policyv1.PodDisruptionBudget {
+	return &policyv1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: policyv1.SchemeGroupVersion.String(),
+			Kind:       "PodDisruptionBudget",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ec.Name,
+			Namespace: ec.Namespace,
+			Labels:    map[string]string{"app": ec.Name},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MaxUnavailable: ptr.To(intstr.FromInt32(1)),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": ec.Name, "controller": ec.Name},
+			},
+		},
+	}
+}
+
+// reconcilePodDisruptionBudget applies the PodDisruptionBudget of the members
+// of ec, or deletes it once podTemplate.disruptionBudget is turned off.
+func reconcilePodDisruptionBudget(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster) error {
+	if hasDisruptionBudget(ec) {
+		pdb := newPodDisruptionBudget(ec)
+		if err := setWorkloadOwner(ec, scheme, pdb); err != nil {
+			return err
+		}
+		if err := applyOwnedObject(ctx, c, recorder, ec, pdb); err != nil {
+			return fmt.Errorf("failed to apply the PodDisruptionBudget: %w", err)
+		}
+		return nil
+	}
+
+	pdb := &policyv1.PodDisruptionBudget{}
+	if err := c.Get(ctx, client.ObjectKey{Name: ec.Name, Namespace: ec.Namespace}, pdb); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !isControlledBy(pdb, ec) {
+		return nil
+	}
+	return client.IgnoreNotFound(c.Delete(ctx, pdb))
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestNewPodDisruptionBudget(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"}}
+	pdb := newPodDisruptionBudget(ec)
+	assert.Equal(t, "test-etcd", pdb.Name)
+	assert.Equal(t, ptr.To(intstr.FromInt32(1)), pdb.Spec.MaxUnavailable)
+	assert.Equal(t, map[string]string{"app": "test-etcd", "controller": "test-etcd"}, pdb.Spec.Selector.MatchLabels)
+
+	assert.True(t, hasDisruptionBudget(ec))
+	ec.Spec.PodTemplate = &ecv1alpha1.PodTemplate{}
+	assert.True(t, hasDisruptionBudget(ec))
+	ec.Spec.PodTemplate.DisruptionBudget = ptr.To(false)
+	assert.False(t, hasDisruptionBudget(ec))
+}
+
+func TestReconcilePodDisruptionBudget(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default", UID: "ec-uid"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Size: 3},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).
+		WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	recorder := record.NewFakeRecorder(10)
+
+	assert.NoError(t, reconcilePodDisruptionBudget(ctx, fakeClient, scheme, recorder, ec))
+	pdb := &policyv1.PodDisruptionBudget{}
+	key := types.NamespacedName{Name: "test-etcd", Namespace: "default"}
+	assert.NoError(t, fakeClient.Get(ctx, key, pdb))
+	assert.True(t, metav1.IsControlledBy(pdb, ec))
+	assert.Equal(t, ptr.To(intstr.FromInt32(1)), pdb.Spec.MaxUnavailable)
+
+	// A PodDisruptionBudget of the same name the operator doesn't control is kept.
+	if ec.Spec.PodTemplate == nil {
+		ec.Spec.PodTemplate = &ecv1alpha1.PodTemplate{}
+	}
+	ec.Spec.PodTemplate.DisruptionBudget = ptr.To(false)
+	other := ec.DeepCopy()
+	other.UID = "other-uid"
+	assert.NoError(t, reconcilePodDisruptionBudget(ctx, fakeClient, scheme, recorder, other))
+	assert.NoError(t, fakeClient.Get(ctx, key, pdb))
+
+	assert.NoError(t, reconcilePodDisruptionBudget(ctx, fakeClient, scheme, recorder, ec))
+	err := fakeClient.Get(ctx, key, pdb)
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	// Nothing to delete.
+	assert.NoError(t, reconcilePodDisruptionBudget(ctx, fakeClient, scheme, recorder, ec))
+}
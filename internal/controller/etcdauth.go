@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// authResyncPeriod is how often the EtcdUsers and the EtcdRoles are synced to
+// etcd again, undoing the changes made by other means, and catching up with
+// the password Secrets, which aren't watched.
+const authResyncPeriod = 5 * time.Minute
+
+const (
+	reasonAuthSynced      = "Synced"
+	reasonAuthSyncFailed  = "SyncFailed"
+	reasonClusterNotFound = "ClusterNotFound"
+	reasonClusterNotReady = "ClusterNotReady"
+)
+
+// authSyncFunc syncs an EtcdUser or an EtcdRole to the etcd cluster reached
+// through c at eps, and reports whether it changed anything.
+type authSyncFunc func(c *etcdutils.ClusterClient, eps []string) (bool, error)
+
+// authReconcile is the reconcile shared by the EtcdUsers and the EtcdRoles.
+type authReconcile struct {
+	client.Client
+	Recorder    record.EventRecorder
+	EtcdClients *etcdutils.ClientPool
+	Shard       Shard
+
+	// clusterName is the name of the EtcdCluster of the reconciled object.
+	clusterName string
+	// conditions and observedGeneration are the status of the reconciled
+	// object.
+	conditions         *[]metav1.Condition
+	observedGeneration *int64
+}
+
+// getAuthCluster returns the EtcdCluster name of namespace, or nil when it
+// doesn't exist.
+func getAuthCluster(ctx context.Context, c client.Reader, namespace, name string) (*ecv1alpha1.EtcdCluster, error) {
+	ec := &ecv1alpha1.EtcdCluster{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, ec); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return ec, nil
+}
+
+// etcdClient returns the client of the members of ec, and their endpoints.
+func (r *authReconcile) etcdClient(ctx context.Context, ec *ecv1alpha1.EtcdCluster) (*etcdutils.ClusterClient, []string, error) {
+	tlsConfig, err := clusterTLSConfig(ctx, r.Client, ec)
+	if err != nil {
+		return nil, nil, err
+	}
+	creds, err := clusterCredentials(ctx, r.Client, ec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.EtcdClients.Cluster(ec.Namespace+"/"+ec.Name, tlsConfig, creds), strings.Split(ec.Status.Endpoints, ","), nil
+}
+
+// reconcile keeps the EtcdAuthFinalizer on obj, and syncs it to its
+// EtcdCluster with sync. Once obj is deleting, it deletes it from the
+// EtcdCluster with remove, and releases obj; there is nothing left to delete
+// when the EtcdCluster doesn't exist. The outcome of the sync is recorded in
+// the status of obj.
+func (r *authReconcile) reconcile(ctx context.Context, obj client.Object, sync authSyncFunc, remove func(c *etcdutils.ClusterClient, eps []string) error) (ctrl.Result, error) {
+	ec, err := getAuthCluster(ctx, r.Client, obj.GetNamespace(), r.clusterName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Without its EtcdCluster, obj follows its own shard.
+	if (ec != nil && !r.Shard.owns(ec)) || (ec == nil && !r.Shard.owns(obj)) {
+		return ctrl.Result{}, nil
+	}
+	base := obj.DeepCopyObject().(client.Object)
+
+	if !obj.GetDeletionTimestamp().IsZero() {
+		if !controllerutil.ContainsFinalizer(obj, ecv1alpha1.EtcdAuthFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		if ec != nil && ec.Status.Endpoints != "" {
+			c, eps, err := r.etcdClient(ctx, ec)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if err := remove(c, eps); err != nil {
+				r.Recorder.Event(obj, corev1.EventTypeWarning, "DeleteFailed", err.Error())
+				return ctrl.Result{}, err
+			}
+		}
+		controllerutil.RemoveFinalizer(obj, ecv1alpha1.EtcdAuthFinalizer)
+		return ctrl.Result{}, r.Patch(ctx, obj, client.MergeFrom(base))
+	}
+
+	if controllerutil.AddFinalizer(obj, ecv1alpha1.EtcdAuthFinalizer) {
+		if err := r.Patch(ctx, obj, client.MergeFrom(base)); err != nil {
+			return ctrl.Result{}, err
+		}
+		base = obj.DeepCopyObject().(client.Object)
+	}
+
+	condition := metav1.Condition{
+		Type:               ecv1alpha1.EtcdAuthConditionSynced,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: obj.GetGeneration(),
+	}
+	// The EtcdClusters aren't watched, their changes are caught up with
+	// by polling.
+	result := ctrl.Result{RequeueAfter: requeueDuration}
+	var syncErr error
+	switch {
+	case ec == nil:
+		condition.Reason = reasonClusterNotFound
+		condition.Message = fmt.Sprintf("EtcdCluster %s not found", r.clusterName)
+	case ec.Status.Endpoints == "":
+		condition.Reason = reasonClusterNotReady
+		condition.Message = fmt.Sprintf("Waiting for EtcdCluster %s to publish its endpoints", ec.Name)
+	default:
+		changed := false
+		c, eps, err := r.etcdClient(ctx, ec)
+		if err == nil {
+			changed, err = sync(c, eps)
+		}
+		if err != nil {
+			syncErr = err
+			condition.Reason = reasonAuthSyncFailed
+			condition.Message = err.Error()
+			r.Recorder.Event(obj, corev1.EventTypeWarning, "SyncFailed", err.Error())
+			break
+		}
+		if changed {
+			r.Recorder.Eventf(obj, corev1.EventTypeNormal, "Synced", "Synced to EtcdCluster %s", ec.Name)
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonAuthSynced
+		condition.Message = fmt.Sprintf("Synced to EtcdCluster %s", ec.Name)
+		*r.observedGeneration = obj.GetGeneration()
+		result = ctrl.Result{RequeueAfter: authResyncPeriod}
+	}
+	meta.SetStatusCondition(r.conditions, condition)
+
+	if err := r.Status().Patch(ctx, obj, client.MergeFrom(base)); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, syncErr
+}
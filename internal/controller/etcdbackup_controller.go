@@ -0,0 +1,531 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+	"go.etcd.io/etcd-operator/internal/snapshotstatus"
+)
+
+const (
+	// uploadContainerName is the container of the backup Jobs uploading the
+	// snapshot. It writes the size of the snapshot to its termination
+	// message.
+	uploadContainerName = "upload"
+	// verifyContainerName is the container of the verification Jobs writing
+	// the status of the snapshot to its termination message, as JSON.
+	verifyContainerName = "status"
+
+	// encryptionKeyDir is where the key of the snapshot encryption is mounted
+	// in the backup and restore Jobs.
+	encryptionKeyDir = "/var/run/secrets/encryption"
+)
+
+// EtcdBackupReconciler takes the snapshots of EtcdClusters described by
+// EtcdBackups, and uploads them to their storage. Each EtcdBackup is taken
+// once, by a Job owned by the EtcdBackup, and then verified by another Job
+// when it asks for it.
+type EtcdBackupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// MaxConcurrentReconciles is the number of EtcdBackups reconciled in
+	// parallel. It defaults to 1 when not set.
+	MaxConcurrentReconciles int
+	// EtcdClients caches the connections to the etcd clusters. A new pool is
+	// created when not set.
+	EtcdClients *etcdutils.ClientPool
+	// Shard selects the EtcdClusters reconciled by this instance of the
+	// operator. The EtcdBackups follow the shard of their EtcdCluster.
+	Shard Shard
+	// OperatorImage is the image of the operator, run by the backup Jobs to
+	// encrypt the snapshots, and by the verification Jobs. The encrypted
+	// backups and the verifications fail when it isn't set.
+	OperatorImage string
+	// HostPathDirs are the directories of the nodes the snapshots of the
+	// HostPath provider may be written to, see snapshotStorage.check.
+	HostPathDirs []string
+}
+
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdbackups,verbs=get;list;watch
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdbackups/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create
+
+// Reconcile starts the backup Job of an EtcdBackup, and records its outcome
+// once it finishes. It then verifies the snapshot the same way, when the
+// EtcdBackup asks for it.
+func (r *EtcdBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	backup := &ecv1alpha1.EtcdBackup{}
+	if err := r.Get(ctx, req.NamespacedName, backup); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	// The completed backups are seen again when the operator starts.
+	clusters.observeBackup(backup)
+	if backup.Status.Phase == ecv1alpha1.EtcdBackupPhaseFailed ||
+		(backup.Status.Phase == ecv1alpha1.EtcdBackupPhaseCompleted && !verificationPending(backup)) {
+		return ctrl.Result{}, nil
+	}
+	if isPaused(backup) {
+		logger.Info("Reconciliation is paused")
+		return ctrl.Result{}, nil
+	}
+	base := backup.DeepCopy()
+	if backup.Status.Phase == ecv1alpha1.EtcdBackupPhaseCompleted {
+		return r.reconcileVerification(ctx, backup, base)
+	}
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Name: backupJobName(backup), Namespace: backup.Namespace}, job)
+	if err == nil {
+		if !r.recordJobOutcome(ctx, backup, job) {
+			// The Job changes trigger a new reconcile.
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{Requeue: verificationPending(backup)}, r.Status().Patch(ctx, backup, client.MergeFrom(base))
+	}
+	if !k8serrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	storage, ok := backupStorage(backup)
+	if !ok {
+		r.fail(backup, fmt.Sprintf("the backup has no destination for the %s storage provider", backup.Spec.StorageProvider))
+		return ctrl.Result{}, r.Status().Patch(ctx, backup, client.MergeFrom(base))
+	}
+	if err := storage.check(r.HostPathDirs); err != nil {
+		r.fail(backup, err.Error())
+		return ctrl.Result{}, r.Status().Patch(ctx, backup, client.MergeFrom(base))
+	}
+	if backup.Spec.Encryption != nil && r.OperatorImage == "" {
+		r.fail(backup, "the snapshot can't be encrypted, the operator runs without --operator-image")
+		return ctrl.Result{}, r.Status().Patch(ctx, backup, client.MergeFrom(base))
+	}
+
+	ec := &ecv1alpha1.EtcdCluster{}
+	if err := r.Get(ctx, client.ObjectKey{Name: backup.Spec.ClusterName, Namespace: backup.Namespace}, ec); err != nil {
+		if k8serrors.IsNotFound(err) {
+			r.fail(backup, fmt.Sprintf("EtcdCluster %s not found", backup.Spec.ClusterName))
+			return ctrl.Result{}, r.Status().Patch(ctx, backup, client.MergeFrom(base))
+		}
+		return ctrl.Result{}, err
+	}
+	if !r.Shard.owns(ec) {
+		return ctrl.Result{}, nil
+	}
+	if ec.Status.Endpoints == "" {
+		logger.Info("Waiting for the EtcdCluster to publish its endpoints", "cluster", ec.Name)
+		return ctrl.Result{RequeueAfter: requeueDuration}, nil
+	}
+
+	// The status is written before the Job is created, so the revision is
+	// the one of the cluster before the snapshot.
+	if backup.Status.StartTime == nil {
+		revision, err := r.clusterRevision(ctx, ec)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		now := metav1.Now()
+		backup.Status.Phase = ecv1alpha1.EtcdBackupPhaseRunning
+		backup.Status.StartTime = &now
+		backup.Status.Revision = revision
+		backup.Status.Location = storage.location()
+		if err := r.Status().Patch(ctx, backup, client.MergeFrom(base)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	job = newBackupJob(backup, ec, storage, r.OperatorImage)
+	if err := controllerutil.SetControllerReference(backup, job, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, job); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+	logger.Info("Started backup", "cluster", ec.Name, "location", backup.Status.Location)
+	return ctrl.Result{}, nil
+}
+
+// reconcileVerification starts the verification Job of backup, a completed
+// backup asking for one, and records its outcome once it finishes.
+func (r *EtcdBackupReconciler) reconcileVerification(ctx context.Context, backup, base *ecv1alpha1.EtcdBackup) (ctrl.Result, error) {
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Name: verifyJobName(backup), Namespace: backup.Namespace}, job)
+	if err == nil {
+		if !r.recordVerificationOutcome(ctx, backup, job) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, r.Status().Patch(ctx, backup, client.MergeFrom(base))
+	}
+	if !k8serrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	if r.OperatorImage == "" {
+		r.failVerification(backup, "the snapshot can't be verified, the operator runs without --operator-image")
+		return ctrl.Result{}, r.Status().Patch(ctx, backup, client.MergeFrom(base))
+	}
+	// The etcd version of the cluster restores the snapshot.
+	ec := &ecv1alpha1.EtcdCluster{}
+	if err := r.Get(ctx, client.ObjectKey{Name: backup.Spec.ClusterName, Namespace: backup.Namespace}, ec); err != nil {
+		if k8serrors.IsNotFound(err) {
+			r.failVerification(backup, fmt.Sprintf("EtcdCluster %s not found", backup.Spec.ClusterName))
+			return ctrl.Result{}, r.Status().Patch(ctx, backup, client.MergeFrom(base))
+		}
+		return ctrl.Result{}, err
+	}
+	if !r.Shard.owns(ec) {
+		return ctrl.Result{}, nil
+	}
+
+	// A completed backup has a destination.
+	storage, _ := backupStorage(backup)
+	job = newVerifyJob(backup, ec, storage, r.OperatorImage)
+	if err := controllerutil.SetControllerReference(backup, job, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, job); err != nil && !k8serrors.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+	log.FromContext(ctx).Info("Started the verification of the backup", "location", backup.Status.Location)
+	return ctrl.Result{}, nil
+}
+
+// clusterRevision returns the revision of ec, as reported by the first of its
+// healthy members.
+func (r *EtcdBackupReconciler) clusterRevision(ctx context.Context, ec *ecv1alpha1.EtcdCluster) (int64, error) {
+	tlsConfig, err := clusterTLSConfig(ctx, r.Client, ec)
+	if err != nil {
+		return 0, err
+	}
+	creds, err := clusterCredentials(ctx, r.Client, ec)
+	if err != nil {
+		return 0, err
+	}
+	eps := strings.Split(ec.Status.Endpoints, ",")
+	health, err := r.EtcdClients.Cluster(ec.Namespace+"/"+ec.Name, tlsConfig, creds).ClusterHealth(eps)
+	if err != nil {
+		return 0, err
+	}
+	for _, h := range health {
+		if h.Health && h.Status != nil && h.Status.Header != nil {
+			return h.Status.Header.Revision, nil
+		}
+	}
+	return 0, fmt.Errorf("no healthy member of EtcdCluster %s", ec.Name)
+}
+
+// recordJobOutcome records the outcome of job, the backup Job of backup, in
+// the status of backup. It reports whether job is finished.
+func (r *EtcdBackupReconciler) recordJobOutcome(ctx context.Context, backup *ecv1alpha1.EtcdBackup, job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			size, err := r.snapshotSize(ctx, job)
+			if err != nil {
+				log.FromContext(ctx).Error(err, "Failed to read the size of the snapshot")
+			}
+			backup.Status.Phase = ecv1alpha1.EtcdBackupPhaseCompleted
+			backup.Status.Size = size
+			backup.Status.CompletionTime = ptr.To(metav1.Now())
+			clusters.observeBackup(backup)
+			r.Recorder.Eventf(backup, corev1.EventTypeNormal, "BackupCompleted", "Uploaded the snapshot to %s", backup.Status.Location)
+			return true
+		case batchv1.JobFailed:
+			r.fail(backup, fmt.Sprintf("backup Job %s failed: %s", job.Name, c.Message))
+			return true
+		}
+	}
+	return false
+}
+
+// recordVerificationOutcome records the outcome of job, the verification
+// Job of backup, in the status of backup. It reports whether job is
+// finished.
+func (r *EtcdBackupReconciler) recordVerificationOutcome(ctx context.Context, backup *ecv1alpha1.EtcdBackup, job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			var st snapshotstatus.Status
+			message, err := r.terminationMessage(ctx, job, verifyContainerName)
+			if err == nil {
+				err = json.Unmarshal([]byte(message), &st)
+			}
+			if err != nil {
+				log.FromContext(ctx).Error(err, "Failed to read the status of the snapshot")
+			}
+			backup.Status.Verified = ptr.To(true)
+			backup.Status.SnapshotRevision = st.Revision
+			backup.Status.SnapshotHash = int64(st.Hash)
+			r.Recorder.Eventf(backup, corev1.EventTypeNormal, "BackupVerified", "Verified the snapshot, at revision %d", st.Revision)
+			return true
+		case batchv1.JobFailed:
+			r.failVerification(backup, fmt.Sprintf("verification Job %s failed: %s", job.Name, c.Message))
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotSize returns the size of the snapshot uploaded by job, from the
+// termination message of its upload container.
+func (r *EtcdBackupReconciler) snapshotSize(ctx context.Context, job *batchv1.Job) (int64, error) {
+	message, err := r.terminationMessage(ctx, job, uploadContainerName)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(message), 10, 64)
+}
+
+// terminationMessage returns the termination message of the container of a
+// succeeded Pod of job.
+func (r *EtcdBackupReconciler) terminationMessage(ctx context.Context, job *batchv1.Job, container string) (string, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return "", err
+	}
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name != container || cs.State.Terminated == nil || cs.State.Terminated.ExitCode != 0 {
+				continue
+			}
+			return cs.State.Terminated.Message, nil
+		}
+	}
+	return "", fmt.Errorf("no succeeded Pod of Job %s", job.Name)
+}
+
+// fail marks backup as failed with message.
+func (r *EtcdBackupReconciler) fail(backup *ecv1alpha1.EtcdBackup, message string) {
+	backup.Status.Phase = ecv1alpha1.EtcdBackupPhaseFailed
+	backup.Status.Message = message
+	r.Recorder.Event(backup, corev1.EventTypeWarning, "BackupFailed", message)
+}
+
+// failVerification marks the snapshot of backup as not verified, with
+// message. The backup stays completed.
+func (r *EtcdBackupReconciler) failVerification(backup *ecv1alpha1.EtcdBackup, message string) {
+	backup.Status.Verified = ptr.To(false)
+	backup.Status.Message = message
+	r.Recorder.Event(backup, corev1.EventTypeWarning, "VerificationFailed", message)
+}
+
+// verificationPending reports whether backup asks for a verification of its
+// snapshot which didn't finish yet.
+func verificationPending(backup *ecv1alpha1.EtcdBackup) bool {
+	return backup.Spec.Verify && backup.Status.Verified == nil
+}
+
+// backupJobName returns the name of the Job taking the snapshot of backup.
+func backupJobName(backup *ecv1alpha1.EtcdBackup) string {
+	return backup.Name + "-snapshot"
+}
+
+// verifyJobName returns the name of the Job verifying the snapshot of
+// backup.
+func verifyJobName(backup *ecv1alpha1.EtcdBackup) string {
+	return backup.Name + "-verify"
+}
+
+// encryptionKeyVolume returns the volume of the key of encryption, mounted
+// at encryptionKeyDir by the containers of newSnapshotCryptContainer.
+func encryptionKeyVolume(encryption *ecv1alpha1.SnapshotEncryption) corev1.Volume {
+	return corev1.Volume{Name: "encryption-key", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+		SecretName: encryption.KeySecretRef.Name,
+		Items:      []corev1.KeyToPath{{Key: encryption.KeySecretRef.Key, Path: "key"}},
+	}}}
+}
+
+// newSnapshotCryptContainer returns the container running `manager snapshot`
+// from image, the image of the operator, to encrypt or decrypt the snapshot
+// at in to out, with the key of encryptionKeyVolume. It runs as root, like
+// the etcd images: etcdctl saves the snapshots readable by their owner only.
+func newSnapshotCryptContainer(name, image, in, out string, mounts ...corev1.VolumeMount) corev1.Container {
+	return corev1.Container{
+		Name:  name,
+		Image: image,
+		Command: []string{"/manager", "snapshot", name,
+			"-key-file", path.Join(encryptionKeyDir, "key"), "-in", in, "-out", out},
+		VolumeMounts: append(slices.Clone(mounts), corev1.VolumeMount{Name: "encryption-key", MountPath: encryptionKeyDir, ReadOnly: true}),
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser:    ptr.To[int64](0),
+			RunAsNonRoot: ptr.To(false),
+		},
+	}
+}
+
+// newBackupJob returns the Job taking the snapshot of ec for backup, and
+// uploading it to storage. etcdctl saves the snapshot of a single member,
+// the first endpoint of ec, to a volume shared with the container uploading
+// it. The snapshot is encrypted in between with operatorImage, the image of
+// the operator, when backup asks for it.
+func newBackupJob(backup *ecv1alpha1.EtcdBackup, ec *ecv1alpha1.EtcdCluster, storage snapshotStorage, operatorImage string) *batchv1.Job {
+	mounts := []corev1.VolumeMount{{Name: "backup", MountPath: "/backup"}}
+	snapshot, uploaded := "/backup/snapshot.db", "/backup/snapshot.db"
+	if backup.Spec.Encryption != nil {
+		uploaded = "/backup/snapshot.db.enc"
+	}
+	labels := withManagedByLabel(map[string]string{
+		"app":       ec.Name,
+		"component": "backup",
+	})
+	upload := storage.container(uploadContainerName, uploadSnapshot, mounts...)
+	upload.Env = append(upload.Env, corev1.EnvVar{Name: "SNAPSHOT", Value: uploaded})
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupJobName(backup),
+			Namespace: backup.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](2),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: backup.Spec.ServiceAccountName,
+					InitContainers: []corev1.Container{{
+						Name:    "snapshot",
+						Image:   fmt.Sprintf("gcr.io/etcd-development/etcd:%s", ec.Spec.Version),
+						Command: []string{"/usr/local/bin/etcdctl", "snapshot", "save", snapshot},
+						Env: []corev1.EnvVar{
+							{Name: "ETCDCTL_API", Value: "3"},
+							{Name: "ETCDCTL_ENDPOINTS", Value: strings.Split(ec.Status.Endpoints, ",")[0]},
+						},
+						VolumeMounts: mounts,
+					}},
+					Containers: []corev1.Container{upload},
+					Volumes: []corev1.Volume{{
+						Name:         "backup",
+						VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					}},
+				},
+			},
+		},
+	}
+	storage.configurePod(&job.Spec.Template)
+	podSpec := &job.Spec.Template.Spec
+	addClientTLS(ec, podSpec, &podSpec.InitContainers[0])
+	addRootCredentials(ec, &podSpec.InitContainers[0])
+	if backup.Spec.Encryption != nil {
+		podSpec.InitContainers = append(podSpec.InitContainers, newSnapshotCryptContainer("encrypt", operatorImage, snapshot, uploaded, mounts...))
+		podSpec.Volumes = append(podSpec.Volumes, encryptionKeyVolume(backup.Spec.Encryption))
+	}
+	return job
+}
+
+// newVerifyJob returns the Job verifying the snapshot of backup, uploaded to
+// storage. An init container downloads the snapshot, and another one
+// decrypts it with operatorImage, the image of the operator, when it is
+// encrypted. etcdutl, from the etcd image of ec, then restores it to a
+// scratch directory, checking its integrity, and operatorImage writes its
+// status to the termination message of the verifyContainerName container.
+func newVerifyJob(backup *ecv1alpha1.EtcdBackup, ec *ecv1alpha1.EtcdCluster, storage snapshotStorage, operatorImage string) *batchv1.Job {
+	snapshotMount := corev1.VolumeMount{Name: "snapshot", MountPath: restoreSnapshotDir}
+	scratchMount := corev1.VolumeMount{Name: "scratch", MountPath: "/scratch"}
+	snapshotPath := path.Join(restoreSnapshotDir, "snapshot.db")
+	initContainers := []corev1.Container{storage.container("fetch", fetchSnapshot, snapshotMount)}
+	volumes := []corev1.Volume{
+		{Name: "snapshot", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		{Name: "scratch", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	if backup.Spec.Encryption != nil {
+		decryptedMount := corev1.VolumeMount{Name: "decrypted", MountPath: restoreDecryptedDir}
+		decrypted := path.Join(restoreDecryptedDir, "snapshot.db")
+		initContainers = append(initContainers, newSnapshotCryptContainer("decrypt", operatorImage, snapshotPath, decrypted, snapshotMount, decryptedMount))
+		volumes = append(volumes,
+			corev1.Volume{Name: "decrypted", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			encryptionKeyVolume(backup.Spec.Encryption),
+		)
+		snapshotPath, snapshotMount = decrypted, decryptedMount
+	}
+	initContainers = append(initContainers, corev1.Container{
+		Name:         "restore",
+		Image:        fmt.Sprintf("gcr.io/etcd-development/etcd:%s", ec.Spec.Version),
+		Command:      []string{"/usr/local/bin/etcdutl", "snapshot", "restore", snapshotPath, "--data-dir=/scratch/data"},
+		VolumeMounts: []corev1.VolumeMount{snapshotMount, scratchMount},
+	})
+
+	labels := withManagedByLabel(map[string]string{
+		"app":       ec.Name,
+		"component": "backup",
+	})
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      verifyJobName(backup),
+			Namespace: backup.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](2),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: backup.Spec.ServiceAccountName,
+					InitContainers:     initContainers,
+					Containers: []corev1.Container{{
+						Name:  verifyContainerName,
+						Image: operatorImage,
+						Command: []string{"/manager", "snapshot", "status",
+							"-in", snapshotPath, "-out", "/dev/termination-log"},
+						VolumeMounts: []corev1.VolumeMount{snapshotMount},
+						// The snapshots are readable by their owner only.
+						SecurityContext: &corev1.SecurityContext{
+							RunAsUser:    ptr.To[int64](0),
+							RunAsNonRoot: ptr.To(false),
+						},
+					}},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+	storage.configurePod(&job.Spec.Template)
+	return job
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("etcdbackup-controller")
+	if r.EtcdClients == nil {
+		r.EtcdClients = etcdutils.NewClientPool()
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ecv1alpha1.EtcdBackup{}).
+		Owns(&batchv1.Job{}).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			NewQueue:                newTrackedQueue("etcdbackups", nil),
+		}).
+		Complete(r)
+}
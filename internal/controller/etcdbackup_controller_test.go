@@ -0,0 +1,362 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func newTestBackup() *ecv1alpha1.EtcdBackup {
+	return &ecv1alpha1.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default", UID: "backup-uid"},
+		Spec: ecv1alpha1.EtcdBackupSpec{
+			ClusterName: "etcd",
+			S3: &ecv1alpha1.S3BackupDestination{
+				Bucket:               "etcd-backups",
+				CredentialsSecretRef: corev1.LocalObjectReference{Name: "etcd-backup-s3"},
+			},
+		},
+	}
+}
+
+func TestNewBackupJob(t *testing.T) {
+	backup := newTestBackup()
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "default"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Version: "v3.5.21"},
+		Status: ecv1alpha1.EtcdClusterStatus{
+			Endpoints: "http://etcd-0.etcd.default.svc.cluster.local:2379,http://etcd-1.etcd.default.svc.cluster.local:2379",
+		},
+	}
+
+	storage, _ := backupStorage(backup)
+	job := newBackupJob(backup, ec, storage, "")
+	assert.Equal(t, "nightly-snapshot", job.Name)
+	podSpec := job.Spec.Template.Spec
+	assert.Equal(t, corev1.RestartPolicyNever, podSpec.RestartPolicy)
+	assert.Equal(t, managedByValue, job.Spec.Template.Labels[managedByLabel])
+	assert.Equal(t, "gcr.io/etcd-development/etcd:v3.5.21", podSpec.InitContainers[0].Image)
+	assert.Contains(t, podSpec.InitContainers[0].Env, corev1.EnvVar{Name: "ETCDCTL_ENDPOINTS", Value: "http://etcd-0.etcd.default.svc.cluster.local:2379"})
+	upload := podSpec.Containers[0]
+	assert.Contains(t, upload.Env, corev1.EnvVar{Name: "KEY", Value: "default/etcd/nightly.db"})
+	assert.Equal(t, "etcd-backup-s3", upload.Env[3].ValueFrom.SecretKeyRef.Name)
+	assert.NotContains(t, upload.Env, corev1.EnvVar{Name: "AWS_DEFAULT_REGION"})
+
+	backup.Spec.S3.Key = "etcd/latest.db"
+	backup.Spec.S3.Region = "eu-west-1"
+	storage, _ = backupStorage(backup)
+	upload = newBackupJob(backup, ec, storage, "").Spec.Template.Spec.Containers[0]
+	assert.Contains(t, upload.Env, corev1.EnvVar{Name: "KEY", Value: "etcd/latest.db"})
+	assert.Contains(t, upload.Env, corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: "eu-west-1"})
+	assert.Contains(t, upload.Env, corev1.EnvVar{Name: "SNAPSHOT", Value: "/backup/snapshot.db"})
+
+	backup.Spec.Encryption = &ecv1alpha1.SnapshotEncryption{KeySecretRef: corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "etcd-backup-key"},
+		Key:                  "aes.key",
+	}}
+	podSpec = newBackupJob(backup, ec, storage, "etcd-operator:v0.1").Spec.Template.Spec
+	encrypt := podSpec.InitContainers[1]
+	assert.Equal(t, "etcd-operator:v0.1", encrypt.Image)
+	assert.Equal(t, []string{"/manager", "snapshot", "encrypt",
+		"-key-file", "/var/run/secrets/encryption/key", "-in", "/backup/snapshot.db", "-out", "/backup/snapshot.db.enc"}, encrypt.Command)
+	assert.Contains(t, podSpec.Containers[0].Env, corev1.EnvVar{Name: "SNAPSHOT", Value: "/backup/snapshot.db.enc"})
+	key := podSpec.Volumes[len(podSpec.Volumes)-1].Secret
+	assert.Equal(t, "etcd-backup-key", key.SecretName)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "aes.key", Path: "key"}}, key.Items)
+}
+
+func TestEtcdBackupReconcile(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = batchv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "default"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Version: "v3.5.21"},
+	}
+	started := metav1.NewTime(time.Date(2025, 1, 31, 2, 0, 0, 0, time.UTC))
+	finishedJob := func(condition batchv1.JobConditionType, message string) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly-snapshot", Namespace: "default"},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: condition, Status: corev1.ConditionTrue, Message: message},
+			}},
+		}
+	}
+	uploadPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nightly-snapshot-x7k2p",
+			Namespace: "default",
+			Labels:    map[string]string{batchv1.JobNameLabel: "nightly-snapshot"},
+		},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  uploadContainerName,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: "2088992\n"}},
+		}}},
+	}
+
+	tests := []struct {
+		name       string
+		status     ecv1alpha1.EtcdBackupStatus
+		endpoints  string
+		objs       []client.Object
+		noCluster  bool
+		noStorage  bool
+		hostPath   bool
+		paused     bool
+		encrypted  bool
+		wantResult ctrl.Result
+		wantPhase  ecv1alpha1.EtcdBackupPhase
+		wantSize   int64
+		wantJob    bool
+	}{
+		{
+			name:      "missing cluster",
+			noCluster: true,
+			wantPhase: ecv1alpha1.EtcdBackupPhaseFailed,
+		},
+		{
+			name:       "cluster without endpoints",
+			wantResult: ctrl.Result{RequeueAfter: requeueDuration},
+		},
+		{
+			name:      "started backup without a Job",
+			status:    ecv1alpha1.EtcdBackupStatus{Phase: ecv1alpha1.EtcdBackupPhaseRunning, StartTime: &started},
+			endpoints: "http://etcd-0.etcd.default.svc.cluster.local:2379",
+			wantPhase: ecv1alpha1.EtcdBackupPhaseRunning,
+			wantJob:   true,
+		},
+		{
+			name:      "paused backup",
+			status:    ecv1alpha1.EtcdBackupStatus{Phase: ecv1alpha1.EtcdBackupPhaseRunning, StartTime: &started},
+			endpoints: "http://etcd-0.etcd.default.svc.cluster.local:2379",
+			paused:    true,
+			wantPhase: ecv1alpha1.EtcdBackupPhaseRunning,
+		},
+		{
+			name:      "backup without a destination",
+			endpoints: "http://etcd-0.etcd.default.svc.cluster.local:2379",
+			noStorage: true,
+			wantPhase: ecv1alpha1.EtcdBackupPhaseFailed,
+		},
+		{
+			name:      "backup to a directory the operator doesn't allow",
+			endpoints: "http://etcd-0.etcd.default.svc.cluster.local:2379",
+			hostPath:  true,
+			wantPhase: ecv1alpha1.EtcdBackupPhaseFailed,
+		},
+		{
+			name:      "encrypted backup without the operator image",
+			endpoints: "http://etcd-0.etcd.default.svc.cluster.local:2379",
+			encrypted: true,
+			wantPhase: ecv1alpha1.EtcdBackupPhaseFailed,
+		},
+		{
+			name:      "completed Job",
+			status:    ecv1alpha1.EtcdBackupStatus{Phase: ecv1alpha1.EtcdBackupPhaseRunning, StartTime: &started},
+			objs:      []client.Object{finishedJob(batchv1.JobComplete, ""), uploadPod},
+			wantPhase: ecv1alpha1.EtcdBackupPhaseCompleted,
+			wantSize:  2088992,
+			wantJob:   true,
+		},
+		{
+			name:      "failed Job",
+			status:    ecv1alpha1.EtcdBackupStatus{Phase: ecv1alpha1.EtcdBackupPhaseRunning, StartTime: &started},
+			objs:      []client.Object{finishedJob(batchv1.JobFailed, "BackoffLimitExceeded")},
+			wantPhase: ecv1alpha1.EtcdBackupPhaseFailed,
+			wantJob:   true,
+		},
+		{
+			name:      "finished backup",
+			status:    ecv1alpha1.EtcdBackupStatus{Phase: ecv1alpha1.EtcdBackupPhaseCompleted, Size: 1024},
+			wantPhase: ecv1alpha1.EtcdBackupPhaseCompleted,
+			wantSize:  1024,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup := newTestBackup()
+			backup.Status = tt.status
+			if tt.paused {
+				backup.Annotations = map[string]string{ecv1alpha1.PausedAnnotation: "true"}
+			}
+			if tt.noStorage {
+				backup.Spec.StorageProvider = ecv1alpha1.StorageProviderGCS
+			}
+			if tt.encrypted {
+				backup.Spec.Encryption = &ecv1alpha1.SnapshotEncryption{}
+			}
+			if tt.hostPath {
+				backup.Spec.StorageProvider = ecv1alpha1.StorageProviderHostPath
+				backup.Spec.S3 = nil
+				backup.Spec.HostPath = &ecv1alpha1.HostPathBackupDestination{NodeName: "node-1", Directory: "/etc"}
+			}
+			objs := append([]client.Object{backup}, tt.objs...)
+			if !tt.noCluster {
+				cluster := ec.DeepCopy()
+				cluster.Status.Endpoints = tt.endpoints
+				objs = append(objs, cluster)
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(&ecv1alpha1.EtcdBackup{}).Build()
+			r := &EtcdBackupReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10), HostPathDirs: []string{"/var/backups"}}
+
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "nightly", Namespace: "default"}})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantResult, result)
+
+			got := &ecv1alpha1.EtcdBackup{}
+			assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(backup), got))
+			assert.Equal(t, tt.wantPhase, got.Status.Phase)
+			assert.Equal(t, tt.wantSize, got.Status.Size)
+			if tt.wantPhase == ecv1alpha1.EtcdBackupPhaseCompleted && tt.status.Phase != tt.wantPhase {
+				assert.NotNil(t, got.Status.CompletionTime)
+			}
+
+			job := &batchv1.Job{}
+			err = c.Get(ctx, client.ObjectKey{Name: "nightly-snapshot", Namespace: "default"}, job)
+			assert.Equal(t, tt.wantJob, err == nil)
+		})
+	}
+}
+
+func TestNewVerifyJob(t *testing.T) {
+	backup := newTestBackup()
+	backup.Spec.Verify = true
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "default"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Version: "v3.5.21"},
+	}
+	storage, _ := backupStorage(backup)
+
+	job := newVerifyJob(backup, ec, storage, "etcd-operator:v0.1")
+	assert.Equal(t, "nightly-verify", job.Name)
+	podSpec := job.Spec.Template.Spec
+	assert.Equal(t, []string{"fetch", "restore"}, []string{podSpec.InitContainers[0].Name, podSpec.InitContainers[1].Name})
+	assert.Contains(t, podSpec.InitContainers[0].Env, corev1.EnvVar{Name: "KEY", Value: "default/etcd/nightly.db"})
+	assert.Equal(t, "gcr.io/etcd-development/etcd:v3.5.21", podSpec.InitContainers[1].Image)
+	assert.Equal(t, []string{"/usr/local/bin/etcdutl", "snapshot", "restore", "/snapshot/snapshot.db", "--data-dir=/scratch/data"},
+		podSpec.InitContainers[1].Command)
+	status := podSpec.Containers[0]
+	assert.Equal(t, verifyContainerName, status.Name)
+	assert.Equal(t, "etcd-operator:v0.1", status.Image)
+	assert.Equal(t, []string{"/manager", "snapshot", "status", "-in", "/snapshot/snapshot.db", "-out", "/dev/termination-log"}, status.Command)
+
+	backup.Spec.Encryption = &ecv1alpha1.SnapshotEncryption{KeySecretRef: corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "etcd-backup-key"},
+		Key:                  "aes.key",
+	}}
+	podSpec = newVerifyJob(backup, ec, storage, "etcd-operator:v0.1").Spec.Template.Spec
+	assert.Equal(t, "decrypt", podSpec.InitContainers[1].Name)
+	assert.Equal(t, "/decrypted/snapshot.db", podSpec.InitContainers[2].Command[3])
+	assert.Equal(t, "/decrypted/snapshot.db", podSpec.Containers[0].Command[4])
+}
+
+func TestEtcdBackupVerification(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = batchv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "default"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Version: "v3.5.21"},
+	}
+	finishedJob := func(condition batchv1.JobConditionType) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly-verify", Namespace: "default"},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: condition, Status: corev1.ConditionTrue},
+			}},
+		}
+	}
+	statusPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nightly-verify-q8w4z",
+			Namespace: "default",
+			Labels:    map[string]string{batchv1.JobNameLabel: "nightly-verify"},
+		},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name: verifyContainerName,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Message: `{"hash":3815453137,"revision":1042,"totalKey":2087,"totalSize":2088960}`,
+			}},
+		}}},
+	}
+
+	tests := []struct {
+		name          string
+		operatorImage string
+		objs          []client.Object
+		wantVerified  *bool
+		wantRevision  int64
+		wantHash      int64
+		wantJob       bool
+	}{
+		{
+			name:          "verification to start",
+			operatorImage: "etcd-operator:v0.1",
+			wantJob:       true,
+		},
+		{
+			name:         "verification without the operator image",
+			wantVerified: ptr.To(false),
+		},
+		{
+			name:          "completed verification",
+			operatorImage: "etcd-operator:v0.1",
+			objs:          []client.Object{finishedJob(batchv1.JobComplete), statusPod},
+			wantVerified:  ptr.To(true),
+			wantRevision:  1042,
+			wantHash:      3815453137,
+			wantJob:       true,
+		},
+		{
+			name:          "failed verification",
+			operatorImage: "etcd-operator:v0.1",
+			objs:          []client.Object{finishedJob(batchv1.JobFailed)},
+			wantVerified:  ptr.To(false),
+			wantJob:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup := newTestBackup()
+			backup.Spec.Verify = true
+			backup.Status = ecv1alpha1.EtcdBackupStatus{Phase: ecv1alpha1.EtcdBackupPhaseCompleted, Size: 2088992}
+			objs := append([]client.Object{backup, ec.DeepCopy()}, tt.objs...)
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(&ecv1alpha1.EtcdBackup{}).Build()
+			r := &EtcdBackupReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10), OperatorImage: tt.operatorImage}
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "nightly", Namespace: "default"}})
+			assert.NoError(t, err)
+
+			got := &ecv1alpha1.EtcdBackup{}
+			assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(backup), got))
+			assert.Equal(t, ecv1alpha1.EtcdBackupPhaseCompleted, got.Status.Phase)
+			assert.Equal(t, tt.wantVerified, got.Status.Verified)
+			assert.Equal(t, tt.wantRevision, got.Status.SnapshotRevision)
+			assert.Equal(t, tt.wantHash, got.Status.SnapshotHash)
+
+			job := &batchv1.Job{}
+			err = c.Get(ctx, client.ObjectKey{Name: "nightly-verify", Namespace: "default"}, job)
+			assert.Equal(t, tt.wantJob, err == nil)
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/cron"
+)
+
+// EtcdBackupScheduleReconciler creates the EtcdBackups of
+// EtcdBackupSchedules on their cron schedule, and deletes the backups, with
+// their snapshot, beyond their retention.
+type EtcdBackupScheduleReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// MaxConcurrentReconciles is the number of EtcdBackupSchedules reconciled
+	// in parallel. It defaults to 1 when not set.
+	MaxConcurrentReconciles int
+	// Clock tells the time of the schedules. The real clock is used when not
+	// set.
+	Clock clock.PassiveClock
+	// HostPathDirs are the directories of the nodes the snapshots of the
+	// HostPath provider may be deleted from, see snapshotStorage.check.
+	HostPathDirs []string
+}
+
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdbackupschedules,verbs=get;list;watch
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdbackupschedules/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdbackups,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create
+
+// Reconcile creates the EtcdBackup of the last scheduled time of an
+// EtcdBackupSchedule, if it wasn't yet, and prunes its old backups.
+func (r *EtcdBackupScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	ebs := &ecv1alpha1.EtcdBackupSchedule{}
+	if err := r.Get(ctx, req.NamespacedName, ebs); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	// Like while suspended, only the last of the backups missed while paused
+	// is taken once resumed.
+	if isPaused(ebs) {
+		logger.Info("Reconciliation is paused")
+		return ctrl.Result{}, nil
+	}
+	// Only the status is written, so the defaults stay in memory.
+	base := ebs.DeepCopy()
+	ecv1alpha1.SetEtcdBackupScheduleDefaults(ebs)
+
+	schedule, err := cron.Parse(ebs.Spec.Schedule)
+	if err != nil {
+		// A new reconcile comes with a fixed schedule.
+		r.Recorder.Event(ebs, corev1.EventTypeWarning, "InvalidSchedule", err.Error())
+		return ctrl.Result{}, nil
+	}
+
+	backupList := &ecv1alpha1.EtcdBackupList{}
+	if err := r.List(ctx, backupList, client.InNamespace(ebs.Namespace), client.MatchingLabels{ecv1alpha1.BackupScheduleLabel: ebs.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+	var backups []*ecv1alpha1.EtcdBackup
+	for i := range backupList.Items {
+		if metav1.IsControlledBy(&backupList.Items[i], ebs) {
+			backups = append(backups, &backupList.Items[i])
+		}
+	}
+
+	result := ctrl.Result{}
+	pruning, err := r.prune(ctx, ebs, backups)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if pruning {
+		result.RequeueAfter = requeueDuration
+	}
+
+	now := r.now().UTC()
+	if !ebs.Spec.Suspend {
+		// The missed backups are skipped, only the last one is taken.
+		scheduled, ok := missedBackupTime(ebs, schedule, now)
+		if !ok {
+			r.Recorder.Eventf(ebs, corev1.EventTypeWarning, "TooManyMissedBackups",
+				"Gave up on more than %d missed backups, the schedule resumes at its next time: set or decrease startingDeadlineSeconds, or check for clock skew", maxMissedBackups)
+			ebs.Status.LastScheduleTime = &metav1.Time{Time: now}
+		} else if !scheduled.IsZero() {
+			if running := runningBackup(backups); running != "" {
+				r.Recorder.Eventf(ebs, corev1.EventTypeWarning, "BackupSkipped", "Skipped the backup of %s, backup %s is still running", scheduled.Format(time.RFC3339), running)
+			} else {
+				backup := newScheduledBackup(ebs, scheduled)
+				if err := controllerutil.SetControllerReference(ebs, backup, r.Scheme); err != nil {
+					return ctrl.Result{}, err
+				}
+				if err := r.Create(ctx, backup); err != nil && !k8serrors.IsAlreadyExists(err) {
+					return ctrl.Result{}, err
+				}
+				logger.Info("Created scheduled backup", "backup", backup.Name)
+				ebs.Status.LastBackupName = backup.Name
+			}
+			ebs.Status.LastScheduleTime = &metav1.Time{Time: scheduled}
+		}
+	}
+
+	ebs.Status.NextScheduleTime = nil
+	if next := schedule.Next(now); !ebs.Spec.Suspend && !next.IsZero() {
+		ebs.Status.NextScheduleTime = &metav1.Time{Time: next}
+		if wait := next.Sub(now); result.RequeueAfter == 0 || wait < result.RequeueAfter {
+			result.RequeueAfter = wait
+		}
+	}
+
+	if err := r.Status().Patch(ctx, ebs, client.MergeFrom(base)); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// maxMissedBackups is how many missed times of a schedule are looked
+// through for the last one, like the CronJob controller does, e.g. after a
+// long downtime of the operator with a schedule every minute.
+const maxMissedBackups = 100
+
+// missedBackupTime returns the last time of schedule, the schedule of ebs,
+// since its last backup and not after now, or the zero time if there is
+// none. The times past startingDeadlineSeconds are skipped. It reports false
+// when it gave up after maxMissedBackups times.
+func missedBackupTime(ebs *ecv1alpha1.EtcdBackupSchedule, schedule *cron.Schedule, now time.Time) (time.Time, bool) {
+	last := ebs.CreationTimestamp.Time
+	if ebs.Status.LastScheduleTime != nil {
+		last = ebs.Status.LastScheduleTime.Time
+	}
+	if d := ebs.Spec.StartingDeadlineSeconds; d != nil {
+		if deadline := now.Add(-time.Duration(*d) * time.Second); deadline.After(last) {
+			last = deadline
+		}
+	}
+	var scheduled time.Time
+	missed := 0
+	for t := schedule.Next(last); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		if missed++; missed > maxMissedBackups {
+			return time.Time{}, false
+		}
+		scheduled = t
+	}
+	return scheduled, true
+}
+
+// lastScheduledTime returns the last time of schedule after last and not
+// after now, or the zero time if there is none.
+func lastScheduledTime(schedule *cron.Schedule, last, now time.Time) time.Time {
+	var scheduled time.Time
+	for t := schedule.Next(last); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		scheduled = t
+	}
+	return scheduled
+}
+
+// runningBackup returns the name of a backup of backups which isn't
+// finished, or "" if there is none.
+func runningBackup(backups []*ecv1alpha1.EtcdBackup) string {
+	for _, b := range backups {
+		if b.Status.Phase != ecv1alpha1.EtcdBackupPhaseCompleted && b.Status.Phase != ecv1alpha1.EtcdBackupPhaseFailed {
+			return b.Name
+		}
+	}
+	return ""
+}
+
+// newScheduledBackup returns the EtcdBackup of ebs scheduled at scheduled.
+// Its name is derived from the scheduled time, so it is created once.
+func newScheduledBackup(ebs *ecv1alpha1.EtcdBackupSchedule, scheduled time.Time) *ecv1alpha1.EtcdBackup {
+	labels := make(map[string]string, len(ebs.Spec.BackupTemplate.Labels)+1)
+	for k, v := range ebs.Spec.BackupTemplate.Labels {
+		labels[k] = v
+	}
+	labels[ecv1alpha1.BackupScheduleLabel] = ebs.Name
+	return &ecv1alpha1.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", ebs.Name, scheduled.Unix()/60),
+			Namespace: ebs.Namespace,
+			Labels:    labels,
+		},
+		Spec: ebs.Spec.BackupTemplate.Spec,
+	}
+}
+
+// prune deletes the backups of ebs beyond its retention, the oldest first:
+// it keeps the Retention newest completed backups, and as many failed ones.
+// The snapshot of a completed backup is deleted by a Job before the backup
+// is. It reports whether snapshots are still being deleted.
+func (r *EtcdBackupScheduleReconciler) prune(ctx context.Context, ebs *ecv1alpha1.EtcdBackupSchedule, backups []*ecv1alpha1.EtcdBackup) (bool, error) {
+	var completed, failed []*ecv1alpha1.EtcdBackup
+	for _, b := range backups {
+		switch b.Status.Phase {
+		case ecv1alpha1.EtcdBackupPhaseCompleted:
+			completed = append(completed, b)
+		case ecv1alpha1.EtcdBackupPhaseFailed:
+			failed = append(failed, b)
+		}
+	}
+	retention := int(*ebs.Spec.Retention)
+
+	for _, b := range expiredBackups(failed, retention) {
+		if err := r.Delete(ctx, b); client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+	}
+
+	pruning := false
+	for _, b := range expiredBackups(completed, retention) {
+		deleted, err := r.pruneSnapshot(ctx, b)
+		if err != nil {
+			return false, err
+		}
+		pruning = pruning || !deleted
+	}
+	return pruning, nil
+}
+
+// expiredBackups returns the backups beyond the retention newest ones.
+func expiredBackups(backups []*ecv1alpha1.EtcdBackup, retention int) []*ecv1alpha1.EtcdBackup {
+	if len(backups) <= retention {
+		return nil
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		ti, tj := backups[i].CreationTimestamp, backups[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return tj.Before(&ti)
+		}
+		return backups[i].Name > backups[j].Name
+	})
+	return backups[retention:]
+}
+
+// pruneJobName returns the name of the Job deleting the snapshot of backup.
+func pruneJobName(backup *ecv1alpha1.EtcdBackup) string {
+	return backup.Name + "-prune"
+}
+
+// pruneSnapshot deletes the snapshot of backup with a Job, then backup once
+// the Job completed. It reports whether backup is deleted. A Job which
+// failed is left for inspection, along with backup, as is a snapshot the
+// operator refuses to reach. A backup without a destination has no
+// snapshot, and is deleted right away.
+func (r *EtcdBackupScheduleReconciler) pruneSnapshot(ctx context.Context, backup *ecv1alpha1.EtcdBackup) (bool, error) {
+	storage, ok := backupStorage(backup)
+	if !ok {
+		return true, client.IgnoreNotFound(r.Delete(ctx, backup))
+	}
+	if err := storage.check(r.HostPathDirs); err != nil {
+		r.Recorder.Eventf(backup, corev1.EventTypeWarning, "PruneFailed", "Failed to delete the snapshot %s: %s", backup.Status.Location, err)
+		return true, nil
+	}
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Name: pruneJobName(backup), Namespace: backup.Namespace}, job)
+	if k8serrors.IsNotFound(err) {
+		job = newPruneJob(backup, storage)
+		if err := controllerutil.SetControllerReference(backup, job, r.Scheme); err != nil {
+			return false, err
+		}
+		return false, client.IgnoreAlreadyExists(r.Create(ctx, job))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			// The Job goes along with the backup.
+			return true, client.IgnoreNotFound(r.Delete(ctx, backup))
+		case batchv1.JobFailed:
+			r.Recorder.Eventf(backup, corev1.EventTypeWarning, "PruneFailed", "Failed to delete the snapshot %s: %s", backup.Status.Location, c.Message)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newPruneJob returns the Job deleting the snapshot of backup from storage.
+func newPruneJob(backup *ecv1alpha1.EtcdBackup, storage snapshotStorage) *batchv1.Job {
+	labels := withManagedByLabel(map[string]string{
+		"app":       backup.Spec.ClusterName,
+		"component": "backup",
+	})
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pruneJobName(backup),
+			Namespace: backup.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](2),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: backup.Spec.ServiceAccountName,
+					Containers:         []corev1.Container{storage.container("prune", deleteSnapshot)},
+				},
+			},
+		},
+	}
+	storage.configurePod(&job.Spec.Template)
+	return job
+}
+
+func (r *EtcdBackupScheduleReconciler) now() time.Time {
+	if r.Clock == nil {
+		return time.Now()
+	}
+	return r.Clock.Now()
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdBackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("etcdbackupschedule-controller")
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ecv1alpha1.EtcdBackupSchedule{}).
+		Owns(&ecv1alpha1.EtcdBackup{}).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			NewQueue:                newTrackedQueue("etcdbackupschedules", nil),
+		}).
+		Complete(r)
+}
@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/cron"
+)
+
+func newTestBackupSchedule(created time.Time) *ecv1alpha1.EtcdBackupSchedule {
+	return &ecv1alpha1.EtcdBackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "hourly",
+			Namespace:         "default",
+			UID:               "schedule-uid",
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: ecv1alpha1.EtcdBackupScheduleSpec{
+			Schedule:  "0 * * * *",
+			Retention: ptr.To[int32](2),
+			BackupTemplate: ecv1alpha1.EtcdBackupTemplate{
+				Labels: map[string]string{"team": "storage"},
+				Spec:   newTestBackup().Spec,
+			},
+		},
+	}
+}
+
+func newBackupScheduleTestClient(objs ...client.Object) (client.Client, *runtime.Scheme) {
+	scheme := runtime.NewScheme()
+	_ = batchv1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+		WithStatusSubresource(&ecv1alpha1.EtcdBackupSchedule{}, &ecv1alpha1.EtcdBackup{}).Build()
+	return c, scheme
+}
+
+func TestLastScheduledTime(t *testing.T) {
+	schedule, err := cron.Parse("0 * * * *")
+	assert.NoError(t, err)
+	last := time.Date(2025, 1, 31, 1, 0, 0, 0, time.UTC)
+
+	assert.True(t, lastScheduledTime(schedule, last, last.Add(59*time.Minute)).IsZero())
+	assert.Equal(t, last.Add(time.Hour), lastScheduledTime(schedule, last, last.Add(time.Hour)))
+	// Only the last of the missed backups.
+	assert.Equal(t, last.Add(5*time.Hour), lastScheduledTime(schedule, last, last.Add(5*time.Hour+time.Minute)))
+}
+
+func TestMissedBackupTime(t *testing.T) {
+	schedule, err := cron.Parse("* * * * *")
+	assert.NoError(t, err)
+	created := time.Date(2025, 1, 31, 1, 0, 0, 0, time.UTC)
+	ebs := newTestBackupSchedule(created)
+
+	scheduled, ok := missedBackupTime(ebs, schedule, created.Add(100*time.Minute+30*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, created.Add(100*time.Minute), scheduled)
+
+	// Like a CronJob, the schedule gives up past 100 missed times...
+	_, ok = missedBackupTime(ebs, schedule, created.Add(101*time.Minute))
+	assert.False(t, ok)
+
+	// ... unless the starting deadline skips them.
+	ebs.Spec.StartingDeadlineSeconds = ptr.To[int64](90)
+	scheduled, ok = missedBackupTime(ebs, schedule, created.Add(24*time.Hour+30*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, created.Add(24*time.Hour), scheduled)
+
+	// A scheduled time past its deadline is skipped.
+	ebs.Spec.StartingDeadlineSeconds = ptr.To[int64](10)
+	scheduled, ok = missedBackupTime(ebs, schedule, created.Add(24*time.Hour+30*time.Second))
+	assert.True(t, ok)
+	assert.True(t, scheduled.IsZero())
+}
+
+func TestEtcdBackupScheduleTooManyMissedBackups(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2025, 1, 31, 1, 30, 0, 0, time.UTC)
+	ebs := newTestBackupSchedule(created)
+	ebs.Spec.Schedule = "* * * * *"
+	c, scheme := newBackupScheduleTestClient(ebs)
+	now := created.Add(24 * time.Hour)
+	recorder := record.NewFakeRecorder(10)
+	r := &EtcdBackupScheduleReconciler{Client: c, Scheme: scheme, Recorder: recorder, Clock: clocktesting.NewFakePassiveClock(now)}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(ebs)}
+
+	_, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Contains(t, <-recorder.Events, "TooManyMissedBackups")
+	backups := &ecv1alpha1.EtcdBackupList{}
+	assert.NoError(t, c.List(ctx, backups))
+	assert.Empty(t, backups.Items)
+	// The schedule resumes at its next time.
+	got := &ecv1alpha1.EtcdBackupSchedule{}
+	assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+	assert.Equal(t, now, got.Status.LastScheduleTime.Time.UTC())
+	assert.Equal(t, now.Add(time.Minute), got.Status.NextScheduleTime.Time.UTC())
+}
+
+func TestEtcdBackupScheduleReconcile(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2025, 1, 31, 1, 30, 0, 0, time.UTC)
+	ebs := newTestBackupSchedule(created)
+	c, scheme := newBackupScheduleTestClient(ebs)
+	clock := clocktesting.NewFakePassiveClock(created.Add(10 * time.Minute))
+	recorder := record.NewFakeRecorder(10)
+	r := &EtcdBackupScheduleReconciler{Client: c, Scheme: scheme, Recorder: recorder, Clock: clock}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(ebs)}
+	backupName := fmt.Sprintf("hourly-%d", time.Date(2025, 1, 31, 2, 0, 0, 0, time.UTC).Unix()/60)
+
+	// Nothing to do before the first scheduled time.
+	result, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 20 * time.Minute}, result)
+	backups := &ecv1alpha1.EtcdBackupList{}
+	assert.NoError(t, c.List(ctx, backups))
+	assert.Empty(t, backups.Items)
+
+	clock.SetTime(created.Add(35 * time.Minute))
+	result, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: 55 * time.Minute}, result)
+	backup := &ecv1alpha1.EtcdBackup{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKey{Name: backupName, Namespace: "default"}, backup))
+	assert.True(t, metav1.IsControlledBy(backup, ebs))
+	assert.Equal(t, map[string]string{"team": "storage", ecv1alpha1.BackupScheduleLabel: "hourly"}, backup.Labels)
+	assert.Equal(t, "etcd", backup.Spec.ClusterName)
+	got := &ecv1alpha1.EtcdBackupSchedule{}
+	assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+	assert.Equal(t, backupName, got.Status.LastBackupName)
+	assert.Equal(t, time.Date(2025, 1, 31, 2, 0, 0, 0, time.UTC), got.Status.LastScheduleTime.Time.UTC())
+	assert.Equal(t, time.Date(2025, 1, 31, 3, 0, 0, 0, time.UTC), got.Status.NextScheduleTime.Time.UTC())
+
+	// Paused schedules are left alone.
+	assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+	got.Annotations = map[string]string{ecv1alpha1.PausedAnnotation: "true"}
+	assert.NoError(t, c.Update(ctx, got))
+	clock.SetTime(created.Add(95 * time.Minute))
+	result, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+	assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+	assert.Equal(t, time.Date(2025, 1, 31, 3, 0, 0, 0, time.UTC), got.Status.NextScheduleTime.Time.UTC())
+	delete(got.Annotations, ecv1alpha1.PausedAnnotation)
+	assert.NoError(t, c.Update(ctx, got))
+
+	// The backup of 03:00 is skipped while the one of 02:00 runs.
+	clock.SetTime(created.Add(95 * time.Minute))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.NoError(t, c.List(ctx, backups))
+	assert.Len(t, backups.Items, 1)
+	assert.Contains(t, <-recorder.Events, "BackupSkipped")
+
+	// Suspended schedules don't create backups.
+	assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+	got.Spec.Suspend = true
+	assert.NoError(t, c.Update(ctx, got))
+	backup.Status.Phase = ecv1alpha1.EtcdBackupPhaseCompleted
+	assert.NoError(t, c.Status().Update(ctx, backup))
+	clock.SetTime(created.Add(155 * time.Minute))
+	result, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+	assert.NoError(t, c.List(ctx, backups))
+	assert.Len(t, backups.Items, 1)
+}
+
+func TestEtcdBackupSchedulePrune(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2025, 1, 31, 1, 30, 0, 0, time.UTC)
+	ebs := newTestBackupSchedule(created)
+	ebs.Spec.Suspend = true
+
+	objs := []client.Object{ebs}
+	for i, phase := range []ecv1alpha1.EtcdBackupPhase{
+		ecv1alpha1.EtcdBackupPhaseCompleted,
+		ecv1alpha1.EtcdBackupPhaseFailed,
+		ecv1alpha1.EtcdBackupPhaseCompleted,
+		ecv1alpha1.EtcdBackupPhaseFailed,
+		ecv1alpha1.EtcdBackupPhaseCompleted,
+		ecv1alpha1.EtcdBackupPhaseFailed,
+	} {
+		backup := newScheduledBackup(ebs, created.Add(time.Duration(i+1)*time.Hour))
+		backup.CreationTimestamp = metav1.NewTime(created.Add(time.Duration(i+1) * time.Hour))
+		backup.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: ecv1alpha1.GroupVersion.String(),
+			Kind:       "EtcdBackupSchedule",
+			Name:       ebs.Name,
+			UID:        ebs.UID,
+			Controller: ptr.To(true),
+		}}
+		backup.Status.Phase = phase
+		objs = append(objs, backup)
+	}
+	oldest := objs[1].(*ecv1alpha1.EtcdBackup)
+	c, scheme := newBackupScheduleTestClient(objs...)
+	r := &EtcdBackupScheduleReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10), Clock: clocktesting.NewFakePassiveClock(created)}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(ebs)}
+
+	result, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: requeueDuration}, result)
+	// The oldest failed backup is deleted right away.
+	err = c.Get(ctx, client.ObjectKeyFromObject(objs[2]), &ecv1alpha1.EtcdBackup{})
+	assert.True(t, k8serrors.IsNotFound(err))
+	backups := &ecv1alpha1.EtcdBackupList{}
+	assert.NoError(t, c.List(ctx, backups))
+	assert.Len(t, backups.Items, 5)
+
+	// The snapshot of the oldest completed backup is deleted first.
+	job := &batchv1.Job{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKey{Name: oldest.Name + "-prune", Namespace: "default"}, job))
+	assert.True(t, metav1.IsControlledBy(job, oldest))
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "KEY", Value: "default/etcd/" + oldest.Name + ".db"})
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	assert.NoError(t, c.Status().Update(ctx, job))
+	result, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+	err = c.Get(ctx, client.ObjectKeyFromObject(oldest), &ecv1alpha1.EtcdBackup{})
+	assert.True(t, k8serrors.IsNotFound(err))
+	assert.NoError(t, c.List(ctx, backups))
+	assert.Len(t, backups.Items, 4)
+}
+
+func TestEtcdBackupSchedulePruneHostPath(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2025, 1, 31, 1, 30, 0, 0, time.UTC)
+	ebs := newTestBackupSchedule(created)
+	backup := newScheduledBackup(ebs, created)
+	backup.Spec.StorageProvider = ecv1alpha1.StorageProviderHostPath
+	backup.Spec.S3 = nil
+	backup.Spec.HostPath = &ecv1alpha1.HostPathBackupDestination{NodeName: "node-1", Directory: "/etc", Path: "passwd"}
+	c, scheme := newBackupScheduleTestClient(ebs, backup)
+	recorder := record.NewFakeRecorder(10)
+	r := &EtcdBackupScheduleReconciler{Client: c, Scheme: scheme, Recorder: recorder, HostPathDirs: []string{"/var/backups"}}
+
+	// The snapshot isn't deleted from a directory the operator doesn't
+	// allow, the backup is left for inspection.
+	deleted, err := r.pruneSnapshot(ctx, backup)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Contains(t, <-recorder.Events, "PruneFailed")
+	err = c.Get(ctx, client.ObjectKey{Name: pruneJobName(backup), Namespace: "default"}, &batchv1.Job{})
+	assert.True(t, k8serrors.IsNotFound(err))
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(backup), &ecv1alpha1.EtcdBackup{}))
+}
@@ -23,15 +23,22 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
 	"go.etcd.io/etcd-operator/internal/etcdutils"
+	"go.etcd.io/etcd-operator/internal/features"
+	"go.etcd.io/etcd-operator/internal/validation"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -44,15 +51,58 @@ type EtcdClusterReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// MaxConcurrentReconciles is the number of EtcdClusters reconciled in
+	// parallel. It defaults to 1 when not set.
+	MaxConcurrentReconciles int
+	// RateLimiter configures how failed reconciles are retried.
+	RateLimiter RateLimiterOptions
+	// EtcdClients caches the connections to the etcd clusters. A new pool is
+	// created when not set.
+	EtcdClients *etcdutils.ClientPool
+	// Shard selects the EtcdClusters reconciled by this instance of the
+	// operator.
+	Shard Shard
+	// PriorityQueue makes the reconciles of Degraded EtcdClusters go before
+	// the others.
+	PriorityQueue bool
+	// RestrictedRBAC avoids the list and watch requests on cluster-scoped
+	// resources, for an operator only granted permissions in the namespaces
+	// it watches. The EtcdClusters then pick up the changes of their
+	// EtcdClusterTemplate on their next reconcile only.
+	RestrictedRBAC bool
+	// APIReader reads the kubeconfig Secrets of the remote Kubernetes
+	// clusters, which aren't in the cache of the manager. The Client is used
+	// when not set.
+	APIReader client.Reader
+	// OperatorImage is the image of the operator, run by the quorum recovery
+	// Jobs to replay the write-ahead log of a member over a backup, and by
+	// the data check of the members. Those recoveries wait when it is empty.
+	OperatorImage string
+
+	remote remoteClients
 }
 
 // +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdclusters/finalizers,verbs=update
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdclustertemplates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdclusteroverrides,verbs=get;list;watch
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;patch;delete
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;patch;delete
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch;get;list;update
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;create;patch
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;prometheusrules,verbs=get;create;patch;delete
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdbackups,verbs=get;list;watch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -63,38 +113,179 @@ type EtcdClusterReconciler struct {
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.19.1/pkg/reconcile
-func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	logger := log.FromContext(ctx)
 
 	// Fetch the EtcdCluster resource
 	etcdCluster := &ecv1alpha1.EtcdCluster{}
 
-	err := r.Get(ctx, req.NamespacedName, etcdCluster)
+	err = r.Get(ctx, req.NamespacedName, etcdCluster)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			logger.Info("EtcdCluster resource not found. Ignoring since object may have been deleted")
+			r.EtcdClients.Close(req.String())
+			r.remote.forget(req.String())
+			clusters.forget(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
 	}
+	if !r.Shard.owns(etcdCluster) {
+		// The EtcdCluster was moved to another shard, or doesn't match the
+		// cluster selector anymore.
+		r.EtcdClients.Close(req.String())
+		r.remote.forget(req.String())
+		clusters.forget(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	// The changes of the status are written once, when the reconcile returns.
+	status := newStatusPatcher(r.Client, etcdCluster)
+	defer func() {
+		setPhaseStatus(etcdCluster)
+		if statusErr := status.patch(ctx, etcdCluster); statusErr != nil {
+			logger.Error(statusErr, "Failed to update the EtcdCluster status")
+			if err == nil {
+				err = statusErr
+			}
+		}
+		clusters.observe(etcdCluster, reconcileResult(result, err))
+	}()
+
+	// Fill in the values of the template, the overrides and the defaults in
+	// memory, so the reconciliation behaves the same whether or not the
+	// defaulting webhook is deployed, and picks up the changes of the
+	// templates and overrides.
+	if err = applyTemplate(ctx, r.Client, etcdCluster); err != nil {
+		r.Recorder.Event(etcdCluster, corev1.EventTypeWarning, "TemplateUnavailable", err.Error())
+		return ctrl.Result{}, err
+	}
+	if err = applyOverrides(ctx, r.Client, etcdCluster); err != nil {
+		r.Recorder.Event(etcdCluster, corev1.EventTypeWarning, "OverrideFailed", err.Error())
+		return ctrl.Result{}, err
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(etcdCluster)
+	setDataCheckImage(r.Recorder, etcdCluster, r.OperatorImage)
+	setGracefulShutdownImage(etcdCluster, r.OperatorImage)
+
+	deleting, err := reconcileDeletionProtection(ctx, r.Client, r.Recorder, etcdCluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err = r.reconcileRemoteCleanup(ctx, etcdCluster, deleting); err != nil {
+		return ctrl.Result{}, err
+	}
+	if deleting {
+		logger.Info("EtcdCluster is being deleted, skipping the reconciliation")
+		return ctrl.Result{}, nil
+	}
+
+	// The webhook may not be deployed, so validate the spec again rather than
+	// partially reconciling an invalid one.
+	specErrs, _ := validation.ValidateEtcdCluster(etcdCluster)
+	setSpecInvalidCondition(etcdCluster, specErrs)
+	if len(specErrs) > 0 {
+		logger.Info("EtcdCluster spec is invalid, skipping the reconciliation", "errors", specErrs.ToAggregate().Error())
+		r.Recorder.Event(etcdCluster, corev1.EventTypeWarning, "SpecInvalid", specErrs.ToAggregate().Error())
+		return ctrl.Result{}, nil
+	}
+	setEphemeralCondition(etcdCluster)
+
+	// The members run in the Kubernetes cluster of the EtcdCluster, unless it
+	// references the kubeconfig of a remote one.
+	if isRemote(etcdCluster) && !features.Enabled(features.StretchClusters) {
+		logger.Info("The members run in a remote Kubernetes cluster, skipping the reconciliation", "featureGate", features.StretchClusters)
+		r.Recorder.Eventf(etcdCluster, corev1.EventTypeWarning, "FeatureDisabled",
+			"The members of the cluster run in a remote Kubernetes cluster, which needs the %s feature gate", features.StretchClusters)
+		return ctrl.Result{}, nil
+	}
+	wc, err := r.remote.workloadClient(ctx, r.Client, r.apiReader(), r.Scheme, etcdCluster)
+	if err != nil {
+		r.Recorder.Event(etcdCluster, corev1.EventTypeWarning, "RemoteClusterUnavailable", err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// The members are spread across the zones of the nodes, if they have
+	// more than one. The nodes aren't read in the restricted RBAC mode, as
+	// they are cluster-scoped.
+	var zones map[string]string
+	if !r.RestrictedRBAC {
+		if zones, err = nodeZones(ctx, wc); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	applyZoneSpread(etcdCluster, zones)
+
+	// The debug Pod doesn't change the cluster, so it is run even when the
+	// cluster is paused or only dry run.
+	if err = reconcileDebugPod(ctx, r.Client, r.Scheme, r.Recorder, etcdCluster); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	if etcdCluster.Spec.Size == 0 {
 		logger.Info("EtcdCluster size is 0..Skipping next steps")
 		return ctrl.Result{}, nil
 	}
 
-	// TODO: Implement finalizer logic here
+	// Record what is about to change before changing anything, so the plan
+	// can be reviewed, and stop there when only a dry run was requested.
+	if err = recordPlannedActions(ctx, wc, etcdCluster); err != nil {
+		return ctrl.Result{}, err
+	}
+	setProgressConditions(etcdCluster)
+	if isDryRun(etcdCluster) {
+		logger.Info("Dry run requested, not applying the planned actions", "plannedActions", etcdCluster.Status.PlannedActions)
+		return ctrl.Result{}, nil
+	}
+
+	paused := isPaused(etcdCluster)
+	setPausedCondition(etcdCluster, paused)
+	if paused {
+		logger.Info("Reconciliation is paused, not applying the planned actions", "plannedActions", etcdCluster.Status.PlannedActions)
+		return ctrl.Result{}, nil
+	}
 
 	logger.Info("Reconciling EtcdCluster", "spec", etcdCluster.Spec)
 
+	// The members of a cluster with TLS only start once their certificates
+	// are issued.
+	renewalTime := etcdCluster.Status.CertificatesRenewalTime
+	if err = reconcileCertificates(ctx, wc, r.Scheme, r.Recorder, etcdCluster, time.Now()); err != nil {
+		r.Recorder.Event(etcdCluster, corev1.EventTypeWarning, "CertificatesUnavailable", err.Error())
+		return ctrl.Result{}, err
+	}
+	if !renewalTime.Equal(etcdCluster.Status.CertificatesRenewalTime) {
+		// Reconnect with the renewed client certificate.
+		r.EtcdClients.Close(req.String())
+	}
+	tlsConfig, err := clusterTLSConfig(ctx, wc, etcdCluster)
+	if err != nil {
+		logger.Info("Waiting for the certificates of the cluster", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: requeueDuration}, nil
+	}
+	// The root password of the cluster is generated before the
+	// authentication is enabled, and used by the operator from then on.
+	creds, err := reconcileRootSecret(ctx, wc, r.Scheme, r.Recorder, etcdCluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// An existing cluster is taken over, rather than bootstrapping a new one.
+	if etcdCluster.Spec.Adoption != nil {
+		if err = reconcileAdoption(ctx, logger, wc, r.Scheme, r.Recorder, etcdCluster, r.EtcdClients.Cluster(req.String(), tlsConfig, creds)); err != nil {
+			r.Recorder.Event(etcdCluster, corev1.EventTypeWarning, "AdoptionFailed", err.Error())
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Get the statefulsets which has the same name as the EtcdCluster resource
-	sts, err := getStatefulSet(ctx, r.Client, etcdCluster.Name, etcdCluster.Namespace)
+	sts, err := getStatefulSet(ctx, wc, etcdCluster.Name, etcdCluster.Namespace)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			logger.Info("Creating StatefulSet with 0 replica", "expectedSize", etcdCluster.Spec.Size)
 			// Create a new StatefulSet
 
-			sts, err = reconcileStatefulSet(ctx, logger, etcdCluster, r.Client, 0, r.Scheme)
+			sts, err = reconcileStatefulSet(ctx, logger, etcdCluster, wc, 0, r.Scheme, r.Recorder)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
@@ -115,23 +306,128 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
-	// If statefulset size is 0. try to instantiate the cluster with 1 member
-	if sts.Spec.Replicas != nil && *sts.Spec.Replicas == 0 {
+	// If statefulset size is 0. try to instantiate the cluster with 1 member,
+	// unless its members are stopped to recover the quorum.
+	if sts.Spec.Replicas != nil && *sts.Spec.Replicas == 0 && !recoveringQuorum(etcdCluster) {
 		logger.Info("StatefulSet has 0 replicas. Trying to create a new cluster with 1 member")
 
-		sts, err = reconcileStatefulSet(ctx, logger, etcdCluster, r.Client, 1, r.Scheme)
+		sts, err = reconcileStatefulSet(ctx, logger, etcdCluster, wc, 1, r.Scheme, r.Recorder)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
-	err = createHeadlessServiceIfNotExist(ctx, logger, r.Client, etcdCluster, r.Scheme)
+	// The members keep their version until the upgrade to the version of
+	// the spec, which only starts once the membership is stable.
+	targetVersion := pinVersion(etcdCluster, sts)
+
+	err = applyHeadlessService(ctx, logger, wc, etcdCluster, r.Scheme, r.Recorder)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if err = reconcileClientService(ctx, wc, r.Scheme, r.Recorder, etcdCluster); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err = reconcileMemberServices(ctx, wc, r.Scheme, r.Recorder, etcdCluster, int(*sts.Spec.Replicas)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err = reconcilePodDisruptionBudget(ctx, wc, r.Scheme, r.Recorder, etcdCluster); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err = reconcileProxyTier(ctx, wc, r.Scheme, r.Recorder, etcdCluster, grpcProxyName(etcdCluster), grpcProxyTier(etcdCluster)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err = reconcileProxyTier(ctx, wc, r.Scheme, r.Recorder, etcdCluster, gatewayName(etcdCluster), gatewayTier(etcdCluster)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err = reconcileConnectionSecret(ctx, r.Client, r.Scheme, r.Recorder, etcdCluster); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The cluster is managed without its ServiceMonitor and PrometheusRule,
+	// e.g. while the Prometheus operator isn't installed.
+	if err = reconcileMonitoring(ctx, wc, r.Scheme, r.Recorder, etcdCluster); err != nil {
+		r.Recorder.Event(etcdCluster, corev1.EventTypeWarning, "MonitoringFailed", err.Error())
+	}
+
+	// The pods and the volumes of the members aren't in the cache of the
+	// manager.
+	podReader := r.apiReader()
+	if isRemote(etcdCluster) {
+		podReader = wc
+	}
+	// The storage classes are cluster-scoped.
+	classReader := podReader
+	if r.RestrictedRBAC {
+		classReader = nil
+	}
+	if err = expandVolumes(ctx, podReader, classReader, wc, r.Recorder, etcdCluster, sts); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	etcdClient := r.EtcdClients.Cluster(req.String(), tlsConfig, creds)
+
+	// The members are stopped while the quorum is recovered, until the
+	// cluster restarts from the first member.
+	if recoveringQuorum(etcdCluster) {
+		recovering, recoverErr := recoverQuorum(ctx, logger, r.Client, wc, r.Scheme, r.Recorder, etcdCluster, sts, r.OperatorImage)
+		if recoverErr != nil {
+			return ctrl.Result{}, recoverErr
+		}
+		if recovering {
+			return ctrl.Result{RequeueAfter: requeueDuration}, nil
+		}
+	}
+
 	logger.Info("Now checking health of the cluster members")
-	memberListResp, healthInfos, err := healthCheck(sts, logger)
+	memberListResp, healthInfos, err := healthCheck(etcdClient, sts, logger)
+	setDegradedCondition(etcdCluster, err)
+	setAvailableCondition(etcdCluster, healthInfos, err)
+	if healthInfos != nil {
+		corrupted, corruptedErr := corruptedMembers(ctx, podReader, etcdCluster)
+		if corruptedErr != nil {
+			logger.Info("Failed to read the data check of the members", "error", corruptedErr.Error())
+		}
+		recordFailingMembers(etcdCluster, sts, healthInfos, corrupted, time.Now())
+	}
+	zonesOfMembers, zonesErr := memberZones(ctx, podReader, etcdCluster, zones)
+	if zonesErr != nil {
+		logger.Info("Failed to get the zones of the members", "error", zonesErr.Error())
+	}
+	setMembersStatus(etcdCluster, memberListResp, healthInfos, zonesOfMembers)
+	// The members out of space fail their health check until the NOSPACE
+	// alarm is disarmed, which is sorted out before anything else.
+	noSpace, noSpaceErr := reconcileNoSpaceAlarm(logger, r.Recorder, etcdCluster, sts, etcdClient, memberListResp, healthInfos)
+	if noSpaceErr != nil {
+		return ctrl.Result{}, noSpaceErr
+	}
+	if noSpace {
+		return ctrl.Result{RequeueAfter: requeueDuration}, nil
+	}
+	// Without a quorum, the cluster only restarts from a single member once
+	// the recovery is confirmed.
+	recovering, recoverErr := reconcileQuorumLoss(ctx, logger, r.Client, r.Recorder, status, etcdCluster, sts, etcdClient, memberListResp, healthInfos, time.Now())
+	if recoverErr != nil {
+		return ctrl.Result{}, recoverErr
+	}
+	if recovering {
+		return ctrl.Result{RequeueAfter: requeueDuration}, nil
+	}
+	// A failed member is replaced while the others keep the quorum, before
+	// anything else changes.
+	replacing, replaceErr := reconcileFailedMembers(ctx, logger, wc, r.Recorder, status, etcdCluster, sts, etcdClient, memberListResp, healthInfos, time.Now())
+	if replaceErr != nil {
+		return ctrl.Result{}, replaceErr
+	}
+	if replacing {
+		return ctrl.Result{RequeueAfter: requeueDuration}, nil
+	}
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("health check failed: %w", err)
 	}
@@ -140,6 +436,10 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	if memberListResp != nil {
 		memberCnt = len(memberListResp.Members)
 	}
+	setLearnersStatus(etcdCluster, memberListResp)
+	if op := etcdCluster.Status.InProgressOperation; op != nil {
+		logger.Info("Resuming the operation in progress", "type", op.Type, "member", op.Member, "startTime", op.StartTime)
+	}
 	targetReplica := *sts.Spec.Replicas // Start with the current size of the stateful set
 
 	// The number of replicas in the StatefulSet doesn't match the number of etcd members in the cluster.
@@ -149,7 +449,7 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			logger.Info("An etcd member was added into the cluster, but the StatefulSet hasn't scaled out yet")
 			newReplicaCount := targetReplica + 1
 			logger.Info("Increasing StatefulSet replicas to match the etcd cluster member count", "oldReplicaCount", targetReplica, "newReplicaCount", newReplicaCount)
-			_, err = reconcileStatefulSet(ctx, logger, etcdCluster, r.Client, newReplicaCount, r.Scheme)
+			_, err = reconcileStatefulSet(ctx, logger, etcdCluster, wc, newReplicaCount, r.Scheme, r.Recorder)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
@@ -157,7 +457,7 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			logger.Info("An etcd member was removed from the cluster, but the StatefulSet hasn't scaled in yet")
 			newReplicaCount := targetReplica - 1
 			logger.Info("Decreasing StatefulSet replicas to remove the unneeded Pod.", "oldReplicaCount", targetReplica, "newReplicaCount", newReplicaCount)
-			_, err = reconcileStatefulSet(ctx, logger, etcdCluster, r.Client, newReplicaCount, r.Scheme)
+			_, err = reconcileStatefulSet(ctx, logger, etcdCluster, wc, newReplicaCount, r.Scheme, r.Recorder)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
@@ -178,6 +478,7 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			// If the leader is not available, let's wait for the leader to be elected
 			return ctrl.Result{}, fmt.Errorf("couldn't find leader, memberCnt: %d", memberCnt)
 		}
+		setEndpointsStatus(etcdCluster, sts)
 
 		learner, learnerStatus = etcdutils.FindLearnerStatus(healthInfos, logger)
 		if learner > 0 {
@@ -189,11 +490,13 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 				logger.Info("Promoting the learner member", "learnerID", learner)
 				eps := clientEndpointsFromStatefulsets(sts)
 				eps = eps[:(len(eps) - 1)]
-				err = etcdutils.PromoteLearner(eps, learner)
+				err = etcdClient.PromoteLearner(eps, learner)
 				if err != nil {
 					// The member is not promoted yet, so we error out
 					return ctrl.Result{}, err
 				}
+				r.Recorder.Eventf(etcdCluster, corev1.EventTypeNormal, "MemberPromoted",
+					"Promoted learner member %s to a voting member", memberNameByID(memberListResp, learner))
 			} else {
 				// Learner is not yet ready. We can't add another learner or proceed further until this one is promoted
 				// So let's requeue
@@ -203,9 +506,59 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}
 
+	// The membership of the cluster matches the StatefulSet, and there is no
+	// learner left to promote: the previous operation, if any, is complete.
+	finishMemberOperation(etcdCluster)
+
+	// The leadership is transferred on request once the membership is
+	// stable, e.g. before the node of the leader is drained.
+	moved, err := reconcileMoveLeader(ctx, logger, r.Client, r.Recorder, etcdCluster, etcdClient, memberListResp, healthInfos)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if moved {
+		return ctrl.Result{RequeueAfter: requeueDuration}, nil
+	}
+
+	// The authentication is turned on, or off, once all the members are
+	// healthy.
+	if err = reconcileAuth(ctx, logger, wc, r.Recorder, etcdCluster, etcdClient, clientEndpointsFromStatefulsets(sts), creds); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The size of the cluster only changes once all its members run the
+	// same version.
+	upgrading, err := reconcileUpgrade(ctx, logger, wc, r.Scheme, r.Recorder, etcdCluster, sts, targetVersion)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if upgrading {
+		return ctrl.Result{RequeueAfter: requeueDuration}, nil
+	}
+
 	if targetReplica == int32(etcdCluster.Spec.Size) {
+		if certificatesRenewed(etcdCluster, sts) {
+			logger.Info("Restarting the members to load their renewed certificates")
+			if _, err = reconcileStatefulSet(ctx, logger, etcdCluster, wc, targetReplica, r.Scheme, r.Recorder); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: requeueDuration}, nil
+		}
+		// The members are only defragmented once the cluster is stable, one
+		// per reconcile.
+		now := time.Now().UTC()
+		defragmenting, err := reconcileDefrag(logger, r.Recorder, etcdCluster, sts, etcdClient, healthInfos, now)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if defragmenting {
+			return ctrl.Result{RequeueAfter: requeueDuration}, nil
+		}
+		if err := reconcileLocalSnapshots(ctx, logger, wc, r.Scheme, r.Recorder, etcdCluster, sts, now); err != nil {
+			return ctrl.Result{}, err
+		}
 		logger.Info("EtcdCluster is already up-to-date")
-		return ctrl.Result{}, nil
+		return withNextLocalSnapshot(withNextDefrag(doneResult(etcdCluster), etcdCluster, now), etcdCluster, now), nil
 	}
 
 	eps := clientEndpointsFromStatefulsets(sts)
@@ -214,34 +567,59 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// If there is no more member to add, the control will not reach here after the requeue
 	if targetReplica < int32(etcdCluster.Spec.Size) {
 		// scale out
-		_, peerURL := peerEndpointForOrdinalIndex(etcdCluster, int(targetReplica)) // The index starts at 0, so we should do this before incrementing targetReplica
+		memberName, peerURLs := peerURLsForOrdinalIndex(etcdCluster, int(targetReplica)) // The index starts at 0, so we should do this before incrementing targetReplica
 		targetReplica++
-		logger.Info("[Scale out] adding a new learner member to etcd cluster", "peerURLs", peerURL)
-		if _, err := etcdutils.AddMember(eps, []string{peerURL}, true); err != nil {
+		if err := startMemberOperation(ctx, status, etcdCluster, actionScaleOut, memberName); err != nil {
+			return ctrl.Result{}, err
+		}
+		logger.Info("[Scale out] adding a new learner member to etcd cluster", "peerURLs", peerURLs)
+		if _, err := etcdClient.AddMember(eps, peerURLs, true); err != nil {
 			return ctrl.Result{}, err
 		}
 
-		logger.Info("Learner member added successfully", "peerURLs", peerURL)
+		logger.Info("Learner member added successfully", "peerURLs", peerURLs)
 	} else {
 		// scale in
 		targetReplica--
 		logger = logger.WithValues("targetReplica", targetReplica, "expectedSize", etcdCluster.Spec.Size)
 
-		memberID := healthInfos[memberCnt-1].Status.Header.MemberId
+		// The StatefulSet removes the Pod of the highest ordinal, so that is
+		// the member to remove from the cluster first.
+		memberName, peerURL := peerEndpointForOrdinalIndex(etcdCluster, int(targetReplica))
+		memberID, found := findMemberID(memberListResp, memberName, peerURL)
+		if !found {
+			return ctrl.Result{}, fmt.Errorf("member %s isn't in the member list of the cluster", memberName)
+		}
+		if err := startMemberOperation(ctx, status, etcdCluster, actionScaleIn, memberName); err != nil {
+			return ctrl.Result{}, err
+		}
 
-		logger.Info("[Scale in] removing one member", "memberID", memberID)
+		logger.Info("[Scale in] removing one member", "member", memberName, "memberID", memberID)
 		eps = eps[:targetReplica]
-		if err := etcdutils.RemoveMember(eps, memberID); err != nil {
+		if err := etcdClient.RemoveMember(eps, memberID); err != nil {
 			return ctrl.Result{}, err
 		}
+
+		// Only remove the Pod once the remaining members confirm the removal,
+		// otherwise the cluster would count a voting member that is gone.
+		// The next reconcile scales the StatefulSet in once it is confirmed.
+		resp, err := etcdClient.MemberList(eps)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if _, stillMember := findMemberID(resp, memberName, peerURL); stillMember {
+			logger.Info("[Scale in] the removal of the member isn't confirmed yet", "member", memberName)
+			return ctrl.Result{RequeueAfter: requeueDuration}, nil
+		}
+		logger.Info("[Scale in] member removed", "member", memberName)
 	}
 
-	sts, err = reconcileStatefulSet(ctx, logger, etcdCluster, r.Client, targetReplica, r.Scheme)
+	sts, err = reconcileStatefulSet(ctx, logger, etcdCluster, wc, targetReplica, r.Scheme, r.Recorder)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	allMembersHealthy, err := areAllMembersHealthy(sts, logger)
+	allMembersHealthy, err := areAllMembersHealthy(etcdClient, sts, logger)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -253,17 +631,57 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	logger.Info("EtcdCluster reconciled successfully")
-	return ctrl.Result{}, nil
+	now := time.Now().UTC()
+	return withNextLocalSnapshot(withNextDefrag(doneResult(etcdCluster), etcdCluster, now), etcdCluster, now), nil
+
+}
 
+// apiReader returns the reader of the objects that aren't in the cache of the
+// manager.
+func (r *EtcdClusterReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *EtcdClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Recorder = mgr.GetEventRecorderFor("etcdcluster-controller")
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&ecv1alpha1.EtcdCluster{}).
+	if r.EtcdClients == nil {
+		r.EtcdClients = etcdutils.NewClientPool()
+	}
+	opts := controller.Options{
+		MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+		RateLimiter:             newRateLimiter(r.RateLimiter),
+	}
+	if r.PriorityQueue {
+		opts.NewQueue = newClusterPriorityQueue(mgr.GetClient(), mgr.GetLogger())
+	}
+	opts.NewQueue = newTrackedQueue("etcdclusters", opts.NewQueue)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&ecv1alpha1.EtcdCluster{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return r.Shard.owns(obj)
+		}), ignoreMembersStatusUpdates)).
 		Owns(&appsv1.StatefulSet{}).
+		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
 		Owns(&corev1.ConfigMap{}).
-		Complete(r)
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Watches(&ecv1alpha1.EtcdClusterOverride{}, handler.EnqueueRequestsFromMapFunc(r.clustersForOverride))
+	if !r.RestrictedRBAC {
+		b = b.Watches(&ecv1alpha1.EtcdClusterTemplate{}, handler.EnqueueRequestsFromMapFunc(r.clustersForTemplate))
+	}
+	return b.WithOptions(opts).Complete(r)
+}
+
+// RestrictedRBACUncachedObjects lists the cluster-scoped objects read by the
+// operator, which must bypass the cache of the manager in the restricted RBAC
+// mode: caching them would list and watch them across the Kubernetes cluster.
+func RestrictedRBACUncachedObjects() []client.Object {
+	return []client.Object{
+		&ecv1alpha1.EtcdClusterTemplate{},
+		&ecv1alpha1.EtcdOperatorPolicy{},
+		&corev1.Namespace{},
+	}
 }
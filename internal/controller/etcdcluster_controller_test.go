@@ -21,11 +21,13 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	operatorv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
 )
 
 func TestControllerReconcile(t *testing.T) {
@@ -70,8 +72,10 @@ func TestControllerReconcile(t *testing.T) {
 	}()
 
 	reconciler := &EtcdClusterReconciler{
-		Client: k8sClient,
-		Scheme: k8sClient.Scheme(),
+		Client:      k8sClient,
+		Scheme:      k8sClient.Scheme(),
+		Recorder:    record.NewFakeRecorder(100),
+		EtcdClients: etcdutils.NewClientPool(),
 	}
 
 	_, err = reconciler.Reconcile(ctx, reconcile.Request{
@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+	"go.etcd.io/etcd-operator/internal/validation"
+)
+
+var (
+	mutationVersions = []string{"v3.5.17", "v3.5.21", "v3.6.0"}
+	mutationOptions  = []string{
+		"--snapshot-count=10000",
+		"--quota-backend-bytes=4294967296",
+		"--auto-compaction-mode=periodic",
+		"--auto-compaction-retention=1h",
+		"--experimental-initial-corrupt-check=true",
+		"--max-txn-ops=256",
+	}
+)
+
+// mutationSettings returns the seed and the number of mutations of
+// TestReconcileRandomMutations, which MUTATION_SEED and MUTATION_ITERATIONS
+// override to replay or extend a run.
+func mutationSettings(t *testing.T) (uint64, int) {
+	seed := uint64(time.Now().UnixNano())
+	if s := os.Getenv("MUTATION_SEED"); s != "" {
+		var err error
+		if seed, err = strconv.ParseUint(s, 10, 64); err != nil {
+			t.Fatalf("Invalid MUTATION_SEED: %v", err)
+		}
+	}
+	iterations := 50
+	if testing.Short() {
+		iterations = 10
+	}
+	if s := os.Getenv("MUTATION_ITERATIONS"); s != "" {
+		var err error
+		if iterations, err = strconv.Atoi(s); err != nil {
+			t.Fatalf("Invalid MUTATION_ITERATIONS: %v", err)
+		}
+	}
+	return seed, iterations
+}
+
+// mutateSpec applies a random change to the spec of ec. The change may be
+// invalid, the caller is expected to validate it.
+func mutateSpec(rng *rand.Rand, ec *ecv1alpha1.EtcdCluster) {
+	spec := &ec.Spec
+	switch rng.IntN(5) {
+	case 0:
+		spec.Size = rng.IntN(8)
+	case 1:
+		spec.Version = mutationVersions[rng.IntN(len(mutationVersions))]
+	case 2:
+		spec.EtcdOptions = nil
+		for _, opt := range mutationOptions {
+			if rng.IntN(3) == 0 {
+				spec.EtcdOptions = append(spec.EtcdOptions, opt)
+			}
+		}
+	case 3:
+		if spec.Ports == nil {
+			spec.Ports = &ecv1alpha1.EtcdPorts{}
+		}
+		spec.Ports.Client = int32(2379 + rng.IntN(3)*1000)
+	case 4:
+		if rng.IntN(2) == 0 {
+			spec.PodTemplate = nil
+			break
+		}
+		port := ecv1alpha1.DefaultClientPort
+		if spec.Ports != nil && spec.Ports.Client != 0 {
+			port = spec.Ports.Client
+		}
+		spec.PodTemplate = &ecv1alpha1.PodTemplate{
+			ReadinessProbe: &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(port)},
+				},
+				PeriodSeconds:    int32(5 + rng.IntN(10)),
+				FailureThreshold: 3,
+			},
+		}
+	}
+}
+
+// validMutation reports whether the update from old to ec would be accepted
+// by the webhook and acted on by the controller.
+func validMutation(old, ec *ecv1alpha1.EtcdCluster) bool {
+	newEc, oldEc := ec.DeepCopy(), old.DeepCopy()
+	ecv1alpha1.SetEtcdClusterDefaults(newEc)
+	ecv1alpha1.SetEtcdClusterDefaults(oldEc)
+	errs, _ := validation.ValidateEtcdCluster(newEc)
+	updateErrs, _ := validation.ValidateEtcdClusterUpdate(newEc, oldEc)
+	errs = append(errs, updateErrs...)
+	return len(errs) == 0
+}
+
+// checkPlanInvariants checks that the actions planned for ec, given the
+// StatefulSet running its members, move the cluster towards its spec one
+// member at a time, so it never loses quorum on the way.
+func checkPlanInvariants(t *testing.T, step string, ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) {
+	t.Helper()
+	var current int32
+	if sts != nil {
+		current = ptr.Deref(sts.Spec.Replicas, 0)
+	}
+	desired := int32(ec.Spec.Size)
+
+	counts := map[string]int{}
+	for _, a := range ec.Status.PlannedActions {
+		counts[a.Type]++
+	}
+	for action, n := range counts {
+		if n > 1 {
+			t.Errorf("%s: %s planned %d times: %v", step, action, n, ec.Status.PlannedActions)
+		}
+	}
+	if (counts[actionCreateStatefulSet] == 1) != (sts == nil) {
+		t.Errorf("%s: CreateStatefulSet planned %d times with StatefulSet present=%t", step, counts[actionCreateStatefulSet], sts != nil)
+	}
+	if counts[actionRollingRestart] == 1 && current == 0 {
+		t.Errorf("%s: RollingRestart planned without members", step)
+	}
+	if counts[actionUpgrade] == 1 && current == 0 {
+		t.Errorf("%s: Upgrade planned without members", step)
+	}
+	if (counts[actionScaleOut] == 1) != (desired > current) {
+		t.Errorf("%s: ScaleOut planned %d times from %d to %d members", step, counts[actionScaleOut], current, desired)
+	}
+	if (counts[actionScaleIn] == 1) != (desired < current) {
+		t.Errorf("%s: ScaleIn planned %d times from %d to %d members", step, counts[actionScaleIn], current, desired)
+	}
+
+	if cond := meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionSpecInvalid); cond != nil {
+		if cond.Status != metav1.ConditionFalse {
+			t.Errorf("%s: valid spec reported as invalid: %s", step, cond.Message)
+		}
+		if cond.ObservedGeneration != ec.Generation {
+			t.Errorf("%s: SpecInvalid condition observed generation %d, expected %d", step, cond.ObservedGeneration, ec.Generation)
+		}
+	}
+}
+
+// advanceMembers emulates the progress of the members towards the spec of
+// ec, the way the controller applies it: the StatefulSet is created empty,
+// then members are added or removed one at a time, the pod template following
+// the spec.
+func advanceMembers(ctx context.Context, t *testing.T, ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) {
+	t.Helper()
+	resolved := ec.DeepCopy()
+	ecv1alpha1.SetEtcdClusterDefaults(resolved)
+
+	if sts == nil {
+		spec, err := newStatefulSetSpec(resolved, 0, nil)
+		if err != nil {
+			t.Fatalf("Failed to build the StatefulSet: %v", err)
+		}
+		sts = &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: ec.Namespace},
+			Spec:       spec,
+		}
+		if err := k8sClient.Create(ctx, sts); err != nil {
+			t.Fatalf("Failed to create the StatefulSet: %v", err)
+		}
+		return
+	}
+
+	replicas := ptr.Deref(sts.Spec.Replicas, 0)
+	switch desired := int32(resolved.Spec.Size); {
+	case desired > replicas:
+		replicas++
+	case desired < replicas:
+		replicas--
+	}
+	spec, err := newStatefulSetSpec(resolved, replicas, nil)
+	if err != nil {
+		t.Fatalf("Failed to build the StatefulSet: %v", err)
+	}
+	sts.Spec.Replicas = &replicas
+	sts.Spec.Template = spec.Template
+	if err := k8sClient.Update(ctx, sts); err != nil {
+		t.Fatalf("Failed to update the StatefulSet: %v", err)
+	}
+}
+
+// TestReconcileRandomMutations applies random valid changes to the spec of
+// an EtcdCluster, and checks after each one that the controller doesn't
+// panic, plans safe actions, and that its plan converges as the members
+// catch up with the spec. The controller runs in dry-run mode, as there are
+// no etcd members behind envtest; their progress is emulated on the
+// StatefulSet by advanceMembers. A failing run is replayed with the seed it
+// logs in MUTATION_SEED.
+func TestReconcileRandomMutations(t *testing.T) {
+	seed, iterations := mutationSettings(t)
+	t.Logf("Mutation seed: %d", seed)
+	rng := rand.New(rand.NewPCG(seed, seed))
+
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "mutation-etcd", Namespace: "default"}
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        key.Name,
+			Namespace:   key.Namespace,
+			Annotations: map[string]string{ecv1alpha1.DryRunAnnotation: "true"},
+		},
+		Spec: ecv1alpha1.EtcdClusterSpec{Size: 3, Version: ecv1alpha1.DefaultEtcdVersion},
+	}
+	if err := k8sClient.Create(ctx, ec); err != nil {
+		t.Fatalf("Failed to create EtcdCluster: %v", err)
+	}
+	defer func() {
+		_ = k8sClient.Delete(ctx, ec)
+		_ = k8sClient.Delete(ctx, &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}})
+	}()
+
+	reconciler := &EtcdClusterReconciler{
+		Client:      k8sClient,
+		Scheme:      scheme.Scheme,
+		Recorder:    &record.FakeRecorder{},
+		EtcdClients: etcdutils.NewClientPool(),
+	}
+	reconcileOnce := func(step string) *ecv1alpha1.EtcdCluster {
+		t.Helper()
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("%s: reconcile panicked (seed %d): %v", step, seed, r)
+				}
+			}()
+			if _, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("%s: reconcile failed (seed %d): %v", step, seed, err)
+			}
+		}()
+		latest := &ecv1alpha1.EtcdCluster{}
+		if err := k8sClient.Get(ctx, key, latest); err != nil {
+			t.Fatalf("Failed to get EtcdCluster: %v", err)
+		}
+		return latest
+	}
+	getStatefulSetOrNil := func() *appsv1.StatefulSet {
+		sts := &appsv1.StatefulSet{}
+		if err := k8sClient.Get(ctx, key, sts); err != nil {
+			if k8serrors.IsNotFound(err) {
+				return nil
+			}
+			t.Fatalf("Failed to get StatefulSet: %v", err)
+		}
+		return sts
+	}
+
+	for i := 0; i < iterations; i++ {
+		latest := &ecv1alpha1.EtcdCluster{}
+		if err := k8sClient.Get(ctx, key, latest); err != nil {
+			t.Fatalf("Failed to get EtcdCluster: %v", err)
+		}
+		mutated := latest.DeepCopy()
+		mutateSpec(rng, mutated)
+		if !validMutation(latest, mutated) {
+			continue
+		}
+		if err := k8sClient.Update(ctx, mutated); err != nil {
+			t.Fatalf("Mutation %d: failed to update EtcdCluster with %+v: %v", i, mutated.Spec, err)
+		}
+
+		// Without members to wait for, each member added or removed takes
+		// one step, plus one to create the StatefulSet.
+		var plan []ecv1alpha1.PlannedAction
+		converged := false
+		for s := 0; s <= 2*8+1; s++ {
+			step := fmt.Sprintf("mutation %d step %d", i, s)
+			current := reconcileOnce(step)
+			if current.Spec.Size == 0 {
+				// The controller doesn't plan for clusters of size 0.
+				converged = true
+				break
+			}
+			sts := getStatefulSetOrNil()
+			checkPlanInvariants(t, step, current, sts)
+
+			// The same state must always lead to the same plan.
+			again := reconcileOnce(step + " replay")
+			if !equality.Semantic.DeepEqual(current.Status.PlannedActions, again.Status.PlannedActions) {
+				t.Errorf("%s: plan changed without changes: %v then %v", step, current.Status.PlannedActions, again.Status.PlannedActions)
+			}
+
+			plan = again.Status.PlannedActions
+			if len(plan) == 0 {
+				converged = true
+				break
+			}
+			advanceMembers(ctx, t, again, sts)
+		}
+		if !converged {
+			t.Fatalf("Mutation %d: plan didn't converge for %+v (seed %d): %v", i, mutated.Spec, seed, plan)
+		}
+	}
+}
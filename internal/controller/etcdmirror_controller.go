@@ -0,0 +1,367 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+	"go.etcd.io/etcd-operator/internal/mirror"
+)
+
+// mirrorStatusPeriod is how often the progress of the running mirrors is
+// recorded in the status of their EtcdMirror.
+const mirrorStatusPeriod = 30 * time.Second
+
+const (
+	reasonMirroring        = "Mirroring"
+	reasonMirrorCopying    = "Copying"
+	reasonMirrorFailed     = "MirrorFailed"
+	reasonConnectionFailed = "ConnectionFailed"
+)
+
+// EtcdMirrorReconciler runs the mirrors described by EtcdMirrors, which
+// replicate the keys of an EtcdCluster to another etcd cluster. The mirrors
+// run in the operator, as long as their EtcdMirror exists.
+type EtcdMirrorReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Shard selects the EtcdClusters reconciled by this instance of the
+	// operator. The EtcdMirrors follow the shard of their source.
+	Shard Shard
+	// APIReader reads the TLS and the credentials Secrets of the
+	// destinations, which aren't in the cache of the manager. The Client is
+	// used when not set.
+	APIReader client.Reader
+
+	mu      sync.Mutex
+	mirrors map[types.NamespacedName]*runningMirror
+}
+
+// runningMirror is a mirror run for an EtcdMirror, along with what it was
+// started with.
+type runningMirror struct {
+	*mirror.Mirror
+	// generation is the generation of the EtcdMirror the mirror runs.
+	generation  int64
+	source      etcdutils.Connection
+	destination etcdutils.Connection
+	clients     []*clientv3.Client
+}
+
+// stop stops the mirror and closes its clients.
+func (m *runningMirror) stop() {
+	m.Stop()
+	for _, c := range m.clients {
+		_ = c.Close()
+	}
+}
+
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdmirrors,verbs=get;list;watch
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdmirrors/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;patch
+
+// Reconcile runs the mirror of an EtcdMirror, restarting it when its spec or
+// the connections to its clusters change, and records its progress in the
+// status of the EtcdMirror. With a failover, it promotes the destination once
+// due, which stops the mirror for good.
+func (r *EtcdMirrorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	em := &ecv1alpha1.EtcdMirror{}
+	if err := r.Get(ctx, req.NamespacedName, em); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			r.stop(req.NamespacedName)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	source, err := getAuthCluster(ctx, r.Client, em.Namespace, em.Spec.SourceClusterName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Without its source, em follows its own shard.
+	if (source != nil && !r.Shard.owns(source)) || (source == nil && !r.Shard.owns(em)) {
+		r.stop(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+	if isPaused(em) {
+		logger.Info("Reconciliation is paused")
+		return ctrl.Result{}, nil
+	}
+	base := em.DeepCopy()
+	ecv1alpha1.SetEtcdMirrorDefaults(em)
+
+	failoverWait, err := r.reconcileFailover(ctx, em, source, time.Now())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	condition := metav1.Condition{
+		Type:               ecv1alpha1.EtcdMirrorConditionMirroring,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: em.Generation,
+	}
+	result := ctrl.Result{RequeueAfter: requeueDuration}
+	var mirrorErr error
+	src, dst, reason, message, err := r.connections(ctx, em, source)
+	switch {
+	case em.Status.PromotedTime != nil:
+		condition.Reason = reasonPromoted
+		condition.Message = fmt.Sprintf("EtcdCluster %s was promoted at %s", em.Spec.Destination.ClusterName,
+			em.Status.PromotedTime.UTC().Format(time.RFC3339))
+		r.stop(req.NamespacedName)
+		result = ctrl.Result{}
+	case err != nil:
+		mirrorErr = err
+		condition.Reason = reasonConnectionFailed
+		condition.Message = err.Error()
+		r.stop(req.NamespacedName)
+	case reason != "":
+		condition.Reason = reason
+		condition.Message = message
+		r.stop(req.NamespacedName)
+	default:
+		m, started, err := r.run(req.NamespacedName, em, src, dst)
+		if err != nil {
+			mirrorErr = err
+			condition.Reason = reasonConnectionFailed
+			condition.Message = err.Error()
+			break
+		}
+		if started {
+			logger.Info("Started mirroring", "revision", m.Status().Revision)
+			r.Recorder.Eventf(em, corev1.EventTypeNormal, "MirrorStarted", "Started mirroring EtcdCluster %s", em.Spec.SourceClusterName)
+		}
+		r.recordProgress(ctx, em, m, &condition)
+		mirrors.observe(em)
+		result = ctrl.Result{RequeueAfter: mirrorStatusPeriod}
+	}
+	if previous := meta.FindStatusCondition(em.Status.Conditions, condition.Type); condition.Reason == reasonMirrorFailed &&
+		(previous == nil || previous.Reason != reasonMirrorFailed) {
+		r.Recorder.Event(em, corev1.EventTypeWarning, "MirrorFailed", condition.Message)
+	}
+	meta.SetStatusCondition(&em.Status.Conditions, condition)
+
+	if err := r.Status().Patch(ctx, em, client.MergeFrom(base)); err != nil {
+		return ctrl.Result{}, err
+	}
+	if failoverWait > 0 && (result.RequeueAfter == 0 || failoverWait < result.RequeueAfter) {
+		result.RequeueAfter = failoverWait
+	}
+	return result, mirrorErr
+}
+
+// connections returns how the source of em and its destination are reached.
+// While either isn't available yet, it returns the reason and the message of
+// the Mirroring condition instead.
+func (r *EtcdMirrorReconciler) connections(ctx context.Context, em *ecv1alpha1.EtcdMirror, source *ecv1alpha1.EtcdCluster) (
+	src, dst etcdutils.Connection, reason, message string, err error) {
+	if reason, message = waitingForCluster(source, em.Spec.SourceClusterName); reason != "" {
+		return src, dst, reason, message, nil
+	}
+	if src, err = clusterConnection(ctx, r.Client, source); err != nil {
+		return src, dst, "", "", err
+	}
+
+	spec := em.Spec.Destination
+	if spec.ClusterName != "" {
+		destination, err := getAuthCluster(ctx, r.Client, em.Namespace, spec.ClusterName)
+		if err != nil {
+			return src, dst, "", "", err
+		}
+		if reason, message = waitingForCluster(destination, spec.ClusterName); reason != "" {
+			return src, dst, reason, message, nil
+		}
+		dst, err = clusterConnection(ctx, r.Client, destination)
+		return src, dst, "", "", err
+	}
+
+	dst.Endpoints = spec.Endpoints
+	if spec.TLSSecretRef != nil {
+		secret := &corev1.Secret{}
+		if err := r.apiReader().Get(ctx, client.ObjectKey{Name: spec.TLSSecretRef.Name, Namespace: em.Namespace}, secret); err != nil {
+			return src, dst, "", "", fmt.Errorf("failed to get the TLS Secret %s: %w", spec.TLSSecretRef.Name, err)
+		}
+		if dst.TLSConfig, err = tlsConfigFromSecret(secret); err != nil {
+			return src, dst, "", "", err
+		}
+	}
+	if spec.CredentialsSecretRef != nil {
+		secret := &corev1.Secret{}
+		if err := r.apiReader().Get(ctx, client.ObjectKey{Name: spec.CredentialsSecretRef.Name, Namespace: em.Namespace}, secret); err != nil {
+			return src, dst, "", "", fmt.Errorf("failed to get the credentials Secret %s: %w", spec.CredentialsSecretRef.Name, err)
+		}
+		dst.Credentials = &etcdutils.Credentials{
+			Username: string(secret.Data[corev1.BasicAuthUsernameKey]),
+			Password: string(secret.Data[corev1.BasicAuthPasswordKey]),
+		}
+	}
+	return src, dst, "", "", nil
+}
+
+// waitingForCluster returns the reason and the message of the Mirroring
+// condition while the EtcdCluster ec, named name, can't be reached yet, or
+// empty strings once it can. ec is nil when it doesn't exist.
+func waitingForCluster(ec *ecv1alpha1.EtcdCluster, name string) (string, string) {
+	switch {
+	case ec == nil:
+		return reasonClusterNotFound, fmt.Sprintf("EtcdCluster %s not found", name)
+	case ec.Status.Endpoints == "":
+		return reasonClusterNotReady, fmt.Sprintf("Waiting for EtcdCluster %s to publish its endpoints", name)
+	}
+	return "", ""
+}
+
+// clusterConnection returns how the operator connects to the members of ec.
+func clusterConnection(ctx context.Context, c client.Reader, ec *ecv1alpha1.EtcdCluster) (etcdutils.Connection, error) {
+	tlsConfig, err := clusterTLSConfig(ctx, c, ec)
+	if err != nil {
+		return etcdutils.Connection{}, err
+	}
+	creds, err := clusterCredentials(ctx, c, ec)
+	if err != nil {
+		return etcdutils.Connection{}, err
+	}
+	return etcdutils.Connection{
+		Endpoints:   strings.Split(ec.Status.Endpoints, ","),
+		TLSConfig:   tlsConfig,
+		Credentials: creds,
+	}, nil
+}
+
+// run returns the mirror of em, identified by key, from src to dst, and
+// whether it was just started. A mirror running a previous generation of em,
+// or other connections, is replaced. The new mirror resumes from the
+// revision mirrored so far, unless the spec of em changed since.
+func (r *EtcdMirrorReconciler) run(key types.NamespacedName, em *ecv1alpha1.EtcdMirror, src, dst etcdutils.Connection) (*mirror.Mirror, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var revision int64
+	if em.Status.ObservedGeneration == em.Generation {
+		revision = em.Status.MirroredRevision
+	}
+	if running, ok := r.mirrors[key]; ok {
+		if running.generation == em.Generation && running.source.Equal(src) && running.destination.Equal(dst) {
+			return running.Mirror, false, nil
+		}
+		if running.generation == em.Generation {
+			revision = running.Status().Revision
+		}
+		running.stop()
+		delete(r.mirrors, key)
+	}
+
+	srcClient, err := src.NewClient()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to connect to the source: %w", err)
+	}
+	dstClient, err := dst.NewClient()
+	if err != nil {
+		_ = srcClient.Close()
+		return nil, false, fmt.Errorf("failed to connect to the destination: %w", err)
+	}
+	running := &runningMirror{
+		Mirror: mirror.Start(mirror.Options{
+			Source:      srcClient,
+			Destination: dstClient,
+			Prefix:      em.Spec.Prefix,
+			DestPrefix:  em.Spec.DestPrefix,
+			Revision:    revision,
+			Logger:      ctrl.Log.WithName("etcdmirror").WithValues("etcdmirror", key.String()),
+		}),
+		generation:  em.Generation,
+		source:      src,
+		destination: dst,
+		clients:     []*clientv3.Client{srcClient, dstClient},
+	}
+	if r.mirrors == nil {
+		r.mirrors = map[types.NamespacedName]*runningMirror{}
+	}
+	r.mirrors[key] = running
+	return running.Mirror, true, nil
+}
+
+// stop stops the mirror of the EtcdMirror key, if it runs.
+func (r *EtcdMirrorReconciler) stop(key types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if running, ok := r.mirrors[key]; ok {
+		running.stop()
+		delete(r.mirrors, key)
+	}
+	mirrors.forget(key)
+}
+
+// recordProgress records the progress of m in the status of em, and sets
+// condition accordingly.
+func (r *EtcdMirrorReconciler) recordProgress(ctx context.Context, em *ecv1alpha1.EtcdMirror, m *mirror.Mirror, condition *metav1.Condition) {
+	status := m.Status()
+	em.Status.ObservedGeneration = em.Generation
+	em.Status.MirroredRevision = status.Revision
+	if !status.LastSyncTime.IsZero() {
+		em.Status.LastSyncTime = &metav1.Time{Time: status.LastSyncTime}
+	}
+	revCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if rev, err := m.SourceRevision(revCtx); err == nil {
+		em.Status.SourceRevision = rev
+	} else {
+		log.FromContext(ctx).Error(err, "Failed to get the revision of the source")
+	}
+	em.Status.LagRevisions = 0
+	if status.Revision > 0 {
+		em.Status.LagRevisions = max(0, em.Status.SourceRevision-status.Revision)
+	}
+
+	switch {
+	case status.Err != nil:
+		condition.Reason = reasonMirrorFailed
+		condition.Message = status.Err.Error()
+	case status.Revision == 0:
+		condition.Reason = reasonMirrorCopying
+		condition.Message = fmt.Sprintf("Copying the keys of EtcdCluster %s", em.Spec.SourceClusterName)
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonMirroring
+		condition.Message = fmt.Sprintf("Mirroring EtcdCluster %s", em.Spec.SourceClusterName)
+	}
+}
+
+// apiReader returns the reader of the objects that aren't in the cache of the
+// manager.
+func (r *EtcdMirrorReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdMirrorReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("etcdmirror-controller")
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ecv1alpha1.EtcdMirror{}).
+		Owns(&corev1.Service{}).
+		WithOptions(controller.Options{NewQueue: newTrackedQueue("etcdmirrors", nil)}).
+		Complete(r)
+}
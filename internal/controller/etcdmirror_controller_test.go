@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func TestEtcdMirrorConnections(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	source := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "primary", Namespace: "default"},
+		Status:     ecv1alpha1.EtcdClusterStatus{Endpoints: "http://primary-0:2379,http://primary-1:2379"},
+	}
+	standby := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "standby", Namespace: "default"}}
+	creds := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "remote-credentials", Namespace: "default"},
+		Type:       corev1.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte("mirror"),
+			corev1.BasicAuthPasswordKey: []byte("s3cr3t"),
+		},
+	}
+	r := &EtcdMirrorReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(source, standby, creds).Build(),
+		Scheme: scheme,
+	}
+	em := &ecv1alpha1.EtcdMirror{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr", Namespace: "default"},
+		Spec: ecv1alpha1.EtcdMirrorSpec{
+			SourceClusterName: "primary",
+			Destination:       ecv1alpha1.EtcdMirrorDestination{ClusterName: "standby"},
+		},
+	}
+
+	// The destination EtcdCluster must publish its endpoints first.
+	_, _, reason, message, err := r.connections(ctx, em, source)
+	assert.NoError(t, err)
+	assert.Equal(t, reasonClusterNotReady, reason)
+	assert.Equal(t, "Waiting for EtcdCluster standby to publish its endpoints", message)
+
+	standby.Status.Endpoints = "http://standby-0:2379"
+	assert.NoError(t, r.Update(ctx, standby))
+	src, dst, reason, _, err := r.connections(ctx, em, source)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	assert.Equal(t, []string{"http://primary-0:2379", "http://primary-1:2379"}, src.Endpoints)
+	assert.Equal(t, []string{"http://standby-0:2379"}, dst.Endpoints)
+	assert.Nil(t, dst.TLSConfig)
+
+	// A cluster the operator doesn't run is reached through its endpoints.
+	em.Spec.Destination = ecv1alpha1.EtcdMirrorDestination{
+		Endpoints:            []string{"https://10.0.0.10:2379"},
+		CredentialsSecretRef: &corev1.LocalObjectReference{Name: "remote-credentials"},
+	}
+	_, dst, _, _, err = r.connections(ctx, em, source)
+	assert.NoError(t, err)
+	assert.Equal(t, etcdutils.Connection{
+		Endpoints:   []string{"https://10.0.0.10:2379"},
+		Credentials: &etcdutils.Credentials{Username: "mirror", Password: "s3cr3t"},
+	}, dst)
+
+	em.Spec.Destination.TLSSecretRef = &corev1.LocalObjectReference{Name: "missing"}
+	_, _, _, _, err = r.connections(ctx, em, source)
+	assert.ErrorContains(t, err, "failed to get the TLS Secret missing")
+
+	_, _, reason, message, err = r.connections(ctx, em, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, reasonClusterNotFound, reason)
+	assert.Equal(t, "EtcdCluster primary not found", message)
+}
+
+func TestEtcdMirrorReconcileWaiting(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	em := &ecv1alpha1.EtcdMirror{
+		ObjectMeta: metav1.ObjectMeta{Name: "dr", Namespace: "default", Generation: 2},
+		Spec: ecv1alpha1.EtcdMirrorSpec{
+			SourceClusterName: "primary",
+			Destination:       ecv1alpha1.EtcdMirrorDestination{Endpoints: []string{"http://10.0.0.10:2379"}},
+		},
+	}
+	r := &EtcdMirrorReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(em).WithStatusSubresource(em).Build(),
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "dr", Namespace: "default"}}
+
+	result, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, requeueDuration, result.RequeueAfter)
+	got := &ecv1alpha1.EtcdMirror{}
+	assert.NoError(t, r.Get(ctx, client.ObjectKeyFromObject(em), got))
+	condition := meta.FindStatusCondition(got.Status.Conditions, ecv1alpha1.EtcdMirrorConditionMirroring)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+		assert.Equal(t, reasonClusterNotFound, condition.Reason)
+		assert.Equal(t, int64(2), condition.ObservedGeneration)
+	}
+	assert.Empty(t, r.mirrors)
+
+	// Nothing is left running once the EtcdMirror is deleted.
+	assert.NoError(t, r.Delete(ctx, got))
+	result, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+}
+
+func TestMirrorCollector(t *testing.T) {
+	em := &ecv1alpha1.EtcdMirror{ObjectMeta: metav1.ObjectMeta{Name: "test-mirror", Namespace: "metrics"}}
+	key := types.NamespacedName{Namespace: "metrics", Name: "test-mirror"}
+
+	// Nothing is exported until the keys are copied.
+	mirrors.observe(em)
+	_, ok := mirrors.statuses[key]
+	assert.False(t, ok)
+
+	em.Status.MirroredRevision = 42
+	em.Status.LagRevisions = 3
+	mirrors.observe(em)
+	assert.Equal(t, 2*len(mirrors.statuses), testutil.CollectAndCount(mirrors))
+	assert.Equal(t, int64(3), mirrors.statuses[key].LagRevisions)
+
+	mirrors.forget(key)
+	_, ok = mirrors.statuses[key]
+	assert.False(t, ok)
+}
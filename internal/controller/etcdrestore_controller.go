@@ -0,0 +1,371 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// restoreDataDir is where the volume of the first member is mounted in
+	// the restore Jobs. The members keep their data in a directory of the
+	// volume named after their Pod.
+	restoreDataDir = "/data"
+	// restoreSnapshotDir is where the snapshot is read from in the restore
+	// Jobs.
+	restoreSnapshotDir = "/snapshot"
+	// restoreDecryptedDir is where the encrypted snapshots are decrypted to
+	// in the restore Jobs.
+	restoreDecryptedDir = "/decrypted"
+)
+
+// EtcdRestoreReconciler creates the EtcdClusters of EtcdRestores, from a
+// snapshot. The members of the operator join the cluster one at a time, as
+// learners of the members already there, so only the first member is
+// restored from the snapshot: a Job restores it to its volume before the
+// EtcdCluster is created, and the other members replicate its data as they
+// join.
+type EtcdRestoreReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// MaxConcurrentReconciles is the number of EtcdRestores reconciled in
+	// parallel. It defaults to 1 when not set.
+	MaxConcurrentReconciles int
+	// OperatorImage is the image of the operator, run by the restore Jobs to
+	// decrypt the snapshots. The encrypted restores fail when it isn't set.
+	OperatorImage string
+	// HostPathDirs are the directories of the nodes the snapshots of the
+	// HostPath sources may be read from, see snapshotStorage.check.
+	HostPathDirs []string
+}
+
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdrestores,verbs=get;list;watch
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdrestores/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdclusters,verbs=get;create
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=create;patch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create
+
+// Reconcile restores the snapshot of an EtcdRestore to the volume of the
+// first member of its EtcdCluster, then creates the EtcdCluster.
+func (r *EtcdRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	restore := &ecv1alpha1.EtcdRestore{}
+	if err := r.Get(ctx, req.NamespacedName, restore); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if restore.Status.Phase == ecv1alpha1.EtcdRestorePhaseCompleted || restore.Status.Phase == ecv1alpha1.EtcdRestorePhaseFailed {
+		return ctrl.Result{}, nil
+	}
+	if isPaused(restore) {
+		logger.Info("Reconciliation is paused")
+		return ctrl.Result{}, nil
+	}
+	base := restore.DeepCopy()
+	ec := restoredCluster(restore)
+
+	existing := &ecv1alpha1.EtcdCluster{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(ec), existing)
+	if err == nil {
+		if existing.Labels[ecv1alpha1.RestoreLabel] != restore.Name {
+			r.fail(restore, fmt.Sprintf("EtcdCluster %s already exists", ec.Name))
+			return ctrl.Result{}, r.Status().Patch(ctx, restore, client.MergeFrom(base))
+		}
+		// The cluster was created by a previous reconcile.
+		return ctrl.Result{}, r.complete(ctx, restore, base, existing)
+	}
+	if !k8serrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	if restore.Spec.Encryption != nil && r.OperatorImage == "" {
+		r.fail(restore, "the snapshot can't be decrypted, the operator runs without --operator-image")
+		return ctrl.Result{}, r.Status().Patch(ctx, restore, client.MergeFrom(base))
+	}
+	if err := checkRestoreSource(restore.Spec.Source, r.HostPathDirs); err != nil {
+		r.fail(restore, err.Error())
+		return ctrl.Result{}, r.Status().Patch(ctx, restore, client.MergeFrom(base))
+	}
+
+	if restore.Status.StartTime == nil {
+		restore.Status.Phase = ecv1alpha1.EtcdRestorePhaseRunning
+		restore.Status.StartTime = ptr.To(metav1.Now())
+		if err := r.Status().Patch(ctx, restore, client.MergeFrom(base)); err != nil {
+			return ctrl.Result{}, err
+		}
+		base = restore.DeepCopy()
+	}
+
+	job := &batchv1.Job{}
+	err = r.Get(ctx, client.ObjectKey{Name: restoreJobName(restore), Namespace: restore.Namespace}, job)
+	if k8serrors.IsNotFound(err) {
+		return ctrl.Result{}, r.startRestoreJob(ctx, restore, ec)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			if err := r.Create(ctx, ec); err != nil {
+				return ctrl.Result{}, err
+			}
+			logger.Info("Created the restored EtcdCluster", "cluster", ec.Name)
+			return ctrl.Result{}, r.complete(ctx, restore, base, ec)
+		case batchv1.JobFailed:
+			r.fail(restore, fmt.Sprintf("restore Job %s failed: %s", job.Name, c.Message))
+			return ctrl.Result{}, r.Status().Patch(ctx, restore, client.MergeFrom(base))
+		}
+	}
+	// The Job changes trigger a new reconcile.
+	return ctrl.Result{}, nil
+}
+
+// startRestoreJob creates the volume of the first member of ec, unless the
+// members share a PersistentVolumeClaim, and the Job restoring the snapshot
+// of restore to it.
+func (r *EtcdRestoreReconciler) startRestoreJob(ctx context.Context, restore *ecv1alpha1.EtcdRestore, ec *ecv1alpha1.EtcdCluster) error {
+	if ec.Spec.StorageSpec.AccessModes == corev1.ReadWriteOnce {
+		stsSpec, err := newStatefulSetSpec(ec, 1, nil)
+		if err != nil {
+			return err
+		}
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      firstMemberClaimName(ec),
+				Namespace: ec.Namespace,
+			},
+			Spec: stsSpec.VolumeClaimTemplates[0].Spec,
+		}
+		// The volume goes with the restore until the EtcdCluster exists.
+		if err := controllerutil.SetControllerReference(restore, pvc, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, pvc); client.IgnoreAlreadyExists(err) != nil {
+			return err
+		}
+	}
+
+	job := newRestoreJob(restore, ec, r.OperatorImage)
+	if err := controllerutil.SetControllerReference(restore, job, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, job); client.IgnoreAlreadyExists(err) != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Started restore", "cluster", ec.Name)
+	return nil
+}
+
+// complete hands the volume of the first member over to ec, the EtcdCluster
+// created by restore, and marks restore as completed.
+func (r *EtcdRestoreReconciler) complete(ctx context.Context, restore, base *ecv1alpha1.EtcdRestore, ec *ecv1alpha1.EtcdCluster) error {
+	if ec.Spec.StorageSpec != nil && ec.Spec.StorageSpec.AccessModes == corev1.ReadWriteOnce {
+		// The StatefulSet would have given the volume the same owner.
+		owners, err := prepareOwnerReference(ec, r.Scheme)
+		if err != nil {
+			return err
+		}
+		patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"ownerReferences": owners}})
+		if err != nil {
+			return err
+		}
+		pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: firstMemberClaimName(ec), Namespace: ec.Namespace}}
+		if err := r.Patch(ctx, pvc, client.RawPatch(types.MergePatchType, patch)); err != nil {
+			return err
+		}
+	}
+
+	restore.Status.Phase = ecv1alpha1.EtcdRestorePhaseCompleted
+	restore.Status.CompletionTime = ptr.To(metav1.Now())
+	r.Recorder.Eventf(restore, corev1.EventTypeNormal, "Restored", "Created EtcdCluster %s from the snapshot", ec.Name)
+	return r.Status().Patch(ctx, restore, client.MergeFrom(base))
+}
+
+// fail marks restore as failed with message.
+func (r *EtcdRestoreReconciler) fail(restore *ecv1alpha1.EtcdRestore, message string) {
+	restore.Status.Phase = ecv1alpha1.EtcdRestorePhaseFailed
+	restore.Status.Message = message
+	r.Recorder.Event(restore, corev1.EventTypeWarning, "RestoreFailed", message)
+}
+
+// restoredCluster returns the EtcdCluster created by restore, with the
+// defaults of its spec.
+func restoredCluster(restore *ecv1alpha1.EtcdRestore) *ecv1alpha1.EtcdCluster {
+	ec := &ecv1alpha1.EtcdCluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: ecv1alpha1.GroupVersion.String(),
+			Kind:       "EtcdCluster",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restore.Spec.ClusterName,
+			Namespace: restore.Namespace,
+			Labels:    map[string]string{ecv1alpha1.RestoreLabel: restore.Name},
+		},
+		Spec: *restore.Spec.ClusterSpec.DeepCopy(),
+	}
+	// The restored cluster is a new one.
+	ec.Spec.Adoption = nil
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	return ec
+}
+
+// firstMemberClaimName returns the name of the PersistentVolumeClaim the
+// StatefulSet of ec gives to its first member.
+func firstMemberClaimName(ec *ecv1alpha1.EtcdCluster) string {
+	return fmt.Sprintf("%s-%s-0", volumeName, ec.Name)
+}
+
+// restoreJobName returns the name of the Job restoring the snapshot of
+// restore.
+func restoreJobName(restore *ecv1alpha1.EtcdRestore) string {
+	return restore.Name + "-restore"
+}
+
+// newRestoreJob returns the Job restoring the snapshot of restore to the data
+// directory of the first member of ec. An init container downloads the
+// snapshot from its storage, and another one decrypts it with
+// operatorImage, the image of the operator, when it is encrypted. Then
+// etcdutl restores it with the flags the first member starts with: it is the
+// only member of the initial cluster. The Job isn't retried, etcdutl doesn't
+// restore to an existing data directory.
+func newRestoreJob(restore *ecv1alpha1.EtcdRestore, ec *ecv1alpha1.EtcdCluster, operatorImage string) *batchv1.Job {
+	claimName := firstMemberClaimName(ec)
+	if ec.Spec.StorageSpec.AccessModes == corev1.ReadWriteMany {
+		claimName = ec.Spec.StorageSpec.PVCName
+	}
+
+	snapshotMount := corev1.VolumeMount{Name: "snapshot", MountPath: restoreSnapshotDir}
+	volumes := []corev1.Volume{{
+		Name: "data",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+		},
+	}}
+	snapshotPath := path.Join(restoreSnapshotDir, "snapshot.db")
+	var initContainers []corev1.Container
+	source := restore.Spec.Source
+	storage, fromStorage := restoreStorage(source)
+	switch {
+	case fromStorage:
+		initContainers = append(initContainers, storage.container("fetch", fetchSnapshot, snapshotMount))
+		volumes = append(volumes, corev1.Volume{Name: "snapshot", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}})
+	case source.PVC != nil:
+		snapshotMount.ReadOnly = true
+		if source.PVC.Path != "" {
+			snapshotPath = path.Join(restoreSnapshotDir, source.PVC.Path)
+		}
+		volumes = append(volumes, corev1.Volume{Name: "snapshot", VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: source.PVC.ClaimName, ReadOnly: true},
+		}})
+	}
+	if restore.Spec.Encryption != nil {
+		decryptedMount := corev1.VolumeMount{Name: "decrypted", MountPath: restoreDecryptedDir}
+		decrypted := path.Join(restoreDecryptedDir, "snapshot.db")
+		initContainers = append(initContainers, newSnapshotCryptContainer("decrypt", operatorImage, snapshotPath, decrypted, snapshotMount, decryptedMount))
+		volumes = append(volumes,
+			corev1.Volume{Name: "decrypted", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			encryptionKeyVolume(restore.Spec.Encryption),
+		)
+		snapshotPath, snapshotMount = decrypted, decryptedMount
+	}
+
+	labels := withManagedByLabel(map[string]string{
+		"app":       ec.Name,
+		"component": "restore",
+	})
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restoreJobName(restore),
+			Namespace: restore.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](0),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: restore.Spec.ServiceAccountName,
+					InitContainers:     initContainers,
+					Containers: []corev1.Container{
+						newSnapshotRestoreContainer(ec, snapshotPath, false, snapshotMount),
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+	if fromStorage {
+		storage.configurePod(&job.Spec.Template)
+	}
+	return job
+}
+
+// newSnapshotRestoreContainer returns the container restoring the snapshot at
+// snapshotPath to the data directory of the first member of ec, in the
+// volume mounted at restoreDataDir, with the flags the first member starts
+// with: it is the only member of the initial cluster. skipHashCheck restores
+// the database of a member, which has no hash, rather than a snapshot.
+func newSnapshotRestoreContainer(ec *ecv1alpha1.EtcdCluster, snapshotPath string, skipHashCheck bool, snapshotMount corev1.VolumeMount) corev1.Container {
+	name, peerURLs := peerURLsForOrdinalIndex(ec, 0)
+	initialCluster := make([]string, 0, len(peerURLs))
+	for _, peerURL := range peerURLs {
+		initialCluster = append(initialCluster, fmt.Sprintf("%s=%s", name, peerURL))
+	}
+	command := []string{
+		"/usr/local/bin/etcdutl", "snapshot", "restore", snapshotPath,
+		"--name=" + name,
+		"--initial-cluster=" + strings.Join(initialCluster, ","),
+		"--initial-advertise-peer-urls=" + strings.Join(peerURLs, ","),
+		"--data-dir=" + path.Join(restoreDataDir, name),
+	}
+	if skipHashCheck {
+		command = append(command, "--skip-hash-check")
+	}
+	return corev1.Container{
+		Name:    "restore",
+		Image:   fmt.Sprintf("gcr.io/etcd-development/etcd:%s", ec.Spec.Version),
+		Command: command,
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "data", MountPath: restoreDataDir},
+			snapshotMount,
+		},
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("etcdrestore-controller")
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ecv1alpha1.EtcdRestore{}).
+		Owns(&batchv1.Job{}).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			NewQueue:                newTrackedQueue("etcdrestores", nil),
+		}).
+		Complete(r)
+}
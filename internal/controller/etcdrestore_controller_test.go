@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func newTestRestore() *ecv1alpha1.EtcdRestore {
+	return &ecv1alpha1.EtcdRestore{
+		ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "default", UID: "restore-uid"},
+		Spec: ecv1alpha1.EtcdRestoreSpec{
+			ClusterName: "etcd",
+			ClusterSpec: ecv1alpha1.EtcdClusterSpec{
+				Size:        3,
+				Version:     "v3.5.21",
+				StorageSpec: &ecv1alpha1.StorageSpec{},
+			},
+			Source: ecv1alpha1.RestoreSource{
+				S3: &ecv1alpha1.S3SnapshotSource{
+					Bucket:               "etcd-backups",
+					Key:                  "default/etcd/nightly.db",
+					CredentialsSecretRef: corev1.LocalObjectReference{Name: "etcd-backup-s3"},
+				},
+			},
+		},
+	}
+}
+
+func TestNewRestoreJob(t *testing.T) {
+	restore := newTestRestore()
+	ec := restoredCluster(restore)
+
+	job := newRestoreJob(restore, ec, "")
+	assert.Equal(t, "restore-restore", job.Name)
+	podSpec := job.Spec.Template.Spec
+	assert.Equal(t, corev1.RestartPolicyNever, podSpec.RestartPolicy)
+	assert.Equal(t, "etcd-data-etcd-0", podSpec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	assert.Equal(t, awsCLIImage, podSpec.InitContainers[0].Image)
+	assert.Contains(t, podSpec.InitContainers[0].Env, corev1.EnvVar{Name: "KEY", Value: "default/etcd/nightly.db"})
+	assert.Equal(t, []string{
+		"/usr/local/bin/etcdutl", "snapshot", "restore", "/snapshot/snapshot.db",
+		"--name=etcd-0",
+		"--initial-cluster=etcd-0=http://etcd-0.etcd.default.svc.cluster.local:2380",
+		"--initial-advertise-peer-urls=http://etcd-0.etcd.default.svc.cluster.local:2380",
+		"--data-dir=/data/etcd-0",
+	}, podSpec.Containers[0].Command)
+
+	restore.Spec.Source = ecv1alpha1.RestoreSource{
+		GCS: &ecv1alpha1.GCSSnapshotSource{
+			Bucket:               "etcd-backups",
+			Object:               "etcd.db",
+			CredentialsSecretRef: &corev1.LocalObjectReference{Name: "etcd-backup-gcs"},
+		},
+	}
+	podSpec = newRestoreJob(restore, ec, "").Spec.Template.Spec
+	assert.Equal(t, gcloudImage, podSpec.InitContainers[0].Image)
+	assert.Equal(t, "etcd-backup-gcs", podSpec.Volumes[2].Secret.SecretName)
+
+	restore.Spec.ServiceAccountName = "etcd-backup"
+	restore.Spec.Source = ecv1alpha1.RestoreSource{
+		Azure: &ecv1alpha1.AzureSnapshotSource{StorageAccount: "etcdbackups", Container: "snapshots", Blob: "etcd.db"},
+	}
+	job = newRestoreJob(restore, ec, "")
+	podSpec = job.Spec.Template.Spec
+	assert.Equal(t, azureCLIImage, podSpec.InitContainers[0].Image)
+	assert.Contains(t, podSpec.InitContainers[0].Env, corev1.EnvVar{Name: "BLOB", Value: "etcd.db"})
+	assert.Equal(t, "etcd-backup", podSpec.ServiceAccountName)
+	assert.Equal(t, "true", job.Spec.Template.Labels[azureWorkloadIdentityLabel])
+	assert.NotContains(t, job.Labels, azureWorkloadIdentityLabel)
+
+	restore.Spec.Source = ecv1alpha1.RestoreSource{
+		HostPath: &ecv1alpha1.HostPathSnapshotSource{NodeName: "node-1", Directory: "/var/backups/etcd", Path: "etcd.db"},
+	}
+	podSpec = newRestoreJob(restore, ec, "").Spec.Template.Spec
+	assert.Equal(t, busyboxImage, podSpec.InitContainers[0].Image)
+	assert.Contains(t, podSpec.InitContainers[0].Env, corev1.EnvVar{Name: "FILE", Value: "etcd.db"})
+	assert.Equal(t, "/var/backups/etcd", podSpec.Volumes[2].HostPath.Path)
+	assert.Equal(t, "node-1", podSpec.NodeSelector[corev1.LabelHostname])
+
+	restore.Spec.Source = ecv1alpha1.RestoreSource{
+		PVC: &ecv1alpha1.PVCSnapshotSource{ClaimName: "snapshots", Path: "etcd/latest.db"},
+	}
+	ec.Spec.StorageSpec.AccessModes = corev1.ReadWriteMany
+	ec.Spec.StorageSpec.PVCName = "etcd-shared"
+	podSpec = newRestoreJob(restore, ec, "").Spec.Template.Spec
+	assert.Empty(t, podSpec.InitContainers)
+	assert.Equal(t, "etcd-shared", podSpec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	assert.Equal(t, "snapshots", podSpec.Volumes[1].PersistentVolumeClaim.ClaimName)
+	assert.Equal(t, "/snapshot/etcd/latest.db", podSpec.Containers[0].Command[3])
+
+	restore.Spec.Encryption = &ecv1alpha1.SnapshotEncryption{KeySecretRef: corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "etcd-backup-key"},
+		Key:                  "aes.key",
+	}}
+	podSpec = newRestoreJob(restore, ec, "etcd-operator:v0.1").Spec.Template.Spec
+	decrypt := podSpec.InitContainers[0]
+	assert.Equal(t, "etcd-operator:v0.1", decrypt.Image)
+	assert.Equal(t, []string{"/manager", "snapshot", "decrypt",
+		"-key-file", "/var/run/secrets/encryption/key", "-in", "/snapshot/etcd/latest.db", "-out", "/decrypted/snapshot.db"}, decrypt.Command)
+	assert.Equal(t, "etcd-backup-key", podSpec.Volumes[3].Secret.SecretName)
+	assert.Equal(t, "/decrypted/snapshot.db", podSpec.Containers[0].Command[3])
+	assert.Contains(t, podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "decrypted", MountPath: "/decrypted"})
+}
+
+func TestEtcdRestoreReconcile(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = batchv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	restore := newTestRestore()
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(restore)}
+
+	t.Run("cluster exists", func(t *testing.T) {
+		ec := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "default"}}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(restore.DeepCopy(), ec).
+			WithStatusSubresource(&ecv1alpha1.EtcdRestore{}).Build()
+		r := &EtcdRestoreReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.Reconcile(ctx, req)
+		assert.NoError(t, err)
+		got := &ecv1alpha1.EtcdRestore{}
+		assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+		assert.Equal(t, ecv1alpha1.EtcdRestorePhaseFailed, got.Status.Phase)
+		assert.Equal(t, "EtcdCluster etcd already exists", got.Status.Message)
+	})
+
+	t.Run("paused", func(t *testing.T) {
+		paused := restore.DeepCopy()
+		paused.Annotations = map[string]string{ecv1alpha1.PausedAnnotation: "true"}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(paused).
+			WithStatusSubresource(&ecv1alpha1.EtcdRestore{}).Build()
+		r := &EtcdRestoreReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.Reconcile(ctx, req)
+		assert.NoError(t, err)
+		got := &ecv1alpha1.EtcdRestore{}
+		assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+		assert.Empty(t, got.Status.Phase)
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, c.List(ctx, jobs))
+		assert.Empty(t, jobs.Items)
+	})
+
+	t.Run("encrypted without the operator image", func(t *testing.T) {
+		encrypted := restore.DeepCopy()
+		encrypted.Spec.Encryption = &ecv1alpha1.SnapshotEncryption{}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(encrypted).
+			WithStatusSubresource(&ecv1alpha1.EtcdRestore{}).Build()
+		r := &EtcdRestoreReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.Reconcile(ctx, req)
+		assert.NoError(t, err)
+		got := &ecv1alpha1.EtcdRestore{}
+		assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+		assert.Equal(t, ecv1alpha1.EtcdRestorePhaseFailed, got.Status.Phase)
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, c.List(ctx, jobs))
+		assert.Empty(t, jobs.Items)
+	})
+
+	t.Run("directory the operator doesn't allow", func(t *testing.T) {
+		hostPath := restore.DeepCopy()
+		hostPath.Spec.Source = ecv1alpha1.RestoreSource{
+			HostPath: &ecv1alpha1.HostPathSnapshotSource{NodeName: "node-1", Directory: "/etc", Path: "shadow"},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(hostPath).
+			WithStatusSubresource(&ecv1alpha1.EtcdRestore{}).Build()
+		r := &EtcdRestoreReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10), HostPathDirs: []string{"/var/backups"}}
+
+		_, err := r.Reconcile(ctx, req)
+		assert.NoError(t, err)
+		got := &ecv1alpha1.EtcdRestore{}
+		assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+		assert.Equal(t, ecv1alpha1.EtcdRestorePhaseFailed, got.Status.Phase)
+		assert.Contains(t, got.Status.Message, "isn't allowed by the --backup-host-path-dirs flag")
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, c.List(ctx, jobs))
+		assert.Empty(t, jobs.Items)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(restore.DeepCopy()).
+			WithStatusSubresource(&ecv1alpha1.EtcdRestore{}, &batchv1.Job{}).Build()
+		recorder := record.NewFakeRecorder(10)
+		r := &EtcdRestoreReconciler{Client: c, Scheme: scheme, Recorder: recorder}
+
+		_, err := r.Reconcile(ctx, req)
+		assert.NoError(t, err)
+		got := &ecv1alpha1.EtcdRestore{}
+		assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+		assert.Equal(t, ecv1alpha1.EtcdRestorePhaseRunning, got.Status.Phase)
+		assert.NotNil(t, got.Status.StartTime)
+		pvc := &corev1.PersistentVolumeClaim{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKey{Name: "etcd-data-etcd-0", Namespace: "default"}, pvc))
+		assert.True(t, metav1.IsControlledBy(pvc, got))
+		job := &batchv1.Job{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKey{Name: "restore-restore", Namespace: "default"}, job))
+		assert.True(t, metav1.IsControlledBy(job, got))
+
+		// The EtcdCluster isn't created before the snapshot is restored.
+		_, err = r.Reconcile(ctx, req)
+		assert.NoError(t, err)
+		err = c.Get(ctx, client.ObjectKey{Name: "etcd", Namespace: "default"}, &ecv1alpha1.EtcdCluster{})
+		assert.True(t, k8serrors.IsNotFound(err))
+
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		assert.NoError(t, c.Status().Update(ctx, job))
+		_, err = r.Reconcile(ctx, req)
+		assert.NoError(t, err)
+		ec := &ecv1alpha1.EtcdCluster{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKey{Name: "etcd", Namespace: "default"}, ec))
+		assert.Equal(t, "restore", ec.Labels[ecv1alpha1.RestoreLabel])
+		assert.Empty(t, ec.OwnerReferences)
+		assert.Equal(t, 3, ec.Spec.Size)
+		assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(pvc), pvc))
+		assert.True(t, metav1.IsControlledBy(pvc, ec))
+		assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+		assert.Equal(t, ecv1alpha1.EtcdRestorePhaseCompleted, got.Status.Phase)
+		assert.NotNil(t, got.Status.CompletionTime)
+		assert.Contains(t, <-recorder.Events, "Restored")
+	})
+
+	t.Run("job failed", func(t *testing.T) {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "restore-restore", Namespace: "default"},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"},
+			}},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(restore.DeepCopy(), job).
+			WithStatusSubresource(&ecv1alpha1.EtcdRestore{}).Build()
+		r := &EtcdRestoreReconciler{Client: c, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.Reconcile(ctx, req)
+		assert.NoError(t, err)
+		got := &ecv1alpha1.EtcdRestore{}
+		assert.NoError(t, c.Get(ctx, req.NamespacedName, got))
+		assert.Equal(t, ecv1alpha1.EtcdRestorePhaseFailed, got.Status.Phase)
+		assert.Equal(t, "restore Job restore-restore failed: BackoffLimitExceeded", got.Status.Message)
+		err = c.Get(ctx, client.ObjectKey{Name: "etcd", Namespace: "default"}, &ecv1alpha1.EtcdCluster{})
+		assert.True(t, k8serrors.IsNotFound(err))
+	})
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+
+	"go.etcd.io/etcd/api/v3/authpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// EtcdRoleReconciler manages the roles of the authentication of the
+// EtcdClusters described by EtcdRoles, through the etcd auth API.
+type EtcdRoleReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// EtcdClients caches the connections to the etcd clusters. A new pool is
+	// created when not set.
+	EtcdClients *etcdutils.ClientPool
+	// Shard selects the EtcdClusters reconciled by this instance of the
+	// operator. The EtcdRoles follow the shard of their EtcdCluster.
+	Shard Shard
+}
+
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdroles,verbs=get;list;watch;patch;update
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdroles/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdroles/finalizers,verbs=update
+
+// Reconcile syncs the role of an EtcdRole, and its permissions, to its
+// EtcdCluster, and deletes the role from etcd along with the EtcdRole.
+func (r *EtcdRoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	role := &ecv1alpha1.EtcdRole{}
+	if err := r.Get(ctx, req.NamespacedName, role); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if isPaused(role) {
+		log.FromContext(ctx).Info("Reconciliation is paused")
+		return ctrl.Result{}, nil
+	}
+
+	name := etcdRoleName(role)
+	perms := rolePermissions(role)
+	auth := &authReconcile{
+		Client:             r.Client,
+		Recorder:           r.Recorder,
+		EtcdClients:        r.EtcdClients,
+		Shard:              r.Shard,
+		clusterName:        role.Spec.ClusterName,
+		conditions:         &role.Status.Conditions,
+		observedGeneration: &role.Status.ObservedGeneration,
+	}
+	return auth.reconcile(ctx, role,
+		func(c *etcdutils.ClusterClient, eps []string) (bool, error) {
+			return c.SyncRole(eps, name, perms)
+		},
+		func(c *etcdutils.ClusterClient, eps []string) error {
+			return c.DeleteRole(eps, name)
+		})
+}
+
+// etcdRoleName returns the name of the etcd role of role.
+func etcdRoleName(role *ecv1alpha1.EtcdRole) string {
+	if role.Spec.RoleName != "" {
+		return role.Spec.RoleName
+	}
+	return role.Name
+}
+
+// rolePermissions returns the etcd permissions of role. etcd holds a single
+// permission per range of keys, so the permissions of role on the same keys
+// are merged.
+func rolePermissions(role *ecv1alpha1.EtcdRole) []etcdutils.Permission {
+	var perms []etcdutils.Permission
+	index := map[[2]string]int{}
+	for _, p := range role.Spec.Permissions {
+		perm := etcdutils.Permission{Key: p.Key}
+		if p.Prefix {
+			if p.Key == "" {
+				// Like etcdctl, the empty prefix stands for all the keys.
+				perm.Key, perm.RangeEnd = "\x00", "\x00"
+			} else {
+				perm.RangeEnd = clientv3.GetPrefixRangeEnd(p.Key)
+			}
+		}
+		switch p.Type {
+		case ecv1alpha1.EtcdPermissionRead:
+			perm.Type = authpb.READ
+		case ecv1alpha1.EtcdPermissionWrite:
+			perm.Type = authpb.WRITE
+		default:
+			perm.Type = authpb.READWRITE
+		}
+
+		key := [2]string{perm.Key, perm.RangeEnd}
+		if i, ok := index[key]; ok {
+			if perms[i].Type != perm.Type {
+				perms[i].Type = authpb.READWRITE
+			}
+			continue
+		}
+		index[key] = len(perms)
+		perms = append(perms, perm)
+	}
+	return perms
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdRoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("etcdrole-controller")
+	if r.EtcdClients == nil {
+		r.EtcdClients = etcdutils.NewClientPool()
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ecv1alpha1.EtcdRole{}).
+		WithOptions(controller.Options{NewQueue: newTrackedQueue("etcdroles", nil)}).
+		Complete(r)
+}
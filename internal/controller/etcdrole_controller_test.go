@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/authpb"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func TestRolePermissions(t *testing.T) {
+	role := &ecv1alpha1.EtcdRole{Spec: ecv1alpha1.EtcdRoleSpec{Permissions: []ecv1alpha1.EtcdPermission{
+		{Key: "/app/", Prefix: true, Type: ecv1alpha1.EtcdPermissionRead},
+		{Key: "/config", Type: ecv1alpha1.EtcdPermissionWrite},
+		{Key: "/app/", Prefix: true, Type: ecv1alpha1.EtcdPermissionWrite},
+		{Prefix: true, Type: ecv1alpha1.EtcdPermissionRead},
+	}}}
+	assert.Equal(t, []etcdutils.Permission{
+		{Key: "/app/", RangeEnd: "/app0", Type: authpb.READWRITE},
+		{Key: "/config", Type: authpb.WRITE},
+		{Key: "\x00", RangeEnd: "\x00", Type: authpb.READ},
+	}, rolePermissions(role))
+
+	assert.Equal(t, "", etcdRoleName(&ecv1alpha1.EtcdRole{}))
+	role.Name = "app"
+	assert.Equal(t, "app", etcdRoleName(role))
+	role.Spec.RoleName = "app-rw"
+	assert.Equal(t, "app-rw", etcdRoleName(role))
+}
+
+func TestEtcdRoleReconcile(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+	key := types.NamespacedName{Name: "app", Namespace: "default"}
+	newRole := func() *ecv1alpha1.EtcdRole {
+		return &ecv1alpha1.EtcdRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Generation: 1},
+			Spec:       ecv1alpha1.EtcdRoleSpec{ClusterName: "etcd"},
+		}
+	}
+	newReconciler := func(objs ...client.Object) *EtcdRoleReconciler {
+		return &EtcdRoleReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+				WithStatusSubresource(&ecv1alpha1.EtcdRole{}).Build(),
+			Scheme:      scheme,
+			Recorder:    record.NewFakeRecorder(10),
+			EtcdClients: etcdutils.NewClientPool(),
+		}
+	}
+	synced := func(r *EtcdRoleReconciler) *metav1.Condition {
+		role := &ecv1alpha1.EtcdRole{}
+		assert.NoError(t, r.Get(ctx, key, role))
+		assert.Contains(t, role.Finalizers, ecv1alpha1.EtcdAuthFinalizer)
+		return meta.FindStatusCondition(role.Status.Conditions, ecv1alpha1.EtcdAuthConditionSynced)
+	}
+
+	// Without its EtcdCluster, the role waits for it.
+	r := newReconciler(newRole())
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{RequeueAfter: requeueDuration}, result)
+	condition := synced(r)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, reasonClusterNotFound, condition.Reason)
+
+	// The EtcdCluster has no endpoints yet.
+	ec := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "default"}}
+	r = newReconciler(newRole(), ec)
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	assert.NoError(t, err)
+	assert.Equal(t, reasonClusterNotReady, synced(r).Reason)
+
+	// A paused role is left alone.
+	paused := newRole()
+	paused.Annotations = map[string]string{ecv1alpha1.PausedAnnotation: "true"}
+	r = newReconciler(paused)
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	assert.NoError(t, err)
+	assert.NoError(t, r.Get(ctx, key, paused))
+	assert.Empty(t, paused.Finalizers)
+
+	// Without its EtcdCluster, there is nothing to delete from etcd.
+	deleting := newRole()
+	deleting.Finalizers = []string{ecv1alpha1.EtcdAuthFinalizer}
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	r = newReconciler(deleting)
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	assert.NoError(t, err)
+	assert.True(t, k8serrors.IsNotFound(r.Get(ctx, key, &ecv1alpha1.EtcdRole{})))
+}
@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// EtcdUserReconciler manages the users of the authentication of the
+// EtcdClusters described by EtcdUsers, through the etcd auth API.
+type EtcdUserReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// EtcdClients caches the connections to the etcd clusters. A new pool is
+	// created when not set.
+	EtcdClients *etcdutils.ClientPool
+	// Shard selects the EtcdClusters reconciled by this instance of the
+	// operator. The EtcdUsers follow the shard of their EtcdCluster.
+	Shard Shard
+	// APIReader reads the password Secrets referenced by the EtcdUsers,
+	// which aren't in the cache of the manager. The Client is used when not
+	// set.
+	APIReader client.Reader
+}
+
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdusers,verbs=get;list;watch;patch;update
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdusers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdusers/finalizers,verbs=update
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create
+
+// Reconcile syncs the user of an EtcdUser, its password and its roles, to its
+// EtcdCluster, and deletes the user from etcd along with the EtcdUser.
+func (r *EtcdUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	user := &ecv1alpha1.EtcdUser{}
+	if err := r.Get(ctx, req.NamespacedName, user); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if isPaused(user) {
+		log.FromContext(ctx).Info("Reconciliation is paused")
+		return ctrl.Result{}, nil
+	}
+
+	name := etcdUserName(user)
+	auth := &authReconcile{
+		Client:             r.Client,
+		Recorder:           r.Recorder,
+		EtcdClients:        r.EtcdClients,
+		Shard:              r.Shard,
+		clusterName:        user.Spec.ClusterName,
+		conditions:         &user.Status.Conditions,
+		observedGeneration: &user.Status.ObservedGeneration,
+	}
+	return auth.reconcile(ctx, user,
+		func(c *etcdutils.ClusterClient, eps []string) (bool, error) {
+			secret, password, err := r.password(ctx, user)
+			if err != nil {
+				return false, err
+			}
+			// The password is only set again when the Secret changed since
+			// it was last set.
+			setPassword := user.Status.PasswordSecret != secret.Name ||
+				user.Status.PasswordSecretVersion != secret.ResourceVersion
+			changed, err := c.SyncUser(eps, name, password, setPassword, user.Spec.Roles)
+			if err != nil {
+				return changed, err
+			}
+			user.Status.PasswordSecret = secret.Name
+			user.Status.PasswordSecretVersion = secret.ResourceVersion
+			return changed, nil
+		},
+		func(c *etcdutils.ClusterClient, eps []string) error {
+			return c.DeleteUser(eps, name)
+		})
+}
+
+// etcdUserName returns the name of the etcd user of user.
+func etcdUserName(user *ecv1alpha1.EtcdUser) string {
+	if user.Spec.UserName != "" {
+		return user.Spec.UserName
+	}
+	return user.Name
+}
+
+// etcdUserPasswordSecretName returns the name of the Secret generated for the
+// password of user.
+func etcdUserPasswordSecretName(user *ecv1alpha1.EtcdUser) string {
+	return user.Name + "-password"
+}
+
+// password returns the Secret holding the password of user, and the
+// password. The Secret is generated when user doesn't reference one.
+func (r *EtcdUserReconciler) password(ctx context.Context, user *ecv1alpha1.EtcdUser) (*corev1.Secret, string, error) {
+	ref := user.Spec.PasswordSecretRef
+	if ref != nil {
+		secret := &corev1.Secret{}
+		if err := r.apiReader().Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: user.Namespace}, secret); err != nil {
+			return nil, "", fmt.Errorf("failed to get the password Secret %s: %w", ref.Name, err)
+		}
+		password, ok := secret.Data[ref.Key]
+		if !ok || len(password) == 0 {
+			return nil, "", fmt.Errorf("the password Secret %s has no %s key", ref.Name, ref.Key)
+		}
+		return secret, string(password), nil
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Name: etcdUserPasswordSecretName(user), Namespace: user.Namespace}, secret)
+	switch {
+	case k8serrors.IsNotFound(err):
+		secret, err = newEtcdUserPasswordSecret(user)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := controllerutil.SetControllerReference(user, secret, r.Scheme); err != nil {
+			return nil, "", err
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			return nil, "", fmt.Errorf("failed to create the password Secret %s: %w", secret.Name, err)
+		}
+	case err != nil:
+		return nil, "", err
+	}
+	return secret, string(secret.Data[ecv1alpha1.EtcdUserPasswordKey]), nil
+}
+
+// newEtcdUserPasswordSecret returns the Secret holding a random password for
+// user.
+func newEtcdUserPasswordSecret(user *ecv1alpha1.EtcdUser) (*corev1.Secret, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      etcdUserPasswordSecretName(user),
+			Namespace: user.Namespace,
+			Labels:    withManagedByLabel(nil),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			ecv1alpha1.EtcdUserPasswordKey: []byte(base64.RawURLEncoding.EncodeToString(b)),
+		},
+	}, nil
+}
+
+// apiReader returns the reader of the objects that aren't in the cache of the
+// manager.
+func (r *EtcdUserReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("etcduser-controller")
+	if r.EtcdClients == nil {
+		r.EtcdClients = etcdutils.NewClientPool()
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ecv1alpha1.EtcdUser{}).
+		Owns(&corev1.Secret{}).
+		WithOptions(controller.Options{NewQueue: newTrackedQueue("etcdusers", nil)}).
+		Complete(r)
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestEtcdUserPassword(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	user := &ecv1alpha1.EtcdUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "user-uid"},
+		Spec:       ecv1alpha1.EtcdUserSpec{ClusterName: "etcd"},
+	}
+	own := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"pass": []byte("s3cr3t")},
+	}
+	r := &EtcdUserReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(user, own).Build(),
+		Scheme: scheme,
+	}
+
+	// The password is generated once, in a Secret owned by the EtcdUser.
+	secret, password, err := r.password(ctx, user)
+	assert.NoError(t, err)
+	assert.Equal(t, "app-password", secret.Name)
+	assert.Len(t, password, 32)
+	assert.True(t, metav1.IsControlledBy(secret, user))
+	assert.Equal(t, managedByValue, secret.Labels[managedByLabel])
+	again, samePassword, err := r.password(ctx, user)
+	assert.NoError(t, err)
+	assert.Equal(t, password, samePassword)
+	assert.Equal(t, secret.ResourceVersion, again.ResourceVersion)
+	assert.NoError(t, r.Get(ctx, client.ObjectKeyFromObject(secret), &corev1.Secret{}))
+
+	// A referenced Secret is used as is.
+	user.Spec.PasswordSecretRef = &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "app-credentials"},
+		Key:                  "pass",
+	}
+	secret, password, err = r.password(ctx, user)
+	assert.NoError(t, err)
+	assert.Equal(t, "app-credentials", secret.Name)
+	assert.Equal(t, "s3cr3t", password)
+
+	user.Spec.PasswordSecretRef.Key = "password"
+	_, _, err = r.password(ctx, user)
+	assert.ErrorContains(t, err, "has no password key")
+	user.Spec.PasswordSecretRef.Name = "missing"
+	_, _, err = r.password(ctx, user)
+	assert.Error(t, err)
+
+	assert.Equal(t, "app", etcdUserName(user))
+	user.Spec.UserName = "etcd-operator"
+	assert.Equal(t, "etcd-operator", etcdUserName(user))
+}
@@ -0,0 +1,346 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// externalTLSDir is where the TLS Secret of an ExternalEtcdCluster is mounted
+// in its backup Pods.
+const externalTLSDir = "/etc/etcd/tls"
+
+// ExternalEtcdClusterReconciler looks after the etcd clusters the operator
+// doesn't run, described by ExternalEtcdClusters: it reports their health,
+// defragments their members and schedules their snapshots.
+type ExternalEtcdClusterReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// EtcdClients caches the connections to the etcd clusters. A new pool is
+	// created when not set.
+	EtcdClients *etcdutils.ClientPool
+	// Shard selects the ExternalEtcdClusters reconciled by this instance of
+	// the operator.
+	Shard Shard
+	// APIReader reads the TLS Secrets and the backup CronJobs, which aren't
+	// in the cache of the manager. The Client is used when not set.
+	APIReader client.Reader
+}
+
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=externaletcdclusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=externaletcdclusters/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;create;patch;delete
+
+// Reconcile checks the members of an ExternalEtcdCluster, records their
+// status, and defragments at most one of them per reconcile.
+func (r *ExternalEtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	// The connections are kept apart from those of the EtcdCluster of the
+	// same name.
+	poolKey := "ExternalEtcdCluster/" + req.String()
+
+	eec := &ecv1alpha1.ExternalEtcdCluster{}
+	if err := r.Get(ctx, req.NamespacedName, eec); err != nil {
+		if k8serrors.IsNotFound(err) {
+			r.EtcdClients.Close(poolKey)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !r.Shard.owns(eec) {
+		r.EtcdClients.Close(poolKey)
+		return ctrl.Result{}, nil
+	}
+	if isPaused(eec) {
+		logger.Info("Reconciliation is paused")
+		return ctrl.Result{}, nil
+	}
+
+	// Only the status is written, so the defaults stay in memory.
+	base := eec.DeepCopy()
+	ecv1alpha1.SetExternalEtcdClusterDefaults(eec)
+	result := ctrl.Result{RequeueAfter: eec.Spec.HealthCheckInterval.Duration}
+
+	tlsConfig, err := r.tlsConfig(ctx, eec)
+	if err != nil {
+		r.Recorder.Event(eec, corev1.EventTypeWarning, "TLSUnavailable", err.Error())
+		return ctrl.Result{}, err
+	}
+	etcdClient := r.EtcdClients.Cluster(poolKey, tlsConfig, nil)
+
+	health, err := etcdClient.ClusterHealth(eec.Spec.Endpoints)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	healthErr := setExternalMembersStatus(eec, health)
+
+	if err := r.reconcileBackup(ctx, eec); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Defragmenting blocks the member for a while, so it is only done while
+	// all the members are healthy, one member per reconcile.
+	if healthErr == nil && eec.Spec.Defrag != nil {
+		if ep := nextDefragEndpoint(eec); ep != "" {
+			logger.Info("Defragmenting member", "endpoint", ep)
+			if err := etcdClient.Defragment(ep); err != nil {
+				r.Recorder.Eventf(eec, corev1.EventTypeWarning, "DefragFailed", "Failed to defragment member %s: %v", ep, err)
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Eventf(eec, corev1.EventTypeNormal, "Defragmented", "Defragmented member %s", ep)
+			now := metav1.Now()
+			eec.Status.LastDefragTime = &now
+			// Check the members again before the next one goes.
+			result = ctrl.Result{RequeueAfter: requeueDuration}
+		}
+	}
+
+	if err := r.Status().Patch(ctx, eec, client.MergeFrom(base)); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// tlsConfig returns the TLS configuration reaching the members of eec, or
+// nil when they serve plain HTTP.
+func (r *ExternalEtcdClusterReconciler) tlsConfig(ctx context.Context, eec *ecv1alpha1.ExternalEtcdCluster) (*tls.Config, error) {
+	if eec.Spec.TLSSecretRef == nil {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.apiReader().Get(ctx, client.ObjectKey{Name: eec.Spec.TLSSecretRef.Name, Namespace: eec.Namespace}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get the TLS Secret %s: %w", eec.Spec.TLSSecretRef.Name, err)
+	}
+	return tlsConfigFromSecret(secret)
+}
+
+// tlsConfigFromSecret returns the TLS configuration of the CA and client
+// certificate held by secret, under the keys of the kubernetes.io/tls
+// Secrets.
+func tlsConfigFromSecret(secret *corev1.Secret) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ca := secret.Data[corev1.ServiceAccountRootCAKey]; len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid %s in Secret %s", corev1.ServiceAccountRootCAKey, secret.Name)
+		}
+		cfg.RootCAs = pool
+	}
+	if _, ok := secret.Data[corev1.TLSCertKey]; ok {
+		cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate in Secret %s: %w", secret.Name, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// setExternalMembersStatus records health, the outcome of the health check of
+// the members of eec, in its status. It returns the error of the unhealthy
+// members, if any.
+func setExternalMembersStatus(eec *ecv1alpha1.ExternalEtcdCluster, health []etcdutils.EpHealth) error {
+	members := make([]ecv1alpha1.ExternalEtcdMemberStatus, 0, len(health))
+	var unhealthy []string
+	for _, h := range health {
+		m := ecv1alpha1.ExternalEtcdMemberStatus{Endpoint: h.Ep, Healthy: h.Health, Error: h.Error}
+		if s := h.Status; s != nil {
+			m.ID = strconv.FormatUint(s.Header.MemberId, 16)
+			m.Version = s.Version
+			m.Leader = s.Leader == s.Header.MemberId
+			m.DBSize = s.DbSize
+			m.DBSizeInUse = s.DbSizeInUse
+		}
+		if !h.Health {
+			unhealthy = append(unhealthy, h.Ep)
+		}
+		members = append(members, m)
+	}
+	eec.Status.Members = members
+
+	var healthErr error
+	if len(unhealthy) > 0 {
+		healthErr = errors.New("unhealthy members: " + strings.Join(unhealthy, ", "))
+	}
+	condition := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: eec.Generation,
+		Reason:             reasonMembersHealthy,
+		Message:            "All members are healthy",
+	}
+	if healthErr != nil {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonHealthCheckFailed
+		condition.Message = healthErr.Error()
+	}
+	meta.SetStatusCondition(&eec.Status.Conditions, condition)
+	return healthErr
+}
+
+// nextDefragEndpoint returns the endpoint of the next member of eec to
+// defragment, or "" if none of them is fragmented enough. The leader goes
+// last, so the leadership changes at most once.
+func nextDefragEndpoint(eec *ecv1alpha1.ExternalEtcdCluster) string {
+	defrag := eec.Spec.Defrag
+	var leader string
+	for _, m := range eec.Status.Members {
+		if m.DBSize == 0 || m.DBSize < defrag.MinDBSize.Value() {
+			continue
+		}
+		if (m.DBSize-m.DBSizeInUse)*100 < int64(defrag.FragmentationThreshold)*m.DBSize {
+			continue
+		}
+		if !m.Leader {
+			return m.Endpoint
+		}
+		leader = m.Endpoint
+	}
+	return leader
+}
+
+// backupCronJobName returns the name of the CronJob taking the snapshots of
+// eec.
+func backupCronJobName(eec *ecv1alpha1.ExternalEtcdCluster) string {
+	return eec.Name + "-backup"
+}
+
+// newBackupCronJob returns the CronJob saving the snapshots of eec, which
+// must have a backup, to its PersistentVolumeClaim. The etcd image has no
+// shell, so each snapshot replaces the previous one. etcdctl takes the
+// snapshot from a single member, the first endpoint.
+func newBackupCronJob(eec *ecv1alpha1.ExternalEtcdCluster) *batchv1.CronJob {
+	backup := eec.Spec.Backup
+	container := corev1.Container{
+		Name:    "snapshot",
+		Image:   fmt.Sprintf("gcr.io/etcd-development/etcd:%s", backup.Version),
+		Command: []string{"/usr/local/bin/etcdctl", "snapshot", "save", "/backup/snapshot.db"},
+		Env: []corev1.EnvVar{
+			{Name: "ETCDCTL_API", Value: "3"},
+			{Name: "ETCDCTL_ENDPOINTS", Value: eec.Spec.Endpoints[0]},
+		},
+		VolumeMounts: []corev1.VolumeMount{{Name: "backup", MountPath: "/backup"}},
+	}
+	volumes := []corev1.Volume{{
+		Name: "backup",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: backup.PVCName},
+		},
+	}}
+	if eec.Spec.TLSSecretRef != nil {
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "ETCDCTL_CACERT", Value: externalTLSDir + "/" + corev1.ServiceAccountRootCAKey},
+			corev1.EnvVar{Name: "ETCDCTL_CERT", Value: externalTLSDir + "/" + corev1.TLSCertKey},
+			corev1.EnvVar{Name: "ETCDCTL_KEY", Value: externalTLSDir + "/" + corev1.TLSPrivateKeyKey},
+		)
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "tls", MountPath: externalTLSDir, ReadOnly: true})
+		volumes = append(volumes, corev1.Volume{
+			Name:         "tls",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: eec.Spec.TLSSecretRef.Name}},
+		})
+	}
+
+	return &batchv1.CronJob{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: batchv1.SchemeGroupVersion.String(),
+			Kind:       "CronJob",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupCronJobName(eec),
+			Namespace: eec.Namespace,
+			Labels: withManagedByLabel(map[string]string{
+				"app":       eec.Name,
+				"component": "backup",
+			}),
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:          backup.Schedule,
+			ConcurrencyPolicy: batchv1.ForbidConcurrent,
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyOnFailure,
+							Containers:    []corev1.Container{container},
+							Volumes:       volumes,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// reconcileBackup applies the backup CronJob of eec, or deletes it once the
+// backup is removed from its spec.
+func (r *ExternalEtcdClusterReconciler) reconcileBackup(ctx context.Context, eec *ecv1alpha1.ExternalEtcdCluster) error {
+	if eec.Spec.Backup == nil {
+		cronJob := &batchv1.CronJob{}
+		err := r.apiReader().Get(ctx, client.ObjectKey{Name: backupCronJobName(eec), Namespace: eec.Namespace}, cronJob)
+		if err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if !metav1.IsControlledBy(cronJob, eec) {
+			return nil
+		}
+		return client.IgnoreNotFound(r.Delete(ctx, cronJob))
+	}
+
+	cronJob := newBackupCronJob(eec)
+	if err := controllerutil.SetControllerReference(eec, cronJob, r.Scheme); err != nil {
+		return err
+	}
+	return r.Patch(ctx, cronJob, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
+
+// apiReader returns the reader of the objects that aren't in the cache of the
+// manager.
+func (r *ExternalEtcdClusterReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ExternalEtcdClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("externaletcdcluster-controller")
+	if r.EtcdClients == nil {
+		r.EtcdClients = etcdutils.NewClientPool()
+	}
+	// The status written by the reconciles doesn't trigger new ones: the
+	// members are checked every healthCheckInterval.
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ecv1alpha1.ExternalEtcdCluster{}, builder.WithPredicates(
+			predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return r.Shard.owns(obj)
+			}),
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}),
+		)).
+		WithOptions(controller.Options{NewQueue: newTrackedQueue("externaletcdclusters", nil)}).
+		Complete(r)
+}
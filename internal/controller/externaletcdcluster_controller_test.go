@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func newExternalTestCluster() *ecv1alpha1.ExternalEtcdCluster {
+	eec := &ecv1alpha1.ExternalEtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "control-plane", Namespace: "kube-system", UID: "eec-uid"},
+		Spec: ecv1alpha1.ExternalEtcdClusterSpec{
+			Endpoints: []string{"https://10.0.0.10:2379", "https://10.0.0.11:2379", "https://10.0.0.12:2379"},
+			Defrag:    &ecv1alpha1.ExternalEtcdDefrag{},
+		},
+	}
+	ecv1alpha1.SetExternalEtcdClusterDefaults(eec)
+	return eec
+}
+
+func TestSetExternalMembersStatus(t *testing.T) {
+	eec := newExternalTestCluster()
+	status := func(id, leader uint64) *clientv3.StatusResponse {
+		return &clientv3.StatusResponse{
+			Header:      &etcdserverpb.ResponseHeader{MemberId: id},
+			Version:     "3.5.21",
+			Leader:      leader,
+			DbSize:      200 << 20,
+			DbSizeInUse: 50 << 20,
+		}
+	}
+
+	err := setExternalMembersStatus(eec, []etcdutils.EpHealth{
+		{Ep: "https://10.0.0.10:2379", Health: true, Status: status(0xa, 0xa)},
+		{Ep: "https://10.0.0.11:2379", Health: true, Status: status(0xb, 0xa)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []ecv1alpha1.ExternalEtcdMemberStatus{
+		{Endpoint: "https://10.0.0.10:2379", Healthy: true, ID: "a", Version: "3.5.21", Leader: true, DBSize: 200 << 20, DBSizeInUse: 50 << 20},
+		{Endpoint: "https://10.0.0.11:2379", Healthy: true, ID: "b", Version: "3.5.21", DBSize: 200 << 20, DBSizeInUse: 50 << 20},
+	}, eec.Status.Members)
+	assert.True(t, meta.IsStatusConditionFalse(eec.Status.Conditions, ecv1alpha1.EtcdClusterConditionDegraded))
+
+	err = setExternalMembersStatus(eec, []etcdutils.EpHealth{
+		{Ep: "https://10.0.0.10:2379", Health: true, Status: status(0xa, 0xa)},
+		{Ep: "https://10.0.0.12:2379", Error: "context deadline exceeded"},
+	})
+	assert.EqualError(t, err, "unhealthy members: https://10.0.0.12:2379")
+	assert.Equal(t, ecv1alpha1.ExternalEtcdMemberStatus{Endpoint: "https://10.0.0.12:2379", Error: "context deadline exceeded"}, eec.Status.Members[1])
+	assert.True(t, meta.IsStatusConditionTrue(eec.Status.Conditions, ecv1alpha1.EtcdClusterConditionDegraded))
+}
+
+func TestNextDefragEndpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []ecv1alpha1.ExternalEtcdMemberStatus
+		want    string
+	}{
+		{
+			name: "no fragmented member",
+			members: []ecv1alpha1.ExternalEtcdMemberStatus{
+				{Endpoint: "a", DBSize: 200 << 20, DBSizeInUse: 150 << 20},
+				{Endpoint: "b", DBSize: 200 << 20, DBSizeInUse: 101 << 20},
+			},
+		},
+		{
+			name: "small databases are left alone",
+			members: []ecv1alpha1.ExternalEtcdMemberStatus{
+				{Endpoint: "a", DBSize: 50 << 20, DBSizeInUse: 1 << 20},
+			},
+		},
+		{
+			name: "followers before the leader",
+			members: []ecv1alpha1.ExternalEtcdMemberStatus{
+				{Endpoint: "a", Leader: true, DBSize: 200 << 20, DBSizeInUse: 10 << 20},
+				{Endpoint: "b", DBSize: 200 << 20, DBSizeInUse: 150 << 20},
+				{Endpoint: "c", DBSize: 200 << 20, DBSizeInUse: 100 << 20},
+			},
+			want: "c",
+		},
+		{
+			name: "leader last",
+			members: []ecv1alpha1.ExternalEtcdMemberStatus{
+				{Endpoint: "a", Leader: true, DBSize: 200 << 20, DBSizeInUse: 10 << 20},
+				{Endpoint: "b", DBSize: 200 << 20, DBSizeInUse: 150 << 20},
+			},
+			want: "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eec := newExternalTestCluster()
+			eec.Status.Members = tt.members
+			assert.Equal(t, tt.want, nextDefragEndpoint(eec))
+		})
+	}
+}
+
+func TestTLSConfigFromSecret(t *testing.T) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "etcd-client"}}
+	cfg, err := tlsConfigFromSecret(secret)
+	assert.NoError(t, err)
+	assert.Nil(t, cfg.RootCAs)
+	assert.Empty(t, cfg.Certificates)
+
+	secret.Data = map[string][]byte{corev1.ServiceAccountRootCAKey: []byte("not a certificate")}
+	_, err = tlsConfigFromSecret(secret)
+	assert.ErrorContains(t, err, "invalid ca.crt in Secret etcd-client")
+
+	secret.Data = map[string][]byte{corev1.TLSCertKey: []byte("not a certificate")}
+	_, err = tlsConfigFromSecret(secret)
+	assert.ErrorContains(t, err, "invalid client certificate in Secret etcd-client")
+}
+
+func TestNewBackupCronJob(t *testing.T) {
+	eec := newExternalTestCluster()
+	eec.Spec.Backup = &ecv1alpha1.ExternalEtcdBackup{Schedule: "0 */6 * * *", PVCName: "etcd-snapshots"}
+	ecv1alpha1.SetExternalEtcdClusterDefaults(eec)
+
+	cronJob := newBackupCronJob(eec)
+	assert.Equal(t, "control-plane-backup", cronJob.Name)
+	assert.Equal(t, "0 */6 * * *", cronJob.Spec.Schedule)
+	assert.Equal(t, batchv1.ForbidConcurrent, cronJob.Spec.ConcurrencyPolicy)
+	podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	assert.Equal(t, "gcr.io/etcd-development/etcd:"+ecv1alpha1.DefaultEtcdVersion, podSpec.Containers[0].Image)
+	assert.Contains(t, podSpec.Containers[0].Env, corev1.EnvVar{Name: "ETCDCTL_ENDPOINTS", Value: "https://10.0.0.10:2379"})
+	assert.Len(t, podSpec.Volumes, 1)
+	assert.Equal(t, "etcd-snapshots", podSpec.Volumes[0].PersistentVolumeClaim.ClaimName)
+
+	eec.Spec.TLSSecretRef = &corev1.LocalObjectReference{Name: "etcd-client"}
+	podSpec = newBackupCronJob(eec).Spec.JobTemplate.Spec.Template.Spec
+	assert.Contains(t, podSpec.Containers[0].Env, corev1.EnvVar{Name: "ETCDCTL_CACERT", Value: "/etc/etcd/tls/ca.crt"})
+	assert.Len(t, podSpec.Volumes, 2)
+	assert.Equal(t, "etcd-client", podSpec.Volumes[1].Secret.SecretName)
+}
+
+func TestReconcileBackup(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = batchv1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	eec := newExternalTestCluster()
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(eec).WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	r := &ExternalEtcdClusterReconciler{Client: c, Scheme: scheme}
+	key := client.ObjectKey{Name: backupCronJobName(eec), Namespace: eec.Namespace}
+
+	// Nothing to delete without a backup.
+	assert.NoError(t, r.reconcileBackup(ctx, eec))
+
+	eec.Spec.Backup = &ecv1alpha1.ExternalEtcdBackup{Schedule: "0 */6 * * *", PVCName: "etcd-snapshots"}
+	ecv1alpha1.SetExternalEtcdClusterDefaults(eec)
+	assert.NoError(t, r.reconcileBackup(ctx, eec))
+	cronJob := &batchv1.CronJob{}
+	assert.NoError(t, c.Get(ctx, key, cronJob))
+	assert.True(t, metav1.IsControlledBy(cronJob, eec))
+
+	eec.Spec.Backup = nil
+	assert.NoError(t, r.reconcileBackup(ctx, eec))
+	err := c.Get(ctx, key, cronJob)
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	// A CronJob of the same name the ExternalEtcdCluster doesn't own is kept.
+	assert.NoError(t, c.Create(ctx, &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}))
+	assert.NoError(t, r.reconcileBackup(ctx, eec))
+	assert.NoError(t, c.Get(ctx, key, cronJob))
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+const reasonPromoted = "Promoted"
+
+// sourceAvailable reports whether the source ec of an EtcdMirror is
+// available: it exists, and its Available condition is True.
+func sourceAvailable(ec *ecv1alpha1.EtcdCluster) bool {
+	return ec != nil && meta.IsStatusConditionTrue(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionAvailable)
+}
+
+// reconcileFailover records since when the source of em, source, is
+// unavailable, and promotes the destination of em once it is due: right away
+// with the PromoteAnnotation, or once the source has been unavailable for the
+// failure threshold with an automatic failover. Promoting stops the mirror
+// of em for good. It then points the failover Service of em, if any, at the
+// active cluster. It returns how long until the automatic failover is due,
+// 0 when none is pending.
+func (r *EtcdMirrorReconciler) reconcileFailover(ctx context.Context, em *ecv1alpha1.EtcdMirror, source *ecv1alpha1.EtcdCluster, now time.Time) (time.Duration, error) {
+	f := em.Spec.Failover
+	if f == nil {
+		return 0, nil
+	}
+	destName := em.Spec.Destination.ClusterName
+	destination, err := getAuthCluster(ctx, r.Client, em.Namespace, destName)
+	if err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	if em.Status.PromotedTime == nil {
+		if sourceAvailable(source) {
+			em.Status.SourceUnavailableSince = nil
+		} else if em.Status.SourceUnavailableSince == nil {
+			em.Status.SourceUnavailableSince = &metav1.Time{Time: now}
+		}
+
+		due := em.Annotations[ecv1alpha1.PromoteAnnotation] == "true"
+		if !due && f.Automatic && em.Status.SourceUnavailableSince != nil {
+			wait = em.Status.SourceUnavailableSince.Add(f.FailureThreshold.Duration).Sub(now)
+			due = wait <= 0
+		}
+		if due {
+			if reason, message := waitingForCluster(destination, destName); reason != "" {
+				r.Recorder.Eventf(em, corev1.EventTypeWarning, "PromotionBlocked", "Can't promote the destination: %s", message)
+				return requeueDuration, nil
+			}
+			r.stop(types.NamespacedName{Namespace: em.Namespace, Name: em.Name})
+			em.Status.PromotedTime = &metav1.Time{Time: now}
+			wait = 0
+			log.FromContext(ctx).Info("Promoted the destination", "source", em.Spec.SourceClusterName, "destination", destName)
+			r.Recorder.Eventf(em, corev1.EventTypeWarning, "Promoted", "Promoted EtcdCluster %s in place of EtcdCluster %s", destName, em.Spec.SourceClusterName)
+		}
+	}
+
+	active := source
+	if em.Status.PromotedTime != nil {
+		active = destination
+	}
+	// The Service is left as is while the active cluster doesn't exist.
+	if f.ServiceName != "" && active != nil {
+		if err := r.applyFailoverService(ctx, em, active); err != nil {
+			r.Recorder.Eventf(em, corev1.EventTypeWarning, "ServiceFailed", "Failed to apply the failover Service %s: %v", f.ServiceName, err)
+			return 0, err
+		}
+	}
+	return max(wait, 0), nil
+}
+
+// newFailoverService returns the failover Service of em, selecting the
+// members of the active cluster ec, like its client Service does.
+func newFailoverService(em *ecv1alpha1.EtcdMirror, ec *ecv1alpha1.EtcdCluster) *corev1.Service {
+	port := ecv1alpha1.DefaultClientPort
+	if ec.Spec.Ports != nil && ec.Spec.Ports.Client != 0 {
+		port = ec.Spec.Ports.Client
+	}
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      em.Spec.Failover.ServiceName,
+			Namespace: em.Namespace,
+			Labels:    withManagedByLabel(map[string]string{"app": em.Name, "component": "failover"}),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": ec.Name, "controller": ec.Name},
+			Ports: []corev1.ServicePort{{
+				Name:       "client",
+				Port:       port,
+				TargetPort: intstr.FromInt32(port),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+		},
+	}
+}
+
+// applyFailoverService points the failover Service of em at the members of
+// ec. A Service of the same name em doesn't control is left alone.
+func (r *EtcdMirrorReconciler) applyFailoverService(ctx context.Context, em *ecv1alpha1.EtcdMirror, ec *ecv1alpha1.EtcdCluster) error {
+	svc := newFailoverService(em, ec)
+	existing := &corev1.Service{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(svc), existing)
+	switch {
+	case k8serrors.IsNotFound(err):
+	case err != nil:
+		return err
+	case !metav1.IsControlledBy(existing, em):
+		return fmt.Errorf("the Service %s already exists and isn't controlled by the EtcdMirror", svc.Name)
+	}
+	if err := controllerutil.SetControllerReference(em, svc, r.Scheme); err != nil {
+		return err
+	}
+	return r.Patch(ctx, svc, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestReconcileFailover(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	available := []metav1.Condition{{Type: ecv1alpha1.EtcdClusterConditionAvailable, Status: metav1.ConditionTrue}}
+	source := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "primary", Namespace: "default"},
+		Status:     ecv1alpha1.EtcdClusterStatus{Endpoints: "http://primary-0:2379", Conditions: available},
+	}
+	standby := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "standby", Namespace: "default"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Ports: &ecv1alpha1.EtcdPorts{Client: 12379}},
+		Status:     ecv1alpha1.EtcdClusterStatus{Endpoints: "http://standby-0:12379"},
+	}
+	newMirror := func(failover ecv1alpha1.EtcdMirrorFailover) *ecv1alpha1.EtcdMirror {
+		em := &ecv1alpha1.EtcdMirror{
+			ObjectMeta: metav1.ObjectMeta{Name: "dr", Namespace: "default", UID: "em-uid"},
+			Spec: ecv1alpha1.EtcdMirrorSpec{
+				SourceClusterName: "primary",
+				Destination:       ecv1alpha1.EtcdMirrorDestination{ClusterName: "standby"},
+				Failover:          &failover,
+			},
+		}
+		ecv1alpha1.SetEtcdMirrorDefaults(em)
+		return em
+	}
+	newReconciler := func(objs ...client.Object) (*EtcdMirrorReconciler, *record.FakeRecorder) {
+		recorder := record.NewFakeRecorder(10)
+		return &EtcdMirrorReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+				WithInterceptorFuncs(applyAsCreateOrUpdate).Build(),
+			Scheme:   scheme,
+			Recorder: recorder,
+		}, recorder
+	}
+	selector := func(r *EtcdMirrorReconciler) (map[string]string, int32) {
+		svc := &corev1.Service{}
+		if !assert.NoError(t, r.Get(ctx, client.ObjectKey{Name: "etcd", Namespace: "default"}, svc)) {
+			return nil, 0
+		}
+		return svc.Spec.Selector, svc.Spec.Ports[0].Port
+	}
+
+	t.Run("promotes on the annotation", func(t *testing.T) {
+		r, recorder := newReconciler(source.DeepCopy())
+		em := newMirror(ecv1alpha1.EtcdMirrorFailover{})
+
+		wait, err := r.reconcileFailover(ctx, em, source, now)
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+		assert.Nil(t, em.Status.SourceUnavailableSince)
+
+		// Without an automatic failover, an unavailable source is only
+		// recorded.
+		wait, err = r.reconcileFailover(ctx, em, nil, now)
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+		assert.Equal(t, now, em.Status.SourceUnavailableSince.Time)
+		assert.Nil(t, em.Status.PromotedTime)
+
+		// The destination must be reachable to be promoted.
+		em.Annotations = map[string]string{ecv1alpha1.PromoteAnnotation: "true"}
+		wait, err = r.reconcileFailover(ctx, em, source, now)
+		assert.NoError(t, err)
+		assert.Equal(t, requeueDuration, wait)
+		assert.Nil(t, em.Status.PromotedTime)
+		assert.Equal(t, "Warning PromotionBlocked Can't promote the destination: EtcdCluster standby not found", <-recorder.Events)
+
+		assert.NoError(t, r.Create(ctx, standby.DeepCopy()))
+		_, err = r.reconcileFailover(ctx, em, source, now)
+		assert.NoError(t, err)
+		assert.Equal(t, now, em.Status.PromotedTime.Time)
+		assert.Equal(t, "Warning Promoted Promoted EtcdCluster standby in place of EtcdCluster primary", <-recorder.Events)
+	})
+
+	t.Run("promotes automatically", func(t *testing.T) {
+		r, recorder := newReconciler(source.DeepCopy(), standby.DeepCopy())
+		em := newMirror(ecv1alpha1.EtcdMirrorFailover{Automatic: true, ServiceName: "etcd"})
+
+		_, err := r.reconcileFailover(ctx, em, source, now)
+		assert.NoError(t, err)
+		got, port := selector(r)
+		assert.Equal(t, map[string]string{"app": "primary", "controller": "primary"}, got)
+		assert.Equal(t, ecv1alpha1.DefaultClientPort, port)
+
+		wait, err := r.reconcileFailover(ctx, em, nil, now)
+		assert.NoError(t, err)
+		assert.Equal(t, ecv1alpha1.DefaultFailoverThreshold, wait)
+
+		// The source recovered in time.
+		_, err = r.reconcileFailover(ctx, em, source, now.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Nil(t, em.Status.SourceUnavailableSince)
+
+		unavailable := source.DeepCopy()
+		unavailable.Status.Conditions[0].Status = metav1.ConditionFalse
+		_, err = r.reconcileFailover(ctx, em, unavailable, now.Add(2*time.Minute))
+		assert.NoError(t, err)
+		wait, err = r.reconcileFailover(ctx, em, unavailable, now.Add(4*time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 3*time.Minute, wait)
+		assert.Nil(t, em.Status.PromotedTime)
+
+		wait, err = r.reconcileFailover(ctx, em, unavailable, now.Add(7*time.Minute))
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+		assert.Equal(t, now.Add(7*time.Minute), em.Status.PromotedTime.Time)
+		assert.Equal(t, "Warning Promoted Promoted EtcdCluster standby in place of EtcdCluster primary", <-recorder.Events)
+		got, port = selector(r)
+		assert.Equal(t, map[string]string{"app": "standby", "controller": "standby"}, got)
+		assert.Equal(t, int32(12379), port)
+
+		// The promotion sticks once the source is back.
+		_, err = r.reconcileFailover(ctx, em, source, now.Add(8*time.Minute))
+		assert.NoError(t, err)
+		got, _ = selector(r)
+		assert.Equal(t, "standby", got["app"])
+	})
+
+	t.Run("leaves foreign Services alone", func(t *testing.T) {
+		foreign := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "default"}}
+		r, recorder := newReconciler(source.DeepCopy(), foreign)
+		em := newMirror(ecv1alpha1.EtcdMirrorFailover{ServiceName: "etcd"})
+
+		_, err := r.reconcileFailover(ctx, em, source, now)
+		assert.ErrorContains(t, err, "Service etcd already exists and isn't controlled by the EtcdMirror")
+		assert.Contains(t, <-recorder.Events, "Warning ServiceFailed")
+	})
+}
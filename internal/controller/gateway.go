@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// gatewayName returns the name of the Deployment and of the Service of the
+// gateway of ec.
+func gatewayName(ec *ecv1alpha1.EtcdCluster) string {
+	return ec.Name + "-gateway"
+}
+
+// gatewayTier returns the proxy tier of the gateway of ec, nil when ec has no
+// gateway. The gateway forwards the TCP connections of the clients to the
+// members as they are, so it needs no certificate: the clients talk TLS to
+// the members through it.
+func gatewayTier(ec *ecv1alpha1.EtcdCluster) *proxyTier {
+	gateway := ec.Spec.Gateway
+	if gateway == nil {
+		return nil
+	}
+	return &proxyTier{
+		name:      gatewayName(ec),
+		component: "gateway",
+		args:      gatewayArgs(ec),
+		port:      gateway.Port,
+		replicas:  gateway.Replicas,
+		resources: gateway.Resources,
+	}
+}
+
+// gatewayArgs returns the arguments of etcd running the gateway of ec.
+func gatewayArgs(ec *ecv1alpha1.EtcdCluster) []string {
+	// The gateway takes the addresses of the members, without a scheme.
+	endpoints := clientEndpointsFromEtcdCluster(ec)
+	for i := range endpoints {
+		endpoints[i] = strings.TrimPrefix(endpoints[i], urlScheme(ec)+"://")
+	}
+	return []string{
+		"gateway", "start",
+		"--endpoints=" + strings.Join(endpoints, ","),
+		fmt.Sprintf("--listen-addr=0.0.0.0:%d", ec.Spec.Gateway.Port),
+	}
+}
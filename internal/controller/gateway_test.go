@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestNewGatewayDeployment(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:    2,
+			Version: "v3.5.21",
+			Gateway: &ecv1alpha1.Gateway{Replicas: ptr.To[int32](2), Port: 23790},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	deploy := newProxyDeployment(ec, gatewayTier(ec))
+	assert.Equal(t, "test-etcd-gateway", deploy.Name)
+	assert.Equal(t, int32(2), *deploy.Spec.Replicas)
+	container := deploy.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, []string{
+		"gateway", "start",
+		"--endpoints=test-etcd-0.test-etcd.default.svc.cluster.local:2379,test-etcd-1.test-etcd.default.svc.cluster.local:2379",
+		"--listen-addr=0.0.0.0:23790",
+	}, container.Args)
+	assert.NotEqual(t, ec.Name, deploy.Spec.Template.Labels["controller"])
+
+	svc := newProxyService(ec, gatewayTier(ec))
+	assert.Equal(t, deploy.Spec.Template.Labels, svc.Spec.Selector)
+	assert.Equal(t, int32(23790), svc.Spec.Ports[0].Port)
+
+	// The gateway passes TLS through, to the members.
+	ec = newAutoTLSTestCluster()
+	ec.Spec.Gateway = &ecv1alpha1.Gateway{}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	deploy = newProxyDeployment(ec, gatewayTier(ec))
+	assert.Equal(t, "--endpoints=etcd-0.etcd.default.svc.cluster.local:2379,etcd-1.etcd.default.svc.cluster.local:2379,etcd-2.etcd.default.svc.cluster.local:2379",
+		deploy.Spec.Template.Spec.Containers[0].Args[2])
+	assert.Empty(t, deploy.Spec.Template.Spec.Volumes)
+}
+
+func TestReconcileGateway(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default", UID: "ec-uid"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:      3,
+			GRPCProxy: &ecv1alpha1.GRPCProxy{},
+			Gateway:   &ecv1alpha1.Gateway{},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).
+		WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	recorder := record.NewFakeRecorder(10)
+
+	assert.NoError(t, reconcileProxyTier(ctx, fakeClient, scheme, recorder, ec, grpcProxyName(ec), grpcProxyTier(ec)))
+	assert.NoError(t, reconcileProxyTier(ctx, fakeClient, scheme, recorder, ec, gatewayName(ec), gatewayTier(ec)))
+	key := types.NamespacedName{Name: "test-etcd-gateway", Namespace: "default"}
+	deploy := &appsv1.Deployment{}
+	assert.NoError(t, fakeClient.Get(ctx, key, deploy))
+	assert.True(t, metav1.IsControlledBy(deploy, ec))
+	assert.Equal(t, int32(1), *deploy.Spec.Replicas)
+	svc := &corev1.Service{}
+	assert.NoError(t, fakeClient.Get(ctx, key, svc))
+
+	// Removing the gateway leaves the gRPC proxy alone.
+	ec.Spec.Gateway = nil
+	assert.NoError(t, reconcileProxyTier(ctx, fakeClient, scheme, recorder, ec, gatewayName(ec), gatewayTier(ec)))
+	assert.True(t, k8serrors.IsNotFound(fakeClient.Get(ctx, key, deploy)))
+	assert.True(t, k8serrors.IsNotFound(fakeClient.Get(ctx, key, svc)))
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "test-etcd-grpc-proxy", Namespace: "default"}, deploy))
+}
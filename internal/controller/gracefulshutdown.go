@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// gracefulShutdownContainerName is the init container of the members
+	// installing the preStop hook of the etcd container, see
+	// podTemplate.gracefulShutdown.
+	gracefulShutdownContainerName = "install-pre-stop"
+	// gracefulShutdownDir is where the etcd container finds the manager
+	// binary running its preStop hook, as the etcd image can't run it.
+	gracefulShutdownDir = "/operator"
+	// defaultGracefulShutdownTimeout is how long a stopping member waits
+	// for the other members by default.
+	defaultGracefulShutdownTimeout = 30 * time.Second
+	// defaultTerminationGracePeriod is the termination grace period of the
+	// pods, which the Kubernetes API defaults to.
+	defaultTerminationGracePeriod = 30 * time.Second
+)
+
+// gracefulShutdownImage returns the image installing the preStop hook of the
+// members of ec, or an empty string when they have none.
+func gracefulShutdownImage(ec *ecv1alpha1.EtcdCluster) string {
+	if ec.Spec.PodTemplate == nil || ec.Spec.PodTemplate.GracefulShutdown == nil {
+		return ""
+	}
+	gs := ec.Spec.PodTemplate.GracefulShutdown
+	if !ptr.Deref(gs.Enabled, true) {
+		return ""
+	}
+	return gs.Image
+}
+
+// setGracefulShutdownImage fills in memory the image installing the preStop
+// hook of the members of ec with operatorImage, the image of the operator,
+// when podTemplate.gracefulShutdown doesn't set one.
+func setGracefulShutdownImage(ec *ecv1alpha1.EtcdCluster, operatorImage string) {
+	if operatorImage == "" {
+		return
+	}
+	if ec.Spec.PodTemplate == nil {
+		ec.Spec.PodTemplate = &ecv1alpha1.PodTemplate{}
+	}
+	if ec.Spec.PodTemplate.GracefulShutdown == nil {
+		ec.Spec.PodTemplate.GracefulShutdown = &ecv1alpha1.GracefulShutdown{}
+	}
+	if gs := ec.Spec.PodTemplate.GracefulShutdown; ptr.Deref(gs.Enabled, true) && gs.Image == "" {
+		gs.Image = operatorImage
+	}
+}
+
+// gracefulShutdownTimeout returns how long a stopping member of ec waits for
+// the other members to be a healthy quorum.
+func gracefulShutdownTimeout(ec *ecv1alpha1.EtcdCluster) time.Duration {
+	if gs := ec.Spec.PodTemplate.GracefulShutdown; gs != nil && gs.Timeout != nil {
+		return gs.Timeout.Duration
+	}
+	return defaultGracefulShutdownTimeout
+}
+
+// addGracefulShutdown adds the preStop hook to the etcd container of podSpec,
+// of a member of ec, when it has one: an init container copies the manager
+// binary of image to a volume shared with the etcd container, whose preStop
+// hook runs its pre-stop command against the member, with the client
+// certificate and the root credentials of the operator. The termination
+// grace period of the pod covers the timeout of the hook.
+func addGracefulShutdown(ec *ecv1alpha1.EtcdCluster, podSpec *corev1.PodSpec, etcd *corev1.Container) {
+	image := gracefulShutdownImage(ec)
+	if image == "" {
+		return
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         "operator",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	podSpec.InitContainers = append(podSpec.InitContainers, corev1.Container{
+		Name:         gracefulShutdownContainerName,
+		Image:        image,
+		Command:      []string{"/manager", "install", "-to", gracefulShutdownDir + "/manager"},
+		VolumeMounts: []corev1.VolumeMount{{Name: "operator", MountPath: gracefulShutdownDir}},
+	})
+
+	timeout := gracefulShutdownTimeout(ec)
+	etcd.VolumeMounts = append(etcd.VolumeMounts, corev1.VolumeMount{Name: "operator", MountPath: gracefulShutdownDir, ReadOnly: true})
+	etcd.Lifecycle = &corev1.Lifecycle{
+		PreStop: &corev1.LifecycleHandler{
+			Exec: &corev1.ExecAction{Command: []string{
+				gracefulShutdownDir + "/manager", "pre-stop",
+				"-endpoint", fmt.Sprintf("%s://127.0.0.1:%d", urlScheme(ec), ec.Spec.Ports.Client),
+				"-timeout", timeout.String(),
+			}},
+		},
+	}
+	addClientTLS(ec, podSpec, etcd)
+	addRootCredentials(ec, etcd)
+	podSpec.TerminationGracePeriodSeconds = ptr.To(int64((timeout + defaultTerminationGracePeriod).Seconds()))
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestSetGracefulShutdownImage(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	setGracefulShutdownImage(ec, "")
+	assert.Empty(t, gracefulShutdownImage(ec))
+
+	setGracefulShutdownImage(ec, "etcd-operator:v0.1.0")
+	assert.Equal(t, "etcd-operator:v0.1.0", gracefulShutdownImage(ec))
+
+	ec.Spec.PodTemplate.GracefulShutdown = &ecv1alpha1.GracefulShutdown{Image: "my-registry/etcd-operator:v0.1.0"}
+	setGracefulShutdownImage(ec, "etcd-operator:v0.1.0")
+	assert.Equal(t, "my-registry/etcd-operator:v0.1.0", gracefulShutdownImage(ec))
+
+	ec.Spec.PodTemplate.GracefulShutdown = &ecv1alpha1.GracefulShutdown{Enabled: ptr.To(false)}
+	setGracefulShutdownImage(ec, "etcd-operator:v0.1.0")
+	assert.Empty(t, gracefulShutdownImage(ec))
+}
+
+func TestGracefulShutdownHook(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	spec, err := newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, spec.Template.Spec.Containers[0].Lifecycle)
+	assert.Nil(t, spec.Template.Spec.TerminationGracePeriodSeconds)
+
+	ec.Spec.PodTemplate.GracefulShutdown = &ecv1alpha1.GracefulShutdown{Image: "etcd-operator:v0.1.0"}
+	spec, err = newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	install := findContainer(spec.Template.Spec.InitContainers, gracefulShutdownContainerName)
+	if assert.NotNil(t, install) {
+		assert.Equal(t, "etcd-operator:v0.1.0", install.Image)
+		assert.Equal(t, []string{"/manager", "install", "-to", "/operator/manager"}, install.Command)
+		assert.Equal(t, []corev1.VolumeMount{{Name: "operator", MountPath: "/operator"}}, install.VolumeMounts)
+	}
+	assert.Contains(t, spec.Template.Spec.Volumes, corev1.Volume{
+		Name:         "operator",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	etcd := spec.Template.Spec.Containers[0]
+	assert.Contains(t, etcd.VolumeMounts, corev1.VolumeMount{Name: "operator", MountPath: "/operator", ReadOnly: true})
+	if assert.NotNil(t, etcd.Lifecycle) && assert.NotNil(t, etcd.Lifecycle.PreStop) {
+		assert.Equal(t, &corev1.ExecAction{Command: []string{
+			"/operator/manager", "pre-stop", "-endpoint", "http://127.0.0.1:2379", "-timeout", "30s",
+		}}, etcd.Lifecycle.PreStop.Exec)
+	}
+	assert.Equal(t, ptr.To[int64](60), spec.Template.Spec.TerminationGracePeriodSeconds)
+
+	// With TLS and authentication, the hook reaches the member like the
+	// operator does.
+	ec = newTLSTestCluster()
+	ec.Spec.Auth = &ecv1alpha1.Authentication{Enabled: true}
+	ec.Spec.PodTemplate.GracefulShutdown = &ecv1alpha1.GracefulShutdown{
+		Image:   "etcd-operator:v0.1.0",
+		Timeout: &metav1.Duration{Duration: time.Minute},
+	}
+	spec, err = newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	etcd = spec.Template.Spec.Containers[0]
+	assert.Equal(t, []string{
+		"/operator/manager", "pre-stop", "-endpoint", "https://127.0.0.1:2379", "-timeout", "1m0s",
+	}, etcd.Lifecycle.PreStop.Exec.Command)
+	assert.Contains(t, etcd.VolumeMounts, corev1.VolumeMount{Name: "client-tls", MountPath: "/etc/etcd/tls/client", ReadOnly: true})
+	var names []string
+	for _, env := range etcd.Env {
+		names = append(names, env.Name)
+	}
+	assert.Subset(t, names, []string{"ETCDCTL_CACERT", "ETCDCTL_CERT", "ETCDCTL_KEY", "ETCDCTL_USER", "ETCDCTL_PASSWORD"})
+	assert.Equal(t, ptr.To[int64](90), spec.Template.Spec.TerminationGracePeriodSeconds)
+
+	ec.Spec.PodTemplate.GracefulShutdown.Enabled = ptr.To(false)
+	spec, err = newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, findContainer(spec.Template.Spec.InitContainers, gracefulShutdownContainerName))
+	assert.Nil(t, spec.Template.Spec.Containers[0].Lifecycle)
+}
+
+func TestGracefulShutdownRestartReasons(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	// The API server defaults the termination grace period.
+	sts.Spec.Template.Spec.TerminationGracePeriodSeconds = ptr.To[int64](30)
+	reasons, err := restartReasons(ec, sts)
+	assert.NoError(t, err)
+	assert.Empty(t, reasons)
+
+	ec.Spec.PodTemplate.GracefulShutdown = &ecv1alpha1.GracefulShutdown{Image: "etcd-operator:v0.1.0"}
+	reasons, err = restartReasons(ec, sts)
+	assert.NoError(t, err)
+	assert.Contains(t, reasons, "graceful shutdown changed")
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// grpcProxyName returns the name of the Deployment and of the Service of the
+// gRPC proxy of ec.
+func grpcProxyName(ec *ecv1alpha1.EtcdCluster) string {
+	return ec.Name + "-grpc-proxy"
+}
+
+// grpcProxyTier returns the proxy tier of the gRPC proxy of ec, nil when ec
+// has no grpcProxy.
+func grpcProxyTier(ec *ecv1alpha1.EtcdCluster) *proxyTier {
+	proxy := ec.Spec.GRPCProxy
+	if proxy == nil {
+		return nil
+	}
+	t := &proxyTier{
+		name:      grpcProxyName(ec),
+		component: "grpc-proxy",
+		args:      grpcProxyArgs(ec),
+		port:      proxy.Port,
+		replicas:  proxy.Replicas,
+		resources: proxy.Resources,
+	}
+	if ec.Spec.TLS.Enabled() {
+		t.certificates = []string{clientCertificate, serverCertificate}
+	}
+	return t
+}
+
+// grpcProxyArgs returns the arguments of etcd running the gRPC proxy of ec.
+// It reaches the members with the client certificate of the operator, and
+// serves the clients with its own server certificate, requiring theirs.
+func grpcProxyArgs(ec *ecv1alpha1.EtcdCluster) []string {
+	args := []string{
+		"grpc-proxy", "start",
+		"--endpoints=" + strings.Join(clientEndpointsFromEtcdCluster(ec), ","),
+		fmt.Sprintf("--listen-addr=0.0.0.0:%d", ec.Spec.GRPCProxy.Port),
+		fmt.Sprintf("--advertise-client-url=%s.%s.svc:%d", grpcProxyName(ec), ec.Namespace, ec.Spec.GRPCProxy.Port),
+	}
+	if !ec.Spec.TLS.Enabled() {
+		return args
+	}
+	clientDir, serverDir := path.Join(tlsDir, clientCertificate), path.Join(tlsDir, serverCertificate)
+	certKey, keyKey := corev1.TLSCertKey, corev1.TLSPrivateKeyKey
+	if ec.Spec.TLS.Provider == ecv1alpha1.TLSProviderAuto {
+		// The proxy has its own certificate in the Secret of the members.
+		certKey, keyKey = memberCertKey(grpcProxyName(ec)), memberKeyKey(grpcProxyName(ec))
+	}
+	return append(args,
+		"--cacert="+path.Join(clientDir, corev1.ServiceAccountRootCAKey),
+		"--cert="+path.Join(clientDir, corev1.TLSCertKey),
+		"--key="+path.Join(clientDir, corev1.TLSPrivateKeyKey),
+		"--cert-file="+path.Join(serverDir, certKey),
+		"--key-file="+path.Join(serverDir, keyKey),
+		"--trusted-ca-file="+path.Join(serverDir, corev1.ServiceAccountRootCAKey),
+	)
+}
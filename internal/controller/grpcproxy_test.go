@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/pki"
+)
+
+func TestNewGRPCProxyDeployment(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:    2,
+			Version: "v3.5.21",
+			GRPCProxy: &ecv1alpha1.GRPCProxy{
+				Replicas: ptr.To[int32](3),
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+				},
+			},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	deploy := newProxyDeployment(ec, grpcProxyTier(ec))
+	assert.Equal(t, "test-etcd-grpc-proxy", deploy.Name)
+	assert.Equal(t, int32(3), *deploy.Spec.Replicas)
+	container := deploy.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, "gcr.io/etcd-development/etcd:v3.5.21", container.Image)
+	assert.Equal(t, []string{
+		"grpc-proxy", "start",
+		"--endpoints=http://test-etcd-0.test-etcd.default.svc.cluster.local:2379,http://test-etcd-1.test-etcd.default.svc.cluster.local:2379",
+		"--listen-addr=0.0.0.0:2379",
+		"--advertise-client-url=test-etcd-grpc-proxy.default.svc:2379",
+	}, container.Args)
+	assert.Equal(t, resource.MustParse("100m"), container.Resources.Requests[corev1.ResourceCPU])
+	assert.Empty(t, deploy.Spec.Template.Spec.Volumes)
+	// The headless Service of the members doesn't select the proxy.
+	assert.NotEqual(t, ec.Name, deploy.Spec.Template.Labels["controller"])
+
+	svc := newProxyService(ec, grpcProxyTier(ec))
+	assert.Equal(t, deploy.Spec.Template.Labels, svc.Spec.Selector)
+	assert.Equal(t, int32(2379), svc.Spec.Ports[0].Port)
+}
+
+func TestGRPCProxyTLS(t *testing.T) {
+	ec := newAutoTLSTestCluster()
+	ec.Spec.GRPCProxy = &ecv1alpha1.GRPCProxy{Port: 23790}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	deploy := newProxyDeployment(ec, grpcProxyTier(ec))
+	args := deploy.Spec.Template.Spec.Containers[0].Args
+	assert.Contains(t, args, "--listen-addr=0.0.0.0:23790")
+	assert.Contains(t, args, "--cert=/etc/etcd/tls/client/tls.crt")
+	assert.Contains(t, args, "--cert-file=/etc/etcd/tls/server/etcd-grpc-proxy.crt")
+	assert.Contains(t, args, "--trusted-ca-file=/etc/etcd/tls/server/ca.crt")
+	assert.Len(t, deploy.Spec.Template.Spec.Volumes, 2)
+
+	// The proxy gets a server certificate of its own.
+	ca, err := pki.NewCA("etcd-ca", time.Hour, time.Now())
+	assert.NoError(t, err)
+	data, _, err := issueMemberCertificates(ec, ca, serverCertificate, nil, time.Now())
+	assert.NoError(t, err)
+	assert.Contains(t, data, memberCertKey("etcd-grpc-proxy"))
+	assert.Contains(t, memberCertificateRequest(ec, serverCertificate, "etcd-grpc-proxy").DNSNames, "etcd-grpc-proxy.default.svc")
+	data, _, err = issueMemberCertificates(ec, ca, peerCertificate, nil, time.Now())
+	assert.NoError(t, err)
+	assert.NotContains(t, data, memberCertKey("etcd-grpc-proxy"))
+
+	ec = newTLSTestCluster()
+	ec.Spec.GRPCProxy = &ecv1alpha1.GRPCProxy{}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	assert.Contains(t, grpcProxyArgs(ec), "--cert-file=/etc/etcd/tls/server/tls.crt")
+	dnsNames, _, _ := unstructured.NestedStringSlice(newCertificate(ec, serverCertificate).Object, "spec", "dnsNames")
+	assert.Contains(t, dnsNames, "etcd-grpc-proxy.default.svc")
+}
+
+func TestReconcileGRPCProxy(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default", UID: "ec-uid"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:      3,
+			GRPCProxy: &ecv1alpha1.GRPCProxy{},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).
+		WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	recorder := record.NewFakeRecorder(10)
+
+	assert.NoError(t, reconcileProxyTier(ctx, fakeClient, scheme, recorder, ec, grpcProxyName(ec), grpcProxyTier(ec)))
+	key := types.NamespacedName{Name: "test-etcd-grpc-proxy", Namespace: "default"}
+	deploy := &appsv1.Deployment{}
+	assert.NoError(t, fakeClient.Get(ctx, key, deploy))
+	assert.True(t, metav1.IsControlledBy(deploy, ec))
+	assert.Equal(t, int32(1), *deploy.Spec.Replicas)
+	svc := &corev1.Service{}
+	assert.NoError(t, fakeClient.Get(ctx, key, svc))
+
+	ec.Spec.GRPCProxy = nil
+	assert.NoError(t, reconcileProxyTier(ctx, fakeClient, scheme, recorder, ec, grpcProxyName(ec), grpcProxyTier(ec)))
+	assert.True(t, k8serrors.IsNotFound(fakeClient.Get(ctx, key, deploy)))
+	assert.True(t, k8serrors.IsNotFound(fakeClient.Get(ctx, key, svc)))
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/cron"
+)
+
+const (
+	// localSnapshotDir is where the volume of a member is mounted in its
+	// local snapshot Jobs, at the directory of its snapshots.
+	localSnapshotDir = "/snapshots"
+
+	// localSnapshotJobTTL is how long the finished local snapshot Jobs are
+	// kept around.
+	localSnapshotJobTTL = 24 * time.Hour
+
+	localSnapshotPruneScript = `set -e
+cd /snapshots
+ls -1r snapshot-*.db | tail -n +$((KEEP + 1)) | while read -r f; do rm -f "$f"; done
+`
+)
+
+// localSnapshotsSchedule returns the parsed local snapshots schedule of ec,
+// or nil when its members aren't snapshotted onto their volume.
+func localSnapshotsSchedule(ec *ecv1alpha1.EtcdCluster) (*cron.Schedule, error) {
+	m := ec.Spec.Maintenance
+	if m == nil || m.LocalSnapshots == nil || ec.Spec.StorageSpec == nil {
+		return nil, nil
+	}
+	return cron.Parse(m.LocalSnapshots.Schedule)
+}
+
+// localSnapshotSubPath returns the directory of the volume of the member
+// name holding its local snapshots. It is next to its data directory, so
+// the snapshots outlive the wipes of its data.
+func localSnapshotSubPath(name string) string {
+	return name + "-snapshots"
+}
+
+// reconcileLocalSnapshots creates the Jobs snapshotting the members of sts
+// onto their volume, once the local snapshots schedule of ec is due, and
+// records the scheduled time in the status of ec. The members are expected
+// to be all healthy. c is the client of the members.
+func reconcileLocalSnapshots(ctx context.Context, logger logr.Logger, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder,
+	ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, now time.Time) error {
+	schedule, err := localSnapshotsSchedule(ec)
+	if schedule == nil || err != nil {
+		return err
+	}
+	since := ec.CreationTimestamp.Time
+	if last := ec.Status.LastLocalSnapshotTime; last != nil {
+		since = last.Time
+	}
+	due := lastScheduledTime(schedule, since, now)
+	if due.IsZero() {
+		return nil
+	}
+
+	for i := range int(ptr.Deref(sts.Spec.Replicas, 0)) {
+		job := newLocalSnapshotJob(ec, sts, i, due)
+		if err := setWorkloadOwner(ec, scheme, job); err != nil {
+			return err
+		}
+		if err := c.Create(ctx, job); client.IgnoreAlreadyExists(err) != nil {
+			recorder.Eventf(ec, corev1.EventTypeWarning, "LocalSnapshotFailed", "Failed to create the local snapshot Job %s: %v", job.Name, err)
+			return err
+		}
+	}
+	logger.Info("Snapshotting the members onto their volume", "scheduledTime", due)
+	recorder.Eventf(ec, corev1.EventTypeNormal, "LocalSnapshot",
+		"Snapshotting the members onto their volume, scheduled at %s", due.Format(time.RFC3339))
+	ec.Status.LastLocalSnapshotTime = &metav1.Time{Time: due}
+	return nil
+}
+
+// newLocalSnapshotJob returns the Job snapshotting the member of sts of the
+// given ordinal onto its volume, for the local snapshots scheduled at due.
+// etcdctl saves the snapshot of the member to the directory of its
+// snapshots, then busybox deletes the oldest ones beyond those to keep. The
+// Job runs on the node of the member, which may be the only one its volume
+// can be attached to.
+func newLocalSnapshotJob(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, index int, due time.Time) *batchv1.Job {
+	member := fmt.Sprintf("%s-%d", ec.Name, index)
+	claimName := fmt.Sprintf("%s-%s", volumeName, member)
+	if ec.Spec.StorageSpec.AccessModes == corev1.ReadWriteMany {
+		claimName = ec.Spec.StorageSpec.PVCName
+	}
+	keep := ec.Spec.Maintenance.LocalSnapshots.Keep
+	if keep == 0 {
+		keep = 3
+	}
+
+	mount := corev1.VolumeMount{Name: "data", MountPath: localSnapshotDir, SubPath: localSnapshotSubPath(member)}
+	labels := withManagedByLabel(map[string]string{
+		"app":       ec.Name,
+		"component": "local-snapshot",
+	})
+	snapshot := corev1.Container{
+		Name:  "snapshot",
+		Image: fmt.Sprintf("gcr.io/etcd-development/etcd:%s", ec.Spec.Version),
+		Command: []string{"/usr/local/bin/etcdctl", "snapshot", "save",
+			fmt.Sprintf("%s/snapshot-%s.db", localSnapshotDir, due.UTC().Format("20060102T150405Z"))},
+		Env: []corev1.EnvVar{
+			{Name: "ETCDCTL_API", Value: "3"},
+			{Name: "ETCDCTL_ENDPOINTS", Value: clientEndpointForOrdinalIndex(sts, index)},
+		},
+		VolumeMounts: []corev1.VolumeMount{mount},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-snapshot-%d", member, due.Unix()),
+			Namespace: ec.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            ptr.To[int32](2),
+			TTLSecondsAfterFinished: ptr.To(int32(localSnapshotJobTTL.Seconds())),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:  corev1.RestartPolicyNever,
+					InitContainers: []corev1.Container{snapshot},
+					Containers: []corev1.Container{{
+						Name:         "prune",
+						Image:        busyboxImage,
+						Command:      []string{"/bin/sh", "-c", localSnapshotPruneScript},
+						Env:          []corev1.EnvVar{{Name: "KEEP", Value: strconv.Itoa(int(keep))}},
+						VolumeMounts: []corev1.VolumeMount{mount},
+					}},
+					Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+					}}},
+					Affinity: &corev1.Affinity{PodAffinity: &corev1.PodAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+							LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{
+								appsv1.StatefulSetPodNameLabel: member,
+							}},
+							TopologyKey: corev1.LabelHostname,
+						}},
+					}},
+				},
+			},
+		},
+	}
+	podSpec := &job.Spec.Template.Spec
+	addClientTLS(ec, podSpec, &podSpec.InitContainers[0])
+	addRootCredentials(ec, &podSpec.InitContainers[0])
+	return job
+}
+
+// withNextLocalSnapshot returns result requeued at the latest for the next
+// time of the local snapshots schedule of ec after now, if any.
+func withNextLocalSnapshot(result ctrl.Result, ec *ecv1alpha1.EtcdCluster, now time.Time) ctrl.Result {
+	schedule, err := localSnapshotsSchedule(ec)
+	if schedule == nil || err != nil {
+		return result
+	}
+	if next := schedule.Next(now); !next.IsZero() {
+		if wait := next.Sub(now); result.RequeueAfter == 0 || wait < result.RequeueAfter {
+			result.RequeueAfter = wait
+		}
+	}
+	return result
+}
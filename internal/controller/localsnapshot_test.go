@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func newLocalSnapshotTestCluster(created time.Time) *ecv1alpha1.EtcdCluster {
+	ec := newQuorumTestCluster()
+	ec.CreationTimestamp = metav1.NewTime(created)
+	ec.Spec.Maintenance = &ecv1alpha1.Maintenance{LocalSnapshots: &ecv1alpha1.LocalSnapshots{Schedule: "0 * * * *", Keep: 5}}
+	return ec
+}
+
+func TestNewLocalSnapshotJob(t *testing.T) {
+	ec := newLocalSnapshotTestCluster(time.Now())
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	due := time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)
+
+	job := newLocalSnapshotJob(ec, sts, 1, due)
+	assert.Equal(t, "test-etcd-1-snapshot-1735700400", job.Name)
+	spec := job.Spec.Template.Spec
+	assert.Equal(t, "etcd-data-test-etcd-1", spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	snapshot := spec.InitContainers[0]
+	assert.Equal(t, []string{"/usr/local/bin/etcdctl", "snapshot", "save", "/snapshots/snapshot-20250101T030000Z.db"}, snapshot.Command)
+	assert.Contains(t, snapshot.Env, corev1.EnvVar{Name: "ETCDCTL_ENDPOINTS", Value: clientEndpointForOrdinalIndex(sts, 1)})
+	assert.Equal(t, "test-etcd-1-snapshots", snapshot.VolumeMounts[0].SubPath)
+	assert.Equal(t, []corev1.EnvVar{{Name: "KEEP", Value: "5"}}, spec.Containers[0].Env)
+	term := spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0]
+	assert.Equal(t, "test-etcd-1", term.LabelSelector.MatchLabels[appsv1.StatefulSetPodNameLabel])
+
+	// The members sharing a volume keep their snapshots in their own
+	// directory of it.
+	ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{AccessModes: corev1.ReadWriteMany, PVCName: "etcd-shared"}
+	ec.Spec.Maintenance.LocalSnapshots.Keep = 0
+	job = newLocalSnapshotJob(ec, sts, 2, due)
+	assert.Equal(t, "etcd-shared", job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	assert.Equal(t, "test-etcd-2-snapshots", job.Spec.Template.Spec.Containers[0].VolumeMounts[0].SubPath)
+	assert.Equal(t, "3", job.Spec.Template.Spec.Containers[0].Env[0].Value)
+}
+
+func TestReconcileLocalSnapshots(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = batchv1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	created := time.Date(2025, 1, 1, 2, 30, 0, 0, time.UTC)
+	ec := newLocalSnapshotTestCluster(created)
+	sts := newPlanTestStatefulSet(t, ec, 3)
+
+	// Nothing is due before the first time of the schedule.
+	assert.NoError(t, reconcileLocalSnapshots(ctx, logr.Discard(), c, scheme, recorder, ec, sts, created.Add(20*time.Minute)))
+	assert.Nil(t, ec.Status.LastLocalSnapshotTime)
+
+	now := created.Add(2 * time.Hour)
+	assert.NoError(t, reconcileLocalSnapshots(ctx, logr.Discard(), c, scheme, recorder, ec, sts, now))
+	assert.Equal(t, time.Date(2025, 1, 1, 4, 0, 0, 0, time.UTC), ec.Status.LastLocalSnapshotTime.Time)
+	assert.Contains(t, <-recorder.Events, "LocalSnapshot")
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, c.List(ctx, jobs, client.InNamespace("default")))
+	assert.Len(t, jobs.Items, 3)
+	assert.True(t, metav1.IsControlledBy(&jobs.Items[0], ec))
+
+	// The members aren't snapshotted again until the next time.
+	assert.NoError(t, reconcileLocalSnapshots(ctx, logr.Discard(), c, scheme, recorder, ec, sts, now.Add(time.Minute)))
+	assert.NoError(t, c.List(ctx, jobs, client.InNamespace("default")))
+	assert.Len(t, jobs.Items, 3)
+
+	result := withNextLocalSnapshot(ctrl.Result{}, ec, now)
+	assert.Equal(t, 30*time.Minute, result.RequeueAfter)
+
+	ec.Spec.Maintenance = nil
+	assert.Equal(t, ctrl.Result{}, withNextLocalSnapshot(ctrl.Result{}, ec, now))
+}
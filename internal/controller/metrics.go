@@ -0,0 +1,427 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+var (
+	queueDepthDesc = prometheus.NewDesc("etcd_operator_workqueue_depth",
+		"Number of items waiting in the workqueue of a controller.",
+		[]string{"controller", "resource"}, nil)
+	queueRetriesDesc = prometheus.NewDesc("etcd_operator_workqueue_retries_total",
+		"Number of retries of failed reconciles handled by the workqueue of a controller.",
+		[]string{"controller", "resource"}, nil)
+	queueLongestWaitingDesc = prometheus.NewDesc("etcd_operator_workqueue_longest_waiting_seconds",
+		"How long the oldest item ready to be reconciled has been waiting in the workqueue of a controller.",
+		[]string{"controller", "resource"}, nil)
+
+	clusterMembersDesc = prometheus.NewDesc("etcd_operator_cluster_members",
+		"Number of members of an EtcdCluster, as last reported by etcd.",
+		[]string{"namespace", "etcdcluster"}, nil)
+	clusterHealthyMembersDesc = prometheus.NewDesc("etcd_operator_cluster_healthy_members",
+		"Number of members of an EtcdCluster passing their health check.",
+		[]string{"namespace", "etcdcluster"}, nil)
+	clusterLeaderChangesDesc = prometheus.NewDesc("etcd_operator_cluster_leader_changes_total",
+		"Number of leader changes of an EtcdCluster seen by the operator.",
+		[]string{"namespace", "etcdcluster"}, nil)
+	clusterDBSizeDesc = prometheus.NewDesc("etcd_operator_cluster_db_size_bytes",
+		"Size of the database of a member of an EtcdCluster.",
+		[]string{"namespace", "etcdcluster", "member"}, nil)
+	clusterLastBackupAgeDesc = prometheus.NewDesc("etcd_operator_cluster_last_backup_age_seconds",
+		"Time since the latest completed EtcdBackup of an EtcdCluster.",
+		[]string{"namespace", "etcdcluster"}, nil)
+	clusterReconcilesDesc = prometheus.NewDesc("etcd_operator_cluster_reconciles_total",
+		"Number of reconciles of an EtcdCluster, by result: success, requeue or error.",
+		[]string{"namespace", "etcdcluster", "result"}, nil)
+
+	mirrorLagDesc = prometheus.NewDesc("etcd_operator_mirror_lag_revisions",
+		"Number of revisions of the source of an EtcdMirror not mirrored yet to its destination.",
+		[]string{"namespace", "etcdmirror"}, nil)
+	mirrorRevisionDesc = prometheus.NewDesc("etcd_operator_mirror_revision",
+		"Revision of the source of an EtcdMirror its destination caught up with.",
+		[]string{"namespace", "etcdmirror"}, nil)
+)
+
+// queues exports the metrics of the workqueues of the controllers.
+var queues = &queueCollector{}
+
+// clusters exports the metrics of the EtcdClusters.
+var clusters = newClusterCollector()
+
+// mirrors exports the metrics of the EtcdMirrors.
+var mirrors = &mirrorCollector{statuses: map[types.NamespacedName]ecv1alpha1.EtcdMirrorStatus{}}
+
+func init() {
+	metrics.Registry.MustRegister(queues, clusters, mirrors)
+}
+
+// queueCollector collects the metrics of the tracked workqueues on each
+// scrape.
+type queueCollector struct {
+	mu       sync.Mutex
+	trackers []*queueTracker
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- queueRetriesDesc
+	ch <- queueLongestWaitingDesc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range c.trackers {
+		depth, retries, longestWaiting := t.stats(now)
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(depth), t.controller, t.resource)
+		ch <- prometheus.MustNewConstMetric(queueRetriesDesc, prometheus.CounterValue, float64(retries), t.controller, t.resource)
+		ch <- prometheus.MustNewConstMetric(queueLongestWaitingDesc, prometheus.GaugeValue, longestWaiting.Seconds(), t.controller, t.resource)
+	}
+}
+
+// track adds t to the collected trackers, replacing the previous tracker of
+// the same controller, if any.
+func (c *queueCollector) track(t *queueTracker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, existing := range c.trackers {
+		if existing.controller == t.controller {
+			c.trackers[i] = t
+			return
+		}
+	}
+	c.trackers = append(c.trackers, t)
+}
+
+// queueTracker records when the items of a workqueue are ready to be
+// reconciled, until a worker picks them up.
+type queueTracker struct {
+	controller string
+	// resource is the plural name of the resource the controller reconciles.
+	resource string
+	// len returns the number of items in the workqueue.
+	len func() int
+
+	mu      sync.Mutex
+	readyAt map[reconcile.Request]time.Time
+	retries uint64
+}
+
+func newQueueTracker(controller, resource string) *queueTracker {
+	return &queueTracker{controller: controller, resource: resource, readyAt: map[reconcile.Request]time.Time{}}
+}
+
+// added records that item was added to the workqueue, to be reconciled after
+// delay. An item added several times is ready at the earliest time. A nil
+// tracker records nothing.
+func (t *queueTracker) added(item reconcile.Request, delay time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ready := time.Now().Add(delay)
+	if existing, ok := t.readyAt[item]; !ok || ready.Before(existing) {
+		t.readyAt[item] = ready
+	}
+}
+
+// retried records that item was added back to the workqueue after a failed
+// reconcile, to be retried after delay.
+func (t *queueTracker) retried(item reconcile.Request, delay time.Duration) {
+	if t == nil {
+		return
+	}
+	t.added(item, delay)
+	t.mu.Lock()
+	t.retries++
+	t.mu.Unlock()
+}
+
+// picked records that a worker picked up item.
+func (t *queueTracker) picked(item reconcile.Request) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.readyAt, item)
+}
+
+// stats returns the depth of the workqueue, its number of retries, and how
+// long its oldest ready item has been waiting at now.
+func (t *queueTracker) stats(now time.Time) (int, uint64, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var longestWaiting time.Duration
+	for _, ready := range t.readyAt {
+		longestWaiting = max(longestWaiting, now.Sub(ready))
+	}
+	depth := 0
+	if t.len != nil {
+		depth = t.len()
+	}
+	return depth, t.retries, longestWaiting
+}
+
+// trackedRateLimiter reports the retries of a workqueue to its tracker.
+type trackedRateLimiter struct {
+	workqueue.TypedRateLimiter[reconcile.Request]
+	tracker *queueTracker
+}
+
+func (l *trackedRateLimiter) When(item reconcile.Request) time.Duration {
+	delay := l.TypedRateLimiter.When(item)
+	l.tracker.retried(item, delay)
+	return delay
+}
+
+// trackedQueue reports the items added to and picked from a workqueue to its
+// tracker. The retries are reported by its trackedRateLimiter.
+type trackedQueue struct {
+	workqueue.TypedRateLimitingInterface[reconcile.Request]
+	tracker *queueTracker
+}
+
+func (q *trackedQueue) Add(item reconcile.Request) {
+	q.tracker.added(item, 0)
+	q.TypedRateLimitingInterface.Add(item)
+}
+
+func (q *trackedQueue) AddAfter(item reconcile.Request, duration time.Duration) {
+	q.tracker.added(item, duration)
+	q.TypedRateLimitingInterface.AddAfter(item, duration)
+}
+
+func (q *trackedQueue) Get() (reconcile.Request, bool) {
+	item, shutdown := q.TypedRateLimitingInterface.Get()
+	q.tracker.picked(item)
+	return item, shutdown
+}
+
+// newTrackedQueue wraps newQueue, a constructor of the workqueues of a
+// controller reconciling resource, to export their metrics. It defaults to
+// the workqueue of controller-runtime.
+func newTrackedQueue(resource string, newQueue func(string, workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request]) func(string, workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+	return func(name string, rateLimiter workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+		tracker := newQueueTracker(name, resource)
+		rateLimiter = &trackedRateLimiter{TypedRateLimiter: rateLimiter, tracker: tracker}
+
+		var q workqueue.TypedRateLimitingInterface[reconcile.Request]
+		if newQueue != nil {
+			q = newQueue(name, rateLimiter)
+		} else {
+			q = workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter, workqueue.TypedRateLimitingQueueConfig[reconcile.Request]{Name: name})
+		}
+		tracker.len = q.Len
+		queues.track(tracker)
+
+		if pq, ok := q.(*clusterPriorityQueue); ok {
+			pq.tracker = tracker
+			return pq
+		}
+		return &trackedQueue{TypedRateLimitingInterface: q, tracker: tracker}
+	}
+}
+
+// The results of the reconciles of the EtcdClusters.
+const (
+	reconcileSuccess = "success"
+	reconcileRequeue = "requeue"
+	reconcileError   = "error"
+)
+
+// clusterSample holds the metrics of an EtcdCluster, as of its last
+// reconcile.
+type clusterSample struct {
+	members        int
+	healthyMembers int32
+	// leader is the last leader seen, kept while the cluster has none.
+	leader        string
+	leaderChanges uint64
+	dbSizes       map[string]int64
+	reconciles    map[string]uint64
+}
+
+// clusterCollector collects the metrics of the EtcdClusters reconciled by
+// the operator, recorded by observe and observeBackup.
+type clusterCollector struct {
+	mu      sync.Mutex
+	samples map[types.NamespacedName]*clusterSample
+	// lastBackups holds the completion time of the latest backup of each
+	// EtcdCluster, exported along with the samples of the cluster.
+	lastBackups map[types.NamespacedName]time.Time
+	// now returns the current time, to compute the age of the backups.
+	now func() time.Time
+}
+
+func newClusterCollector() *clusterCollector {
+	return &clusterCollector{
+		samples:     map[types.NamespacedName]*clusterSample{},
+		lastBackups: map[types.NamespacedName]time.Time{},
+		now:         time.Now,
+	}
+}
+
+func (c *clusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clusterMembersDesc
+	ch <- clusterHealthyMembersDesc
+	ch <- clusterLeaderChangesDesc
+	ch <- clusterDBSizeDesc
+	ch <- clusterLastBackupAgeDesc
+	ch <- clusterReconcilesDesc
+}
+
+func (c *clusterCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for key, s := range c.samples {
+		ch <- prometheus.MustNewConstMetric(clusterMembersDesc, prometheus.GaugeValue, float64(s.members), key.Namespace, key.Name)
+		ch <- prometheus.MustNewConstMetric(clusterHealthyMembersDesc, prometheus.GaugeValue, float64(s.healthyMembers), key.Namespace, key.Name)
+		ch <- prometheus.MustNewConstMetric(clusterLeaderChangesDesc, prometheus.CounterValue, float64(s.leaderChanges), key.Namespace, key.Name)
+		for member, size := range s.dbSizes {
+			ch <- prometheus.MustNewConstMetric(clusterDBSizeDesc, prometheus.GaugeValue, float64(size), key.Namespace, key.Name, member)
+		}
+		if lastBackup, ok := c.lastBackups[key]; ok {
+			ch <- prometheus.MustNewConstMetric(clusterLastBackupAgeDesc, prometheus.GaugeValue, now.Sub(lastBackup).Seconds(), key.Namespace, key.Name)
+		}
+		for result, count := range s.reconciles {
+			ch <- prometheus.MustNewConstMetric(clusterReconcilesDesc, prometheus.CounterValue, float64(count), key.Namespace, key.Name, result)
+		}
+	}
+}
+
+// observe records the status of ec at the end of a reconcile with the given
+// result.
+func (c *clusterCollector) observe(ec *ecv1alpha1.EtcdCluster, result string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: ec.Namespace, Name: ec.Name}
+	s, ok := c.samples[key]
+	if !ok {
+		s = &clusterSample{reconciles: map[string]uint64{}}
+		c.samples[key] = s
+	}
+	s.reconciles[result]++
+
+	// The status isn't refreshed when the reconcile stops early, e.g. while
+	// the cluster is paused, so it still holds the last values seen.
+	s.members = len(ec.Status.Members)
+	s.healthyMembers = ec.Status.ReadyMembers
+	if leader := ec.Status.Leader; leader != "" {
+		if s.leader != "" && s.leader != leader {
+			s.leaderChanges++
+		}
+		s.leader = leader
+	}
+	s.dbSizes = make(map[string]int64, len(ec.Status.Members))
+	for _, m := range ec.Status.Members {
+		if m.DBSize > 0 {
+			s.dbSizes[m.Name] = m.DBSize
+		}
+	}
+}
+
+// observeBackup records the completion of backup, if completed, for the age
+// of the latest backup of its EtcdCluster.
+func (c *clusterCollector) observeBackup(backup *ecv1alpha1.EtcdBackup) {
+	if backup.Status.Phase != ecv1alpha1.EtcdBackupPhaseCompleted || backup.Status.CompletionTime == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: backup.Namespace, Name: backup.Spec.ClusterName}
+	if last, ok := c.lastBackups[key]; !ok || backup.Status.CompletionTime.After(last) {
+		c.lastBackups[key] = backup.Status.CompletionTime.Time
+	}
+}
+
+// forget drops the metrics of the EtcdCluster key, once it is deleted or
+// reconciled by another shard.
+func (c *clusterCollector) forget(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.samples, key)
+	delete(c.lastBackups, key)
+}
+
+// reconcileResult returns the result of a reconcile returning result and
+// err, for the etcd_operator_cluster_reconciles_total metric.
+func reconcileResult(result ctrl.Result, err error) string {
+	switch {
+	case err != nil:
+		return reconcileError
+	case result.RequeueAfter > 0 || result.Requeue:
+		return reconcileRequeue
+	default:
+		return reconcileSuccess
+	}
+}
+
+// mirrorCollector collects the metrics of the EtcdMirrors run by the
+// operator, recorded by observe.
+type mirrorCollector struct {
+	mu       sync.Mutex
+	statuses map[types.NamespacedName]ecv1alpha1.EtcdMirrorStatus
+}
+
+func (c *mirrorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- mirrorLagDesc
+	ch <- mirrorRevisionDesc
+}
+
+func (c *mirrorCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, s := range c.statuses {
+		ch <- prometheus.MustNewConstMetric(mirrorLagDesc, prometheus.GaugeValue, float64(s.LagRevisions), key.Namespace, key.Name)
+		ch <- prometheus.MustNewConstMetric(mirrorRevisionDesc, prometheus.GaugeValue, float64(s.MirroredRevision), key.Namespace, key.Name)
+	}
+}
+
+// observe records the progress of em, as of its status. Nothing is recorded
+// until its mirror copied the keys of the source.
+func (c *mirrorCollector) observe(em *ecv1alpha1.EtcdMirror) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: em.Namespace, Name: em.Name}
+	if em.Status.MirroredRevision == 0 {
+		delete(c.statuses, key)
+		return
+	}
+	c.statuses[key] = ecv1alpha1.EtcdMirrorStatus{
+		MirroredRevision: em.Status.MirroredRevision,
+		LagRevisions:     em.Status.LagRevisions,
+	}
+}
+
+// forget drops the metrics of the EtcdMirror key, once its mirror stopped.
+func (c *mirrorCollector) forget(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.statuses, key)
+}
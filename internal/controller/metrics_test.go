@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/priorityqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestTrackedQueue(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	tests := []struct {
+		name     string
+		newQueue func(string, workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request]
+	}{
+		{name: "default"},
+		{name: "priority", newQueue: newClusterPriorityQueue(fakeClient, logr.Discard())},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rateLimiter := workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](time.Hour, time.Hour)
+			q := newTrackedQueue("etcdclusters", tt.newQueue)("test-"+tt.name, rateLimiter)
+			defer q.ShutDown()
+			if tt.newQueue != nil {
+				_, ok := q.(priorityqueue.PriorityQueue[reconcile.Request])
+				assert.True(t, ok, "the priority queue must not be hidden")
+			}
+
+			first := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "first"}}
+			second := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "second"}}
+			q.Add(first)
+			time.Sleep(10 * time.Millisecond)
+			q.Add(second)
+			// Retries aren't waiting before their delay is over.
+			q.AddRateLimited(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "failing"}})
+
+			tracker := queues.trackers[len(queues.trackers)-1]
+			assert.Equal(t, "test-"+tt.name, tracker.controller)
+			depth, retries, longestWaiting := tracker.stats(time.Now())
+			assert.Equal(t, 2, depth)
+			assert.Equal(t, uint64(1), retries)
+			assert.GreaterOrEqual(t, longestWaiting, 10*time.Millisecond)
+
+			item, _ := q.Get()
+			assert.Equal(t, first, item)
+			q.Done(item)
+			_, _, longestWaiting = tracker.stats(time.Now())
+			assert.Less(t, longestWaiting, 10*time.Millisecond)
+
+			assert.Equal(t, 3*len(queues.trackers), testutil.CollectAndCount(queues))
+		})
+	}
+}
+
+func TestClusterCollector(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newClusterCollector()
+	c.now = func() time.Time { return now }
+
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Status.ReadyMembers = 2
+	ec.Status.Leader = "test-etcd-0"
+	ec.Status.Members = []ecv1alpha1.MemberStatus{
+		{Name: "test-etcd-0", DBSize: 4096},
+		{Name: "test-etcd-1", DBSize: 2048},
+		// Not responding.
+		{Name: "test-etcd-2"},
+	}
+	c.observe(ec, reconcileSuccess)
+
+	// The latest completed backup counts, whatever the order they are seen.
+	backup := func(name string, phase ecv1alpha1.EtcdBackupPhase, completed time.Duration) *ecv1alpha1.EtcdBackup {
+		b := &ecv1alpha1.EtcdBackup{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		b.Spec.ClusterName = "test-etcd"
+		b.Status.Phase = phase
+		b.Status.CompletionTime = ptr.To(metav1.NewTime(now.Add(-completed)))
+		return b
+	}
+	c.observeBackup(backup("latest", ecv1alpha1.EtcdBackupPhaseCompleted, time.Hour))
+	c.observeBackup(backup("previous", ecv1alpha1.EtcdBackupPhaseCompleted, 2*time.Hour))
+	c.observeBackup(backup("failed", ecv1alpha1.EtcdBackupPhaseFailed, time.Minute))
+
+	// The leader changes, then is lost, which isn't a change.
+	ec.Status.Leader = "test-etcd-1"
+	c.observe(ec, reconcileRequeue)
+	ec.Status.Leader = ""
+	c.observe(ec, reconcileError)
+	ec.Status.Leader = "test-etcd-1"
+	c.observe(ec, reconcileSuccess)
+
+	expected := `
+# HELP etcd_operator_cluster_db_size_bytes Size of the database of a member of an EtcdCluster.
+# TYPE etcd_operator_cluster_db_size_bytes gauge
+etcd_operator_cluster_db_size_bytes{etcdcluster="test-etcd",member="test-etcd-0",namespace="default"} 4096
+etcd_operator_cluster_db_size_bytes{etcdcluster="test-etcd",member="test-etcd-1",namespace="default"} 2048
+# HELP etcd_operator_cluster_healthy_members Number of members of an EtcdCluster passing their health check.
+# TYPE etcd_operator_cluster_healthy_members gauge
+etcd_operator_cluster_healthy_members{etcdcluster="test-etcd",namespace="default"} 2
+# HELP etcd_operator_cluster_last_backup_age_seconds Time since the latest completed EtcdBackup of an EtcdCluster.
+# TYPE etcd_operator_cluster_last_backup_age_seconds gauge
+etcd_operator_cluster_last_backup_age_seconds{etcdcluster="test-etcd",namespace="default"} 3600
+# HELP etcd_operator_cluster_leader_changes_total Number of leader changes of an EtcdCluster seen by the operator.
+# TYPE etcd_operator_cluster_leader_changes_total counter
+etcd_operator_cluster_leader_changes_total{etcdcluster="test-etcd",namespace="default"} 1
+# HELP etcd_operator_cluster_members Number of members of an EtcdCluster, as last reported by etcd.
+# TYPE etcd_operator_cluster_members gauge
+etcd_operator_cluster_members{etcdcluster="test-etcd",namespace="default"} 3
+# HELP etcd_operator_cluster_reconciles_total Number of reconciles of an EtcdCluster, by result: success, requeue or error.
+# TYPE etcd_operator_cluster_reconciles_total counter
+etcd_operator_cluster_reconciles_total{etcdcluster="test-etcd",namespace="default",result="error"} 1
+etcd_operator_cluster_reconciles_total{etcdcluster="test-etcd",namespace="default",result="requeue"} 1
+etcd_operator_cluster_reconciles_total{etcdcluster="test-etcd",namespace="default",result="success"} 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+
+	c.forget(types.NamespacedName{Namespace: "default", Name: "test-etcd"})
+	assert.Equal(t, 0, testutil.CollectAndCount(c))
+}
+
+func TestReconcileResult(t *testing.T) {
+	assert.Equal(t, reconcileSuccess, reconcileResult(ctrl.Result{}, nil))
+	assert.Equal(t, reconcileRequeue, reconcileResult(ctrl.Result{RequeueAfter: time.Second}, nil))
+	assert.Equal(t, reconcileError, reconcileResult(ctrl.Result{RequeueAfter: time.Second}, errors.New("failed")))
+}
@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// prometheusOperatorGroupVersion is the API version of the ServiceMonitors of
+// the Prometheus operator. Like the cert-manager Certificates, they are
+// handled as unstructured objects, so the Prometheus operator needn't be
+// installed when no EtcdCluster uses it.
+const prometheusOperatorGroupVersion = "monitoring.coreos.com/v1"
+
+// metricsPortName returns the name of the port the members of ec serve their
+// metrics on, over plain HTTP. The client port of the members with TLS
+// requires a client certificate, which would also give Prometheus access to
+// the data, so they serve their metrics on a port of their own.
+func metricsPortName(ec *ecv1alpha1.EtcdCluster) string {
+	if ec.Spec.TLS.Enabled() {
+		return "metrics"
+	}
+	return "client"
+}
+
+// prometheusDuration formats d the way Prometheus parses durations, without
+// fractions.
+func prometheusDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// newMonitoringRef returns an empty object of the Prometheus operator, of the
+// given kind and name.
+func newMonitoringRef(kind, name, namespace string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(prometheusOperatorGroupVersion)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace(namespace)
+	return obj
+}
+
+// newServiceMonitor returns the ServiceMonitor scraping the members of ec,
+// which must have a serviceMonitor, through its headless Service.
+func newServiceMonitor(ec *ecv1alpha1.EtcdCluster) *unstructured.Unstructured {
+	cfg := ec.Spec.Monitoring.ServiceMonitor
+	endpoint := map[string]any{
+		"port":   metricsPortName(ec),
+		"path":   "/metrics",
+		"scheme": "http",
+	}
+	if cfg.Interval != nil {
+		endpoint["interval"] = prometheusDuration(cfg.Interval.Duration)
+	}
+	spec := map[string]any{
+		"endpoints": []any{endpoint},
+		"selector": map[string]any{
+			"matchLabels": map[string]any{"app": ec.Name, "controller": ec.Name},
+		},
+	}
+
+	labels := maps.Clone(cfg.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels["app"] = ec.Name
+
+	sm := newMonitoringRef("ServiceMonitor", ec.Name, ec.Namespace)
+	sm.Object["spec"] = spec
+	sm.SetLabels(labels)
+	return sm
+}
+
+// alertSelector returns the label matchers selecting the metrics of the
+// members of ec, as scraped by its ServiceMonitor: Prometheus names the job
+// after the headless Service.
+func alertSelector(ec *ecv1alpha1.EtcdCluster) string {
+	return fmt.Sprintf(`job=%q,namespace=%q`, ec.Name, ec.Namespace)
+}
+
+// etcdAlert is an alert recommended by the etcd mixin, whose expr formats
+// the alertSelector of the cluster.
+type etcdAlert struct {
+	name        string
+	expr        string
+	duration    string
+	severity    string
+	summary     string
+	description string
+}
+
+// etcdAlerts are the alerts of the PrometheusRules, from the etcd mixin.
+var etcdAlerts = []etcdAlert{
+	{
+		name:        "etcdInsufficientMembers",
+		expr:        `sum(up{%[1]s} == bool 1) < ((count(up{%[1]s}) + 1) / 2)`,
+		duration:    "3m",
+		severity:    "critical",
+		summary:     "etcd cluster has insufficient number of members.",
+		description: "etcd cluster {{ $labels.namespace }}/{{ $labels.job }}: insufficient members ({{ $value }}).",
+	},
+	{
+		name:        "etcdNoLeader",
+		expr:        `etcd_server_has_leader{%[1]s} == 0`,
+		duration:    "1m",
+		severity:    "critical",
+		summary:     "etcd cluster has no leader.",
+		description: "etcd cluster {{ $labels.namespace }}/{{ $labels.job }}: member {{ $labels.pod }} has no leader.",
+	},
+	{
+		name:        "etcdHighNumberOfLeaderChanges",
+		expr:        `increase(etcd_server_leader_changes_seen_total{%[1]s}[15m]) >= 4`,
+		duration:    "5m",
+		severity:    "warning",
+		summary:     "etcd cluster has high number of leader changes.",
+		description: "etcd cluster {{ $labels.namespace }}/{{ $labels.job }}: {{ $value }} leader changes within the last 15 minutes. Frequent elections may be a sign of insufficient resources, high network latency, or disruptions by other components and should be investigated.",
+	},
+	{
+		name:        "etcdHighFsyncDurations",
+		expr:        `histogram_quantile(0.99, rate(etcd_disk_wal_fsync_duration_seconds_bucket{%[1]s}[5m])) > 0.5`,
+		duration:    "10m",
+		severity:    "warning",
+		summary:     "etcd cluster 99th percentile fsync durations are too high.",
+		description: "etcd cluster {{ $labels.namespace }}/{{ $labels.job }}: 99th percentile fsync durations are {{ $value }}s on member {{ $labels.pod }}.",
+	},
+	{
+		name:        "etcdHighFsyncDurations",
+		expr:        `histogram_quantile(0.99, rate(etcd_disk_wal_fsync_duration_seconds_bucket{%[1]s}[5m])) > 1`,
+		duration:    "10m",
+		severity:    "critical",
+		summary:     "etcd cluster 99th percentile fsync durations are too high.",
+		description: "etcd cluster {{ $labels.namespace }}/{{ $labels.job }}: 99th percentile fsync durations are {{ $value }}s on member {{ $labels.pod }}.",
+	},
+	{
+		name:        "etcdHighCommitDurations",
+		expr:        `histogram_quantile(0.99, rate(etcd_disk_backend_commit_duration_seconds_bucket{%[1]s}[5m])) > 0.25`,
+		duration:    "10m",
+		severity:    "warning",
+		summary:     "etcd cluster 99th percentile commit durations are too high.",
+		description: "etcd cluster {{ $labels.namespace }}/{{ $labels.job }}: 99th percentile commit durations {{ $value }}s on member {{ $labels.pod }}.",
+	},
+	{
+		name:        "etcdDatabaseQuotaLowSpace",
+		expr:        `(last_over_time(etcd_mvcc_db_total_size_in_bytes{%[1]s}[5m]) / last_over_time(etcd_server_quota_backend_bytes{%[1]s}[5m])) * 100 > 95`,
+		duration:    "10m",
+		severity:    "critical",
+		summary:     "etcd cluster database is running full.",
+		description: "etcd cluster {{ $labels.namespace }}/{{ $labels.job }}: database size exceeds the defined quota on member {{ $labels.pod }}, please defrag or increase the quota as the writes to etcd will be disabled when it is full.",
+	},
+}
+
+// newPrometheusRule returns the PrometheusRule alerting on the members of
+// ec, which must have a prometheusRule.
+func newPrometheusRule(ec *ecv1alpha1.EtcdCluster) *unstructured.Unstructured {
+	cfg := ec.Spec.Monitoring.PrometheusRule
+	selector := alertSelector(ec)
+	rules := make([]any, 0, len(etcdAlerts))
+	for _, a := range etcdAlerts {
+		alertLabels := make(map[string]any, len(cfg.AlertLabels)+1)
+		for k, v := range cfg.AlertLabels {
+			alertLabels[k] = v
+		}
+		alertLabels["severity"] = a.severity
+		rules = append(rules, map[string]any{
+			"alert":  a.name,
+			"expr":   fmt.Sprintf(a.expr, selector),
+			"for":    a.duration,
+			"labels": alertLabels,
+			"annotations": map[string]any{
+				"summary":     a.summary,
+				"description": a.description,
+			},
+		})
+	}
+
+	labels := maps.Clone(cfg.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels["app"] = ec.Name
+
+	rule := newMonitoringRef("PrometheusRule", ec.Name, ec.Namespace)
+	rule.Object["spec"] = map[string]any{
+		"groups": []any{
+			map[string]any{"name": "etcd", "rules": rules},
+		},
+	}
+	rule.SetLabels(labels)
+	return rule
+}
+
+// reconcileMonitoring applies the ServiceMonitor and the PrometheusRule of
+// ec, in the Kubernetes cluster running its members, and deletes them once
+// they are removed from the spec. The objects created are recorded in the
+// status, so the clusters without them don't look them up, which fails when
+// the Prometheus operator isn't installed.
+func reconcileMonitoring(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster) error {
+	var sm, rule *unstructured.Unstructured
+	if m := ec.Spec.Monitoring; m != nil {
+		if m.ServiceMonitor != nil {
+			sm = newServiceMonitor(ec)
+		}
+		if m.PrometheusRule != nil {
+			rule = newPrometheusRule(ec)
+		}
+	}
+	return errors.Join(
+		reconcileMonitoringObject(ctx, c, scheme, recorder, ec, "ServiceMonitor", sm, &ec.Status.ServiceMonitor),
+		reconcileMonitoringObject(ctx, c, scheme, recorder, ec, "PrometheusRule", rule, &ec.Status.PrometheusRule),
+	)
+}
+
+// reconcileMonitoringObject applies obj, an object of the Prometheus
+// operator of the given kind, and records its name in recorded. A nil obj
+// deletes the object recorded instead.
+func reconcileMonitoringObject(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder,
+	ec *ecv1alpha1.EtcdCluster, kind string, obj *unstructured.Unstructured, recorded *string) error {
+	if obj == nil {
+		if *recorded == "" {
+			return nil
+		}
+		if err := c.Delete(ctx, newMonitoringRef(kind, *recorded, ec.Namespace)); client.IgnoreNotFound(err) != nil && !meta.IsNoMatchError(err) {
+			return fmt.Errorf("failed to delete the %s: %w", kind, err)
+		}
+		*recorded = ""
+		return nil
+	}
+
+	if err := setWorkloadOwner(ec, scheme, obj); err != nil {
+		return err
+	}
+	if err := applyOwnedObject(ctx, c, recorder, ec, obj); err != nil {
+		if meta.IsNoMatchError(err) {
+			return fmt.Errorf("the Prometheus operator isn't installed: %w", err)
+		}
+		return fmt.Errorf("failed to apply the %s: %w", kind, err)
+	}
+	*recorded = obj.GetName()
+	return nil
+}
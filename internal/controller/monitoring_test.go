@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestNewServiceMonitor(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.Monitoring = &ecv1alpha1.Monitoring{ServiceMonitor: &ecv1alpha1.ServiceMonitorSpec{
+		Interval: &metav1.Duration{Duration: 1500 * time.Millisecond},
+		Labels:   map[string]string{"release": "prometheus", "app": "other"},
+	}}
+
+	sm := newServiceMonitor(ec)
+	assert.Equal(t, "ServiceMonitor", sm.GetKind())
+	assert.Equal(t, "test-etcd", sm.GetName())
+	assert.Equal(t, map[string]string{"release": "prometheus", "app": "test-etcd"}, sm.GetLabels())
+	endpoints, _, _ := unstructured.NestedSlice(sm.Object, "spec", "endpoints")
+	assert.Equal(t, []any{map[string]any{"port": "client", "path": "/metrics", "scheme": "http", "interval": "1500ms"}}, endpoints)
+	selector, _, _ := unstructured.NestedStringMap(sm.Object, "spec", "selector", "matchLabels")
+	assert.Equal(t, map[string]string{"app": "test-etcd", "controller": "test-etcd"}, selector)
+	// The labels of the spec are left alone.
+	assert.Equal(t, "other", ec.Spec.Monitoring.ServiceMonitor.Labels["app"])
+
+	// The members with TLS serve their metrics on a port of their own.
+	ec = newTLSTestCluster()
+	ec.Spec.Monitoring = &ecv1alpha1.Monitoring{ServiceMonitor: &ecv1alpha1.ServiceMonitorSpec{}}
+	sm = newServiceMonitor(ec)
+	endpoints, _, _ = unstructured.NestedSlice(sm.Object, "spec", "endpoints")
+	assert.Equal(t, []any{map[string]any{"port": "metrics", "path": "/metrics", "scheme": "http"}}, endpoints)
+}
+
+func TestNewPrometheusRule(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.Monitoring = &ecv1alpha1.Monitoring{
+		ServiceMonitor: &ecv1alpha1.ServiceMonitorSpec{},
+		PrometheusRule: &ecv1alpha1.PrometheusRuleSpec{
+			Labels:      map[string]string{"release": "prometheus"},
+			AlertLabels: map[string]string{"team": "storage", "severity": "info"},
+		},
+	}
+
+	rule := newPrometheusRule(ec)
+	assert.Equal(t, "PrometheusRule", rule.GetKind())
+	assert.Equal(t, "test-etcd", rule.GetName())
+	assert.Equal(t, map[string]string{"release": "prometheus", "app": "test-etcd"}, rule.GetLabels())
+	groups, _, _ := unstructured.NestedSlice(rule.Object, "spec", "groups")
+	assert.Len(t, groups, 1)
+	rules, _, _ := unstructured.NestedSlice(groups[0].(map[string]any), "rules")
+	assert.Len(t, rules, len(etcdAlerts))
+
+	var names []string
+	for _, r := range rules {
+		r := r.(map[string]any)
+		names = append(names, r["alert"].(string))
+		// Every metric of the expressions is selected by the job of the cluster.
+		expr := r["expr"].(string)
+		assert.Equal(t, strings.Count(expr, "{"), strings.Count(expr, `{job="test-etcd",namespace="default"}`), expr)
+		labels := r["labels"].(map[string]any)
+		assert.Equal(t, "storage", labels["team"])
+		// The severity of the alert isn't overridden.
+		assert.Contains(t, []any{"warning", "critical"}, labels["severity"])
+	}
+	assert.Contains(t, names, "etcdNoLeader")
+	assert.Contains(t, names, "etcdHighFsyncDurations")
+	assert.Contains(t, names, "etcdDatabaseQuotaLowSpace")
+}
+
+func TestReconcileMonitoring(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	gvk := schema.FromAPIVersionAndKind(prometheusOperatorGroupVersion, "ServiceMonitor")
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(gvk, meta.RESTScopeNamespace)
+	mapper.Add(schema.FromAPIVersionAndKind(prometheusOperatorGroupVersion, "PrometheusRule"), meta.RESTScopeNamespace)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.UID = "ec-uid"
+	ec.Spec.Monitoring = &ecv1alpha1.Monitoring{ServiceMonitor: &ecv1alpha1.ServiceMonitorSpec{}}
+	assert.NoError(t, reconcileMonitoring(ctx, fakeClient, scheme, record.NewFakeRecorder(10), ec))
+	assert.Equal(t, "test-etcd", ec.Status.ServiceMonitor)
+	assert.Empty(t, ec.Status.PrometheusRule)
+	sm := newMonitoringRef("ServiceMonitor", "test-etcd", "default")
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(sm), sm))
+	assert.True(t, metav1.IsControlledBy(sm, ec))
+
+	ec.Spec.Monitoring.PrometheusRule = &ecv1alpha1.PrometheusRuleSpec{}
+	assert.NoError(t, reconcileMonitoring(ctx, fakeClient, scheme, record.NewFakeRecorder(10), ec))
+	assert.Equal(t, "test-etcd", ec.Status.PrometheusRule)
+	rule := newMonitoringRef("PrometheusRule", "test-etcd", "default")
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(rule), rule))
+	assert.True(t, metav1.IsControlledBy(rule, ec))
+
+	// The objects go once they are removed from the spec.
+	ec.Spec.Monitoring = nil
+	assert.NoError(t, reconcileMonitoring(ctx, fakeClient, scheme, record.NewFakeRecorder(10), ec))
+	assert.Empty(t, ec.Status.ServiceMonitor)
+	assert.Empty(t, ec.Status.PrometheusRule)
+	assert.True(t, k8serrors.IsNotFound(fakeClient.Get(ctx, client.ObjectKeyFromObject(sm), sm)))
+	assert.True(t, k8serrors.IsNotFound(fakeClient.Get(ctx, client.ObjectKeyFromObject(rule), rule)))
+
+	// Without the Prometheus operator.
+	fakeClient = fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			return &meta.NoKindMatchError{GroupKind: gvk.GroupKind()}
+		},
+	}).Build()
+	ec.Spec.Monitoring = &ecv1alpha1.Monitoring{ServiceMonitor: &ecv1alpha1.ServiceMonitorSpec{}}
+	err := reconcileMonitoring(ctx, fakeClient, scheme, record.NewFakeRecorder(10), ec)
+	assert.ErrorContains(t, err, "the Prometheus operator isn't installed")
+	assert.Empty(t, ec.Status.ServiceMonitor)
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// removeAnnotation removes the annotation key from ec, once it is consumed.
+// Only the annotation is patched, ec holds in-memory values of its spec.
+func removeAnnotation(ctx context.Context, c client.Client, ec *ecv1alpha1.EtcdCluster, key string) error {
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": map[string]any{key: nil}}})
+	if err != nil {
+		return err
+	}
+	obj := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: ec.Namespace}}
+	if err := c.Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return err
+	}
+	delete(ec.Annotations, key)
+	return nil
+}
+
+// reconcileMoveLeader transfers the leadership of ec to the member named by
+// its MoveLeaderAnnotation, and removes the annotation once done, or once it
+// can't be done: when the member isn't a voting member of the cluster.
+// members and healthInfos are the result of the health check of the
+// cluster. It returns whether the leadership was transferred.
+func reconcileMoveLeader(ctx context.Context, logger logr.Logger, c client.Client, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster,
+	etcdClient *etcdutils.ClusterClient, members *clientv3.MemberListResponse, healthInfos []etcdutils.EpHealth) (bool, error) {
+	target, ok := ec.Annotations[ecv1alpha1.MoveLeaderAnnotation]
+	if !ok || members == nil {
+		return false, nil
+	}
+
+	idx := slices.IndexFunc(members.Members, func(m *etcdserverpb.Member) bool { return memberName(m) == target })
+	if idx < 0 || members.Members[idx].IsLearner {
+		recorder.Eventf(ec, corev1.EventTypeWarning, "LeaderMoveFailed",
+			"Can't move the leadership to %s, it isn't a voting member of the cluster", target)
+		return false, removeAnnotation(ctx, c, ec, ecv1alpha1.MoveLeaderAnnotation)
+	}
+	transferee := members.Members[idx].ID
+
+	leaderIdx := slices.IndexFunc(healthInfos, func(h etcdutils.EpHealth) bool {
+		return h.Status != nil && h.Status.Header != nil && h.Status.Leader == h.Status.Header.MemberId
+	})
+	if leaderIdx < 0 {
+		// The leadership is moved once the cluster elected a leader.
+		return false, nil
+	}
+	leader := healthInfos[leaderIdx]
+	if leader.Status.Leader == transferee {
+		logger.Info("The member is already the leader", "member", target)
+		return false, removeAnnotation(ctx, c, ec, ecv1alpha1.MoveLeaderAnnotation)
+	}
+
+	from := memberNameByID(members, leader.Status.Leader)
+	logger.Info("Moving the leadership", "from", from, "to", target)
+	if err := etcdClient.MoveLeader(leader.Ep, transferee); err != nil {
+		recorder.Eventf(ec, corev1.EventTypeWarning, "LeaderMoveFailed", "Failed to move the leadership from member %s to %s: %v", from, target, err)
+		return false, err
+	}
+	recorder.Eventf(ec, corev1.EventTypeNormal, "LeaderMoved", "Moved the leadership from member %s to %s", from, target)
+	return true, removeAnnotation(ctx, c, ec, ecv1alpha1.MoveLeaderAnnotation)
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func TestReconcileMoveLeader(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+	members := &clientv3.MemberListResponse{Members: []*etcdserverpb.Member{
+		{ID: 1, Name: "test-etcd-0"},
+		{ID: 2, Name: "test-etcd-1"},
+		{ID: 3, Name: "test-etcd-2", IsLearner: true},
+	}}
+	health := func(leader uint64) []etcdutils.EpHealth {
+		var infos []etcdutils.EpHealth
+		for _, id := range []uint64{1, 2} {
+			infos = append(infos, etcdutils.EpHealth{Health: true, Status: &clientv3.StatusResponse{
+				Header: &etcdserverpb.ResponseHeader{MemberId: id}, Leader: leader,
+			}})
+		}
+		return infos
+	}
+	newCluster := func(target string) (*ecv1alpha1.EtcdCluster, client.Client) {
+		ec := newPlanTestCluster(3, "v3.5.21")
+		ec.Annotations = map[string]string{ecv1alpha1.MoveLeaderAnnotation: target}
+		return ec, fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec.DeepCopy()).Build()
+	}
+	annotations := func(c client.Client) map[string]string {
+		ec := &ecv1alpha1.EtcdCluster{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKey{Name: "test-etcd", Namespace: "default"}, ec))
+		return ec.Annotations
+	}
+
+	t.Run("without the annotation", func(t *testing.T) {
+		ec := newPlanTestCluster(3, "v3.5.21")
+		recorder := record.NewFakeRecorder(10)
+		moved, err := reconcileMoveLeader(ctx, logr.Discard(), nil, recorder, ec, nil, members, health(1))
+		assert.NoError(t, err)
+		assert.False(t, moved)
+		assert.Empty(t, recorder.Events)
+	})
+
+	t.Run("to a member that can't lead", func(t *testing.T) {
+		for _, target := range []string{"test-etcd-5", "test-etcd-2"} {
+			ec, c := newCluster(target)
+			recorder := record.NewFakeRecorder(10)
+			moved, err := reconcileMoveLeader(ctx, logr.Discard(), c, recorder, ec, nil, members, health(1))
+			assert.NoError(t, err)
+			assert.False(t, moved)
+			assert.Equal(t, "Warning LeaderMoveFailed Can't move the leadership to "+target+", it isn't a voting member of the cluster", <-recorder.Events)
+			assert.NotContains(t, ec.Annotations, ecv1alpha1.MoveLeaderAnnotation)
+			assert.NotContains(t, annotations(c), ecv1alpha1.MoveLeaderAnnotation)
+		}
+	})
+
+	t.Run("to the leader", func(t *testing.T) {
+		ec, c := newCluster("test-etcd-1")
+		recorder := record.NewFakeRecorder(10)
+
+		// The annotation waits for the cluster to elect a leader.
+		moved, err := reconcileMoveLeader(ctx, logr.Discard(), c, recorder, ec, nil, members, health(0))
+		assert.NoError(t, err)
+		assert.False(t, moved)
+		assert.Contains(t, annotations(c), ecv1alpha1.MoveLeaderAnnotation)
+
+		moved, err = reconcileMoveLeader(ctx, logr.Discard(), c, recorder, ec, nil, members, health(2))
+		assert.NoError(t, err)
+		assert.False(t, moved)
+		assert.Empty(t, recorder.Events)
+		assert.NotContains(t, annotations(c), ecv1alpha1.MoveLeaderAnnotation)
+	})
+}
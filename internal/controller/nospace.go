@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// alarmedMemberNames returns the names of the members raising alarms, or
+// their hexadecimal ID when they aren't in members.
+func alarmedMemberNames(alarms []*etcdserverpb.AlarmMember, members *clientv3.MemberListResponse) string {
+	names := make([]string, 0, len(alarms))
+	for _, a := range alarms {
+		names = append(names, memberNameByID(members, a.MemberID))
+	}
+	return strings.Join(names, ", ")
+}
+
+// recordAlarms records alarms, the alarms raised by the members of ec, in its
+// status, and an event for each alarm raised or cleared since they were last
+// recorded.
+func recordAlarms(recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, alarms []*etcdserverpb.AlarmMember, members *clientv3.MemberListResponse) {
+	var current []ecv1alpha1.MemberAlarm
+	for _, a := range alarms {
+		if a.Alarm == etcdserverpb.AlarmType_NONE {
+			continue
+		}
+		current = append(current, ecv1alpha1.MemberAlarm{Member: memberNameByID(members, a.MemberID), Alarm: a.Alarm.String()})
+	}
+	for _, a := range current {
+		if !slices.Contains(ec.Status.Alarms, a) {
+			recorder.Eventf(ec, corev1.EventTypeWarning, "AlarmRaised", "Member %s raised the %s alarm", a.Member, a.Alarm)
+		}
+	}
+	for _, a := range ec.Status.Alarms {
+		if !slices.Contains(current, a) {
+			recorder.Eventf(ec, corev1.EventTypeNormal, "AlarmCleared", "The %s alarm of member %s is cleared", a.Alarm, a.Member)
+		}
+	}
+	ec.Status.Alarms = current
+}
+
+// leaderLast returns the ordinals of the members of sts, the leader last
+// according to healthInfos, the result of the health check of the members.
+func leaderLast(sts *appsv1.StatefulSet, healthInfos []etcdutils.EpHealth) []int {
+	var ordinals []int
+	leader := -1
+	for i := range int(ptr.Deref(sts.Spec.Replicas, 0)) {
+		ep := clientEndpointForOrdinalIndex(sts, i)
+		idx := slices.IndexFunc(healthInfos, func(h etcdutils.EpHealth) bool { return h.Ep == ep })
+		if idx >= 0 && healthInfos[idx].Status != nil && healthInfos[idx].Status.Leader == healthInfos[idx].Status.Header.MemberId {
+			leader = i
+			continue
+		}
+		ordinals = append(ordinals, i)
+	}
+	if leader >= 0 {
+		ordinals = append(ordinals, leader)
+	}
+	return ordinals
+}
+
+// reconcileNoSpaceAlarm checks the alarms raised by the members of ec, and
+// records them in its status. Once the database of a member reaches its
+// quota, it raises the NOSPACE alarm, and the cluster only serves reads and
+// deletes until the alarm is disarmed.
+// With spec.maintenance.autoRecoverNoSpace, the keyspace is compacted to its
+// current revision, the members are defragmented, the leader last, to give
+// the space back, and the alarm is disarmed. It is only reported otherwise.
+// members and healthInfos are the result of the health check of the
+// cluster. It returns whether the alarm is raised, in which case the other
+// changes of the cluster wait for it to be disarmed, as the members fail
+// their health check meanwhile.
+func reconcileNoSpaceAlarm(logger logr.Logger, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet,
+	etcdClient *etcdutils.ClusterClient, members *clientv3.MemberListResponse, healthInfos []etcdutils.EpHealth) (bool, error) {
+	if members == nil {
+		return false, nil
+	}
+	eps := clientEndpointsFromStatefulsets(sts)
+	eps = eps[:min(len(eps), len(members.Members))]
+	alarms, err := etcdClient.AlarmList(eps)
+	if err != nil {
+		// The alarms are only listed by a cluster with a quorum.
+		logger.Info("Failed to list the alarms of the members", "error", err.Error())
+		return false, nil
+	}
+	recordAlarms(recorder, ec, alarms, members)
+	var noSpace []*etcdserverpb.AlarmMember
+	for _, a := range alarms {
+		if a.Alarm == etcdserverpb.AlarmType_NOSPACE {
+			noSpace = append(noSpace, a)
+		}
+	}
+	if len(noSpace) == 0 {
+		return false, nil
+	}
+	names := alarmedMemberNames(noSpace, members)
+
+	if m := ec.Spec.Maintenance; m == nil || !m.AutoRecoverNoSpace {
+		recorder.Eventf(ec, corev1.EventTypeWarning, "NoSpace",
+			"Members %s ran out of space, the cluster only serves reads and deletes until the NOSPACE alarm is disarmed", names)
+		return true, nil
+	}
+
+	logger.Info("[NOSPACE] compacting the keyspace", "members", names)
+	rev, err := etcdClient.CompactToLatest(eps)
+	if err != nil {
+		recorder.Eventf(ec, corev1.EventTypeWarning, "CompactionFailed", "Failed to compact the keyspace: %v", err)
+		return true, err
+	}
+	recorder.Eventf(ec, corev1.EventTypeNormal, "Compacted", "Compacted the keyspace to revision %d, as members %s ran out of space", rev, names)
+
+	for _, index := range leaderLast(sts, healthInfos) {
+		name := fmt.Sprintf("%s-%d", sts.Name, index)
+		logger.Info("[NOSPACE] defragmenting member", "member", name)
+		if err := etcdClient.Defragment(clientEndpointForOrdinalIndex(sts, index)); err != nil {
+			recorder.Eventf(ec, corev1.EventTypeWarning, "DefragFailed", "Failed to defragment member %s: %v", name, err)
+			return true, err
+		}
+		recorder.Eventf(ec, corev1.EventTypeNormal, "Defragmented", "Defragmented member %s, as members %s ran out of space", name, names)
+	}
+
+	for _, a := range noSpace {
+		if err := etcdClient.AlarmDisarm(eps, a); err != nil {
+			return true, fmt.Errorf("failed to disarm the NOSPACE alarm: %w", err)
+		}
+	}
+	recorder.Eventf(ec, corev1.EventTypeNormal, "NoSpaceAlarmDisarmed", "Disarmed the NOSPACE alarm of members %s", names)
+	return true, nil
+}
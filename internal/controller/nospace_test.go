@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"k8s.io/client-go/tools/record"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func TestAlarmedMemberNames(t *testing.T) {
+	members := &clientv3.MemberListResponse{Members: []*etcdserverpb.Member{
+		{ID: 0x1, Name: "test-etcd-0"},
+		{ID: 0x2, Name: "test-etcd-1"},
+		{ID: 0x3},
+	}}
+	alarms := []*etcdserverpb.AlarmMember{
+		{MemberID: 0x2, Alarm: etcdserverpb.AlarmType_NOSPACE},
+		{MemberID: 0x3, Alarm: etcdserverpb.AlarmType_NOSPACE},
+		{MemberID: 0xab, Alarm: etcdserverpb.AlarmType_NOSPACE},
+	}
+	assert.Equal(t, "test-etcd-1, 3, ab", alarmedMemberNames(alarms, members))
+}
+
+func TestRecordAlarms(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	members := &clientv3.MemberListResponse{Members: []*etcdserverpb.Member{
+		{ID: 0x1, Name: "test-etcd-0"},
+		{ID: 0x2, Name: "test-etcd-1"},
+	}}
+	recorder := record.NewFakeRecorder(10)
+
+	recordAlarms(recorder, ec, []*etcdserverpb.AlarmMember{
+		{MemberID: 0x1, Alarm: etcdserverpb.AlarmType_NOSPACE},
+		{MemberID: 0x2, Alarm: etcdserverpb.AlarmType_NONE},
+	}, members)
+	assert.Equal(t, []ecv1alpha1.MemberAlarm{{Member: "test-etcd-0", Alarm: "NOSPACE"}}, ec.Status.Alarms)
+	assert.Equal(t, "Warning AlarmRaised Member test-etcd-0 raised the NOSPACE alarm", <-recorder.Events)
+
+	// The alarms still raised aren't reported again.
+	recordAlarms(recorder, ec, []*etcdserverpb.AlarmMember{
+		{MemberID: 0x1, Alarm: etcdserverpb.AlarmType_NOSPACE},
+		{MemberID: 0x2, Alarm: etcdserverpb.AlarmType_CORRUPT},
+	}, members)
+	assert.Len(t, ec.Status.Alarms, 2)
+	assert.Equal(t, "Warning AlarmRaised Member test-etcd-1 raised the CORRUPT alarm", <-recorder.Events)
+	assert.Empty(t, recorder.Events)
+
+	recordAlarms(recorder, ec, nil, members)
+	assert.Empty(t, ec.Status.Alarms)
+	assert.Equal(t, "Normal AlarmCleared The NOSPACE alarm of member test-etcd-0 is cleared", <-recorder.Events)
+	assert.Equal(t, "Normal AlarmCleared The CORRUPT alarm of member test-etcd-1 is cleared", <-recorder.Events)
+}
+
+func TestLeaderLast(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	status := func(id, leader uint64) *clientv3.StatusResponse {
+		return &clientv3.StatusResponse{Header: &etcdserverpb.ResponseHeader{MemberId: id}, Leader: leader}
+	}
+	health := func(statuses ...*clientv3.StatusResponse) []etcdutils.EpHealth {
+		var infos []etcdutils.EpHealth
+		for i, s := range statuses {
+			infos = append(infos, etcdutils.EpHealth{Ep: clientEndpointForOrdinalIndex(sts, i), Status: s})
+		}
+		return infos
+	}
+
+	assert.Equal(t, []int{1, 2, 0}, leaderLast(sts, health(status(1, 1), status(2, 1), status(3, 1))))
+	assert.Equal(t, []int{0, 2, 1}, leaderLast(sts, health(status(1, 2), status(2, 2), status(3, 2))))
+	// Without a leader, or a status, the order is kept.
+	assert.Equal(t, []int{0, 1, 2}, leaderLast(sts, health(status(1, 0), nil)))
+}
+
+func TestReconcileNoSpaceAlarmWithoutMembers(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	recorder := record.NewFakeRecorder(10)
+
+	// The alarms aren't listed when the cluster doesn't respond.
+	noSpace, err := reconcileNoSpaceAlarm(logr.Discard(), recorder, ec, sts, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, noSpace)
+	assert.Empty(t, recorder.Events)
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// startMemberOperation records in the status of ec that the operator is
+// about to add or remove member, and writes it right away along with the
+// other pending changes of the status. It must succeed before the first step
+// of the change is taken, so an interrupted change is always on record.
+func startMemberOperation(ctx context.Context, status *statusPatcher, ec *ecv1alpha1.EtcdCluster, opType, member string) error {
+	ec.Status.InProgressOperation = &ecv1alpha1.MemberOperation{
+		Type:      opType,
+		Member:    member,
+		StartTime: metav1.Now(),
+	}
+	return status.patch(ctx, ec)
+}
+
+// finishMemberOperation clears the operation recorded in the status of ec,
+// once the membership of the cluster matches its StatefulSet again.
+func finishMemberOperation(ec *ecv1alpha1.EtcdCluster) {
+	ec.Status.InProgressOperation = nil
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestMemberOperation(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := newPlanTestCluster(3, "v3.5.21")
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).WithStatusSubresource(ec).Build()
+
+	// The operation is written right away.
+	assert.NoError(t, startMemberOperation(ctx, newStatusPatcher(fakeClient, ec), ec, actionScaleOut, "test-etcd-3"))
+	stored := &ecv1alpha1.EtcdCluster{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(ec), stored))
+	assert.NotNil(t, stored.Status.InProgressOperation)
+	assert.Equal(t, actionScaleOut, stored.Status.InProgressOperation.Type)
+	assert.Equal(t, "test-etcd-3", stored.Status.InProgressOperation.Member)
+	assert.False(t, stored.Status.InProgressOperation.StartTime.IsZero())
+
+	// The next leader picks up the operation from the stored status.
+	finishMemberOperation(stored)
+	assert.Nil(t, stored.Status.InProgressOperation)
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// applyOverrides patches the spec of ec, in memory, with the
+// EtcdClusterOverrides of its namespace that select it.
+func applyOverrides(ctx context.Context, c client.Client, ec *ecv1alpha1.EtcdCluster) error {
+	overrides := &ecv1alpha1.EtcdClusterOverrideList{}
+	if err := c.List(ctx, overrides, client.InNamespace(ec.Namespace)); err != nil {
+		return fmt.Errorf("failed to list EtcdClusterOverrides: %w", err)
+	}
+	if len(overrides.Items) == 0 {
+		return nil
+	}
+
+	applied, err := ecv1alpha1.ApplyEtcdClusterOverrides(ec, overrides.Items)
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		log.FromContext(ctx).Info("Applied EtcdClusterOverrides", "overrides", applied)
+	}
+	return nil
+}
+
+// clustersForOverride returns the reconcile requests of the EtcdClusters
+// selected by the EtcdClusterOverride obj, so they pick up its changes.
+func (r *EtcdClusterReconciler) clustersForOverride(ctx context.Context, obj client.Object) []reconcile.Request {
+	override, ok := obj.(*ecv1alpha1.EtcdClusterOverride)
+	if !ok {
+		return nil
+	}
+
+	selector := labels.Everything()
+	if override.Spec.ClusterSelector != nil {
+		var err error
+		selector, err = metav1.LabelSelectorAsSelector(override.Spec.ClusterSelector)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "Invalid clusterSelector", "override", override.Name)
+			return nil
+		}
+	}
+
+	clusters := &ecv1alpha1.EtcdClusterList{}
+	if err := r.List(ctx, clusters, client.InNamespace(override.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list the EtcdClusters selected by the override", "override", override.Name)
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(clusters.Items))
+	for _, ec := range clusters.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ec)})
+	}
+	return requests
+}
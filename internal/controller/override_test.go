@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func newOverride(namespace, name string, priority int32, selector map[string]string, patch string) *ecv1alpha1.EtcdClusterOverride {
+	o := &ecv1alpha1.EtcdClusterOverride{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: ecv1alpha1.EtcdClusterOverrideSpec{
+			Priority: priority,
+			Patch:    runtime.RawExtension{Raw: []byte(patch)},
+		},
+	}
+	if selector != nil {
+		o.Spec.ClusterSelector = &metav1.LabelSelector{MatchLabels: selector}
+	}
+	return o
+}
+
+func TestApplyOverrides(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newOverride("staging", "small", 0, nil, `{"size":1,"storageSpec":{"volumeSizeRequest":"1Gi"}}`),
+		newOverride("staging", "pinned", 10, map[string]string{"tier": "critical"}, `{"size":3,"version":"v3.5.20"}`),
+		newOverride("prod", "other-namespace", 0, nil, `{"size":7}`),
+	).Build()
+
+	newCluster := func(lbls map[string]string) *ecv1alpha1.EtcdCluster {
+		return &ecv1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "staging", Labels: lbls},
+			Spec: ecv1alpha1.EtcdClusterSpec{
+				Size:        5,
+				Version:     "v3.5.21",
+				StorageSpec: &ecv1alpha1.StorageSpec{StorageClassName: "fast", VolumeSizeRequest: resource.MustParse("8Gi")},
+			},
+		}
+	}
+
+	t.Run("patches the selected clusters", func(t *testing.T) {
+		ec := newCluster(nil)
+		assert.NoError(t, applyOverrides(ctx, fakeClient, ec))
+		assert.Equal(t, 1, ec.Spec.Size)
+		assert.Equal(t, "v3.5.21", ec.Spec.Version)
+		assert.Equal(t, "fast", ec.Spec.StorageSpec.StorageClassName)
+		assert.True(t, ec.Spec.StorageSpec.VolumeSizeRequest.Equal(resource.MustParse("1Gi")))
+	})
+
+	t.Run("higher priorities win", func(t *testing.T) {
+		ec := newCluster(map[string]string{"tier": "critical"})
+		assert.NoError(t, applyOverrides(ctx, fakeClient, ec))
+		assert.Equal(t, 3, ec.Spec.Size)
+		assert.Equal(t, "v3.5.20", ec.Spec.Version)
+	})
+}
+
+func TestClustersForOverride(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	newCluster := func(namespace, name string, lbls map[string]string) *ecv1alpha1.EtcdCluster {
+		return &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: lbls}}
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newCluster("staging", "critical", map[string]string{"tier": "critical"}),
+		newCluster("staging", "regular", nil),
+		newCluster("prod", "critical", map[string]string{"tier": "critical"}),
+	).Build()
+	r := &EtcdClusterReconciler{Client: fakeClient, Scheme: scheme}
+
+	requests := r.clustersForOverride(context.Background(), newOverride("staging", "all", 0, nil, `{}`))
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "staging", Name: "critical"}},
+		{NamespacedName: types.NamespacedName{Namespace: "staging", Name: "regular"}},
+	}, requests)
+
+	requests = r.clustersForOverride(context.Background(), newOverride("staging", "critical", 0, map[string]string{"tier": "critical"}, `{}`))
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "staging", Name: "critical"}},
+	}, requests)
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+const (
+	actionCreateStatefulSet = "CreateStatefulSet"
+	actionScaleOut          = "ScaleOut"
+	actionScaleIn           = "ScaleIn"
+	actionRollingRestart    = "RollingRestart"
+	actionUpgrade           = "Upgrade"
+	actionReplaceMember     = "ReplaceMember"
+	actionRecoverQuorum     = "RecoverQuorum"
+	actionAdopt             = "Adopt"
+)
+
+// isPaused reports whether the reconciliation of obj is paused with the
+// PausedAnnotation. Every controller of the operator must honor it.
+func isPaused(obj metav1.Object) bool {
+	return obj.GetAnnotations()[ecv1alpha1.PausedAnnotation] == "true"
+}
+
+// isDryRun reports whether the operator should only plan, and not apply,
+// the changes for the EtcdCluster.
+func isDryRun(ec *ecv1alpha1.EtcdCluster) bool {
+	return ec.Annotations[ecv1alpha1.DryRunAnnotation] == "true"
+}
+
+// planActions returns the actions needed to move the members run by sts
+// towards the spec of ec. sts is nil when the StatefulSet doesn't exist yet.
+func planActions(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) ([]ecv1alpha1.PlannedAction, error) {
+	var plan []ecv1alpha1.PlannedAction
+	var current int32
+
+	// Nothing is planned until the StatefulSet to adopt exists.
+	if sts == nil && ec.Spec.Adoption != nil {
+		return nil, nil
+	}
+
+	if adopting(ec, sts) {
+		// The changes of the adopted members are only planned once they are
+		// adopted.
+		current = ptr.Deref(sts.Spec.Replicas, 0)
+		plan = append(plan, ecv1alpha1.PlannedAction{
+			Type:        actionAdopt,
+			Description: fmt.Sprintf("adopt StatefulSet %s/%s and its %d member(s), then move them to the pod template of the operator one at a time", ec.Namespace, ec.Name, current),
+			Reason:      "spec.adoption is set and the StatefulSet isn't managed by the operator",
+		})
+	} else if sts == nil {
+		plan = append(plan, ecv1alpha1.PlannedAction{
+			Type:        actionCreateStatefulSet,
+			Description: fmt.Sprintf("create StatefulSet %s/%s", ec.Namespace, ec.Name),
+			Reason:      "the StatefulSet doesn't exist",
+		})
+	} else {
+		current = ptr.Deref(sts.Spec.Replicas, 0)
+		if recovery := ec.Spec.QuorumRecovery; recovery != nil && !recoveringQuorum(ec) &&
+			meta.IsStatusConditionTrue(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionQuorumLost) {
+			reason := "the members lost their quorum"
+			if !isQuorumRecoveryConfirmed(ec) {
+				reason += fmt.Sprintf(", waiting for the %s annotation to confirm the recovery", ecv1alpha1.ConfirmQuorumRecoveryAnnotation)
+			}
+			plan = append(plan, ecv1alpha1.PlannedAction{
+				Type:        actionRecoverQuorum,
+				Description: fmt.Sprintf("restart the cluster from a single member, with the data of the %s source", recovery.Source),
+				Reason:      reason,
+			})
+		}
+		if running := statefulSetVersion(sts); running != ec.Spec.Version && current > 0 {
+			reason := "spec.version differs from the version of the members"
+			if problem, _ := etcdutils.CheckUpgradePath(running, ec.Spec.Version); problem != "" {
+				reason = "unsupported, the members keep running " + running + ": " + problem
+			}
+			plan = append(plan, ecv1alpha1.PlannedAction{
+				Type:        actionUpgrade,
+				Description: fmt.Sprintf("upgrade %d member(s) one at a time, from %s to %s", current, running, ec.Spec.Version),
+				Reason:      reason,
+			})
+		}
+		reasons, err := restartReasons(ec, sts)
+		if err != nil {
+			return nil, err
+		}
+		if len(reasons) > 0 && current > 0 {
+			plan = append(plan, ecv1alpha1.PlannedAction{
+				Type:        actionRollingRestart,
+				Description: fmt.Sprintf("rolling restart of %d member(s)", current),
+				Reason:      strings.Join(reasons, "; "),
+			})
+		}
+	}
+
+	desired := int32(ec.Spec.Size)
+	switch {
+	case desired > current:
+		plan = append(plan, ecv1alpha1.PlannedAction{
+			Type:        actionScaleOut,
+			Description: fmt.Sprintf("add %d member(s) one learner at a time, from %d to %d", desired-current, current, desired),
+			Reason:      "spec.size is larger than the number of members",
+		})
+	case desired < current:
+		plan = append(plan, ecv1alpha1.PlannedAction{
+			Type:        actionScaleIn,
+			Description: fmt.Sprintf("remove %d member(s) one at a time, from %d to %d", current-desired, current, desired),
+			Reason:      "spec.size is smaller than the number of members",
+		})
+	}
+
+	return plan, nil
+}
+
+// restartReasons returns why the pods of sts have to be replaced to match
+// the spec of ec, or nothing if the running pod template is up to date. The
+// changes of version are planned as upgrades instead.
+func restartReasons(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) ([]string, error) {
+	desiredSpec, err := newStatefulSetSpec(ec, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	desired := findContainer(desiredSpec.Template.Spec.Containers, "etcd")
+	current := findContainer(sts.Spec.Template.Spec.Containers, "etcd")
+	if current == nil {
+		return []string{"the etcd container is missing from the pod template"}, nil
+	}
+
+	var reasons []string
+	if certificatesRenewed(ec, sts) {
+		reasons = append(reasons, "certificates renewed")
+	}
+	if !equality.Semantic.DeepEqual(desired.Args, current.Args) {
+		reasons = append(reasons, "etcd arguments changed")
+	}
+	if !equality.Semantic.DeepEqual(desired.Env, current.Env) || !equality.Semantic.DeepEqual(desired.EnvFrom, current.EnvFrom) {
+		reasons = append(reasons, "environment changed")
+	}
+	if !equality.Semantic.DeepEqual(desired.Ports, current.Ports) {
+		reasons = append(reasons, "container ports changed")
+	}
+	if !equality.Semantic.DeepEqual(desired.LivenessProbe, current.LivenessProbe) ||
+		!equality.Semantic.DeepEqual(desired.ReadinessProbe, current.ReadinessProbe) {
+		reasons = append(reasons, "probes changed")
+	}
+	if !equality.Semantic.DeepEqual(desired.Resources, current.Resources) {
+		reasons = append(reasons, "resources changed")
+	}
+	desiredPod, currentPod := desiredSpec.Template.Spec, sts.Spec.Template.Spec
+	if !equality.Semantic.DeepEqual(desiredPod.Affinity, currentPod.Affinity) ||
+		!equality.Semantic.DeepEqual(desiredPod.Tolerations, currentPod.Tolerations) ||
+		!equality.Semantic.DeepEqual(desiredPod.NodeSelector, currentPod.NodeSelector) ||
+		desiredPod.PriorityClassName != currentPod.PriorityClassName ||
+		!equality.Semantic.DeepEqual(desiredPod.TopologySpreadConstraints, currentPod.TopologySpreadConstraints) {
+		reasons = append(reasons, "scheduling changed")
+	}
+	desiredCheck := findContainer(desiredPod.InitContainers, dataCheckContainerName)
+	currentCheck := findContainer(currentPod.InitContainers, dataCheckContainerName)
+	if (desiredCheck == nil) != (currentCheck == nil) || (desiredCheck != nil && desiredCheck.Image != currentCheck.Image) {
+		reasons = append(reasons, "data check changed")
+	}
+	if !equality.Semantic.DeepEqual(desired.Lifecycle, current.Lifecycle) ||
+		terminationGracePeriod(desiredPod) != terminationGracePeriod(currentPod) {
+		reasons = append(reasons, "graceful shutdown changed")
+	}
+	return reasons, nil
+}
+
+// terminationGracePeriod returns the termination grace period of the pods of
+// podSpec, which the API server defaults.
+func terminationGracePeriod(podSpec corev1.PodSpec) int64 {
+	return ptr.Deref(podSpec.TerminationGracePeriodSeconds, int64(defaultTerminationGracePeriod.Seconds()))
+}
+
+func findContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+// recordPlannedActions computes the actions pending for ec and stores them in
+// its status.
+func recordPlannedActions(ctx context.Context, c client.Client, ec *ecv1alpha1.EtcdCluster) error {
+	sts, err := getStatefulSet(ctx, c, ec.Name, ec.Namespace)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return err
+		}
+		sts = nil
+	}
+
+	plan, err := planActions(ec, sts)
+	if err != nil {
+		return err
+	}
+	ec.Status.PlannedActions = plan
+	return nil
+}
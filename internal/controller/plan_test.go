@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func newPlanTestCluster(size int, version string) *ecv1alpha1.EtcdCluster {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Size: size, Version: version},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	return ec
+}
+
+func newPlanTestStatefulSet(t *testing.T, ec *ecv1alpha1.EtcdCluster, replicas int32) *appsv1.StatefulSet {
+	spec, err := newStatefulSetSpec(ec, replicas, nil)
+	assert.NoError(t, err)
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: ec.Namespace},
+		Spec:       spec,
+	}
+}
+
+func actionTypes(plan []ecv1alpha1.PlannedAction) []string {
+	var types []string
+	for _, a := range plan {
+		types = append(types, a.Type)
+	}
+	return types
+}
+
+func TestPlanActions(t *testing.T) {
+	running := newPlanTestCluster(3, "v3.5.21")
+	adopted := newPlanTestCluster(5, "v3.5.22")
+	adopted.Spec.Adoption = &ecv1alpha1.Adoption{Endpoints: []string{"http://test-etcd-0.test-etcd:2379"}}
+
+	tests := []struct {
+		name          string
+		ec            *ecv1alpha1.EtcdCluster
+		sts           *appsv1.StatefulSet
+		expectedTypes []string
+		expectedInfo  string
+	}{
+		{
+			name:          "new cluster",
+			ec:            newPlanTestCluster(3, "v3.5.21"),
+			expectedTypes: []string{actionCreateStatefulSet, actionScaleOut},
+			expectedInfo:  "from 0 to 3",
+		},
+		{
+			name: "up to date cluster",
+			ec:   newPlanTestCluster(3, "v3.5.21"),
+			sts:  newPlanTestStatefulSet(t, running, 3),
+		},
+		{
+			name:          "scale out",
+			ec:            newPlanTestCluster(5, "v3.5.21"),
+			sts:           newPlanTestStatefulSet(t, running, 3),
+			expectedTypes: []string{actionScaleOut},
+			expectedInfo:  "add 2 member(s)",
+		},
+		{
+			name:          "scale in",
+			ec:            newPlanTestCluster(1, "v3.5.21"),
+			sts:           newPlanTestStatefulSet(t, running, 3),
+			expectedTypes: []string{actionScaleIn},
+			expectedInfo:  "remove 2 member(s)",
+		},
+		{
+			name:          "version change",
+			ec:            newPlanTestCluster(3, "v3.5.22"),
+			sts:           newPlanTestStatefulSet(t, running, 3),
+			expectedTypes: []string{actionUpgrade},
+			expectedInfo:  "upgrade 3 member(s) one at a time, from v3.5.21 to v3.5.22",
+		},
+		{
+			name:          "unsupported version change",
+			ec:            newPlanTestCluster(3, "v3.7.0"),
+			sts:           newPlanTestStatefulSet(t, running, 3),
+			expectedTypes: []string{actionUpgrade},
+			expectedInfo:  "unsupported, the members keep running v3.5.21",
+		},
+		{
+			name:          "version change and scale out",
+			ec:            newPlanTestCluster(5, "v3.6.0"),
+			sts:           newPlanTestStatefulSet(t, running, 3),
+			expectedTypes: []string{actionUpgrade, actionScaleOut},
+			expectedInfo:  "add 2 member(s)",
+		},
+		{
+			name: "missing StatefulSet to adopt",
+			ec:   adopted,
+		},
+		{
+			// The upgrade is only planned once the members are adopted.
+			name:          "adoption",
+			ec:            adopted,
+			sts:           newPlanTestStatefulSet(t, running, 3),
+			expectedTypes: []string{actionAdopt, actionScaleOut},
+			expectedInfo:  "add 2 member(s)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planActions(tt.ec, tt.sts)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedTypes, actionTypes(plan))
+			if tt.expectedInfo != "" {
+				last := plan[len(plan)-1]
+				assert.Contains(t, last.Description+" "+last.Reason, tt.expectedInfo)
+			}
+		})
+	}
+}
+
+func TestPlanActionsEtcdOptionsChanged(t *testing.T) {
+	running := newPlanTestCluster(3, "v3.5.21")
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.EtcdOptions = []string{"--snapshot-count=5000"}
+
+	plan, err := planActions(ec, newPlanTestStatefulSet(t, running, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{actionRollingRestart}, actionTypes(plan))
+	assert.Equal(t, "rolling restart of 3 member(s)", plan[0].Description)
+	assert.Equal(t, "etcd arguments changed", plan[0].Reason)
+}
+
+func TestPlanActionsSchedulingChanged(t *testing.T) {
+	running := newPlanTestCluster(3, "v3.5.21")
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.PodTemplate.Scheduling.NodeSelector = map[string]string{"disktype": "ssd"}
+
+	plan, err := planActions(ec, newPlanTestStatefulSet(t, running, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{actionRollingRestart}, actionTypes(plan))
+	assert.Equal(t, "scheduling changed", plan[0].Reason)
+}
+
+func TestPlanActionsDataCheckChanged(t *testing.T) {
+	running := newPlanTestCluster(3, "v3.5.21")
+	running.Spec.EphemeralStorage = &ecv1alpha1.EphemeralStorage{}
+	ec := running.DeepCopy()
+	ec.Spec.PodTemplate.DataCheck = &ecv1alpha1.DataCheck{Image: "etcd-operator:v0.1.0"}
+
+	plan, err := planActions(ec, newPlanTestStatefulSet(t, running, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{actionRollingRestart}, actionTypes(plan))
+	assert.Equal(t, "data check changed", plan[0].Reason)
+
+	plan, err = planActions(ec, newPlanTestStatefulSet(t, ec, 3))
+	assert.NoError(t, err)
+	assert.Empty(t, plan)
+}
+
+func TestPlanActionsResourcesChanged(t *testing.T) {
+	running := newPlanTestCluster(3, "v3.5.21")
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.PodTemplate.Resources = &corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+	}
+
+	plan, err := planActions(ec, newPlanTestStatefulSet(t, running, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{actionRollingRestart}, actionTypes(plan))
+	assert.Equal(t, "resources changed", plan[0].Reason)
+}
+
+func TestPlanActionsQuorumLost(t *testing.T) {
+	running := newPlanTestCluster(3, "v3.5.21")
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.QuorumRecovery = &ecv1alpha1.QuorumRecovery{Source: ecv1alpha1.QuorumRecoverySourceBackup}
+	setQuorumLostCondition(ec, newPlanTestStatefulSet(t, running, 3), nil, time.Now())
+
+	plan, err := planActions(ec, newPlanTestStatefulSet(t, running, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{actionRecoverQuorum}, actionTypes(plan))
+	assert.Equal(t, "restart the cluster from a single member, with the data of the Backup source", plan[0].Description)
+	assert.Contains(t, plan[0].Reason, "waiting for the operator.etcd.io/confirm-quorum-recovery annotation")
+
+	ec.Annotations = map[string]string{ecv1alpha1.ConfirmQuorumRecoveryAnnotation: ec.Name}
+	plan, err = planActions(ec, newPlanTestStatefulSet(t, running, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, "the members lost their quorum", plan[0].Reason)
+}
+
+func TestRecordPlannedActions(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Annotations = map[string]string{ecv1alpha1.DryRunAnnotation: "true"}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).Build()
+
+	assert.True(t, isDryRun(ec))
+	assert.NoError(t, recordPlannedActions(ctx, fakeClient, ec))
+	assert.Equal(t, []string{actionCreateStatefulSet, actionScaleOut}, actionTypes(ec.Status.PlannedActions))
+
+	// The dry run must not have created anything.
+	err := fakeClient.Get(ctx, client.ObjectKeyFromObject(ec), &appsv1.StatefulSet{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// proxyTier describes pods of etcd proxying the clients to the members of an
+// EtcdCluster, such as the gRPC proxy or the gateway, run by a Deployment and
+// reached through a Service of the same name.
+type proxyTier struct {
+	// name is the name of the Deployment and of the Service.
+	name string
+	// component labels the Deployment, its pods and the Service. The labels
+	// differ from those of the members, which the headless Service selects.
+	component string
+	// args are the arguments of etcd.
+	args      []string
+	port      int32
+	replicas  *int32
+	resources *corev1.ResourceRequirements
+	// certificates are the TLS certificates of the cluster mounted in the
+	// pods, under tlsDir.
+	certificates []string
+}
+
+// proxyLabels returns the labels of the proxy tier t of ec.
+func proxyLabels(ec *ecv1alpha1.EtcdCluster, t *proxyTier) map[string]string {
+	return map[string]string{
+		"app":       ec.Name,
+		"component": t.component,
+	}
+}
+
+// newProxyDeployment returns the Deployment of the proxy tier t of ec.
+func newProxyDeployment(ec *ecv1alpha1.EtcdCluster, t *proxyTier) *appsv1.Deployment {
+	labels := proxyLabels(ec, t)
+	container := corev1.Container{
+		Name:    t.component,
+		Command: []string{"/usr/local/bin/etcd"},
+		Args:    t.args,
+		Image:   fmt.Sprintf("gcr.io/etcd-development/etcd:%s", ec.Spec.Version),
+		Ports: []corev1.ContainerPort{
+			{Name: "client", ContainerPort: t.port, Protocol: corev1.ProtocolTCP},
+		},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(t.port)},
+			},
+			PeriodSeconds: 5,
+		},
+	}
+	if t.resources != nil {
+		container.Resources = *t.resources
+	}
+	podSpec := corev1.PodSpec{}
+	for _, certificate := range t.certificates {
+		name := certificate + "-tls"
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: tlsSecretName(ec, certificate)}},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name: name, MountPath: path.Join(tlsDir, certificate), ReadOnly: true,
+		})
+	}
+	podSpec.Containers = []corev1.Container{container}
+
+	return &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       "Deployment",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      t.name,
+			Namespace: ec.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: t.replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					// The proxies restart with the members, when the
+					// certificates are renewed.
+					Annotations: certificatesAnnotations(ec),
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+// newProxyService returns the Service of the proxy tier t of ec.
+func newProxyService(ec *ecv1alpha1.EtcdCluster, t *proxyTier) *corev1.Service {
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      t.name,
+			Namespace: ec.Namespace,
+			Labels:    proxyLabels(ec, t),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: proxyLabels(ec, t),
+			Ports: []corev1.ServicePort{
+				{Name: "client", Port: t.port, TargetPort: intstr.FromInt32(t.port), Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+}
+
+// reconcileProxyTier applies the Deployment and the Service of the proxy tier
+// t of ec, or deletes those named name when t is nil, once the proxies are
+// removed from the spec.
+func reconcileProxyTier(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, name string, t *proxyTier) error {
+	if t != nil {
+		for _, obj := range []client.Object{newProxyDeployment(ec, t), newProxyService(ec, t)} {
+			if err := setWorkloadOwner(ec, scheme, obj); err != nil {
+				return err
+			}
+			if err := applyOwnedObject(ctx, c, recorder, ec, obj); err != nil {
+				return fmt.Errorf("failed to apply %s: %w", t.name, err)
+			}
+		}
+		return nil
+	}
+
+	key := client.ObjectKey{Name: name, Namespace: ec.Namespace}
+	for _, obj := range []client.Object{&appsv1.Deployment{}, &corev1.Service{}} {
+		if err := c.Get(ctx, key, obj); err != nil {
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if !isControlledBy(obj, ec) {
+			continue
+		}
+		if err := c.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
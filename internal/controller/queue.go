@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/priorityqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// priorityDegraded is the priority of the reconciles of Degraded
+// EtcdClusters, which may be at risk of losing quorum. It is higher than the
+// default priority of 0, and than the low priority used for resyncs.
+const priorityDegraded = 100
+
+// clusterPriorityQueue is a priority queue that raises the priority of the
+// reconciles of Degraded EtcdClusters, so they aren't held back by routine
+// reconciles of healthy clusters.
+type clusterPriorityQueue struct {
+	priorityqueue.PriorityQueue[reconcile.Request]
+	priority func(reconcile.Request) int
+	// tracker, if set, exports the metrics of the queue.
+	tracker *queueTracker
+}
+
+// newClusterPriorityQueue returns a constructor of clusterPriorityQueues,
+// which looks up the EtcdClusters with c, meant for controller.Options.
+func newClusterPriorityQueue(c client.Reader, logger logr.Logger) func(string, workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+	return func(name string, rateLimiter workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+		return &clusterPriorityQueue{
+			PriorityQueue: priorityqueue.New(name, func(o *priorityqueue.Opts[reconcile.Request]) {
+				o.Log = logger.WithValues("controller", name)
+				o.RateLimiter = rateLimiter
+			}),
+			priority: func(req reconcile.Request) int {
+				return clusterPriority(context.Background(), c, req)
+			},
+		}
+	}
+}
+
+// clusterPriority returns the priority of the reconcile of the EtcdCluster
+// req refers to, based on its last known status.
+func clusterPriority(ctx context.Context, c client.Reader, req reconcile.Request) int {
+	ec := &ecv1alpha1.EtcdCluster{}
+	if err := c.Get(ctx, req.NamespacedName, ec); err != nil {
+		return 0
+	}
+	if meta.IsStatusConditionTrue(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionDegraded) {
+		return priorityDegraded
+	}
+	return 0
+}
+
+func (q *clusterPriorityQueue) AddWithOpts(o priorityqueue.AddOpts, items ...reconcile.Request) {
+	for _, item := range items {
+		opts := o
+		opts.Priority = max(opts.Priority, q.priority(item))
+		if !opts.RateLimited {
+			// The retries are tracked by the rate limiter.
+			q.tracker.added(item, opts.After)
+		}
+		q.PriorityQueue.AddWithOpts(opts, item)
+	}
+}
+
+func (q *clusterPriorityQueue) Add(item reconcile.Request) {
+	q.AddWithOpts(priorityqueue.AddOpts{}, item)
+}
+
+func (q *clusterPriorityQueue) AddAfter(item reconcile.Request, duration time.Duration) {
+	q.AddWithOpts(priorityqueue.AddOpts{After: duration}, item)
+}
+
+func (q *clusterPriorityQueue) AddRateLimited(item reconcile.Request) {
+	q.AddWithOpts(priorityqueue.AddOpts{RateLimited: true}, item)
+}
+
+func (q *clusterPriorityQueue) GetWithPriority() (reconcile.Request, int, bool) {
+	item, priority, shutdown := q.PriorityQueue.GetWithPriority()
+	q.tracker.picked(item)
+	return item, priority, shutdown
+}
+
+func (q *clusterPriorityQueue) Get() (reconcile.Request, bool) {
+	item, _, shutdown := q.GetWithPriority()
+	return item, shutdown
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/priorityqueue"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestClusterPriorityQueue(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	healthy := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "healthy", Namespace: "default"}}
+	degraded := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "degraded", Namespace: "default"}}
+	meta.SetStatusCondition(&degraded.Status.Conditions, metav1.Condition{
+		Type:   ecv1alpha1.EtcdClusterConditionDegraded,
+		Status: metav1.ConditionTrue,
+		Reason: reasonHealthCheckFailed,
+	})
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(healthy, degraded).Build()
+
+	q := newClusterPriorityQueue(fakeClient, logr.Discard())("test", nil)
+	defer q.ShutDown()
+	pq, ok := q.(priorityqueue.PriorityQueue[reconcile.Request])
+	assert.True(t, ok)
+
+	healthyReq := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "healthy"}}
+	degradedReq := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "degraded"}}
+	missingReq := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "missing"}}
+
+	q.Add(healthyReq)
+	q.Add(missingReq)
+	// The degraded cluster goes first, even when enqueued as a resync.
+	pq.AddWithOpts(priorityqueue.AddOpts{Priority: handler.LowPriority}, degradedReq)
+
+	item, priority, _ := pq.GetWithPriority()
+	assert.Equal(t, degradedReq, item)
+	assert.Equal(t, priorityDegraded, priority)
+
+	_, priority, _ = pq.GetWithPriority()
+	assert.Equal(t, 0, priority)
+	_, priority, _ = pq.GetWithPriority()
+	assert.Equal(t, 0, priority)
+}
@@ -0,0 +1,498 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+	"go.etcd.io/etcd-operator/internal/features"
+)
+
+const (
+	// busyboxImage copies the database of the member the quorum is
+	// recovered from, and wipes the data directories of the members, in the
+	// quorum recovery Jobs.
+	busyboxImage = "busybox:1.37"
+
+	// maxClusterSize is the largest size of an EtcdCluster, see
+	// ValidateEtcdCluster.
+	maxClusterSize = 7
+
+	// quorumSourceDir is where the volume of the member the quorum is
+	// recovered from is mounted in the quorum recovery Jobs, when it isn't
+	// the volume of the first member.
+	quorumSourceDir = "/source"
+
+	// quorumWALDir is where the quorum recovery Jobs replaying the
+	// write-ahead log keep a copy of the member directory of the source,
+	// with its log and its raft snapshots but without its database.
+	quorumWALDir = restoreSnapshotDir + "/member"
+
+	quorumPrepareScript = `set -e
+if [ -n "$SOURCE" ]; then cp "$SOURCE" /snapshot/snapshot.db; fi
+if [ -n "$WAL_SOURCE" ]; then
+  mkdir -p /snapshot/member/snap
+  cp -r "$WAL_SOURCE/wal" /snapshot/member/wal
+  for f in "$WAL_SOURCE"/snap/*.snap; do if [ -e "$f" ]; then cp "$f" /snapshot/member/snap/; fi; done
+fi
+rm -rf $DATA_DIRS
+`
+)
+
+// isQuorumRecoveryConfirmed reports whether the recovery of the quorum of ec
+// was confirmed with the ConfirmQuorumRecoveryAnnotation.
+func isQuorumRecoveryConfirmed(ec *ecv1alpha1.EtcdCluster) bool {
+	return ec.Annotations[ecv1alpha1.ConfirmQuorumRecoveryAnnotation] == ec.Name
+}
+
+// recoveringQuorum reports whether the operator is recovering the quorum of
+// ec.
+func recoveringQuorum(ec *ecv1alpha1.EtcdCluster) bool {
+	op := ec.Status.InProgressOperation
+	return op != nil && op.Type == actionRecoverQuorum
+}
+
+func hasLeader(h etcdutils.EpHealth) bool {
+	return h.Status != nil && h.Status.Leader != 0
+}
+
+// leaderlessGracePeriod returns how long most of the members of ec may
+// respond without a leader before their quorum is deemed lost: a few
+// election timeouts, in which they normally elect a new one.
+func leaderlessGracePeriod(ec *ecv1alpha1.EtcdCluster) time.Duration {
+	election := time.Second
+	if t := ec.Spec.Tuning; t != nil && t.ElectionTimeout != nil {
+		election = t.ElectionTimeout.Duration
+	}
+	return max(time.Minute, 5*election)
+}
+
+// setQuorumLostCondition records in the QuorumLost condition of ec whether
+// its members, run by sts, lost their quorum, from the health check of all of
+// them, healthInfos, at now. It returns whether the quorum is lost. A single
+// member has no quorum to lose, it is only down. The members without a
+// leader lost their quorum when most of them don't respond, or once they
+// went without one for leaderlessGracePeriod; until then, the condition is
+// Unknown, as they are likely electing one.
+func setQuorumLostCondition(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, healthInfos []etcdutils.EpHealth, now time.Time) bool {
+	replicas := int(ptr.Deref(sts.Spec.Replicas, 0))
+	condition := metav1.Condition{
+		Type:               ecv1alpha1.EtcdClusterConditionQuorumLost,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: ec.Generation,
+		Reason:             reasonLeaderElected,
+		Message:            "The members have a leader",
+		LastTransitionTime: metav1.NewTime(now),
+	}
+	lost := false
+	switch {
+	case replicas < 2:
+		condition.Reason = reasonSingleMember
+		condition.Message = "A single member has no quorum to lose"
+	case !slices.ContainsFunc(healthInfos, hasLeader):
+		responding := 0
+		for _, h := range healthInfos {
+			if h.Status != nil {
+				responding++
+			}
+		}
+		// A lost quorum stays lost until a leader is elected.
+		since := now
+		if previous := meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionQuorumLost); previous != nil {
+			switch previous.Status {
+			case metav1.ConditionUnknown:
+				since = previous.LastTransitionTime.Time
+			case metav1.ConditionTrue:
+				since = time.Time{}
+			}
+		}
+		if responding > replicas/2 && now.Sub(since) < leaderlessGracePeriod(ec) {
+			condition.Status = metav1.ConditionUnknown
+			condition.Reason = reasonElectingLeader
+			condition.Message = fmt.Sprintf("%d of %d members respond, none of them has a leader since %s",
+				responding, replicas, since.UTC().Format(time.RFC3339))
+			break
+		}
+		lost = true
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonNoLeader
+		condition.Message = fmt.Sprintf("%d of %d members respond, none of them has a leader", responding, replicas)
+	}
+
+	meta.SetStatusCondition(&ec.Status.Conditions, condition)
+	return lost
+}
+
+// mostRecentMember returns the ordinal of the member of sts with the most
+// recent raft index in healthInfos, the first one on a tie. It returns false
+// when none of the members responds.
+func mostRecentMember(sts *appsv1.StatefulSet, healthInfos []etcdutils.EpHealth) (int, bool) {
+	found := false
+	var index int
+	var raftIndex uint64
+	for i := range int(ptr.Deref(sts.Spec.Replicas, 0)) {
+		ep := clientEndpointForOrdinalIndex(sts, i)
+		idx := slices.IndexFunc(healthInfos, func(h etcdutils.EpHealth) bool { return h.Ep == ep })
+		if idx < 0 || healthInfos[idx].Status == nil {
+			continue
+		}
+		if status := healthInfos[idx].Status; !found || status.RaftIndex > raftIndex {
+			found, index, raftIndex = true, i, status.RaftIndex
+		}
+	}
+	return index, found
+}
+
+// latestBackup returns the latest completed EtcdBackup of ec, or nil if it
+// has none. The encrypted backups are skipped, the quorum recovery doesn't
+// decrypt their snapshots, along with the backups without a destination and
+// the ones whose snapshot failed its verification.
+func latestBackup(ctx context.Context, c client.Client, ec *ecv1alpha1.EtcdCluster) (*ecv1alpha1.EtcdBackup, error) {
+	backups := &ecv1alpha1.EtcdBackupList{}
+	if err := c.List(ctx, backups, client.InNamespace(ec.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list the backups of the cluster: %w", err)
+	}
+	var latest *ecv1alpha1.EtcdBackup
+	for i := range backups.Items {
+		backup := &backups.Items[i]
+		if backup.Spec.ClusterName != ec.Name || backup.Spec.Encryption != nil ||
+			backup.Status.Phase != ecv1alpha1.EtcdBackupPhaseCompleted || backup.Status.CompletionTime == nil {
+			continue
+		}
+		if _, ok := backupStorage(backup); !ok {
+			continue
+		}
+		if backup.Status.Verified != nil && !*backup.Status.Verified {
+			continue
+		}
+		if latest == nil || backup.Status.CompletionTime.After(latest.Status.CompletionTime.Time) {
+			latest = backup
+		}
+	}
+	return latest, nil
+}
+
+// reconcileQuorumLoss records whether the members of ec, run by sts, lost
+// their quorum, and starts its recovery once it is confirmed. members and
+// healthInfos are the result of the health check of the cluster. It returns
+// whether the recovery started, in which case it is carried out by
+// recoverQuorum from the next reconcile. A recovery isn't started again
+// while the previous one completes.
+func reconcileQuorumLoss(ctx context.Context, logger logr.Logger, c client.Client, recorder record.EventRecorder, status *statusPatcher,
+	ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, etcdClient *etcdutils.ClusterClient,
+	members *clientv3.MemberListResponse, healthInfos []etcdutils.EpHealth, now time.Time) (bool, error) {
+	if members == nil && ptr.Deref(sts.Spec.Replicas, 0) > 1 {
+		// The member list is a linearizable read, which fails without a
+		// quorum: check whether any member still has a leader.
+		var err error
+		if healthInfos, err = etcdClient.ClusterHealth(clientEndpointsFromStatefulsets(sts)); err != nil {
+			return false, err
+		}
+	}
+	if !setQuorumLostCondition(ec, sts, healthInfos, now) || recoveringQuorum(ec) {
+		return false, nil
+	}
+	return startQuorumRecovery(ctx, logger, c, recorder, status, ec, sts, healthInfos)
+}
+
+// startQuorumRecovery records the recovery of the quorum of ec as the
+// operation in progress, once it is confirmed, and consumes the
+// confirmation. healthInfos is the health check of the members of sts, the
+// member with the most recent data is picked from. It returns whether the
+// recovery started.
+func startQuorumRecovery(ctx context.Context, logger logr.Logger, c client.Client, recorder record.EventRecorder, status *statusPatcher,
+	ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, healthInfos []etcdutils.EpHealth) (bool, error) {
+	recovery := ec.Spec.QuorumRecovery
+	if recovery == nil {
+		recorder.Event(ec, corev1.EventTypeWarning, "QuorumLost",
+			"The members lost their quorum; bring enough of them back, or set spec.quorumRecovery to recover it")
+		return false, nil
+	}
+	if !features.Enabled(features.AutoRecovery) {
+		recorder.Eventf(ec, corev1.EventTypeWarning, "QuorumLost",
+			"The members lost their quorum; bring enough of them back, or enable the %s feature gate to recover it", features.AutoRecovery)
+		return false, nil
+	}
+	if !isQuorumRecoveryConfirmed(ec) {
+		recorder.Eventf(ec, corev1.EventTypeWarning, "QuorumLost",
+			"The members lost their quorum; annotate the EtcdCluster with %s=%s to recover it from the %s source, losing the writes it misses",
+			ecv1alpha1.ConfirmQuorumRecoveryAnnotation, ec.Name, recovery.Source)
+		return false, nil
+	}
+
+	// The first member is restarted with the data of the source. The log
+	// replayed over the backup is the one of the most recent member, or of
+	// the first one when none responds.
+	member := fmt.Sprintf("%s-0", ec.Name)
+	if recovery.ReplayWAL {
+		if index, ok := mostRecentMember(sts, healthInfos); ok {
+			member = fmt.Sprintf("%s-%d", ec.Name, index)
+		}
+	}
+	if recovery.Source == ecv1alpha1.QuorumRecoverySourceMember {
+		index, ok := mostRecentMember(sts, healthInfos)
+		if !ok {
+			recorder.Event(ec, corev1.EventTypeWarning, "QuorumRecoveryUnavailable",
+				"None of the members responds, the quorum can't be recovered from their data")
+			return false, nil
+		}
+		member = fmt.Sprintf("%s-%d", ec.Name, index)
+	}
+
+	if err := startMemberOperation(ctx, status, ec, actionRecoverQuorum, member); err != nil {
+		return false, err
+	}
+	// The confirmation only holds for this recovery.
+	if err := removeAnnotation(ctx, c, ec, ecv1alpha1.ConfirmQuorumRecoveryAnnotation); err != nil {
+		return false, err
+	}
+
+	logger.Info("[Recover quorum] recovery confirmed", "source", recovery.Source, "member", member)
+	recorder.Eventf(ec, corev1.EventTypeWarning, "RecoveringQuorum",
+		"Recovering the quorum from the %s source, restarting the cluster from member %s", recovery.Source, member)
+	return true, nil
+}
+
+// recoverQuorum carries out the recovery of the quorum of ec, recorded as the
+// operation in progress: it stops the members run by sts, restores the data
+// of the source to the volume of the first member with a Job, wipes the data
+// of the other members, and restarts the cluster from the first member. The
+// other members then join it empty, as learners, like after a scale out. c
+// is the client of the EtcdCluster, wc the one of its members. It returns
+// whether the recovery is in progress, in which case the other changes of
+// the cluster wait for it to complete. operatorImage, the image of the
+// operator, replays the write-ahead log over the backup, when the recovery
+// asks for it.
+func recoverQuorum(ctx context.Context, logger logr.Logger, c, wc client.Client, scheme *runtime.Scheme, recorder record.EventRecorder,
+	ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, operatorImage string) (bool, error) {
+	op := ec.Status.InProgressOperation
+	var source int
+	if _, err := fmt.Sscanf(op.Member, ec.Name+"-%d", &source); err != nil {
+		return true, fmt.Errorf("invalid member %s in the operation in progress: %w", op.Member, err)
+	}
+
+	job := &batchv1.Job{}
+	err := wc.Get(ctx, client.ObjectKey{Name: quorumRecoveryJobName(ec, op), Namespace: ec.Namespace}, job)
+	if k8serrors.IsNotFound(err) {
+		replayWAL := ec.Spec.QuorumRecovery != nil && ec.Spec.QuorumRecovery.ReplayWAL
+		if replayWAL && operatorImage == "" {
+			recorder.Event(ec, corev1.EventTypeWarning, "QuorumRecoveryUnavailable",
+				"The write-ahead log can't be replayed, the operator runs without --operator-image")
+			return true, nil
+		}
+		// The data of the members is only replaced once they are stopped.
+		if ptr.Deref(sts.Spec.Replicas, 0) > 0 {
+			logger.Info("[Recover quorum] stopping the members")
+			return true, applyStatefulSet(ctx, logger, ec, wc, 0, scheme)
+		}
+		if sts.Status.Replicas > 0 {
+			logger.Info("[Recover quorum] waiting for the members to stop")
+			return true, nil
+		}
+
+		var backup *ecv1alpha1.EtcdBackup
+		if ec.Spec.QuorumRecovery != nil && ec.Spec.QuorumRecovery.Source == ecv1alpha1.QuorumRecoverySourceBackup {
+			if backup, err = latestBackup(ctx, c, ec); err != nil {
+				return true, err
+			}
+			if backup == nil {
+				recorder.Event(ec, corev1.EventTypeWarning, "QuorumRecoveryUnavailable",
+					"The cluster has no completed EtcdBackup to recover the quorum from")
+				return true, nil
+			}
+		}
+		job = newQuorumRecoveryJob(ec, quorumRecoveryJobName(ec, op), source, backup, operatorImage)
+		if err := setWorkloadOwner(ec, scheme, job); err != nil {
+			return true, err
+		}
+		if err := wc.Create(ctx, job); client.IgnoreAlreadyExists(err) != nil {
+			return true, err
+		}
+		logger.Info("[Recover quorum] restoring the data of the first member", "job", job.Name)
+		return true, nil
+	}
+	if err != nil {
+		return true, err
+	}
+
+	var complete bool
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			complete = true
+		case batchv1.JobFailed:
+			recorder.Eventf(ec, corev1.EventTypeWarning, "QuorumRecoveryFailed",
+				"Quorum recovery Job %s failed: %s; delete it to retry", job.Name, condition.Message)
+			return true, nil
+		}
+	}
+	if !complete {
+		logger.Info("[Recover quorum] waiting for the data of the first member to be restored", "job", job.Name)
+		return true, nil
+	}
+	if ptr.Deref(sts.Spec.Replicas, 0) > 0 {
+		// The cluster restarted from the first member, the others are
+		// added back by the scale out.
+		return false, nil
+	}
+
+	for i := 1; i < maxClusterSize; i++ {
+		if err := wipeMemberData(ctx, wc, ec, i); err != nil {
+			return true, err
+		}
+	}
+	logger.Info("[Recover quorum] restarting the cluster from the first member")
+	if err := applyEtcdClusterState(ctx, ec, 1, wc, scheme, logger, recorder); err != nil {
+		return true, err
+	}
+	if err := applyStatefulSet(ctx, logger, ec, wc, 1, scheme); err != nil {
+		return true, err
+	}
+	recorder.Eventf(ec, corev1.EventTypeNormal, "QuorumRecovered",
+		"Restarted the cluster from member %s-0, the other members join it empty", ec.Name)
+	return true, nil
+}
+
+// quorumRecoveryJobName returns the name of the Job restoring the data of the
+// first member of ec for the quorum recovery op.
+func quorumRecoveryJobName(ec *ecv1alpha1.EtcdCluster, op *ecv1alpha1.MemberOperation) string {
+	return fmt.Sprintf("%s-quorum-recovery-%d", ec.Name, op.StartTime.Unix())
+}
+
+// newQuorumRecoveryJob returns the Job restoring the data of the first member
+// of ec, from the snapshot of backup, or from the database of the member of
+// the given ordinal when backup is nil. An init container copies the
+// database of the member, as the members keep their data in the directories
+// the Job then wipes, then etcdutl restores it like the snapshot of an
+// EtcdRestore. The data directories of the other members sharing the volume
+// of the first one are wiped too. When the recovery replays the write-ahead
+// log, the init container copies the log of the member of the given ordinal
+// instead, and operatorImage, the image of the operator, restores the
+// snapshot of backup along with it. The Job isn't retried.
+func newQuorumRecoveryJob(ec *ecv1alpha1.EtcdCluster, name string, source int, backup *ecv1alpha1.EtcdBackup, operatorImage string) *batchv1.Job {
+	storage := ec.Spec.StorageSpec
+	claimName := firstMemberClaimName(ec)
+	dataDirs := []string{path.Join(restoreDataDir, fmt.Sprintf("%s-0", ec.Name))}
+	if storage.AccessModes == corev1.ReadWriteMany {
+		claimName = storage.PVCName
+		dataDirs = nil
+		for i := range maxClusterSize {
+			dataDirs = append(dataDirs, path.Join(restoreDataDir, fmt.Sprintf("%s-%d", ec.Name, i)))
+		}
+	}
+
+	dataMount := corev1.VolumeMount{Name: "data", MountPath: restoreDataDir}
+	snapshotMount := corev1.VolumeMount{Name: "snapshot", MountPath: restoreSnapshotDir}
+	volumes := []corev1.Volume{
+		{Name: "data", VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+		}},
+		{Name: "snapshot", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	prepare := corev1.Container{
+		Name:         "prepare",
+		Image:        busyboxImage,
+		Command:      []string{"/bin/sh", "-c", quorumPrepareScript},
+		Env:          []corev1.EnvVar{{Name: "DATA_DIRS", Value: strings.Join(dataDirs, " ")}},
+		VolumeMounts: []corev1.VolumeMount{dataMount, snapshotMount},
+	}
+
+	replayWAL := backup != nil && ec.Spec.QuorumRecovery != nil && ec.Spec.QuorumRecovery.ReplayWAL
+	var initContainers []corev1.Container
+	var backupSnapshot snapshotStorage
+	if backup != nil {
+		backupSnapshot, _ = backupStorage(backup)
+		initContainers = append(initContainers, backupSnapshot.container("fetch", fetchSnapshot, snapshotMount))
+	}
+	if backup == nil || replayWAL {
+		member := fmt.Sprintf("%s-%d", ec.Name, source)
+		memberDir := path.Join(restoreDataDir, member, "member")
+		if storage.AccessModes == corev1.ReadWriteOnce && source != 0 {
+			memberDir = path.Join(quorumSourceDir, member, "member")
+			volumes = append(volumes, corev1.Volume{Name: "source", VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: fmt.Sprintf("%s-%s", volumeName, member),
+					ReadOnly:  true,
+				},
+			}})
+			prepare.VolumeMounts = append(prepare.VolumeMounts, corev1.VolumeMount{Name: "source", MountPath: quorumSourceDir, ReadOnly: true})
+		}
+		if replayWAL {
+			prepare.Env = append(prepare.Env, corev1.EnvVar{Name: "WAL_SOURCE", Value: memberDir})
+		} else {
+			prepare.Env = append(prepare.Env, corev1.EnvVar{Name: "SOURCE", Value: path.Join(memberDir, "snap", "db")})
+		}
+	}
+	initContainers = append(initContainers, prepare)
+
+	restore := newSnapshotRestoreContainer(ec, path.Join(restoreSnapshotDir, "snapshot.db"), backup == nil, snapshotMount)
+	if replayWAL {
+		memberName, peerURLs := peerURLsForOrdinalIndex(ec, 0)
+		restore = corev1.Container{
+			Name:  "replay",
+			Image: operatorImage,
+			Command: []string{"/manager", "snapshot", "replay",
+				"-in", path.Join(restoreSnapshotDir, "snapshot.db"),
+				"-source", quorumWALDir,
+				"-data-dir", path.Join(restoreDataDir, memberName),
+				"-name", memberName,
+				"-peer-urls", strings.Join(peerURLs, ","),
+			},
+			VolumeMounts: []corev1.VolumeMount{dataMount, snapshotMount},
+			SecurityContext: &corev1.SecurityContext{
+				RunAsUser:    ptr.To[int64](0),
+				RunAsNonRoot: ptr.To(false),
+			},
+		}
+	}
+
+	labels := withManagedByLabel(map[string]string{
+		"app":       ec.Name,
+		"component": "quorum-recovery",
+	})
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ec.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](0),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:  corev1.RestartPolicyNever,
+					InitContainers: initContainers,
+					Containers:     []corev1.Container{restore},
+					Volumes:        volumes,
+				},
+			},
+		},
+	}
+	if backup != nil {
+		job.Spec.Template.Spec.ServiceAccountName = backup.Spec.ServiceAccountName
+		backupSnapshot.configurePod(&job.Spec.Template)
+	}
+	return job
+}
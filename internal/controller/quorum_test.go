@@ -0,0 +1,342 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	featuregatetesting "k8s.io/component-base/featuregate/testing"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+	"go.etcd.io/etcd-operator/internal/features"
+)
+
+// quorumHealth returns the health check of the members of sts, with the
+// leader and raft index each of them reports. A nil entry is a member that
+// doesn't respond.
+func quorumHealth(sts *appsv1.StatefulSet, statuses ...*clientv3.StatusResponse) []etcdutils.EpHealth {
+	var infos []etcdutils.EpHealth
+	for i, status := range statuses {
+		infos = append(infos, etcdutils.EpHealth{Ep: clientEndpointForOrdinalIndex(sts, i), Health: status != nil, Status: status})
+	}
+	return infos
+}
+
+func memberStatus(leader, raftIndex uint64) *clientv3.StatusResponse {
+	return &clientv3.StatusResponse{Header: &etcdserverpb.ResponseHeader{}, Leader: leader, RaftIndex: raftIndex}
+}
+
+func newQuorumTestCluster() *ecv1alpha1.EtcdCluster {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.UID = "ec-uid"
+	ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{AccessModes: corev1.ReadWriteOnce, VolumeSizeRequest: resource.MustParse("1Gi")}
+	ec.Spec.QuorumRecovery = &ecv1alpha1.QuorumRecovery{Source: ecv1alpha1.QuorumRecoverySourceMember}
+	return ec
+}
+
+func TestSetQuorumLostCondition(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	condition := func() *metav1.Condition {
+		return meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionQuorumLost)
+	}
+
+	now := time.Date(2025, 1, 31, 1, 0, 0, 0, time.UTC)
+
+	assert.False(t, setQuorumLostCondition(ec, sts, quorumHealth(sts, memberStatus(1, 10), nil, memberStatus(1, 10)), now))
+	assert.Equal(t, metav1.ConditionFalse, condition().Status)
+	assert.Equal(t, reasonLeaderElected, condition().Reason)
+
+	// Most of the members responding without a leader are likely electing
+	// one.
+	electing := quorumHealth(sts, memberStatus(0, 10), nil, memberStatus(0, 10))
+	assert.False(t, setQuorumLostCondition(ec, sts, electing, now))
+	assert.Equal(t, metav1.ConditionUnknown, condition().Status)
+	assert.Equal(t, reasonElectingLeader, condition().Reason)
+	assert.False(t, setQuorumLostCondition(ec, sts, electing, now.Add(30*time.Second)))
+	assert.Equal(t, "2 of 3 members respond, none of them has a leader since 2025-01-31T01:00:00Z", condition().Message)
+	assert.False(t, setQuorumLostCondition(ec, sts, quorumHealth(sts, memberStatus(2, 11), nil, memberStatus(2, 11)), now.Add(40*time.Second)))
+	assert.Equal(t, metav1.ConditionFalse, condition().Status)
+
+	// A new leaderless stretch starts over, and the quorum is lost past the
+	// grace period.
+	assert.False(t, setQuorumLostCondition(ec, sts, electing, now.Add(time.Minute)))
+	assert.True(t, setQuorumLostCondition(ec, sts, electing, now.Add(2*time.Minute)))
+	assert.Equal(t, metav1.ConditionTrue, condition().Status)
+	assert.Equal(t, "2 of 3 members respond, none of them has a leader", condition().Message)
+
+	// Most of the members not responding lost the quorum right away.
+	ec.Status.Conditions = nil
+	assert.True(t, setQuorumLostCondition(ec, sts, quorumHealth(sts, memberStatus(0, 10), nil, nil), now))
+	assert.Equal(t, metav1.ConditionTrue, condition().Status)
+	assert.Equal(t, "1 of 3 members respond, none of them has a leader", condition().Message)
+	// A lost quorum stays lost until a leader is elected.
+	assert.True(t, setQuorumLostCondition(ec, sts, electing, now.Add(time.Second)))
+
+	// A single member is only down.
+	assert.False(t, setQuorumLostCondition(ec, newPlanTestStatefulSet(t, ec, 1), nil, now))
+	assert.Equal(t, reasonSingleMember, condition().Reason)
+}
+
+func TestMostRecentMember(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	sts := newPlanTestStatefulSet(t, ec, 3)
+
+	index, ok := mostRecentMember(sts, quorumHealth(sts, memberStatus(0, 10), nil, memberStatus(0, 12)))
+	assert.True(t, ok)
+	assert.Equal(t, 2, index)
+
+	index, ok = mostRecentMember(sts, quorumHealth(sts, memberStatus(0, 12), memberStatus(0, 12)))
+	assert.True(t, ok)
+	assert.Equal(t, 0, index)
+
+	_, ok = mostRecentMember(sts, quorumHealth(sts, nil, nil, nil))
+	assert.False(t, ok)
+}
+
+func TestLatestBackup(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := newPlanTestCluster(3, "v3.5.21")
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	backup := func(name, cluster string, phase ecv1alpha1.EtcdBackupPhase, completed time.Time) client.Object {
+		return &ecv1alpha1.EtcdBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: ecv1alpha1.EtcdBackupSpec{ClusterName: cluster, S3: &ecv1alpha1.S3BackupDestination{
+				Bucket: "backups",
+			}},
+			Status: ecv1alpha1.EtcdBackupStatus{Phase: phase, CompletionTime: ptr.To(metav1.NewTime(completed))},
+		}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	latest, err := latestBackup(ctx, c, ec)
+	assert.NoError(t, err)
+	assert.Nil(t, latest)
+
+	unverified := backup("unverified", ec.Name, ecv1alpha1.EtcdBackupPhaseCompleted, now.Add(2*time.Hour)).(*ecv1alpha1.EtcdBackup)
+	unverified.Status.Verified = ptr.To(false)
+	c = fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		backup("old", ec.Name, ecv1alpha1.EtcdBackupPhaseCompleted, now),
+		backup("latest", ec.Name, ecv1alpha1.EtcdBackupPhaseCompleted, now.Add(time.Hour)),
+		backup("failed", ec.Name, ecv1alpha1.EtcdBackupPhaseFailed, now.Add(2*time.Hour)),
+		unverified,
+		backup("other", "other-etcd", ecv1alpha1.EtcdBackupPhaseCompleted, now.Add(2*time.Hour)),
+	).Build()
+	latest, err = latestBackup(ctx, c, ec)
+	assert.NoError(t, err)
+	assert.Equal(t, "latest", latest.Name)
+}
+
+func TestStartQuorumRecovery(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+
+	ec := newQuorumTestCluster()
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	health := quorumHealth(sts, nil, memberStatus(0, 12), memberStatus(0, 10))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec.DeepCopy()).WithStatusSubresource(ec).Build()
+	status := newStatusPatcher(c, ec)
+
+	// The recovery needs the AutoRecovery feature gate.
+	started, err := startQuorumRecovery(ctx, logr.Discard(), c, recorder, status, ec, sts, health)
+	assert.NoError(t, err)
+	assert.False(t, started)
+	assert.Contains(t, <-recorder.Events, "enable the AutoRecovery feature gate")
+	featuregatetesting.SetFeatureGateDuringTest(t, features.DefaultFeatureGate, features.AutoRecovery, true)
+
+	started, err = startQuorumRecovery(ctx, logr.Discard(), c, recorder, status, ec, sts, health)
+	assert.NoError(t, err)
+	assert.False(t, started)
+	assert.Contains(t, <-recorder.Events, "annotate the EtcdCluster with operator.etcd.io/confirm-quorum-recovery=test-etcd")
+	assert.Nil(t, ec.Status.InProgressOperation)
+
+	confirmed := &ecv1alpha1.EtcdCluster{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(ec), confirmed))
+	confirmed.Annotations = map[string]string{ecv1alpha1.ConfirmQuorumRecoveryAnnotation: ec.Name}
+	assert.NoError(t, c.Update(ctx, confirmed))
+	ec.Annotations = map[string]string{ecv1alpha1.ConfirmQuorumRecoveryAnnotation: ec.Name}
+	started, err = startQuorumRecovery(ctx, logr.Discard(), c, recorder, status, ec, sts, health)
+	assert.NoError(t, err)
+	assert.True(t, started)
+	assert.Contains(t, <-recorder.Events, "restarting the cluster from member test-etcd-1")
+
+	stored := &ecv1alpha1.EtcdCluster{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(ec), stored))
+	assert.Equal(t, actionRecoverQuorum, stored.Status.InProgressOperation.Type)
+	assert.Equal(t, "test-etcd-1", stored.Status.InProgressOperation.Member)
+	// The confirmation is consumed.
+	assert.NotContains(t, stored.Annotations, ecv1alpha1.ConfirmQuorumRecoveryAnnotation)
+	assert.False(t, isQuorumRecoveryConfirmed(ec))
+}
+
+func TestNewQuorumRecoveryJob(t *testing.T) {
+	ec := newQuorumTestCluster()
+
+	job := newQuorumRecoveryJob(ec, "test-etcd-quorum-recovery", 2, nil, "")
+	spec := job.Spec.Template.Spec
+	assert.Len(t, spec.InitContainers, 1)
+	prepare := spec.InitContainers[0]
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "DATA_DIRS", Value: "/data/test-etcd-0"},
+		{Name: "SOURCE", Value: "/source/test-etcd-2/member/snap/db"},
+	}, prepare.Env)
+	assert.Equal(t, "etcd-data-test-etcd-0", spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	assert.Equal(t, "etcd-data-test-etcd-2", spec.Volumes[2].PersistentVolumeClaim.ClaimName)
+	assert.Contains(t, spec.Containers[0].Command, "--skip-hash-check")
+	assert.Contains(t, spec.Containers[0].Command, "--data-dir=/data/test-etcd-0")
+
+	// The first member's database is read from its own volume.
+	job = newQuorumRecoveryJob(ec, "test-etcd-quorum-recovery", 0, nil, "")
+	assert.Len(t, job.Spec.Template.Spec.Volumes, 2)
+	assert.Equal(t, "/data/test-etcd-0/member/snap/db", job.Spec.Template.Spec.InitContainers[0].Env[1].Value)
+
+	// The members sharing a volume are all wiped.
+	shared := newQuorumTestCluster()
+	shared.Spec.StorageSpec = &ecv1alpha1.StorageSpec{AccessModes: corev1.ReadWriteMany, PVCName: "etcd-shared"}
+	job = newQuorumRecoveryJob(shared, "test-etcd-quorum-recovery", 2, nil, "")
+	assert.Equal(t, "etcd-shared", job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	assert.Contains(t, job.Spec.Template.Spec.InitContainers[0].Env[0].Value, "/data/test-etcd-0 /data/test-etcd-1")
+	assert.Equal(t, "/data/test-etcd-2/member/snap/db", job.Spec.Template.Spec.InitContainers[0].Env[1].Value)
+
+	backup := &ecv1alpha1.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default"},
+		Spec: ecv1alpha1.EtcdBackupSpec{ClusterName: ec.Name, S3: &ecv1alpha1.S3BackupDestination{
+			Bucket:               "backups",
+			CredentialsSecretRef: corev1.LocalObjectReference{Name: "s3-credentials"},
+		}},
+	}
+	job = newQuorumRecoveryJob(ec, "test-etcd-quorum-recovery", 0, backup, "")
+	spec = job.Spec.Template.Spec
+	assert.Equal(t, []string{"fetch", "prepare"}, []string{spec.InitContainers[0].Name, spec.InitContainers[1].Name})
+	assert.Contains(t, spec.InitContainers[0].Env, corev1.EnvVar{Name: "KEY", Value: "default/test-etcd/nightly.db"})
+	assert.Len(t, spec.InitContainers[1].Env, 1)
+	assert.NotContains(t, spec.Containers[0].Command, "--skip-hash-check")
+
+	// The log of the most recent member is replayed over the backup.
+	ec.Spec.QuorumRecovery = &ecv1alpha1.QuorumRecovery{Source: ecv1alpha1.QuorumRecoverySourceBackup, ReplayWAL: true}
+	job = newQuorumRecoveryJob(ec, "test-etcd-quorum-recovery", 2, backup, "etcd-operator:latest")
+	spec = job.Spec.Template.Spec
+	assert.Equal(t, []string{"fetch", "prepare"}, []string{spec.InitContainers[0].Name, spec.InitContainers[1].Name})
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "DATA_DIRS", Value: "/data/test-etcd-0"},
+		{Name: "WAL_SOURCE", Value: "/source/test-etcd-2/member"},
+	}, spec.InitContainers[1].Env)
+	assert.Equal(t, "etcd-data-test-etcd-2", spec.Volumes[2].PersistentVolumeClaim.ClaimName)
+	replay := spec.Containers[0]
+	assert.Equal(t, "replay", replay.Name)
+	assert.Equal(t, "etcd-operator:latest", replay.Image)
+	assert.Equal(t, []string{"/manager", "snapshot", "replay", "-in", "/snapshot/snapshot.db", "-source", "/snapshot/member",
+		"-data-dir", "/data/test-etcd-0", "-name", "test-etcd-0"}, replay.Command[:11])
+}
+
+func TestRecoverQuorum(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = appsv1.AddToScheme(scheme)
+	_ = batchv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+
+	ec := newQuorumTestCluster()
+	ec.Status.InProgressOperation = &ecv1alpha1.MemberOperation{
+		Type:      actionRecoverQuorum,
+		Member:    "test-etcd-2",
+		StartTime: metav1.NewTime(time.Unix(1735689600, 0)),
+	}
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	objects := []client.Object{sts}
+	for i := range 3 {
+		objects = append(objects, &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("etcd-data-test-etcd-%d", i), Namespace: "default",
+		}})
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+
+	// recover runs recoverQuorum the way Reconcile does, with the
+	// StatefulSet reporting pods.
+	recover := func(pods int32) bool {
+		t.Helper()
+		current := &appsv1.StatefulSet{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(sts), current))
+		current.Status.Replicas = pods
+		recovering, err := recoverQuorum(ctx, logr.Discard(), c, c, scheme, recorder, ec, current, "")
+		assert.NoError(t, err)
+		return recovering
+	}
+	replicas := func() int32 {
+		t.Helper()
+		current := &appsv1.StatefulSet{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(sts), current))
+		return ptr.Deref(current.Spec.Replicas, 0)
+	}
+	job := &batchv1.Job{}
+	jobKey := client.ObjectKey{Name: "test-etcd-quorum-recovery-1735689600", Namespace: "default"}
+
+	// Replaying the log needs the image of the operator.
+	recovery := ec.Spec.QuorumRecovery
+	ec.Spec.QuorumRecovery = &ecv1alpha1.QuorumRecovery{Source: ecv1alpha1.QuorumRecoverySourceBackup, ReplayWAL: true}
+	assert.True(t, recover(3))
+	assert.Equal(t, int32(3), replicas())
+	assert.Contains(t, <-recorder.Events, "QuorumRecoveryUnavailable")
+	ec.Spec.QuorumRecovery = recovery
+
+	// The members are stopped first.
+	assert.True(t, recover(3))
+	assert.Equal(t, int32(0), replicas())
+	assert.True(t, recover(1))
+	assert.Error(t, c.Get(ctx, jobKey, job))
+
+	// Then the data of the first member is restored.
+	assert.True(t, recover(0))
+	assert.NoError(t, c.Get(ctx, jobKey, job))
+	assert.True(t, metav1.IsControlledBy(job, ec))
+	assert.True(t, recover(0))
+	assert.Equal(t, int32(0), replicas())
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+	assert.NoError(t, c.Status().Update(ctx, job))
+	assert.True(t, recover(0))
+	assert.Contains(t, <-recorder.Events, "QuorumRecoveryFailed")
+
+	// The cluster restarts from the first member, the other members are
+	// wiped.
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	assert.NoError(t, c.Status().Update(ctx, job))
+	assert.True(t, recover(0))
+	assert.Equal(t, int32(1), replicas())
+	assert.Contains(t, <-recorder.Events, "QuorumRecovered")
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	assert.NoError(t, c.List(ctx, pvcs))
+	assert.Len(t, pvcs.Items, 1)
+	assert.Equal(t, "etcd-data-test-etcd-0", pvcs.Items[0].Name)
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKey{Name: configMapNameForEtcdCluster(ec), Namespace: "default"}, cm))
+	assert.Equal(t, "new", cm.Data["ETCD_INITIAL_CLUSTER_STATE"])
+
+	// The recovery is done, the other members are added back by the scale
+	// out.
+	assert.False(t, recover(1))
+}
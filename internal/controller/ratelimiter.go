@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// RateLimiterOptions configures how failed reconciles are retried. The zero
+// value of each field keeps the controller-runtime default.
+type RateLimiterOptions struct {
+	// BaseDelay is the delay before the first retry of a failing cluster. It
+	// doubles with each consecutive failure of the same cluster.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two retries of a failing cluster.
+	MaxDelay time.Duration
+	// QPS is the overall number of retries per second, shared by all the
+	// clusters.
+	QPS float64
+	// Burst is the number of retries allowed above QPS in a short burst.
+	Burst int
+}
+
+const (
+	defaultBaseDelay = 5 * time.Millisecond
+	defaultMaxDelay  = 1000 * time.Second
+	defaultQPS       = 10
+	defaultBurst     = 100
+)
+
+// newRateLimiter returns a rate limiter which applies both a per-cluster
+// exponential backoff and an overall token bucket, like the controller-runtime
+// default, with the given settings.
+func newRateLimiter(opts RateLimiterOptions) workqueue.TypedRateLimiter[reconcile.Request] {
+	if opts == (RateLimiterOptions{}) {
+		return nil
+	}
+	if opts.BaseDelay == 0 {
+		opts.BaseDelay = defaultBaseDelay
+	}
+	if opts.MaxDelay == 0 {
+		opts.MaxDelay = defaultMaxDelay
+	}
+	if opts.QPS == 0 {
+		opts.QPS = defaultQPS
+	}
+	if opts.Burst == 0 {
+		opts.Burst = defaultBurst
+	}
+	return workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](opts.BaseDelay, opts.MaxDelay),
+		&workqueue.TypedBucketRateLimiter[reconcile.Request]{
+			Limiter: rate.NewLimiter(rate.Limit(opts.QPS), opts.Burst),
+		},
+	)
+}
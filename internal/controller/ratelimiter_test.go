@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	assert.Nil(t, newRateLimiter(RateLimiterOptions{}))
+
+	limiter := newRateLimiter(RateLimiterOptions{BaseDelay: time.Second, MaxDelay: 3 * time.Second})
+	failing := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "failing"}}
+	other := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "other"}}
+
+	assert.Equal(t, time.Second, limiter.When(failing))
+	assert.Equal(t, 2*time.Second, limiter.When(failing))
+	assert.Equal(t, 3*time.Second, limiter.When(failing))
+	assert.Equal(t, 3*time.Second, limiter.When(failing))
+	assert.Equal(t, 4, limiter.NumRequeues(failing))
+
+	// A failing cluster doesn't slow down the retries of the others.
+	assert.Equal(t, time.Second, limiter.When(other))
+
+	limiter.Forget(failing)
+	assert.Equal(t, time.Second, limiter.When(failing))
+}
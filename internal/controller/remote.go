@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// remoteOwnerLabel replaces the owner references of the member workloads
+	// run in a remote Kubernetes cluster, which can't reference the
+	// EtcdCluster. Its value is the UID of the EtcdCluster.
+	remoteOwnerLabel = "operator.etcd.io/owner-uid"
+
+	// remoteResyncPeriod is how often the EtcdClusters whose members run in a
+	// remote Kubernetes cluster are reconciled, as the changes of their
+	// member workloads aren't watched.
+	remoteResyncPeriod = time.Minute
+)
+
+// isRemote reports whether the members of ec run in a remote Kubernetes
+// cluster.
+func isRemote(ec *ecv1alpha1.EtcdCluster) bool {
+	return ec.Spec.KubeconfigSecretRef != nil
+}
+
+// setWorkloadOwner makes ec the controller of obj, one of its member
+// workloads. The workloads run in a remote Kubernetes cluster carry the
+// remoteOwnerLabel instead of an owner reference.
+func setWorkloadOwner(ec *ecv1alpha1.EtcdCluster, scheme *runtime.Scheme, obj metav1.Object) error {
+	if isRemote(ec) {
+		lbls := make(map[string]string, len(obj.GetLabels())+1)
+		for k, v := range obj.GetLabels() {
+			lbls[k] = v
+		}
+		lbls[remoteOwnerLabel] = string(ec.UID)
+		obj.SetLabels(lbls)
+		return nil
+	}
+
+	owners, err := prepareOwnerReference(ec, scheme)
+	if err != nil {
+		return err
+	}
+	obj.SetOwnerReferences(owners)
+	return nil
+}
+
+// isControlledBy reports whether ec is the controller of obj, see
+// setWorkloadOwner.
+func isControlledBy(obj metav1.Object, ec *ecv1alpha1.EtcdCluster) bool {
+	if metav1.IsControlledBy(obj, ec) {
+		return true
+	}
+	return isRemote(ec) && obj.GetLabels()[remoteOwnerLabel] == string(ec.UID)
+}
+
+// doneResult is the result of a reconcile of ec that has nothing left to do.
+func doneResult(ec *ecv1alpha1.EtcdCluster) ctrl.Result {
+	if isRemote(ec) {
+		return ctrl.Result{RequeueAfter: remoteResyncPeriod}
+	}
+	return ctrl.Result{}
+}
+
+// remoteClients caches the clients of the remote Kubernetes clusters, by
+// EtcdCluster, so they are only built again once their kubeconfig changes.
+// The zero value is ready to use.
+type remoteClients struct {
+	mu      sync.Mutex
+	clients map[string]remoteClient
+}
+
+type remoteClient struct {
+	kubeconfig []byte
+	client     client.Client
+}
+
+// workloadClient returns the client of the Kubernetes cluster running the
+// members of ec: c itself, or the client of the remote cluster whose
+// kubeconfig is held by the Secret ec references, read with reader.
+func (rc *remoteClients) workloadClient(ctx context.Context, c client.Client, reader client.Reader, scheme *runtime.Scheme, ec *ecv1alpha1.EtcdCluster) (client.Client, error) {
+	if !isRemote(ec) {
+		return c, nil
+	}
+
+	ref := ec.Spec.KubeconfigSecretRef
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: ec.Namespace}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get the kubeconfig Secret %s: %w", ref.Name, err)
+	}
+	kubeconfig, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("the kubeconfig Secret %s has no %s key", ref.Name, ref.Key)
+	}
+
+	key := client.ObjectKeyFromObject(ec).String()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if cached, ok := rc.clients[key]; ok && bytes.Equal(cached.kubeconfig, kubeconfig) {
+		return cached.client, nil
+	}
+
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig in Secret %s: %w", ref.Name, err)
+	}
+	wc, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the client of the remote Kubernetes cluster: %w", err)
+	}
+	if rc.clients == nil {
+		rc.clients = make(map[string]remoteClient)
+	}
+	rc.clients[key] = remoteClient{kubeconfig: kubeconfig, client: wc}
+	return wc, nil
+}
+
+// forget drops the cached client of the EtcdCluster with the given key.
+func (rc *remoteClients) forget(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	delete(rc.clients, key)
+}
+
+// reconcileRemoteCleanup keeps the RemoteCleanupFinalizer on an ec whose
+// members run in a remote Kubernetes cluster. Once ec is deleting, and past
+// its deletion protection, it deletes the member workloads from the remote
+// cluster and releases ec.
+func (r *EtcdClusterReconciler) reconcileRemoteCleanup(ctx context.Context, ec *ecv1alpha1.EtcdCluster, deleting bool) error {
+	finalizers := slices.Clone(ec.Finalizers)
+
+	if !deleting {
+		if isRemote(ec) && controllerutil.AddFinalizer(ec, ecv1alpha1.RemoteCleanupFinalizer) {
+			return patchFinalizers(ctx, r.Client, ec, finalizers)
+		}
+		return nil
+	}
+
+	if !controllerutil.ContainsFinalizer(ec, ecv1alpha1.RemoteCleanupFinalizer) ||
+		controllerutil.ContainsFinalizer(ec, ecv1alpha1.DeletionProtectionFinalizer) {
+		return nil
+	}
+
+	wc, err := r.remote.workloadClient(ctx, r.Client, r.apiReader(), r.Scheme, ec)
+	if err != nil {
+		return err
+	}
+	if err := deleteRemoteWorkloads(ctx, wc, ec); err != nil {
+		return err
+	}
+	r.Recorder.Event(ec, corev1.EventTypeNormal, "RemoteCleanupDone", "Deleted the members from the remote Kubernetes cluster")
+
+	controllerutil.RemoveFinalizer(ec, ecv1alpha1.RemoteCleanupFinalizer)
+	if err := patchFinalizers(ctx, r.Client, ec, finalizers); err != nil {
+		return err
+	}
+	r.remote.forget(client.ObjectKeyFromObject(ec).String())
+	return nil
+}
+
+// deleteRemoteWorkloads deletes the member workloads of ec controlled by it
+// from the remote Kubernetes cluster of wc. The volumes of the members go
+// with the StatefulSet, see newStatefulSetSpec.
+func deleteRemoteWorkloads(ctx context.Context, wc client.Client, ec *ecv1alpha1.EtcdCluster) error {
+	workloads := []client.Object{
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: ec.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: ec.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: clientServiceName(ec), Namespace: ec.Namespace}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: grpcProxyName(ec), Namespace: ec.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: grpcProxyName(ec), Namespace: ec.Namespace}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: gatewayName(ec), Namespace: ec.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: gatewayName(ec), Namespace: ec.Namespace}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: configMapNameForEtcdCluster(ec), Namespace: ec.Namespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: rootSecretName(ec), Namespace: ec.Namespace}},
+	}
+	if ec.Status.ServiceMonitor != "" {
+		workloads = append(workloads, newMonitoringRef("ServiceMonitor", ec.Status.ServiceMonitor, ec.Namespace))
+	}
+	if ec.Status.PrometheusRule != "" {
+		workloads = append(workloads, newMonitoringRef("PrometheusRule", ec.Status.PrometheusRule, ec.Namespace))
+	}
+	for _, obj := range workloads {
+		if err := wc.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if k8serrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				continue
+			}
+			return err
+		}
+		if !isControlledBy(obj, ec) {
+			continue
+		}
+		if err := wc.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	services := &corev1.ServiceList{}
+	if err := wc.List(ctx, services, client.InNamespace(ec.Namespace), client.MatchingLabels(withManagedByLabel(memberServiceLabels(ec)))); err != nil {
+		return err
+	}
+	for i := range services.Items {
+		if !isControlledBy(&services.Items[i], ec) {
+			continue
+		}
+		if err := wc.Delete(ctx, &services.Items[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
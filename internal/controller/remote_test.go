@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: remote
+  cluster:
+    server: https://remote.example.com:6443
+contexts:
+- name: remote
+  context:
+    cluster: remote
+    user: remote
+current-context: remote
+users:
+- name: remote
+  user:
+    token: secret-token
+`
+
+func newRemoteTestCluster() *ecv1alpha1.EtcdCluster {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.UID = "ec-uid"
+	ec.Spec.KubeconfigSecretRef = &ecv1alpha1.KubeconfigSecretReference{Name: "remote-kubeconfig"}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	return ec
+}
+
+func TestSetWorkloadOwner(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	local := newPlanTestCluster(3, "v3.5.21")
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, setWorkloadOwner(local, scheme, cm))
+	assert.True(t, metav1.IsControlledBy(cm, local))
+	assert.NotContains(t, cm.Labels, remoteOwnerLabel)
+	assert.True(t, isControlledBy(cm, local))
+
+	// The workloads of a remote cluster can't reference the EtcdCluster.
+	remote := newRemoteTestCluster()
+	cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": remote.Name}}}
+	assert.NoError(t, setWorkloadOwner(remote, scheme, cm))
+	assert.Empty(t, cm.OwnerReferences)
+	assert.Equal(t, map[string]string{"app": remote.Name, remoteOwnerLabel: "ec-uid"}, cm.Labels)
+	assert.True(t, isControlledBy(cm, remote))
+
+	cm.Labels[remoteOwnerLabel] = "other-uid"
+	assert.False(t, isControlledBy(cm, remote))
+}
+
+func TestWorkloadClient(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "remote-kubeconfig", Namespace: "default"},
+		Data:       map[string][]byte{"value": []byte(testKubeconfig)},
+	}
+	hub := fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build()
+	rc := &remoteClients{}
+
+	// The members of a local cluster run next to it.
+	local := newPlanTestCluster(3, "v3.5.21")
+	wc, err := rc.workloadClient(ctx, hub, hub, scheme, local)
+	assert.NoError(t, err)
+	assert.Equal(t, hub, wc)
+
+	remote := newRemoteTestCluster()
+	wc, err = rc.workloadClient(ctx, hub, hub, scheme, remote)
+	assert.NoError(t, err)
+	assert.NotEqual(t, hub, wc)
+
+	// The client is reused until the kubeconfig changes.
+	cached, err := rc.workloadClient(ctx, hub, hub, scheme, remote)
+	assert.NoError(t, err)
+	assert.Same(t, wc, cached)
+
+	secret.Data["value"] = []byte(testKubeconfig + "preferences: {}\n")
+	assert.NoError(t, hub.Update(ctx, secret))
+	rebuilt, err := rc.workloadClient(ctx, hub, hub, scheme, remote)
+	assert.NoError(t, err)
+	assert.NotSame(t, wc, rebuilt)
+
+	remote.Spec.KubeconfigSecretRef.Key = "kubeconfig"
+	_, err = rc.workloadClient(ctx, hub, hub, scheme, remote)
+	assert.ErrorContains(t, err, "has no kubeconfig key")
+
+	remote.Spec.KubeconfigSecretRef.Name = "missing"
+	_, err = rc.workloadClient(ctx, hub, hub, scheme, remote)
+	assert.True(t, k8serrors.IsNotFound(err))
+}
+
+func TestReconcileRemoteCleanup(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := newRemoteTestCluster()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "remote-kubeconfig", Namespace: ec.Namespace},
+		Data:       map[string][]byte{"value": []byte(testKubeconfig)},
+	}
+	hub := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec, secret).Build()
+	owned := map[string]string{remoteOwnerLabel: string(ec.UID)}
+	remoteCluster := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: ec.Namespace, Labels: owned}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: configMapNameForEtcdCluster(ec), Namespace: ec.Namespace, Labels: owned}},
+		// The Service isn't the EtcdCluster's, so it is left alone.
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: ec.Namespace}},
+	).Build()
+
+	r := &EtcdClusterReconciler{Client: hub, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	r.remote.clients = map[string]remoteClient{
+		client.ObjectKeyFromObject(ec).String(): {kubeconfig: []byte(testKubeconfig), client: remoteCluster},
+	}
+
+	// The finalizer is added to the remote clusters, keeping the in-memory
+	// defaults of ec.
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	expected := ec.Spec.DeepCopy()
+	assert.NoError(t, r.reconcileRemoteCleanup(ctx, ec, false))
+	assert.Equal(t, *expected, ec.Spec)
+	stored := &ecv1alpha1.EtcdCluster{}
+	assert.NoError(t, hub.Get(ctx, client.ObjectKeyFromObject(ec), stored))
+	assert.Equal(t, []string{ecv1alpha1.RemoteCleanupFinalizer}, stored.Finalizers)
+
+	// The workloads are deleted before the EtcdCluster.
+	assert.NoError(t, hub.Delete(ctx, stored))
+	assert.NoError(t, hub.Get(ctx, client.ObjectKeyFromObject(ec), stored))
+	ecv1alpha1.SetEtcdClusterDefaults(stored)
+	assert.NoError(t, r.reconcileRemoteCleanup(ctx, stored, true))
+
+	err := remoteCluster.Get(ctx, client.ObjectKeyFromObject(ec), &appsv1.StatefulSet{})
+	assert.True(t, k8serrors.IsNotFound(err))
+	err = remoteCluster.Get(ctx, client.ObjectKey{Name: configMapNameForEtcdCluster(ec), Namespace: ec.Namespace}, &corev1.ConfigMap{})
+	assert.True(t, k8serrors.IsNotFound(err))
+	assert.NoError(t, remoteCluster.Get(ctx, client.ObjectKeyFromObject(ec), &corev1.Service{}))
+
+	err = hub.Get(ctx, client.ObjectKeyFromObject(ec), stored)
+	assert.True(t, k8serrors.IsNotFound(err))
+	assert.Empty(t, r.remote.clients)
+}
+
+func TestReconcileRemoteFeatureGate(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := newRemoteTestCluster()
+	hub := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).WithStatusSubresource(ec).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &EtcdClusterReconciler{Client: hub, Scheme: scheme, Recorder: recorder}
+
+	// The remote clusters aren't reconciled without the StretchClusters
+	// feature gate.
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(ec)})
+	assert.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+	assert.Contains(t, <-recorder.Events, "needs the StretchClusters feature gate")
+	assert.Empty(t, r.remote.clients)
+}
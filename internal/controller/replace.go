@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+	"go.etcd.io/etcd-operator/internal/features"
+)
+
+// defaultFailureThreshold is how long a member fails its health check before
+// it is replaced, unless the EtcdCluster sets another threshold.
+const defaultFailureThreshold = 10 * time.Minute
+
+// failureThreshold returns how long the members of ec fail their health check
+// before they are replaced.
+func failureThreshold(ec *ecv1alpha1.EtcdCluster) time.Duration {
+	if r := ec.Spec.MemberReplacement; r != nil && r.FailureThreshold != nil {
+		return r.FailureThreshold.Duration
+	}
+	return defaultFailureThreshold
+}
+
+// recordFailingMembers records in the status of ec the members of sts failing
+// their health check in healthInfos, keeping when they first failed it. The
+// members missing from healthInfos, which aren't started yet or are already
+// removed, are forgotten. The failing members in corrupted, by name, are
+// marked as corrupted, with the outcome of their data check.
+func recordFailingMembers(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, healthInfos []etcdutils.EpHealth, corrupted map[string]string, now time.Time) {
+	var failing []ecv1alpha1.FailingMember
+	for i := range int(ptr.Deref(sts.Spec.Replicas, 0)) {
+		ep := clientEndpointForOrdinalIndex(sts, i)
+		idx := slices.IndexFunc(healthInfos, func(h etcdutils.EpHealth) bool { return h.Ep == ep })
+		if idx < 0 || healthInfos[idx].Health {
+			continue
+		}
+		member := ecv1alpha1.FailingMember{
+			Name:  fmt.Sprintf("%s-%d", sts.Name, i),
+			Since: metav1.NewTime(now),
+			Error: healthInfos[idx].Error,
+		}
+		if message, ok := corrupted[member.Name]; ok {
+			member.Error, member.Corrupted = message, true
+		}
+		if previous := findFailingMember(ec, member.Name); previous != nil {
+			member.Since = previous.Since
+		}
+		failing = append(failing, member)
+	}
+	ec.Status.FailingMembers = failing
+}
+
+func findFailingMember(ec *ecv1alpha1.EtcdCluster, name string) *ecv1alpha1.FailingMember {
+	for i := range ec.Status.FailingMembers {
+		if ec.Status.FailingMembers[i].Name == name {
+			return &ec.Status.FailingMembers[i]
+		}
+	}
+	return nil
+}
+
+// memberToReplace returns the member of ec to replace, failing its health
+// check for longer than the failure threshold, or right away when its data is
+// corrupted. Only a single failing member is replaced: several members
+// failing at once likely share a cause, e.g. a network partition, which
+// wiping their data doesn't fix. The reason nothing is replaced is returned
+// otherwise, empty when all the members are healthy.
+func memberToReplace(ec *ecv1alpha1.EtcdCluster, now time.Time) (string, string) {
+	switch failing := ec.Status.FailingMembers; {
+	case len(failing) == 0:
+		return "", ""
+	case len(failing) > 1:
+		return "", fmt.Sprintf("%d members are failing, only a single one is replaced", len(failing))
+	case !failing[0].Corrupted && now.Sub(failing[0].Since.Time) < failureThreshold(ec):
+		return "", fmt.Sprintf("member %s has been failing for less than %s", failing[0].Name, failureThreshold(ec))
+	default:
+		return failing[0].Name, ""
+	}
+}
+
+// reconcileFailedMembers replaces the member of ec failing its health check
+// for longer than the failure threshold, or whose data is corrupted, when
+// memberReplacement is set: it removes the member from the cluster, deletes
+// its pod and volume so the StatefulSet recreates them empty, and adds it
+// back as a learner, which is then promoted like any other. A learner is
+// removed the same way when it failed before the replacement started, e.g.
+// while the cluster scaled out, or when it doesn't start within the failure
+// threshold once added back. The replacement is recorded as the operation in
+// progress, so it resumes after an interruption. members and healthInfos are
+// the result of the health check of the cluster. It returns whether a
+// replacement is in progress, in which case the other changes of the cluster
+// wait for it to complete.
+func reconcileFailedMembers(ctx context.Context, logger logr.Logger, c client.Client, recorder record.EventRecorder, status *statusPatcher,
+	ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, etcdClient *etcdutils.ClusterClient,
+	members *clientv3.MemberListResponse, healthInfos []etcdutils.EpHealth, now time.Time) (bool, error) {
+	if members == nil {
+		return false, nil
+	}
+	op := ec.Status.InProgressOperation
+	if op == nil {
+		if ec.Spec.MemberReplacement == nil || !features.Enabled(features.AutoRecovery) {
+			return false, nil
+		}
+		member, reason := memberToReplace(ec, now)
+		if member == "" {
+			if reason != "" {
+				logger.Info("Not replacing the failing members", "reason", reason)
+			}
+			return false, nil
+		}
+		if !slices.ContainsFunc(healthInfos, func(h etcdutils.EpHealth) bool { return h.Health && h.Status != nil && h.Status.Leader != 0 }) {
+			logger.Info("Not replacing the failing member without a leader", "member", member)
+			return false, nil
+		}
+		if storage := ec.Spec.StorageSpec; storage != nil && storage.AccessModes == corev1.ReadWriteMany {
+			recorder.Eventf(ec, corev1.EventTypeWarning, "MemberReplacementUnsupported",
+				"Member %s is failing, but the data of the members on a shared volume can't be wiped", member)
+			return false, nil
+		}
+		if err := startMemberOperation(ctx, status, ec, actionReplaceMember, member); err != nil {
+			return false, err
+		}
+		if failing := findFailingMember(ec, member); failing.Corrupted {
+			recorder.Eventf(ec, corev1.EventTypeWarning, "ReplacingMember", "Replacing member %s, its data is corrupted: %s", member, failing.Error)
+		} else {
+			recorder.Eventf(ec, corev1.EventTypeWarning, "ReplacingMember",
+				"Replacing member %s, failing its health check since %s: %s", member, failing.Since.UTC().Format(time.RFC3339), failing.Error)
+		}
+		op = ec.Status.InProgressOperation
+	}
+	if op.Type != actionReplaceMember {
+		return false, nil
+	}
+
+	var index int
+	if _, err := fmt.Sscanf(op.Member, ec.Name+"-%d", &index); err != nil {
+		return false, fmt.Errorf("invalid member %s in the operation in progress: %w", op.Member, err)
+	}
+	name, peerURLs := peerURLsForOrdinalIndex(ec, index)
+	peerURL := peerURLs[0]
+	ep := clientEndpointForOrdinalIndex(sts, index)
+	var eps []string
+	healthy := false
+	for _, h := range healthInfos {
+		if !h.Health {
+			continue
+		}
+		if h.Ep == ep {
+			healthy = true
+			continue
+		}
+		eps = append(eps, h.Ep)
+	}
+	if len(eps) == 0 {
+		return true, fmt.Errorf("no healthy member left to replace member %s", name)
+	}
+
+	var member *etcdserverpb.Member
+	if idx := slices.IndexFunc(members.Members, func(m *etcdserverpb.Member) bool {
+		return m.Name == name || slices.Contains(m.PeerURLs, peerURL)
+	}); idx >= 0 {
+		member = members.Members[idx]
+	}
+
+	switch {
+	case member == nil:
+		logger.Info("[Replace member] wiping the data of the member and adding it back", "member", name)
+		if err := wipeMemberData(ctx, c, ec, index); err != nil {
+			return true, err
+		}
+		if _, err := etcdClient.AddMember(eps, peerURLs, true); err != nil {
+			return true, err
+		}
+		// The new member fails its health check until it starts, from
+		// now on.
+		op.StartTime = metav1.NewTime(now)
+		ec.Status.FailingMembers = slices.DeleteFunc(ec.Status.FailingMembers, func(m ecv1alpha1.FailingMember) bool { return m.Name == name })
+		if err := status.patch(ctx, ec); err != nil {
+			return true, err
+		}
+		recorder.Eventf(ec, corev1.EventTypeNormal, "MemberReplaced", "Added member %s back to the cluster, with empty data", name)
+		return true, nil
+	case healthy:
+		// The new member is up: it is promoted, and the operation
+		// completed, like after a scale out.
+		return false, nil
+	case !member.IsLearner:
+		logger.Info("[Replace member] removing the failed member", "member", name, "memberID", member.ID)
+		if err := etcdClient.RemoveMember(eps, member.ID); err != nil {
+			return true, err
+		}
+		return true, nil
+	case failedLearner(ec, op, now):
+		logger.Info("[Replace member] removing the failed learner", "member", name, "memberID", member.ID)
+		if err := etcdClient.RemoveMember(eps, member.ID); err != nil {
+			return true, err
+		}
+		return true, nil
+	default:
+		logger.Info("[Replace member] waiting for the new member to start", "member", name)
+		return true, nil
+	}
+}
+
+// failedLearner reports whether the member of op, the replacement of a
+// member of ec, is a learner to remove: it failed before the replacement
+// started, or it hasn't started within the failure threshold since it was
+// added back.
+func failedLearner(ec *ecv1alpha1.EtcdCluster, op *ecv1alpha1.MemberOperation, now time.Time) bool {
+	if failing := findFailingMember(ec, op.Member); failing != nil && failing.Since.Before(&op.StartTime) {
+		return true
+	}
+	return now.Sub(op.StartTime.Time) >= failureThreshold(ec)
+}
+
+// wipeMemberData deletes the pod of the member of ec of the given ordinal,
+// then its volume, so the StatefulSet recreates them empty. The volume, which
+// pvc-protection keeps while a pod uses it, is gone along with the pod; the
+// pod is deleted again in case the StatefulSet recreated it on the old volume
+// in between.
+func wipeMemberData(ctx context.Context, c client.Client, ec *ecv1alpha1.EtcdCluster, index int) error {
+	name := fmt.Sprintf("%s-%d", ec.Name, index)
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ec.Namespace}}
+	if err := c.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete the pod of member %s: %w", name, err)
+	}
+	storage := ec.Spec.StorageSpec
+	if storage == nil || storage.AccessModes != corev1.ReadWriteOnce {
+		return nil
+	}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%s", volumeName, name), Namespace: ec.Namespace}}
+	if err := c.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete the volume of member %s: %w", name, err)
+	}
+	pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ec.Namespace}}
+	if err := c.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete the pod of member %s: %w", name, err)
+	}
+	return nil
+}
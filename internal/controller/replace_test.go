@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func TestRecordFailingMembers(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	health := func(healthy ...bool) []etcdutils.EpHealth {
+		var infos []etcdutils.EpHealth
+		for i, h := range healthy {
+			infos = append(infos, etcdutils.EpHealth{Ep: clientEndpointForOrdinalIndex(sts, i), Health: h, Error: "context deadline exceeded"})
+		}
+		return infos
+	}
+
+	recordFailingMembers(ec, sts, health(true, true, true), nil, now)
+	assert.Empty(t, ec.Status.FailingMembers)
+
+	recordFailingMembers(ec, sts, health(true, false, true), nil, now)
+	assert.Equal(t, []ecv1alpha1.FailingMember{
+		{Name: "test-etcd-1", Since: metav1.NewTime(now), Error: "context deadline exceeded"},
+	}, ec.Status.FailingMembers)
+
+	// The first failure is kept.
+	recordFailingMembers(ec, sts, health(false, false, true), nil, now.Add(time.Minute))
+	assert.Len(t, ec.Status.FailingMembers, 2)
+	assert.Equal(t, metav1.NewTime(now.Add(time.Minute)), ec.Status.FailingMembers[0].Since)
+	assert.Equal(t, metav1.NewTime(now), ec.Status.FailingMembers[1].Since)
+
+	// The members not checked are forgotten.
+	recordFailingMembers(ec, sts, health(true, false), nil, now.Add(2*time.Minute))
+	assert.Len(t, ec.Status.FailingMembers, 1)
+	assert.Equal(t, "test-etcd-1", ec.Status.FailingMembers[0].Name)
+
+	// The outcome of the data check of the corrupted members replaces the
+	// error of their health check.
+	corrupted := map[string]string{"test-etcd-1": "the data check failed: the database is corrupted", "test-etcd-2": "ignored"}
+	recordFailingMembers(ec, sts, health(true, false, true), corrupted, now.Add(3*time.Minute))
+	assert.Equal(t, []ecv1alpha1.FailingMember{
+		{Name: "test-etcd-1", Since: metav1.NewTime(now), Error: "the data check failed: the database is corrupted", Corrupted: true},
+	}, ec.Status.FailingMembers)
+}
+
+func TestMemberToReplace(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	failing := func(name string, since time.Duration) ecv1alpha1.FailingMember {
+		return ecv1alpha1.FailingMember{Name: name, Since: metav1.NewTime(now.Add(-since))}
+	}
+
+	tests := []struct {
+		name           string
+		threshold      *metav1.Duration
+		failing        []ecv1alpha1.FailingMember
+		expectedMember string
+		expectedReason string
+	}{
+		{
+			name: "healthy members",
+		},
+		{
+			name:           "recent failure",
+			failing:        []ecv1alpha1.FailingMember{failing("etcd-1", 5*time.Minute)},
+			expectedReason: "member etcd-1 has been failing for less than 10m0s",
+		},
+		{
+			name:           "failure past the default threshold",
+			failing:        []ecv1alpha1.FailingMember{failing("etcd-1", 11*time.Minute)},
+			expectedMember: "etcd-1",
+		},
+		{
+			name:           "failure past the threshold",
+			threshold:      &metav1.Duration{Duration: 2 * time.Minute},
+			failing:        []ecv1alpha1.FailingMember{failing("etcd-1", 5*time.Minute)},
+			expectedMember: "etcd-1",
+		},
+		{
+			name:           "recent corruption",
+			failing:        []ecv1alpha1.FailingMember{{Name: "etcd-1", Since: metav1.NewTime(now), Corrupted: true}},
+			expectedMember: "etcd-1",
+		},
+		{
+			name:           "several failures",
+			failing:        []ecv1alpha1.FailingMember{failing("etcd-0", time.Hour), failing("etcd-1", time.Hour)},
+			expectedReason: "2 members are failing, only a single one is replaced",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := newPlanTestCluster(3, "v3.5.21")
+			ec.Spec.MemberReplacement = &ecv1alpha1.MemberReplacement{FailureThreshold: tt.threshold}
+			ec.Status.FailingMembers = tt.failing
+
+			member, reason := memberToReplace(ec, now)
+			assert.Equal(t, tt.expectedMember, member)
+			assert.Equal(t, tt.expectedReason, reason)
+		})
+	}
+}
+
+func TestReconcileFailedMembersFeatureGate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.MemberReplacement = &ecv1alpha1.MemberReplacement{}
+	ec.Status.FailingMembers = []ecv1alpha1.FailingMember{{Name: "test-etcd-1", Since: metav1.NewTime(now.Add(-time.Hour))}}
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	recorder := record.NewFakeRecorder(10)
+
+	// The members aren't replaced without the AutoRecovery feature gate.
+	health := quorumHealth(sts, memberStatus(1, 10), nil, memberStatus(1, 10))
+	replacing, err := reconcileFailedMembers(ctx, logr.Discard(), nil, recorder, nil, ec, sts, nil,
+		&clientv3.MemberListResponse{}, health, now)
+	assert.NoError(t, err)
+	assert.False(t, replacing)
+	assert.Nil(t, ec.Status.InProgressOperation)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestFailedLearner(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	op := &ecv1alpha1.MemberOperation{Type: actionReplaceMember, Member: "test-etcd-1", StartTime: metav1.NewTime(now.Add(-time.Minute))}
+
+	tests := []struct {
+		name     string
+		since    *time.Time
+		now      time.Time
+		expected bool
+	}{
+		{
+			name:     "learner added back, starting",
+			now:      now,
+			expected: false,
+		},
+		{
+			name:     "learner added back, failing since",
+			since:    &now,
+			now:      now,
+			expected: false,
+		},
+		{
+			name:     "learner added back, not started within the threshold",
+			since:    &now,
+			now:      now.Add(10 * time.Minute),
+			expected: true,
+		},
+		{
+			name:     "learner failing before the replacement",
+			since:    ptr.To(now.Add(-time.Hour)),
+			now:      now,
+			expected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := newPlanTestCluster(3, "v3.5.21")
+			if tt.since != nil {
+				ec.Status.FailingMembers = []ecv1alpha1.FailingMember{{Name: "test-etcd-1", Since: metav1.NewTime(*tt.since)}}
+			}
+			assert.Equal(t, tt.expected, failedLearner(ec, op, tt.now))
+		})
+	}
+}
+
+func TestWipeMemberData(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{AccessModes: corev1.ReadWriteOnce, VolumeSizeRequest: resource.MustParse("1Gi")}
+	objects := []client.Object{
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-etcd-1", Namespace: "default"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-etcd-2", Namespace: "default"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "etcd-data-test-etcd-1", Namespace: "default"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "etcd-data-test-etcd-2", Namespace: "default"}},
+	}
+	var deleted []string
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithInterceptorFuncs(interceptor.Funcs{
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			deleted = append(deleted, fmt.Sprintf("%T %s", obj, obj.GetName()))
+			return c.Delete(ctx, obj, opts...)
+		},
+	}).Build()
+
+	assert.NoError(t, wipeMemberData(ctx, c, ec, 1))
+	// The pod goes first, or pvc-protection keeps the volume.
+	assert.Equal(t, []string{
+		"*v1.Pod test-etcd-1",
+		"*v1.PersistentVolumeClaim etcd-data-test-etcd-1",
+		"*v1.Pod test-etcd-1",
+	}, deleted)
+	pods := &corev1.PodList{}
+	assert.NoError(t, c.List(ctx, pods))
+	assert.Len(t, pods.Items, 1)
+	assert.Equal(t, "test-etcd-2", pods.Items[0].Name)
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	assert.NoError(t, c.List(ctx, pvcs))
+	assert.Len(t, pvcs.Items, 1)
+	assert.Equal(t, "etcd-data-test-etcd-2", pvcs.Items[0].Name)
+
+	// Wiping is idempotent.
+	assert.NoError(t, wipeMemberData(ctx, c, ec, 1))
+}
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// clientServiceName returns the name of the client Service of ec.
+func clientServiceName(ec *ecv1alpha1.EtcdCluster) string {
+	return fmt.Sprintf("%s-client", ec.Name)
+}
+
+// newClientService returns the client Service of ec, which must have a
+// clientService. It selects the members like the headless Service does,
+// but isn't labeled like it, for the ServiceMonitor not to select it.
+func newClientService(ec *ecv1alpha1.EtcdCluster) *corev1.Service {
+	cfg := ec.Spec.ClientService
+	ports := []corev1.ServicePort{{
+		Name:       "client",
+		Port:       ec.Spec.Ports.Client,
+		TargetPort: intstr.FromInt32(ec.Spec.Ports.Client),
+		NodePort:   cfg.NodePort,
+		Protocol:   corev1.ProtocolTCP,
+	}}
+	for _, p := range cfg.ExtraPorts {
+		targetPort := p.TargetPort
+		if targetPort == (intstr.IntOrString{}) {
+			targetPort = intstr.FromInt32(p.Port)
+		}
+		ports = append(ports, corev1.ServicePort{
+			Name:       p.Name,
+			Port:       p.Port,
+			TargetPort: targetPort,
+			NodePort:   p.NodePort,
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        clientServiceName(ec),
+			Namespace:   ec.Namespace,
+			Labels:      map[string]string{"app": ec.Name, "component": "client"},
+			Annotations: cfg.Annotations,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                     cfg.Type,
+			Selector:                 map[string]string{"app": ec.Name, "controller": ec.Name},
+			Ports:                    ports,
+			SessionAffinity:          cfg.SessionAffinity,
+			LoadBalancerSourceRanges: cfg.LoadBalancerSourceRanges,
+		},
+	}
+}
+
+// reconcileClientService applies the client Service of ec, or deletes it once
+// the clientService is removed.
+func reconcileClientService(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster) error {
+	if ec.Spec.ClientService != nil {
+		svc := newClientService(ec)
+		if err := setWorkloadOwner(ec, scheme, svc); err != nil {
+			return err
+		}
+		if err := applyOwnedObject(ctx, c, recorder, ec, svc); err != nil {
+			return fmt.Errorf("failed to apply client service: %w", err)
+		}
+		return nil
+	}
+
+	svc := &corev1.Service{}
+	if err := c.Get(ctx, client.ObjectKey{Name: clientServiceName(ec), Namespace: ec.Namespace}, svc); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !isControlledBy(svc, ec) {
+		return nil
+	}
+	return client.IgnoreNotFound(c.Delete(ctx, svc))
+}
+
+// memberServiceLabels returns the labels of the member Services of ec.
+func memberServiceLabels(ec *ecv1alpha1.EtcdCluster) map[string]string {
+	return map[string]string{
+		"app":       ec.Name,
+		"component": "member",
+	}
+}
+
+// memberServicesDomain returns the domain the members of ec advertise their
+// URLs at too, if any.
+func memberServicesDomain(ec *ecv1alpha1.EtcdCluster) string {
+	if ec.Spec.MemberServices == nil {
+		return ""
+	}
+	return ec.Spec.MemberServices.Domain
+}
+
+// newMemberService returns the Service of the member of ec of the given
+// index, which must have memberServices.
+func newMemberService(ec *ecv1alpha1.EtcdCluster, index int) *corev1.Service {
+	cfg := ec.Spec.MemberServices
+	member := fmt.Sprintf("%s-%d", ec.Name, index)
+	var annotations map[string]string
+	if len(cfg.Annotations) > 0 {
+		annotations = make(map[string]string, len(cfg.Annotations))
+		for k, v := range cfg.Annotations {
+			annotations[k] = strings.ReplaceAll(v, "$(MEMBER_NAME)", member)
+		}
+	}
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        member + "-svc",
+			Namespace:   ec.Namespace,
+			Labels:      memberServiceLabels(ec),
+			Annotations: annotations,
+		},
+		Spec: corev1.ServiceSpec{
+			Type: cfg.Type,
+			Selector: map[string]string{
+				"app":                          ec.Name,
+				"controller":                   ec.Name,
+				appsv1.StatefulSetPodNameLabel: member,
+			},
+			// The peers reach a member joining the cluster before it is
+			// ready.
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{
+				{Name: "client", Port: ec.Spec.Ports.Client, TargetPort: intstr.FromInt32(ec.Spec.Ports.Client), Protocol: corev1.ProtocolTCP},
+				{Name: "peer", Port: ec.Spec.Ports.Peer, TargetPort: intstr.FromInt32(ec.Spec.Ports.Peer), Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+}
+
+// reconcileMemberServices applies the Services of the members of ec, for the
+// members it has, given by replicas, and the ones it is scaling out to. It
+// deletes the Services of the members scaled in, and all of them once the
+// memberServices are removed.
+func reconcileMemberServices(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, replicas int) error {
+	wanted := map[string]bool{}
+	if ec.Spec.MemberServices != nil {
+		for i := range max(ec.Spec.Size, replicas) {
+			svc := newMemberService(ec, i)
+			if err := setWorkloadOwner(ec, scheme, svc); err != nil {
+				return err
+			}
+			if err := applyOwnedObject(ctx, c, recorder, ec, svc); err != nil {
+				return fmt.Errorf("failed to apply member service: %w", err)
+			}
+			wanted[svc.Name] = true
+		}
+	}
+
+	services := &corev1.ServiceList{}
+	if err := c.List(ctx, services, client.InNamespace(ec.Namespace), client.MatchingLabels(withManagedByLabel(memberServiceLabels(ec)))); err != nil {
+		return err
+	}
+	for i := range services.Items {
+		svc := &services.Items[i]
+		if wanted[svc.Name] || !isControlledBy(svc, ec) {
+			continue
+		}
+		if err := c.Delete(ctx, svc); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestNewClientService(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size: 3,
+			ClientService: &ecv1alpha1.ClientService{
+				Type:        corev1.ServiceTypeLoadBalancer,
+				Annotations: map[string]string{"external-dns.alpha.kubernetes.io/hostname": "etcd.example.com"},
+				NodePort:    30379,
+				ExtraPorts: []ecv1alpha1.ClientServicePort{
+					{Name: "grpc-proxy", Port: 23790},
+					{Name: "gateway", Port: 80, TargetPort: intstr.FromString("gateway")},
+				},
+			},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	svc := newClientService(ec)
+	assert.Equal(t, "test-etcd-client", svc.Name)
+	assert.Equal(t, corev1.ServiceTypeLoadBalancer, svc.Spec.Type)
+	assert.Equal(t, corev1.ServiceAffinityNone, svc.Spec.SessionAffinity)
+	assert.Equal(t, "etcd.example.com", svc.Annotations["external-dns.alpha.kubernetes.io/hostname"])
+	assert.Equal(t, map[string]string{"app": "test-etcd", "controller": "test-etcd"}, svc.Spec.Selector)
+	assert.Equal(t, []corev1.ServicePort{
+		{Name: "client", Port: 2379, TargetPort: intstr.FromInt32(2379), NodePort: 30379, Protocol: corev1.ProtocolTCP},
+		{Name: "grpc-proxy", Port: 23790, TargetPort: intstr.FromInt32(23790), Protocol: corev1.ProtocolTCP},
+		{Name: "gateway", Port: 80, TargetPort: intstr.FromString("gateway"), Protocol: corev1.ProtocolTCP},
+	}, svc.Spec.Ports)
+}
+
+func TestReconcileClientService(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default", UID: "ec-uid"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:          3,
+			ClientService: &ecv1alpha1.ClientService{Type: corev1.ServiceTypeNodePort},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).
+		WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	recorder := record.NewFakeRecorder(10)
+
+	assert.NoError(t, reconcileClientService(ctx, fakeClient, scheme, recorder, ec))
+	svc := &corev1.Service{}
+	key := types.NamespacedName{Name: "test-etcd-client", Namespace: "default"}
+	assert.NoError(t, fakeClient.Get(ctx, key, svc))
+	assert.True(t, metav1.IsControlledBy(svc, ec))
+	assert.Equal(t, corev1.ServiceTypeNodePort, svc.Spec.Type)
+
+	// A Service of the same name the operator doesn't control is kept.
+	ec.Spec.ClientService = nil
+	other := ec.DeepCopy()
+	other.UID = "other-uid"
+	assert.NoError(t, reconcileClientService(ctx, fakeClient, scheme, recorder, other))
+	assert.NoError(t, fakeClient.Get(ctx, key, svc))
+
+	assert.NoError(t, reconcileClientService(ctx, fakeClient, scheme, recorder, ec))
+	err := fakeClient.Get(ctx, key, svc)
+	assert.True(t, k8serrors.IsNotFound(err))
+
+	// Nothing to delete.
+	assert.NoError(t, reconcileClientService(ctx, fakeClient, scheme, recorder, ec))
+}
+
+func TestNewMemberService(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size: 3,
+			MemberServices: &ecv1alpha1.MemberServices{
+				Type:        corev1.ServiceTypeLoadBalancer,
+				Annotations: map[string]string{"external-dns.alpha.kubernetes.io/hostname": "$(MEMBER_NAME).etcd.example.com"},
+			},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	svc := newMemberService(ec, 1)
+	assert.Equal(t, "test-etcd-1-svc", svc.Name)
+	assert.Equal(t, corev1.ServiceTypeLoadBalancer, svc.Spec.Type)
+	assert.Equal(t, "test-etcd-1.etcd.example.com", svc.Annotations["external-dns.alpha.kubernetes.io/hostname"])
+	assert.Equal(t, "test-etcd-1", svc.Spec.Selector[appsv1.StatefulSetPodNameLabel])
+	assert.True(t, svc.Spec.PublishNotReadyAddresses)
+	assert.Equal(t, []corev1.ServicePort{
+		{Name: "client", Port: 2379, TargetPort: intstr.FromInt32(2379), Protocol: corev1.ProtocolTCP},
+		{Name: "peer", Port: 2380, TargetPort: intstr.FromInt32(2380), Protocol: corev1.ProtocolTCP},
+	}, svc.Spec.Ports)
+	// The annotations of the spec are left as they are.
+	assert.Equal(t, "$(MEMBER_NAME).etcd.example.com", ec.Spec.MemberServices.Annotations["external-dns.alpha.kubernetes.io/hostname"])
+}
+
+func TestReconcileMemberServices(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default", UID: "ec-uid"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:           3,
+			MemberServices: &ecv1alpha1.MemberServices{},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).
+		WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	recorder := record.NewFakeRecorder(10)
+
+	serviceNames := func() []string {
+		services := &corev1.ServiceList{}
+		assert.NoError(t, fakeClient.List(ctx, services))
+		var names []string
+		for _, svc := range services.Items {
+			names = append(names, svc.Name)
+		}
+		return names
+	}
+
+	// The Services of the members the cluster is scaling out to are
+	// created first.
+	assert.NoError(t, reconcileMemberServices(ctx, fakeClient, scheme, recorder, ec, 1))
+	assert.Equal(t, []string{"test-etcd-0-svc", "test-etcd-1-svc", "test-etcd-2-svc"}, serviceNames())
+
+	// The Services of the members scaled in are deleted once they are gone.
+	ec.Spec.Size = 1
+	assert.NoError(t, reconcileMemberServices(ctx, fakeClient, scheme, recorder, ec, 2))
+	assert.Equal(t, []string{"test-etcd-0-svc", "test-etcd-1-svc"}, serviceNames())
+	assert.NoError(t, reconcileMemberServices(ctx, fakeClient, scheme, recorder, ec, 1))
+	assert.Equal(t, []string{"test-etcd-0-svc"}, serviceNames())
+
+	ec.Spec.MemberServices = nil
+	assert.NoError(t, reconcileMemberServices(ctx, fakeClient, scheme, recorder, ec, 1))
+	assert.Empty(t, serviceNames())
+}
+
+func TestMemberServicesDomain(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:           3,
+			MemberServices: &ecv1alpha1.MemberServices{Domain: "etcd.example.com"},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	name, peerURLs := peerURLsForOrdinalIndex(ec, 1)
+	assert.Equal(t, "test-etcd-1", name)
+	assert.Equal(t, []string{
+		"http://test-etcd-1.test-etcd.default.svc.cluster.local:2380",
+		"http://test-etcd-1.etcd.example.com:2380",
+	}, peerURLs)
+
+	args := defaultArgs(ec)
+	assert.Contains(t, args, "--initial-advertise-peer-urls=http://$(POD_NAME).test-etcd.$(POD_NAMESPACE).svc.cluster.local:2380,"+
+		"http://$(POD_NAME).etcd.example.com:2380")
+	assert.Contains(t, args, "--advertise-client-urls=http://$(POD_NAME).test-etcd.$(POD_NAMESPACE).svc.cluster.local:2379,"+
+		"http://$(POD_NAME).etcd.example.com:2379")
+
+	cm := newEtcdClusterState(ec, 1)
+	assert.Equal(t, "test-etcd-0=http://test-etcd-0.test-etcd.default.svc.cluster.local:2380,"+
+		"test-etcd-0=http://test-etcd-0.etcd.example.com:2380", cm.Data["ETCD_INITIAL_CLUSTER"])
+
+	ec.Spec.TLS = &ecv1alpha1.TLSCertificate{Provider: ecv1alpha1.TLSProviderAuto}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	req := memberCertificateRequest(ec, peerCertificate, "test-etcd-1")
+	assert.Contains(t, req.DNSNames, "test-etcd-1.etcd.example.com")
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// Shard selects the EtcdClusters reconciled by an instance of the operator,
+// when several instances split the EtcdClusters between them. The zero value
+// selects all the EtcdClusters.
+type Shard struct {
+	// Count is the number of shards.
+	Count int
+	// Index is the index of the shard of this instance, from 0 to Count-1.
+	Index int
+	// Selector restricts the shard to the EtcdClusters whose labels match
+	// it. All the EtcdClusters match when nil.
+	Selector labels.Selector
+}
+
+// owns reports whether the EtcdCluster obj belongs to the shard. It must
+// match the Selector, then it belongs to the shard set by its ShardLabel, or
+// else to the one selected by a hash of its namespace and name.
+func (s Shard) owns(obj metav1.Object) bool {
+	if s.Selector != nil && !s.Selector.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+	if s.Count <= 1 {
+		return true
+	}
+	if value, ok := obj.GetLabels()[ecv1alpha1.ShardLabel]; ok {
+		if index, err := strconv.Atoi(value); err == nil && index >= 0 && index < s.Count {
+			return index == s.Index
+		}
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(obj.GetNamespace() + "/" + obj.GetName()))
+	return int(h.Sum32()%uint32(s.Count)) == s.Index
+}
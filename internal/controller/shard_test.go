@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestShardOwns(t *testing.T) {
+	newCluster := func(name string, labels map[string]string) *ecv1alpha1.EtcdCluster {
+		return &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels}}
+	}
+
+	t.Run("unsharded", func(t *testing.T) {
+		assert.True(t, Shard{}.owns(newCluster("test", nil)))
+	})
+
+	t.Run("every cluster belongs to exactly one shard", func(t *testing.T) {
+		counts := make([]int, 3)
+		for i := 0; i < 100; i++ {
+			ec := newCluster(fmt.Sprintf("test-%d", i), nil)
+			owners := 0
+			for index := range counts {
+				if (Shard{Count: len(counts), Index: index}).owns(ec) {
+					owners++
+					counts[index]++
+				}
+			}
+			assert.Equal(t, 1, owners, ec.Name)
+		}
+		for index, count := range counts {
+			assert.NotZero(t, count, "shard %d owns no cluster", index)
+		}
+	})
+
+	t.Run("shard label", func(t *testing.T) {
+		ec := newCluster("test", map[string]string{ecv1alpha1.ShardLabel: "2"})
+		assert.True(t, Shard{Count: 3, Index: 2}.owns(ec))
+		assert.False(t, Shard{Count: 3, Index: 0}.owns(ec))
+		assert.False(t, Shard{Count: 3, Index: 1}.owns(ec))
+	})
+
+	t.Run("invalid shard label falls back to the hash", func(t *testing.T) {
+		labeled := newCluster("test", map[string]string{ecv1alpha1.ShardLabel: "5"})
+		unlabeled := newCluster("test", nil)
+		for index := 0; index < 3; index++ {
+			shard := Shard{Count: 3, Index: index}
+			assert.Equal(t, shard.owns(unlabeled), shard.owns(labeled))
+		}
+	})
+
+	t.Run("selector", func(t *testing.T) {
+		selector, err := labels.Parse("tier=canary,team!=legacy")
+		assert.NoError(t, err)
+		shard := Shard{Selector: selector}
+		assert.True(t, shard.owns(newCluster("test", map[string]string{"tier": "canary"})))
+		assert.False(t, shard.owns(newCluster("test", map[string]string{"tier": "canary", "team": "legacy"})))
+		assert.False(t, shard.owns(newCluster("test", nil)))
+
+		// The selected clusters are still split between the shards.
+		ec := newCluster("test", map[string]string{"tier": "canary", ecv1alpha1.ShardLabel: "1"})
+		assert.True(t, Shard{Count: 2, Index: 1, Selector: selector}.owns(ec))
+		assert.False(t, Shard{Count: 2, Index: 0, Selector: selector}.owns(ec))
+	})
+}
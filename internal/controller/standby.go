@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// StandbyWarmer keeps the replicas of the operator waiting for the leadership
+// ready to take over: it syncs the caches of all the resources watched by
+// the EtcdCluster controller, and opens the connections to the etcd clusters,
+// so a new leader doesn't have to list them all before reconciling.
+type StandbyWarmer struct {
+	Cache       cache.Cache
+	EtcdClients *etcdutils.ClientPool
+	// Shard selects the EtcdClusters whose connections are opened.
+	Shard Shard
+	// RestrictedRBAC must match the EtcdClusterReconciler, to skip the
+	// resources it doesn't watch.
+	RestrictedRBAC bool
+	// Interval is how often the connections of new EtcdClusters are opened.
+	Interval time.Duration
+
+	warmed map[string]bool
+}
+
+// Start syncs the caches, then opens the connections to the etcd clusters
+// every Interval until ctx is done.
+func (w *StandbyWarmer) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("standby-warmer")
+	for _, obj := range w.watchedObjects() {
+		if _, err := w.Cache.GetInformer(ctx, obj); err != nil {
+			return err
+		}
+	}
+	if !w.Cache.WaitForCacheSync(ctx) {
+		return nil
+	}
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		w.warmClients(ctx, w.Cache, logger)
+	}, w.Interval)
+	return nil
+}
+
+// NeedLeaderElection makes the StandbyWarmer run on all the replicas, which
+// is its purpose.
+func (w *StandbyWarmer) NeedLeaderElection() bool {
+	return false
+}
+
+// watchedObjects lists the resources watched by the EtcdCluster controller.
+func (w *StandbyWarmer) watchedObjects() []client.Object {
+	objs := []client.Object{
+		&ecv1alpha1.EtcdCluster{},
+		&appsv1.StatefulSet{},
+		&corev1.Service{},
+		&corev1.ConfigMap{},
+		&ecv1alpha1.EtcdClusterOverride{},
+	}
+	if !w.RestrictedRBAC {
+		objs = append(objs, &ecv1alpha1.EtcdClusterTemplate{})
+	}
+	return objs
+}
+
+// warmClients opens the connections to the members of the EtcdClusters of
+// the shard, and closes the ones of the EtcdClusters deleted since the last
+// call.
+func (w *StandbyWarmer) warmClients(ctx context.Context, c client.Reader, logger logr.Logger) {
+	clusters := &ecv1alpha1.EtcdClusterList{}
+	if err := c.List(ctx, clusters); err != nil {
+		logger.Error(err, "Failed to list the EtcdClusters")
+		return
+	}
+
+	warmed := map[string]bool{}
+	for _, ec := range clusters.Items {
+		if !w.Shard.owns(&ec) {
+			continue
+		}
+		name := client.ObjectKeyFromObject(&ec).String()
+		warmed[name] = true
+		sts := &appsv1.StatefulSet{}
+		if err := c.Get(ctx, client.ObjectKey{Name: ec.Name, Namespace: ec.Namespace}, sts); err != nil || sts.Spec.Replicas == nil {
+			continue
+		}
+		tlsConfig, err := clusterTLSConfig(ctx, c, &ec)
+		if err != nil {
+			continue
+		}
+		creds, err := clusterCredentials(ctx, c, &ec)
+		if err != nil {
+			continue
+		}
+		if err := w.EtcdClients.Warm(name, clientEndpointsFromStatefulsets(sts), tlsConfig, creds); err != nil {
+			logger.Error(err, "Failed to connect to the EtcdCluster", "etcdCluster", name)
+		}
+	}
+
+	for name := range w.warmed {
+		if !warmed[name] {
+			w.EtcdClients.Close(name)
+		}
+	}
+	w.warmed = warmed
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func TestStandbyWarmerStart(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	for _, restricted := range []bool{false, true} {
+		informers := &informertest.FakeInformers{Scheme: scheme}
+		w := &StandbyWarmer{Cache: informers, RestrictedRBAC: restricted}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.NoError(t, w.Start(ctx))
+
+		gvk, err := apiutil.GVKForObject(&ecv1alpha1.EtcdClusterTemplate{}, scheme)
+		assert.NoError(t, err)
+		assert.Len(t, informers.InformersByGVK, len(w.watchedObjects()))
+		assert.Equal(t, !restricted, informers.InformersByGVK[gvk] != nil)
+	}
+}
+
+func TestStandbyWarmerWarmClients(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{
+		Name:      "test",
+		Namespace: "default",
+		Labels:    map[string]string{ecv1alpha1.ShardLabel: "0"},
+	}}
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: ptr.To[int32](3)},
+	}
+	other := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{
+		Name:      "other",
+		Namespace: "default",
+		Labels:    map[string]string{ecv1alpha1.ShardLabel: "1"},
+	}}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec, sts, other).Build()
+
+	pool := etcdutils.NewClientPool()
+	defer pool.CloseAll()
+	w := &StandbyWarmer{EtcdClients: pool, Shard: Shard{Count: 2, Index: 0}}
+
+	w.warmClients(context.Background(), fakeClient, logr.Discard())
+	// The clusters of the other shards are skipped.
+	assert.Equal(t, map[string]bool{"default/test": true}, w.warmed)
+
+	assert.NoError(t, fakeClient.Delete(context.Background(), ec))
+	w.warmClients(context.Background(), fakeClient, logr.Discard())
+	assert.Empty(t, w.warmed)
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// statusPatcher coalesces the changes made to the status of an EtcdCluster
+// during a reconcile into as few writes as possible, usually a single one at
+// the end of the reconcile.
+type statusPatcher struct {
+	client client.Client
+	// base is the EtcdCluster as of the last write of its status.
+	base *ecv1alpha1.EtcdCluster
+}
+
+func newStatusPatcher(c client.Client, ec *ecv1alpha1.EtcdCluster) *statusPatcher {
+	return &statusPatcher{client: c, base: ec.DeepCopy()}
+}
+
+// patch writes the changes of the status of ec since the last write, as a
+// merge patch of the status subresource. Nothing is written when the status
+// didn't change.
+func (p *statusPatcher) patch(ctx context.Context, ec *ecv1alpha1.EtcdCluster) error {
+	if equality.Semantic.DeepEqual(p.base.Status, ec.Status) {
+		return nil
+	}
+
+	// Only patch the status: ec may hold in-memory values of its spec, such as
+	// the ones of its template.
+	obj := p.base.DeepCopy()
+	obj.Status = *ec.Status.DeepCopy()
+	if err := p.client.Status().Patch(ctx, obj, client.MergeFrom(p.base)); err != nil {
+		return err
+	}
+	// Keep the status as stored, e.g. with its timestamps truncated to the
+	// second, so that the next comparison isn't thrown off.
+	ec.ResourceVersion = obj.ResourceVersion
+	ec.Status = *obj.Status.DeepCopy()
+	p.base = obj
+	return nil
+}
+
+// setEndpointsStatus records the client endpoints of the members of sts in
+// the status of ec, whose cluster has elected a leader.
+func setEndpointsStatus(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) {
+	ec.Status.Endpoints = strings.Join(clientEndpointsFromStatefulsets(sts), ",")
+	ec.Status.Initialized = true
+}
+
+// memberName returns the name of m, a member of the cluster. The learners
+// that didn't start yet have no name, they are named after the Pod of their
+// peer URL.
+func memberName(m *etcdserverpb.Member) string {
+	name := m.Name
+	if name == "" && len(m.PeerURLs) > 0 {
+		if u, err := url.Parse(m.PeerURLs[0]); err == nil {
+			name, _, _ = strings.Cut(u.Hostname(), ".")
+		}
+	}
+	return name
+}
+
+// memberNameByID returns the name of the member of resp with id, or its
+// hexadecimal ID when it isn't in resp, or has no name yet.
+func memberNameByID(resp *clientv3.MemberListResponse, id uint64) string {
+	if resp != nil {
+		if idx := slices.IndexFunc(resp.Members, func(m *etcdserverpb.Member) bool { return m.ID == id }); idx >= 0 {
+			if name := memberName(resp.Members[idx]); name != "" {
+				return name
+			}
+		}
+	}
+	return strconv.FormatUint(id, 16)
+}
+
+// setLearnersStatus records the names of the learners of resp, the member
+// list of the cluster of ec, in its status.
+func setLearnersStatus(ec *ecv1alpha1.EtcdCluster, resp *clientv3.MemberListResponse) {
+	var learners []string
+	if resp != nil {
+		for _, m := range resp.Members {
+			if m.IsLearner {
+				learners = append(learners, memberName(m))
+			}
+		}
+	}
+	ec.Status.Learners = learners
+}
+
+// setMembersStatus records the members of resp, the member list of the
+// cluster of ec, in its status, along with what healthInfos, the result of
+// their health check, reports about them: the leader, and how many members
+// are ready. zones are the zones of the members, by name.
+func setMembersStatus(ec *ecv1alpha1.EtcdCluster, resp *clientv3.MemberListResponse, healthInfos []etcdutils.EpHealth, zones map[string]string) {
+	var ready int32
+	for _, h := range healthInfos {
+		if h.Health {
+			ready++
+		}
+	}
+	ec.Status.ReadyMembers = ready
+	ec.Status.Leader = ""
+
+	var members []ecv1alpha1.MemberStatus
+	if resp != nil {
+		for _, m := range resp.Members {
+			member := ecv1alpha1.MemberStatus{
+				Name:       memberName(m),
+				ID:         strconv.FormatUint(m.ID, 16),
+				PeerURLs:   m.PeerURLs,
+				ClientURLs: m.ClientURLs,
+				IsLearner:  m.IsLearner,
+			}
+			member.Zone = zones[member.Name]
+			for _, h := range healthInfos {
+				if h.Status == nil {
+					continue
+				}
+				if h.Status.Leader == m.ID {
+					member.IsLeader = true
+				}
+				if h.Status.Header.MemberId == m.ID {
+					member.Version = h.Status.Version
+					member.DBSize = h.Status.DbSize
+					member.DBSizeInUse = h.Status.DbSizeInUse
+					member.RaftAppliedIndex = int64(h.Status.RaftAppliedIndex)
+				}
+			}
+			if member.IsLeader {
+				ec.Status.Leader = member.Name
+			}
+			members = append(members, member)
+		}
+	}
+	ec.Status.Members = members
+}
+
+// setPhaseStatus summarizes the conditions of ec in the phase of its status,
+// the most pressing first.
+func setPhaseStatus(ec *ecv1alpha1.EtcdCluster) {
+	if !ec.DeletionTimestamp.IsZero() {
+		// Without finalizers, the EtcdCluster is gone along with its status.
+		if len(ec.Finalizers) > 0 {
+			ec.Status.Phase = ecv1alpha1.EtcdClusterPhaseDeleting
+		}
+		return
+	}
+	conditions := ec.Status.Conditions
+	available := meta.FindStatusCondition(conditions, ecv1alpha1.EtcdClusterConditionAvailable)
+	switch {
+	case meta.IsStatusConditionTrue(conditions, ecv1alpha1.EtcdClusterConditionSpecInvalid):
+		ec.Status.Phase = ecv1alpha1.EtcdClusterPhaseInvalid
+	case meta.IsStatusConditionTrue(conditions, ecv1alpha1.EtcdClusterConditionPaused):
+		ec.Status.Phase = ecv1alpha1.EtcdClusterPhasePaused
+	case available == nil || available.Status != metav1.ConditionTrue && !ec.Status.Initialized:
+		ec.Status.Phase = ecv1alpha1.EtcdClusterPhasePending
+	case available.Status != metav1.ConditionTrue:
+		ec.Status.Phase = ecv1alpha1.EtcdClusterPhaseUnavailable
+	case meta.IsStatusConditionTrue(conditions, ecv1alpha1.EtcdClusterConditionDegraded):
+		ec.Status.Phase = ecv1alpha1.EtcdClusterPhaseDegraded
+	case meta.IsStatusConditionTrue(conditions, ecv1alpha1.EtcdClusterConditionUpgrading):
+		ec.Status.Phase = ecv1alpha1.EtcdClusterPhaseUpgrading
+	case meta.IsStatusConditionTrue(conditions, ecv1alpha1.EtcdClusterConditionScalingUp),
+		meta.IsStatusConditionTrue(conditions, ecv1alpha1.EtcdClusterConditionScalingDown):
+		ec.Status.Phase = ecv1alpha1.EtcdClusterPhaseScaling
+	default:
+		ec.Status.Phase = ecv1alpha1.EtcdClusterPhaseRunning
+	}
+}
+
+// ignoreMembersStatusUpdates filters out the updates of EtcdClusters only
+// changing the status of their members, which is refreshed on each
+// reconcile, e.g. with the raft index of the members: they would otherwise
+// trigger the next reconcile right away.
+var ignoreMembersStatusUpdates = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldEc, okOld := e.ObjectOld.(*ecv1alpha1.EtcdCluster)
+		newEc, okNew := e.ObjectNew.(*ecv1alpha1.EtcdCluster)
+		if !okOld || !okNew {
+			return true
+		}
+		oldEc, newEc = oldEc.DeepCopy(), newEc.DeepCopy()
+		for _, ec := range []*ecv1alpha1.EtcdCluster{oldEc, newEc} {
+			ec.ResourceVersion = ""
+			ec.ManagedFields = nil
+			ec.Status.Members = nil
+		}
+		return !equality.Semantic.DeepEqual(oldEc, newEc)
+	},
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func TestStatusPatcher(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	ec := newPlanTestCluster(3, "v3.5.21")
+	patches := 0
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ec).WithStatusSubresource(ec).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				patches++
+				return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(ec), ec))
+
+	status := newStatusPatcher(fakeClient, ec)
+	// Nothing changed, nothing is written.
+	assert.NoError(t, status.patch(ctx, ec))
+	assert.Equal(t, 0, patches)
+
+	// The changes are coalesced into a single patch, which leaves the
+	// in-memory changes of the spec out.
+	setPausedCondition(ec, false)
+	setSpecInvalidCondition(ec, nil)
+	ec.Spec.Size = 5
+	assert.NoError(t, status.patch(ctx, ec))
+	assert.Equal(t, 1, patches)
+
+	stored := &ecv1alpha1.EtcdCluster{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(ec), stored))
+	assert.Len(t, stored.Status.Conditions, 2)
+	assert.Equal(t, 3, stored.Spec.Size)
+	assert.Equal(t, stored.ResourceVersion, ec.ResourceVersion)
+
+	// Setting the same conditions again is a no-op.
+	setPausedCondition(ec, false)
+	assert.NoError(t, status.patch(ctx, ec))
+	assert.Equal(t, 1, patches)
+
+	ec.Status.InProgressOperation = &ecv1alpha1.MemberOperation{Type: actionScaleIn, StartTime: metav1.Now()}
+	assert.NoError(t, status.patch(ctx, ec))
+	assert.Equal(t, 2, patches)
+}
+
+func TestSetEndpointsStatus(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: ec.Name, Namespace: ec.Namespace},
+		Spec:       appsv1.StatefulSetSpec{Replicas: pointerToInt32(2)},
+	}
+
+	setEndpointsStatus(ec, sts)
+	assert.True(t, ec.Status.Initialized)
+	assert.Equal(t, clientEndpointForOrdinalIndex(sts, 0)+","+clientEndpointForOrdinalIndex(sts, 1), ec.Status.Endpoints)
+}
+
+func TestSetLearnersStatus(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Status.Learners = []string{"test-etcd-1"}
+
+	setLearnersStatus(ec, &clientv3.MemberListResponse{
+		Members: []*etcdserverpb.Member{
+			{ID: 1, Name: "test-etcd-0"},
+			{ID: 2, Name: "test-etcd-1"},
+			{ID: 3, PeerURLs: []string{"http://test-etcd-2.test-etcd.default.svc.cluster.local:2380"}, IsLearner: true},
+		},
+	})
+	assert.Equal(t, []string{"test-etcd-2"}, ec.Status.Learners)
+
+	setLearnersStatus(ec, nil)
+	assert.Empty(t, ec.Status.Learners)
+}
+
+func TestMemberNameByID(t *testing.T) {
+	resp := &clientv3.MemberListResponse{
+		Members: []*etcdserverpb.Member{
+			{ID: 1, Name: "test-etcd-0"},
+			{ID: 2, PeerURLs: []string{"http://test-etcd-1.test-etcd.default.svc.cluster.local:2380"}, IsLearner: true},
+			{ID: 3},
+		},
+	}
+	assert.Equal(t, "test-etcd-0", memberNameByID(resp, 1))
+	assert.Equal(t, "test-etcd-1", memberNameByID(resp, 2))
+	assert.Equal(t, "3", memberNameByID(resp, 3))
+	assert.Equal(t, "ab", memberNameByID(resp, 0xab))
+	assert.Equal(t, "ab", memberNameByID(nil, 0xab))
+}
+
+func TestSetMembersStatus(t *testing.T) {
+	ec := newPlanTestCluster(3, "v3.5.21")
+	members := &clientv3.MemberListResponse{
+		Members: []*etcdserverpb.Member{
+			{ID: 0xa1, Name: "test-etcd-0", PeerURLs: []string{"http://test-etcd-0:2380"}, ClientURLs: []string{"http://test-etcd-0:2379"}},
+			{ID: 0xb2, Name: "test-etcd-1"},
+			{ID: 0xc3, PeerURLs: []string{"http://test-etcd-2.test-etcd.default.svc.cluster.local:2380"}, IsLearner: true},
+		},
+	}
+	healthInfos := []etcdutils.EpHealth{
+		{Ep: "test-etcd-0", Health: true, Status: &clientv3.StatusResponse{
+			Header: &etcdserverpb.ResponseHeader{MemberId: 0xa1}, Leader: 0xb2,
+			Version: "3.5.21", DbSize: 4096, DbSizeInUse: 2048, RaftAppliedIndex: 42,
+		}},
+		{Ep: "test-etcd-1", Error: "context deadline exceeded"},
+	}
+
+	setMembersStatus(ec, members, healthInfos, map[string]string{"test-etcd-0": "zone-a", "test-etcd-2": "zone-b"})
+	assert.Equal(t, []ecv1alpha1.MemberStatus{
+		{
+			Name: "test-etcd-0", ID: "a1", PeerURLs: []string{"http://test-etcd-0:2380"}, ClientURLs: []string{"http://test-etcd-0:2379"},
+			Zone: "zone-a", Version: "3.5.21", DBSize: 4096, DBSizeInUse: 2048, RaftAppliedIndex: 42,
+		},
+		{Name: "test-etcd-1", ID: "b2", IsLeader: true},
+		{Name: "test-etcd-2", ID: "c3", PeerURLs: []string{"http://test-etcd-2.test-etcd.default.svc.cluster.local:2380"}, IsLearner: true, Zone: "zone-b"},
+	}, ec.Status.Members)
+	assert.Equal(t, "test-etcd-1", ec.Status.Leader)
+	assert.Equal(t, int32(1), ec.Status.ReadyMembers)
+
+	// The members are forgotten while the cluster doesn't respond.
+	setMembersStatus(ec, nil, nil, nil)
+	assert.Empty(t, ec.Status.Members)
+	assert.Empty(t, ec.Status.Leader)
+	assert.Zero(t, ec.Status.ReadyMembers)
+}
+
+func TestIgnoreMembersStatusUpdates(t *testing.T) {
+	oldEc := newPlanTestCluster(3, "v3.5.21")
+	oldEc.Status.Members = []ecv1alpha1.MemberStatus{{Name: "test-etcd-0", ID: "a1", RaftAppliedIndex: 42}}
+
+	newEc := oldEc.DeepCopy()
+	newEc.ResourceVersion = "2"
+	newEc.Status.Members[0].RaftAppliedIndex = 43
+	assert.False(t, ignoreMembersStatusUpdates.Update(event.UpdateEvent{ObjectOld: oldEc, ObjectNew: newEc}))
+
+	newEc.Status.Learners = []string{"test-etcd-2"}
+	assert.True(t, ignoreMembersStatusUpdates.Update(event.UpdateEvent{ObjectOld: oldEc, ObjectNew: newEc}))
+
+	newEc = oldEc.DeepCopy()
+	newEc.Spec.Size = 5
+	assert.True(t, ignoreMembersStatusUpdates.Update(event.UpdateEvent{ObjectOld: oldEc, ObjectNew: newEc}))
+}
+
+func TestSetPhaseStatus(t *testing.T) {
+	condition := func(conditionType string, status metav1.ConditionStatus) metav1.Condition {
+		return metav1.Condition{Type: conditionType, Status: status}
+	}
+	available := condition(ecv1alpha1.EtcdClusterConditionAvailable, metav1.ConditionTrue)
+	unavailable := condition(ecv1alpha1.EtcdClusterConditionAvailable, metav1.ConditionFalse)
+
+	tests := []struct {
+		name        string
+		initialized bool
+		conditions  []metav1.Condition
+		expected    ecv1alpha1.EtcdClusterPhase
+	}{
+		{
+			name:     "not checked yet",
+			expected: ecv1alpha1.EtcdClusterPhasePending,
+		},
+		{
+			name:       "never elected a leader",
+			conditions: []metav1.Condition{unavailable},
+			expected:   ecv1alpha1.EtcdClusterPhasePending,
+		},
+		{
+			name:        "lost its leader",
+			initialized: true,
+			conditions:  []metav1.Condition{unavailable, condition(ecv1alpha1.EtcdClusterConditionScalingUp, metav1.ConditionTrue)},
+			expected:    ecv1alpha1.EtcdClusterPhaseUnavailable,
+		},
+		{
+			name:       "invalid first",
+			conditions: []metav1.Condition{unavailable, condition(ecv1alpha1.EtcdClusterConditionSpecInvalid, metav1.ConditionTrue)},
+			expected:   ecv1alpha1.EtcdClusterPhaseInvalid,
+		},
+		{
+			name:       "paused",
+			conditions: []metav1.Condition{available, condition(ecv1alpha1.EtcdClusterConditionPaused, metav1.ConditionTrue)},
+			expected:   ecv1alpha1.EtcdClusterPhasePaused,
+		},
+		{
+			name:        "degraded while scaling",
+			initialized: true,
+			conditions: []metav1.Condition{
+				available, condition(ecv1alpha1.EtcdClusterConditionDegraded, metav1.ConditionTrue),
+				condition(ecv1alpha1.EtcdClusterConditionScalingDown, metav1.ConditionTrue),
+			},
+			expected: ecv1alpha1.EtcdClusterPhaseDegraded,
+		},
+		{
+			name:        "upgrading",
+			initialized: true,
+			conditions:  []metav1.Condition{available, condition(ecv1alpha1.EtcdClusterConditionUpgrading, metav1.ConditionTrue)},
+			expected:    ecv1alpha1.EtcdClusterPhaseUpgrading,
+		},
+		{
+			name:        "scaling",
+			initialized: true,
+			conditions:  []metav1.Condition{available, condition(ecv1alpha1.EtcdClusterConditionScalingUp, metav1.ConditionTrue)},
+			expected:    ecv1alpha1.EtcdClusterPhaseScaling,
+		},
+		{
+			name:        "running",
+			initialized: true,
+			conditions:  []metav1.Condition{available, condition(ecv1alpha1.EtcdClusterConditionDegraded, metav1.ConditionFalse)},
+			expected:    ecv1alpha1.EtcdClusterPhaseRunning,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := newPlanTestCluster(3, "v3.5.21")
+			ec.Status.Initialized = tt.initialized
+			ec.Status.Conditions = tt.conditions
+			setPhaseStatus(ec)
+			assert.Equal(t, tt.expected, ec.Status.Phase)
+		})
+	}
+
+	// The phase of an EtcdCluster being deleted is only written while it
+	// has finalizers.
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Status.Phase = ecv1alpha1.EtcdClusterPhaseRunning
+	ec.DeletionTimestamp = ptr.To(metav1.Now())
+	setPhaseStatus(ec)
+	assert.Equal(t, ecv1alpha1.EtcdClusterPhaseRunning, ec.Status.Phase)
+	ec.Finalizers = []string{ecv1alpha1.DeletionProtectionFinalizer}
+	setPhaseStatus(ec)
+	assert.Equal(t, ecv1alpha1.EtcdClusterPhaseDeleting, ec.Status.Phase)
+}
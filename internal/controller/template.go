@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// applyTemplate fills in the unset fields of ec, in memory, with the values
+// of the EtcdClusterTemplate it references, if any.
+func applyTemplate(ctx context.Context, c client.Client, ec *ecv1alpha1.EtcdCluster) error {
+	if ec.Spec.TemplateRef == nil {
+		return nil
+	}
+
+	tmpl := &ecv1alpha1.EtcdClusterTemplate{}
+	if err := c.Get(ctx, client.ObjectKey{Name: ec.Spec.TemplateRef.Name}, tmpl); err != nil {
+		return fmt.Errorf("failed to get EtcdClusterTemplate %s: %w", ec.Spec.TemplateRef.Name, err)
+	}
+	ecv1alpha1.ApplyEtcdClusterTemplate(ec, tmpl)
+	return nil
+}
+
+// clustersForTemplate returns the reconcile requests of the EtcdClusters
+// referencing the EtcdClusterTemplate obj, so they pick up its changes.
+func (r *EtcdClusterReconciler) clustersForTemplate(ctx context.Context, obj client.Object) []reconcile.Request {
+	clusters := &ecv1alpha1.EtcdClusterList{}
+	if err := r.List(ctx, clusters); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list the EtcdClusters referencing the template", "template", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ec := range clusters.Items {
+		if ec.Spec.TemplateRef != nil && ec.Spec.TemplateRef.Name == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ec)})
+		}
+	}
+	return requests
+}
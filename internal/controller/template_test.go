@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestApplyTemplate(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	tmpl := &ecv1alpha1.EtcdClusterTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden"},
+		Spec: ecv1alpha1.EtcdClusterTemplateSpec{
+			Version:        "v3.5.20",
+			EtcdOptions:    []string{"--snapshot-count=5000"},
+			StorageSpec:    &ecv1alpha1.StorageSpec{VolumeSizeRequest: resource.MustParse("8Gi")},
+			DeletionPolicy: ecv1alpha1.DeletionPolicyProtect,
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tmpl).Build()
+
+	t.Run("fills in the unset fields", func(t *testing.T) {
+		ec := &ecv1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+			Spec: ecv1alpha1.EtcdClusterSpec{
+				Size:        3,
+				EtcdOptions: []string{"--quota-backend-bytes=8589934592"},
+				TemplateRef: &ecv1alpha1.EtcdClusterTemplateReference{Name: "golden"},
+			},
+		}
+		assert.NoError(t, applyTemplate(ctx, fakeClient, ec))
+		ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+		assert.Equal(t, "v3.5.20", ec.Spec.Version)
+		assert.Equal(t, []string{"--quota-backend-bytes=8589934592"}, ec.Spec.EtcdOptions)
+		assert.True(t, ec.Spec.StorageSpec.VolumeSizeRequest.Equal(resource.MustParse("8Gi")))
+		assert.Equal(t, ecv1alpha1.DeletionPolicyProtect, ec.Spec.DeletionPolicy)
+		assert.Equal(t, ecv1alpha1.DefaultClientPort, ec.Spec.Ports.Client)
+
+		// The template itself must not be modified by the defaults.
+		assert.True(t, tmpl.Spec.StorageSpec.VolumeSizeLimit.IsZero())
+	})
+
+	t.Run("missing template", func(t *testing.T) {
+		ec := &ecv1alpha1.EtcdCluster{
+			Spec: ecv1alpha1.EtcdClusterSpec{TemplateRef: &ecv1alpha1.EtcdClusterTemplateReference{Name: "missing"}},
+		}
+		assert.ErrorContains(t, applyTemplate(ctx, fakeClient, ec), "EtcdClusterTemplate missing")
+	})
+}
+
+func TestClustersForTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+
+	newCluster := func(namespace, name, template string) *ecv1alpha1.EtcdCluster {
+		ec := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if template != "" {
+			ec.Spec.TemplateRef = &ecv1alpha1.EtcdClusterTemplateReference{Name: template}
+		}
+		return ec
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newCluster("team-a", "etcd", "golden"),
+		newCluster("team-b", "etcd", "golden"),
+		newCluster("team-c", "etcd", "other"),
+		newCluster("team-d", "etcd", ""),
+	).Build()
+
+	r := &EtcdClusterReconciler{Client: fakeClient, Scheme: scheme}
+	requests := r.clustersForTemplate(context.Background(), &ecv1alpha1.EtcdClusterTemplate{ObjectMeta: metav1.ObjectMeta{Name: "golden"}})
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "etcd"}},
+		{NamespacedName: types.NamespacedName{Namespace: "team-b", Name: "etcd"}},
+	}, requests)
+}
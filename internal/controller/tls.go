@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// tlsDir is where the certificates are mounted in the Pods created by the
+// operator.
+// Each certificate has its own directory, holding the keys of its Secret.
+const tlsDir = "/etc/etcd/tls"
+
+// The certificates issued to each EtcdCluster with TLS.
+const (
+	// peerCertificate authenticates the members to each other.
+	peerCertificate = "peer"
+	// serverCertificate is served by the members to their clients.
+	serverCertificate = "server"
+	// clientCertificate authenticates the operator, and its Jobs, to the
+	// members.
+	clientCertificate = "client"
+)
+
+// certManagerGroupVersion is the API version of the cert-manager
+// Certificates. They are handled as unstructured objects, so cert-manager
+// needn't be installed when no EtcdCluster uses it.
+const certManagerGroupVersion = "cert-manager.io/v1"
+
+// urlScheme returns the scheme of the client and peer URLs of the members of
+// ec.
+func urlScheme(ec *ecv1alpha1.EtcdCluster) string {
+	if ec.Spec.TLS.Enabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// tlsSecretName returns the name of the Secret holding the given certificate
+// of ec.
+func tlsSecretName(ec *ecv1alpha1.EtcdCluster, certificate string) string {
+	return fmt.Sprintf("%s-%s-tls", ec.Name, certificate)
+}
+
+// tlsArgs returns the flags making the members of ec serve, and require, TLS
+// with the certificates mounted by tlsVolumes.
+func tlsArgs(ec *ecv1alpha1.EtcdCluster) []string {
+	if !ec.Spec.TLS.Enabled() {
+		return nil
+	}
+	server, peer := path.Join(tlsDir, serverCertificate), path.Join(tlsDir, peerCertificate)
+	certKey, keyKey := corev1.TLSCertKey, corev1.TLSPrivateKeyKey
+	if ec.Spec.TLS.Provider == ecv1alpha1.TLSProviderAuto {
+		// Each member has its own certificates, in the same Secrets.
+		certKey, keyKey = memberCertKey("$(POD_NAME)"), memberKeyKey("$(POD_NAME)")
+	}
+	return []string{
+		"--cert-file=" + path.Join(server, certKey),
+		"--key-file=" + path.Join(server, keyKey),
+		"--trusted-ca-file=" + path.Join(server, corev1.ServiceAccountRootCAKey),
+		"--client-cert-auth",
+		"--peer-cert-file=" + path.Join(peer, certKey),
+		"--peer-key-file=" + path.Join(peer, keyKey),
+		"--peer-trusted-ca-file=" + path.Join(peer, corev1.ServiceAccountRootCAKey),
+		"--peer-client-cert-auth",
+		// The probes can't present a client certificate.
+		fmt.Sprintf("--listen-metrics-urls=http://0.0.0.0:%d", ecv1alpha1.DefaultMetricsPort),
+	}
+}
+
+// tlsVolumes returns the volumes of the server and peer certificates of the
+// members of ec, and where the etcd container mounts them.
+func tlsVolumes(ec *ecv1alpha1.EtcdCluster) ([]corev1.Volume, []corev1.VolumeMount) {
+	if !ec.Spec.TLS.Enabled() {
+		return nil, nil
+	}
+	var (
+		volumes []corev1.Volume
+		mounts  []corev1.VolumeMount
+	)
+	for _, certificate := range []string{serverCertificate, peerCertificate} {
+		name := certificate + "-tls"
+		volumes = append(volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: tlsSecretName(ec, certificate)}},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: name, MountPath: path.Join(tlsDir, certificate), ReadOnly: true})
+	}
+	return volumes, mounts
+}
+
+// addClientTLS makes container, of podSpec, reach the members of ec with
+// etcdctl over TLS, with the client certificate of the operator.
+func addClientTLS(ec *ecv1alpha1.EtcdCluster, podSpec *corev1.PodSpec, container *corev1.Container) {
+	if !ec.Spec.TLS.Enabled() {
+		return
+	}
+	dir := path.Join(tlsDir, clientCertificate)
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         "client-tls",
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: tlsSecretName(ec, clientCertificate)}},
+	})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "client-tls", MountPath: dir, ReadOnly: true})
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "ETCDCTL_CACERT", Value: path.Join(dir, corev1.ServiceAccountRootCAKey)},
+		corev1.EnvVar{Name: "ETCDCTL_CERT", Value: path.Join(dir, corev1.TLSCertKey)},
+		corev1.EnvVar{Name: "ETCDCTL_KEY", Value: path.Join(dir, corev1.TLSPrivateKeyKey)},
+	)
+}
+
+// clientSchemeFromStatefulSet returns the scheme of the client URLs the
+// members of sts advertise.
+func clientSchemeFromStatefulSet(sts *appsv1.StatefulSet) string {
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		for _, arg := range c.Args {
+			if strings.HasPrefix(arg, "--advertise-client-urls=https://") {
+				return "https"
+			}
+		}
+	}
+	return "http"
+}
+
+// newCertificate returns the cert-manager Certificate of the given
+// certificate of ec. The server and peer certificates are valid for the names
+// of all the members, so they don't change when the cluster is scaled.
+func newCertificate(ec *ecv1alpha1.EtcdCluster, certificate string) *unstructured.Unstructured {
+	cfg := ec.Spec.TLS.CertManagerConfig()
+	members := fmt.Sprintf("*.%s.%s.svc", ec.Name, ec.Namespace)
+	spec := map[string]any{
+		"secretName": tlsSecretName(ec, certificate),
+		"issuerRef": map[string]any{
+			"name":  cfg.IssuerRef.Name,
+			"kind":  cfg.IssuerRef.Kind,
+			"group": cfg.IssuerRef.Group,
+		},
+		// The cache of the operator only holds the Secrets it manages.
+		"secretTemplate": map[string]any{
+			"labels": map[string]any{managedByLabel: managedByValue},
+		},
+		"privateKey": map[string]any{"rotationPolicy": "Always"},
+	}
+	switch certificate {
+	case clientCertificate:
+		spec["commonName"] = fmt.Sprintf("%s-operator", ec.Name)
+		spec["usages"] = []any{"client auth"}
+	case serverCertificate:
+		spec["commonName"] = ec.Name
+		spec["dnsNames"] = []any{members, members + ".cluster.local", fmt.Sprintf("%s.%s.svc", ec.Name, ec.Namespace), "localhost"}
+		spec["ipAddresses"] = []any{"127.0.0.1"}
+		spec["usages"] = []any{"server auth", "client auth"}
+	case peerCertificate:
+		spec["commonName"] = ec.Name
+		spec["dnsNames"] = []any{members, members + ".cluster.local"}
+		spec["usages"] = []any{"server auth", "client auth"}
+	}
+	if domain := memberServicesDomain(ec); domain != "" && certificate != clientCertificate {
+		spec["dnsNames"] = append(spec["dnsNames"].([]any), "*."+domain)
+	}
+	if ec.Spec.GRPCProxy != nil && certificate == serverCertificate {
+		spec["dnsNames"] = append(spec["dnsNames"].([]any), fmt.Sprintf("%s.%s.svc", grpcProxyName(ec), ec.Namespace))
+	}
+	if cfg.Duration != nil {
+		spec["duration"] = cfg.Duration.Duration.String()
+	}
+
+	cert := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	cert.SetAPIVersion(certManagerGroupVersion)
+	cert.SetKind("Certificate")
+	cert.SetName(tlsSecretName(ec, certificate))
+	cert.SetNamespace(ec.Namespace)
+	cert.SetLabels(map[string]string{"app": ec.Name})
+	return cert
+}
+
+// reconcileCertificates issues the certificates of ec, or requests them from
+// cert-manager, in the Kubernetes cluster running its members.
+func reconcileCertificates(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, now time.Time) error {
+	if !ec.Spec.TLS.Enabled() {
+		return nil
+	}
+	if ec.Spec.TLS.Provider == ecv1alpha1.TLSProviderAuto {
+		return reconcileAutoCertificates(ctx, c, scheme, recorder, ec, now)
+	}
+	for _, certificate := range []string{peerCertificate, serverCertificate, clientCertificate} {
+		cert := newCertificate(ec, certificate)
+		if err := setWorkloadOwner(ec, scheme, cert); err != nil {
+			return err
+		}
+		if err := applyOwnedObject(ctx, c, recorder, ec, cert); err != nil {
+			if meta.IsNoMatchError(err) {
+				return fmt.Errorf("cert-manager isn't installed: %w", err)
+			}
+			return fmt.Errorf("failed to apply the %s Certificate: %w", certificate, err)
+		}
+	}
+	return nil
+}
+
+// clusterTLSConfig returns the TLS configuration the operator reaches the
+// members of ec with, read from the Secret of its client certificate, or nil
+// when the members don't serve TLS.
+func clusterTLSConfig(ctx context.Context, c client.Reader, ec *ecv1alpha1.EtcdCluster) (*tls.Config, error) {
+	if !ec.Spec.TLS.Enabled() {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	name := tlsSecretName(ec, clientCertificate)
+	if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: ec.Namespace}, secret); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf("the client certificate isn't issued yet: Secret %s not found", name)
+		}
+		return nil, err
+	}
+	if len(secret.Data[corev1.TLSCertKey]) == 0 {
+		return nil, fmt.Errorf("the client certificate isn't issued yet: Secret %s is empty", name)
+	}
+	return tlsConfigFromSecret(secret)
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func newTLSTestCluster() *ecv1alpha1.EtcdCluster {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "default", UID: "ec-uid"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:    3,
+			Version: "v3.5.21",
+			TLS: &ecv1alpha1.TLSCertificate{
+				Provider: ecv1alpha1.TLSProviderCertManager,
+				ProviderCfg: ecv1alpha1.ProviderConfig{
+					CertManagerCfg: &ecv1alpha1.ProviderCertManagerConfig{
+						IssuerRef: ecv1alpha1.CertManagerIssuerReference{Name: "etcd-ca"},
+						Duration:  &metav1.Duration{Duration: 720 * time.Hour},
+					},
+				},
+			},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	return ec
+}
+
+// newTestCertificate returns a self-signed certificate and its key, PEM
+// encoded.
+func newTestCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "etcd-operator"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestTLSArgs(t *testing.T) {
+	ec := newTLSTestCluster()
+	args := createArgs(ec)
+	assert.Contains(t, args, "--listen-client-urls=https://0.0.0.0:2379")
+	assert.Contains(t, args, "--advertise-client-urls=https://$(POD_NAME).etcd.$(POD_NAMESPACE).svc.cluster.local:2379")
+	assert.Contains(t, args, "--initial-advertise-peer-urls=https://$(POD_NAME).etcd.$(POD_NAMESPACE).svc.cluster.local:2380")
+	assert.Contains(t, args, "--cert-file=/etc/etcd/tls/server/tls.crt")
+	assert.Contains(t, args, "--trusted-ca-file=/etc/etcd/tls/server/ca.crt")
+	assert.Contains(t, args, "--peer-key-file=/etc/etcd/tls/peer/tls.key")
+	assert.Contains(t, args, "--peer-client-cert-auth")
+	assert.Contains(t, args, "--listen-metrics-urls=http://0.0.0.0:2381")
+
+	_, peerURL := peerEndpointForOrdinalIndex(ec, 1)
+	assert.Equal(t, "https://etcd-1.etcd.default.svc.cluster.local:2380", peerURL)
+	assert.Equal(t, "https://etcd-0.etcd.default.svc.cluster.local:2379", clientEndpointsFromEtcdCluster(ec)[0])
+
+	ec.Spec.TLS = nil
+	assert.Nil(t, tlsArgs(ec))
+	volumes, mounts := tlsVolumes(ec)
+	assert.Nil(t, volumes)
+	assert.Nil(t, mounts)
+}
+
+func TestTLSVolumes(t *testing.T) {
+	ec := newTLSTestCluster()
+	volumes, mounts := tlsVolumes(ec)
+	assert.Equal(t, []corev1.Volume{
+		{Name: "server-tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "etcd-server-tls"}}},
+		{Name: "peer-tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "etcd-peer-tls"}}},
+	}, volumes)
+	assert.Equal(t, []corev1.VolumeMount{
+		{Name: "server-tls", MountPath: "/etc/etcd/tls/server", ReadOnly: true},
+		{Name: "peer-tls", MountPath: "/etc/etcd/tls/peer", ReadOnly: true},
+	}, mounts)
+
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "etcdctl"}}}
+	addClientTLS(ec, podSpec, &podSpec.Containers[0])
+	assert.Equal(t, "etcd-client-tls", podSpec.Volumes[0].Secret.SecretName)
+	assert.Equal(t, "/etc/etcd/tls/client", podSpec.Containers[0].VolumeMounts[0].MountPath)
+	assert.Contains(t, podSpec.Containers[0].Env, corev1.EnvVar{Name: "ETCDCTL_CERT", Value: "/etc/etcd/tls/client/tls.crt"})
+}
+
+func TestNewCertificate(t *testing.T) {
+	ec := newTLSTestCluster()
+
+	server := newCertificate(ec, serverCertificate)
+	assert.Equal(t, "Certificate", server.GetKind())
+	assert.Equal(t, "etcd-server-tls", server.GetName())
+	secretName, _, _ := unstructured.NestedString(server.Object, "spec", "secretName")
+	assert.Equal(t, "etcd-server-tls", secretName)
+	issuer, _, _ := unstructured.NestedStringMap(server.Object, "spec", "issuerRef")
+	assert.Equal(t, map[string]string{"name": "etcd-ca", "kind": "Issuer", "group": "cert-manager.io"}, issuer)
+	dnsNames, _, _ := unstructured.NestedStringSlice(server.Object, "spec", "dnsNames")
+	assert.Equal(t, []string{
+		"*.etcd.default.svc", "*.etcd.default.svc.cluster.local", "etcd.default.svc", "localhost",
+	}, dnsNames)
+	duration, _, _ := unstructured.NestedString(server.Object, "spec", "duration")
+	assert.Equal(t, "720h0m0s", duration)
+
+	client := newCertificate(ec, clientCertificate)
+	commonName, _, _ := unstructured.NestedString(client.Object, "spec", "commonName")
+	assert.Equal(t, "etcd-operator", commonName)
+	usages, _, _ := unstructured.NestedStringSlice(client.Object, "spec", "usages")
+	assert.Equal(t, []string{"client auth"}, usages)
+	_, found, _ := unstructured.NestedSlice(client.Object, "spec", "dnsNames")
+	assert.False(t, found)
+}
+
+func TestClusterTLSConfig(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	ec := newTLSTestCluster()
+
+	cfg, err := clusterTLSConfig(ctx, fake.NewClientBuilder().WithScheme(scheme).Build(), &ecv1alpha1.EtcdCluster{})
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	_, err = clusterTLSConfig(ctx, fake.NewClientBuilder().WithScheme(scheme).Build(), ec)
+	assert.EqualError(t, err, "the client certificate isn't issued yet: Secret etcd-client-tls not found")
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "etcd-client-tls", Namespace: "default"}}
+	_, err = clusterTLSConfig(ctx, fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build(), ec)
+	assert.EqualError(t, err, "the client certificate isn't issued yet: Secret etcd-client-tls is empty")
+
+	cert, key := newTestCertificate(t)
+	secret.Data = map[string][]byte{
+		corev1.ServiceAccountRootCAKey: cert,
+		corev1.TLSCertKey:              cert,
+		corev1.TLSPrivateKeyKey:        key,
+	}
+	cfg, err = clusterTLSConfig(ctx, fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build(), ec)
+	assert.NoError(t, err)
+	assert.NotNil(t, cfg.RootCAs)
+	assert.Len(t, cfg.Certificates, 1)
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// statefulSetVersion returns the etcd version of the pod template of sts, or
+// an empty string if it has no etcd container.
+func statefulSetVersion(sts *appsv1.StatefulSet) string {
+	etcd := findContainer(sts.Spec.Template.Spec.Containers, "etcd")
+	if etcd == nil {
+		return ""
+	}
+	i := strings.LastIndex(etcd.Image, ":")
+	if i < 0 {
+		return ""
+	}
+	return etcd.Image[i+1:]
+}
+
+// statefulSetPartition returns the ordinal from which the pods of sts run
+// its latest pod template.
+func statefulSetPartition(sts *appsv1.StatefulSet) int32 {
+	if rollingUpdate := sts.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil {
+		return ptr.Deref(rollingUpdate.Partition, 0)
+	}
+	return 0
+}
+
+// setStatefulSetPartition restricts the rollout of the pod template of sts to
+// the pods from the partition ordinal. The partition isn't part of the
+// StatefulSet applied by applyStatefulSet, so it is kept when the StatefulSet
+// is applied again.
+func setStatefulSetPartition(ctx context.Context, c client.Client, sts *appsv1.StatefulSet, partition int32) error {
+	patch := client.MergeFrom(sts.DeepCopy())
+	sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+		Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+	}
+	if err := c.Patch(ctx, sts, patch); err != nil {
+		return fmt.Errorf("failed to set the partition of StatefulSet %s/%s: %w", sts.Namespace, sts.Name, err)
+	}
+	return nil
+}
+
+// statefulSetUpdated reports whether the StatefulSet controller observed the
+// latest spec of sts, at least updated of its pods run the latest pod
+// template, and all its pods are ready.
+func statefulSetUpdated(sts *appsv1.StatefulSet, updated int32) bool {
+	return sts.Status.ObservedGeneration >= sts.Generation &&
+		sts.Status.UpdatedReplicas >= updated &&
+		sts.Status.ReadyReplicas == ptr.Deref(sts.Spec.Replicas, 0)
+}
+
+// pinVersion sets the version of ec to the version its members run, the one
+// of the pod template of sts, and returns the version of the spec. Only
+// reconcileUpgrade moves the members to the version of the spec, one at a
+// time, so applying the StatefulSet for any other reason, e.g. to scale it,
+// doesn't restart all the members with another version at once. The members
+// stopped to recover the quorum restart with the version they ran.
+func pinVersion(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) string {
+	target := ec.Spec.Version
+	if running := statefulSetVersion(sts); running != "" && (ptr.Deref(sts.Spec.Replicas, 0) > 0 || recoveringQuorum(ec)) {
+		ec.Spec.Version = running
+	}
+	return target
+}
+
+// reconcileUpgrade upgrades the members of ec, run by sts, to the target
+// version one at a time, from the highest ordinal, and records the progress
+// in the Upgrading condition. It must only be called once the membership of
+// the cluster matches sts and its members passed the health check, so each
+// member is only upgraded once the previous one is back and healthy. It
+// returns whether an upgrade is in progress, in which case the other changes
+// of the cluster wait for it to complete.
+func reconcileUpgrade(ctx context.Context, logger logr.Logger, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, target string) (bool, error) {
+	replicas := ptr.Deref(sts.Spec.Replicas, 0)
+	partition := statefulSetPartition(sts)
+
+	if partition > 0 || meta.IsStatusConditionTrue(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionUpgrading) {
+		if !statefulSetUpdated(sts, replicas-partition) {
+			logger.Info("Waiting for the upgraded members to be ready", "version", ec.Spec.Version, "partition", partition)
+			return true, nil
+		}
+		if partition == 0 {
+			logger.Info("Upgrade completed", "version", ec.Spec.Version)
+			setUpgradingCondition(ec, metav1.ConditionFalse, reasonUpgradeCompleted, fmt.Sprintf("All members run %s", ec.Spec.Version))
+			recorder.Eventf(ec, corev1.EventTypeNormal, "UpgradeCompleted", "All members run %s", ec.Spec.Version)
+			return false, nil
+		}
+		return true, upgradeMember(ctx, logger, c, recorder, ec, sts, partition-1)
+	}
+
+	running := ec.Spec.Version
+	if target == running {
+		return false, nil
+	}
+	problem, err := etcdutils.CheckUpgradePath(running, target)
+	if err != nil {
+		logger.Info("Skipping the upgrade path checks", "reason", err.Error())
+	}
+	if problem != "" {
+		logger.Info("Not upgrading the members", "reason", problem)
+		setUpgradingCondition(ec, metav1.ConditionFalse, reasonUpgradeUnsupported, fmt.Sprintf("The members keep running %s: %s", running, problem))
+		recorder.Event(ec, corev1.EventTypeWarning, "UpgradeUnsupported", problem)
+		return false, nil
+	}
+
+	// Hold the rollout of the new pod template back to the last member
+	// before applying it.
+	logger.Info("Upgrading the members", "from", running, "to", target)
+	if err := setStatefulSetPartition(ctx, c, sts, replicas); err != nil {
+		return true, err
+	}
+	ec.Spec.Version = target
+	if err := applyStatefulSet(ctx, logger, ec, c, replicas, scheme); err != nil {
+		return true, err
+	}
+	recorder.Eventf(ec, corev1.EventTypeNormal, "UpgradeStarted", "Upgrading the members from %s to %s, one at a time", running, target)
+	return true, upgradeMember(ctx, logger, c, recorder, ec, sts, replicas-1)
+}
+
+// upgradeMember rolls the pod template of sts out to the member of the given
+// ordinal, whose members of higher ordinals are already upgraded.
+func upgradeMember(ctx context.Context, logger logr.Logger, c client.Client, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet, ordinal int32) error {
+	if err := setStatefulSetPartition(ctx, c, sts, ordinal); err != nil {
+		return err
+	}
+	replicas := ptr.Deref(sts.Spec.Replicas, 0)
+	member := fmt.Sprintf("%s-%d", ec.Name, ordinal)
+	logger.Info("Upgrading member", "member", member, "version", ec.Spec.Version)
+	setUpgradingCondition(ec, metav1.ConditionTrue, reasonUpgradeInProgress,
+		fmt.Sprintf("Upgrading member %s to %s, %d of %d", member, ec.Spec.Version, replicas-ordinal, replicas))
+	recorder.Eventf(ec, corev1.EventTypeNormal, "UpgradingMember", "Upgrading member %s to %s", member, ec.Spec.Version)
+	return nil
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// applyKeepingUpdateStrategy is applyAsCreateOrUpdate, keeping the update
+// strategy of the StatefulSets the applied objects don't set, like
+// server-side apply keeps the fields of the other field managers.
+var applyKeepingUpdateStrategy = interceptor.Funcs{
+	Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+		if sts, ok := obj.(*appsv1.StatefulSet); ok && patch.Type() == types.ApplyPatchType {
+			existing := &appsv1.StatefulSet{}
+			if err := c.Get(ctx, client.ObjectKeyFromObject(sts), existing); err == nil {
+				sts.Spec.UpdateStrategy = existing.Spec.UpdateStrategy
+			}
+		}
+		return applyAsCreateOrUpdate.Patch(ctx, c, obj, patch, opts...)
+	},
+}
+
+func TestPinVersion(t *testing.T) {
+	running := newPlanTestCluster(3, "v3.5.21")
+	ec := newPlanTestCluster(3, "v3.6.0")
+
+	assert.Equal(t, "v3.6.0", pinVersion(ec, newPlanTestStatefulSet(t, running, 3)))
+	assert.Equal(t, "v3.5.21", ec.Spec.Version)
+
+	// A StatefulSet without members takes the version of the spec.
+	ec = newPlanTestCluster(3, "v3.6.0")
+	assert.Equal(t, "v3.6.0", pinVersion(ec, newPlanTestStatefulSet(t, running, 0)))
+	assert.Equal(t, "v3.6.0", ec.Spec.Version)
+}
+
+func TestReconcileUpgrade(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = appsv1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.UID = "ec-uid"
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(sts).WithInterceptorFuncs(applyKeepingUpdateStrategy).Build()
+
+	// reconcile runs reconcileUpgrade the way Reconcile does, with the
+	// StatefulSet reporting updated pods.
+	reconcile := func(target string, updated int32) bool {
+		t.Helper()
+		current := &appsv1.StatefulSet{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(sts), current))
+		current.Status = appsv1.StatefulSetStatus{
+			ObservedGeneration: current.Generation,
+			ReadyReplicas:      3,
+			UpdatedReplicas:    updated,
+		}
+		ec.Spec.Version = target
+		pinVersion(ec, current)
+		upgrading, err := reconcileUpgrade(ctx, logr.Discard(), c, scheme, recorder, ec, current, target)
+		assert.NoError(t, err)
+		return upgrading
+	}
+	stored := func() *appsv1.StatefulSet {
+		t.Helper()
+		current := &appsv1.StatefulSet{}
+		assert.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(sts), current))
+		return current
+	}
+	condition := func() *metav1.Condition {
+		return meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionUpgrading)
+	}
+
+	assert.False(t, reconcile("v3.5.21", 3))
+	assert.Nil(t, condition())
+
+	t.Run("unsupported upgrade", func(t *testing.T) {
+		assert.False(t, reconcile("v3.7.0", 3))
+		assert.Equal(t, "v3.5.21", ec.Spec.Version)
+		assert.Equal(t, "v3.5.21", statefulSetVersion(stored()))
+		assert.Equal(t, metav1.ConditionFalse, condition().Status)
+		assert.Equal(t, reasonUpgradeUnsupported, condition().Reason)
+		assert.Contains(t, <-recorder.Events, "skip a minor version")
+	})
+
+	t.Run("upgrade", func(t *testing.T) {
+		assert.True(t, reconcile("v3.6.0", 3))
+		assert.Equal(t, "v3.6.0", statefulSetVersion(stored()))
+		assert.Equal(t, int32(2), statefulSetPartition(stored()))
+		assert.Equal(t, metav1.ConditionTrue, condition().Status)
+		assert.Equal(t, "Upgrading member test-etcd-2 to v3.6.0, 1 of 3", condition().Message)
+		assert.Contains(t, <-recorder.Events, "UpgradeStarted")
+		assert.Contains(t, <-recorder.Events, "UpgradingMember")
+
+		// The next member waits for the previous one.
+		assert.True(t, reconcile("v3.6.0", 0))
+		assert.Equal(t, int32(2), statefulSetPartition(stored()))
+
+		assert.True(t, reconcile("v3.6.0", 1))
+		assert.Equal(t, int32(1), statefulSetPartition(stored()))
+		assert.Equal(t, "Upgrading member test-etcd-1 to v3.6.0, 2 of 3", condition().Message)
+		<-recorder.Events
+
+		assert.True(t, reconcile("v3.6.0", 2))
+		assert.Equal(t, int32(0), statefulSetPartition(stored()))
+		<-recorder.Events
+
+		assert.True(t, reconcile("v3.6.0", 2))
+		assert.False(t, reconcile("v3.6.0", 3))
+		assert.Equal(t, metav1.ConditionFalse, condition().Status)
+		assert.Equal(t, reasonUpgradeCompleted, condition().Reason)
+		assert.Equal(t, "All members run v3.6.0", condition().Message)
+		assert.Contains(t, <-recorder.Events, "UpgradeCompleted")
+
+		assert.False(t, reconcile("v3.6.0", 3))
+	})
+}
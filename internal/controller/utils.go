@@ -12,7 +12,6 @@ import (
 	"github.com/go-logr/logr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -20,8 +19,8 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/ptr"
 
@@ -54,16 +53,16 @@ func prepareOwnerReference(ec *ecv1alpha1.EtcdCluster, scheme *runtime.Scheme) (
 	return owners, nil
 }
 
-func reconcileStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1alpha1.EtcdCluster, c client.Client, replicas int32, scheme *runtime.Scheme) (*appsv1.StatefulSet, error) {
+func reconcileStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1alpha1.EtcdCluster, c client.Client, replicas int32, scheme *runtime.Scheme, recorder record.EventRecorder) (*appsv1.StatefulSet, error) {
 
 	// prepare/update configmap for StatefulSet
-	err := applyEtcdClusterState(ctx, ec, int(replicas), c, scheme, logger)
+	err := applyEtcdClusterState(ctx, ec, int(replicas), c, scheme, logger, recorder)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create Update StatefulSet
-	err = createOrPatchStatefulSet(ctx, logger, ec, c, replicas, scheme)
+	err = applyStatefulSet(ctx, logger, ec, c, replicas, scheme)
 	if err != nil {
 		return nil, err
 	}
@@ -78,14 +77,23 @@ func reconcileStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1alpha
 	return getStatefulSet(ctx, c, ec.Name, ec.Namespace)
 }
 
-func defaultArgs(name string) []string {
-	return []string{
+func defaultArgs(ec *ecv1alpha1.EtcdCluster) []string {
+	clientPort, peerPort := ec.Spec.Ports.Client, ec.Spec.Ports.Peer
+	scheme := urlScheme(ec)
+	peerURLs := fmt.Sprintf("%s://$(POD_NAME).%s.$(POD_NAMESPACE).svc.cluster.local:%d", scheme, ec.Name, peerPort)
+	clientURLs := fmt.Sprintf("%s://$(POD_NAME).%s.$(POD_NAMESPACE).svc.cluster.local:%d", scheme, ec.Name, clientPort)
+	if domain := memberServicesDomain(ec); domain != "" {
+		peerURLs += fmt.Sprintf(",%s://$(POD_NAME).%s:%d", scheme, domain, peerPort)
+		clientURLs += fmt.Sprintf(",%s://$(POD_NAME).%s:%d", scheme, domain, clientPort)
+	}
+	args := []string{
 		"--name=$(POD_NAME)",
-		"--listen-peer-urls=http://0.0.0.0:2380",   // TODO: only listen on 127.0.0.1 and host IP
-		"--listen-client-urls=http://0.0.0.0:2379", // TODO: only listen on 127.0.0.1 and host IP
-		fmt.Sprintf("--initial-advertise-peer-urls=http://$(POD_NAME).%s.$(POD_NAMESPACE).svc.cluster.local:2380", name),
-		fmt.Sprintf("--advertise-client-urls=http://$(POD_NAME).%s.$(POD_NAMESPACE).svc.cluster.local:2379", name),
+		fmt.Sprintf("--listen-peer-urls=%s://0.0.0.0:%d", scheme, peerPort),     // TODO: only listen on 127.0.0.1 and host IP
+		fmt.Sprintf("--listen-client-urls=%s://0.0.0.0:%d", scheme, clientPort), // TODO: only listen on 127.0.0.1 and host IP
+		"--initial-advertise-peer-urls=" + peerURLs,
+		"--advertise-client-urls=" + clientURLs,
 	}
+	return append(args, tlsArgs(ec)...)
 }
 
 func RemoveStringFromSlice(s []string, str string) []string {
@@ -115,8 +123,9 @@ func getArgName(s string) string {
 	return strings.TrimSpace(s)
 }
 
-func createArgs(name string, etcdOptions []string) []string {
-	defaultArgs := defaultArgs(name)
+func createArgs(ec *ecv1alpha1.EtcdCluster) []string {
+	etcdOptions := ec.Spec.EtcdOptions
+	defaultArgs := defaultArgs(ec)
 	if len(etcdOptions) > 0 {
 		var argName string
 		// Remove default arguments if conflicts with user supplied
@@ -125,41 +134,74 @@ func createArgs(name string, etcdOptions []string) []string {
 			defaultArgs = RemoveStringFromSlice(defaultArgs, argName)
 		}
 	}
+	// The validation rejects the etcdOptions repeating the tuning options.
+	defaultArgs = append(defaultArgs, ec.Spec.Tuning.Flags()...)
+	defaultArgs = append(defaultArgs, quotaBackendBytesHint(ec)...)
 	defaultArgs = append(defaultArgs, etcdOptions...)
+	if ec.Spec.PodTemplate != nil {
+		// The validation rejects the extra arguments overriding the flags
+		// the operator owns.
+		defaultArgs = append(defaultArgs, ec.Spec.PodTemplate.ExtraArgs...)
+	}
 	return defaultArgs
 }
 
-func createOrPatchStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1alpha1.EtcdCluster, c client.Client, replicas int32, scheme *runtime.Scheme) error {
-	sts := &appsv1.StatefulSet{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      ec.Name,
-			Namespace: ec.Namespace,
-		},
+// defaultQuotaBackendBytes is the quota of the database of etcd when
+// --quota-backend-bytes isn't set.
+var defaultQuotaBackendBytes = resource.MustParse("2Gi")
+
+// quotaBackendBytesHint returns the --quota-backend-bytes flag capping the
+// database of the members to half the memory limit of the etcd container,
+// when the quota isn't set otherwise and that is below the default quota.
+// etcd maps its whole database in memory: a database outgrowing the limit
+// gets the members OOM-killed in a loop, while the NOSPACE alarm raised by the
+// quota keeps the cluster serving reads and deletions.
+func quotaBackendBytesHint(ec *ecv1alpha1.EtcdCluster) []string {
+	pt := ec.Spec.PodTemplate
+	if pt == nil || pt.Resources == nil || (ec.Spec.Tuning != nil && ec.Spec.Tuning.QuotaBackendBytes != nil) {
+		return nil
+	}
+	limit, ok := pt.Resources.Limits[corev1.ResourceMemory]
+	if !ok {
+		return nil
 	}
+	for _, option := range slices.Concat(ec.Spec.EtcdOptions, pt.ExtraArgs) {
+		if "--"+strings.TrimLeft(getArgName(option), "-") == "--quota-backend-bytes" {
+			return nil
+		}
+	}
+	if slices.ContainsFunc(pt.Env, func(env corev1.EnvVar) bool { return env.Name == "ETCD_QUOTA_BACKEND_BYTES" }) {
+		return nil
+	}
+	quota := limit.Value() / 2
+	if quota >= defaultQuotaBackendBytes.Value() {
+		return nil
+	}
+	return []string{fmt.Sprintf("--quota-backend-bytes=%d", quota)}
+}
 
+// newStatefulSetSpec returns the desired spec of the StatefulSet running the
+// members of the EtcdCluster.
+func newStatefulSetSpec(ec *ecv1alpha1.EtcdCluster, replicas int32, owners []metav1.OwnerReference) (appsv1.StatefulSetSpec, error) {
 	labels := map[string]string{
 		"app":        ec.Name,
 		"controller": ec.Name,
 	}
 
-	// Create a new controller ref.
-	owners, err := prepareOwnerReference(ec, scheme)
-	if err != nil {
-		return err
-	}
 	podSpec := corev1.PodSpec{
 		Containers: []corev1.Container{
 			{
 				Name:    "etcd",
 				Command: []string{"/usr/local/bin/etcd"},
-				Args:    createArgs(ec.Name, ec.Spec.EtcdOptions),
+				Args:    createArgs(ec),
 				Image:   fmt.Sprintf("gcr.io/etcd-development/etcd:%s", ec.Spec.Version),
 				Env: []corev1.EnvVar{
 					{
 						Name: "POD_NAME",
 						ValueFrom: &corev1.EnvVarSource{
 							FieldRef: &corev1.ObjectFieldSelector{
-								FieldPath: "metadata.name",
+								APIVersion: "v1",
+								FieldPath:  "metadata.name",
 							},
 						},
 					},
@@ -167,7 +209,8 @@ func createOrPatchStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1a
 						Name: "POD_NAMESPACE",
 						ValueFrom: &corev1.EnvVarSource{
 							FieldRef: &corev1.ObjectFieldSelector{
-								FieldPath: "metadata.namespace",
+								APIVersion: "v1",
+								FieldPath:  "metadata.namespace",
 							},
 						},
 					},
@@ -184,16 +227,41 @@ func createOrPatchStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1a
 				Ports: []corev1.ContainerPort{
 					{
 						Name:          "client",
-						ContainerPort: 2379,
+						ContainerPort: ec.Spec.Ports.Client,
+						Protocol:      corev1.ProtocolTCP,
 					},
 					{
 						Name:          "peer",
-						ContainerPort: 2380,
+						ContainerPort: ec.Spec.Ports.Peer,
+						Protocol:      corev1.ProtocolTCP,
 					},
 				},
+				LivenessProbe:  ec.Spec.PodTemplate.LivenessProbe,
+				ReadinessProbe: ec.Spec.PodTemplate.ReadinessProbe,
 			},
 		},
 	}
+	if res := ec.Spec.PodTemplate.Resources; res != nil {
+		podSpec.Containers[0].Resources = *res
+	}
+	if ec.Spec.TLS.Enabled() {
+		podSpec.Containers[0].Ports = append(podSpec.Containers[0].Ports, corev1.ContainerPort{
+			Name:          "metrics",
+			ContainerPort: ecv1alpha1.DefaultMetricsPort,
+			Protocol:      corev1.ProtocolTCP,
+		})
+		podSpec.Volumes, podSpec.Containers[0].VolumeMounts = tlsVolumes(ec)
+	}
+	// The variables of the container take precedence over the ConfigMap of
+	// the cluster state: the validation rejects those the operator owns.
+	podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, ec.Spec.PodTemplate.Env...)
+	if sched := ec.Spec.PodTemplate.Scheduling; sched != nil {
+		podSpec.Affinity = sched.Affinity
+		podSpec.Tolerations = sched.Tolerations
+		podSpec.NodeSelector = sched.NodeSelector
+		podSpec.PriorityClassName = sched.PriorityClassName
+		podSpec.TopologySpreadConstraints = sched.TopologySpreadConstraints
+	}
 
 	stsSpec := appsv1.StatefulSetSpec{
 		Replicas:    &replicas,
@@ -203,27 +271,46 @@ func createOrPatchStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1a
 		},
 		Template: corev1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
-				Labels: labels,
+				Labels:      labels,
+				Annotations: certificatesAnnotations(ec),
 			},
 			Spec: podSpec,
 		},
 	}
 
+	if isRemote(ec) {
+		// The garbage collector of the remote Kubernetes cluster can't
+		// delete the volumes along with the EtcdCluster, so they go with the
+		// StatefulSet instead.
+		stsSpec.PersistentVolumeClaimRetentionPolicy = &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+			WhenDeleted: appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+			WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+		}
+	}
+
+	if storage := ec.Spec.EphemeralStorage; storage != nil {
+		stsSpec.Template.Spec.Volumes = append(stsSpec.Template.Spec.Volumes, corev1.Volume{
+			Name: volumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{Medium: storage.Medium, SizeLimit: storage.SizeLimit},
+			},
+		})
+		stsSpec.Template.Spec.Containers[0].VolumeMounts = append(stsSpec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: etcdDataDir,
+		})
+	}
+
 	if ec.Spec.StorageSpec != nil {
 
-		stsSpec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{
+		stsSpec.Template.Spec.Containers[0].VolumeMounts = append(stsSpec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
 			Name:        volumeName,
 			MountPath:   etcdDataDir,
 			SubPathExpr: "$(POD_NAME)",
-		}}
+		})
 		// Create a new volume claim template
 		if ec.Spec.StorageSpec.VolumeSizeRequest.Cmp(resource.MustParse("1Mi")) < 0 {
-			return fmt.Errorf("VolumeSizeRequest must be at least 1Mi")
-		}
-
-		if ec.Spec.StorageSpec.VolumeSizeLimit.IsZero() {
-			logger.Info("VolumeSizeLimit is not set. Setting it to VolumeSizeRequest")
-			ec.Spec.StorageSpec.VolumeSizeLimit = ec.Spec.StorageSpec.VolumeSizeRequest
+			return appsv1.StatefulSetSpec{}, fmt.Errorf("VolumeSizeRequest must be at least 1Mi")
 		}
 
 		pvcObjectMeta := metav1.ObjectMeta{
@@ -241,7 +328,7 @@ func createOrPatchStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1a
 		}
 
 		switch ec.Spec.StorageSpec.AccessModes {
-		case corev1.ReadWriteOnce, "":
+		case corev1.ReadWriteOnce:
 			stsSpec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
 				{
 					ObjectMeta: pvcObjectMeta,
@@ -257,7 +344,7 @@ func createOrPatchStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1a
 			}
 		case corev1.ReadWriteMany:
 			if ec.Spec.StorageSpec.PVCName == "" {
-				return fmt.Errorf("PVCName must be set when AccessModes is ReadWriteMany")
+				return appsv1.StatefulSetSpec{}, fmt.Errorf("PVCName must be set when AccessModes is ReadWriteMany")
 			}
 			stsSpec.Template.Spec.Volumes = append(stsSpec.Template.Spec.Volumes, corev1.Volume{
 				Name: volumeName,
@@ -268,21 +355,56 @@ func createOrPatchStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1a
 				},
 			})
 		default:
-			return fmt.Errorf("AccessMode %s is not supported", ec.Spec.StorageSpec.AccessModes)
+			return appsv1.StatefulSetSpec{}, fmt.Errorf("AccessMode %s is not supported", ec.Spec.StorageSpec.AccessModes)
 		}
 	}
 
-	logger.Info("Now creating/updating statefulset", "name", ec.Name, "namespace", ec.Namespace, "replicas", replicas)
-	_, err = controllerutil.CreateOrPatch(ctx, c, sts, func() error {
-		// Define or update the desired spec
-		sts.ObjectMeta = metav1.ObjectMeta{
-			Name:            ec.Name,
-			Namespace:       ec.Namespace,
-			OwnerReferences: owners,
+	// The data of the members without a volume doesn't outlive their
+	// container, there is nothing to check.
+	etcd := &stsSpec.Template.Spec.Containers[0]
+	if image := dataCheckImage(ec); image != "" {
+		if i := slices.IndexFunc(etcd.VolumeMounts, func(m corev1.VolumeMount) bool { return m.MountPath == etcdDataDir }); i >= 0 {
+			stsSpec.Template.Spec.InitContainers = []corev1.Container{newDataCheckContainer(image, etcd.VolumeMounts[i], etcd.Resources)}
 		}
-		sts.Spec = stsSpec
-		return nil
-	})
+	}
+	addGracefulShutdown(ec, &stsSpec.Template.Spec, etcd)
+
+	return stsSpec, nil
+}
+
+func applyStatefulSet(ctx context.Context, logger logr.Logger, ec *ecv1alpha1.EtcdCluster, c client.Client, replicas int32, scheme *runtime.Scheme) error {
+	sts := &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       "StatefulSet",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ec.Name,
+			Namespace: ec.Namespace,
+			Labels:    withManagedByLabel(nil),
+		},
+	}
+	// Create a new controller ref.
+	if err := setWorkloadOwner(ec, scheme, sts); err != nil {
+		return err
+	}
+	stsSpec, err := newStatefulSetSpec(ec, replicas, sts.OwnerReferences)
+	if err != nil {
+		return err
+	}
+	sts.Spec = stsSpec
+	// The claim templates of an existing StatefulSet can't be changed, its
+	// volumes are expanded in place instead, see expandVolumes.
+	current := &appsv1.StatefulSet{}
+	switch err = c.Get(ctx, client.ObjectKeyFromObject(sts), current); {
+	case err == nil:
+		sts.Spec.VolumeClaimTemplates = current.Spec.VolumeClaimTemplates
+	case !k8serrors.IsNotFound(err):
+		return err
+	}
+
+	logger.Info("Now creating/updating statefulset", "name", ec.Name, "namespace", ec.Namespace, "replicas", replicas)
+	err = c.Patch(ctx, sts, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
 	if err != nil {
 		return err
 	}
@@ -326,47 +448,50 @@ func waitForStatefulSetReady(ctx context.Context, logger logr.Logger, r client.C
 	return nil
 }
 
-func createHeadlessServiceIfNotExist(ctx context.Context, logger logr.Logger, c client.Client, ec *ecv1alpha1.EtcdCluster, scheme *runtime.Scheme) error {
-	service := &corev1.Service{}
-	err := c.Get(ctx, client.ObjectKey{Name: ec.Name, Namespace: ec.Namespace}, service)
+func applyHeadlessService(ctx context.Context, logger logr.Logger, c client.Client, ec *ecv1alpha1.EtcdCluster, scheme *runtime.Scheme, recorder record.EventRecorder) error {
+	labels := map[string]string{
+		"app":        ec.Name,
+		"controller": ec.Name,
+	}
+	headlessSvc := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ec.Name,
+			Namespace: ec.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "None", // Key for headless service
+			Selector:  labels,
+			// The ports are named after those of the members, for the
+			// ServiceMonitor to select.
+			Ports: []corev1.ServicePort{
+				{Name: "client", Port: ec.Spec.Ports.Client, Protocol: corev1.ProtocolTCP},
+				{Name: "peer", Port: ec.Spec.Ports.Peer, Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+	if ec.Spec.TLS.Enabled() {
+		headlessSvc.Spec.Ports = append(headlessSvc.Spec.Ports, corev1.ServicePort{
+			Name: "metrics", Port: ecv1alpha1.DefaultMetricsPort, Protocol: corev1.ProtocolTCP,
+		})
+	}
+	if err := setWorkloadOwner(ec, scheme, headlessSvc); err != nil {
+		return err
+	}
 
-	if err != nil {
-		if k8serrors.IsNotFound(err) {
-			logger.Info("Headless service does not exist. Creating headless service")
-			owners, err1 := prepareOwnerReference(ec, scheme)
-			if err1 != nil {
-				return err1
-			}
-			labels := map[string]string{
-				"app":        ec.Name,
-				"controller": ec.Name,
-			}
-			// Create the headless service
-			headlessSvc := &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:            ec.Name,
-					Namespace:       ec.Namespace,
-					Labels:          labels,
-					OwnerReferences: owners,
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "None", // Key for headless service
-					Selector:  labels,
-				},
-			}
-			if createErr := c.Create(ctx, headlessSvc); createErr != nil {
-				return fmt.Errorf("failed to create headless service: %w", createErr)
-			}
-			logger.Info("Headless service created successfully")
-			return nil
-		}
-		return fmt.Errorf("failed to get headless service: %w", err)
+	logger.Info("Now applying headless service", "name", ec.Name, "namespace", ec.Namespace)
+	if err := applyOwnedObject(ctx, c, recorder, ec, headlessSvc); err != nil {
+		return fmt.Errorf("failed to apply headless service: %w", err)
 	}
 	return nil
 }
 
 func checkStatefulSetControlledByEtcdOperator(ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) error {
-	if !metav1.IsControlledBy(sts, ec) {
+	if !isControlledBy(sts, ec) {
 		return fmt.Errorf("StatefulSet %s/%s is not controlled by EtcdCluster %s/%s", sts.Namespace, sts.Name, ec.Namespace, ec.Name)
 	}
 	return nil
@@ -378,8 +503,35 @@ func configMapNameForEtcdCluster(ec *ecv1alpha1.EtcdCluster) string {
 
 func peerEndpointForOrdinalIndex(ec *ecv1alpha1.EtcdCluster, index int) (string, string) {
 	name := fmt.Sprintf("%s-%d", ec.Name, index)
-	return name, fmt.Sprintf("http://%s-%d.%s.%s.svc.cluster.local:2380",
-		ec.Name, index, ec.Name, ec.Namespace)
+	return name, fmt.Sprintf("%s://%s-%d.%s.%s.svc.cluster.local:%d",
+		urlScheme(ec), ec.Name, index, ec.Name, ec.Namespace, ec.Spec.Ports.Peer)
+}
+
+// peerURLsForOrdinalIndex returns the name and all the peer URLs of the
+// member of the given index: its URL in the Kubernetes cluster, followed by
+// its URL under the domain of the member Services, if any.
+func peerURLsForOrdinalIndex(ec *ecv1alpha1.EtcdCluster, index int) (string, []string) {
+	name, peerURL := peerEndpointForOrdinalIndex(ec, index)
+	peerURLs := []string{peerURL}
+	if domain := memberServicesDomain(ec); domain != "" {
+		peerURLs = append(peerURLs, fmt.Sprintf("%s://%s.%s:%d", urlScheme(ec), name, domain, ec.Spec.Ports.Peer))
+	}
+	return name, peerURLs
+}
+
+// findMemberID returns the ID of the member of resp with the given name or
+// peer URL. A member added but not started yet has no name, only its peer
+// URL.
+func findMemberID(resp *clientv3.MemberListResponse, name, peerURL string) (uint64, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	for _, m := range resp.Members {
+		if m.Name == name || slices.Contains(m.PeerURLs, peerURL) {
+			return m.ID, true
+		}
+	}
+	return 0, false
 }
 
 func newEtcdClusterState(ec *ecv1alpha1.EtcdCluster, replica int) *corev1.ConfigMap {
@@ -392,11 +544,17 @@ func newEtcdClusterState(ec *ecv1alpha1.EtcdCluster, replica int) *corev1.Config
 
 	var initialCluster []string
 	for i := 0; i < replica; i++ {
-		name, peerURL := peerEndpointForOrdinalIndex(ec, i)
-		initialCluster = append(initialCluster, fmt.Sprintf("%s=%s", name, peerURL))
+		name, peerURLs := peerURLsForOrdinalIndex(ec, i)
+		for _, peerURL := range peerURLs {
+			initialCluster = append(initialCluster, fmt.Sprintf("%s=%s", name, peerURL))
+		}
 	}
 
 	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "ConfigMap",
+		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      configMapNameForEtcdCluster(ec),
 			Namespace: ec.Namespace,
@@ -409,34 +567,34 @@ func newEtcdClusterState(ec *ecv1alpha1.EtcdCluster, replica int) *corev1.Config
 	}
 }
 
-func applyEtcdClusterState(ctx context.Context, ec *ecv1alpha1.EtcdCluster, replica int, c client.Client, scheme *runtime.Scheme, logger logr.Logger) error {
+func applyEtcdClusterState(ctx context.Context, ec *ecv1alpha1.EtcdCluster, replica int, c client.Client, scheme *runtime.Scheme, logger logr.Logger, recorder record.EventRecorder) error {
 	cm := newEtcdClusterState(ec, replica)
 
 	// Create a new controller ref.
-	owners, err := prepareOwnerReference(ec, scheme)
-	if err != nil {
+	if err := setWorkloadOwner(ec, scheme, cm); err != nil {
 		return err
 	}
 
-	cm.OwnerReferences = owners
-
 	logger.Info("Now updating configmap", "name", configMapNameForEtcdCluster(ec), "namespace", ec.Namespace)
-	err = c.Get(ctx, types.NamespacedName{Name: configMapNameForEtcdCluster(ec), Namespace: ec.Namespace}, &corev1.ConfigMap{})
-	if err != nil {
-		if k8serrors.IsNotFound(err) {
-			createErr := c.Create(ctx, cm)
-			return createErr
-		}
-		return err
-	}
-
-	updateErr := c.Update(ctx, cm)
-	return updateErr
+	return applyOwnedObject(ctx, c, recorder, ec, cm)
 }
 
 func clientEndpointForOrdinalIndex(sts *appsv1.StatefulSet, index int) string {
-	return fmt.Sprintf("http://%s-%d.%s.%s.svc.cluster.local:2379",
-		sts.Name, index, sts.Name, sts.Namespace)
+	return fmt.Sprintf("%s://%s-%d.%s.%s.svc.cluster.local:%d",
+		clientSchemeFromStatefulSet(sts), sts.Name, index, sts.Name, sts.Namespace, clientPortFromStatefulSet(sts))
+}
+
+// clientPortFromStatefulSet returns the client port exposed by the etcd
+// container of the StatefulSet.
+func clientPortFromStatefulSet(sts *appsv1.StatefulSet) int32 {
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == "client" {
+				return p.ContainerPort
+			}
+		}
+	}
+	return ecv1alpha1.DefaultClientPort
 }
 
 func getStatefulSet(ctx context.Context, c client.Client, name, namespace string) (*appsv1.StatefulSet, error) {
@@ -448,6 +606,17 @@ func getStatefulSet(ctx context.Context, c client.Client, name, namespace string
 	return sts, nil
 }
 
+// clientEndpointsFromEtcdCluster returns the client endpoints of all the
+// members of ec once it reaches its expected size.
+func clientEndpointsFromEtcdCluster(ec *ecv1alpha1.EtcdCluster) []string {
+	endpoints := make([]string, 0, ec.Spec.Size)
+	for i := range ec.Spec.Size {
+		endpoints = append(endpoints, fmt.Sprintf("%s://%s-%d.%s.%s.svc.cluster.local:%d",
+			urlScheme(ec), ec.Name, i, ec.Name, ec.Namespace, ec.Spec.Ports.Client))
+	}
+	return endpoints
+}
+
 func clientEndpointsFromStatefulsets(sts *appsv1.StatefulSet) []string {
 	var endpoints []string
 	replica := int(*sts.Spec.Replicas)
@@ -459,8 +628,8 @@ func clientEndpointsFromStatefulsets(sts *appsv1.StatefulSet) []string {
 	return endpoints
 }
 
-func areAllMembersHealthy(sts *appsv1.StatefulSet, logger logr.Logger) (bool, error) {
-	_, health, err := healthCheck(sts, logger)
+func areAllMembersHealthy(etcdClient *etcdutils.ClusterClient, sts *appsv1.StatefulSet, logger logr.Logger) (bool, error) {
+	_, health, err := healthCheck(etcdClient, sts, logger)
 	if err != nil {
 		return false, err
 	}
@@ -476,7 +645,7 @@ func areAllMembersHealthy(sts *appsv1.StatefulSet, logger logr.Logger) (bool, er
 // healthCheck returns a memberList and an error.
 // If any member (excluding not yet started or already removed member)
 // is unhealthy, the error won't be nil.
-func healthCheck(sts *appsv1.StatefulSet, lg klog.Logger) (*clientv3.MemberListResponse, []etcdutils.EpHealth, error) {
+func healthCheck(etcdClient *etcdutils.ClusterClient, sts *appsv1.StatefulSet, lg klog.Logger) (*clientv3.MemberListResponse, []etcdutils.EpHealth, error) {
 	replica := int(*sts.Spec.Replicas)
 	if replica == 0 {
 		return nil, nil, nil
@@ -484,7 +653,7 @@ func healthCheck(sts *appsv1.StatefulSet, lg klog.Logger) (*clientv3.MemberListR
 
 	endpoints := clientEndpointsFromStatefulsets(sts)
 
-	memberlistResp, err := etcdutils.MemberList(endpoints)
+	memberlistResp, err := etcdClient.MemberList(endpoints)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -500,7 +669,7 @@ func healthCheck(sts *appsv1.StatefulSet, lg klog.Logger) (*clientv3.MemberListR
 	lg.Info("health checking", "replica", replica, "len(members)", memberCnt)
 	endpoints = endpoints[:cnt]
 
-	healthInfos, err := etcdutils.ClusterHealth(endpoints)
+	healthInfos, err := etcdClient.ClusterHealth(endpoints)
 	if err != nil {
 		return memberlistResp, nil, err
 	}
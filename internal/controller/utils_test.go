@@ -5,14 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/assert"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -54,7 +58,7 @@ func TestReconcileStatefulSet(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = ecv1alpha1.AddToScheme(scheme)
 
-	fakeClient := fake.NewClientBuilder().Build()
+	fakeClient := fake.NewClientBuilder().WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
 	logger := log.FromContext(context.Background())
 
 	ec := &ecv1alpha1.EtcdCluster{
@@ -67,8 +71,9 @@ func TestReconcileStatefulSet(t *testing.T) {
 			Version: "3.5.17",
 		},
 	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
 
-	_, _ = reconcileStatefulSet(context.Background(), logger, ec, fakeClient, 3, scheme)
+	_, _ = reconcileStatefulSet(context.Background(), logger, ec, fakeClient, 3, scheme, record.NewFakeRecorder(10))
 
 	sts := &appsv1.StatefulSet{}
 	err := fakeClient.Get(context.Background(), client.ObjectKey{Name: "test-etcd", Namespace: "default"}, sts)
@@ -160,7 +165,7 @@ func TestWaitForStatefulSetReady(t *testing.T) {
 	}
 }
 
-func TestCreateHeadlessServiceIfNotExist(t *testing.T) {
+func TestApplyHeadlessService(t *testing.T) {
 	ctx := context.TODO()
 	logger := log.FromContext(ctx)
 
@@ -170,7 +175,7 @@ func TestCreateHeadlessServiceIfNotExist(t *testing.T) {
 	_ = ecv1alpha1.AddToScheme(scheme)
 
 	// Create a fake client
-	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
 
 	// Create an EtcdCluster instance
 	ec := &ecv1alpha1.EtcdCluster{
@@ -179,9 +184,10 @@ func TestCreateHeadlessServiceIfNotExist(t *testing.T) {
 			Namespace: "default",
 		},
 	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
 
 	t.Run("creates headless service if it does not exist", func(t *testing.T) {
-		err := createHeadlessServiceIfNotExist(ctx, logger, fakeClient, ec, scheme)
+		err := applyHeadlessService(ctx, logger, fakeClient, ec, scheme, record.NewFakeRecorder(10))
 		assert.NoError(t, err)
 
 		// Verify that the service was created
@@ -193,11 +199,15 @@ func TestCreateHeadlessServiceIfNotExist(t *testing.T) {
 			"app":        "test-etcd",
 			"controller": "test-etcd",
 		}, service.Spec.Selector)
+		assert.Equal(t, []corev1.ServicePort{
+			{Name: "client", Port: 2379, Protocol: corev1.ProtocolTCP},
+			{Name: "peer", Port: 2380, Protocol: corev1.ProtocolTCP},
+		}, service.Spec.Ports)
 	})
 
-	t.Run("does not create service if it already exists", func(t *testing.T) {
+	t.Run("applies the service again if it already exists", func(t *testing.T) {
 		// Service was already created in previous test. Call the function again to ensure no error
-		err := createHeadlessServiceIfNotExist(ctx, logger, fakeClient, ec, scheme)
+		err := applyHeadlessService(ctx, logger, fakeClient, ec, scheme, record.NewFakeRecorder(10))
 		assert.NoError(t, err)
 	})
 }
@@ -227,6 +237,38 @@ func TestClientEndpointForOrdinalIndex(t *testing.T) {
 	}
 }
 
+func TestFindMemberID(t *testing.T) {
+	resp := &clientv3.MemberListResponse{
+		Members: []*etcdserverpb.Member{
+			{ID: 1, Name: "test-etcd-0", PeerURLs: []string{"http://test-etcd-0.test-etcd.default.svc.cluster.local:2380"}},
+			{ID: 2, Name: "test-etcd-1", PeerURLs: []string{"http://test-etcd-1.test-etcd.default.svc.cluster.local:2380"}},
+			// A learner that hasn't started yet.
+			{ID: 3, PeerURLs: []string{"http://test-etcd-2.test-etcd.default.svc.cluster.local:2380"}, IsLearner: true},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		resp          *clientv3.MemberListResponse
+		member        string
+		expectedID    uint64
+		expectedFound bool
+	}{
+		{name: "by name", resp: resp, member: "test-etcd-1", expectedID: 2, expectedFound: true},
+		{name: "by peer URL", resp: resp, member: "test-etcd-2", expectedID: 3, expectedFound: true},
+		{name: "not a member", resp: resp, member: "test-etcd-3"},
+		{name: "no member list", member: "test-etcd-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peerURL := fmt.Sprintf("http://%s.test-etcd.default.svc.cluster.local:2380", tt.member)
+			id, found := findMemberID(tt.resp, tt.member, peerURL)
+			assert.Equal(t, tt.expectedFound, found)
+			assert.Equal(t, tt.expectedID, id)
+		})
+	}
+}
+
 func TestIsLearnerReady(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -439,7 +481,8 @@ func TestAreAllMembersHealthy(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			logger := logr.Discard() // Use a no-op logger for testing
 
-			result, err := areAllMembersHealthy(tt.statefulSet, logger)
+			etcdClient := etcdutils.NewClientPool().Cluster("default/test-sts", nil, nil)
+			result, err := areAllMembersHealthy(etcdClient, tt.statefulSet, logger)
 			assert.Equal(t, tt.expectedResult, result)
 			if tt.expectedError != nil {
 				assert.Error(t, err)
@@ -461,7 +504,7 @@ func TestApplyEtcdClusterState(t *testing.T) {
 	_ = ecv1alpha1.AddToScheme(scheme)
 
 	// Create a fake client
-	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
 
 	// Create an EtcdCluster instance
 	ec := &ecv1alpha1.EtcdCluster{
@@ -470,9 +513,10 @@ func TestApplyEtcdClusterState(t *testing.T) {
 			Namespace: "default",
 		},
 	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
 
 	t.Run("creates configmap if it does not exist", func(t *testing.T) {
-		err := applyEtcdClusterState(ctx, ec, 3, fakeClient, scheme, logger)
+		err := applyEtcdClusterState(ctx, ec, 3, fakeClient, scheme, logger, record.NewFakeRecorder(10))
 		assert.NoError(t, err)
 
 		// Verify that the configmap was created
@@ -492,7 +536,7 @@ func TestApplyEtcdClusterState(t *testing.T) {
 		assert.NoError(t, err)
 
 		// Call the function again to ensure it updates the configmap
-		err = applyEtcdClusterState(ctx, ec, 3, fakeClient, scheme, logger)
+		err = applyEtcdClusterState(ctx, ec, 3, fakeClient, scheme, logger, record.NewFakeRecorder(10))
 		assert.NoError(t, err)
 
 		// Verify that the configmap was updated
@@ -591,9 +635,170 @@ func TestCreatingArgs(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.testName, func(t *testing.T) {
-			result := createArgs(tt.clusterName, tt.etcdOptions)
+			ec := &ecv1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: tt.clusterName},
+				Spec:       ecv1alpha1.EtcdClusterSpec{EtcdOptions: tt.etcdOptions},
+			}
+			ecv1alpha1.SetEtcdClusterDefaults(ec)
+			result := createArgs(ec)
 			assert.Equal(t, tt.expectedResult, result)
 		})
 	}
 
 }
+
+func TestCreatingArgsWithTuning(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "testCluster"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			EtcdOptions: []string{"--max-wals=7"},
+			Tuning: &ecv1alpha1.EtcdTuning{
+				QuotaBackendBytes:       ptr.To(resource.MustParse("8Gi")),
+				AutoCompactionMode:      ecv1alpha1.AutoCompactionModePeriodic,
+				AutoCompactionRetention: "1h",
+				SnapshotCount:           ptr.To[int64](10000),
+				HeartbeatInterval:       &metav1.Duration{Duration: 250 * time.Millisecond},
+				ElectionTimeout:         &metav1.Duration{Duration: 2500 * time.Millisecond},
+				MaxRequestBytes:         ptr.To(resource.MustParse("10Mi")),
+			},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	// The tuning options go between the defaults and the etcdOptions.
+	assert.Equal(t, []string{
+		"--name=$(POD_NAME)",
+		"--listen-peer-urls=http://0.0.0.0:2380",
+		"--listen-client-urls=http://0.0.0.0:2379",
+		"--initial-advertise-peer-urls=http://$(POD_NAME).testCluster.$(POD_NAMESPACE).svc.cluster.local:2380",
+		"--advertise-client-urls=http://$(POD_NAME).testCluster.$(POD_NAMESPACE).svc.cluster.local:2379",
+		"--quota-backend-bytes=8589934592",
+		"--auto-compaction-mode=periodic",
+		"--auto-compaction-retention=1h",
+		"--snapshot-count=10000",
+		"--heartbeat-interval=250",
+		"--election-timeout=2500",
+		"--max-request-bytes=10485760",
+		"--max-wals=7",
+	}, createArgs(ec))
+}
+
+func TestPodTemplateExtraArgsAndEnv(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "testCluster"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Version:     "v3.5.21",
+			EtcdOptions: []string{"--max-wals=7"},
+			PodTemplate: &ecv1alpha1.PodTemplate{
+				ExtraArgs: []string{"--experimental-initial-corrupt-check=true"},
+				Env:       []corev1.EnvVar{{Name: "GOMAXPROCS", Value: "2"}},
+			},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	// The extra arguments go after the etcdOptions.
+	args := createArgs(ec)
+	assert.Equal(t, []string{"--max-wals=7", "--experimental-initial-corrupt-check=true"}, args[len(args)-2:])
+
+	spec, err := newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	env := spec.Template.Spec.Containers[0].Env
+	assert.Len(t, env, 3)
+	assert.Equal(t, corev1.EnvVar{Name: "GOMAXPROCS", Value: "2"}, env[2])
+}
+
+func TestPodTemplateScheduling(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "testCluster"},
+		Spec:       ecv1alpha1.EtcdClusterSpec{Version: "v3.5.21"},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	// The members are spread across the nodes by default.
+	spec, err := newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	terms := spec.Template.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	assert.Len(t, terms, 1)
+	assert.Equal(t, corev1.LabelHostname, terms[0].TopologyKey)
+	assert.Equal(t, spec.Selector, terms[0].LabelSelector)
+
+	ec.Spec.PodTemplate.Scheduling = &ecv1alpha1.PodScheduling{
+		Affinity:          &corev1.Affinity{},
+		Tolerations:       []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "etcd"}},
+		NodeSelector:      map[string]string{"dedicated": "etcd"},
+		PriorityClassName: "system-cluster-critical",
+		TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+			{MaxSkew: 1, TopologyKey: corev1.LabelTopologyZone, WhenUnsatisfiable: corev1.DoNotSchedule},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	spec, err = newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	podSpec := spec.Template.Spec
+	assert.Equal(t, &corev1.Affinity{}, podSpec.Affinity)
+	assert.Equal(t, ec.Spec.PodTemplate.Scheduling.Tolerations, podSpec.Tolerations)
+	assert.Equal(t, map[string]string{"dedicated": "etcd"}, podSpec.NodeSelector)
+	assert.Equal(t, "system-cluster-critical", podSpec.PriorityClassName)
+	assert.Equal(t, ec.Spec.PodTemplate.Scheduling.TopologySpreadConstraints, podSpec.TopologySpreadConstraints)
+}
+
+func TestPodTemplateResources(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "testCluster"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Version: "v3.5.21",
+			PodTemplate: &ecv1alpha1.PodTemplate{
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+				},
+			},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	spec, err := newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, *ec.Spec.PodTemplate.Resources, spec.Template.Spec.Containers[0].Resources)
+	// The quota of the database is half the memory limit.
+	assert.Contains(t, spec.Template.Spec.Containers[0].Args, "--quota-backend-bytes=536870912")
+
+	// The quota set otherwise is kept.
+	ec.Spec.PodTemplate.ExtraArgs = []string{"--quota-backend-bytes=268435456"}
+	assert.NotContains(t, createArgs(ec), "--quota-backend-bytes=536870912")
+	ec.Spec.PodTemplate.ExtraArgs = nil
+	ec.Spec.Tuning = &ecv1alpha1.EtcdTuning{QuotaBackendBytes: ptr.To(resource.MustParse("256Mi"))}
+	assert.NotContains(t, createArgs(ec), "--quota-backend-bytes=536870912")
+
+	// Half a large limit is above the default quota of etcd, which is kept.
+	ec.Spec.Tuning = nil
+	ec.Spec.PodTemplate.Resources.Limits[corev1.ResourceMemory] = resource.MustParse("8Gi")
+	assert.NotContains(t, createArgs(ec), "--quota-backend-bytes=4294967296")
+}
+
+func TestEphemeralStorage(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "testCluster"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Version: "v3.5.21",
+			EphemeralStorage: &ecv1alpha1.EphemeralStorage{
+				Medium:    corev1.StorageMediumMemory,
+				SizeLimit: ptr.To(resource.MustParse("512Mi")),
+			},
+		},
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	spec, err := newStatefulSetSpec(ec, 3, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, spec.VolumeClaimTemplates)
+	assert.Equal(t, []corev1.Volume{{
+		Name: volumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory, SizeLimit: ptr.To(resource.MustParse("512Mi"))},
+		},
+	}}, spec.Template.Spec.Volumes)
+	assert.Equal(t, []corev1.VolumeMount{{Name: volumeName, MountPath: etcdDataDir}}, spec.Template.Spec.Containers[0].VolumeMounts)
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// expandVolumes grows the volumes of the members of ec to
+// spec.storageSpec.volumeSizeRequest, and records the progress in the
+// VolumesExpanding condition. The claim templates of the StatefulSet can't be
+// changed, so the volumes created from them are expanded in place, which
+// their storage class must allow. The volumes are read with r, as they don't
+// carry the label of the operator, and patched with c. Their storage classes
+// are read with classes, nil when the operator isn't allowed to: the API
+// server then rejects the expansions the storage classes don't allow.
+func expandVolumes(ctx context.Context, r, classes client.Reader, c client.Client, recorder record.EventRecorder, ec *ecv1alpha1.EtcdCluster, sts *appsv1.StatefulSet) error {
+	storage := ec.Spec.StorageSpec
+	// The volume shared by the members belongs to the user.
+	if storage == nil || storage.AccessModes != corev1.ReadWriteOnce || sts.Spec.Replicas == nil {
+		meta.RemoveStatusCondition(&ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionVolumesExpanding)
+		return nil
+	}
+	size := storage.VolumeSizeRequest
+	var expanding, unsupported []string
+	for i := range *sts.Spec.Replicas {
+		pvc := &corev1.PersistentVolumeClaim{}
+		key := client.ObjectKey{Name: fmt.Sprintf("%s-%s-%d", volumeName, ec.Name, i), Namespace: ec.Namespace}
+		if err := r.Get(ctx, key, pvc); err != nil {
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if pvc.Spec.Resources.Requests.Storage().Cmp(size) < 0 {
+			allowed, err := expansionAllowed(ctx, classes, pvc)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				recorder.Eventf(ec, corev1.EventTypeWarning, "VolumeExpansionFailed",
+					"The storage class %s of the volume %s doesn't allow its expansion to %s", *pvc.Spec.StorageClassName, pvc.Name, size.String())
+				unsupported = append(unsupported, pvc.Name)
+				continue
+			}
+			patch := client.MergeFrom(pvc.DeepCopy())
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+			if err := c.Patch(ctx, pvc, patch); err != nil {
+				// The volume wasn't dynamically provisioned, or the storage
+				// class couldn't be read.
+				if k8serrors.IsForbidden(err) || k8serrors.IsInvalid(err) {
+					recorder.Eventf(ec, corev1.EventTypeWarning, "VolumeExpansionFailed",
+						"Failed to expand the volume %s to %s: %v", pvc.Name, size.String(), err)
+					unsupported = append(unsupported, pvc.Name)
+					continue
+				}
+				return err
+			}
+			recorder.Eventf(ec, corev1.EventTypeNormal, "VolumeExpanding", "Expanding the volume %s to %s", pvc.Name, size.String())
+		}
+		// The capacity of the volume grows once its file system is resized
+		// on the node of the member, without restarting it.
+		if pvc.Status.Phase == corev1.ClaimBound && pvc.Status.Capacity.Storage().Cmp(size) < 0 {
+			expanding = append(expanding, pvc.Name)
+		}
+	}
+	setVolumesExpandingCondition(ec, size, expanding, unsupported)
+	return nil
+}
+
+// expansionAllowed reports whether the storage class of pvc allows its
+// expansion, which is assumed when the storage class can't be read.
+func expansionAllowed(ctx context.Context, classes client.Reader, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	if classes == nil || ptr.Deref(pvc.Spec.StorageClassName, "") == "" {
+		return true, nil
+	}
+	class := &storagev1.StorageClass{}
+	if err := classes.Get(ctx, client.ObjectKey{Name: *pvc.Spec.StorageClassName}, class); err != nil {
+		if k8serrors.IsNotFound(err) || k8serrors.IsForbidden(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return ptr.Deref(class.AllowVolumeExpansion, false), nil
+}
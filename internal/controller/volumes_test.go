@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func newVolumeTestClaim(name, class, size, capacity string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: ptr.To(class),
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase:    corev1.ClaimBound,
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)},
+		},
+	}
+}
+
+func TestExpandVolumes(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = storagev1.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{VolumeSizeRequest: resource.MustParse("2Gi")}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "expandable"}, AllowVolumeExpansion: ptr.To(true)},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "fixed"}},
+		newVolumeTestClaim("etcd-data-test-etcd-0", "expandable", "1Gi", "1Gi"),
+		// Already expanded.
+		newVolumeTestClaim("etcd-data-test-etcd-1", "expandable", "4Gi", "4Gi"),
+		newVolumeTestClaim("etcd-data-test-etcd-2", "fixed", "1Gi", "1Gi"),
+		// Not a member anymore.
+		newVolumeTestClaim("etcd-data-test-etcd-3", "expandable", "1Gi", "1Gi"),
+	).Build()
+	sts := &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Replicas: ptr.To[int32](3)}}
+	recorder := record.NewFakeRecorder(10)
+
+	assert.NoError(t, expandVolumes(context.Background(), fakeClient, fakeClient, fakeClient, recorder, ec, sts))
+	for name, size := range map[string]string{
+		"etcd-data-test-etcd-0": "2Gi",
+		"etcd-data-test-etcd-1": "4Gi",
+		"etcd-data-test-etcd-2": "1Gi",
+		"etcd-data-test-etcd-3": "1Gi",
+	} {
+		pvc := &corev1.PersistentVolumeClaim{}
+		assert.NoError(t, fakeClient.Get(context.Background(), client.ObjectKey{Name: name, Namespace: "default"}, pvc))
+		assert.Equal(t, resource.MustParse(size), *pvc.Spec.Resources.Requests.Storage(), name)
+	}
+	assert.Len(t, recorder.Events, 2)
+	assert.Contains(t, <-recorder.Events, "Expanding the volume etcd-data-test-etcd-0 to 2Gi")
+	assert.Contains(t, <-recorder.Events, "The storage class fixed of the volume etcd-data-test-etcd-2 doesn't allow its expansion")
+	condition := meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionVolumesExpanding)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, reasonExpansionInProgress, condition.Reason)
+	assert.Equal(t, "Expanding the volumes etcd-data-test-etcd-0 to 2Gi; "+
+		"The volumes etcd-data-test-etcd-2 can't be expanded to 2Gi, see the VolumeExpansionFailed events", condition.Message)
+
+	// The expansion completes once the file system is resized.
+	pvc := newVolumeTestClaim("etcd-data-test-etcd-0", "expandable", "2Gi", "2Gi")
+	fakeClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(pvc).Build()
+	sts.Spec.Replicas = ptr.To[int32](1)
+	assert.NoError(t, expandVolumes(context.Background(), fakeClient, nil, fakeClient, recorder, ec, sts))
+	condition = meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionVolumesExpanding)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, reasonVolumesExpanded, condition.Reason)
+
+	// Without storage, the members have no volume to expand.
+	ec.Spec.StorageSpec = nil
+	assert.NoError(t, expandVolumes(context.Background(), fakeClient, nil, fakeClient, recorder, ec, sts))
+	assert.Nil(t, meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionVolumesExpanding))
+}
+
+func TestApplyStatefulSetKeepsClaimTemplates(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+	fakeClient := fake.NewClientBuilder().WithInterceptorFuncs(applyAsCreateOrUpdate).Build()
+	logger := log.FromContext(context.Background())
+	ec := newPlanTestCluster(3, "v3.5.21")
+	ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{VolumeSizeRequest: resource.MustParse("1Gi")}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+	assert.NoError(t, applyStatefulSet(context.Background(), logger, ec, fakeClient, 3, scheme))
+
+	// The claim templates can't be changed.
+	ec.Spec.StorageSpec.VolumeSizeRequest = resource.MustParse("2Gi")
+	ec.Spec.StorageSpec.VolumeSizeLimit = resource.MustParse("2Gi")
+	assert.NoError(t, applyStatefulSet(context.Background(), logger, ec, fakeClient, 3, scheme))
+	sts, err := getStatefulSet(context.Background(), fakeClient, ec.Name, ec.Namespace)
+	assert.NoError(t, err)
+	assert.Equal(t, resource.MustParse("1Gi"), *sts.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests.Storage())
+}
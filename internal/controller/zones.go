@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// nodeZones returns the topology.kubernetes.io/zone label of the nodes of the
+// Kubernetes cluster c, by node name. The nodes without the label are left
+// out. Only the metadata of the nodes is read, and nothing when the operator
+// isn't allowed to list them, e.g. in a remote Kubernetes cluster.
+func nodeZones(ctx context.Context, c client.Reader) (map[string]string, error) {
+	nodes := &metav1.PartialObjectMetadataList{}
+	nodes.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("NodeList"))
+	if err := c.List(ctx, nodes, client.HasLabels{corev1.LabelTopologyZone}); err != nil {
+		if k8serrors.IsForbidden(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	zones := make(map[string]string, len(nodes.Items))
+	for _, n := range nodes.Items {
+		zones[n.Name] = n.Labels[corev1.LabelTopologyZone]
+	}
+	return zones, nil
+}
+
+// applyZoneSpread spreads the members of ec evenly across the zones of the
+// nodes, when there is more than one, unless spec.podTemplate.scheduling sets
+// its own topologySpreadConstraints. Like the defaults, the constraint is
+// only filled in memory, as it depends on the nodes rather than on the spec.
+func applyZoneSpread(ec *ecv1alpha1.EtcdCluster, zones map[string]string) {
+	sched := ec.Spec.PodTemplate.Scheduling
+	if sched.TopologySpreadConstraints != nil || len(sets.New(slices.Collect(maps.Values(zones))...)) < 2 {
+		return
+	}
+	sched.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{
+		{
+			MaxSkew:           1,
+			TopologyKey:       corev1.LabelTopologyZone,
+			WhenUnsatisfiable: corev1.DoNotSchedule,
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": ec.Name, "controller": ec.Name},
+			},
+			// The zones of the nodes the members can't run on, e.g. those
+			// of the tainted control plane, don't count.
+			NodeTaintsPolicy: ptr.To(corev1.NodeInclusionPolicyHonor),
+		},
+	}
+}
+
+// memberZones returns the zone of the members of ec, by name, from zones, the
+// zones of the nodes their pods run on. The pods are read with c, which must
+// not be restricted to the objects of the operator, as the pods of the
+// StatefulSet don't carry its label.
+func memberZones(ctx context.Context, c client.Reader, ec *ecv1alpha1.EtcdCluster, zones map[string]string) (map[string]string, error) {
+	if len(zones) == 0 {
+		return nil, nil
+	}
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(ec.Namespace), client.MatchingLabels{"app": ec.Name, "controller": ec.Name}); err != nil {
+		return nil, err
+	}
+	members := make(map[string]string, len(pods.Items))
+	for _, p := range pods.Items {
+		if zone, ok := zones[p.Spec.NodeName]; ok {
+			members[p.Name] = zone
+		}
+	}
+	return members, nil
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newZoneTestNode(name, zone string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if zone != "" {
+		node.Labels = map[string]string{corev1.LabelTopologyZone: zone}
+	}
+	return node
+}
+
+func TestNodeZones(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newZoneTestNode("node-a", "zone-a"),
+		newZoneTestNode("node-b", "zone-b"),
+		newZoneTestNode("node-c", ""),
+	).Build()
+
+	zones, err := nodeZones(context.Background(), fakeClient)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"node-a": "zone-a", "node-b": "zone-b"}, zones)
+}
+
+func TestApplyZoneSpread(t *testing.T) {
+	// A single zone isn't worth spreading across.
+	ec := newPlanTestCluster(3, "v3.5.21")
+	applyZoneSpread(ec, map[string]string{"node-a": "zone-a", "node-b": "zone-a"})
+	assert.Nil(t, ec.Spec.PodTemplate.Scheduling.TopologySpreadConstraints)
+
+	applyZoneSpread(ec, map[string]string{"node-a": "zone-a", "node-b": "zone-b"})
+	constraints := ec.Spec.PodTemplate.Scheduling.TopologySpreadConstraints
+	assert.Len(t, constraints, 1)
+	assert.Equal(t, int32(1), constraints[0].MaxSkew)
+	assert.Equal(t, corev1.LabelTopologyZone, constraints[0].TopologyKey)
+	assert.Equal(t, corev1.DoNotSchedule, constraints[0].WhenUnsatisfiable)
+	sts := newPlanTestStatefulSet(t, ec, 3)
+	assert.Equal(t, sts.Spec.Selector, constraints[0].LabelSelector)
+
+	// The constraints of the spec are kept.
+	ec = newPlanTestCluster(3, "v3.5.21")
+	own := []corev1.TopologySpreadConstraint{{MaxSkew: 2, TopologyKey: "rack", WhenUnsatisfiable: corev1.ScheduleAnyway}}
+	ec.Spec.PodTemplate.Scheduling.TopologySpreadConstraints = own
+	applyZoneSpread(ec, map[string]string{"node-a": "zone-a", "node-b": "zone-b"})
+	assert.Equal(t, own, ec.Spec.PodTemplate.Scheduling.TopologySpreadConstraints)
+}
+
+func TestMemberZones(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	ec := newPlanTestCluster(3, "v3.5.21")
+	pod := func(name, node string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ec.Namespace, Labels: map[string]string{"app": ec.Name, "controller": ec.Name}},
+			Spec:       corev1.PodSpec{NodeName: node},
+		}
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		pod("test-etcd-0", "node-a"),
+		pod("test-etcd-1", "node-b"),
+		// Not scheduled yet.
+		pod("test-etcd-2", ""),
+	).Build()
+
+	zones, err := memberZones(context.Background(), fakeClient, ec, map[string]string{"node-a": "zone-a", "node-b": "zone-b"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"test-etcd-0": "zone-a", "test-etcd-1": "zone-b"}, zones)
+
+	// The pods aren't read when the nodes have no zone.
+	zones, err = memberZones(context.Background(), fakeClient, ec, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, zones)
+}
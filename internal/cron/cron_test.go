@@ -0,0 +1,52 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestNext(t *testing.T) {
+	// A Friday.
+	from := time.Date(2025, 1, 31, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 31, 10, 18, 0, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)},
+		{"15,45 * * * *", time.Date(2025, 1, 31, 10, 45, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2025, 2, 1, 2, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 1 * * 7", time.Date(2025, 2, 2, 1, 30, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either the day of month or the day of week.
+		{"0 0 15 * 6", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		assert.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.want, s.Next(from), tt.spec)
+	}
+}
@@ -0,0 +1,115 @@
+// Package datacheck checks the integrity of the data directory of an etcd
+// member, the way the member reads it when it starts: the members run it in
+// an init container, so that a member with corrupted data is replaced rather
+// than crash-looping.
+package datacheck
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+)
+
+// ExitCorrupted is the exit code of `manager check-data` when the data of
+// the member is corrupted. It fails with other exit codes when it can't
+// check the data, e.g. when it can't read it.
+const ExitCorrupted = 3
+
+// CorruptedError is the error of Check when the data of the member is
+// corrupted, rather than unreadable.
+type CorruptedError struct {
+	Err error
+}
+
+func (e *CorruptedError) Error() string { return e.Err.Error() }
+
+func (e *CorruptedError) Unwrap() error { return e.Err }
+
+// corrupted returns err as a CorruptedError, unless it is a failure to reach
+// a file, e.g. a permission error, which says nothing of its content.
+func corrupted(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+	return &CorruptedError{Err: err}
+}
+
+// Check checks the data directory dataDir of a member: the CRCs of its
+// write-ahead log, its newest raft snapshot the log records, and the
+// consistency of the pages of its database. A data directory without member
+// data, of a member which didn't start yet, passes the check. The errors
+// finding corrupted data are CorruptedErrors.
+func Check(dataDir string) error {
+	memberDir := filepath.Join(dataDir, "member")
+	if _, err := os.Stat(memberDir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	lg := zap.NewNop()
+
+	walDir := filepath.Join(memberDir, "wal")
+	if !wal.Exist(walDir) {
+		return corrupted(errors.New("the write-ahead log is missing"))
+	}
+	walSnaps, err := wal.ValidSnapshotEntries(lg, walDir)
+	if err != nil {
+		return corrupted(fmt.Errorf("failed to read the write-ahead log: %w", err))
+	}
+	// Like etcd, the log is read from its newest raft snapshot, or from its
+	// start when there is none.
+	var walSnap walpb.Snapshot
+	snapshot, err := snap.New(lg, filepath.Join(memberDir, "snap")).LoadNewestAvailable(walSnaps)
+	switch {
+	case err == nil:
+		walSnap = walpb.Snapshot{
+			Index:     snapshot.Metadata.Index,
+			Term:      snapshot.Metadata.Term,
+			ConfState: &snapshot.Metadata.ConfState,
+		}
+	case !errors.Is(err, snap.ErrNoSnapshot):
+		return corrupted(fmt.Errorf("failed to load the raft snapshot: %w", err))
+	}
+	if _, err := wal.Verify(lg, walDir, walSnap); err != nil {
+		return corrupted(fmt.Errorf("the write-ahead log from raft index %d is corrupted: %w", walSnap.Index, err))
+	}
+
+	db := filepath.Join(memberDir, "snap", "db")
+	if _, err := os.Stat(db); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// etcd creates the database when it is missing.
+			return nil
+		}
+		return err
+	}
+	return checkDatabase(db)
+}
+
+// checkDatabase checks the consistency of the pages of the database at path.
+func checkDatabase(path string) error {
+	db, err := bolt.Open(path, 0o400, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return corrupted(fmt.Errorf("failed to open the database: %w", err))
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		var errs []error
+		for err := range tx.Check() {
+			errs = append(errs, err)
+		}
+		if len(errs) > 0 {
+			return corrupted(fmt.Errorf("the database is corrupted: %w", errors.Join(errs...)))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,104 @@
+package datacheck
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/v3client"
+)
+
+// writeMember runs an etcd server on dir, writing enough keys for it to save
+// a raft snapshot, and stops it.
+func writeMember(t *testing.T, dir string) {
+	local, _ := url.Parse("http://127.0.0.1:0")
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	cfg.SnapshotCount = 10
+	cfg.ListenPeerUrls = []url.URL{*local}
+	cfg.ListenClientUrls = []url.URL{*local}
+	cfg.AdvertiseClientUrls = []url.URL{*local}
+	cfg.AdvertisePeerUrls = []url.URL{*local}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("Failed to start etcd server: %v", err)
+	}
+	defer e.Close()
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(60 * time.Second):
+		t.Fatalf("Server took too long to start")
+	}
+	c := v3client.New(e.Server)
+	defer c.Close()
+	for i := range 25 {
+		_, err := c.Put(context.Background(), fmt.Sprintf("key-%d", i), "value")
+		assert.NoError(t, err)
+	}
+}
+
+func copyDir(t *testing.T, src, dst string) {
+	assert.NoError(t, os.CopyFS(dst, os.DirFS(src)))
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	member := filepath.Join(dir, "member")
+	writeMember(t, member)
+	assert.NoError(t, Check(member))
+	snaps, err := filepath.Glob(filepath.Join(member, "member", "snap", "*.snap"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, snaps)
+
+	// A member which didn't start yet.
+	assert.NoError(t, Check(filepath.Join(dir, "empty")))
+
+	noWAL := filepath.Join(dir, "no-wal")
+	copyDir(t, member, noWAL)
+	assert.NoError(t, os.RemoveAll(filepath.Join(noWAL, "member", "wal")))
+	err = Check(noWAL)
+	assert.ErrorContains(t, err, "the write-ahead log is missing")
+	assert.ErrorAs(t, err, new(*CorruptedError))
+
+	corruptedWAL := filepath.Join(dir, "corrupted-wal")
+	copyDir(t, member, corruptedWAL)
+	wals, err := filepath.Glob(filepath.Join(corruptedWAL, "member", "wal", "*.wal"))
+	assert.NoError(t, err)
+	f, err := os.OpenFile(wals[len(wals)-1], os.O_RDWR, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteAt([]byte("corrupted"), 1024)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.ErrorAs(t, Check(corruptedWAL), new(*CorruptedError))
+
+	corruptedDB := filepath.Join(dir, "corrupted-db")
+	copyDir(t, member, corruptedDB)
+	assert.NoError(t, os.WriteFile(filepath.Join(corruptedDB, "member", "snap", "db"), []byte("not a database"), 0o600))
+	err = Check(corruptedDB)
+	assert.ErrorContains(t, err, "failed to open the database")
+	assert.ErrorAs(t, err, new(*CorruptedError))
+
+	noDB := filepath.Join(dir, "no-db")
+	copyDir(t, member, noDB)
+	assert.NoError(t, os.Remove(filepath.Join(noDB, "member", "snap", "db")))
+	assert.NoError(t, Check(noDB))
+
+	// Failing to read the data says nothing of its integrity.
+	if os.Geteuid() != 0 {
+		unreadable := filepath.Join(dir, "unreadable")
+		copyDir(t, member, unreadable)
+		assert.NoError(t, os.Chmod(filepath.Join(unreadable, "member", "snap", "db"), 0))
+		err = Check(unreadable)
+		assert.Error(t, err)
+		assert.NotErrorAs(t, err, new(*CorruptedError))
+	}
+}
@@ -0,0 +1,264 @@
+package etcdutils
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/authpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Permission is a permission of an etcd role on the keys from Key to
+// RangeEnd, or on Key alone when RangeEnd is empty.
+type Permission struct {
+	Key      string
+	RangeEnd string
+	Type     authpb.Permission_Type
+}
+
+// permissionRange identifies the keys of a permission. etcd holds at most one
+// permission per range and role.
+type permissionRange struct {
+	key, rangeEnd string
+}
+
+// SyncRole creates the role name when it doesn't exist, and grants and
+// revokes its permissions so that they are perms. It reports whether the role
+// changed.
+func (c *ClusterClient) SyncRole(eps []string, name string, perms []Permission) (bool, error) {
+	return syncRole(c.dial, eps, name, perms)
+}
+
+func syncRole(dial dialFunc, eps []string, name string, perms []Permission) (bool, error) {
+	c, release, err := dial(eps)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	changed := false
+	current := map[permissionRange]authpb.Permission_Type{}
+	resp, err := c.RoleGet(ctx, name)
+	switch {
+	case errors.Is(err, rpctypes.ErrRoleNotFound):
+		if _, err := c.RoleAdd(ctx, name); err != nil {
+			return false, err
+		}
+		changed = true
+	case err != nil:
+		return false, err
+	default:
+		for _, p := range resp.Perm {
+			current[permissionRange{string(p.Key), string(p.RangeEnd)}] = p.PermType
+		}
+	}
+
+	wanted := map[permissionRange]bool{}
+	for _, p := range perms {
+		r := permissionRange{p.Key, p.RangeEnd}
+		wanted[r] = true
+		// Granting a permission on a range replaces the one of the role on
+		// the same range.
+		if t, ok := current[r]; ok && t == p.Type {
+			continue
+		}
+		if _, err := c.RoleGrantPermission(ctx, name, p.Key, p.RangeEnd, clientv3.PermissionType(p.Type)); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	for r := range current {
+		if wanted[r] {
+			continue
+		}
+		if _, err := c.RoleRevokePermission(ctx, name, r.key, r.rangeEnd); err != nil && !errors.Is(err, rpctypes.ErrPermissionNotGranted) {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// DeleteRole deletes the role name, which is revoked from the users it was
+// granted to. A missing role isn't an error.
+func (c *ClusterClient) DeleteRole(eps []string, name string) error {
+	return deleteRole(c.dial, eps, name)
+}
+
+func deleteRole(dial dialFunc, eps []string, name string) error {
+	c, release, err := dial(eps)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := c.RoleDelete(ctx, name); err != nil && !errors.Is(err, rpctypes.ErrRoleNotFound) {
+		return err
+	}
+	return nil
+}
+
+// SyncUser creates the user name with password when it doesn't exist, and
+// grants and revokes its roles so that they are roles. The password of an
+// existing user is only changed when setPassword is true. It reports whether
+// the user changed.
+func (c *ClusterClient) SyncUser(eps []string, name, password string, setPassword bool, roles []string) (bool, error) {
+	return syncUser(c.dial, eps, name, password, setPassword, roles)
+}
+
+func syncUser(dial dialFunc, eps []string, name, password string, setPassword bool, roles []string) (bool, error) {
+	c, release, err := dial(eps)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	changed := false
+	var current []string
+	resp, err := c.UserGet(ctx, name)
+	switch {
+	case errors.Is(err, rpctypes.ErrUserNotFound):
+		if _, err := c.UserAdd(ctx, name, password); err != nil {
+			return false, err
+		}
+		changed = true
+	case err != nil:
+		return false, err
+	default:
+		current = resp.Roles
+		if setPassword {
+			if _, err := c.UserChangePassword(ctx, name, password); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+
+	for _, role := range roles {
+		if slices.Contains(current, role) {
+			continue
+		}
+		if _, err := c.UserGrantRole(ctx, name, role); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	for _, role := range current {
+		if slices.Contains(roles, role) {
+			continue
+		}
+		if _, err := c.UserRevokeRole(ctx, name, role); err != nil && !errors.Is(err, rpctypes.ErrRoleNotGranted) {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// DeleteUser deletes the user name. A missing user isn't an error.
+func (c *ClusterClient) DeleteUser(eps []string, name string) error {
+	return deleteUser(c.dial, eps, name)
+}
+
+func deleteUser(dial dialFunc, eps []string, name string) error {
+	c, release, err := dial(eps)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := c.UserDelete(ctx, name); err != nil && !errors.Is(err, rpctypes.ErrUserNotFound) {
+		return err
+	}
+	return nil
+}
+
+// rootRole is the built-in role granting everything, whose users etcd
+// requires to enable the authentication.
+const rootRole = "root"
+
+// EnableAuth enables the authentication of the cluster, once the user
+// name, with password, exists and has the root role. It reports whether the
+// authentication was disabled until then. The password of an existing user
+// is changed to password, so it is known to the caller.
+func (c *ClusterClient) EnableAuth(eps []string, name, password string) (bool, error) {
+	return enableAuth(c.dial, eps, name, password)
+}
+
+func enableAuth(dial dialFunc, eps []string, name, password string) (bool, error) {
+	c, release, err := dial(eps)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	status, err := c.AuthStatus(ctx)
+	if err != nil {
+		return false, err
+	}
+	if status.Enabled {
+		return false, nil
+	}
+
+	if _, err := c.UserAdd(ctx, name, password); errors.Is(err, rpctypes.ErrUserAlreadyExist) {
+		if _, err := c.UserChangePassword(ctx, name, password); err != nil {
+			return false, err
+		}
+	} else if err != nil {
+		return false, err
+	}
+	if _, err := c.UserGrantRole(ctx, name, rootRole); err != nil {
+		return false, err
+	}
+	if _, err := c.AuthEnable(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DisableAuth disables the authentication of the cluster. It reports whether
+// the authentication was enabled until then.
+func (c *ClusterClient) DisableAuth(eps []string) (bool, error) {
+	return disableAuth(c.dial, eps)
+}
+
+func disableAuth(dial dialFunc, eps []string) (bool, error) {
+	c, release, err := dial(eps)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	status, err := c.AuthStatus(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !status.Enabled {
+		return false, nil
+	}
+	if _, err := c.AuthDisable(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
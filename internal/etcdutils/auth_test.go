@@ -0,0 +1,115 @@
+package etcdutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestSyncRole(t *testing.T) {
+	e := setupEtcdServer(t)
+	defer e.Close()
+	eps := []string{"http://localhost:2379"}
+
+	perms := []Permission{
+		{Key: "/app/", RangeEnd: clientv3.GetPrefixRangeEnd("/app/"), Type: clientv3.PermReadWrite},
+		{Key: "/config", Type: clientv3.PermRead},
+	}
+	changed, err := syncRole(dial, eps, "app", perms)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	changed, err = syncRole(dial, eps, "app", perms)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// The permission on /config changes type, the one on /app/ is revoked.
+	perms = []Permission{{Key: "/config", Type: clientv3.PermWrite}}
+	changed, err = syncRole(dial, eps, "app", perms)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	c, release, err := dial(eps)
+	assert.NoError(t, err)
+	defer release()
+	resp, err := c.RoleGet(context.Background(), "app")
+	assert.NoError(t, err)
+	assert.Len(t, resp.Perm, 1)
+	assert.Equal(t, "/config", string(resp.Perm[0].Key))
+	assert.Equal(t, clientv3.PermWrite, resp.Perm[0].PermType)
+
+	assert.NoError(t, deleteRole(dial, eps, "app"))
+	assert.NoError(t, deleteRole(dial, eps, "app"))
+	_, err = c.RoleGet(context.Background(), "app")
+	assert.Error(t, err)
+}
+
+func TestSyncUser(t *testing.T) {
+	e := setupEtcdServer(t)
+	defer e.Close()
+	eps := []string{"http://localhost:2379"}
+
+	for _, role := range []string{"reader", "writer"} {
+		_, err := syncRole(dial, eps, role, nil)
+		assert.NoError(t, err)
+	}
+
+	changed, err := syncUser(dial, eps, "app", "secret", false, []string{"reader"})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = syncUser(dial, eps, "app", "secret", false, []string{"reader"})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = syncUser(dial, eps, "app", "other", true, []string{"writer"})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	c, release, err := dial(eps)
+	assert.NoError(t, err)
+	defer release()
+	resp, err := c.UserGet(context.Background(), "app")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"writer"}, resp.Roles)
+
+	// A missing role can't be granted.
+	_, err = syncUser(dial, eps, "app", "other", false, []string{"writer", "missing"})
+	assert.Error(t, err)
+
+	assert.NoError(t, deleteUser(dial, eps, "app"))
+	assert.NoError(t, deleteUser(dial, eps, "app"))
+	_, err = c.UserGet(context.Background(), "app")
+	assert.Error(t, err)
+}
+
+func TestEnableAuth(t *testing.T) {
+	e := setupEtcdServer(t)
+	defer e.Close()
+	eps := []string{"http://localhost:2379"}
+	c := NewClientPool().Cluster("default/test", nil, &Credentials{Username: "root", Password: "secret"})
+
+	enabled, err := c.EnableAuth(eps, "root", "secret")
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+	enabled, err = c.EnableAuth(eps, "root", "secret")
+	assert.NoError(t, err)
+	assert.False(t, enabled)
+
+	// The clients of the pool authenticate, the others are denied.
+	_, err = c.MemberList(eps)
+	assert.NoError(t, err)
+	anonymous, release, err := dial(eps)
+	assert.NoError(t, err)
+	defer release()
+	_, err = anonymous.Get(context.Background(), "foo")
+	assert.Error(t, err)
+
+	disabled, err := c.DisableAuth(eps)
+	assert.NoError(t, err)
+	assert.True(t, disabled)
+	disabled, err = c.DisableAuth(eps)
+	assert.NoError(t, err)
+	assert.False(t, disabled)
+	_, err = anonymous.Get(context.Background(), "foo")
+	assert.NoError(t, err)
+}
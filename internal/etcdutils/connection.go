@@ -0,0 +1,36 @@
+package etcdutils
+
+import (
+	"crypto/tls"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Connection is how a client connects to an etcd cluster.
+type Connection struct {
+	Endpoints []string
+	// TLSConfig is the TLS configuration of the client, nil for plain HTTP.
+	TLSConfig *tls.Config
+	// Credentials are the user and the password of the client, nil when it
+	// doesn't authenticate.
+	Credentials *Credentials
+}
+
+// NewClient returns a new client connected as conn. Unlike the clients of a
+// ClientPool, it belongs to the caller, who closes it, e.g. once done with
+// its long-running watches.
+func (conn Connection) NewClient() (*clientv3.Client, error) {
+	cfg := newClientConfig(conn.Endpoints, conn.TLSConfig)
+	if conn.Credentials != nil {
+		cfg.Username, cfg.Password = conn.Credentials.Username, conn.Credentials.Password
+	}
+	return clientv3.New(cfg)
+}
+
+// Equal reports whether conn and other connect to the same endpoints the same
+// way.
+func (conn Connection) Equal(other Connection) bool {
+	return endpointsKey(conn.Endpoints) == endpointsKey(other.Endpoints) &&
+		sameTLSConfig(conn.TLSConfig, other.TLSConfig) &&
+		sameCredentials(conn.Credentials, other.Credentials)
+}
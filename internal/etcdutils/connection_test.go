@@ -0,0 +1,24 @@
+package etcdutils
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionEqual(t *testing.T) {
+	conn := Connection{
+		Endpoints:   []string{"https://a:2379", "https://b:2379"},
+		TLSConfig:   &tls.Config{ServerName: "a"},
+		Credentials: &Credentials{Username: "root", Password: "secret"},
+	}
+	assert.True(t, conn.Equal(Connection{
+		Endpoints:   []string{"https://b:2379", "https://a:2379"},
+		TLSConfig:   &tls.Config{ServerName: "a"},
+		Credentials: &Credentials{Username: "root", Password: "secret"},
+	}))
+	assert.False(t, conn.Equal(Connection{Endpoints: conn.Endpoints, TLSConfig: conn.TLSConfig}))
+	assert.False(t, conn.Equal(Connection{Endpoints: conn.Endpoints, Credentials: conn.Credentials}))
+	assert.False(t, conn.Equal(Connection{Endpoints: conn.Endpoints[:1], TLSConfig: conn.TLSConfig, Credentials: conn.Credentials}))
+}
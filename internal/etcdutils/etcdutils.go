@@ -2,6 +2,7 @@ package etcdutils
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"sort"
@@ -10,35 +11,48 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
-	"go.uber.org/zap"
 
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
 	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
-	"go.etcd.io/etcd/client/pkg/v3/logutil"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
-func MemberList(eps []string) (*clientv3.MemberListResponse, error) {
-	cfg := clientv3.Config{
+// dialFunc returns a client connected to eps, along with the function to call
+// once done with it.
+type dialFunc func(eps []string) (*clientv3.Client, func(), error)
+
+func newClientConfig(eps []string, tlsConfig *tls.Config) clientv3.Config {
+	return clientv3.Config{
 		Endpoints:            eps,
 		DialTimeout:          2 * time.Second,
 		DialKeepAliveTime:    2 * time.Second,
 		DialKeepAliveTimeout: 6 * time.Second,
+		TLS:                  tlsConfig,
 	}
+}
 
-	c, err := clientv3.New(cfg)
+// dial creates a new client, which is closed once released.
+func dial(eps []string) (*clientv3.Client, func(), error) {
+	c, err := clientv3.New(newClientConfig(eps, nil))
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, func() { _ = c.Close() }, nil
+}
+
+func MemberList(eps []string) (*clientv3.MemberListResponse, error) {
+	return memberList(dial, eps)
+}
+
+func memberList(dial dialFunc, eps []string) (*clientv3.MemberListResponse, error) {
+	c, release, err := dial(eps)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer func() {
-		err := c.Close()
-		if err != nil {
-			cancel()
-			return
-		}
-		cancel()
-	}()
+	defer cancel()
 
 	return c.MemberList(ctx)
 }
@@ -121,38 +135,25 @@ func FindLearnerStatus(healthInfos []EpHealth, logger logr.Logger) (uint64, *cli
 }
 
 func ClusterHealth(eps []string) ([]EpHealth, error) {
-	lg, err := logutil.CreateDefaultZapLogger(zap.InfoLevel)
-	if err != nil {
-		return nil, err
-	}
-
-	var cfgs = make([]*clientv3.Config, 0, len(eps))
-	for _, ep := range eps {
-		cfg := &clientv3.Config{
-			Endpoints:            []string{ep},
-			DialTimeout:          2 * time.Second,
-			DialKeepAliveTime:    2 * time.Second,
-			DialKeepAliveTimeout: 6 * time.Second,
-		}
-
-		cfgs = append(cfgs, cfg)
-	}
+	return clusterHealth(dial, eps)
+}
 
+func clusterHealth(dial dialFunc, eps []string) ([]EpHealth, error) {
 	healthCh := make(chan EpHealth, len(eps))
 
 	var wg sync.WaitGroup
-	for _, cfg := range cfgs {
+	for _, ep := range eps {
 		wg.Add(1)
-		go func(cfg *clientv3.Config) {
+		go func(ep string) {
 			defer wg.Done()
 
-			ep := cfg.Endpoints[0]
-			cfg.Logger = lg.Named("client")
-			cli, err := clientv3.New(*cfg)
+			cli, release, err := dial([]string{ep})
 			if err != nil {
 				healthCh <- EpHealth{Ep: ep, Health: false, Error: err.Error()}
 				return
 			}
+			defer release()
+
 			startTs := time.Now()
 			// get a random key. As long as we can get the response
 			// without an error, the endpoint is health.
@@ -180,7 +181,7 @@ func ClusterHealth(eps []string) ([]EpHealth, error) {
 			}
 			cancel()
 			healthCh <- eh
-		}(cfg)
+		}(ep)
 	}
 	wg.Wait()
 	close(healthCh)
@@ -195,27 +196,18 @@ func ClusterHealth(eps []string) ([]EpHealth, error) {
 }
 
 func AddMember(eps []string, peerURLs []string, learner bool) (*clientv3.MemberAddResponse, error) {
-	cfg := clientv3.Config{
-		Endpoints:            eps,
-		DialTimeout:          2 * time.Second,
-		DialKeepAliveTime:    2 * time.Second,
-		DialKeepAliveTimeout: 6 * time.Second,
-	}
+	return addMember(dial, eps, peerURLs, learner)
+}
 
-	c, err := clientv3.New(cfg)
+func addMember(dial dialFunc, eps []string, peerURLs []string, learner bool) (*clientv3.MemberAddResponse, error) {
+	c, release, err := dial(eps)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer func() {
-		err := c.Close()
-		if err != nil {
-			cancel()
-			return
-		}
-		cancel()
-	}()
+	defer cancel()
 
 	if learner {
 		return c.MemberAddAsLearner(ctx, peerURLs)
@@ -225,55 +217,149 @@ func AddMember(eps []string, peerURLs []string, learner bool) (*clientv3.MemberA
 }
 
 func PromoteLearner(eps []string, learnerId uint64) error {
-	cfg := clientv3.Config{
-		Endpoints:            eps,
-		DialTimeout:          2 * time.Second,
-		DialKeepAliveTime:    2 * time.Second,
-		DialKeepAliveTimeout: 6 * time.Second,
-	}
+	return promoteLearner(dial, eps, learnerId)
+}
 
-	c, err := clientv3.New(cfg)
+func promoteLearner(dial dialFunc, eps []string, learnerId uint64) error {
+	c, release, err := dial(eps)
 	if err != nil {
 		return err
 	}
+	defer release()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer func() {
-		err := c.Close()
-		if err != nil {
-			cancel()
-			return
-		}
-		cancel()
-	}()
+	defer cancel()
 
 	_, err = c.MemberPromote(ctx, learnerId)
 	return err
 }
 
 func RemoveMember(eps []string, memberID uint64) error {
-	cfg := clientv3.Config{
-		Endpoints:            eps,
-		DialTimeout:          2 * time.Second,
-		DialKeepAliveTime:    2 * time.Second,
-		DialKeepAliveTimeout: 6 * time.Second,
-	}
+	return removeMember(dial, eps, memberID)
+}
 
-	c, err := clientv3.New(cfg)
+func removeMember(dial dialFunc, eps []string, memberID uint64) error {
+	c, release, err := dial(eps)
 	if err != nil {
 		return err
 	}
+	defer release()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer func() {
-		err := c.Close()
-		if err != nil {
-			cancel()
-			return
-		}
-		cancel()
-	}()
+	defer cancel()
 
 	_, err = c.MemberRemove(ctx, memberID)
 	return err
 }
+
+func Defragment(ep string) error {
+	return defragment(dial, ep)
+}
+
+func defragment(dial dialFunc, ep string) error {
+	c, release, err := dial([]string{ep})
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Defragmenting a large database blocks the member for a while.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	_, err = c.Defragment(ctx, ep)
+	return err
+}
+
+// MoveLeader transfers the leadership of the cluster to the member
+// transfereeID. ep must be the endpoint of the leader, only the leader can
+// transfer its leadership.
+func MoveLeader(ep string, transfereeID uint64) error {
+	return moveLeader(dial, ep, transfereeID)
+}
+
+func moveLeader(dial dialFunc, ep string, transfereeID uint64) error {
+	c, release, err := dial([]string{ep})
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err = c.MoveLeader(ctx, transfereeID)
+	return err
+}
+
+// AlarmList returns the alarms raised by the members of the cluster.
+func AlarmList(eps []string) ([]*etcdserverpb.AlarmMember, error) {
+	return alarmList(dial, eps)
+}
+
+func alarmList(dial dialFunc, eps []string) ([]*etcdserverpb.AlarmMember, error) {
+	c, release, err := dial(eps)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resp, err := c.AlarmList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Alarms, nil
+}
+
+// AlarmDisarm disarms alarm, once its cause is fixed.
+func AlarmDisarm(eps []string, alarm *etcdserverpb.AlarmMember) error {
+	return alarmDisarm(dial, eps, alarm)
+}
+
+func alarmDisarm(dial dialFunc, eps []string, alarm *etcdserverpb.AlarmMember) error {
+	c, release, err := dial(eps)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err = c.AlarmDisarm(ctx, (*clientv3.AlarmMember)(alarm))
+	return err
+}
+
+// CompactToLatest compacts the keyspace of the cluster to its current
+// revision, discarding the history of the keys, and returns the revision.
+// The keyspace already compacted to the revision isn't an error.
+func CompactToLatest(eps []string) (int64, error) {
+	return compactToLatest(dial, eps)
+}
+
+func compactToLatest(dial dialFunc, eps []string) (int64, error) {
+	c, release, err := dial(eps)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Any read returns the current revision of the keyspace.
+	resp, err := c.Get(ctx, "compact", clientv3.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	rev := resp.Header.Revision
+	// Compacting physically waits for the space to be freed in the
+	// backend, so it can be reclaimed by defragmenting.
+	if _, err := c.Compact(ctx, rev, clientv3.WithCompactPhysical()); err != nil && !errors.Is(err, rpctypes.ErrCompacted) {
+		return 0, err
+	}
+	return rev, nil
+}
@@ -153,6 +153,67 @@ func TestRemoveMember(t *testing.T) {
 	})
 }
 
+func TestDefragment(t *testing.T) {
+	e := setupEtcdServer(t)
+	defer e.Close()
+
+	assert.NoError(t, Defragment("http://localhost:2379"))
+}
+
+func TestMoveLeader(t *testing.T) {
+	e := setupEtcdServer(t)
+	defer e.Close()
+
+	// An unknown member can't take over the leadership.
+	assert.Error(t, MoveLeader("http://localhost:2379", 12345))
+}
+
+func TestAlarms(t *testing.T) {
+	e := setupEtcdServer(t)
+	defer e.Close()
+	eps := []string{"http://localhost:2379"}
+
+	alarms, err := AlarmList(eps)
+	assert.NoError(t, err)
+	assert.Empty(t, alarms)
+
+	// Raise the alarm the way a member out of space does.
+	alarm := &etcdserverpb.AlarmMember{MemberID: uint64(e.Server.ID()), Alarm: etcdserverpb.AlarmType_NOSPACE}
+	_, err = e.Server.Alarm(context.Background(), &etcdserverpb.AlarmRequest{
+		Action: etcdserverpb.AlarmRequest_ACTIVATE, MemberID: alarm.MemberID, Alarm: alarm.Alarm,
+	})
+	assert.NoError(t, err)
+	alarms, err = AlarmList(eps)
+	assert.NoError(t, err)
+	assert.Equal(t, []*etcdserverpb.AlarmMember{alarm}, alarms)
+
+	assert.NoError(t, AlarmDisarm(eps, alarm))
+	alarms, err = AlarmList(eps)
+	assert.NoError(t, err)
+	assert.Empty(t, alarms)
+}
+
+func TestCompactToLatest(t *testing.T) {
+	e := setupEtcdServer(t)
+	defer e.Close()
+	eps := []string{"http://localhost:2379"}
+
+	c, release, err := dial(eps)
+	assert.NoError(t, err)
+	defer release()
+	resp, err := c.Put(context.Background(), "key", "value")
+	assert.NoError(t, err)
+
+	rev, err := CompactToLatest(eps)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.Header.Revision, rev)
+
+	// Compacting again to the same revision succeeds.
+	rev, err = CompactToLatest(eps)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.Header.Revision, rev)
+}
+
 func TestIsLearnerReady(t *testing.T) {
 	leaderStatus := &clientv3.StatusResponse{
 		Header: &etcdserverpb.ResponseHeader{
@@ -0,0 +1,141 @@
+package etcdutils
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// flagLifecycle records in which minor versions of etcd a command line flag
+// was introduced, deprecated and removed. Empty fields mean the flag has been
+// around since before the oldest supported version, or hasn't been
+// deprecated/removed yet.
+type flagLifecycle struct {
+	added       string
+	deprecated  string
+	removed     string
+	replacement string
+}
+
+// etcdFlags lists the flags whose availability depends on the etcd version.
+// Flags that are accepted by every supported version aren't listed.
+var etcdFlags = map[string]flagLifecycle{
+	// Removed in v3.5.
+	"--debug":              {deprecated: "3.4", removed: "3.5", replacement: "--log-level=debug"},
+	"--log-output":         {deprecated: "3.4", removed: "3.5", replacement: "--log-outputs"},
+	"--log-package-levels": {deprecated: "3.4", removed: "3.5", replacement: "--log-level"},
+
+	// The v2 API and the v2 proxy were removed in v3.6.
+	"--enable-v2":                {deprecated: "3.5", removed: "3.6"},
+	"--experimental-enable-v2v3": {deprecated: "3.5", removed: "3.6"},
+	"--proxy":                    {deprecated: "3.5", removed: "3.6"},
+	"--proxy-failure-wait":       {deprecated: "3.5", removed: "3.6"},
+	"--proxy-refresh-interval":   {deprecated: "3.5", removed: "3.6"},
+	"--proxy-dial-timeout":       {deprecated: "3.5", removed: "3.6"},
+	"--proxy-write-timeout":      {deprecated: "3.5", removed: "3.6"},
+	"--proxy-read-timeout":       {deprecated: "3.5", removed: "3.6"},
+
+	// Experimental flags graduated in v3.6. The old names keep working
+	// until v3.7, the new ones are unknown to v3.5.
+	"--experimental-compact-hash-check-time":           {deprecated: "3.6", removed: "3.7", replacement: "--compact-hash-check-time"},
+	"--experimental-corrupt-check-time":                {deprecated: "3.6", removed: "3.7", replacement: "--corrupt-check-time"},
+	"--experimental-compaction-batch-limit":            {deprecated: "3.6", removed: "3.7", replacement: "--compaction-batch-limit"},
+	"--experimental-compaction-sleep-interval":         {deprecated: "3.6", removed: "3.7", replacement: "--compaction-sleep-interval"},
+	"--experimental-downgrade-check-time":              {deprecated: "3.6", removed: "3.7", replacement: "--downgrade-check-time"},
+	"--experimental-memory-mlock":                      {deprecated: "3.6", removed: "3.7", replacement: "--memory-mlock"},
+	"--experimental-max-learners":                      {deprecated: "3.6", removed: "3.7", replacement: "--max-learners"},
+	"--experimental-peer-skip-client-san-verification": {deprecated: "3.6", removed: "3.7", replacement: "--peer-skip-client-san-verification"},
+	"--experimental-snapshot-catchup-entries":          {deprecated: "3.6", removed: "3.7", replacement: "--snapshot-catchup-entries"},
+	"--experimental-warning-apply-duration":            {deprecated: "3.6", removed: "3.7", replacement: "--warning-apply-duration"},
+	"--experimental-watch-progress-notify-interval":    {deprecated: "3.6", removed: "3.7", replacement: "--watch-progress-notify-interval"},
+	"--experimental-initial-corrupt-check":             {deprecated: "3.6", removed: "3.7", replacement: "--feature-gates=InitialCorruptCheck=true"},
+	"--experimental-enable-lease-checkpoint":           {deprecated: "3.6", removed: "3.7", replacement: "--feature-gates=LeaseCheckpoint=true"},
+	"--experimental-stop-grpc-service-on-defrag":       {deprecated: "3.6", removed: "3.7", replacement: "--feature-gates=StopGRPCServiceOnDefrag=true"},
+
+	"--feature-gates":                     {added: "3.6"},
+	"--memory-mlock":                      {added: "3.6"},
+	"--compact-hash-check-time":           {added: "3.6"},
+	"--corrupt-check-time":                {added: "3.6"},
+	"--compaction-batch-limit":            {added: "3.6"},
+	"--compaction-sleep-interval":         {added: "3.6"},
+	"--downgrade-check-time":              {added: "3.6"},
+	"--max-learners":                      {added: "3.6"},
+	"--peer-skip-client-san-verification": {added: "3.6"},
+	"--snapshot-catchup-entries":          {added: "3.6"},
+	"--warning-apply-duration":            {added: "3.6"},
+	"--watch-progress-notify-interval":    {added: "3.6"},
+}
+
+// FlagIssue describes a problem with a flag passed to etcd.
+type FlagIssue struct {
+	// Index is the position of the offending argument.
+	Index int
+	// Flag is the name of the offending flag.
+	Flag string
+	// Message explains the problem.
+	Message string
+	// Fatal is set when etcd refuses to start with the flag, as opposed to
+	// only logging a deprecation warning.
+	Fatal bool
+}
+
+// FlagName returns the name of a command line argument, i.e. the argument
+// without its value.
+func FlagName(arg string) string {
+	arg = strings.TrimSpace(arg)
+	if idx := strings.IndexAny(arg, "= "); idx != -1 {
+		return arg[:idx]
+	}
+	return arg
+}
+
+// CheckFlagCompatibility checks that the given etcd command line arguments are
+// accepted by etcdVersion. It returns an error only if etcdVersion can't be
+// parsed.
+func CheckFlagCompatibility(etcdVersion string, args []string) ([]FlagIssue, error) {
+	v, err := version.ParseGeneric(etcdVersion)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse etcd version %q: %w", etcdVersion, err)
+	}
+
+	var issues []FlagIssue
+	for i, arg := range args {
+		name := FlagName(arg)
+		lifecycle, ok := etcdFlags[name]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case lifecycle.added != "" && v.LessThan(version.MustParseGeneric(lifecycle.added)):
+			issues = append(issues, FlagIssue{
+				Index:   i,
+				Flag:    name,
+				Message: fmt.Sprintf("%s is not supported before etcd v%s", name, lifecycle.added),
+				Fatal:   true,
+			})
+		case lifecycle.removed != "" && v.AtLeast(version.MustParseGeneric(lifecycle.removed)):
+			issues = append(issues, FlagIssue{
+				Index:   i,
+				Flag:    name,
+				Message: withReplacement(fmt.Sprintf("%s was removed in etcd v%s", name, lifecycle.removed), lifecycle.replacement),
+				Fatal:   true,
+			})
+		case lifecycle.deprecated != "" && v.AtLeast(version.MustParseGeneric(lifecycle.deprecated)):
+			issues = append(issues, FlagIssue{
+				Index:   i,
+				Flag:    name,
+				Message: withReplacement(fmt.Sprintf("%s is deprecated since etcd v%s", name, lifecycle.deprecated), lifecycle.replacement),
+			})
+		}
+	}
+	return issues, nil
+}
+
+func withReplacement(msg, replacement string) string {
+	if replacement == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s, use %s instead", msg, replacement)
+}
@@ -0,0 +1,77 @@
+package etcdutils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagName(t *testing.T) {
+	assert.Equal(t, "--snapshot-count", FlagName("--snapshot-count=5000"))
+	assert.Equal(t, "--snapshot-count", FlagName("--snapshot-count 5000"))
+	assert.Equal(t, "--enable-v2", FlagName("--enable-v2"))
+}
+
+func TestCheckFlagCompatibility(t *testing.T) {
+	tests := []struct {
+		name          string
+		version       string
+		args          []string
+		expectedFlags []string
+		expectedFatal []bool
+	}{
+		{
+			name:    "supported flags",
+			version: "v3.5.21",
+			args:    []string{"--snapshot-count=5000", "--experimental-max-learners=2"},
+		},
+		{
+			name:          "flag removed in an older version",
+			version:       "v3.5.21",
+			args:          []string{"--snapshot-count=5000", "--debug"},
+			expectedFlags: []string{"--debug"},
+			expectedFatal: []bool{true},
+		},
+		{
+			name:          "flag added in a newer version",
+			version:       "v3.5.21",
+			args:          []string{"--feature-gates=InitialCorruptCheck=true"},
+			expectedFlags: []string{"--feature-gates"},
+			expectedFatal: []bool{true},
+		},
+		{
+			name:          "deprecated and removed flags",
+			version:       "v3.6.0",
+			args:          []string{"--experimental-max-learners=2", "--enable-v2"},
+			expectedFlags: []string{"--experimental-max-learners", "--enable-v2"},
+			expectedFatal: []bool{false, true},
+		},
+		{
+			name:    "version without patch",
+			version: "3.6",
+			args:    []string{"--max-learners=2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := CheckFlagCompatibility(tt.version, tt.args)
+			assert.NoError(t, err)
+
+			var flags []string
+			var fatal []bool
+			for _, issue := range issues {
+				flags = append(flags, issue.Flag)
+				fatal = append(fatal, issue.Fatal)
+				assert.Equal(t, issue.Flag, FlagName(tt.args[issue.Index]))
+			}
+			assert.Equal(t, tt.expectedFlags, flags)
+			assert.Equal(t, tt.expectedFatal, fatal)
+		})
+	}
+}
+
+func TestCheckFlagCompatibilityInvalidVersion(t *testing.T) {
+	_, err := CheckFlagCompatibility("latest", []string{"--debug"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,457 @@
+package etcdutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/connectivity"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// evictionInterval is how often a started ClientPool evicts its failed and
+// idle connections.
+const evictionInterval = time.Minute
+
+// ClientPool caches the etcd clients of each cluster, so that consecutive
+// reconciles and health checks reuse their connections instead of dialing,
+// and handshaking, on every call.
+type ClientPool struct {
+	// StatusTTL is how long the member lists and the health of the clusters
+	// are cached, so that frequent reconciles don't query every member each
+	// time. They aren't cached when it is 0. The membership changes made
+	// through the pool discard the cached results of the cluster.
+	StatusTTL time.Duration
+	// IdleTimeout is how long a connection can stay unused before it is
+	// evicted, e.g. the ones to the former members of a cluster. The
+	// connections aren't evicted for being idle when it is 0.
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	clusters map[string]*clusterClients
+}
+
+// Credentials are the user and the password a client authenticates to etcd
+// with.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// clientOptions are how the clients of a cluster connect to it.
+type clientOptions struct {
+	tlsConfig *tls.Config
+	creds     *Credentials
+}
+
+type clusterClients struct {
+	opts clientOptions
+	// clients are keyed by the endpoints they are connected to.
+	clients map[string]*clientv3.Client
+	// lastUsed is when each client was last handed out, by the same key.
+	lastUsed map[string]time.Time
+	// results are keyed by the operation and the endpoints it queried.
+	results map[string]cachedResult
+}
+
+type cachedResult struct {
+	value   any
+	expires time.Time
+}
+
+// NewClientPool returns an empty ClientPool.
+func NewClientPool() *ClientPool {
+	return &ClientPool{clusters: map[string]*clusterClients{}}
+}
+
+// Cluster returns a client for the cluster identified by name, which uses the
+// connections of the pool, and authenticates with creds when they are set.
+// The cached connections of the cluster are closed when tlsConfig or creds
+// differ from the ones they were created with.
+func (p *ClientPool) Cluster(name string, tlsConfig *tls.Config, creds *Credentials) *ClusterClient {
+	return &ClusterClient{pool: p, name: name, opts: clientOptions{tlsConfig: tlsConfig, creds: creds}}
+}
+
+// Close closes the connections of the cluster identified by name, e.g. once
+// it is deleted.
+func (p *ClientPool) Close(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cc, ok := p.clusters[name]; ok {
+		cc.close()
+		delete(p.clusters, name)
+	}
+}
+
+// Warm opens, ahead of the next operations on the cluster identified by
+// name, the connections they use to reach eps: one to all the endpoints, and
+// one to each of them.
+func (p *ClientPool) Warm(name string, eps []string, tlsConfig *tls.Config, creds *Credentials) error {
+	if len(eps) == 0 {
+		return nil
+	}
+	opts := clientOptions{tlsConfig: tlsConfig, creds: creds}
+	var errs []error
+	if _, err := p.client(name, eps, opts); err != nil {
+		errs = append(errs, err)
+	}
+	for _, ep := range eps {
+		if _, err := p.client(name, []string{ep}, opts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CloseAll closes all the connections of the pool.
+func (p *ClientPool) CloseAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for name, cc := range p.clusters {
+		cc.close()
+		delete(p.clusters, name)
+	}
+}
+
+// Check reports an error when the pool can't be locked within a second,
+// which would block all the operations on the clusters. It is meant to be
+// used as a health check of the operator.
+func (p *ClientPool) Check(_ *http.Request) error {
+	deadline := time.Now().Add(time.Second)
+	for !p.mu.TryLock() {
+		if time.Now().After(deadline) {
+			return errors.New("etcd client pool is locked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *ClientPool) client(name string, eps []string, opts clientOptions) (*clientv3.Client, error) {
+	key := endpointsKey(eps)
+	if c := p.cached(name, key, opts); c != nil {
+		return c, nil
+	}
+
+	// Dial without holding the lock, so that an unreachable cluster doesn't
+	// hold back the others.
+	cfg := newClientConfig(eps, opts.tlsConfig)
+	if opts.creds != nil {
+		cfg.Username, cfg.Password = opts.creds.Username, opts.creds.Password
+	}
+	c, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cc := p.clusterClients(name, opts)
+	if existing, ok := cc.clients[key]; ok {
+		// Another caller dialed the same endpoints concurrently.
+		_ = c.Close()
+		return existing, nil
+	}
+	cc.clients[key] = c
+	cc.lastUsed[key] = time.Now()
+	return c, nil
+}
+
+// cached returns the cached client of the cluster connected to the endpoints
+// identified by key, or nil if there is no usable one.
+func (p *ClientPool) cached(name, key string, opts clientOptions) *clientv3.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cc := p.clusterClients(name, opts)
+	c, ok := cc.clients[key]
+	if !ok {
+		return nil
+	}
+	// Drop the connections which failed, so that the next calls start over
+	// with a fresh one.
+	if !failed(c) {
+		cc.lastUsed[key] = time.Now()
+		return c
+	}
+	_ = c.Close()
+	delete(cc.clients, key)
+	delete(cc.lastUsed, key)
+	return nil
+}
+
+// failed reports whether the connection of c failed.
+func failed(c *clientv3.Client) bool {
+	state := c.ActiveConnection().GetState()
+	return state == connectivity.TransientFailure || state == connectivity.Shutdown
+}
+
+// Evict closes the connections which failed, and the ones unused for longer
+// than the IdleTimeout, rather than waiting for the next operation on their
+// cluster, which may never come. It returns how many connections it closed.
+func (p *ClientPool) Evict() int {
+	return p.evict(time.Now())
+}
+
+func (p *ClientPool) evict(now time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	evicted := 0
+	for name, cc := range p.clusters {
+		for key, c := range cc.clients {
+			idle := p.IdleTimeout > 0 && now.Sub(cc.lastUsed[key]) > p.IdleTimeout
+			if !idle && !failed(c) {
+				continue
+			}
+			_ = c.Close()
+			delete(cc.clients, key)
+			delete(cc.lastUsed, key)
+			evicted++
+		}
+		for key, r := range cc.results {
+			if now.After(r.expires) {
+				delete(cc.results, key)
+			}
+		}
+		if len(cc.clients) == 0 && len(cc.results) == 0 {
+			delete(p.clusters, name)
+		}
+	}
+	return evicted
+}
+
+// Start evicts the failed and idle connections periodically, until ctx is
+// done.
+func (p *ClientPool) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("etcd-client-pool")
+	ticker := time.NewTicker(evictionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if evicted := p.Evict(); evicted > 0 {
+			logger.V(1).Info("Evicted etcd connections", "count", evicted)
+		}
+	}
+}
+
+// NeedLeaderElection makes the eviction run on all the replicas of the
+// operator, as the warm standby replicas hold connections too.
+func (p *ClientPool) NeedLeaderElection() bool {
+	return false
+}
+
+// clusterClients returns the clients of the cluster, after closing them if
+// they were created with a different TLS configuration or credentials. It
+// must be called with the lock held.
+func (p *ClientPool) clusterClients(name string, opts clientOptions) *clusterClients {
+	cc, ok := p.clusters[name]
+	if ok && sameTLSConfig(cc.opts.tlsConfig, opts.tlsConfig) && sameCredentials(cc.opts.creds, opts.creds) {
+		return cc
+	}
+	if ok {
+		cc.close()
+	}
+	cc = &clusterClients{
+		opts:     opts,
+		clients:  map[string]*clientv3.Client{},
+		lastUsed: map[string]time.Time{},
+		results:  map[string]cachedResult{},
+	}
+	p.clusters[name] = cc
+	return cc
+}
+
+func (cc *clusterClients) close() {
+	for _, c := range cc.clients {
+		_ = c.Close()
+	}
+	clear(cc.clients)
+	clear(cc.lastUsed)
+	clear(cc.results)
+}
+
+// loadResult returns the unexpired result of the cluster identified by
+// name stored under key.
+func (p *ClientPool) loadResult(name, key string) (any, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cc, ok := p.clusters[name]
+	if !ok {
+		return nil, false
+	}
+	r, ok := cc.results[key]
+	if !ok || time.Now().After(r.expires) {
+		delete(cc.results, key)
+		return nil, false
+	}
+	return r.value, true
+}
+
+func (p *ClientPool) storeResult(name, key string, opts clientOptions, value any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clusterClients(name, opts).results[key] = cachedResult{value: value, expires: time.Now().Add(p.StatusTTL)}
+}
+
+// invalidate discards the cached results of the cluster identified by name.
+func (p *ClientPool) invalidate(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cc, ok := p.clusters[name]; ok {
+		clear(cc.results)
+	}
+}
+
+// withStatusCache returns the result of call, an operation on eps, from the
+// cache of the pool when it was made less than StatusTTL ago. Failed calls
+// aren't cached.
+func withStatusCache[T any](c *ClusterClient, op string, eps []string, call func() (T, error)) (T, error) {
+	if c.pool.StatusTTL <= 0 {
+		return call()
+	}
+	key := op + "/" + endpointsKey(eps)
+	if v, ok := c.pool.loadResult(c.name, key); ok {
+		return v.(T), nil
+	}
+	v, err := call()
+	if err != nil {
+		return v, err
+	}
+	c.pool.storeResult(c.name, key, c.opts, v)
+	return v, nil
+}
+
+func endpointsKey(eps []string) string {
+	sorted := slices.Clone(eps)
+	slices.Sort(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// sameTLSConfig reports whether a and b hold the same TLS material.
+func sameTLSConfig(a, b *tls.Config) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a == b {
+		return true
+	}
+	if a.ServerName != b.ServerName || a.InsecureSkipVerify != b.InsecureSkipVerify || !a.RootCAs.Equal(b.RootCAs) {
+		return false
+	}
+	return slices.EqualFunc(a.Certificates, b.Certificates, func(x, y tls.Certificate) bool {
+		return slices.EqualFunc(x.Certificate, y.Certificate, bytes.Equal)
+	})
+}
+
+// sameCredentials reports whether a and b are the same credentials.
+func sameCredentials(a, b *Credentials) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// ClusterClient operates an etcd cluster through the connections of a
+// ClientPool.
+type ClusterClient struct {
+	pool *ClientPool
+	name string
+	opts clientOptions
+}
+
+func (c *ClusterClient) dial(eps []string) (*clientv3.Client, func(), error) {
+	cli, err := c.pool.client(c.name, eps, c.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cli, func() {}, nil
+}
+
+// MemberList returns the members of the cluster, possibly cached for the
+// StatusTTL of the pool. The response must not be modified.
+func (c *ClusterClient) MemberList(eps []string) (*clientv3.MemberListResponse, error) {
+	return withStatusCache(c, "members", eps, func() (*clientv3.MemberListResponse, error) {
+		return memberList(c.dial, eps)
+	})
+}
+
+// ClusterHealth returns the health of eps, possibly cached for the StatusTTL
+// of the pool. The result must not be modified.
+func (c *ClusterClient) ClusterHealth(eps []string) ([]EpHealth, error) {
+	return withStatusCache(c, "health", eps, func() ([]EpHealth, error) {
+		return clusterHealth(c.dial, eps)
+	})
+}
+
+// AlarmList returns the alarms raised by the members of the cluster,
+// possibly cached for the StatusTTL of the pool. The result must not be
+// modified.
+func (c *ClusterClient) AlarmList(eps []string) ([]*etcdserverpb.AlarmMember, error) {
+	return withStatusCache(c, "alarms", eps, func() ([]*etcdserverpb.AlarmMember, error) {
+		return alarmList(c.dial, eps)
+	})
+}
+
+func (c *ClusterClient) AddMember(eps []string, peerURLs []string, learner bool) (*clientv3.MemberAddResponse, error) {
+	defer c.pool.invalidate(c.name)
+	return addMember(c.dial, eps, peerURLs, learner)
+}
+
+func (c *ClusterClient) PromoteLearner(eps []string, learnerId uint64) error {
+	defer c.pool.invalidate(c.name)
+	return promoteLearner(c.dial, eps, learnerId)
+}
+
+func (c *ClusterClient) RemoveMember(eps []string, memberID uint64) error {
+	defer c.pool.invalidate(c.name)
+	return removeMember(c.dial, eps, memberID)
+}
+
+// Defragment defragments the member serving ep. It discards the cached
+// results of the cluster, as the size of the database of the member changes.
+func (c *ClusterClient) Defragment(ep string) error {
+	defer c.pool.invalidate(c.name)
+	return defragment(c.dial, ep)
+}
+
+// MoveLeader transfers the leadership of the cluster, from the leader serving
+// ep, to the member transfereeID. It discards the cached results of the
+// cluster, as its leader changes.
+func (c *ClusterClient) MoveLeader(ep string, transfereeID uint64) error {
+	defer c.pool.invalidate(c.name)
+	return moveLeader(c.dial, ep, transfereeID)
+}
+
+// CompactToLatest compacts the keyspace of the cluster to its current
+// revision, and returns the revision.
+func (c *ClusterClient) CompactToLatest(eps []string) (int64, error) {
+	defer c.pool.invalidate(c.name)
+	return compactToLatest(c.dial, eps)
+}
+
+// AlarmDisarm disarms alarm. It discards the cached results of the cluster,
+// as the health of the members changes.
+func (c *ClusterClient) AlarmDisarm(eps []string, alarm *etcdserverpb.AlarmMember) error {
+	defer c.pool.invalidate(c.name)
+	return alarmDisarm(c.dial, eps, alarm)
+}
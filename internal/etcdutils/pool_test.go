@@ -0,0 +1,217 @@
+package etcdutils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientPool(t *testing.T) {
+	e := setupEtcdServer(t)
+	defer e.Close()
+
+	pool := NewClientPool()
+	defer pool.CloseAll()
+	eps := []string{"http://localhost:2379"}
+
+	t.Run("ReusesClients", func(t *testing.T) {
+		first, err := pool.client("default/test", eps, clientOptions{})
+		assert.NoError(t, err)
+		second, err := pool.client("default/test", eps, clientOptions{})
+		assert.NoError(t, err)
+		assert.Same(t, first, second)
+
+		other, err := pool.client("default/other", eps, clientOptions{})
+		assert.NoError(t, err)
+		assert.NotSame(t, first, other)
+	})
+
+	t.Run("ClusterClientOperations", func(t *testing.T) {
+		c := pool.Cluster("default/test", nil, nil)
+		resp, err := c.MemberList(eps)
+		assert.NoError(t, err)
+		assert.Len(t, resp.Members, 1)
+
+		health, err := c.ClusterHealth(eps)
+		assert.NoError(t, err)
+		assert.True(t, health[0].Health)
+	})
+
+	t.Run("WarmsClients", func(t *testing.T) {
+		assert.NoError(t, pool.Warm("default/warm", eps, nil, nil))
+		assert.Len(t, pool.clusters["default/warm"].clients, 1)
+
+		warm, err := pool.client("default/warm", eps, clientOptions{})
+		assert.NoError(t, err)
+		assert.NoError(t, pool.Warm("default/warm", eps, nil, nil))
+		again, err := pool.client("default/warm", eps, clientOptions{})
+		assert.NoError(t, err)
+		assert.Same(t, warm, again)
+	})
+
+	t.Run("EvictsIdleAndFailedClients", func(t *testing.T) {
+		pool := NewClientPool()
+		pool.IdleTimeout = time.Minute
+		defer pool.CloseAll()
+
+		_, err := pool.client("default/idle", eps, clientOptions{})
+		assert.NoError(t, err)
+		assert.Zero(t, pool.evict(time.Now()))
+		assert.Equal(t, 1, pool.evict(time.Now().Add(2*time.Minute)))
+		assert.NotContains(t, pool.clusters, "default/idle")
+
+		c, err := pool.client("default/failed", eps, clientOptions{})
+		assert.NoError(t, err)
+		_ = c.Close()
+		assert.Equal(t, 1, pool.Evict())
+		assert.NotContains(t, pool.clusters, "default/failed")
+	})
+
+	t.Run("ClosesClients", func(t *testing.T) {
+		first, err := pool.client("default/test", eps, clientOptions{})
+		assert.NoError(t, err)
+
+		pool.Close("default/test")
+		assert.NotContains(t, pool.clusters, "default/test")
+
+		second, err := pool.client("default/test", eps, clientOptions{})
+		assert.NoError(t, err)
+		assert.NotSame(t, first, second)
+	})
+
+	t.Run("RecreatesClientsOnTLSChange", func(t *testing.T) {
+		first, err := pool.client("default/test", eps, clientOptions{})
+		assert.NoError(t, err)
+
+		second, err := pool.client("default/test", eps, clientOptions{tlsConfig: &tls.Config{ServerName: "test"}})
+		assert.NoError(t, err)
+		assert.NotSame(t, first, second)
+		assert.Len(t, pool.clusters["default/test"].clients, 1)
+	})
+
+	t.Run("RecreatesClientsOnCredentialsChange", func(t *testing.T) {
+		first, err := pool.client("default/creds", eps, clientOptions{})
+		assert.NoError(t, err)
+
+		creds := clientOptions{creds: &Credentials{Username: "root", Password: "secret"}}
+		second, err := pool.client("default/creds", eps, creds)
+		assert.NoError(t, err)
+		assert.NotSame(t, first, second)
+		// Equal credentials keep the client.
+		creds = clientOptions{creds: &Credentials{Username: "root", Password: "secret"}}
+		third, err := pool.client("default/creds", eps, creds)
+		assert.NoError(t, err)
+		assert.Same(t, second, third)
+	})
+}
+
+func TestClientPoolCheck(t *testing.T) {
+	pool := NewClientPool()
+	assert.NoError(t, pool.Check(nil))
+
+	pool.mu.Lock()
+	assert.Error(t, pool.Check(nil))
+	pool.mu.Unlock()
+	assert.NoError(t, pool.Check(nil))
+}
+
+func TestEndpointsKey(t *testing.T) {
+	assert.Equal(t, endpointsKey([]string{"http://b:2379", "http://a:2379"}), endpointsKey([]string{"http://a:2379", "http://b:2379"}))
+	assert.NotEqual(t, endpointsKey([]string{"http://a:2379"}), endpointsKey([]string{"http://a:2379", "http://b:2379"}))
+}
+
+func TestSameTLSConfig(t *testing.T) {
+	cert := tls.Certificate{Certificate: [][]byte{[]byte("cert")}}
+	otherCert := tls.Certificate{Certificate: [][]byte{[]byte("other")}}
+	pool := x509.NewCertPool()
+
+	tests := []struct {
+		name     string
+		a, b     *tls.Config
+		expected bool
+	}{
+		{name: "both nil", expected: true},
+		{name: "one nil", a: &tls.Config{}, expected: false},
+		{
+			name:     "same material",
+			a:        &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool},
+			b:        &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool},
+			expected: true,
+		},
+		{
+			name:     "different certificates",
+			a:        &tls.Config{Certificates: []tls.Certificate{cert}},
+			b:        &tls.Config{Certificates: []tls.Certificate{otherCert}},
+			expected: false,
+		},
+		{
+			name:     "different root CAs",
+			a:        &tls.Config{RootCAs: pool},
+			b:        &tls.Config{},
+			expected: false,
+		},
+		{
+			name:     "different server names",
+			a:        &tls.Config{ServerName: "a"},
+			b:        &tls.Config{ServerName: "b"},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sameTLSConfig(tt.a, tt.b))
+		})
+	}
+}
+
+func TestWithStatusCache(t *testing.T) {
+	pool := NewClientPool()
+	pool.StatusTTL = time.Hour
+	c := pool.Cluster("default/test", nil, nil)
+	eps := []string{"http://a:2379", "http://b:2379"}
+
+	calls := 0
+	call := func() (int, error) {
+		calls++
+		return calls, nil
+	}
+
+	v, err := withStatusCache(c, "test", eps, call)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	// The endpoints are the same in a different order.
+	v, _ = withStatusCache(c, "test", []string{"http://b:2379", "http://a:2379"}, call)
+	assert.Equal(t, 1, v)
+
+	// Other operations and endpoints are cached separately.
+	v, _ = withStatusCache(c, "other", eps, call)
+	assert.Equal(t, 2, v)
+	v, _ = withStatusCache(c, "test", eps[:1], call)
+	assert.Equal(t, 3, v)
+
+	pool.invalidate("default/test")
+	v, _ = withStatusCache(c, "test", eps, call)
+	assert.Equal(t, 4, v)
+
+	// Failed calls aren't cached.
+	_, err = withStatusCache(c, "failing", eps, func() (int, error) { return 0, errors.New("failed") })
+	assert.Error(t, err)
+	v, _ = withStatusCache(c, "failing", eps, call)
+	assert.Equal(t, 5, v)
+
+	pool.StatusTTL = time.Millisecond
+	_, _ = withStatusCache(c, "expiring", eps, call)
+	time.Sleep(2 * time.Millisecond)
+	v, _ = withStatusCache(c, "expiring", eps, call)
+	assert.Equal(t, 7, v)
+
+	pool.StatusTTL = 0
+	_, _ = withStatusCache(c, "uncached", eps, call)
+	v, _ = withStatusCache(c, "uncached", eps, call)
+	assert.Equal(t, 9, v)
+}
@@ -0,0 +1,35 @@
+package etcdutils
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// CheckUpgradePath returns why the members of a cluster can't be moved from
+// the etcd version from to the version to, or an empty string if they can.
+// etcd only supports upgrades to the next minor version, and a cluster can't
+// be moved back to the previous minor version by replacing its members:
+// https://etcd.io/docs/latest/upgrades/. Patch releases can be changed
+// freely. An error is returned when a version can't be parsed.
+func CheckUpgradePath(from, to string) (string, error) {
+	fromVersion, err := version.ParseGeneric(from)
+	if err != nil {
+		return "", fmt.Errorf("invalid etcd version %q: %w", from, err)
+	}
+	toVersion, err := version.ParseGeneric(to)
+	if err != nil {
+		return "", fmt.Errorf("invalid etcd version %q: %w", to, err)
+	}
+
+	switch {
+	case toVersion.Major() != fromVersion.Major():
+		return fmt.Sprintf("upgrades across major versions, from %s to %s, aren't supported", from, to), nil
+	case toVersion.Minor() < fromVersion.Minor():
+		return fmt.Sprintf("downgrades from %s to %s aren't supported", from, to), nil
+	case toVersion.Minor() > fromVersion.Minor()+1:
+		return fmt.Sprintf("upgrades from %s to %s skip a minor version; upgrade to v%d.%d first",
+			from, to, fromVersion.Major(), fromVersion.Minor()+1), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,49 @@
+package etcdutils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckUpgradePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		expected string
+	}{
+		{name: "patch upgrade", from: "v3.5.17", to: "v3.5.21"},
+		{name: "patch downgrade", from: "v3.5.21", to: "v3.5.17"},
+		{name: "minor upgrade", from: "v3.5.21", to: "v3.6.0"},
+		{name: "without prefix", from: "3.5.21", to: "v3.6"},
+		{
+			name:     "skipped minor",
+			from:     "v3.4.35",
+			to:       "v3.6.0",
+			expected: "upgrades from v3.4.35 to v3.6.0 skip a minor version; upgrade to v3.5 first",
+		},
+		{
+			name:     "minor downgrade",
+			from:     "v3.6.0",
+			to:       "v3.5.21",
+			expected: "downgrades from v3.6.0 to v3.5.21 aren't supported",
+		},
+		{
+			name:     "major upgrade",
+			from:     "v3.6.0",
+			to:       "v4.0.0",
+			expected: "upgrades across major versions, from v3.6.0 to v4.0.0, aren't supported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem, err := CheckUpgradePath(tt.from, tt.to)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, problem)
+		})
+	}
+
+	_, err := CheckUpgradePath("latest", "v3.6.0")
+	assert.ErrorContains(t, err, `invalid etcd version "latest"`)
+}
@@ -0,0 +1,65 @@
+// Package features defines the feature gates of the operator, which turn its
+// experimental subsystems on and off.
+package features
+
+import (
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/component-base/featuregate"
+)
+
+const (
+	// ContinuousBackup enables the EtcdBackupSchedules, which take the
+	// EtcdBackups of the EtcdClusters on a schedule.
+	ContinuousBackup featuregate.Feature = "ContinuousBackup"
+
+	// StretchClusters enables the EtcdClusters spanning several Kubernetes
+	// clusters, whose members run in a remote one.
+	StretchClusters featuregate.Feature = "StretchClusters"
+
+	// AutoRecovery enables the recovery of the EtcdClusters which lost their
+	// quorum, and the replacement of their failed members.
+	AutoRecovery featuregate.Feature = "AutoRecovery"
+
+	// ExternalEtcdClusters enables the ExternalEtcdClusters, which look after
+	// the etcd clusters the operator doesn't run.
+	ExternalEtcdClusters featuregate.Feature = "ExternalEtcdClusters"
+
+	// EtcdBackups enables the EtcdBackups, which upload snapshots of the
+	// EtcdClusters to S3, and the EtcdRestores, which create EtcdClusters from
+	// snapshots.
+	EtcdBackups featuregate.Feature = "EtcdBackups"
+
+	// EtcdAuth enables the EtcdUsers and the EtcdRoles, which manage the
+	// users and the roles of the authentication of the EtcdClusters.
+	EtcdAuth featuregate.Feature = "EtcdAuth"
+
+	// EtcdMirrors enables the EtcdMirrors, which replicate the keys of the
+	// EtcdClusters to other etcd clusters.
+	EtcdMirrors featuregate.Feature = "EtcdMirrors"
+)
+
+var defaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	ContinuousBackup:     {Default: false, PreRelease: featuregate.Alpha},
+	StretchClusters:      {Default: false, PreRelease: featuregate.Alpha},
+	AutoRecovery:         {Default: false, PreRelease: featuregate.Alpha},
+	ExternalEtcdClusters: {Default: false, PreRelease: featuregate.Alpha},
+	EtcdBackups:          {Default: false, PreRelease: featuregate.Alpha},
+	EtcdAuth:             {Default: false, PreRelease: featuregate.Alpha},
+	EtcdMirrors:          {Default: false, PreRelease: featuregate.Alpha},
+}
+
+// DefaultMutableFeatureGate is the feature gate of the operator, set by the
+// --feature-gates flag.
+var DefaultMutableFeatureGate featuregate.MutableFeatureGate = featuregate.NewFeatureGate()
+
+// DefaultFeatureGate is the read-only view of DefaultMutableFeatureGate.
+var DefaultFeatureGate featuregate.FeatureGate = DefaultMutableFeatureGate
+
+func init() {
+	utilruntime.Must(DefaultMutableFeatureGate.Add(defaultFeatureGates))
+}
+
+// Enabled reports whether the feature is enabled.
+func Enabled(f featuregate.Feature) bool {
+	return DefaultFeatureGate.Enabled(f)
+}
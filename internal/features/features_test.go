@@ -0,0 +1,27 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/component-base/featuregate"
+)
+
+func TestDefaultFeatureGates(t *testing.T) {
+	for f, spec := range defaultFeatureGates {
+		assert.False(t, spec.Default, "%s must be disabled by default", f)
+		assert.False(t, Enabled(f))
+	}
+}
+
+func TestFeatureGateSet(t *testing.T) {
+	gate := featuregate.NewFeatureGate()
+	assert.NoError(t, gate.Add(defaultFeatureGates))
+
+	assert.NoError(t, gate.Set("ContinuousBackup=true,AutoRecovery=false"))
+	assert.True(t, gate.Enabled(ContinuousBackup))
+	assert.False(t, gate.Enabled(AutoRecovery))
+	assert.False(t, gate.Enabled(StretchClusters))
+
+	assert.Error(t, gate.Set("Unknown=true"))
+}
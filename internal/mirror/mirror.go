@@ -0,0 +1,243 @@
+// Package mirror replicates the keys of an etcd cluster to another one, like
+// `etcdctl make-mirror`: it copies the keys once, then applies the changes
+// watched on the source to the destination, one source revision per
+// transaction. The EtcdMirrors run it in the operator to keep warm standby
+// clusters.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/mirror"
+)
+
+const (
+	// retryInterval is how long a failed mirror waits before starting over.
+	retryInterval = 5 * time.Second
+
+	// progressInterval is how often the source is asked for the progress of
+	// the watch, so that the mirrored revision keeps up with the changes of
+	// the keys which aren't mirrored.
+	progressInterval = 10 * time.Second
+)
+
+// Options configures a Mirror.
+type Options struct {
+	// Source is the client of the cluster the keys are read from.
+	Source *clientv3.Client
+	// Destination is the client of the cluster the keys are written to.
+	Destination *clientv3.Client
+	// Prefix restricts the mirrored keys to the ones starting with it. All
+	// the keys are mirrored when empty.
+	Prefix string
+	// DestPrefix replaces Prefix in the keys written to the destination.
+	// The keys are written as is when empty.
+	DestPrefix string
+	// Revision is the source revision already mirrored, to resume from. The
+	// keys are copied first when 0, or when the source compacted it.
+	Revision int64
+	// Logger logs the errors of the mirror.
+	Logger logr.Logger
+}
+
+// Status is the progress of a Mirror.
+type Status struct {
+	// Revision is the source revision mirrored so far, 0 until the keys are
+	// copied.
+	Revision int64
+	// LastSyncTime is when the destination last caught up with Revision.
+	LastSyncTime time.Time
+	// Err is the error the mirror is recovering from, nil while it runs.
+	Err error
+}
+
+// Mirror replicates the keys of a cluster to another one until stopped.
+type Mirror struct {
+	opts   Options
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Start starts mirroring the keys of opts.Source to opts.Destination. The
+// mirror starts over after the errors, from the last revision it mirrored,
+// until it is stopped.
+func Start(opts Options) *Mirror {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Mirror{opts: opts, cancel: cancel, done: make(chan struct{}), status: Status{Revision: opts.Revision}}
+	go m.run(ctx)
+	return m
+}
+
+// Stop stops the mirror, and waits for it to return. It doesn't close the
+// clients.
+func (m *Mirror) Stop() {
+	m.cancel()
+	<-m.done
+}
+
+// Status returns the progress of the mirror.
+func (m *Mirror) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// SourceRevision returns the current revision of the source.
+func (m *Mirror) SourceRevision(ctx context.Context) (int64, error) {
+	key := m.opts.Prefix
+	if key == "" {
+		key = "\x00"
+	}
+	resp, err := m.opts.Source.Get(ctx, key, clientv3.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Header.Revision, nil
+}
+
+func (m *Mirror) run(ctx context.Context) {
+	defer close(m.done)
+	for {
+		err := m.sync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		m.opts.Logger.Error(err, "Mirroring failed, starting over", "retryInterval", retryInterval)
+		m.mu.Lock()
+		m.status.Err = err
+		// The keys are copied again when the source forgot the changes
+		// since the revision mirrored.
+		if errors.Is(err, rpctypes.ErrCompacted) {
+			m.status.Revision = 0
+		}
+		m.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// sync copies the keys unless a revision was mirrored already, then applies
+// the changes of the source until ctx is done or an error occurs. The
+// progress notifications of the watch advance the mirrored revision while
+// none of the mirrored keys change.
+func (m *Mirror) sync(ctx context.Context) error {
+	rev := m.Status().Revision
+	if rev == 0 {
+		var err error
+		if rev, err = m.copyKeys(ctx, mirror.NewSyncer(m.opts.Source, m.opts.Prefix, 0)); err != nil {
+			return err
+		}
+		m.synced(rev)
+	}
+
+	wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	wch := m.opts.Source.Watch(wctx, m.opts.Prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+	go func() {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-wctx.Done():
+				return
+			case <-ticker.C:
+				_ = m.opts.Source.RequestProgress(wctx)
+			}
+		}
+	}()
+	for wresp := range wch {
+		if err := wresp.Err(); err != nil {
+			return err
+		}
+		if err := m.apply(ctx, wresp.Events); err != nil {
+			return err
+		}
+		m.synced(wresp.Header.Revision)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.New("the watch of the source was closed")
+}
+
+// copyKeys writes the keys of the source to the destination, as of a single
+// revision, which it returns.
+func (m *Mirror) copyKeys(ctx context.Context, syncer mirror.Syncer) (int64, error) {
+	var rev int64
+	rch, errch := syncer.SyncBase(ctx)
+	for resp := range rch {
+		rev = resp.Header.Revision
+		for _, kv := range resp.Kvs {
+			if _, err := m.opts.Destination.Put(ctx, m.destKey(kv.Key), string(kv.Value)); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := <-errch; err != nil {
+		return 0, err
+	}
+	if rev == 0 {
+		// The source has no keys under the prefix.
+		return m.SourceRevision(ctx)
+	}
+	return rev, nil
+}
+
+// apply writes events to the destination, in one transaction per source
+// revision, so that the destination only goes through the states of the
+// source.
+func (m *Mirror) apply(ctx context.Context, events []*clientv3.Event) error {
+	var ops []clientv3.Op
+	var rev int64
+	for _, ev := range events {
+		if ev.Kv.ModRevision != rev && len(ops) > 0 {
+			if _, err := m.opts.Destination.Txn(ctx).Then(ops...).Commit(); err != nil {
+				return err
+			}
+			ops = ops[:0]
+		}
+		rev = ev.Kv.ModRevision
+		key := m.destKey(ev.Kv.Key)
+		switch ev.Type {
+		case mvccpb.PUT:
+			ops = append(ops, clientv3.OpPut(key, string(ev.Kv.Value)))
+		case mvccpb.DELETE:
+			ops = append(ops, clientv3.OpDelete(key))
+		}
+	}
+	if len(ops) > 0 {
+		_, err := m.opts.Destination.Txn(ctx).Then(ops...).Commit()
+		return err
+	}
+	return nil
+}
+
+// synced records that the destination caught up with the source revision
+// rev.
+func (m *Mirror) synced(rev int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = Status{Revision: rev, LastSyncTime: time.Now()}
+}
+
+// destKey returns the destination key of the source key.
+func (m *Mirror) destKey(key []byte) string {
+	if m.opts.DestPrefix == "" {
+		return string(key)
+	}
+	return m.opts.DestPrefix + strings.TrimPrefix(string(key), m.opts.Prefix)
+}
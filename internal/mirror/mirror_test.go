@@ -0,0 +1,113 @@
+package mirror
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/v3client"
+)
+
+func startEtcd(t *testing.T) *clientv3.Client {
+	local, _ := url.Parse("http://127.0.0.1:0")
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	cfg.ListenPeerUrls = []url.URL{*local}
+	cfg.ListenClientUrls = []url.URL{*local}
+	cfg.AdvertiseClientUrls = []url.URL{*local}
+	cfg.AdvertisePeerUrls = []url.URL{*local}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("Failed to start etcd server: %v", err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(60 * time.Second):
+		t.Fatalf("Server took too long to start")
+	}
+	c := v3client.New(e.Server)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func get(t *testing.T, c *clientv3.Client, prefix string) map[string]string {
+	resp, err := c.Get(context.Background(), prefix, clientv3.WithPrefix())
+	assert.NoError(t, err)
+	kvs := map[string]string{}
+	for _, kv := range resp.Kvs {
+		kvs[string(kv.Key)] = string(kv.Value)
+	}
+	return kvs
+}
+
+func TestMirror(t *testing.T) {
+	ctx := context.Background()
+	source := startEtcd(t)
+	dest := startEtcd(t)
+
+	_, err := source.Put(ctx, "/app/a", "1")
+	assert.NoError(t, err)
+	_, err = source.Put(ctx, "/app/b", "2")
+	assert.NoError(t, err)
+	_, err = source.Put(ctx, "/other", "3")
+	assert.NoError(t, err)
+
+	m := Start(Options{Source: source, Destination: dest, Prefix: "/app/", DestPrefix: "/standby/", Logger: logr.Discard()})
+	defer m.Stop()
+
+	// The existing keys are copied, under the destination prefix.
+	assert.Eventually(t, func() bool { return m.Status().Revision > 0 }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, map[string]string{"/standby/a": "1", "/standby/b": "2"}, get(t, dest, "/"))
+
+	// Then the changes are applied as they happen.
+	_, err = source.Put(ctx, "/app/c", "4")
+	assert.NoError(t, err)
+	_, err = source.Delete(ctx, "/app/a")
+	assert.NoError(t, err)
+	put, err := source.Txn(ctx).Then(clientv3.OpPut("/app/b", "5"), clientv3.OpPut("/app/d", "6")).Commit()
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return m.Status().Revision == put.Header.Revision }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, map[string]string{"/standby/b": "5", "/standby/c": "4", "/standby/d": "6"}, get(t, dest, "/"))
+	assert.NoError(t, m.Status().Err)
+	assert.False(t, m.Status().LastSyncTime.IsZero())
+
+	rev, err := m.SourceRevision(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, put.Header.Revision, rev)
+}
+
+func TestMirrorResume(t *testing.T) {
+	ctx := context.Background()
+	source := startEtcd(t)
+	dest := startEtcd(t)
+
+	first, err := source.Put(ctx, "a", "1")
+	assert.NoError(t, err)
+	_, err = source.Put(ctx, "b", "2")
+	assert.NoError(t, err)
+
+	// Only the changes past the mirrored revision are applied.
+	m := Start(Options{Source: source, Destination: dest, Revision: first.Header.Revision, Logger: logr.Discard()})
+	assert.Eventually(t, func() bool { return len(get(t, dest, "")) == 1 }, 10*time.Second, 10*time.Millisecond)
+	m.Stop()
+	assert.Equal(t, map[string]string{"b": "2"}, get(t, dest, ""))
+
+	// The keys are copied again once the source compacted the revision.
+	_, err = source.Put(ctx, "c", "3")
+	assert.NoError(t, err)
+	_, err = source.Compact(ctx, first.Header.Revision+2)
+	assert.NoError(t, err)
+	m = Start(Options{Source: source, Destination: dest, Revision: first.Header.Revision, Logger: logr.Discard()})
+	defer m.Stop()
+	assert.Eventually(t, func() bool { return len(get(t, dest, "")) == 3 }, 20*time.Second, 10*time.Millisecond)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2", "c": "3"}, get(t, dest, ""))
+}
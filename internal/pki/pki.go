@@ -0,0 +1,169 @@
+// Package pki generates the certificate authorities of the EtcdClusters using
+// the auto TLS provider, and issues their certificates.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// backdate is how long before their issuance the certificates are valid, so
+// they are accepted despite some clock skew.
+const backdate = 5 * time.Minute
+
+// KeyPair is a certificate and its private key.
+type KeyPair struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+
+	// CertPEM and KeyPEM are the PEM encoding of Cert and Key.
+	CertPEM, KeyPEM []byte
+}
+
+// Request describes the certificate to issue.
+type Request struct {
+	CommonName  string
+	DNSNames    []string
+	IPAddresses []net.IP
+	Usages      []x509.ExtKeyUsage
+	// Validity is the lifetime of the certificate.
+	Validity time.Duration
+}
+
+// NewCA generates a self-signed certificate authority valid from now for the
+// given duration.
+func NewCA(commonName string, validity time.Duration, now time.Time) (*KeyPair, error) {
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	return create(template, validity, now, nil, nil)
+}
+
+// Renew returns a new certificate of the CA, valid from now for the given
+// duration, with the same subject and key. The certificates issued by the
+// CA before, and the members trusting its previous certificate, keep
+// working.
+func (ca *KeyPair) Renew(validity time.Duration, now time.Time) (*KeyPair, error) {
+	if !ca.Cert.IsCA {
+		return nil, fmt.Errorf("%s isn't a certificate authority", ca.Cert.Subject.CommonName)
+	}
+	template := &x509.Certificate{
+		Subject:               ca.Cert.Subject,
+		KeyUsage:              ca.Cert.KeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	return create(template, validity, now, ca.Key, nil)
+}
+
+// Issue issues the certificate described by req, signed by the CA, valid
+// from now.
+func (ca *KeyPair) Issue(req Request, now time.Time) (*KeyPair, error) {
+	if !ca.Cert.IsCA {
+		return nil, fmt.Errorf("%s isn't a certificate authority", ca.Cert.Subject.CommonName)
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: req.CommonName},
+		DNSNames:    req.DNSNames,
+		IPAddresses: req.IPAddresses,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: req.Usages,
+	}
+	return create(template, req.Validity, now, nil, ca)
+}
+
+// create returns the certificate of key from template, signed by ca, or
+// self-signed when ca is nil. A key is generated when key is nil.
+func create(template *x509.Certificate, validity time.Duration, now time.Time, key crypto.Signer, ca *KeyPair) (*KeyPair, error) {
+	if key == nil {
+		var err error
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return nil, fmt.Errorf("failed to generate the key: %w", err)
+		}
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the serial number: %w", err)
+	}
+	template.SerialNumber = serial
+	template.NotBefore = now.Add(-backdate)
+	template.NotAfter = now.Add(validity)
+
+	parent, signer := template, key
+	if ca != nil {
+		parent, signer = ca.Cert, ca.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the key: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{
+		Cert:    cert,
+		Key:     key,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// ParseKeyPair parses a PEM encoded certificate and its PKCS #8 private key.
+func ParseKeyPair(certPEM, keyPEM []byte) (*KeyPair, error) {
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return &KeyPair{Cert: cert, Key: signer, CertPEM: certPEM, KeyPEM: keyPEM}, nil
+}
+
+// ParseCertificate parses the first PEM encoded certificate of data.
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// NeedsRenewal returns whether less than a third of the lifetime of cert is
+// left at now.
+func NeedsRenewal(cert *x509.Certificate, now time.Time) bool {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return now.After(cert.NotAfter.Add(-lifetime / 3))
+}
+
+// SignedBy returns whether cert was issued by ca.
+func SignedBy(cert *x509.Certificate, ca *x509.Certificate) bool {
+	return cert.CheckSignatureFrom(ca) == nil
+}
@@ -0,0 +1,86 @@
+package pki
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssue(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ca, err := NewCA("etcd-ca", 365*24*time.Hour, now)
+	assert.NoError(t, err)
+	assert.True(t, ca.Cert.IsCA)
+	assert.True(t, SignedBy(ca.Cert, ca.Cert))
+
+	cert, err := ca.Issue(Request{
+		CommonName:  "etcd-0",
+		DNSNames:    []string{"etcd-0.etcd.default.svc"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		Usages:      []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		Validity:    24 * time.Hour,
+	}, now)
+	assert.NoError(t, err)
+	assert.False(t, cert.Cert.IsCA)
+	assert.True(t, SignedBy(cert.Cert, ca.Cert))
+	assert.Equal(t, now.Add(24*time.Hour), cert.Cert.NotAfter)
+	assert.NoError(t, cert.Cert.VerifyHostname("etcd-0.etcd.default.svc"))
+	assert.NoError(t, cert.Cert.VerifyHostname("127.0.0.1"))
+
+	_, err = cert.Issue(Request{CommonName: "etcd-1", Validity: time.Hour}, now)
+	assert.EqualError(t, err, "etcd-0 isn't a certificate authority")
+
+	other, err := NewCA("other-ca", time.Hour, now)
+	assert.NoError(t, err)
+	assert.False(t, SignedBy(cert.Cert, other.Cert))
+}
+
+func TestRenew(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ca, err := NewCA("etcd-ca", time.Hour, now)
+	assert.NoError(t, err)
+	cert, err := ca.Issue(Request{CommonName: "etcd-0", Validity: time.Hour}, now)
+	assert.NoError(t, err)
+
+	renewed, err := ca.Renew(24*time.Hour, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(25*time.Hour), renewed.Cert.NotAfter)
+	assert.Equal(t, ca.KeyPEM, renewed.KeyPEM)
+	assert.True(t, SignedBy(cert.Cert, renewed.Cert))
+	renewedCert, err := renewed.Issue(Request{CommonName: "etcd-1", Validity: time.Hour}, now)
+	assert.NoError(t, err)
+	assert.True(t, SignedBy(renewedCert.Cert, ca.Cert))
+
+	_, err = cert.Renew(time.Hour, now)
+	assert.EqualError(t, err, "etcd-0 isn't a certificate authority")
+}
+
+func TestParseKeyPair(t *testing.T) {
+	ca, err := NewCA("etcd-ca", time.Hour, time.Now())
+	assert.NoError(t, err)
+
+	parsed, err := ParseKeyPair(ca.CertPEM, ca.KeyPEM)
+	assert.NoError(t, err)
+	assert.Equal(t, ca.Cert.Raw, parsed.Cert.Raw)
+	cert, err := parsed.Issue(Request{CommonName: "etcd-0", Validity: time.Hour}, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, SignedBy(cert.Cert, ca.Cert))
+
+	_, err = ParseKeyPair([]byte("not a certificate"), ca.KeyPEM)
+	assert.EqualError(t, err, "no PEM encoded certificate found")
+	_, err = ParseKeyPair(ca.CertPEM, nil)
+	assert.EqualError(t, err, "no PEM encoded key found")
+}
+
+func TestNeedsRenewal(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ca, err := NewCA("etcd-ca", 90*24*time.Hour, now)
+	assert.NoError(t, err)
+
+	assert.False(t, NeedsRenewal(ca.Cert, now))
+	assert.False(t, NeedsRenewal(ca.Cert, now.Add(59*24*time.Hour)))
+	assert.True(t, NeedsRenewal(ca.Cert, now.Add(61*24*time.Hour)))
+}
@@ -0,0 +1,302 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/snapshot"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func newStatusCommand(o *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status CLUSTER",
+		Short: "Show the conditions of an EtcdCluster and the status of its members",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.status(cmd.Context(), args[0])
+		},
+	}
+}
+
+func newMembersCommand(o *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "members CLUSTER",
+		Short: "List the members of an EtcdCluster",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.members(cmd.Context(), args[0])
+		},
+	}
+}
+
+func newDefragCommand(o *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "defrag CLUSTER",
+		Short: "Defragment the members of an EtcdCluster one at a time, the leader last",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.defrag(cmd.Context(), args[0])
+		},
+	}
+}
+
+func newSnapshotCommand(o *Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Manage the snapshots of an EtcdCluster",
+	}
+	var pod string
+	save := &cobra.Command{
+		Use:   "save CLUSTER FILE",
+		Short: "Save a snapshot of an EtcdCluster to a local file",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.snapshotSave(cmd.Context(), args[0], pod, args[1])
+		},
+	}
+	save.Flags().StringVar(&pod, "member", "", "The member Pod to take the snapshot from. Defaults to the first member.")
+	cmd.AddCommand(save)
+	return cmd
+}
+
+func newMoveLeaderCommand(o *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "move-leader CLUSTER MEMBER",
+		Short: "Transfer the leadership of an EtcdCluster to the member Pod MEMBER",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.moveLeader(cmd.Context(), args[0], args[1])
+		},
+	}
+}
+
+func (o *Options) status(ctx context.Context, name string) error {
+	c, err := o.getCluster(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(o.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", c.ec.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", c.ec.Namespace)
+	fmt.Fprintf(w, "Size:\t%d\n", c.ec.Spec.Size)
+	fmt.Fprintf(w, "Version:\t%s\n", c.ec.Spec.Version)
+	if op := c.ec.Status.InProgressOperation; op != nil {
+		fmt.Fprintf(w, "In progress:\t%s of %s since %s\n", op.Type, op.Member, op.StartTime)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "CONDITION\tSTATUS\tREASON\tMESSAGE")
+	for _, cond := range c.ec.Status.Conditions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cond.Type, cond.Status, cond.Reason, cond.Message)
+	}
+	fmt.Fprintln(w)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	cli, members, closeFn, err := o.connect(ctx, c, c.members())
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	statuses := o.statuses(ctx, cli, members)
+
+	w = tabwriter.NewWriter(o.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MEMBER\tID\tVERSION\tDB SIZE\tLEADER\tLEARNER\tRAFT TERM\tRAFT INDEX\tERRORS")
+	for i, m := range members {
+		s := statuses[i]
+		if s.err != nil {
+			fmt.Fprintf(w, "%s\t\t\t\t\t\t\t\t%s\n", m.pod, s.err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%t\t%d\t%d\t%s\n", m.pod, formatMemberID(s.Header.MemberId), s.Version,
+			resource.NewQuantity(s.DbSize, resource.BinarySI), s.Leader == s.Header.MemberId, s.IsLearner,
+			s.RaftTerm, s.RaftIndex, strings.Join(s.Errors, ", "))
+	}
+	return w.Flush()
+}
+
+func (o *Options) members(ctx context.Context, name string) error {
+	c, err := o.getCluster(ctx, name)
+	if err != nil {
+		return err
+	}
+	cli, _, closeFn, err := o.connect(ctx, c, c.members())
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	reqCtx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+	resp, err := cli.MemberList(reqCtx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(o.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPEER URLS\tCLIENT URLS\tLEARNER")
+	for _, m := range resp.Members {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", formatMemberID(m.ID), m.Name, strings.Join(m.PeerURLs, ","), strings.Join(m.ClientURLs, ","), m.IsLearner)
+	}
+	return w.Flush()
+}
+
+func (o *Options) defrag(ctx context.Context, name string) error {
+	c, err := o.getCluster(ctx, name)
+	if err != nil {
+		return err
+	}
+	cli, members, closeFn, err := o.connect(ctx, c, c.members())
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	statuses := o.statuses(ctx, cli, members)
+	for _, i := range defragOrder(statuses) {
+		if statuses[i].err != nil {
+			return fmt.Errorf("member %s is unreachable: %w", members[i].pod, statuses[i].err)
+		}
+	}
+	for _, i := range defragOrder(statuses) {
+		reqCtx, cancel := context.WithTimeout(ctx, o.Timeout)
+		_, err := cli.Defragment(reqCtx, members[i].endpoint)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to defragment member %s: %w", members[i].pod, err)
+		}
+		fmt.Fprintf(o.out, "Defragmented member %s\n", members[i].pod)
+	}
+	return nil
+}
+
+func (o *Options) snapshotSave(ctx context.Context, name, pod, path string) error {
+	c, err := o.getCluster(ctx, name)
+	if err != nil {
+		return err
+	}
+	pods := c.members()
+	if len(pods) == 0 {
+		return fmt.Errorf("EtcdCluster %s has no members", name)
+	}
+	if pod == "" {
+		pod = pods[0]
+	} else if !slices.Contains(pods, pod) {
+		return fmt.Errorf("%s isn't a member of EtcdCluster %s", pod, name)
+	}
+
+	members, stop, err := c.forward([]string{pod})
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	if err := snapshot.Save(ctx, zap.NewNop(), clientv3.Config{Endpoints: []string{members[0].endpoint}, DialTimeout: o.Timeout}, path); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.out, "Saved the snapshot of member %s to %s\n", pod, path)
+	return nil
+}
+
+func (o *Options) moveLeader(ctx context.Context, name, pod string) error {
+	c, err := o.getCluster(ctx, name)
+	if err != nil {
+		return err
+	}
+	cli, members, closeFn, err := o.connect(ctx, c, c.members())
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	statuses := o.statuses(ctx, cli, members)
+	leader := leaderIndex(statuses)
+	if leader < 0 {
+		return fmt.Errorf("EtcdCluster %s has no leader", name)
+	}
+	target := slices.IndexFunc(members, func(m member) bool { return m.pod == pod })
+	if target < 0 {
+		return fmt.Errorf("%s isn't a member of EtcdCluster %s", pod, name)
+	}
+	if statuses[target].err != nil {
+		return fmt.Errorf("member %s is unreachable: %w", pod, statuses[target].err)
+	}
+	if target == leader {
+		fmt.Fprintf(o.out, "Member %s is already the leader\n", pod)
+		return nil
+	}
+
+	// The leadership can only be transferred by the leader.
+	leaderCli, err := clientv3.New(clientv3.Config{Endpoints: []string{members[leader].endpoint}, DialTimeout: o.Timeout, Context: ctx})
+	if err != nil {
+		return err
+	}
+	defer leaderCli.Close()
+	reqCtx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+	if _, err := leaderCli.MoveLeader(reqCtx, statuses[target].Header.MemberId); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.out, "Moved the leadership from member %s to %s\n", members[leader].pod, pod)
+	return nil
+}
+
+// memberStatus is the status of a member, or the error returned when getting
+// it.
+type memberStatus struct {
+	*clientv3.StatusResponse
+	err error
+}
+
+// statuses returns the status of each of the members.
+func (o *Options) statuses(ctx context.Context, cli *clientv3.Client, members []member) []memberStatus {
+	statuses := make([]memberStatus, len(members))
+	for i, m := range members {
+		reqCtx, cancel := context.WithTimeout(ctx, o.Timeout)
+		statuses[i].StatusResponse, statuses[i].err = cli.Status(reqCtx, m.endpoint)
+		cancel()
+		if statuses[i].err == nil && statuses[i].Header == nil {
+			statuses[i].err = errors.New("empty status")
+		}
+	}
+	return statuses
+}
+
+// leaderIndex returns the index of the status of the leader, or -1.
+func leaderIndex(statuses []memberStatus) int {
+	return slices.IndexFunc(statuses, func(s memberStatus) bool {
+		return s.err == nil && s.Leader == s.Header.MemberId
+	})
+}
+
+// defragOrder returns the indexes of the members in the order to defragment
+// them: the followers first, then the leader, so the cluster only changes
+// leader if it has to.
+func defragOrder(statuses []memberStatus) []int {
+	leader := leaderIndex(statuses)
+	order := make([]int, 0, len(statuses))
+	for i := range statuses {
+		if i != leader {
+			order = append(order, i)
+		}
+	}
+	if leader >= 0 {
+		order = append(order, leader)
+	}
+	return order
+}
+
+// formatMemberID formats the ID of a member like etcdctl does.
+func formatMemberID(id uint64) string {
+	return strconv.FormatUint(id, 16)
+}
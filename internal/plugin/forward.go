@@ -0,0 +1,124 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// member is a member Pod of an EtcdCluster reached through a port-forward.
+type member struct {
+	pod string
+	// endpoint is the local address forwarded to the client port of the Pod.
+	endpoint string
+}
+
+// clientPort returns the client port exposed by the etcd container of sts.
+func clientPort(sts *appsv1.StatefulSet) int32 {
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == "client" {
+				return p.ContainerPort
+			}
+		}
+	}
+	return ecv1alpha1.DefaultClientPort
+}
+
+// forward port-forwards a local port to the client port of each of the given
+// member Pods of c, until the returned function is called.
+func (c *cluster) forward(pods []string) ([]member, func(), error) {
+	var stops []chan struct{}
+	stop := func() {
+		for _, ch := range stops {
+			close(ch)
+		}
+	}
+
+	members := make([]member, 0, len(pods))
+	for _, pod := range pods {
+		stopCh := make(chan struct{})
+		stops = append(stops, stopCh)
+		port, err := forwardPod(c.restConfig, c.sts.Namespace, pod, clientPort(c.sts), stopCh)
+		if err != nil {
+			stop()
+			return nil, nil, fmt.Errorf("failed to port-forward to %s: %w", pod, err)
+		}
+		members = append(members, member{pod: pod, endpoint: fmt.Sprintf("http://127.0.0.1:%d", port)})
+	}
+	return members, stop, nil
+}
+
+// forwardPod port-forwards a random local port to port of pod, until stopCh
+// is closed, and returns the local port.
+func forwardPod(restConfig *rest.Config, namespace, pod string, port int32, stopCh chan struct{}) (uint16, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(restConfig)
+	if err != nil {
+		return 0, err
+	}
+	u, err := url.Parse(restConfig.Host)
+	if err != nil {
+		return 0, err
+	}
+	u.Path, err = url.JoinPath(u.Path, "api", "v1", "namespaces", namespace, "pods", pod, "portforward")
+	if err != nil {
+		return 0, err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, u)
+
+	readyCh := make(chan struct{})
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", port)}, stopCh, readyCh, io.Discard, io.Discard)
+	if err != nil {
+		return 0, err
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- fw.ForwardPorts() }()
+
+	select {
+	case <-readyCh:
+	case err := <-errCh:
+		return 0, err
+	}
+	ports, err := fw.GetPorts()
+	if err != nil {
+		return 0, err
+	}
+	if len(ports) == 0 {
+		return 0, errors.New("no port forwarded")
+	}
+	return ports[0].Local, nil
+}
+
+// connect port-forwards to the given member Pods of c, and returns a client
+// of their endpoints. The returned function closes the client and stops the
+// port-forwards.
+func (o *Options) connect(ctx context.Context, c *cluster, pods []string) (*clientv3.Client, []member, func(), error) {
+	members, stop, err := c.forward(pods)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	eps := make([]string, 0, len(members))
+	for _, m := range members {
+		eps = append(eps, m.endpoint)
+	}
+	cli, err := clientv3.New(clientv3.Config{Endpoints: eps, DialTimeout: o.Timeout, Context: ctx})
+	if err != nil {
+		stop()
+		return nil, nil, nil, err
+	}
+	return cli, members, func() {
+		_ = cli.Close()
+		stop()
+	}, nil
+}
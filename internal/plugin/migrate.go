@@ -0,0 +1,297 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// legacyGroupVersion is the API version of the EtcdClusters of the legacy
+// CoreOS etcd-operator. Its types aren't imported, the legacy clusters are
+// read as unstructured objects and converted to the few types below.
+var legacyGroupVersion = schema.GroupVersion{Group: "etcd.database.coreos.com", Version: "v1beta2"}
+
+const (
+	// legacyDefaultRepository and legacyDefaultVersion are the image and
+	// version the legacy operator runs when the spec doesn't set them.
+	legacyDefaultRepository = "quay.io/coreos/etcd"
+	legacyDefaultVersion    = "3.2.13"
+)
+
+// legacyEtcdCluster is an EtcdCluster of the legacy operator.
+type legacyEtcdCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              legacyClusterSpec `json:"spec"`
+}
+
+type legacyClusterSpec struct {
+	Size       int              `json:"size"`
+	Repository string           `json:"repository,omitempty"`
+	Version    string           `json:"version,omitempty"`
+	Paused     bool             `json:"paused,omitempty"`
+	Pod        *legacyPodPolicy `json:"pod,omitempty"`
+	TLS        *legacyTLSPolicy `json:"TLS,omitempty"`
+}
+
+type legacyTLSPolicy struct {
+	Static *legacyStaticTLS `json:"static,omitempty"`
+}
+
+type legacyStaticTLS struct {
+	Member         *legacyMemberSecret `json:"member,omitempty"`
+	OperatorSecret string              `json:"operatorSecret,omitempty"`
+}
+
+type legacyMemberSecret struct {
+	PeerSecret   string `json:"peerSecret,omitempty"`
+	ServerSecret string `json:"serverSecret,omitempty"`
+}
+
+type legacyPodPolicy struct {
+	Labels                    map[string]string                 `json:"labels,omitempty"`
+	NodeSelector              map[string]string                 `json:"nodeSelector,omitempty"`
+	Affinity                  *corev1.Affinity                  `json:"affinity,omitempty"`
+	Resources                 corev1.ResourceRequirements       `json:"resources,omitempty"`
+	Tolerations               []corev1.Toleration               `json:"tolerations,omitempty"`
+	EtcdEnv                   []corev1.EnvVar                   `json:"etcdEnv,omitempty"`
+	PersistentVolumeClaimSpec *corev1.PersistentVolumeClaimSpec `json:"persistentVolumeClaimSpec,omitempty"`
+	Annotations               map[string]string                 `json:"annotations,omitempty"`
+	BusyboxImage              string                            `json:"busyboxImage,omitempty"`
+	SecurityContext           *corev1.PodSecurityContext        `json:"securityContext,omitempty"`
+	DNSTimeoutInSecond        int64                             `json:"DNSTimeoutInSecond,omitempty"`
+	ClusterDomain             string                            `json:"ClusterDomain,omitempty"`
+}
+
+// migrateOptions are the flags of the migrate command.
+type migrateOptions struct {
+	apply      bool
+	nameSuffix string
+}
+
+func newMigrateCommand(o *Options) *cobra.Command {
+	mo := &migrateOptions{}
+	cmd := &cobra.Command{
+		Use:   "migrate [LEGACY-CLUSTER]",
+		Short: "Convert the EtcdClusters of the legacy CoreOS etcd-operator to EtcdClusters of the operator",
+		Long: `Convert the etcd.database.coreos.com/v1beta2 EtcdClusters of the namespace, or
+the one named LEGACY-CLUSTER, to operator.etcd.io EtcdClusters. They are
+printed, or created with --apply. The data isn't migrated.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var name string
+			if len(args) > 0 {
+				name = args[0]
+			}
+			c, _, namespace, err := o.newClient()
+			if err != nil {
+				return err
+			}
+			return o.migrate(cmd.Context(), c, namespace, name, mo)
+		},
+	}
+	cmd.Flags().BoolVar(&mo.apply, "apply", false, "Create the converted EtcdClusters, rather than printing them.")
+	cmd.Flags().StringVar(&mo.nameSuffix, "name-suffix", "", "The suffix appended to the names of the converted EtcdClusters, to run them next to the legacy ones.")
+	return cmd
+}
+
+func (o *Options) migrate(ctx context.Context, c client.Client, namespace, name string, mo *migrateOptions) error {
+	legacy, err := listLegacyClusters(ctx, c, namespace, name)
+	if err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return fmt.Errorf("no legacy EtcdCluster in namespace %s", namespace)
+	}
+
+	for i, l := range legacy {
+		ec, warnings := convertLegacyCluster(l)
+		ec.Name += mo.nameSuffix
+		if mo.apply {
+			for _, w := range warnings {
+				fmt.Fprintf(o.out, "Warning: %s/%s: %s\n", l.Namespace, l.Name, w)
+			}
+			if err := c.Create(ctx, ec); err != nil {
+				return fmt.Errorf("failed to create EtcdCluster %s/%s: %w", ec.Namespace, ec.Name, err)
+			}
+			fmt.Fprintf(o.out, "Created EtcdCluster %s/%s from legacy EtcdCluster %s\n", ec.Namespace, ec.Name, l.Name)
+			continue
+		}
+
+		out, err := marshalEtcdCluster(ec)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Fprintln(o.out, "---")
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(o.out, "# %s\n", w)
+		}
+		if _, err := o.out.Write(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listLegacyClusters returns the legacy EtcdClusters of namespace, or the one
+// named name.
+func listLegacyClusters(ctx context.Context, c client.Client, namespace, name string) ([]*legacyEtcdCluster, error) {
+	var objs []unstructured.Unstructured
+	if name != "" {
+		obj := unstructured.Unstructured{}
+		obj.SetGroupVersionKind(legacyGroupVersion.WithKind("EtcdCluster"))
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &obj); err != nil {
+			return nil, legacyClientError(err)
+		}
+		objs = append(objs, obj)
+	} else {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(legacyGroupVersion.WithKind("EtcdClusterList"))
+		if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			return nil, legacyClientError(err)
+		}
+		objs = list.Items
+	}
+
+	legacy := make([]*legacyEtcdCluster, 0, len(objs))
+	for _, obj := range objs {
+		l := &legacyEtcdCluster{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, l); err != nil {
+			return nil, fmt.Errorf("failed to read legacy EtcdCluster %s: %w", obj.GetName(), err)
+		}
+		legacy = append(legacy, l)
+	}
+	return legacy, nil
+}
+
+func legacyClientError(err error) error {
+	if meta.IsNoMatchError(err) {
+		return fmt.Errorf("the CRDs of the legacy etcd-operator aren't installed: %w", err)
+	}
+	return err
+}
+
+// convertLegacyCluster returns the EtcdCluster equivalent to the legacy
+// cluster l, and the warnings about the settings of l it can't carry over.
+func convertLegacyCluster(l *legacyEtcdCluster) (*ecv1alpha1.EtcdCluster, []string) {
+	var warnings []string
+	ec := &ecv1alpha1.EtcdCluster{
+		TypeMeta: metav1.TypeMeta{APIVersion: ecv1alpha1.GroupVersion.String(), Kind: "EtcdCluster"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      l.Name,
+			Namespace: l.Namespace,
+			Labels:    l.Labels,
+		},
+		Spec: ecv1alpha1.EtcdClusterSpec{Size: l.Spec.Size},
+	}
+
+	version := l.Spec.Version
+	if version == "" {
+		version = legacyDefaultVersion
+	}
+	ec.Spec.Version = "v" + strings.TrimPrefix(version, "v")
+	if repo := l.Spec.Repository; repo != "" && repo != legacyDefaultRepository {
+		warnings = append(warnings, fmt.Sprintf("the members run the etcd images of gcr.io/etcd-development/etcd rather than %s", repo))
+	}
+	if l.Spec.Paused {
+		ec.Annotations = map[string]string{ecv1alpha1.PausedAnnotation: "true"}
+		warnings = append(warnings, fmt.Sprintf("the cluster is paused, remove the %s annotation to create its members", ecv1alpha1.PausedAnnotation))
+	}
+	if tls := l.Spec.TLS; tls != nil && tls.Static != nil {
+		ec.Spec.TLS = &ecv1alpha1.TLSCertificate{Provider: ecv1alpha1.TLSProviderAuto}
+		warnings = append(warnings, "the certificates of the members are issued by the operator rather than read from the static Secrets, the clients need new certificates")
+	}
+
+	pod := l.Spec.Pod
+	if pod == nil {
+		pod = &legacyPodPolicy{}
+	}
+	ec.Spec.StorageSpec, ec.Spec.EphemeralStorage, warnings = convertLegacyStorage(pod.PersistentVolumeClaimSpec, warnings)
+
+	tmpl := &ecv1alpha1.PodTemplate{Env: pod.EtcdEnv}
+	if len(pod.Resources.Limits) > 0 || len(pod.Resources.Requests) > 0 {
+		tmpl.Resources = &pod.Resources
+	}
+	if pod.Affinity != nil || len(pod.Tolerations) > 0 || len(pod.NodeSelector) > 0 {
+		tmpl.Scheduling = &ecv1alpha1.PodScheduling{
+			Affinity:     pod.Affinity,
+			Tolerations:  pod.Tolerations,
+			NodeSelector: pod.NodeSelector,
+		}
+	}
+	if tmpl.Env != nil || tmpl.Resources != nil || tmpl.Scheduling != nil {
+		ec.Spec.PodTemplate = tmpl
+	}
+
+	var ignored []string
+	if len(pod.Labels) > 0 {
+		ignored = append(ignored, "pod.labels")
+	}
+	if len(pod.Annotations) > 0 {
+		ignored = append(ignored, "pod.annotations")
+	}
+	if pod.BusyboxImage != "" {
+		ignored = append(ignored, "pod.busyboxImage")
+	}
+	if pod.SecurityContext != nil {
+		ignored = append(ignored, "pod.securityContext")
+	}
+	if pod.DNSTimeoutInSecond != 0 {
+		ignored = append(ignored, "pod.DNSTimeoutInSecond")
+	}
+	if pod.ClusterDomain != "" {
+		ignored = append(ignored, "pod.ClusterDomain")
+	}
+	if len(ignored) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%s can't be converted and are ignored", strings.Join(ignored, ", ")))
+	}
+	return ec, warnings
+}
+
+// convertLegacyStorage returns the storage of the members of a legacy
+// cluster whose pods have the given claim spec: the legacy members without
+// one keep their data in an emptyDir volume.
+func convertLegacyStorage(pvc *corev1.PersistentVolumeClaimSpec, warnings []string) (*ecv1alpha1.StorageSpec, *ecv1alpha1.EphemeralStorage, []string) {
+	if pvc == nil {
+		return nil, &ecv1alpha1.EphemeralStorage{}, warnings
+	}
+	storage := &ecv1alpha1.StorageSpec{}
+	if pvc.StorageClassName != nil {
+		storage.StorageClassName = *pvc.StorageClassName
+	}
+	if size, ok := pvc.Resources.Requests[corev1.ResourceStorage]; ok {
+		storage.VolumeSizeRequest = size
+	}
+	if slices.ContainsFunc(pvc.AccessModes, func(m corev1.PersistentVolumeAccessMode) bool {
+		return m != corev1.ReadWriteOnce
+	}) {
+		warnings = append(warnings, "the volumes are ReadWriteOnce, the access modes of the persistentVolumeClaimSpec are ignored")
+	}
+	return storage, nil, warnings
+}
+
+// marshalEtcdCluster returns the YAML manifest of ec, without its status.
+func marshalEtcdCluster(ec *ecv1alpha1.EtcdCluster) ([]byte, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(ec)
+	if err != nil {
+		return nil, err
+	}
+	delete(obj, "status")
+	unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+	return yaml.Marshal(obj)
+}
@@ -0,0 +1,135 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func newLegacyCluster(name string, spec map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	obj.SetGroupVersionKind(legacyGroupVersion.WithKind("EtcdCluster"))
+	obj.SetName(name)
+	obj.SetNamespace("default")
+	return obj
+}
+
+func TestConvertLegacyCluster(t *testing.T) {
+	l := &legacyEtcdCluster{}
+	l.Name = "example"
+	l.Namespace = "default"
+	l.Spec = legacyClusterSpec{
+		Size:    3,
+		Version: "3.5.17",
+		Pod: &legacyPodPolicy{
+			NodeSelector: map[string]string{"disk": "ssd"},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			},
+			EtcdEnv: []corev1.EnvVar{{Name: "ETCD_AUTO_COMPACTION_RETENTION", Value: "1"}},
+			PersistentVolumeClaimSpec: &corev1.PersistentVolumeClaimSpec{
+				StorageClassName: ptr.To("fast"),
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("2Gi")},
+				},
+			},
+		},
+	}
+
+	ec, warnings := convertLegacyCluster(l)
+	assert.Empty(t, warnings)
+	assert.Equal(t, "example", ec.Name)
+	assert.Equal(t, 3, ec.Spec.Size)
+	assert.Equal(t, "v3.5.17", ec.Spec.Version)
+	assert.Equal(t, &ecv1alpha1.StorageSpec{StorageClassName: "fast", VolumeSizeRequest: resource.MustParse("2Gi")}, ec.Spec.StorageSpec)
+	assert.Nil(t, ec.Spec.EphemeralStorage)
+	assert.Equal(t, map[string]string{"disk": "ssd"}, ec.Spec.PodTemplate.Scheduling.NodeSelector)
+	assert.Equal(t, l.Spec.Pod.EtcdEnv, ec.Spec.PodTemplate.Env)
+	assert.Equal(t, resource.MustParse("100m"), ec.Spec.PodTemplate.Resources.Requests[corev1.ResourceCPU])
+
+	// The defaults of the legacy operator.
+	ec, warnings = convertLegacyCluster(&legacyEtcdCluster{Spec: legacyClusterSpec{Size: 1}})
+	assert.Empty(t, warnings)
+	assert.Equal(t, "v3.2.13", ec.Spec.Version)
+	assert.Equal(t, &ecv1alpha1.EphemeralStorage{}, ec.Spec.EphemeralStorage)
+	assert.Nil(t, ec.Spec.PodTemplate)
+}
+
+func TestConvertLegacyClusterWarnings(t *testing.T) {
+	l := &legacyEtcdCluster{}
+	l.Spec = legacyClusterSpec{
+		Size:       3,
+		Repository: "registry.example.com/etcd",
+		Paused:     true,
+		TLS:        &legacyTLSPolicy{Static: &legacyStaticTLS{OperatorSecret: "etcd-client-tls"}},
+		Pod: &legacyPodPolicy{
+			Labels:       map[string]string{"team": "infra"},
+			BusyboxImage: "busybox:1.36",
+		},
+	}
+	ec, warnings := convertLegacyCluster(l)
+	assert.Equal(t, "true", ec.Annotations[ecv1alpha1.PausedAnnotation])
+	assert.Equal(t, ecv1alpha1.TLSProviderAuto, ec.Spec.TLS.Provider)
+	assert.Len(t, warnings, 4)
+	assert.Contains(t, warnings[0], "rather than registry.example.com/etcd")
+	assert.Contains(t, warnings[3], "pod.labels, pod.busyboxImage can't be converted")
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = ecv1alpha1.AddToScheme(scheme)
+	scheme.AddKnownTypeWithName(legacyGroupVersion.WithKind("EtcdCluster"), &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(legacyGroupVersion.WithKind("EtcdClusterList"), &unstructured.UnstructuredList{})
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newLegacyCluster("first", map[string]any{"size": int64(3), "version": "3.5.17"}),
+		newLegacyCluster("second", map[string]any{"size": int64(1), "paused": true}),
+	).Build()
+
+	out := &bytes.Buffer{}
+	o := &Options{out: out}
+	assert.NoError(t, o.migrate(ctx, c, "default", "", &migrateOptions{}))
+	assert.Equal(t, `apiVersion: operator.etcd.io/v1alpha1
+kind: EtcdCluster
+metadata:
+  name: first
+  namespace: default
+spec:
+  ephemeralStorage: {}
+  size: 3
+  version: v3.5.17
+---
+# the cluster is paused, remove the operator.etcd.io/paused annotation to create its members
+apiVersion: operator.etcd.io/v1alpha1
+kind: EtcdCluster
+metadata:
+  annotations:
+    operator.etcd.io/paused: "true"
+  name: second
+  namespace: default
+spec:
+  ephemeralStorage: {}
+  size: 1
+  version: v3.2.13
+`, out.String())
+
+	out.Reset()
+	assert.NoError(t, o.migrate(ctx, c, "default", "first", &migrateOptions{apply: true, nameSuffix: "-new"}))
+	assert.Equal(t, "Created EtcdCluster default/first-new from legacy EtcdCluster first\n", out.String())
+	ec := &ecv1alpha1.EtcdCluster{}
+	assert.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "first-new"}, ec))
+	assert.Equal(t, "v3.5.17", ec.Spec.Version)
+
+	assert.ErrorContains(t, o.migrate(ctx, c, "other", "", &migrateOptions{}), "no legacy EtcdCluster in namespace other")
+}
@@ -0,0 +1,125 @@
+// Package plugin implements kubectl-etcd, a kubectl plugin running the day-2
+// operations of the EtcdClusters managed by the operator, without having to
+// port-forward to their members and assemble etcdctl flags by hand.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// Options holds the flags shared by all the commands.
+type Options struct {
+	Kubeconfig string
+	Context    string
+	Namespace  string
+	Timeout    time.Duration
+
+	out io.Writer
+}
+
+// NewCommand returns the root command of the plugin.
+func NewCommand(out io.Writer) *cobra.Command {
+	o := &Options{out: out}
+	cmd := &cobra.Command{
+		Use:           "kubectl-etcd",
+		Short:         "Operate the EtcdClusters managed by the etcd-operator",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	cmd.SetOut(out)
+	cmd.PersistentFlags().StringVar(&o.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file.")
+	cmd.PersistentFlags().StringVar(&o.Context, "context", "", "The kubeconfig context to use.")
+	cmd.PersistentFlags().StringVarP(&o.Namespace, "namespace", "n", "", "The namespace of the EtcdCluster.")
+	cmd.PersistentFlags().DurationVar(&o.Timeout, "timeout", 30*time.Second, "The timeout of each etcd request.")
+
+	cmd.AddCommand(
+		newStatusCommand(o),
+		newMembersCommand(o),
+		newDefragCommand(o),
+		newSnapshotCommand(o),
+		newMoveLeaderCommand(o),
+		newRestoreCommand(o),
+		newMigrateCommand(o),
+	)
+	return cmd
+}
+
+// cluster is an EtcdCluster and the clients to reach it.
+type cluster struct {
+	ec         *ecv1alpha1.EtcdCluster
+	sts        *appsv1.StatefulSet
+	restConfig *rest.Config
+}
+
+// members returns the names of the member Pods of the cluster.
+func (c *cluster) members() []string {
+	if c.sts == nil || c.sts.Spec.Replicas == nil {
+		return nil
+	}
+	pods := make([]string, 0, *c.sts.Spec.Replicas)
+	for i := range int(*c.sts.Spec.Replicas) {
+		pods = append(pods, fmt.Sprintf("%s-%d", c.sts.Name, i))
+	}
+	return pods
+}
+
+// newClient returns a client of the Kubernetes cluster of the kubeconfig, its
+// config, and the namespace of the commands.
+func (o *Options) newClient() (client.Client, *rest.Config, string, error) {
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: o.Kubeconfig, Precedence: clientcmd.NewDefaultClientConfigLoadingRules().Precedence},
+		&clientcmd.ConfigOverrides{CurrentContext: o.Context},
+	)
+	restConfig, err := loader.ClientConfig()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	namespace := o.Namespace
+	if namespace == "" {
+		if namespace, _, err = loader.Namespace(); err != nil {
+			return nil, nil, "", err
+		}
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = ecv1alpha1.AddToScheme(scheme)
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return c, restConfig, namespace, nil
+}
+
+// getCluster returns the EtcdCluster name and its StatefulSet.
+func (o *Options) getCluster(ctx context.Context, name string) (*cluster, error) {
+	c, restConfig, namespace, err := o.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ec := &ecv1alpha1.EtcdCluster{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, ec); err != nil {
+		return nil, err
+	}
+	ecv1alpha1.SetEtcdClusterDefaults(ec)
+
+	sts := &appsv1.StatefulSet{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, sts); err != nil {
+		return nil, fmt.Errorf("failed to get the StatefulSet of EtcdCluster %s: %w", name, err)
+	}
+	return &cluster{ec: ec, sts: sts, restConfig: restConfig}, nil
+}
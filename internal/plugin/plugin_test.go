@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestNewCommand(t *testing.T) {
+	cmd := NewCommand(&bytes.Buffer{})
+	var names []string
+	for _, sub := range cmd.Commands() {
+		names = append(names, sub.Name())
+	}
+	assert.ElementsMatch(t, []string{"status", "members", "defrag", "snapshot", "move-leader", "restore", "migrate"}, names)
+
+	cmd.SetArgs([]string{"status"})
+	assert.ErrorContains(t, cmd.Execute(), "accepts 1 arg(s)")
+}
+
+func TestClusterMembers(t *testing.T) {
+	c := &cluster{sts: &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: ptr.To[int32](3)},
+	}}
+	assert.Equal(t, []string{"test-0", "test-1", "test-2"}, c.members())
+	assert.Empty(t, (&cluster{}).members())
+}
+
+func TestClientPort(t *testing.T) {
+	sts := &appsv1.StatefulSet{}
+	assert.Equal(t, ecv1alpha1.DefaultClientPort, clientPort(sts))
+
+	sts.Spec.Template.Spec.Containers = []corev1.Container{{
+		Ports: []corev1.ContainerPort{{Name: "peer", ContainerPort: 2380}, {Name: "client", ContainerPort: 12379}},
+	}}
+	assert.Equal(t, int32(12379), clientPort(sts))
+}
+
+func newMemberStatus(id, leader uint64) memberStatus {
+	return memberStatus{StatusResponse: &clientv3.StatusResponse{
+		Header: &etcdserverpb.ResponseHeader{MemberId: id},
+		Leader: leader,
+	}}
+}
+
+func TestDefragOrder(t *testing.T) {
+	statuses := []memberStatus{newMemberStatus(1, 2), newMemberStatus(2, 2), newMemberStatus(3, 2)}
+	assert.Equal(t, 1, leaderIndex(statuses))
+	assert.Equal(t, []int{0, 2, 1}, defragOrder(statuses))
+
+	// Without a leader, the members keep their order.
+	statuses = []memberStatus{{err: errors.New("unreachable")}, newMemberStatus(2, 0)}
+	assert.Equal(t, -1, leaderIndex(statuses))
+	assert.Equal(t, []int{0, 1}, defragOrder(statuses))
+}
+
+func TestFormatMemberID(t *testing.T) {
+	assert.Equal(t, "8e9e05c52164694d", formatMemberID(0x8e9e05c52164694d))
+}
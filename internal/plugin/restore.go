@@ -0,0 +1,135 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func newRestoreCommand(o *Options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore BACKUP CLUSTER",
+		Short: "Restore the snapshot of the EtcdBackup BACKUP to a new EtcdCluster CLUSTER",
+		Long: `Restore the snapshot of the EtcdBackup BACKUP to a new EtcdCluster CLUSTER,
+with the spec of the cluster it backed up. It creates an EtcdRestore named
+after CLUSTER, which the operator carries out.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.restore(cmd.Context(), args[0], args[1])
+		},
+	}
+}
+
+func (o *Options) restore(ctx context.Context, backupName, name string) error {
+	c, _, namespace, err := o.newClient()
+	if err != nil {
+		return err
+	}
+
+	backup := &ecv1alpha1.EtcdBackup{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: backupName}, backup); err != nil {
+		return err
+	}
+	ec := &ecv1alpha1.EtcdCluster{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: backup.Spec.ClusterName}, ec); err != nil {
+		return fmt.Errorf("failed to get EtcdCluster %s, the spec of the restored cluster: %w", backup.Spec.ClusterName, err)
+	}
+
+	restore, err := newRestore(backup, ec, name)
+	if err != nil {
+		return err
+	}
+	if err := c.Create(ctx, restore); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.out, "Created EtcdRestore %s, restoring the snapshot of EtcdBackup %s to EtcdCluster %s\n", restore.Name, backup.Name, name)
+	return nil
+}
+
+// newRestore returns the EtcdRestore of the snapshot of backup to a new
+// EtcdCluster, name, with the spec of ec, the cluster backup was taken of.
+func newRestore(backup *ecv1alpha1.EtcdBackup, ec *ecv1alpha1.EtcdCluster, name string) (*ecv1alpha1.EtcdRestore, error) {
+	if backup.Status.Phase != ecv1alpha1.EtcdBackupPhaseCompleted {
+		return nil, fmt.Errorf("EtcdBackup %s isn't completed", backup.Name)
+	}
+	if ec.Spec.StorageSpec == nil {
+		return nil, fmt.Errorf("EtcdCluster %s has no storageSpec, the restored cluster needs one", ec.Name)
+	}
+	if ec.Spec.KubeconfigSecretRef != nil {
+		return nil, fmt.Errorf("EtcdCluster %s runs in a remote Kubernetes cluster, it can't be restored", ec.Name)
+	}
+	source, err := backupSource(backup)
+	if err != nil {
+		return nil, err
+	}
+	// The restored cluster runs next to ec: it gets the Secret named after
+	// it rather than taking over the one of ec.
+	spec := ec.Spec.DeepCopy()
+	if spec.ConnectionSecret != nil {
+		spec.ConnectionSecret.Name = ""
+	}
+	return &ecv1alpha1.EtcdRestore{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: backup.Namespace},
+		Spec: ecv1alpha1.EtcdRestoreSpec{
+			ClusterName:        name,
+			ClusterSpec:        *spec,
+			Source:             source,
+			ServiceAccountName: backup.Spec.ServiceAccountName,
+			Encryption:         backup.Spec.Encryption.DeepCopy(),
+		},
+	}, nil
+}
+
+// backupSource returns the source reading the snapshot of backup, in the
+// destination of its storage provider.
+func backupSource(backup *ecv1alpha1.EtcdBackup) (ecv1alpha1.RestoreSource, error) {
+	spec := backup.Spec
+	name := backup.DefaultSnapshotName()
+	orDefault := func(s string) string {
+		if s != "" {
+			return s
+		}
+		return name
+	}
+	switch {
+	case spec.StorageProvider == ecv1alpha1.StorageProviderGCS && spec.GCS != nil:
+		return ecv1alpha1.RestoreSource{GCS: &ecv1alpha1.GCSSnapshotSource{
+			Bucket:               spec.GCS.Bucket,
+			Object:               orDefault(spec.GCS.Object),
+			CredentialsSecretRef: spec.GCS.CredentialsSecretRef.DeepCopy(),
+		}}, nil
+	case spec.StorageProvider == ecv1alpha1.StorageProviderAzure && spec.Azure != nil:
+		return ecv1alpha1.RestoreSource{Azure: &ecv1alpha1.AzureSnapshotSource{
+			StorageAccount:       spec.Azure.StorageAccount,
+			Container:            spec.Azure.Container,
+			Blob:                 orDefault(spec.Azure.Blob),
+			CredentialsSecretRef: spec.Azure.CredentialsSecretRef.DeepCopy(),
+		}}, nil
+	case spec.StorageProvider == ecv1alpha1.StorageProviderPVC && spec.PVC != nil:
+		return ecv1alpha1.RestoreSource{PVC: &ecv1alpha1.PVCSnapshotSource{
+			ClaimName: spec.PVC.ClaimName,
+			Path:      orDefault(spec.PVC.Path),
+		}}, nil
+	case spec.StorageProvider == ecv1alpha1.StorageProviderHostPath && spec.HostPath != nil:
+		return ecv1alpha1.RestoreSource{HostPath: &ecv1alpha1.HostPathSnapshotSource{
+			NodeName:  spec.HostPath.NodeName,
+			Directory: spec.HostPath.Directory,
+			Path:      orDefault(spec.HostPath.Path),
+		}}, nil
+	case (spec.StorageProvider == "" || spec.StorageProvider == ecv1alpha1.StorageProviderS3) && spec.S3 != nil:
+		return ecv1alpha1.RestoreSource{S3: &ecv1alpha1.S3SnapshotSource{
+			Bucket:               spec.S3.Bucket,
+			Key:                  orDefault(spec.S3.Key),
+			Region:               spec.S3.Region,
+			Endpoint:             spec.S3.Endpoint,
+			CredentialsSecretRef: spec.S3.CredentialsSecretRef,
+		}}, nil
+	}
+	return ecv1alpha1.RestoreSource{}, errors.New("the EtcdBackup has no destination for its storage provider")
+}
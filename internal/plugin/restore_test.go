@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestNewRestore(t *testing.T) {
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "default"},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:             3,
+			Version:          "v3.5.21",
+			StorageSpec:      &ecv1alpha1.StorageSpec{VolumeSizeRequest: resource.MustParse("1Gi")},
+			ConnectionSecret: &ecv1alpha1.ConnectionSecret{Name: "prod-etcd"},
+		},
+	}
+	backup := &ecv1alpha1.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default"},
+		Spec: ecv1alpha1.EtcdBackupSpec{
+			ClusterName:        "prod",
+			StorageProvider:    ecv1alpha1.StorageProviderS3,
+			S3:                 &ecv1alpha1.S3BackupDestination{Bucket: "backups", CredentialsSecretRef: corev1.LocalObjectReference{Name: "aws"}},
+			ServiceAccountName: "backup",
+		},
+		Status: ecv1alpha1.EtcdBackupStatus{Phase: ecv1alpha1.EtcdBackupPhaseRunning},
+	}
+
+	_, err := newRestore(backup, ec, "prod-restored")
+	assert.ErrorContains(t, err, "EtcdBackup nightly isn't completed")
+
+	backup.Status.Phase = ecv1alpha1.EtcdBackupPhaseCompleted
+	restore, err := newRestore(backup, ec, "prod-restored")
+	assert.NoError(t, err)
+	assert.Equal(t, "prod-restored", restore.Name)
+	assert.Equal(t, "default", restore.Namespace)
+	assert.Equal(t, "prod-restored", restore.Spec.ClusterName)
+	// The restored cluster doesn't take over the Secret of ec.
+	assert.Equal(t, &ecv1alpha1.ConnectionSecret{}, restore.Spec.ClusterSpec.ConnectionSecret)
+	assert.Equal(t, "prod-etcd", ec.Spec.ConnectionSecret.Name)
+	restore.Spec.ClusterSpec.ConnectionSecret = ec.Spec.ConnectionSecret
+	assert.Equal(t, ec.Spec, restore.Spec.ClusterSpec)
+	assert.Equal(t, "backup", restore.Spec.ServiceAccountName)
+	assert.Equal(t, &ecv1alpha1.S3SnapshotSource{
+		Bucket:               "backups",
+		Key:                  "default/prod/nightly.db",
+		CredentialsSecretRef: corev1.LocalObjectReference{Name: "aws"},
+	}, restore.Spec.Source.S3)
+
+	ec.Spec.StorageSpec = nil
+	_, err = newRestore(backup, ec, "prod-restored")
+	assert.ErrorContains(t, err, "the restored cluster needs one")
+}
+
+func TestBackupSource(t *testing.T) {
+	backup := &ecv1alpha1.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default"},
+		Spec: ecv1alpha1.EtcdBackupSpec{
+			ClusterName:     "prod",
+			StorageProvider: ecv1alpha1.StorageProviderPVC,
+			PVC:             &ecv1alpha1.PVCBackupDestination{ClaimName: "snapshots"},
+		},
+	}
+	source, err := backupSource(backup)
+	assert.NoError(t, err)
+	assert.Equal(t, &ecv1alpha1.PVCSnapshotSource{ClaimName: "snapshots", Path: "default/prod/nightly.db"}, source.PVC)
+
+	backup.Spec.StorageProvider = ecv1alpha1.StorageProviderHostPath
+	backup.Spec.HostPath = &ecv1alpha1.HostPathBackupDestination{NodeName: "node-1", Directory: "/var/backups", Path: "prod.db"}
+	source, err = backupSource(backup)
+	assert.NoError(t, err)
+	assert.Equal(t, &ecv1alpha1.HostPathSnapshotSource{NodeName: "node-1", Directory: "/var/backups", Path: "prod.db"}, source.HostPath)
+	assert.Nil(t, source.PVC)
+
+	backup.Spec.StorageProvider = ecv1alpha1.StorageProviderGCS
+	_, err = backupSource(backup)
+	assert.ErrorContains(t, err, "no destination for its storage provider")
+}
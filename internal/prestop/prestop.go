@@ -0,0 +1,156 @@
+// Package prestop hands a stopping etcd member over to the rest of its
+// cluster: the preStop hook of the members runs it, so that a member moves
+// its leadership to another member, and only stops once the other members
+// are a healthy quorum without it.
+package prestop
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// pollInterval is how often the health of the other members is checked.
+const pollInterval = time.Second
+
+// Run moves the leadership off the member at ep, when it is the leader, to
+// the healthy voting member with the most recent raft index, then waits for
+// the other members to be a healthy quorum of the cluster, with a leader.
+// It gives up once ctx is done, even in the middle of a request to the
+// members. A learner, or the single member of a cluster, has nothing to hand
+// over.
+func Run(ctx context.Context, lg *zap.Logger, c *etcdutils.ClusterClient, ep string) error {
+	type result struct {
+		done bool
+		err  error
+	}
+	for {
+		// The requests of the ClusterClient have their own timeouts, so ctx
+		// is only checked around them.
+		results := make(chan result, 1)
+		go func() {
+			done, err := handOver(lg, c, ep)
+			results <- result{done, err}
+		}()
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the other members aren't a healthy quorum: %w", ctx.Err())
+		case r := <-results:
+			if r.err != nil {
+				lg.Info("failed to hand the member over", zap.Error(r.err))
+			}
+			if r.done {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the other members aren't a healthy quorum: %w", ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// handOver checks the cluster of the member at ep once, moving its leadership
+// away when it is the leader. It returns whether the member can stop.
+func handOver(lg *zap.Logger, c *etcdutils.ClusterClient, ep string) (bool, error) {
+	members, err := c.MemberList([]string{ep})
+	if err != nil {
+		return false, err
+	}
+	self := members.Header.MemberId
+	idx := slices.IndexFunc(members.Members, func(m *etcdserverpb.Member) bool { return m.ID == self })
+	if idx < 0 || members.Members[idx].IsLearner || votingMembers(members) == 1 {
+		return true, nil
+	}
+
+	eps := []string{ep}
+	for _, m := range members.Members {
+		if m.ID != self && len(m.ClientURLs) > 0 {
+			eps = append(eps, m.ClientURLs[0])
+		}
+	}
+	healthInfos, err := c.ClusterHealth(eps)
+	if err != nil {
+		return false, err
+	}
+
+	if leader := leaderOf(healthInfos); leader == self {
+		transferee, ok := transferee(members, healthInfos, self)
+		if !ok {
+			return false, fmt.Errorf("no other healthy voting member to move the leadership to")
+		}
+		lg.Info("moving the leadership", zap.String("to", fmt.Sprintf("%x", transferee)))
+		return false, c.MoveLeader(ep, transferee)
+	}
+	return quorumWithout(members, healthInfos, self), nil
+}
+
+func votingMembers(members *clientv3.MemberListResponse) int {
+	n := 0
+	for _, m := range members.Members {
+		if !m.IsLearner {
+			n++
+		}
+	}
+	return n
+}
+
+// leaderOf returns the leader the healthy members in healthInfos agree on, or
+// 0 when there is none.
+func leaderOf(healthInfos []etcdutils.EpHealth) uint64 {
+	for _, h := range healthInfos {
+		if h.Health && h.Status != nil && h.Status.Leader != 0 {
+			return h.Status.Leader
+		}
+	}
+	return 0
+}
+
+// healthyVoters returns the healthy voting members in healthInfos, other
+// than self, by ID.
+func healthyVoters(members *clientv3.MemberListResponse, healthInfos []etcdutils.EpHealth, self uint64) map[uint64]*clientv3.StatusResponse {
+	voters := map[uint64]*clientv3.StatusResponse{}
+	for _, h := range healthInfos {
+		if !h.Health || h.Status == nil || h.Status.Header == nil || h.Status.IsLearner {
+			continue
+		}
+		id := h.Status.Header.MemberId
+		if id != self && slices.ContainsFunc(members.Members, func(m *etcdserverpb.Member) bool { return m.ID == id }) {
+			voters[id] = h.Status
+		}
+	}
+	return voters
+}
+
+// transferee returns the healthy voting member, other than self, with the
+// most recent raft index, which catches up with the leader the soonest.
+func transferee(members *clientv3.MemberListResponse, healthInfos []etcdutils.EpHealth, self uint64) (uint64, bool) {
+	var (
+		best  uint64
+		index uint64
+	)
+	for id, st := range healthyVoters(members, healthInfos, self) {
+		if best == 0 || st.RaftIndex > index || (st.RaftIndex == index && id < best) {
+			best, index = id, st.RaftIndex
+		}
+	}
+	return best, best != 0
+}
+
+// quorumWithout reports whether the voting members other than self are a
+// healthy quorum of the cluster, with a leader other than self.
+func quorumWithout(members *clientv3.MemberListResponse, healthInfos []etcdutils.EpHealth, self uint64) bool {
+	leader := leaderOf(healthInfos)
+	if leader == 0 || leader == self {
+		return false
+	}
+	return len(healthyVoters(members, healthInfos, self)) >= votingMembers(members)/2+1
+}
@@ -0,0 +1,63 @@
+package prestop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+func newMembers(ids ...uint64) *clientv3.MemberListResponse {
+	resp := &clientv3.MemberListResponse{Header: &etcdserverpb.ResponseHeader{MemberId: ids[0]}}
+	for _, id := range ids {
+		resp.Members = append(resp.Members, &etcdserverpb.Member{ID: id, ClientURLs: []string{"http://member"}})
+	}
+	return resp
+}
+
+func health(id, leader, index uint64, healthy bool) etcdutils.EpHealth {
+	return etcdutils.EpHealth{Health: healthy, Status: &clientv3.StatusResponse{
+		Header:    &etcdserverpb.ResponseHeader{MemberId: id},
+		Leader:    leader,
+		RaftIndex: index,
+	}}
+}
+
+func TestTransferee(t *testing.T) {
+	members := newMembers(1, 2, 3)
+
+	id, ok := transferee(members, []etcdutils.EpHealth{health(1, 1, 10, true), health(2, 1, 8, true), health(3, 1, 9, true)}, 1)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), id)
+
+	id, ok = transferee(members, []etcdutils.EpHealth{health(1, 1, 10, true), health(2, 1, 8, true), health(3, 1, 9, false)}, 1)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), id)
+
+	// A learner can't take over the leadership.
+	members.Members[1].IsLearner = true
+	learner := health(2, 1, 8, true)
+	learner.Status.IsLearner = true
+	_, ok = transferee(members, []etcdutils.EpHealth{health(1, 1, 10, true), learner, health(3, 1, 9, false)}, 1)
+	assert.False(t, ok)
+}
+
+func TestQuorumWithout(t *testing.T) {
+	members := newMembers(1, 2, 3)
+
+	assert.True(t, quorumWithout(members, []etcdutils.EpHealth{health(1, 2, 10, true), health(2, 2, 10, true), health(3, 2, 10, true)}, 1))
+	// The member is still the leader.
+	assert.False(t, quorumWithout(members, []etcdutils.EpHealth{health(1, 1, 10, true), health(2, 1, 10, true), health(3, 1, 10, true)}, 1))
+	// Without the member, a single healthy member isn't a quorum of three.
+	assert.False(t, quorumWithout(members, []etcdutils.EpHealth{health(1, 2, 10, true), health(2, 2, 10, true), health(3, 2, 10, false)}, 1))
+	// No leader.
+	assert.False(t, quorumWithout(members, []etcdutils.EpHealth{health(1, 0, 10, true), health(2, 0, 10, true), health(3, 0, 10, true)}, 1))
+
+	members = newMembers(1, 2, 3, 4, 5)
+	assert.True(t, quorumWithout(members, []etcdutils.EpHealth{
+		health(1, 2, 10, true), health(2, 2, 10, true), health(3, 2, 10, true), health(4, 2, 10, true), health(5, 2, 10, false),
+	}, 1))
+}
@@ -0,0 +1,216 @@
+// Package rbac builds the RBAC resources of the restricted mode of the
+// operator, in which it only holds permissions in the namespaces it watches.
+package rbac
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NamespacedRules are the permissions the operator needs in each namespace it
+// watches. They match the namespaced part of the manager ClusterRole
+// generated in config/rbac/role.yaml.
+var NamespacedRules = []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"configmaps", "secrets", "services"},
+		Verbs:     []string{"create", "delete", "get", "list", "patch", "update", "watch"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"events"},
+		Verbs:     []string{"create", "get", "list", "patch", "update"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"persistentvolumeclaims"},
+		Verbs:     []string{"create", "delete", "get", "patch"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"create", "delete", "get", "list", "patch", "watch"},
+	},
+	{
+		APIGroups: []string{"apps"},
+		Resources: []string{"deployments", "statefulsets"},
+		Verbs:     []string{"create", "delete", "get", "list", "patch", "update", "watch"},
+	},
+	{
+		APIGroups: []string{"batch"},
+		Resources: []string{"cronjobs"},
+		Verbs:     []string{"create", "delete", "get", "patch"},
+	},
+	{
+		APIGroups: []string{"batch"},
+		Resources: []string{"jobs"},
+		Verbs:     []string{"create", "get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"cert-manager.io"},
+		Resources: []string{"certificates"},
+		Verbs:     []string{"create", "get", "patch"},
+	},
+	{
+		APIGroups: []string{"monitoring.coreos.com"},
+		Resources: []string{"prometheusrules", "servicemonitors"},
+		Verbs:     []string{"create", "delete", "get", "patch"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdbackups"},
+		Verbs:     []string{"create", "delete", "get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdbackups/status"},
+		Verbs:     []string{"get", "patch", "update"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdbackupschedules"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdbackupschedules/status"},
+		Verbs:     []string{"get", "patch", "update"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdclusteroverrides"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdclusters"},
+		Verbs:     []string{"create", "delete", "get", "list", "patch", "update", "watch"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdclusters/finalizers"},
+		Verbs:     []string{"update"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdclusters/status"},
+		Verbs:     []string{"get", "patch", "update"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdmirrors"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdmirrors/status"},
+		Verbs:     []string{"get", "patch", "update"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdrestores"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdrestores/status"},
+		Verbs:     []string{"get", "patch", "update"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdroles", "etcdusers"},
+		Verbs:     []string{"get", "list", "patch", "update", "watch"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdroles/finalizers", "etcdusers/finalizers"},
+		Verbs:     []string{"update"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdroles/status", "etcdusers/status"},
+		Verbs:     []string{"get", "patch", "update"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"externaletcdclusters"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"externaletcdclusters/status"},
+		Verbs:     []string{"get", "patch", "update"},
+	},
+	{
+		APIGroups: []string{"policy"},
+		Resources: []string{"poddisruptionbudgets"},
+		Verbs:     []string{"create", "delete", "get", "list", "patch", "watch"},
+	},
+}
+
+// ClusterRules are the cluster-wide permissions left in the restricted mode.
+// The cluster-scoped resources are read directly from the API server instead
+// of being watched.
+var ClusterRules = []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"namespaces"},
+		Verbs:     []string{"get"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdclustertemplates"},
+		Verbs:     []string{"get"},
+	},
+	{
+		APIGroups: []string{"operator.etcd.io"},
+		Resources: []string{"etcdoperatorpolicies"},
+		Verbs:     []string{"list"},
+	},
+}
+
+// UnrestrictedResources are the cluster-scoped resources of the manager
+// ClusterRole the operator doesn't read at all in the restricted mode.
+var UnrestrictedResources = []string{"nodes", "storageclasses"}
+
+// RestrictedObjects returns the roles, and their bindings to the service
+// account of the operator, granting it the permissions of the restricted
+// mode in the given namespaces.
+func RestrictedObjects(name string, serviceAccount, serviceAccountNamespace string, namespaces []string) []client.Object {
+	subjects := []rbacv1.Subject{{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      serviceAccount,
+		Namespace: serviceAccountNamespace,
+	}}
+
+	objs := []client.Object{
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Rules:      ClusterRules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name},
+			Subjects:   subjects,
+		},
+	}
+	for _, ns := range namespaces {
+		objs = append(objs,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+				Rules:      NamespacedRules,
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+				Subjects:   subjects,
+			},
+		)
+	}
+	return objs
+}
@@ -0,0 +1,63 @@
+package rbac
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// verbs returns the verbs granted by rules on resource, sorted.
+func verbs(rules []rbacv1.PolicyRule, group, resource string) []string {
+	var granted []string
+	for _, rule := range rules {
+		if slices.Contains(rule.APIGroups, group) && slices.Contains(rule.Resources, resource) {
+			granted = append(granted, rule.Verbs...)
+		}
+	}
+	slices.Sort(granted)
+	return slices.Compact(granted)
+}
+
+// TestRulesMatchManagerRole makes sure the restricted rules follow the changes
+// of the RBAC markers of the operator.
+func TestRulesMatchManagerRole(t *testing.T) {
+	data, err := os.ReadFile("../../config/rbac/role.yaml")
+	assert.NoError(t, err)
+	role := &rbacv1.ClusterRole{}
+	assert.NoError(t, yaml.Unmarshal(data, role))
+
+	for _, rule := range role.Rules {
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				if slices.Contains(UnrestrictedResources, resource) {
+					assert.Nil(t, verbs(ClusterRules, group, resource), "%s/%s", group, resource)
+					assert.Nil(t, verbs(NamespacedRules, group, resource), "%s/%s", group, resource)
+					continue
+				}
+				if granted := verbs(ClusterRules, group, resource); granted != nil {
+					for _, verb := range granted {
+						assert.Contains(t, rule.Verbs, verb, "%s/%s", group, resource)
+					}
+					assert.Nil(t, verbs(NamespacedRules, group, resource), "%s/%s", group, resource)
+					continue
+				}
+				assert.Equal(t, verbs(role.Rules, group, resource), verbs(NamespacedRules, group, resource), "%s/%s", group, resource)
+			}
+		}
+	}
+}
+
+func TestRestrictedObjects(t *testing.T) {
+	objs := RestrictedObjects("etcd-operator-restricted", "controller-manager", "etcd-operator-system", []string{"team-a", "team-b"})
+	assert.Len(t, objs, 6)
+
+	binding, ok := objs[5].(*rbacv1.RoleBinding)
+	assert.True(t, ok)
+	assert.Equal(t, "team-b", binding.Namespace)
+	assert.Equal(t, "Role", binding.RoleRef.Kind)
+	assert.Equal(t, "etcd-operator-system", binding.Subjects[0].Namespace)
+}
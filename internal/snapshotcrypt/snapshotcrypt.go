@@ -0,0 +1,147 @@
+// Package snapshotcrypt encrypts the snapshots of the EtcdBackups with
+// AES-256-GCM, and decrypts them for the EtcdRestores.
+//
+// The snapshot is split in chunks, each sealed with its own nonce: a random
+// prefix, written after the header, followed by the index of the chunk and
+// whether it is the last one. A snapshot truncated, reordered or tampered
+// with fails to decrypt.
+package snapshotcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// KeySize is the size of the keys, in bytes.
+	KeySize = 32
+
+	// chunkSize is the size of the plaintext of the chunks, but the last.
+	chunkSize = 64 * 1024
+	// prefixSize is the size of the random prefix of the nonces.
+	prefixSize = 7
+)
+
+// magic starts the encrypted snapshots, with the version of the format.
+var magic = []byte("EOSNAP1\n")
+
+// ErrDecrypt is returned when a snapshot can't be decrypted: it isn't
+// encrypted, the key is wrong, or it was truncated or tampered with.
+var ErrDecrypt = errors.New("failed to decrypt the snapshot: wrong key, or corrupted snapshot")
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("the key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce returns the nonce of the chunk at index i.
+func nonce(prefix []byte, i uint32, last bool) []byte {
+	n := make([]byte, 0, prefixSize+5)
+	n = append(n, prefix...)
+	n = binary.BigEndian.AppendUint32(n, i)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
+
+// readChunk reads the next chunk of r into buf, and reports whether it is the
+// last one.
+func readChunk(r *bufio.Reader, buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(r, buf)
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return n, true, nil
+	case err != nil:
+		return n, false, err
+	}
+	if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+		return n, true, nil
+	} else if err != nil {
+		return n, false, err
+	}
+	return n, false, nil
+}
+
+// Encrypt writes the snapshot read from src, encrypted with key, to dst.
+func Encrypt(dst io.Writer, src io.Reader, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	if _, err := dst.Write(append(bytes.Clone(magic), prefix...)); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(src)
+	buf := make([]byte, chunkSize, chunkSize+aead.Overhead())
+	for i := uint32(0); ; i++ {
+		n, last, err := readChunk(r, buf)
+		if err != nil {
+			return err
+		}
+		if _, err := dst.Write(aead.Seal(buf[:0], nonce(prefix, i, last), buf[:n], nil)); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		if i == math.MaxUint32 {
+			return errors.New("the snapshot is too large to be encrypted")
+		}
+	}
+}
+
+// Decrypt writes the snapshot read from src, decrypted with key, to dst. dst
+// may have received a part of the snapshot when ErrDecrypt is returned.
+func Decrypt(dst io.Writer, src io.Reader, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(src)
+	header := make([]byte, len(magic)+prefixSize)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header[:len(magic)], magic) {
+		return ErrDecrypt
+	}
+	prefix := header[len(magic):]
+
+	buf := make([]byte, chunkSize+aead.Overhead())
+	for i := uint32(0); ; i++ {
+		n, last, err := readChunk(r, buf)
+		if err != nil {
+			return err
+		}
+		plaintext, err := aead.Open(buf[:0], nonce(prefix, i, last), buf[:n], nil)
+		if err != nil {
+			return ErrDecrypt
+		}
+		if _, err := dst.Write(plaintext); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		if i == math.MaxUint32 {
+			return ErrDecrypt
+		}
+	}
+}
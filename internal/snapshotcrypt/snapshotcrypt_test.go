@@ -0,0 +1,61 @@
+package snapshotcrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 42} {
+		snapshot := make([]byte, size)
+		_, _ = rand.Read(snapshot)
+
+		encrypted := &bytes.Buffer{}
+		assert.NoError(t, Encrypt(encrypted, bytes.NewReader(snapshot), key))
+		if size > 0 {
+			assert.NotContains(t, encrypted.String(), string(snapshot))
+		}
+
+		decrypted := &bytes.Buffer{}
+		assert.NoError(t, Decrypt(decrypted, bytes.NewReader(encrypted.Bytes()), key), "size %d", size)
+		assert.True(t, bytes.Equal(snapshot, decrypted.Bytes()), "size %d", size)
+	}
+}
+
+func TestDecryptFails(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+	snapshot := make([]byte, 2*chunkSize+10)
+	_, _ = rand.Read(snapshot)
+	encrypted := &bytes.Buffer{}
+	assert.NoError(t, Encrypt(encrypted, bytes.NewReader(snapshot), key))
+	sealedChunk := chunkSize + 16
+	header := len(magic) + prefixSize
+
+	tampered := bytes.Clone(encrypted.Bytes())
+	tampered[header+10] ^= 1
+
+	tests := []struct {
+		name      string
+		encrypted []byte
+		key       []byte
+	}{
+		{name: "wrong key", encrypted: encrypted.Bytes(), key: bytes.Repeat([]byte{8}, KeySize)},
+		{name: "plaintext", encrypted: snapshot, key: key},
+		{name: "tampered", encrypted: tampered, key: key},
+		{name: "truncated at a chunk", encrypted: encrypted.Bytes()[:header+sealedChunk], key: key},
+		{name: "truncated in a chunk", encrypted: encrypted.Bytes()[:encrypted.Len()-1], key: key},
+		{name: "header only", encrypted: encrypted.Bytes()[:header], key: key},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, Decrypt(&bytes.Buffer{}, bytes.NewReader(tt.encrypted), tt.key), ErrDecrypt)
+		})
+	}
+
+	assert.ErrorContains(t, Encrypt(&bytes.Buffer{}, bytes.NewReader(snapshot), key[:16]), "must be 32 bytes")
+}
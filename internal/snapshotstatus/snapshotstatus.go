@@ -0,0 +1,77 @@
+// Package snapshotstatus reads the status of the etcd snapshots, the way
+// `etcdutl snapshot status` does: the backup verification Jobs report it,
+// as etcdutl has no shell around it in the etcd image to write it to their
+// termination message.
+package snapshotstatus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// keyBucket is the bucket of the keys, indexed by their revision.
+var keyBucket = []byte("key")
+
+// Status is the status of a snapshot, with the JSON fields of
+// `etcdutl snapshot status -w json`.
+type Status struct {
+	// Hash is the CRC-32C of the buckets of the snapshot, with their keys
+	// and values.
+	Hash uint32 `json:"hash"`
+	// Revision is the latest revision of the snapshot.
+	Revision int64 `json:"revision"`
+	// TotalKey is the number of keys of the snapshot, in all its buckets.
+	TotalKey int `json:"totalKey"`
+	// TotalSize is the size of the snapshot, in bytes.
+	TotalSize int64 `json:"totalSize"`
+}
+
+// Read returns the status of the snapshot at path, after checking the
+// integrity of its database.
+func Read(path string) (Status, error) {
+	if _, err := os.Stat(path); err != nil {
+		return Status{}, err
+	}
+	db, err := bolt.Open(path, 0o400, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return Status{}, err
+	}
+	defer db.Close()
+
+	var st Status
+	h := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	err = db.View(func(tx *bolt.Tx) error {
+		var errs []error
+		for err := range tx.Check() {
+			errs = append(errs, err)
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("snapshot integrity check failed: %w", errors.Join(errs...))
+		}
+		st.TotalSize = tx.Size()
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			h.Write(name)
+			isKeyBucket := string(name) == string(keyBucket)
+			return b.ForEach(func(k, v []byte) error {
+				h.Write(k)
+				h.Write(v)
+				if isKeyBucket && len(k) >= 8 {
+					// The keys start with the main revision, big-endian.
+					st.Revision = int64(binary.BigEndian.Uint64(k[:8]))
+				}
+				st.TotalKey++
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return Status{}, err
+	}
+	st.Hash = h.Sum32()
+	return st, nil
+}
@@ -0,0 +1,72 @@
+package snapshotstatus
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+// revisionKey returns the key of the main revision rev in the key bucket.
+func revisionKey(rev int64) []byte {
+	k := make([]byte, 17)
+	binary.BigEndian.PutUint64(k, uint64(rev))
+	k[8] = '_'
+	return k
+}
+
+func writeSnapshot(t *testing.T, path string, revisions ...int64) {
+	db, err := bolt.Open(path, 0o600, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		keys, err := tx.CreateBucket(keyBucket)
+		if err != nil {
+			return err
+		}
+		for _, rev := range revisions {
+			if err := keys.Put(revisionKey(rev), []byte("value")); err != nil {
+				return err
+			}
+		}
+		meta, err := tx.CreateBucket([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		return meta.Put([]byte("consistent_index"), make([]byte, 8))
+	}))
+	assert.NoError(t, db.Close())
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "snapshot.db")
+	writeSnapshot(t, snapshot, 2, 3, 5)
+
+	st, err := Read(snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), st.Revision)
+	assert.Equal(t, 4, st.TotalKey)
+	assert.Positive(t, st.TotalSize)
+	assert.NotZero(t, st.Hash)
+
+	other := filepath.Join(dir, "other.db")
+	writeSnapshot(t, other, 2, 3, 6)
+	otherSt, err := Read(other)
+	assert.NoError(t, err)
+	assert.NotEqual(t, st.Hash, otherSt.Hash)
+
+	again, err := Read(snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, st, again)
+
+	_, err = Read(filepath.Join(dir, "missing.db"))
+	assert.Error(t, err)
+
+	garbage := filepath.Join(dir, "garbage.db")
+	assert.NoError(t, os.WriteFile(garbage, []byte("not a snapshot"), 0o600))
+	_, err = Read(garbage)
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+// Package validation validates EtcdClusters the same way wherever they are
+// checked: in the admission webhook, in the controller, or offline.
+package validation
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/cron"
+	"go.etcd.io/etcd-operator/internal/etcdutils"
+)
+
+// ValidateEtcdCluster runs all the checks of an EtcdCluster that don't depend
+// on other objects. ec is expected to be resolved: its template, overrides
+// and defaults already applied. It returns the violations and the warnings
+// about allowed but risky settings.
+func ValidateEtcdCluster(ec *ecv1alpha1.EtcdCluster) (field.ErrorList, []string) {
+	errs := ecv1alpha1.ValidateEtcdCluster(ec)
+	errs = append(errs, ValidateMaintenance(ec)...)
+	optionErrs, warnings := ValidateEtcdOptions(ec)
+	warnings = append(warnings, WarnEphemeralStorage(ec)...)
+	return append(errs, optionErrs...), warnings
+}
+
+// WarnEphemeralStorage warns that the members of the clusters with
+// spec.ephemeralStorage lose their data along with their pods.
+func WarnEphemeralStorage(ec *ecv1alpha1.EtcdCluster) []string {
+	if ec.Spec.EphemeralStorage == nil {
+		return nil
+	}
+	return []string{"spec.ephemeralStorage: the members lose their data along with their pods, e.g. on a node drain or " +
+		"a rolling restart, and the cluster loses all of it when a majority of them go at once; use it for test or cache clusters only"}
+}
+
+// ValidateMaintenance rejects the maintenance schedules that can't be
+// parsed, as the members would never be maintained.
+func ValidateMaintenance(ec *ecv1alpha1.EtcdCluster) field.ErrorList {
+	m := ec.Spec.Maintenance
+	if m == nil {
+		return nil
+	}
+	maintenancePath := field.NewPath("spec", "maintenance")
+	var errs field.ErrorList
+	if m.DefragSchedule != "" {
+		if _, err := cron.Parse(m.DefragSchedule); err != nil {
+			errs = append(errs, field.Invalid(maintenancePath.Child("defragSchedule"), m.DefragSchedule, err.Error()))
+		}
+	}
+	if l := m.LocalSnapshots; l != nil {
+		if _, err := cron.Parse(l.Schedule); err != nil {
+			errs = append(errs, field.Invalid(maintenancePath.Child("localSnapshots", "schedule"), l.Schedule, err.Error()))
+		}
+	}
+	return errs
+}
+
+// ValidateEtcdClusterUpdate runs the checks of an update of an EtcdCluster,
+// on top of those of ValidateEtcdCluster. Both objects are expected to be
+// resolved. It returns the violations and the warnings about allowed but
+// risky changes.
+func ValidateEtcdClusterUpdate(newEc, oldEc *ecv1alpha1.EtcdCluster) (field.ErrorList, []string) {
+	errs := ecv1alpha1.ValidateEtcdClusterUpdate(newEc, oldEc)
+	warnings := ecv1alpha1.WarnEtcdClusterUpdate(newEc, oldEc)
+	versionErrs, versionWarnings := ValidateVersionUpdate(newEc, oldEc)
+	return append(errs, versionErrs...), append(warnings, versionWarnings...)
+}
+
+// ValidateVersionUpdate rejects the version changes that etcd doesn't
+// support, as the upgraded members would fail to join the cluster.
+func ValidateVersionUpdate(newEc, oldEc *ecv1alpha1.EtcdCluster) (field.ErrorList, []string) {
+	if newEc.Spec.Version == oldEc.Spec.Version {
+		return nil, nil
+	}
+	versionPath := field.NewPath("spec", "version")
+	problem, err := etcdutils.CheckUpgradePath(oldEc.Spec.Version, newEc.Spec.Version)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("%s: skipping the upgrade path checks: %v", versionPath, err)}
+	}
+	if problem != "" {
+		return field.ErrorList{field.Forbidden(versionPath, problem)}, nil
+	}
+	return nil, nil
+}
+
+// ValidateEtcdOptions rejects the etcd options, and the extra arguments of
+// the pod template, that the selected etcd version doesn't accept, as
+// members would crash-loop on them, and warns about the deprecated ones.
+func ValidateEtcdOptions(ec *ecv1alpha1.EtcdCluster) (field.ErrorList, []string) {
+	errs, warnings := validateFlags(ec.Spec.Version, ec.Spec.EtcdOptions, field.NewPath("spec", "etcdOptions"))
+	if pt := ec.Spec.PodTemplate; pt != nil && len(pt.ExtraArgs) > 0 {
+		argErrs, argWarnings := validateFlags(ec.Spec.Version, pt.ExtraArgs, field.NewPath("spec", "podTemplate", "extraArgs"))
+		errs, warnings = append(errs, argErrs...), append(warnings, argWarnings...)
+	}
+	return errs, warnings
+}
+
+func validateFlags(version string, options []string, optionsPath *field.Path) (field.ErrorList, []string) {
+	issues, err := etcdutils.CheckFlagCompatibility(version, options)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("%s: skipping the etcd options compatibility checks: %v", optionsPath, err)}
+	}
+
+	var errs field.ErrorList
+	var warnings []string
+	for _, issue := range issues {
+		if issue.Fatal {
+			errs = append(errs, field.Invalid(optionsPath.Index(issue.Index), options[issue.Index], issue.Message))
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("%s: %s", optionsPath.Index(issue.Index), issue.Message))
+	}
+	return errs, warnings
+}
@@ -0,0 +1,309 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func TestValidateEtcdCluster(t *testing.T) {
+	tests := []struct {
+		name             string
+		mutate           func(ec *ecv1alpha1.EtcdCluster)
+		expectedErrors   []string
+		expectedWarnings int
+	}{
+		{
+			name:   "valid cluster",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {},
+		},
+		{
+			name:           "size out of range",
+			mutate:         func(ec *ecv1alpha1.EtcdCluster) { ec.Spec.Size = 9 },
+			expectedErrors: []string{"spec.size"},
+		},
+		{
+			name:           "same client and peer ports",
+			mutate:         func(ec *ecv1alpha1.EtcdCluster) { ec.Spec.Ports.Peer = ec.Spec.Ports.Client },
+			expectedErrors: []string{"spec.ports"},
+		},
+		{
+			name: "shared volume without a PVC",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{
+					AccessModes:       "ReadWriteMany",
+					VolumeSizeRequest: resource.MustParse("2Gi"),
+					VolumeSizeLimit:   resource.MustParse("1Gi"),
+				}
+			},
+			expectedErrors: []string{"spec.storageSpec.pvcName", "spec.storageSpec.volumeSizeLimit"},
+		},
+		{
+			name: "invalid service monitor",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Monitoring = &ecv1alpha1.Monitoring{ServiceMonitor: &ecv1alpha1.ServiceMonitorSpec{
+					Interval: &metav1.Duration{Duration: 500 * time.Millisecond},
+					Labels:   map[string]string{"release": "-prometheus"},
+				}}
+			},
+			expectedErrors: []string{"spec.monitoring.serviceMonitor.interval", "spec.monitoring.serviceMonitor.labels"},
+		},
+		{
+			name: "invalid adoption",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.TLS = &ecv1alpha1.TLSCertificate{Provider: ecv1alpha1.TLSProviderAuto}
+				ec.Spec.Adoption = &ecv1alpha1.Adoption{Endpoints: []string{"http://etcd-0.etcd:2379", "etcd-1.etcd:2379"}}
+			},
+			expectedErrors: []string{"spec.adoption.endpoints[1]", "spec.adoption"},
+		},
+		{
+			name: "load balancer client service",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.ClientService = &ecv1alpha1.ClientService{
+					Type:                     corev1.ServiceTypeLoadBalancer,
+					SessionAffinity:          corev1.ServiceAffinityClientIP,
+					Annotations:              map[string]string{"external-dns.alpha.kubernetes.io/hostname": "etcd.example.com"},
+					LoadBalancerSourceRanges: []string{"10.0.0.0/8"},
+					ExtraPorts:               []ecv1alpha1.ClientServicePort{{Name: "grpc-proxy", Port: 23790}},
+				}
+			},
+		},
+		{
+			name: "invalid client service",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.ClientService = &ecv1alpha1.ClientService{
+					Type:                     corev1.ServiceTypeClusterIP,
+					SessionAffinity:          corev1.ServiceAffinityNone,
+					NodePort:                 30379,
+					LoadBalancerSourceRanges: []string{"10.0.0.0"},
+					ExtraPorts: []ecv1alpha1.ClientServicePort{
+						{Name: "client", Port: 2379},
+						{Name: "Metrics_Port", Port: 2381},
+					},
+				}
+			},
+			expectedErrors: []string{
+				"spec.clientService.nodePort",
+				"spec.clientService.loadBalancerSourceRanges",
+				"spec.clientService.loadBalancerSourceRanges[0]",
+				"spec.clientService.extraPorts[0].name",
+				"spec.clientService.extraPorts[0].port",
+				"spec.clientService.extraPorts[1].name",
+			},
+		},
+		{
+			name: "invalid member services",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.MemberServices = &ecv1alpha1.MemberServices{
+					Type:        corev1.ServiceTypeExternalName,
+					Annotations: map[string]string{"external-dns.alpha.kubernetes.io/hostname": "$(MEMBER_NAME).etcd.example.com"},
+					Domain:      "Etcd.example.com",
+				}
+				ec.Spec.Adoption = &ecv1alpha1.Adoption{Endpoints: []string{"http://etcd-0.etcd:2379"}}
+			},
+			expectedErrors: []string{"spec.memberServices.type", "spec.memberServices.domain", "spec.memberServices.domain"},
+		},
+		{
+			name: "invalid grpc proxy",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.GRPCProxy = &ecv1alpha1.GRPCProxy{Replicas: ptr.To[int32](-1), Port: 70000}
+			},
+			expectedErrors: []string{"spec.grpcProxy.replicas", "spec.grpcProxy.port"},
+		},
+		{
+			name: "invalid gateway",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Gateway = &ecv1alpha1.Gateway{Replicas: ptr.To[int32](-1), Port: 70000}
+			},
+			expectedErrors: []string{"spec.gateway.replicas", "spec.gateway.port"},
+		},
+		{
+			name: "prometheus rule without service monitor",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Monitoring = &ecv1alpha1.Monitoring{PrometheusRule: &ecv1alpha1.PrometheusRuleSpec{
+					AlertLabels: map[string]string{"team": "-storage"},
+				}}
+			},
+			expectedErrors: []string{"spec.monitoring.serviceMonitor", "spec.monitoring.prometheusRule.alertLabels"},
+		},
+		{
+			name: "ephemeral storage",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.EphemeralStorage = &ecv1alpha1.EphemeralStorage{Medium: corev1.StorageMediumMemory, SizeLimit: ptr.To(resource.MustParse("1Gi"))}
+			},
+			expectedWarnings: 1,
+		},
+		{
+			name: "ephemeral and persistent storage",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{AccessModes: corev1.ReadWriteOnce, VolumeSizeRequest: resource.MustParse("1Gi"), VolumeSizeLimit: resource.MustParse("1Gi")}
+				ec.Spec.EphemeralStorage = &ecv1alpha1.EphemeralStorage{Medium: "HugePages", SizeLimit: ptr.To(resource.MustParse("0"))}
+			},
+			expectedErrors:   []string{"spec.ephemeralStorage", "spec.ephemeralStorage.medium", "spec.ephemeralStorage.sizeLimit"},
+			expectedWarnings: 1,
+		},
+		{
+			name:           "unknown deletion policy",
+			mutate:         func(ec *ecv1alpha1.EtcdCluster) { ec.Spec.DeletionPolicy = "Keep" },
+			expectedErrors: []string{"spec.deletionPolicy"},
+		},
+		{
+			name: "short member failure threshold",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.MemberReplacement = &ecv1alpha1.MemberReplacement{FailureThreshold: &metav1.Duration{Duration: 30 * time.Second}}
+			},
+			expectedErrors: []string{"spec.memberReplacement.failureThreshold"},
+		},
+		{
+			name: "short graceful shutdown timeout",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.PodTemplate = &ecv1alpha1.PodTemplate{GracefulShutdown: &ecv1alpha1.GracefulShutdown{Timeout: &metav1.Duration{}}}
+			},
+			expectedErrors: []string{"spec.podTemplate.gracefulShutdown.timeout"},
+		},
+		{
+			name: "quorum recovery without storage",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.QuorumRecovery = &ecv1alpha1.QuorumRecovery{Source: "Snapshot"}
+			},
+			expectedErrors: []string{"spec.quorumRecovery.source", "spec.storageSpec"},
+		},
+		{
+			name: "write-ahead log replay without a backup",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.QuorumRecovery = &ecv1alpha1.QuorumRecovery{Source: ecv1alpha1.QuorumRecoverySourceMember, ReplayWAL: true}
+			},
+			expectedErrors: []string{"spec.quorumRecovery.replayWAL", "spec.storageSpec"},
+		},
+		{
+			name: "invalid defrag schedule",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Maintenance = &ecv1alpha1.Maintenance{DefragSchedule: "0 3 * *"}
+			},
+			expectedErrors: []string{"spec.maintenance.defragSchedule"},
+		},
+		{
+			name: "invalid local snapshots schedule without storage",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Maintenance = &ecv1alpha1.Maintenance{LocalSnapshots: &ecv1alpha1.LocalSnapshots{Schedule: "hourly", Keep: 3}}
+			},
+			expectedErrors: []string{"spec.storageSpec", "spec.maintenance.localSnapshots.schedule"},
+		},
+		{
+			name: "heartbeat interval beyond the default election timeout",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Tuning = &ecv1alpha1.EtcdTuning{
+					QuotaBackendBytes:       ptr.To(resource.MustParse("8Gi")),
+					AutoCompactionMode:      ecv1alpha1.AutoCompactionModeRevision,
+					AutoCompactionRetention: "1000",
+					HeartbeatInterval:       &metav1.Duration{Duration: 250 * time.Millisecond},
+				}
+			},
+			expectedErrors: []string{"spec.tuning.heartbeatInterval"},
+		},
+		{
+			name: "invalid tuning",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Tuning = &ecv1alpha1.EtcdTuning{
+					QuotaBackendBytes:       ptr.To(resource.MustParse("0")),
+					AutoCompactionRetention: "1 hour",
+					SnapshotCount:           ptr.To[int64](0),
+					ElectionTimeout:         &metav1.Duration{Duration: time.Minute},
+					MaxRequestBytes:         ptr.To(resource.MustParse("-1")),
+				}
+			},
+			expectedErrors: []string{
+				"spec.tuning.quotaBackendBytes", "spec.tuning.maxRequestBytes", "spec.tuning.autoCompactionRetention",
+				"spec.tuning.snapshotCount", "spec.tuning.electionTimeout",
+			},
+		},
+		{
+			name: "auto compaction mode without retention",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Tuning = &ecv1alpha1.EtcdTuning{AutoCompactionMode: ecv1alpha1.AutoCompactionModePeriodic}
+			},
+			expectedErrors: []string{"spec.tuning.autoCompactionRetention"},
+		},
+		{
+			name: "tuning repeated in the etcd options",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Tuning = &ecv1alpha1.EtcdTuning{SnapshotCount: ptr.To[int64](10000)}
+				ec.Spec.EtcdOptions = []string{"--max-wals=7", "--snapshot-count 5000"}
+			},
+			expectedErrors: []string{"spec.etcdOptions[1]"},
+		},
+		{
+			name: "extra arguments overriding the operator",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Tuning = &ecv1alpha1.EtcdTuning{SnapshotCount: ptr.To[int64](10000)}
+				ec.Spec.PodTemplate.ExtraArgs = []string{
+					"--experimental-initial-corrupt-check=true", "--data-dir=/tmp", "-name etcd", "--snapshot-count=5000", "debug",
+				}
+			},
+			expectedErrors: []string{
+				"spec.podTemplate.extraArgs[1]", "spec.podTemplate.extraArgs[2]", "spec.podTemplate.extraArgs[3]", "spec.podTemplate.extraArgs[4]",
+			},
+		},
+		{
+			name: "env overriding the operator",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.PodTemplate.Env = []corev1.EnvVar{
+					{Name: "GOMAXPROCS", Value: "2"}, {Name: "ETCD_DATA_DIR", Value: "/tmp"}, {Name: "POD_NAME", Value: "etcd"},
+				}
+			},
+			expectedErrors: []string{"spec.podTemplate.env[1].name", "spec.podTemplate.env[2].name"},
+		},
+		{
+			name: "unsupported extra argument",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.PodTemplate.ExtraArgs = []string{"--debug"}
+			},
+			expectedErrors: []string{"spec.podTemplate.extraArgs[0]"},
+		},
+		{
+			name:           "unsupported etcd option",
+			mutate:         func(ec *ecv1alpha1.EtcdCluster) { ec.Spec.EtcdOptions = []string{"--debug"} },
+			expectedErrors: []string{"spec.etcdOptions[0]"},
+		},
+		{
+			name: "as many learners as voting members",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.EtcdOptions = []string{"--experimental-max-learners=2", "--experimental-max-learners 3"}
+			},
+			expectedErrors: []string{"spec.etcdOptions[1]"},
+		},
+		{
+			name: "deprecated etcd option",
+			mutate: func(ec *ecv1alpha1.EtcdCluster) {
+				ec.Spec.Version = "v3.6.0"
+				ec.Spec.EtcdOptions = []string{"--experimental-max-learners=2"}
+			},
+			expectedWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &ecv1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+				Spec:       ecv1alpha1.EtcdClusterSpec{Size: 3},
+			}
+			ecv1alpha1.SetEtcdClusterDefaults(ec)
+			tt.mutate(ec)
+
+			errs, warnings := ValidateEtcdCluster(ec)
+			assert.Len(t, warnings, tt.expectedWarnings)
+			assert.Len(t, errs, len(tt.expectedErrors))
+			for i, expected := range tt.expectedErrors {
+				assert.Equal(t, expected, errs[i].Field)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+// Package walreplay restores an etcd snapshot along with the write-ahead log
+// retained by a member, replaying the entries of the log the snapshot
+// misses: the quorum recovery Jobs run it to recover the writes committed
+// since the backup they restore, which `etcdutl snapshot restore` drops.
+package walreplay
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/client/pkg/v3/types"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/membership"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+)
+
+// startTimeout bounds the replay of the log by the etcd server.
+const startTimeout = 5 * time.Minute
+
+// Options configures Replay.
+type Options struct {
+	// Snapshot is the snapshot to restore, saved by `etcdctl snapshot save`.
+	Snapshot string
+	// Source is the member directory, holding the wal and snap directories,
+	// of the member whose log is replayed.
+	Source string
+	// DataDir is the data directory the snapshot is restored to. It must
+	// not exist.
+	DataDir string
+	// Name is the name of the member restarted from DataDir.
+	Name string
+	// PeerURLs are the peer URLs of the member restarted from DataDir.
+	PeerURLs []string
+	// Logger logs the replay. Nothing is logged when nil.
+	Logger *zap.Logger
+}
+
+// Replay restores opts.Snapshot to opts.DataDir, with the log of
+// opts.Source, then starts an etcd server on it with --force-new-cluster:
+// the server replays the committed entries of the log past the snapshot,
+// and becomes the single member of the cluster, with the name and the peer
+// URLs of opts. It fails when the log doesn't reach back to the snapshot,
+// or ends before it.
+func Replay(opts Options) error {
+	lg := opts.Logger
+	if lg == nil {
+		lg = zap.NewNop()
+	}
+	if _, err := os.Stat(opts.DataDir); err == nil {
+		return fmt.Errorf("data directory %s already exists", opts.DataDir)
+	}
+	peerURLs, err := types.NewURLs(opts.PeerURLs)
+	if err != nil {
+		return fmt.Errorf("invalid peer URLs: %w", err)
+	}
+
+	memberDir := filepath.Join(opts.DataDir, "member")
+	if err := os.MkdirAll(filepath.Join(memberDir, "snap"), 0o700); err != nil {
+		return err
+	}
+	db := filepath.Join(memberDir, "snap", "db")
+	if err := copySnapshot(opts.Snapshot, db); err != nil {
+		return err
+	}
+	index, members, err := readBackend(db)
+	if err != nil {
+		return err
+	}
+	snap, err := prepareLog(lg, opts.Source, memberDir, index, members)
+	if err != nil {
+		return err
+	}
+	lg.Info("replaying the write-ahead log", zap.Uint64("snapshot-index", index), zap.Uint64("log-snapshot-index", snap.Index))
+	return startNewCluster(lg, opts.DataDir, opts.Name, peerURLs)
+}
+
+// copySnapshot copies the snapshot at src to dst, after checking the SHA-256
+// appended to it by `etcdctl snapshot save`, which is left out.
+func copySnapshot(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size%512 == sha256.Size {
+		size -= sha256.Size
+		h := sha256.New()
+		if _, err := io.CopyN(h, f, size); err != nil {
+			return err
+		}
+		sum := make([]byte, sha256.Size)
+		if _, err := io.ReadFull(f, sum); err != nil {
+			return err
+		}
+		if !bytes.Equal(sum, h.Sum(nil)) {
+			return errors.New("the snapshot doesn't match its SHA-256")
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(out, f, size); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// readBackend returns the raft index of the last entry applied to the
+// database at path, and the IDs of the members it records.
+func readBackend(path string) (uint64, map[types.ID]bool, error) {
+	db, err := bolt.Open(path, 0o400, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer db.Close()
+
+	var index uint64
+	members := map[types.ID]bool{}
+	err = db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket([]byte("meta"))
+		if meta == nil {
+			return errors.New("the snapshot has no consistent index")
+		}
+		if v := meta.Get([]byte("consistent_index")); len(v) == 8 {
+			index = binary.BigEndian.Uint64(v)
+		}
+		if b := tx.Bucket([]byte("members")); b != nil {
+			return b.ForEach(func(k, _ []byte) error {
+				id, err := strconv.ParseUint(string(k), 16, 64)
+				if err != nil {
+					return fmt.Errorf("invalid member ID %q in the snapshot: %w", k, err)
+				}
+				members[types.ID(id)] = true
+				return nil
+			})
+		}
+		return nil
+	})
+	return index, members, err
+}
+
+// prepareLog copies the log of the member directory source to memberDir,
+// along with the newest raft snapshot it records at or before index, the
+// raft index of the restored database, and returns that raft snapshot. The
+// log must be committed up to index, by one of members.
+func prepareLog(lg *zap.Logger, source, memberDir string, index uint64, members map[types.ID]bool) (walpb.Snapshot, error) {
+	srcWAL := filepath.Join(source, "wal")
+	snaps, err := wal.ValidSnapshotEntries(lg, srcWAL)
+	if err != nil {
+		return walpb.Snapshot{}, fmt.Errorf("failed to read the write-ahead log: %w", err)
+	}
+	var snap walpb.Snapshot
+	found := false
+	for _, s := range snaps {
+		if s.Index > index || (found && s.Index < snap.Index) {
+			continue
+		}
+		if s.Index > 0 {
+			if _, err := os.Stat(filepath.Join(source, "snap", snapName(s))); err != nil {
+				continue
+			}
+		}
+		snap, found = s, true
+	}
+	if !found {
+		return walpb.Snapshot{}, fmt.Errorf("the write-ahead log doesn't reach back to the snapshot, at raft index %d", index)
+	}
+
+	w, err := wal.OpenForRead(lg, srcWAL, snap)
+	if err != nil {
+		return walpb.Snapshot{}, fmt.Errorf("failed to open the write-ahead log: %w", err)
+	}
+	metadata, state, _, err := w.ReadAll()
+	w.Close()
+	if err != nil {
+		return walpb.Snapshot{}, fmt.Errorf("failed to read the write-ahead log: %w", err)
+	}
+	var md etcdserverpb.Metadata
+	if err := md.Unmarshal(metadata); err != nil {
+		return walpb.Snapshot{}, fmt.Errorf("invalid write-ahead log metadata: %w", err)
+	}
+	if !members[types.ID(md.NodeID)] {
+		return walpb.Snapshot{}, fmt.Errorf("member %s of the write-ahead log isn't a member of the snapshot", types.ID(md.NodeID))
+	}
+	if state.Commit < index {
+		return walpb.Snapshot{}, fmt.Errorf("the write-ahead log is committed up to raft index %d, before the snapshot, at %d", state.Commit, index)
+	}
+
+	if err := copyDir(srcWAL, filepath.Join(memberDir, "wal")); err != nil {
+		return walpb.Snapshot{}, err
+	}
+	if snap.Index > 0 {
+		name := snapName(snap)
+		if err := copyFile(filepath.Join(source, "snap", name), filepath.Join(memberDir, "snap", name)); err != nil {
+			return walpb.Snapshot{}, err
+		}
+	}
+	return snap, nil
+}
+
+// snapName returns the name of the file of the raft snapshot s.
+func snapName(s walpb.Snapshot) string {
+	return fmt.Sprintf("%016x-%016x.snap", s.Term, s.Index)
+}
+
+// startNewCluster starts an etcd server on dataDir with --force-new-cluster,
+// waits for it to apply the log, sets the peer URLs of its member, and stops
+// it. It only listens on the loopback interface.
+func startNewCluster(lg *zap.Logger, dataDir, name string, peerURLs types.URLs) error {
+	local, _ := url.Parse("http://127.0.0.1:0")
+	cfg := embed.NewConfig()
+	cfg.Name = name
+	cfg.Dir = dataDir
+	cfg.ForceNewCluster = true
+	cfg.ListenPeerUrls = []url.URL{*local}
+	cfg.ListenClientUrls = []url.URL{*local}
+	cfg.AdvertisePeerUrls = []url.URL{*local}
+	cfg.AdvertiseClientUrls = []url.URL{*local}
+	cfg.ZapLoggerBuilder = embed.NewZapLoggerBuilder(lg)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to start etcd: %w", err)
+	}
+	defer e.Close()
+	select {
+	case <-e.Server.ReadyNotify():
+	case err := <-e.Err():
+		return fmt.Errorf("etcd failed: %w", err)
+	case <-time.After(startTimeout):
+		return errors.New("timed out replaying the write-ahead log")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err = e.Server.UpdateMember(ctx, membership.Member{
+		ID:             e.Server.ID(),
+		RaftAttributes: membership.RaftAttributes{PeerURLs: peerURLs.StringSlice()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update the peer URLs of the member: %w", err)
+	}
+	return nil
+}
+
+// copyDir copies the files of the directory src to the new directory dst.
+func copyDir(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(dst, 0o700); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies the file src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,126 @@
+package walreplay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/v3client"
+)
+
+func startEtcd(t *testing.T, dir string) *embed.Etcd {
+	local, _ := url.Parse("http://127.0.0.1:0")
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	cfg.ListenPeerUrls = []url.URL{*local}
+	cfg.ListenClientUrls = []url.URL{*local}
+	cfg.AdvertiseClientUrls = []url.URL{*local}
+	cfg.AdvertisePeerUrls = []url.URL{*local}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("Failed to start etcd server: %v", err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(60 * time.Second):
+		e.Close()
+		t.Fatalf("Server took too long to start")
+	}
+	return e
+}
+
+func put(t *testing.T, e *embed.Etcd, keys ...string) {
+	c := v3client.New(e.Server)
+	defer c.Close()
+	for _, key := range keys {
+		_, err := c.Put(context.Background(), key, "value")
+		assert.NoError(t, err)
+	}
+}
+
+func saveSnapshot(t *testing.T, e *embed.Etcd, path string) {
+	c, err := clientv3.New(clientv3.Config{Endpoints: []string{e.Clients[0].Addr().String()}})
+	assert.NoError(t, err)
+	defer c.Close()
+	rc, err := c.Snapshot(context.Background())
+	assert.NoError(t, err)
+	defer rc.Close()
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	_, err = io.Copy(f, rc)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	e := startEtcd(t, source)
+	put(t, e, "before")
+	saveSnapshot(t, e, filepath.Join(dir, "snapshot.db"))
+	put(t, e, "after")
+	e.Close()
+
+	// A snapshot more recent than the log of the source.
+	other := startEtcd(t, filepath.Join(dir, "other"))
+	for i := range 20 {
+		put(t, other, fmt.Sprintf("other-%d", i))
+	}
+	saveSnapshot(t, other, filepath.Join(dir, "other.db"))
+	other.Close()
+
+	restored := filepath.Join(dir, "restored")
+	peerURL := "http://my-etcd-0.my-etcd.default.svc:2380"
+	err := Replay(Options{
+		Snapshot: filepath.Join(dir, "snapshot.db"),
+		Source:   filepath.Join(source, "member"),
+		DataDir:  restored,
+		Name:     "my-etcd-0",
+		PeerURLs: []string{peerURL},
+	})
+	assert.NoError(t, err)
+
+	e = startEtcd(t, restored)
+	defer e.Close()
+	c := v3client.New(e.Server)
+	defer c.Close()
+	for _, key := range []string{"before", "after"} {
+		resp, err := c.Get(context.Background(), key)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), resp.Count, key)
+	}
+	members, err := c.MemberList(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, members.Members, 1) {
+		assert.Equal(t, []string{peerURL}, members.Members[0].PeerURLs)
+	}
+
+	err = Replay(Options{
+		Snapshot: filepath.Join(dir, "other.db"),
+		Source:   filepath.Join(source, "member"),
+		DataDir:  filepath.Join(dir, "other-restored"),
+		Name:     "my-etcd-0",
+		PeerURLs: []string{peerURL},
+	})
+	assert.Error(t, err)
+
+	err = Replay(Options{
+		Snapshot: filepath.Join(dir, "snapshot.db"),
+		Source:   filepath.Join(source, "member"),
+		DataDir:  restored,
+		Name:     "my-etcd-0",
+		PeerURLs: []string{peerURL},
+	})
+	assert.ErrorContains(t, err, "already exists")
+}
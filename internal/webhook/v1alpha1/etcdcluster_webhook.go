@@ -0,0 +1,248 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/internal/validation"
+)
+
+// log is for logging in this package.
+var etcdclusterlog = logf.Log.WithName("etcdcluster-resource")
+
+// SetupEtcdClusterWebhookWithManager registers the webhook for EtcdCluster in the manager.
+func SetupEtcdClusterWebhookWithManager(mgr ctrl.Manager, defaultTemplate func() string) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&operatorv1alpha1.EtcdCluster{}).
+		WithValidator(&EtcdClusterCustomValidator{Client: mgr.GetClient()}).
+		WithDefaulter(&EtcdClusterCustomDefaulter{DefaultTemplate: defaultTemplate}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-operator-etcd-io-v1alpha1-etcdcluster,mutating=true,failurePolicy=fail,sideEffects=None,groups=operator.etcd.io,resources=etcdclusters,verbs=create;update,versions=v1alpha1,name=metcdcluster-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// EtcdClusterCustomDefaulter sets default values on the EtcdCluster resource
+// when it is created or updated.
+type EtcdClusterCustomDefaulter struct {
+	// DefaultTemplate returns the name of the EtcdClusterTemplate set on the
+	// EtcdClusters created without a templateRef, if any.
+	DefaultTemplate func() string
+}
+
+var _ webhook.CustomDefaulter = &EtcdClusterCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind EtcdCluster.
+func (d *EtcdClusterCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	etcdcluster, ok := obj.(*operatorv1alpha1.EtcdCluster)
+	if !ok {
+		return fmt.Errorf("expected an EtcdCluster object but got %T", obj)
+	}
+	etcdclusterlog.Info("Defaulting for EtcdCluster", "name", etcdcluster.GetName())
+
+	// A size of 0 on an existing cluster is a deliberate choice, so only
+	// default the size of clusters that are being created.
+	if etcdcluster.Spec.Size == 0 && isCreate(ctx) {
+		etcdcluster.Spec.Size = operatorv1alpha1.DefaultClusterSize
+	}
+	if etcdcluster.Spec.TemplateRef == nil && d.DefaultTemplate != nil && isCreate(ctx) {
+		if name := d.DefaultTemplate(); name != "" {
+			etcdcluster.Spec.TemplateRef = &operatorv1alpha1.EtcdClusterTemplateReference{Name: name}
+		}
+	}
+
+	// The unset fields of a cluster referencing a template are filled in by
+	// the operator from the template, so that the cluster follows the
+	// changes of the template.
+	if etcdcluster.Spec.TemplateRef != nil {
+		return nil
+	}
+
+	operatorv1alpha1.SetEtcdClusterDefaults(etcdcluster)
+	return nil
+}
+
+// isCreate reports whether the admission request carried by ctx creates the object.
+func isCreate(ctx context.Context) bool {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return false
+	}
+	return req.Operation == admissionv1.Create
+}
+
+// +kubebuilder:webhook:path=/validate-operator-etcd-io-v1alpha1-etcdcluster,mutating=false,failurePolicy=fail,sideEffects=None,groups=operator.etcd.io,resources=etcdclusters,verbs=create;update,versions=v1alpha1,name=vetcdcluster-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// +kubebuilder:rbac:groups=operator.etcd.io,resources=etcdoperatorpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// EtcdClusterCustomValidator validates the EtcdCluster resource when it is
+// created or updated.
+type EtcdClusterCustomValidator struct {
+	// Client reads the EtcdOperatorPolicies, the Namespaces they select, and
+	// the EtcdClusterTemplates and EtcdClusterOverrides applying to the
+	// validated clusters.
+	Client client.Reader
+}
+
+var _ webhook.CustomValidator = &EtcdClusterCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type EtcdCluster.
+func (v *EtcdClusterCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	etcdcluster, ok := obj.(*operatorv1alpha1.EtcdCluster)
+	if !ok {
+		return nil, fmt.Errorf("expected an EtcdCluster object but got %T", obj)
+	}
+	etcdclusterlog.Info("Validation for EtcdCluster upon creation", "name", etcdcluster.GetName())
+
+	ec, err := v.Resolve(ctx, etcdcluster)
+	if err != nil {
+		return nil, err
+	}
+
+	errs, specWarnings := validation.ValidateEtcdCluster(ec)
+	warnings := admission.Warnings(specWarnings)
+	policyErrs, err := v.validatePolicies(ctx, ec)
+	if err != nil {
+		return warnings, err
+	}
+	errs = append(errs, policyErrs...)
+	if len(errs) > 0 {
+		return warnings, apierrors.NewInvalid(operatorv1alpha1.GroupVersion.WithKind("EtcdCluster").GroupKind(), etcdcluster.Name, errs)
+	}
+	return warnings, nil
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type EtcdCluster.
+func (v *EtcdClusterCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	etcdcluster, ok := newObj.(*operatorv1alpha1.EtcdCluster)
+	if !ok {
+		return nil, fmt.Errorf("expected an EtcdCluster object for the newObj but got %T", newObj)
+	}
+	oldEtcdcluster, ok := oldObj.(*operatorv1alpha1.EtcdCluster)
+	if !ok {
+		return nil, fmt.Errorf("expected an EtcdCluster object for the oldObj but got %T", oldObj)
+	}
+	etcdclusterlog.Info("Validation for EtcdCluster upon update", "name", etcdcluster.GetName())
+
+	// Objects created before the defaulting webhook was deployed, or
+	// referencing a template, may not carry the defaults, so compare the
+	// resolved forms of both objects.
+	newEc, err := v.Resolve(ctx, etcdcluster)
+	if err != nil {
+		return nil, err
+	}
+	oldEc, err := v.Resolve(ctx, oldEtcdcluster)
+	if err != nil {
+		return nil, err
+	}
+
+	errs, specWarnings := validation.ValidateEtcdCluster(newEc)
+	updateErrs, updateWarnings := validation.ValidateEtcdClusterUpdate(newEc, oldEc)
+	errs = append(errs, updateErrs...)
+	warnings := admission.Warnings(append(specWarnings, updateWarnings...))
+	policyErrs, err := v.validatePolicies(ctx, newEc)
+	if err != nil {
+		return warnings, err
+	}
+	errs = append(errs, policyErrs...)
+	if len(errs) > 0 {
+		return warnings, apierrors.NewInvalid(operatorv1alpha1.GroupVersion.WithKind("EtcdCluster").GroupKind(), etcdcluster.Name, errs)
+	}
+	return warnings, nil
+}
+
+// Resolve returns a copy of ec with the values of its template, if it still
+// exists, its overrides and the defaults filled in, as the operator sees it.
+func (v *EtcdClusterCustomValidator) Resolve(ctx context.Context, ec *operatorv1alpha1.EtcdCluster) (*operatorv1alpha1.EtcdCluster, error) {
+	resolved := ec.DeepCopy()
+	if ref := ec.Spec.TemplateRef; ref != nil {
+		tmpl := &operatorv1alpha1.EtcdClusterTemplate{}
+		err := v.Client.Get(ctx, client.ObjectKey{Name: ref.Name}, tmpl)
+		switch {
+		case err == nil:
+			operatorv1alpha1.ApplyEtcdClusterTemplate(resolved, tmpl)
+		case !apierrors.IsNotFound(err):
+			// A missing template is reported by the operator on the
+			// EtcdCluster, it doesn't have to block admission.
+			return nil, fmt.Errorf("failed to get EtcdClusterTemplate %s: %w", ref.Name, err)
+		}
+	}
+
+	overrides := &operatorv1alpha1.EtcdClusterOverrideList{}
+	if err := v.Client.List(ctx, overrides, client.InNamespace(ec.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list EtcdClusterOverrides: %w", err)
+	}
+	if _, err := operatorv1alpha1.ApplyEtcdClusterOverrides(resolved, overrides.Items); err != nil {
+		return nil, err
+	}
+
+	operatorv1alpha1.SetEtcdClusterDefaults(resolved)
+	return resolved, nil
+}
+
+// validatePolicies checks ec against the EtcdOperatorPolicies selecting its
+// namespace.
+func (v *EtcdClusterCustomValidator) validatePolicies(ctx context.Context, ec *operatorv1alpha1.EtcdCluster) (field.ErrorList, error) {
+	policies := &operatorv1alpha1.EtcdOperatorPolicyList{}
+	if err := v.Client.List(ctx, policies); err != nil {
+		return nil, fmt.Errorf("failed to list EtcdOperatorPolicies: %w", err)
+	}
+	if len(policies.Items) == 0 {
+		return nil, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: ec.Namespace}, ns); err != nil {
+		return nil, fmt.Errorf("failed to get namespace %s: %w", ec.Namespace, err)
+	}
+
+	var errs field.ErrorList
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		if policy.Spec.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(policy.Spec.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid namespaceSelector in EtcdOperatorPolicy %s: %w", policy.Name, err)
+			}
+			if !selector.Matches(labels.Set(ns.Labels)) {
+				continue
+			}
+		}
+		errs = append(errs, operatorv1alpha1.ValidateEtcdClusterPolicy(ec, policy)...)
+	}
+	return errs, nil
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type EtcdCluster.
+func (v *EtcdClusterCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
@@ -0,0 +1,648 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+func admissionContext(op admissionv1.Operation) context.Context {
+	return admission.NewContextWithRequest(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Operation: op},
+	})
+}
+
+func newValidator(objs ...client.Object) *EtcdClusterCustomValidator {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = operatorv1alpha1.AddToScheme(scheme)
+	return &EtcdClusterCustomValidator{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+	}
+}
+
+func TestEtcdClusterDefault(t *testing.T) {
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		spec         operatorv1alpha1.EtcdClusterSpec
+		expectedSize int
+	}{
+		{
+			name:         "size is defaulted on create",
+			ctx:          admissionContext(admissionv1.Create),
+			expectedSize: operatorv1alpha1.DefaultClusterSize,
+		},
+		{
+			name:         "explicit size is kept on create",
+			ctx:          admissionContext(admissionv1.Create),
+			spec:         operatorv1alpha1.EtcdClusterSpec{Size: 1},
+			expectedSize: 1,
+		},
+		{
+			name:         "size 0 is kept on update",
+			ctx:          admissionContext(admissionv1.Update),
+			expectedSize: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &operatorv1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+				Spec:       tt.spec,
+			}
+
+			defaulter := &EtcdClusterCustomDefaulter{}
+			assert.NoError(t, defaulter.Default(tt.ctx, ec))
+
+			assert.Equal(t, tt.expectedSize, ec.Spec.Size)
+			assert.Equal(t, operatorv1alpha1.DefaultEtcdVersion, ec.Spec.Version)
+			assert.Equal(t, operatorv1alpha1.DefaultClientPort, ec.Spec.Ports.Client)
+			assert.Equal(t, operatorv1alpha1.DefaultPeerPort, ec.Spec.Ports.Peer)
+			assert.NotNil(t, ec.Spec.PodTemplate.LivenessProbe)
+			assert.NotNil(t, ec.Spec.PodTemplate.ReadinessProbe)
+			assert.NotNil(t, ec.Spec.PodTemplate.Scheduling.Affinity.PodAntiAffinity)
+		})
+	}
+}
+
+func TestEtcdClusterDefaultKeepsUserValues(t *testing.T) {
+	probe := &corev1.Probe{PeriodSeconds: 42}
+	ec := &operatorv1alpha1.EtcdCluster{
+		Spec: operatorv1alpha1.EtcdClusterSpec{
+			Size:    5,
+			Version: "v3.6.0",
+			Ports:   &operatorv1alpha1.EtcdPorts{Client: 3379},
+			StorageSpec: &operatorv1alpha1.StorageSpec{
+				VolumeSizeRequest: resource.MustParse("2Gi"),
+			},
+			PodTemplate: &operatorv1alpha1.PodTemplate{
+				ReadinessProbe: probe,
+				Scheduling:     &operatorv1alpha1.PodScheduling{Affinity: &corev1.Affinity{}},
+			},
+		},
+	}
+
+	defaulter := &EtcdClusterCustomDefaulter{}
+	assert.NoError(t, defaulter.Default(admissionContext(admissionv1.Create), ec))
+
+	assert.Equal(t, 5, ec.Spec.Size)
+	assert.Equal(t, "v3.6.0", ec.Spec.Version)
+	assert.Equal(t, int32(3379), ec.Spec.Ports.Client)
+	assert.Equal(t, operatorv1alpha1.DefaultPeerPort, ec.Spec.Ports.Peer)
+	assert.Equal(t, corev1.ReadWriteOnce, ec.Spec.StorageSpec.AccessModes)
+	assert.True(t, ec.Spec.StorageSpec.VolumeSizeLimit.Equal(resource.MustParse("2Gi")))
+	assert.Same(t, probe, ec.Spec.PodTemplate.ReadinessProbe)
+	assert.Equal(t, int32(3379), ec.Spec.PodTemplate.LivenessProbe.HTTPGet.Port.IntVal)
+	// An empty affinity opts out of the default anti-affinity.
+	assert.Equal(t, &corev1.Affinity{}, ec.Spec.PodTemplate.Scheduling.Affinity)
+}
+
+func TestEtcdClusterDefaultTLSProvider(t *testing.T) {
+	ec := &operatorv1alpha1.EtcdCluster{
+		Spec: operatorv1alpha1.EtcdClusterSpec{TLS: &operatorv1alpha1.TLSCertificate{}},
+	}
+
+	defaulter := &EtcdClusterCustomDefaulter{}
+	assert.NoError(t, defaulter.Default(admissionContext(admissionv1.Create), ec))
+	assert.Equal(t, operatorv1alpha1.TLSProviderAuto, ec.Spec.TLS.Provider)
+}
+
+func TestEtcdClusterDefaultCertManager(t *testing.T) {
+	ec := &operatorv1alpha1.EtcdCluster{
+		Spec: operatorv1alpha1.EtcdClusterSpec{TLS: &operatorv1alpha1.TLSCertificate{
+			Provider: operatorv1alpha1.TLSProviderCertManager,
+			ProviderCfg: operatorv1alpha1.ProviderConfig{
+				CertManagerCfg: &operatorv1alpha1.ProviderCertManagerConfig{
+					IssuerRef: operatorv1alpha1.CertManagerIssuerReference{Name: "etcd-ca"},
+				},
+			},
+		}},
+	}
+
+	defaulter := &EtcdClusterCustomDefaulter{}
+	assert.NoError(t, defaulter.Default(admissionContext(admissionv1.Create), ec))
+	issuerRef := ec.Spec.TLS.ProviderCfg.CertManagerCfg.IssuerRef
+	assert.Equal(t, "Issuer", issuerRef.Kind)
+	assert.Equal(t, "cert-manager.io", issuerRef.Group)
+	// The probes use the plain HTTP metrics port, as the client port
+	// requires a client certificate.
+	assert.Equal(t, operatorv1alpha1.DefaultMetricsPort, ec.Spec.PodTemplate.LivenessProbe.HTTPGet.Port.IntVal)
+}
+
+func TestEtcdClusterDefaultRejectsOtherKinds(t *testing.T) {
+	defaulter := &EtcdClusterCustomDefaulter{}
+	assert.Error(t, defaulter.Default(context.Background(), &corev1.Pod{}))
+}
+
+func TestEtcdClusterValidateUpdate(t *testing.T) {
+	base := func() *operatorv1alpha1.EtcdCluster {
+		return &operatorv1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+			Spec: operatorv1alpha1.EtcdClusterSpec{
+				Size:    3,
+				Version: "v3.5.21",
+				StorageSpec: &operatorv1alpha1.StorageSpec{
+					StorageClassName:  "standard",
+					VolumeSizeRequest: resource.MustParse("2Gi"),
+				},
+				TLS: &operatorv1alpha1.TLSCertificate{Provider: "auto"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		mutate        func(ec *operatorv1alpha1.EtcdCluster)
+		expectedError string
+	}{
+		{
+			name:   "scaling and upgrading are allowed",
+			mutate: func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.Size = 5; ec.Spec.Version = "v3.5.22" },
+		},
+		{
+			name:   "upgrading to the next minor version is allowed",
+			mutate: func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.Version = "v3.6.0" },
+		},
+		{
+			name:          "skipping a minor version is rejected",
+			mutate:        func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.Version = "v3.7.0" },
+			expectedError: "spec.version: Forbidden: upgrades from v3.5.21 to v3.7.0 skip a minor version",
+		},
+		{
+			name:          "downgrading to the previous minor version is rejected",
+			mutate:        func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.Version = "v3.4.35" },
+			expectedError: "spec.version: Forbidden: downgrades from v3.5.21 to v3.4.35",
+		},
+		{
+			name: "growing the volume is allowed",
+			mutate: func(ec *operatorv1alpha1.EtcdCluster) {
+				ec.Spec.StorageSpec.VolumeSizeRequest = resource.MustParse("4Gi")
+			},
+		},
+		{
+			name: "shrinking the volume is rejected",
+			mutate: func(ec *operatorv1alpha1.EtcdCluster) {
+				ec.Spec.StorageSpec.VolumeSizeRequest = resource.MustParse("1Gi")
+			},
+			expectedError: "spec.storageSpec.volumeSizeRequest",
+		},
+		{
+			name:          "changing the storage class is rejected",
+			mutate:        func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.StorageSpec.StorageClassName = "fast" },
+			expectedError: "spec.storageSpec.storageClassName",
+		},
+		{
+			name:          "removing the storage is rejected",
+			mutate:        func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.StorageSpec = nil },
+			expectedError: "spec.storageSpec",
+		},
+		{
+			name:          "changing the peer port is rejected",
+			mutate:        func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.Ports = &operatorv1alpha1.EtcdPorts{Peer: 3380} },
+			expectedError: "spec.ports.peer",
+		},
+		{
+			name: "moving the members to a remote cluster is rejected",
+			mutate: func(ec *operatorv1alpha1.EtcdCluster) {
+				ec.Spec.KubeconfigSecretRef = &operatorv1alpha1.KubeconfigSecretReference{Name: "remote-kubeconfig"}
+			},
+			expectedError: "spec.kubeconfigSecretRef",
+		},
+		{
+			name: "adding member services is accepted",
+			mutate: func(ec *operatorv1alpha1.EtcdCluster) {
+				ec.Spec.MemberServices = &operatorv1alpha1.MemberServices{Type: corev1.ServiceTypeLoadBalancer}
+			},
+		},
+		{
+			name: "adding a domain to the member URLs is rejected",
+			mutate: func(ec *operatorv1alpha1.EtcdCluster) {
+				ec.Spec.MemberServices = &operatorv1alpha1.MemberServices{Domain: "etcd.example.com"}
+			},
+			expectedError: "spec.memberServices.domain",
+		},
+		{
+			name:          "disabling TLS is rejected",
+			mutate:        func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.TLS = nil },
+			expectedError: "spec.tls",
+		},
+		{
+			name:          "changing the TLS provider is rejected",
+			mutate:        func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.TLS.Provider = "cert-manager" },
+			expectedError: "spec.tls.provider",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldEc, newEc := base(), base()
+			tt.mutate(newEc)
+
+			validator := newValidator()
+			_, err := validator.ValidateUpdate(context.Background(), oldEc, newEc)
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
+
+func TestEtcdClusterValidateCertManager(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           *operatorv1alpha1.ProviderCertManagerConfig
+		expectedError string
+	}{
+		{
+			name: "issuer is allowed",
+			cfg: &operatorv1alpha1.ProviderCertManagerConfig{
+				IssuerRef: operatorv1alpha1.CertManagerIssuerReference{Name: "etcd-ca", Kind: "ClusterIssuer"},
+				Duration:  &metav1.Duration{Duration: 720 * time.Hour},
+			},
+		},
+		{
+			name:          "missing configuration is rejected",
+			expectedError: "spec.tls.providerCfg.certManagerCfg: Required value",
+		},
+		{
+			name:          "missing issuer name is rejected",
+			cfg:           &operatorv1alpha1.ProviderCertManagerConfig{},
+			expectedError: "spec.tls.providerCfg.certManagerCfg.issuerRef.name",
+		},
+		{
+			name: "short duration is rejected",
+			cfg: &operatorv1alpha1.ProviderCertManagerConfig{
+				IssuerRef: operatorv1alpha1.CertManagerIssuerReference{Name: "etcd-ca"},
+				Duration:  &metav1.Duration{Duration: time.Minute},
+			},
+			expectedError: "spec.tls.providerCfg.certManagerCfg.duration",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &operatorv1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+				Spec: operatorv1alpha1.EtcdClusterSpec{
+					Size:    3,
+					Version: "v3.5.21",
+					TLS: &operatorv1alpha1.TLSCertificate{
+						Provider:    operatorv1alpha1.TLSProviderCertManager,
+						ProviderCfg: operatorv1alpha1.ProviderConfig{CertManagerCfg: tt.cfg},
+					},
+				},
+			}
+
+			_, err := newValidator().ValidateCreate(context.Background(), ec)
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
+
+func TestEtcdClusterValidateAutoTLS(t *testing.T) {
+	ec := &operatorv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec: operatorv1alpha1.EtcdClusterSpec{
+			Size:    3,
+			Version: "v3.5.21",
+			TLS: &operatorv1alpha1.TLSCertificate{
+				Provider: operatorv1alpha1.TLSProviderAuto,
+				ProviderCfg: operatorv1alpha1.ProviderConfig{
+					AutoCfg: &operatorv1alpha1.ProviderAutoConfig{Duration: &metav1.Duration{Duration: 720 * time.Hour}},
+				},
+			},
+		},
+	}
+	_, err := newValidator().ValidateCreate(context.Background(), ec)
+	assert.NoError(t, err)
+
+	ec.Spec.TLS.ProviderCfg.AutoCfg.Duration.Duration = time.Minute
+	_, err = newValidator().ValidateCreate(context.Background(), ec)
+	assert.ErrorContains(t, err, "spec.tls.providerCfg.autoCfg.duration")
+}
+
+func TestEtcdClusterValidateUpdateEnablingTLS(t *testing.T) {
+	oldEc := &operatorv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+		Spec:       operatorv1alpha1.EtcdClusterSpec{Size: 3, Version: "v3.5.21"},
+	}
+	newEc := oldEc.DeepCopy()
+	newEc.Spec.TLS = &operatorv1alpha1.TLSCertificate{Provider: operatorv1alpha1.TLSProviderAuto}
+
+	_, err := newValidator().ValidateUpdate(context.Background(), oldEc, newEc)
+	assert.ErrorContains(t, err, "TLS can't be enabled on an existing cluster")
+}
+
+func TestEtcdClusterValidateEtcdOptions(t *testing.T) {
+	tests := []struct {
+		name             string
+		version          string
+		etcdOptions      []string
+		expectedError    string
+		expectedWarnings int
+	}{
+		{
+			name:        "supported options",
+			version:     "v3.5.21",
+			etcdOptions: []string{"--snapshot-count=5000"},
+		},
+		{
+			name:          "removed option is rejected",
+			version:       "v3.6.0",
+			etcdOptions:   []string{"--snapshot-count=5000", "--enable-v2=true"},
+			expectedError: "spec.etcdOptions[1]",
+		},
+		{
+			name:          "option from a newer version is rejected",
+			version:       "v3.5.21",
+			etcdOptions:   []string{"--max-learners=2"},
+			expectedError: "spec.etcdOptions[0]",
+		},
+		{
+			name:             "deprecated option is a warning",
+			version:          "v3.6.0",
+			etcdOptions:      []string{"--experimental-max-learners=2"},
+			expectedWarnings: 1,
+		},
+		{
+			name:             "unparsable version skips the checks",
+			version:          "latest",
+			etcdOptions:      []string{"--enable-v2=true"},
+			expectedWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &operatorv1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+				Spec: operatorv1alpha1.EtcdClusterSpec{
+					Size:        3,
+					Version:     tt.version,
+					EtcdOptions: tt.etcdOptions,
+				},
+			}
+
+			validator := newValidator()
+			for _, validate := range []func() (admission.Warnings, error){
+				func() (admission.Warnings, error) { return validator.ValidateCreate(context.Background(), ec) },
+				func() (admission.Warnings, error) { return validator.ValidateUpdate(context.Background(), ec, ec) },
+			} {
+				warnings, err := validate()
+				assert.Len(t, warnings, tt.expectedWarnings)
+				if tt.expectedError == "" {
+					assert.NoError(t, err)
+					continue
+				}
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestEtcdClusterValidateUpdateWarnings(t *testing.T) {
+	base := func() *operatorv1alpha1.EtcdCluster {
+		return &operatorv1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: "default"},
+			Spec:       operatorv1alpha1.EtcdClusterSpec{Size: 5, Version: "v3.5.21"},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		mutateOld       func(ec *operatorv1alpha1.EtcdCluster)
+		mutateNew       func(ec *operatorv1alpha1.EtcdCluster)
+		expectedWarning string
+	}{
+		{
+			name:      "scaling down by one member",
+			mutateNew: func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.Size = 4 },
+		},
+		{
+			name:            "scaling down by more than one member",
+			mutateNew:       func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.Size = 3 },
+			expectedWarning: "spec.size",
+		},
+		{
+			name: "changing two disruptive fields at once",
+			mutateNew: func(ec *operatorv1alpha1.EtcdCluster) {
+				ec.Spec.Version = "v3.5.22"
+				ec.Spec.EtcdOptions = []string{"--snapshot-count=5000"}
+			},
+			expectedWarning: "spec.version, spec.etcdOptions are changed at once",
+		},
+		{
+			name: "upgrading a degraded cluster",
+			mutateOld: func(ec *operatorv1alpha1.EtcdCluster) {
+				ec.Status.Conditions = []metav1.Condition{{
+					Type:   operatorv1alpha1.EtcdClusterConditionDegraded,
+					Status: metav1.ConditionTrue,
+				}}
+			},
+			mutateNew:       func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.Version = "v3.5.22" },
+			expectedWarning: "while the cluster is Degraded",
+		},
+		{
+			name: "growing the volumes",
+			mutateOld: func(ec *operatorv1alpha1.EtcdCluster) {
+				ec.Spec.StorageSpec = &operatorv1alpha1.StorageSpec{AccessModes: corev1.ReadWriteOnce, VolumeSizeRequest: resource.MustParse("1Gi")}
+			},
+			mutateNew: func(ec *operatorv1alpha1.EtcdCluster) {
+				ec.Spec.StorageSpec = &operatorv1alpha1.StorageSpec{AccessModes: corev1.ReadWriteOnce, VolumeSizeRequest: resource.MustParse("2Gi")}
+			},
+			expectedWarning: "allowVolumeExpansion",
+		},
+		{
+			name:            "upgrading from a version that can't be parsed",
+			mutateOld:       func(ec *operatorv1alpha1.EtcdCluster) { ec.Spec.Version = "main" },
+			mutateNew:       func(ec *operatorv1alpha1.EtcdCluster) {},
+			expectedWarning: "spec.version: skipping the upgrade path checks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldEc, newEc := base(), base()
+			if tt.mutateOld != nil {
+				tt.mutateOld(oldEc)
+			}
+			tt.mutateNew(newEc)
+
+			validator := newValidator()
+			warnings, err := validator.ValidateUpdate(context.Background(), oldEc, newEc)
+			assert.NoError(t, err)
+			if tt.expectedWarning == "" {
+				assert.Empty(t, warnings)
+				return
+			}
+			assert.Len(t, warnings, 1)
+			assert.Contains(t, warnings[0], tt.expectedWarning)
+		})
+	}
+}
+
+func TestEtcdClusterDefaultWithTemplate(t *testing.T) {
+	ec := &operatorv1alpha1.EtcdCluster{
+		Spec: operatorv1alpha1.EtcdClusterSpec{
+			TemplateRef: &operatorv1alpha1.EtcdClusterTemplateReference{Name: "golden"},
+		},
+	}
+
+	defaulter := &EtcdClusterCustomDefaulter{}
+	assert.NoError(t, defaulter.Default(admissionContext(admissionv1.Create), ec))
+
+	// The template provides the other values, so only the size is defaulted.
+	assert.Equal(t, operatorv1alpha1.DefaultClusterSize, ec.Spec.Size)
+	assert.Empty(t, ec.Spec.Version)
+	assert.Nil(t, ec.Spec.Ports)
+}
+
+func TestEtcdClusterDefaultTemplate(t *testing.T) {
+	defaulter := &EtcdClusterCustomDefaulter{DefaultTemplate: func() string { return "golden" }}
+
+	ec := &operatorv1alpha1.EtcdCluster{}
+	assert.NoError(t, defaulter.Default(admissionContext(admissionv1.Create), ec))
+	assert.Equal(t, &operatorv1alpha1.EtcdClusterTemplateReference{Name: "golden"}, ec.Spec.TemplateRef)
+	assert.Empty(t, ec.Spec.Version)
+
+	// Existing clusters keep their spec.
+	ec = &operatorv1alpha1.EtcdCluster{}
+	assert.NoError(t, defaulter.Default(admissionContext(admissionv1.Update), ec))
+	assert.Nil(t, ec.Spec.TemplateRef)
+
+	// So do the clusters referencing another template.
+	ec = &operatorv1alpha1.EtcdCluster{Spec: operatorv1alpha1.EtcdClusterSpec{
+		TemplateRef: &operatorv1alpha1.EtcdClusterTemplateReference{Name: "other"},
+	}}
+	assert.NoError(t, defaulter.Default(admissionContext(admissionv1.Create), ec))
+	assert.Equal(t, "other", ec.Spec.TemplateRef.Name)
+}
+
+func TestEtcdClusterValidatePolicies(t *testing.T) {
+	prod := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "prod"}}}
+	dev := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev"}}
+	fleet := &operatorv1alpha1.EtcdOperatorPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "fleet"},
+		Spec: operatorv1alpha1.EtcdOperatorPolicySpec{
+			AllowedVersions:       []string{"v3.5"},
+			MaxSize:               ptr.To(5),
+			AllowedStorageClasses: []string{"fast"},
+		},
+	}
+	prodOnly := &operatorv1alpha1.EtcdOperatorPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "prod-tls"},
+		Spec: operatorv1alpha1.EtcdOperatorPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			RequireTLS:        true,
+		},
+	}
+	golden := &operatorv1alpha1.EtcdClusterTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden"},
+		Spec:       operatorv1alpha1.EtcdClusterTemplateSpec{Version: "v3.6.0"},
+	}
+	validator := newValidator(prod, dev, fleet, prodOnly, golden)
+
+	tests := []struct {
+		name           string
+		namespace      string
+		spec           operatorv1alpha1.EtcdClusterSpec
+		expectedErrors []string
+	}{
+		{
+			name:      "compliant cluster",
+			namespace: "dev",
+			spec:      operatorv1alpha1.EtcdClusterSpec{Size: 3, Version: "v3.5.21"},
+		},
+		{
+			name:           "version, size and storage class are constrained",
+			namespace:      "dev",
+			spec:           operatorv1alpha1.EtcdClusterSpec{Size: 7, Version: "v3.6.0", StorageSpec: &operatorv1alpha1.StorageSpec{}},
+			expectedErrors: []string{"spec.version", "spec.size", "spec.storageSpec.storageClassName"},
+		},
+		{
+			name:      "the version of the template is checked",
+			namespace: "dev",
+			spec: operatorv1alpha1.EtcdClusterSpec{
+				Size:        3,
+				TemplateRef: &operatorv1alpha1.EtcdClusterTemplateReference{Name: "golden"},
+			},
+			expectedErrors: []string{"spec.version"},
+		},
+		{
+			name:           "TLS is required in the selected namespaces",
+			namespace:      "prod",
+			spec:           operatorv1alpha1.EtcdClusterSpec{Size: 3},
+			expectedErrors: []string{"spec.tls", "prod-tls"},
+		},
+		{
+			name:      "TLS enabled in the selected namespaces",
+			namespace: "prod",
+			spec: operatorv1alpha1.EtcdClusterSpec{
+				Size: 3,
+				TLS:  &operatorv1alpha1.TLSCertificate{Provider: operatorv1alpha1.TLSProviderAuto},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &operatorv1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-etcd", Namespace: tt.namespace},
+				Spec:       tt.spec,
+			}
+
+			_, createErr := validator.ValidateCreate(context.Background(), ec)
+			_, updateErr := validator.ValidateUpdate(context.Background(), ec, ec)
+			for _, err := range []error{createErr, updateErr} {
+				if len(tt.expectedErrors) == 0 {
+					assert.NoError(t, err)
+					continue
+				}
+				assert.Error(t, err)
+				for _, expected := range tt.expectedErrors {
+					assert.Contains(t, err.Error(), expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	operatorv1beta1 "go.etcd.io/etcd-operator/api/v1beta1"
+)
+
+// SetupEtcdClusterWebhookWithManager registers the conversion webhook of the
+// v1beta1 EtcdClusters in the manager. They are defaulted and validated by
+// the webhooks of v1alpha1, which the API server converts them to.
+func SetupEtcdClusterWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&operatorv1beta1.EtcdCluster{}).
+		Complete()
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package chaos injects failures into the members of an EtcdCluster, for the
+// e2e tests checking how the operator copes with them.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/e2e-framework/klient/k8s/resources"
+)
+
+const (
+	// fillImage is the image of the Pods filling the data volumes.
+	fillImage = "busybox:1.36"
+	// dataVolumeName is the name of the volume claim template of the
+	// members, see newStatefulSetSpec in internal/controller.
+	dataVolumeName = "etcd-data"
+)
+
+// Members returns the Pods running the members of the EtcdCluster with the
+// given name.
+func Members(ctx context.Context, r *resources.Resources, namespace, cluster string) ([]corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := r.WithNamespace(namespace).List(ctx, pods, resources.WithLabelSelector("app="+cluster)); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// KillRandomMember deletes, without grace period, the Pod of a random member
+// of the EtcdCluster with the given name, and returns it.
+func KillRandomMember(ctx context.Context, r *resources.Resources, namespace, cluster string) (*corev1.Pod, error) {
+	pods, err := Members(ctx, r, namespace, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("EtcdCluster %s/%s has no members", namespace, cluster)
+	}
+	pod := &pods[rand.IntN(len(pods))]
+	if err := r.Delete(ctx, pod, resources.WithGracePeriod(0)); err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+// PartitionMember cuts the member running in the given Pod off the network
+// with a NetworkPolicy denying all its traffic. The CNI of the cluster must
+// enforce NetworkPolicies. The returned function heals the partition.
+func PartitionMember(ctx context.Context, r *resources.Resources, namespace, pod string) (func(context.Context) error, error) {
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "chaos-partition-" + pod, Namespace: namespace},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"statefulset.kubernetes.io/pod-name": pod},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		},
+	}
+	if err := r.Create(ctx, policy); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		return r.Delete(ctx, policy)
+	}, nil
+}
+
+// FillDataVolume fills the data volume of the member running in the given
+// Pod, which must have storage, until it runs out of space. It writes from a
+// Pod mounting the volume on the node of the member, as the etcd image has no
+// shell. The returned function frees the space; the Pods created go with
+// the namespace.
+func FillDataVolume(ctx context.Context, r *resources.Resources, namespace, pod string) (func(context.Context) error, error) {
+	member := &corev1.Pod{}
+	if err := r.Get(ctx, pod, namespace, member); err != nil {
+		return nil, err
+	}
+	if member.Spec.NodeName == "" {
+		return nil, errors.New("the member isn't scheduled yet")
+	}
+
+	newPod := func(name string, command string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: corev1.PodSpec{
+				NodeName:      member.Spec.NodeName,
+				RestartPolicy: corev1.RestartPolicyNever,
+				Containers: []corev1.Container{{
+					Name:         "fill",
+					Image:        fillImage,
+					Command:      []string{"sh", "-c", command},
+					VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}},
+				}},
+				Volumes: []corev1.Volume{{
+					Name: "data",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: dataVolumeName + "-" + pod,
+						},
+					},
+				}},
+			},
+		}
+	}
+
+	// dd stops, and fails, once the volume is full.
+	fill := newPod("chaos-fill-"+pod, "dd if=/dev/zero of=/data/chaos-fill bs=1M || true")
+	if err := r.Create(ctx, fill); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		if err := r.Delete(ctx, fill); err != nil {
+			return err
+		}
+		return r.Create(ctx, newPod("chaos-free-"+pod, "rm -f /data/chaos-fill"))
+	}, nil
+}
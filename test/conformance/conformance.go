@@ -0,0 +1,327 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package conformance holds the behavioral tests an operator managing
+// EtcdClusters must pass to be compatible with etcd-operator: bootstrap,
+// scaling, upgrade and recovery from the loss of a member. They are
+// e2e-framework features, so distributions and forks of the operator can run
+// them against their own deployment:
+//
+//	func TestConformance(t *testing.T) {
+//		testEnv.Test(t, conformance.Features(conformance.Options{})...)
+//	}
+//
+// The features are labeled with the Version of the suite they belong to.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/e2e-framework/klient/k8s"
+	"sigs.k8s.io/e2e-framework/klient/k8s/resources"
+	"sigs.k8s.io/e2e-framework/klient/wait"
+	"sigs.k8s.io/e2e-framework/klient/wait/conditions"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/test/chaos"
+)
+
+// Version is the version of the conformance suite. Its major version changes
+// when a test is removed or expects a different behavior, its minor version
+// when tests are added. An operator conforms to a version when it passes all
+// the features returned by Features.
+const Version = "v1.0.0"
+
+// VersionLabel is the label of the features holding the Version of the
+// suite, to select them with the label filters of e2e-framework.
+const VersionLabel = "conformance"
+
+const (
+	clusterName = "conformance"
+	clusterSize = 3
+	scaledSize  = 5
+)
+
+// Options configure the conformance suite. The zero value runs it with the
+// defaults.
+type Options struct {
+	// Version is the etcd version of the clusters, but for the upgrade.
+	// Defaults to the DefaultEtcdVersion of the operator.
+	Version string
+	// FromVersion is the etcd version the upgraded cluster starts from.
+	// Defaults to v3.5.17.
+	FromVersion string
+	// ToVersion is the etcd version the cluster is upgraded to. Defaults to
+	// the DefaultEtcdVersion of the operator.
+	ToVersion string
+	// Timeout bounds each wait for the cluster to reach a state. Defaults to
+	// 5 minutes.
+	Timeout time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Version == "" {
+		o.Version = ecv1alpha1.DefaultEtcdVersion
+	}
+	if o.FromVersion == "" {
+		o.FromVersion = "v3.5.17"
+	}
+	if o.ToVersion == "" {
+		o.ToVersion = ecv1alpha1.DefaultEtcdVersion
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 5 * time.Minute
+	}
+	return o
+}
+
+// Features returns all the features of the conformance suite.
+func Features(opts Options) []features.Feature {
+	return []features.Feature{
+		Bootstrap(opts),
+		Scale(opts),
+		Upgrade(opts),
+		FailureRecovery(opts),
+	}
+}
+
+// Bootstrap checks that a new EtcdCluster gets all its members, healthy, and
+// publishes its client endpoints.
+func Bootstrap(opts Options) features.Feature {
+	opts = opts.withDefaults()
+	return newFeature("bootstrap", opts, opts.Version).
+		Assess("the cluster publishes an endpoint per member",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				ec := getCluster(ctx, t, cfg.Client().Resources())
+				if n := len(strings.Split(ec.Status.Endpoints, ",")); ec.Status.Endpoints == "" || n != clusterSize {
+					t.Errorf("EtcdCluster has endpoints %q, expected %d", ec.Status.Endpoints, clusterSize)
+				}
+				return ctx
+			}).
+		Feature()
+}
+
+// Scale checks that an EtcdCluster is scaled out and back in, and stays
+// healthy.
+func Scale(opts Options) features.Feature {
+	opts = opts.withDefaults()
+	return newFeature("scale", opts, opts.Version).
+		Assess("the cluster scales out",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				resize(ctx, t, cfg.Client().Resources(), opts, scaledSize)
+				return ctx
+			}).
+		Assess("the cluster scales in",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				resize(ctx, t, cfg.Client().Resources(), opts, clusterSize)
+				return ctx
+			}).
+		Feature()
+}
+
+// Upgrade checks that the members of an EtcdCluster are upgraded from
+// FromVersion to ToVersion, and stay healthy.
+func Upgrade(opts Options) features.Feature {
+	opts = opts.withDefaults()
+	return newFeature("upgrade", opts, opts.FromVersion).
+		Assess("the members are upgraded",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				r := cfg.Client().Resources()
+				patch(ctx, t, r, fmt.Sprintf(`{"spec":{"version":%q}}`, opts.ToVersion))
+				if err := WaitForVersion(ctx, r, namespace(ctx), clusterName, clusterSize, opts.ToVersion, opts.Timeout); err != nil {
+					t.Fatal(err)
+				}
+				if err := WaitForHealthy(ctx, r, namespace(ctx), clusterName, clusterSize, opts.Timeout); err != nil {
+					t.Fatal(err)
+				}
+				return ctx
+			}).
+		Feature()
+}
+
+// FailureRecovery checks that an EtcdCluster recovers from the loss of one
+// of its members.
+func FailureRecovery(opts Options) features.Feature {
+	opts = opts.withDefaults()
+	return newFeature("failure-recovery", opts, opts.Version).
+		Assess("the cluster recovers from the loss of a member",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				r := cfg.Client().Resources()
+				killed, err := chaos.KillRandomMember(ctx, r, namespace(ctx), clusterName)
+				if err != nil {
+					t.Fatalf("Failed to kill a member: %s", err)
+				}
+				replaced := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: killed.Name, Namespace: killed.Namespace}}
+				if err := wait.For(
+					conditions.New(r).ResourceMatch(replaced, func(obj k8s.Object) bool {
+						return obj.GetUID() != killed.UID
+					}),
+					wait.WithTimeout(opts.Timeout),
+					wait.WithInterval(5*time.Second),
+				); err != nil {
+					t.Fatalf("Member %s wasn't replaced: %s", killed.Name, err)
+				}
+				if err := WaitForHealthy(ctx, r, namespace(ctx), clusterName, clusterSize, opts.Timeout); err != nil {
+					t.Fatal(err)
+				}
+				return ctx
+			}).
+		Feature()
+}
+
+type namespaceKey struct{}
+
+func namespace(ctx context.Context) string {
+	ns, _ := ctx.Value(namespaceKey{}).(string)
+	return ns
+}
+
+// newFeature returns a feature running a healthy EtcdCluster of clusterSize
+// members, of the given etcd version, in a namespace of its own.
+func newFeature(name string, opts Options, version string) *features.FeatureBuilder {
+	return features.New("conformance/"+name).
+		WithLabel(VersionLabel, Version).
+		Setup(func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			r := cfg.Client().Resources()
+			if err := ecv1alpha1.AddToScheme(r.GetScheme()); err != nil {
+				t.Fatalf("Failed to register the operator types: %s", err)
+			}
+
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: envconf.RandomName("conformance-"+name, 32)}}
+			if err := r.Create(ctx, ns); err != nil {
+				t.Fatalf("Failed to create namespace: %s", err)
+			}
+			ctx = context.WithValue(ctx, namespaceKey{}, ns.Name)
+
+			ec := &ecv1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: ns.Name},
+				Spec:       ecv1alpha1.EtcdClusterSpec{Size: clusterSize, Version: version},
+			}
+			if err := r.Create(ctx, ec); err != nil {
+				t.Fatalf("Failed to create EtcdCluster: %s", err)
+			}
+			if err := WaitForHealthy(ctx, r, ns.Name, clusterName, clusterSize, opts.Timeout); err != nil {
+				t.Fatal(err)
+			}
+			return ctx
+		}).
+		Teardown(func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace(ctx)}}
+			if err := cfg.Client().Resources().Delete(ctx, ns); err != nil {
+				t.Logf("Failed to delete namespace %s: %s", ns.Name, err)
+			}
+			return ctx
+		})
+}
+
+func getCluster(ctx context.Context, t *testing.T, r *resources.Resources) *ecv1alpha1.EtcdCluster {
+	t.Helper()
+	ec := &ecv1alpha1.EtcdCluster{}
+	if err := r.Get(ctx, clusterName, namespace(ctx), ec); err != nil {
+		t.Fatalf("Failed to get EtcdCluster: %s", err)
+	}
+	return ec
+}
+
+func patch(ctx context.Context, t *testing.T, r *resources.Resources, data string) {
+	t.Helper()
+	ec := getCluster(ctx, t, r)
+	if err := r.Patch(ctx, ec, k8s.Patch{PatchType: types.MergePatchType, Data: []byte(data)}); err != nil {
+		t.Fatalf("Failed to patch EtcdCluster with %s: %s", data, err)
+	}
+}
+
+func resize(ctx context.Context, t *testing.T, r *resources.Resources, opts Options, size int) {
+	t.Helper()
+	patch(ctx, t, r, fmt.Sprintf(`{"spec":{"size":%d}}`, size))
+	if err := WaitForHealthy(ctx, r, namespace(ctx), clusterName, size, opts.Timeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// WaitForDegraded waits for the Degraded condition of an EtcdCluster to have
+// the given status.
+func WaitForDegraded(ctx context.Context, r *resources.Resources, namespace, name string, status metav1.ConditionStatus, timeout time.Duration) error {
+	ec := &ecv1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	if err := wait.For(
+		conditions.New(r).ResourceMatch(ec, func(obj k8s.Object) bool {
+			ec, ok := obj.(*ecv1alpha1.EtcdCluster)
+			return ok && meta.IsStatusConditionPresentAndEqual(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionDegraded, status)
+		}),
+		wait.WithContext(ctx),
+		wait.WithTimeout(timeout),
+		wait.WithInterval(5*time.Second),
+	); err != nil {
+		return fmt.Errorf("Degraded condition of EtcdCluster %s isn't %s: %w", name, status, err)
+	}
+	return nil
+}
+
+// WaitForHealthy waits for exactly size members of an EtcdCluster to be
+// ready, and for the operator to report them healthy.
+func WaitForHealthy(ctx context.Context, r *resources.Resources, namespace, name string, size int, timeout time.Duration) error {
+	if err := wait.For(func(ctx context.Context) (bool, error) {
+		pods, err := chaos.Members(ctx, r, namespace, name)
+		if err != nil {
+			return false, err
+		}
+		ready := 0
+		for _, pod := range pods {
+			for _, c := range pod.Status.Conditions {
+				if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+					ready++
+				}
+			}
+		}
+		return ready == size, nil
+	}, wait.WithContext(ctx), wait.WithTimeout(timeout), wait.WithInterval(5*time.Second)); err != nil {
+		return fmt.Errorf("members of EtcdCluster %s aren't ready: %w", name, err)
+	}
+	return WaitForDegraded(ctx, r, namespace, name, metav1.ConditionFalse, timeout)
+}
+
+// WaitForVersion waits for exactly size members of an EtcdCluster to run the
+// given etcd version.
+func WaitForVersion(ctx context.Context, r *resources.Resources, namespace, name string, size int, version string, timeout time.Duration) error {
+	if err := wait.For(func(ctx context.Context) (bool, error) {
+		pods, err := chaos.Members(ctx, r, namespace, name)
+		if err != nil {
+			return false, err
+		}
+		if len(pods) != size {
+			return false, nil
+		}
+		for _, pod := range pods {
+			if !strings.HasSuffix(pod.Spec.Containers[0].Image, ":"+version) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}, wait.WithContext(ctx), wait.WithTimeout(timeout), wait.WithInterval(5*time.Second)); err != nil {
+		return fmt.Errorf("members of EtcdCluster %s don't run %s: %w", name, version, err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/e2e-framework/klient/k8s"
+	"sigs.k8s.io/e2e-framework/klient/wait"
+	"sigs.k8s.io/e2e-framework/klient/wait/conditions"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/test/chaos"
+)
+
+const (
+	chaosClusterName = "chaos"
+	chaosClusterSize = 3
+)
+
+// chaosStorageClass is the StorageClass of the data volumes filled by the
+// chaos tests. It must enforce the size of the volumes, which the default
+// StorageClass of KinD doesn't, so the test is skipped when it isn't set.
+var chaosStorageClass = os.Getenv("E2E_CHAOS_STORAGE_CLASS")
+
+type chaosNamespaceKey struct{}
+
+// setupChaosCluster creates a namespace running a healthy EtcdCluster of
+// chaosClusterSize members, with storage of the given class when set.
+func setupChaosCluster(storageClass string) features.Func {
+	return func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+		r := cfg.Client().Resources()
+		_ = ecv1alpha1.AddToScheme(r.GetScheme())
+		_ = networkingv1.AddToScheme(r.GetScheme())
+
+		ns := createTestNamespace(ctx, t, r, "chaos")
+		ctx = context.WithValue(ctx, chaosNamespaceKey{}, ns)
+
+		ec := &ecv1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: chaosClusterName, Namespace: ns},
+			Spec:       ecv1alpha1.EtcdClusterSpec{Size: chaosClusterSize, Version: etcdVersion},
+		}
+		if storageClass != "" {
+			ec.Spec.StorageSpec = &ecv1alpha1.StorageSpec{
+				StorageClassName:  storageClass,
+				VolumeSizeRequest: resource.MustParse("256Mi"),
+			}
+		}
+		if err := r.Create(ctx, ec); err != nil {
+			t.Fatalf("Failed to create EtcdCluster: %s", err)
+		}
+		waitForClusterHealthy(ctx, t, r, ns, chaosClusterName, chaosClusterSize)
+		return ctx
+	}
+}
+
+// teardownChaosCluster deletes the namespace created by setupChaosCluster.
+func teardownChaosCluster(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+	deleteTestNamespace(ctx, t, cfg.Client().Resources(), chaosNamespace(ctx))
+	return ctx
+}
+
+func chaosNamespace(ctx context.Context) string {
+	ns, _ := ctx.Value(chaosNamespaceKey{}).(string)
+	return ns
+}
+
+func TestChaosKillMember(t *testing.T) {
+	feature := features.New("chaos/kill-member").
+		Setup(setupChaosCluster("")).
+		Assess("the killed member is replaced and the cluster recovers",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				r := cfg.Client().Resources()
+				ns := chaosNamespace(ctx)
+
+				killed, err := chaos.KillRandomMember(ctx, r, ns, chaosClusterName)
+				if err != nil {
+					t.Fatalf("Failed to kill a member: %s", err)
+				}
+				t.Logf("Killed member %s", killed.Name)
+
+				// The StatefulSet replaces the Pod under the same name.
+				replaced := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: killed.Name, Namespace: ns}}
+				if err := wait.For(
+					conditions.New(r).ResourceMatch(replaced, func(obj k8s.Object) bool {
+						return obj.GetUID() != killed.UID
+					}),
+					wait.WithTimeout(clusterTimeout),
+					wait.WithInterval(5*time.Second),
+				); err != nil {
+					t.Fatalf("Member %s wasn't replaced: %s", killed.Name, err)
+				}
+				waitForClusterHealthy(ctx, t, r, ns, chaosClusterName, chaosClusterSize)
+				return ctx
+			}).
+		Teardown(teardownChaosCluster)
+
+	_ = testEnv.Test(t, feature.Feature())
+}
+
+func TestChaosPartitionMember(t *testing.T) {
+	feature := features.New("chaos/partition-member").
+		Setup(setupChaosCluster("")).
+		Assess("the operator reports the partitioned member and the cluster recovers once healed",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				r := cfg.Client().Resources()
+				ns := chaosNamespace(ctx)
+
+				pod := chaosClusterName + "-1"
+				heal, err := chaos.PartitionMember(ctx, r, ns, pod)
+				if err != nil {
+					t.Fatalf("Failed to partition member %s: %s", pod, err)
+				}
+				waitForDegraded(ctx, t, r, ns, chaosClusterName, metav1.ConditionTrue)
+
+				ec := &ecv1alpha1.EtcdCluster{}
+				if err := r.Get(ctx, chaosClusterName, ns, ec); err != nil {
+					t.Fatalf("Failed to get EtcdCluster: %s", err)
+				}
+				degraded := meta.FindStatusCondition(ec.Status.Conditions, ecv1alpha1.EtcdClusterConditionDegraded)
+				if degraded.Reason != "HealthCheckFailed" {
+					t.Errorf("Degraded condition has reason %s, expected HealthCheckFailed", degraded.Reason)
+				}
+
+				if err := heal(ctx); err != nil {
+					t.Fatalf("Failed to heal the partition: %s", err)
+				}
+				waitForClusterHealthy(ctx, t, r, ns, chaosClusterName, chaosClusterSize)
+				return ctx
+			}).
+		Teardown(teardownChaosCluster)
+
+	_ = testEnv.Test(t, feature.Feature())
+}
+
+func TestChaosFillDataVolume(t *testing.T) {
+	if chaosStorageClass == "" {
+		t.Skip("E2E_CHAOS_STORAGE_CLASS isn't set")
+	}
+
+	feature := features.New("chaos/fill-data-volume").
+		Setup(setupChaosCluster(chaosStorageClass)).
+		Assess("the operator reports the member out of space and the cluster recovers once freed",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				r := cfg.Client().Resources()
+				ns := chaosNamespace(ctx)
+
+				pod := chaosClusterName + "-0"
+				free, err := chaos.FillDataVolume(ctx, r, ns, pod)
+				if err != nil {
+					t.Fatalf("Failed to fill the data volume of member %s: %s", pod, err)
+				}
+				waitForDegraded(ctx, t, r, ns, chaosClusterName, metav1.ConditionTrue)
+
+				if err := free(ctx); err != nil {
+					t.Fatalf("Failed to free the data volume: %s", err)
+				}
+				waitForClusterHealthy(ctx, t, r, ns, chaosClusterName, chaosClusterSize)
+				return ctx
+			}).
+		Teardown(teardownChaosCluster)
+
+	_ = testEnv.Test(t, feature.Feature())
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+
+	"go.etcd.io/etcd-operator/test/conformance"
+)
+
+// TestConformance runs the conformance suite against the operator under
+// test, with EtcdClusters of etcdVersion.
+func TestConformance(t *testing.T) {
+	opts := conformance.Options{
+		Version:   etcdVersion,
+		ToVersion: etcdVersion,
+		Timeout:   clusterTimeout,
+	}
+	_ = testEnv.Test(t, conformance.Features(opts)...)
+}
@@ -25,6 +25,7 @@ import (
 	"testing"
 	"time"
 
+	"sigs.k8s.io/e2e-framework/klient/conf"
 	"sigs.k8s.io/e2e-framework/klient/wait"
 	"sigs.k8s.io/e2e-framework/klient/wait/conditions"
 	"sigs.k8s.io/e2e-framework/pkg/env"
@@ -32,6 +33,7 @@ import (
 	"sigs.k8s.io/e2e-framework/pkg/envfuncs"
 	"sigs.k8s.io/e2e-framework/support/kind"
 
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
 	test_utils "go.etcd.io/etcd-operator/test/utils"
 )
 
@@ -39,37 +41,74 @@ var (
 	testEnv     env.Environment
 	dockerImage = "etcd-operator:v0.1"
 	namespace   = "etcd-operator-system"
+
+	// useExistingCluster runs the tests against the cluster of the current
+	// KUBECONFIG instead of a new KinD cluster. The image must then be
+	// pullable by the cluster.
+	useExistingCluster = os.Getenv("E2E_USE_EXISTING_CLUSTER") == "true"
+	// skipBuild deploys the image as is instead of building it first.
+	skipBuild = os.Getenv("E2E_SKIP_BUILD") == "true"
+
+	// kindNodeImage sets the Kubernetes version of the KinD cluster, and
+	// etcdVersion the etcd version of the EtcdClusters of the tests, so the
+	// suite can run over a matrix of versions, see test-e2e-matrix.
+	kindNodeImage = envOrDefault("E2E_KIND_NODE_IMAGE", "kindest/node:v1.32.0")
+	etcdVersion   = envOrDefault("E2E_ETCD_VERSION", ecv1alpha1.DefaultEtcdVersion)
+
+	// The dependencies installed by the suite, and removed once it is done.
+	// Those already in an existing cluster are left alone.
+	installedPrometheus  bool
+	installedCertManager bool
 )
 
 func TestMain(m *testing.M) {
-	testEnv = env.New()
+	if img := os.Getenv("E2E_IMAGE"); img != "" {
+		dockerImage = img
+	}
+
 	kindClusterName := "etcd-cluster"
 	kindCluster := kind.NewCluster(kindClusterName)
-	clusterVersion := kind.WithImage("kindest/node:v1.32.0")
+	clusterVersion := kind.WithImage(kindNodeImage)
+	log.Printf("Running the tests with etcd %s", etcdVersion)
+
+	if useExistingCluster {
+		log.Println("Using the existing cluster of the current KUBECONFIG...")
+		testEnv = env.NewWithKubeConfig(conf.ResolveKubeConfigFile())
+	} else {
+		log.Printf("Creating KinD cluster with %s...", kindNodeImage)
+		testEnv = env.New()
+		testEnv.Setup(
+			// create KinD cluster
+			func(ctx context.Context, cfg *envconf.Config) (context.Context, error) {
+				var err error
+				ctx, err = envfuncs.CreateClusterWithConfig(kindCluster, kindClusterName, "kind-config.yaml", clusterVersion)(ctx, cfg)
+				if err != nil {
+					log.Printf("failed to create cluster: %s", err)
+					return ctx, err
+				}
+
+				return ctx, nil
+			},
+		)
+	}
 
-	log.Println("Creating KinD cluster...")
 	testEnv.Setup(
-		// create KinD cluster
+		// prepare the resources
 		func(ctx context.Context, cfg *envconf.Config) (context.Context, error) {
-			// create KinD cluster
-			var err error
-			ctx, err = envfuncs.CreateClusterWithOpts(kindCluster, kindClusterName, clusterVersion)(ctx, cfg)
-			if err != nil {
-				log.Printf("failed to create cluster: %s", err)
-				return ctx, err
+			if skipBuild {
+				log.Printf("Skipping the build of docker image %s", dockerImage)
+			} else {
+				// Build docker image
+				log.Println("Building docker image...")
+				cmd := exec.Command("make", "docker-build", fmt.Sprintf("IMG=%s", dockerImage))
+				if _, err := test_utils.Run(cmd); err != nil {
+					log.Printf("Failed to build docker image: %s", err)
+					return ctx, err
+				}
 			}
 
-			return ctx, nil
-		},
-
-		// prepare the resources
-		func(ctx context.Context, cfg *envconf.Config) (context.Context, error) {
-			// Build docker image
-			log.Println("Building docker image...")
-			cmd := exec.Command("make", "docker-build", fmt.Sprintf("IMG=%s", dockerImage))
-			if _, err := test_utils.Run(cmd); err != nil {
-				log.Printf("Failed to build docker image: %s", err)
-				return ctx, err
+			if useExistingCluster {
+				return ctx, nil
 			}
 
 			// Load docker image into kind
@@ -84,14 +123,24 @@ func TestMain(m *testing.M) {
 
 		// install prometheus and cert-manager
 		func(ctx context.Context, cfg *envconf.Config) (context.Context, error) {
-			log.Println("Installing prometheus operator...")
-			if err := test_utils.InstallPrometheusOperator(); err != nil {
-				log.Printf("Unable to install Prometheus operator: %s", err)
+			if test_utils.IsPrometheusCRDsInstalled() {
+				log.Println("Prometheus operator is already installed")
+			} else {
+				log.Println("Installing prometheus operator...")
+				if err := test_utils.InstallPrometheusOperator(); err != nil {
+					log.Printf("Unable to install Prometheus operator: %s", err)
+				}
+				installedPrometheus = true
 			}
 
-			log.Println("Installing cert-manager...")
-			if err := test_utils.InstallCertManager(); err != nil {
-				log.Printf("Unable to install Cert Manager: %s", err)
+			if test_utils.IsCertManagerCRDsInstalled() {
+				log.Println("Cert Manager is already installed")
+			} else {
+				log.Println("Installing cert-manager...")
+				if err := test_utils.InstallCertManager(); err != nil {
+					log.Printf("Unable to install Cert Manager: %s", err)
+				}
+				installedCertManager = true
 			}
 
 			return ctx, nil
@@ -178,28 +227,42 @@ func TestMain(m *testing.M) {
 			log.Println("Removing dependencies...")
 
 			// remove prometheus
-			test_utils.UninstallPrometheusOperator()
+			if installedPrometheus {
+				test_utils.UninstallPrometheusOperator()
+			}
 
 			// remove cert-manager
-			test_utils.UninstallCertManager()
-
-			return ctx, nil
-		},
-
-		// Destroy environment
-		func(ctx context.Context, cfg *envconf.Config) (context.Context, error) {
-			var err error
-
-			log.Println("Destroying cluster...")
-			ctx, err = envfuncs.DestroyCluster(kindClusterName)(ctx, cfg)
-			if err != nil {
-				log.Printf("failed to delete cluster: %s", err)
+			if installedCertManager {
+				test_utils.UninstallCertManager()
 			}
 
 			return ctx, nil
 		},
 	)
+	if !useExistingCluster {
+		testEnv.Finish(
+			// Destroy environment
+			func(ctx context.Context, cfg *envconf.Config) (context.Context, error) {
+				var err error
+
+				log.Println("Destroying cluster...")
+				ctx, err = envfuncs.DestroyCluster(kindClusterName)(ctx, cfg)
+				if err != nil {
+					log.Printf("failed to delete cluster: %s", err)
+				}
+
+				return ctx, nil
+			},
+		)
+	}
 
 	// Use Environment.Run to launch the test
 	os.Exit(testEnv.Run(m))
 }
+
+func envOrDefault(key, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return value
+}
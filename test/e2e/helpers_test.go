@@ -0,0 +1,71 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/e2e-framework/klient/k8s/resources"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+
+	"go.etcd.io/etcd-operator/test/conformance"
+)
+
+// clusterTimeout bounds the waits for the EtcdClusters of the tests.
+const clusterTimeout = 5 * time.Minute
+
+// createTestNamespace creates a namespace with a random name starting with
+// prefix, and returns its name.
+func createTestNamespace(ctx context.Context, t *testing.T, r *resources.Resources, prefix string) string {
+	t.Helper()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: envconf.RandomName(prefix, 16)}}
+	if err := r.Create(ctx, ns); err != nil {
+		t.Fatalf("Failed to create namespace: %s", err)
+	}
+	return ns.Name
+}
+
+// deleteTestNamespace deletes a namespace created by createTestNamespace.
+func deleteTestNamespace(ctx context.Context, t *testing.T, r *resources.Resources, name string) {
+	t.Helper()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if err := r.Delete(ctx, ns); err != nil {
+		t.Logf("Failed to delete namespace %s: %s", name, err)
+	}
+}
+
+// waitForDegraded waits for the Degraded condition of an EtcdCluster to have
+// the given status.
+func waitForDegraded(ctx context.Context, t *testing.T, r *resources.Resources, namespace, name string, status metav1.ConditionStatus) {
+	t.Helper()
+	if err := conformance.WaitForDegraded(ctx, r, namespace, name, status, clusterTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForClusterHealthy waits for the given number of members of an
+// EtcdCluster to be ready, and for the operator to report them healthy.
+func waitForClusterHealthy(ctx context.Context, t *testing.T, r *resources.Resources, namespace, name string, size int) {
+	t.Helper()
+	if err := conformance.WaitForHealthy(ctx, r, namespace, name, size, clusterTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/e2e-framework/klient/k8s"
+	"sigs.k8s.io/e2e-framework/klient/k8s/resources"
+	"sigs.k8s.io/e2e-framework/klient/wait"
+	"sigs.k8s.io/e2e-framework/klient/wait/conditions"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	operatorDeployment = "etcd-operator-controller-manager"
+	// leaderElectionLease is the lease of the leader election of the
+	// operator, which runs a single shard.
+	leaderElectionLease = "cc4a0f4b.etcd.io"
+	leaderClusterName   = "leader"
+)
+
+// leaderPod returns the name of the Pod of the operator holding the lease of
+// the leader election, whose identity is its hostname followed by a UUID.
+func leaderPod(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return strings.SplitN(*lease.Spec.HolderIdentity, "_", 2)[0]
+}
+
+// waitForOperatorReplicas scales the operator to at least replicas, and waits
+// for them to be ready. The Deployment is scaled back once the test is done.
+func waitForOperatorReplicas(ctx context.Context, t *testing.T, r *resources.Resources, replicas int32) {
+	t.Helper()
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, operatorDeployment, namespace, deployment); err != nil {
+		t.Fatalf("Failed to get the Deployment of the operator: %s", err)
+	}
+	if current := *deployment.Spec.Replicas; current < replicas {
+		if err := mergePatch(ctx, r, deployment, fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)); err != nil {
+			t.Fatalf("Failed to scale the operator: %s", err)
+		}
+		t.Cleanup(func() {
+			scaled := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: operatorDeployment, Namespace: namespace}}
+			if err := mergePatch(context.Background(), r, scaled, fmt.Sprintf(`{"spec":{"replicas":%d}}`, current)); err != nil {
+				t.Logf("Failed to scale the operator back to %d replicas: %s", current, err)
+			}
+		})
+	}
+	if err := wait.For(
+		conditions.New(r).ResourceMatch(deployment, func(obj k8s.Object) bool {
+			return obj.(*appsv1.Deployment).Status.ReadyReplicas >= replicas
+		}),
+		wait.WithTimeout(3*time.Minute),
+		wait.WithInterval(5*time.Second),
+	); err != nil {
+		t.Fatalf("The replicas of the operator aren't ready: %s", err)
+	}
+}
+
+// TestLeaderFailover kills the replica of the operator holding the
+// leadership, and checks another replica takes over and keeps reconciling
+// the EtcdClusters.
+func TestLeaderFailover(t *testing.T) {
+	feature := features.New("leader-election/failover").
+		Assess("another replica takes over the reconciles of the killed leader",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				r := cfg.Client().Resources()
+				_ = appsv1.AddToScheme(r.GetScheme())
+				_ = coordinationv1.AddToScheme(r.GetScheme())
+				_ = ecv1alpha1.AddToScheme(r.GetScheme())
+
+				waitForOperatorReplicas(ctx, t, r, 2)
+				ns := createTestNamespace(ctx, t, r, "leader")
+				defer deleteTestNamespace(ctx, t, r, ns)
+
+				ec := &ecv1alpha1.EtcdCluster{
+					ObjectMeta: metav1.ObjectMeta{Name: leaderClusterName, Namespace: ns},
+					Spec:       ecv1alpha1.EtcdClusterSpec{Size: 1, Version: etcdVersion},
+				}
+				if err := r.Create(ctx, ec); err != nil {
+					t.Fatalf("Failed to create EtcdCluster: %s", err)
+				}
+				waitForClusterHealthy(ctx, t, r, ns, leaderClusterName, 1)
+
+				lease := &coordinationv1.Lease{}
+				if err := r.Get(ctx, leaderElectionLease, namespace, lease); err != nil {
+					t.Fatalf("Failed to get the lease of the leader election: %s", err)
+				}
+				leader := leaderPod(lease)
+				if leader == "" {
+					t.Fatal("No replica of the operator holds the leadership")
+				}
+
+				// Without a grace period, the leader can't release the lease,
+				// which the other replica takes over once it expires.
+				pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: leader, Namespace: namespace}}
+				if err := r.Delete(ctx, pod, resources.WithGracePeriod(0)); err != nil {
+					t.Fatalf("Failed to kill the leader %s: %s", leader, err)
+				}
+				t.Logf("Killed the leader %s", leader)
+				if err := wait.For(
+					conditions.New(r).ResourceMatch(lease, func(obj k8s.Object) bool {
+						holder := leaderPod(obj.(*coordinationv1.Lease))
+						return holder != "" && holder != leader
+					}),
+					wait.WithTimeout(2*time.Minute),
+					wait.WithInterval(2*time.Second),
+				); err != nil {
+					t.Fatalf("No replica took over the leadership of %s: %s", leader, err)
+				}
+				t.Logf("%s took over the leadership", leaderPod(lease))
+
+				// The new leader resumes the reconciles.
+				if err := mergePatch(ctx, r, ec, `{"spec":{"size":3}}`); err != nil {
+					t.Fatalf("Failed to scale EtcdCluster: %s", err)
+				}
+				waitForClusterHealthy(ctx, t, r, ns, leaderClusterName, 3)
+				return ctx
+			})
+
+	_ = testEnv.Test(t, feature.Feature())
+}
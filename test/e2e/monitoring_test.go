@@ -0,0 +1,87 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+const monitoredClusterName = "monitored"
+
+func TestServiceMonitor(t *testing.T) {
+	feature := features.New("monitoring/service-monitor").
+		Assess("the members of a cluster with TLS are scraped on their metrics port",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				r := cfg.Client().Resources()
+				_ = ecv1alpha1.AddToScheme(r.GetScheme())
+
+				ns := createTestNamespace(ctx, t, r, "monitoring")
+				defer deleteTestNamespace(ctx, t, r, ns)
+
+				ec := &ecv1alpha1.EtcdCluster{
+					ObjectMeta: metav1.ObjectMeta{Name: monitoredClusterName, Namespace: ns},
+					Spec: ecv1alpha1.EtcdClusterSpec{
+						Size:    3,
+						Version: etcdVersion,
+						TLS:     &ecv1alpha1.TLSCertificate{Provider: ecv1alpha1.TLSProviderAuto},
+						Monitoring: &ecv1alpha1.Monitoring{
+							ServiceMonitor: &ecv1alpha1.ServiceMonitorSpec{Labels: map[string]string{"release": "e2e"}},
+							PrometheusRule: &ecv1alpha1.PrometheusRuleSpec{},
+						},
+					},
+				}
+				if err := r.Create(ctx, ec); err != nil {
+					t.Fatalf("Failed to create EtcdCluster: %s", err)
+				}
+				waitForClusterHealthy(ctx, t, r, ns, monitoredClusterName, 3)
+
+				sm := &unstructured.Unstructured{}
+				sm.SetAPIVersion("monitoring.coreos.com/v1")
+				sm.SetKind("ServiceMonitor")
+				if err := r.Get(ctx, monitoredClusterName, ns, sm); err != nil {
+					t.Fatalf("Failed to get ServiceMonitor: %s", err)
+				}
+				if sm.GetLabels()["release"] != "e2e" {
+					t.Errorf("ServiceMonitor has labels %v, want release=e2e", sm.GetLabels())
+				}
+				endpoints, _, _ := unstructured.NestedSlice(sm.Object, "spec", "endpoints")
+				if len(endpoints) != 1 {
+					t.Fatalf("ServiceMonitor has %d endpoints, want 1", len(endpoints))
+				}
+				if port, _, _ := unstructured.NestedString(endpoints[0].(map[string]any), "port"); port != "metrics" {
+					t.Errorf("ServiceMonitor scrapes the port %q, want metrics", port)
+				}
+
+				rule := &unstructured.Unstructured{}
+				rule.SetAPIVersion("monitoring.coreos.com/v1")
+				rule.SetKind("PrometheusRule")
+				if err := r.Get(ctx, monitoredClusterName, ns, rule); err != nil {
+					t.Fatalf("Failed to get PrometheusRule: %s", err)
+				}
+				return ctx
+			})
+
+	_ = testEnv.Test(t, feature.Feature())
+}
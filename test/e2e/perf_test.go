@@ -0,0 +1,197 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/e2e-framework/klient/k8s"
+	"sigs.k8s.io/e2e-framework/klient/k8s/resources"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/test/perf"
+)
+
+const (
+	perfClusterName = "perf"
+	// perfFromVersion is the version the benchmarked cluster is upgraded
+	// from, to the default version of the operator.
+	perfFromVersion = "v3.5.17"
+	// perfJobTimeout bounds a benchmark, which runs for a minute, and the
+	// scheduling of its Pod.
+	perfJobTimeout = 5 * time.Minute
+)
+
+// perfOperation is an operation of the operator benchmarked while it runs.
+type perfOperation struct {
+	name string
+	size int
+	// run starts the operation on the cluster, nil for the baseline.
+	run func(ctx context.Context, r *resources.Resources, ec *ecv1alpha1.EtcdCluster) error
+}
+
+var perfOperations = []perfOperation{
+	{name: "baseline", size: 3},
+	{
+		name: "scale",
+		size: 5,
+		run: func(ctx context.Context, r *resources.Resources, ec *ecv1alpha1.EtcdCluster) error {
+			return mergePatch(ctx, r, ec, `{"spec":{"size":5}}`)
+		},
+	},
+	{
+		name: "defrag",
+		size: 5,
+		run: func(ctx context.Context, r *resources.Resources, ec *ecv1alpha1.EtcdCluster) error {
+			_, err := perf.StartEtcdctl(ctx, r, ec, "defrag", "defrag", "--cluster")
+			return err
+		},
+	},
+	{
+		name: "upgrade",
+		size: 5,
+		run: func(ctx context.Context, r *resources.Resources, ec *ecv1alpha1.EtcdCluster) error {
+			return mergePatch(ctx, r, ec, fmt.Sprintf(`{"spec":{"version":%q}}`, ecv1alpha1.DefaultEtcdVersion))
+		},
+	},
+}
+
+func mergePatch(ctx context.Context, r *resources.Resources, obj k8s.Object, patch string) error {
+	return r.Patch(ctx, obj, k8s.Patch{PatchType: types.MergePatchType, Data: []byte(patch)})
+}
+
+// TestPerformance benchmarks an EtcdCluster while the operator scales,
+// defragments and upgrades it, and compares the throughput to the one of
+// the idle cluster. It runs for several minutes, so only with E2E_PERF=true.
+// E2E_PERF_PROFILE sets the load (s, m or l, defaults to s),
+// E2E_PERF_MAX_REGRESSION the tolerated drop of throughput (defaults to
+// 0.5), and E2E_PERF_REPORT the file the results are written to as JSON.
+func TestPerformance(t *testing.T) {
+	if os.Getenv("E2E_PERF") != "true" {
+		t.Skip("E2E_PERF isn't set")
+	}
+	profile := perf.ProfileSmall
+	if p := os.Getenv("E2E_PERF_PROFILE"); p != "" {
+		profile = p
+	}
+	maxRegression := 0.5
+	if v := os.Getenv("E2E_PERF_MAX_REGRESSION"); v != "" {
+		var err error
+		if maxRegression, err = strconv.ParseFloat(v, 64); err != nil {
+			t.Fatalf("Invalid E2E_PERF_MAX_REGRESSION: %s", err)
+		}
+	}
+
+	var ns string
+	results := map[string]perf.Result{}
+	feature := features.New("performance").
+		Setup(func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			r := cfg.Client().Resources()
+			_ = ecv1alpha1.AddToScheme(r.GetScheme())
+			_ = batchv1.AddToScheme(r.GetScheme())
+
+			ns = createTestNamespace(ctx, t, r, "perf")
+			ec := &ecv1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: perfClusterName, Namespace: ns},
+				Spec: ecv1alpha1.EtcdClusterSpec{
+					Size:    3,
+					Version: perfFromVersion,
+					// The cluster is scaled beyond the workers of the KinD
+					// cluster of the suite.
+					PodTemplate: &ecv1alpha1.PodTemplate{
+						Scheduling: &ecv1alpha1.PodScheduling{Affinity: &corev1.Affinity{}},
+					},
+				},
+			}
+			if err := r.Create(ctx, ec); err != nil {
+				t.Fatalf("Failed to create EtcdCluster: %s", err)
+			}
+			waitForClusterHealthy(ctx, t, r, ns, perfClusterName, 3)
+			return ctx
+		}).
+		Assess("the throughput holds during the operations of the operator",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				r := cfg.Client().Resources()
+				for _, op := range perfOperations {
+					ec := &ecv1alpha1.EtcdCluster{}
+					if err := r.Get(ctx, perfClusterName, ns, ec); err != nil {
+						t.Fatalf("Failed to get EtcdCluster: %s", err)
+					}
+					job, err := perf.StartBenchmark(ctx, r, ec, op.name, profile)
+					if err != nil {
+						t.Fatalf("Failed to start the %s benchmark: %s", op.name, err)
+					}
+					if op.run != nil {
+						if err := op.run(ctx, r, ec); err != nil {
+							t.Fatalf("Failed to start the %s operation: %s", op.name, err)
+						}
+					}
+
+					// The benchmark fails when the cluster misses the
+					// expectations of the profile, which the regression check
+					// below covers.
+					logs, err := perf.Wait(ctx, r, job, perfJobTimeout)
+					if err != nil && logs == "" {
+						t.Fatalf("The %s benchmark didn't run: %s", op.name, err)
+					}
+					result, err := perf.ParseResult(logs)
+					if err != nil {
+						t.Fatalf("Failed to parse the %s benchmark: %s", op.name, err)
+					}
+					results[op.name] = result
+					t.Logf("%s: %d writes/s, slowest request %s, stddev %s", op.name, result.Throughput, result.Slowest, result.Stddev)
+
+					waitForClusterHealthy(ctx, t, r, ns, perfClusterName, op.size)
+				}
+
+				baseline := results["baseline"].Throughput
+				for name, result := range results {
+					if float64(result.Throughput) < float64(baseline)*(1-maxRegression) {
+						t.Errorf("Throughput during %s is %d writes/s, more than %.0f%% below the baseline of %d writes/s",
+							name, result.Throughput, maxRegression*100, baseline)
+					}
+				}
+				return ctx
+			}).
+		Teardown(func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			if path := os.Getenv("E2E_PERF_REPORT"); path != "" {
+				data, err := json.MarshalIndent(results, "", "  ")
+				if err == nil {
+					err = os.WriteFile(path, data, 0o644)
+				}
+				if err != nil {
+					t.Errorf("Failed to write the report: %s", err)
+				}
+			}
+			deleteTestNamespace(ctx, t, cfg.Client().Resources(), ns)
+			return ctx
+		})
+
+	_ = testEnv.Test(t, feature.Feature())
+}
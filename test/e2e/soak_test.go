@@ -0,0 +1,318 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/e2e-framework/klient/k8s"
+	"sigs.k8s.io/e2e-framework/klient/k8s/resources"
+	"sigs.k8s.io/e2e-framework/klient/wait"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+	"go.etcd.io/etcd-operator/test/chaos"
+	"go.etcd.io/etcd-operator/test/conformance"
+	"go.etcd.io/etcd-operator/test/perf"
+)
+
+const soakClusterSize = 3
+
+// TestSoak loops upgrade, downgrade, scale, backup and restore cycles on
+// fresh EtcdClusters for E2E_SOAK_DURATION, e.g. 4h, and is skipped when it
+// isn't set. Each cycle checks that the members keep their identity through
+// the operations, and that deleting the EtcdCluster leaves nothing behind.
+func TestSoak(t *testing.T) {
+	v := os.Getenv("E2E_SOAK_DURATION")
+	if v == "" {
+		t.Skip("E2E_SOAK_DURATION isn't set")
+	}
+	duration, err := time.ParseDuration(v)
+	if err != nil {
+		t.Fatalf("Invalid E2E_SOAK_DURATION: %s", err)
+	}
+
+	var ns string
+	feature := features.New("soak").
+		Setup(func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			r := cfg.Client().Resources()
+			_ = ecv1alpha1.AddToScheme(r.GetScheme())
+			_ = batchv1.AddToScheme(r.GetScheme())
+			ns = createTestNamespace(ctx, t, r, "soak")
+			return ctx
+		}).
+		Assess("the operator survives repeated cycles of operations",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				r := cfg.Client().Resources()
+				deadline := time.Now().Add(duration)
+				for cycle := 1; time.Now().Before(deadline); cycle++ {
+					start := time.Now()
+					soakCycle(ctx, t, r, ns, cycle)
+					t.Logf("Cycle %d took %s", cycle, time.Since(start).Round(time.Second))
+				}
+				return ctx
+			}).
+		Teardown(func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			deleteTestNamespace(ctx, t, cfg.Client().Resources(), ns)
+			return ctx
+		})
+
+	_ = testEnv.Test(t, feature.Feature())
+}
+
+// soakCycle runs one cycle of the soak test on a new EtcdCluster.
+func soakCycle(ctx context.Context, t *testing.T, r *resources.Resources, ns string, cycle int) {
+	t.Helper()
+	name := fmt.Sprintf("soak-%d", cycle)
+	ec := &ecv1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+		Spec: ecv1alpha1.EtcdClusterSpec{
+			Size:        soakClusterSize,
+			Version:     perfFromVersion,
+			StorageSpec: &ecv1alpha1.StorageSpec{VolumeSizeRequest: resource.MustParse("1Gi")},
+		},
+	}
+	if err := r.Create(ctx, ec); err != nil {
+		t.Fatalf("Failed to create EtcdCluster %s: %s", name, err)
+	}
+	waitForMembers(ctx, t, r, ns, name, soakClusterSize, perfFromVersion)
+	members := soakMemberIDs(ctx, t, r, ns, name, "initial")
+
+	// upgrade, then downgrade
+	for _, version := range []string{ecv1alpha1.DefaultEtcdVersion, perfFromVersion} {
+		if err := mergePatch(ctx, r, ec, fmt.Sprintf(`{"spec":{"version":%q}}`, version)); err != nil {
+			t.Fatalf("Failed to set the version of EtcdCluster %s to %s: %s", name, version, err)
+		}
+		waitForMembers(ctx, t, r, ns, name, soakClusterSize, version)
+		assertSameMembers(t, members, soakMemberIDs(ctx, t, r, ns, name, "version-"+strings.ReplaceAll(version, ".", "-")))
+	}
+
+	// scale out, then in
+	for _, size := range []int{soakClusterSize + 2, soakClusterSize} {
+		if err := mergePatch(ctx, r, ec, fmt.Sprintf(`{"spec":{"size":%d}}`, size)); err != nil {
+			t.Fatalf("Failed to scale EtcdCluster %s to %d: %s", name, size, err)
+		}
+		waitForMembers(ctx, t, r, ns, name, size, perfFromVersion)
+		scaled := soakMemberIDs(ctx, t, r, ns, name, fmt.Sprintf("size-%d", size))
+		for member, id := range members {
+			if scaled[member] != id {
+				t.Errorf("Member %s of EtcdCluster %s has ID %s after scaling to %d, expected %s", member, name, scaled[member], size, id)
+			}
+		}
+	}
+
+	soakBackupRestore(ctx, t, r, ec)
+
+	// Nothing is left once the EtcdCluster is deleted.
+	if err := r.Delete(ctx, ec); err != nil {
+		t.Fatalf("Failed to delete EtcdCluster %s: %s", name, err)
+	}
+	if err := wait.For(func(ctx context.Context) (bool, error) {
+		err := r.Get(ctx, name, ns, &ecv1alpha1.EtcdCluster{})
+		if k8serrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}, wait.WithTimeout(clusterTimeout), wait.WithInterval(5*time.Second)); err != nil {
+		stuck := &ecv1alpha1.EtcdCluster{}
+		_ = r.Get(ctx, name, ns, stuck)
+		t.Fatalf("EtcdCluster %s is stuck deleting with finalizers %v: %s", name, stuck.Finalizers, err)
+	}
+	assertNoLeftovers(ctx, t, r, ns, name)
+}
+
+// waitForMembers waits for the given number of members of an EtcdCluster to
+// run the given version, and for the operator to report them healthy.
+func waitForMembers(ctx context.Context, t *testing.T, r *resources.Resources, ns, name string, size int, version string) {
+	t.Helper()
+	if err := conformance.WaitForVersion(ctx, r, ns, name, size, version, clusterTimeout); err != nil {
+		t.Fatal(err)
+	}
+	waitForClusterHealthy(ctx, t, r, ns, name, size)
+}
+
+// runEtcdctl runs etcdctl with the given arguments against the members of
+// the EtcdCluster, and returns its output.
+func runEtcdctl(ctx context.Context, t *testing.T, r *resources.Resources, ns, name, suffix string, args ...string) string {
+	t.Helper()
+	ec := &ecv1alpha1.EtcdCluster{}
+	if err := r.Get(ctx, name, ns, ec); err != nil {
+		t.Fatalf("Failed to get EtcdCluster %s: %s", name, err)
+	}
+	job, err := perf.StartEtcdctl(ctx, r, ec, suffix, args...)
+	if err != nil {
+		t.Fatalf("Failed to run etcdctl %s: %s", strings.Join(args, " "), err)
+	}
+	logs, err := perf.Wait(ctx, r, job, clusterTimeout)
+	if err != nil {
+		t.Fatalf("Failed to run etcdctl %s: %s\n%s", strings.Join(args, " "), err, logs)
+	}
+	deleteJob(ctx, t, r, job)
+	return logs
+}
+
+func deleteJob(ctx context.Context, t *testing.T, r *resources.Resources, job *batchv1.Job) {
+	t.Helper()
+	if err := r.Delete(ctx, job, resources.WithDeletePropagation(string(metav1.DeletePropagationForeground))); err != nil {
+		t.Errorf("Failed to delete Job %s: %s", job.Name, err)
+	}
+}
+
+// soakMemberIDs returns the IDs of the members of an EtcdCluster, by name.
+func soakMemberIDs(ctx context.Context, t *testing.T, r *resources.Resources, ns, name, step string) map[string]string {
+	t.Helper()
+	out := runEtcdctl(ctx, t, r, ns, name, "members-"+step, "member", "list", "-w", "json")
+	var list struct {
+		Members []struct {
+			ID   uint64 `json:"ID"`
+			Name string `json:"name"`
+		} `json:"members"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		t.Fatalf("Failed to parse the members of EtcdCluster %s: %s\n%s", name, err, out)
+	}
+	ids := make(map[string]string, len(list.Members))
+	for _, m := range list.Members {
+		ids[m.Name] = fmt.Sprintf("%x", m.ID)
+	}
+	return ids
+}
+
+func assertSameMembers(t *testing.T, want, got map[string]string) {
+	t.Helper()
+	if len(want) != len(got) {
+		t.Errorf("Members changed from %v to %v", want, got)
+		return
+	}
+	for member, id := range want {
+		if got[member] != id {
+			t.Errorf("Member %s has ID %s, expected %s", member, got[member], id)
+		}
+	}
+}
+
+// soakBackupRestore writes a key, saves a snapshot of ec, and restores it to
+// a new data directory. The operator can't restore an EtcdCluster from a
+// snapshot, so the restore is checked offline, with etcdutl.
+func soakBackupRestore(ctx context.Context, t *testing.T, r *resources.Resources, ec *ecv1alpha1.EtcdCluster) {
+	t.Helper()
+	runEtcdctl(ctx, t, r, ec.Namespace, ec.Name, "put", "put", "soak/"+ec.Name, time.Now().Format(time.RFC3339))
+
+	if err := r.Get(ctx, ec.Name, ec.Namespace, ec); err != nil {
+		t.Fatalf("Failed to get EtcdCluster %s: %s", ec.Name, err)
+	}
+	image := fmt.Sprintf("gcr.io/etcd-development/etcd:%s", ec.Spec.Version)
+	mounts := []corev1.VolumeMount{{Name: "snapshot", MountPath: "/snapshot"}}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: ec.Name + "-backup-restore", Namespace: ec.Namespace},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](0),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					InitContainers: []corev1.Container{{
+						Name:         "backup",
+						Image:        image,
+						Command:      []string{"/usr/local/bin/etcdctl", "snapshot", "save", "/snapshot/snapshot.db"},
+						Env:          []corev1.EnvVar{{Name: "ETCDCTL_ENDPOINTS", Value: ec.Status.Endpoints}},
+						VolumeMounts: mounts,
+					}},
+					Containers: []corev1.Container{{
+						Name:         "restore",
+						Image:        image,
+						Command:      []string{"/usr/local/bin/etcdutl", "snapshot", "restore", "/snapshot/snapshot.db", "--data-dir", "/snapshot/restored"},
+						VolumeMounts: mounts,
+					}},
+					Volumes: []corev1.Volume{{Name: "snapshot", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+				},
+			},
+		},
+	}
+	if err := r.Create(ctx, job); err != nil {
+		t.Fatalf("Failed to create the backup Job of EtcdCluster %s: %s", ec.Name, err)
+	}
+	if logs, err := perf.Wait(ctx, r, job, clusterTimeout); err != nil {
+		t.Fatalf("Failed to back up and restore EtcdCluster %s: %s\n%s", ec.Name, err, logs)
+	}
+	deleteJob(ctx, t, r, job)
+}
+
+// assertNoLeftovers checks that the workloads, and the volumes, of a deleted
+// EtcdCluster are gone.
+func assertNoLeftovers(ctx context.Context, t *testing.T, r *resources.Resources, ns, name string) {
+	t.Helper()
+	leftovers := func(ctx context.Context) ([]string, error) {
+		var found []string
+		workloads := []struct {
+			kind, name string
+			obj        k8s.Object
+		}{
+			{"StatefulSet", name, &appsv1.StatefulSet{}},
+			{"Service", name, &corev1.Service{}},
+			{"ConfigMap", name + "-state", &corev1.ConfigMap{}},
+		}
+		for _, w := range workloads {
+			err := r.Get(ctx, w.name, ns, w.obj)
+			if err == nil {
+				found = append(found, w.kind+" "+w.name)
+			} else if !k8serrors.IsNotFound(err) {
+				return nil, err
+			}
+		}
+
+		pods, err := chaos.Members(ctx, r, ns, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			found = append(found, "Pod "+pod.Name)
+		}
+		pvcs := &corev1.PersistentVolumeClaimList{}
+		if err := r.WithNamespace(ns).List(ctx, pvcs); err != nil {
+			return nil, err
+		}
+		for _, pvc := range pvcs.Items {
+			if strings.HasPrefix(pvc.Name, "etcd-data-"+name+"-") {
+				found = append(found, "PersistentVolumeClaim "+pvc.Name)
+			}
+		}
+		return found, nil
+	}
+
+	var found []string
+	if err := wait.For(func(ctx context.Context) (bool, error) {
+		var err error
+		found, err = leftovers(ctx)
+		return len(found) == 0, err
+	}, wait.WithTimeout(clusterTimeout), wait.WithInterval(5*time.Second)); err != nil {
+		t.Errorf("EtcdCluster %s left %v behind: %s", name, found, err)
+	}
+}
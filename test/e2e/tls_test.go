@@ -0,0 +1,109 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/e2e-framework/klient/k8s/resources"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+const tlsClusterName = "tls"
+
+// newCertManagerObject returns a cert-manager object of the given kind and
+// spec.
+func newCertManagerObject(kind, name, ns string, spec map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	obj.SetAPIVersion("cert-manager.io/v1")
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace(ns)
+	return obj
+}
+
+// createCAIssuer creates the Issuer etcd-ca in ns, signing with a CA issued
+// by a self-signed Issuer.
+func createCAIssuer(ctx context.Context, t *testing.T, r *resources.Resources, ns string) {
+	t.Helper()
+	for _, obj := range []*unstructured.Unstructured{
+		newCertManagerObject("Issuer", "self-signed", ns, map[string]any{"selfSigned": map[string]any{}}),
+		newCertManagerObject("Certificate", "etcd-ca", ns, map[string]any{
+			"isCA":       true,
+			"commonName": "etcd-ca",
+			"secretName": "etcd-ca",
+			"issuerRef":  map[string]any{"name": "self-signed", "kind": "Issuer"},
+		}),
+		newCertManagerObject("Issuer", "etcd-ca", ns, map[string]any{"ca": map[string]any{"secretName": "etcd-ca"}}),
+	} {
+		if err := r.Create(ctx, obj); err != nil {
+			t.Fatalf("Failed to create %s %s: %s", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+}
+
+func TestCertManagerTLS(t *testing.T) {
+	feature := features.New("tls/cert-manager").
+		Assess("the members serve TLS with the certificates of cert-manager",
+			func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+				r := cfg.Client().Resources()
+				_ = ecv1alpha1.AddToScheme(r.GetScheme())
+
+				ns := createTestNamespace(ctx, t, r, "tls")
+				defer deleteTestNamespace(ctx, t, r, ns)
+				createCAIssuer(ctx, t, r, ns)
+
+				ec := &ecv1alpha1.EtcdCluster{
+					ObjectMeta: metav1.ObjectMeta{Name: tlsClusterName, Namespace: ns},
+					Spec: ecv1alpha1.EtcdClusterSpec{
+						Size:    3,
+						Version: etcdVersion,
+						TLS: &ecv1alpha1.TLSCertificate{
+							Provider: ecv1alpha1.TLSProviderCertManager,
+							ProviderCfg: ecv1alpha1.ProviderConfig{
+								CertManagerCfg: &ecv1alpha1.ProviderCertManagerConfig{
+									IssuerRef: ecv1alpha1.CertManagerIssuerReference{Name: "etcd-ca"},
+								},
+							},
+						},
+					},
+				}
+				if err := r.Create(ctx, ec); err != nil {
+					t.Fatalf("Failed to create EtcdCluster: %s", err)
+				}
+				waitForClusterHealthy(ctx, t, r, ns, tlsClusterName, 3)
+
+				if err := r.Get(ctx, tlsClusterName, ns, ec); err != nil {
+					t.Fatalf("Failed to get EtcdCluster: %s", err)
+				}
+				for _, endpoint := range strings.Split(ec.Status.Endpoints, ",") {
+					if !strings.HasPrefix(endpoint, "https://") {
+						t.Errorf("Endpoint %s isn't served over TLS", endpoint)
+					}
+				}
+				return ctx
+			})
+
+	_ = testEnv.Test(t, feature.Feature())
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package perf runs etcd benchmarks against the EtcdClusters of the e2e
+// tests, to measure the overhead of the operations of the operator on the
+// clients of the clusters.
+package perf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/e2e-framework/klient/k8s"
+	"sigs.k8s.io/e2e-framework/klient/k8s/resources"
+	"sigs.k8s.io/e2e-framework/klient/wait"
+	"sigs.k8s.io/e2e-framework/klient/wait/conditions"
+
+	ecv1alpha1 "go.etcd.io/etcd-operator/api/v1alpha1"
+)
+
+// Profiles of `etcdctl check perf`, from the lightest to the heaviest. Each
+// benchmark runs for one minute.
+const (
+	ProfileSmall  = "s"
+	ProfileMedium = "m"
+	ProfileLarge  = "l"
+)
+
+// Result is the outcome of a benchmark.
+type Result struct {
+	// Throughput is the number of writes per second.
+	Throughput int `json:"throughput"`
+	// Slowest is the latency of the slowest request.
+	Slowest time.Duration `json:"slowest"`
+	// Stddev is the standard deviation of the latencies.
+	Stddev time.Duration `json:"stddev"`
+	// Passed reports whether the cluster met the expectations of the
+	// profile.
+	Passed bool `json:"passed"`
+}
+
+var (
+	throughputRe = regexp.MustCompile(`Throughput (?:is|too low:) (\d+) writes/s`)
+	slowestRe    = regexp.MustCompile(`Slowest request took (?:too long: )?([0-9.]+)s`)
+	stddevRe     = regexp.MustCompile(`Stddev (?:is|too high:) ([0-9.]+)s`)
+	verdictRe    = regexp.MustCompile(`(?m)^(PASS|FAIL)$`)
+)
+
+// ParseResult parses the output of `etcdctl check perf`.
+func ParseResult(out string) (Result, error) {
+	var r Result
+	m := throughputRe.FindStringSubmatch(out)
+	if m == nil {
+		return r, fmt.Errorf("no throughput in the benchmark output: %q", out)
+	}
+	r.Throughput, _ = strconv.Atoi(m[1])
+
+	var err error
+	if r.Slowest, err = parseSeconds(slowestRe, out); err != nil {
+		return r, err
+	}
+	if r.Stddev, err = parseSeconds(stddevRe, out); err != nil {
+		return r, err
+	}
+	m = verdictRe.FindStringSubmatch(out)
+	r.Passed = m != nil && m[1] == "PASS"
+	return r, nil
+}
+
+func parseSeconds(re *regexp.Regexp, out string) (time.Duration, error) {
+	m := re.FindStringSubmatch(out)
+	if m == nil {
+		return 0, fmt.Errorf("no match for %s in the benchmark output", re)
+	}
+	s, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(s * float64(time.Second)), nil
+}
+
+// StartEtcdctl starts a Job, named after ec and suffix, running etcdctl with
+// the given arguments against the members of ec. ec must be initialized, and
+// serve its clients in plain HTTP.
+func StartEtcdctl(ctx context.Context, r *resources.Resources, ec *ecv1alpha1.EtcdCluster, suffix string, args ...string) (*batchv1.Job, error) {
+	if ec.Status.Endpoints == "" {
+		return nil, fmt.Errorf("EtcdCluster %s/%s has no endpoints yet", ec.Namespace, ec.Name)
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: ec.Name + "-" + suffix, Namespace: ec.Namespace},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](0),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:    "etcdctl",
+						Image:   fmt.Sprintf("gcr.io/etcd-development/etcd:%s", ec.Spec.Version),
+						Command: append([]string{"/usr/local/bin/etcdctl"}, args...),
+						Env: []corev1.EnvVar{
+							{Name: "ETCDCTL_API", Value: "3"},
+							{Name: "ETCDCTL_ENDPOINTS", Value: ec.Status.Endpoints},
+						},
+					}},
+				},
+			},
+		},
+	}
+	if err := r.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// StartBenchmark starts `etcdctl check perf` with the given profile against
+// the members of ec, in a Job named after ec and name, see StartEtcdctl.
+func StartBenchmark(ctx context.Context, r *resources.Resources, ec *ecv1alpha1.EtcdCluster, name, profile string) (*batchv1.Job, error) {
+	return StartEtcdctl(ctx, r, ec, "perf-"+name, "check", "perf", "--load="+profile)
+}
+
+// Wait waits for job to finish, and returns the logs of its Pod. The error
+// is set when the Job failed, in which case the logs are still returned.
+func Wait(ctx context.Context, r *resources.Resources, job *batchv1.Job, timeout time.Duration) (string, error) {
+	if err := wait.For(
+		conditions.New(r).ResourceMatch(job, func(obj k8s.Object) bool {
+			j, ok := obj.(*batchv1.Job)
+			return ok && (j.Status.Succeeded > 0 || j.Status.Failed > 0)
+		}),
+		wait.WithTimeout(timeout),
+		wait.WithInterval(5*time.Second),
+	); err != nil {
+		return "", fmt.Errorf("Job %s didn't finish: %w", job.Name, err)
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.WithNamespace(job.Namespace).List(ctx, pods, resources.WithLabelSelector("job-name="+job.Name)); err != nil {
+		return "", err
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("Job %s has no Pod", job.Name)
+	}
+	clientset, err := kubernetes.NewForConfig(r.GetConfig())
+	if err != nil {
+		return "", err
+	}
+	stream, err := clientset.CoreV1().Pods(job.Namespace).GetLogs(pods.Items[0].Name, &corev1.PodLogOptions{}).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+	logs, err := io.ReadAll(stream)
+	if err != nil {
+		return "", err
+	}
+
+	if job.Status.Failed > 0 {
+		return string(logs), fmt.Errorf("Job %s failed", job.Name)
+	}
+	return string(logs), nil
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package perf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseResult(t *testing.T) {
+	r, err := ParseResult(` 60 / 60 Boooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooo! 100.00% 1m0s
+PASS: Throughput is 151 writes/s
+PASS: Slowest request took 0.087015s
+PASS: Stddev is 0.001981s
+PASS
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Throughput: 151, Slowest: 87015 * time.Microsecond, Stddev: 1981 * time.Microsecond, Passed: true}, r)
+
+	r, err = ParseResult(`FAIL: Throughput too low: 98 writes/s
+FAIL: Slowest request took too long: 1.200000s
+PASS: Stddev is 0.020000s
+FAIL
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Throughput: 98, Slowest: 1200 * time.Millisecond, Stddev: 20 * time.Millisecond}, r)
+
+	_, err = ParseResult("Error: context deadline exceeded\n")
+	assert.ErrorContains(t, err, "no throughput")
+}